@@ -0,0 +1,103 @@
+// Command admins manages platform admin accounts from the command line, for
+// example to create the first admin or to recover a locked-out one.
+//
+//	admins create EMAIL NAME [config flags]
+//	admins reset-password EMAIL [config flags]
+//	admins reset-totp EMAIL [config flags]
+//	admins enable EMAIL [config flags]
+//
+// create and reset-password read the password from the first line of
+// standard input. reset-totp turns TOTP off so the admin can set it up again
+// after losing their device. Changes are recorded in the admin audit log as
+// made by the system.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"lynkr/internal/services"
+	"lynkr/pkg/config"
+	"lynkr/pkg/database"
+)
+
+func main() {
+	if len(os.Args) < 3 {
+		usage()
+	}
+	command, email := os.Args[1], os.Args[2]
+	args := os.Args[3:]
+
+	var name string
+	switch command {
+	case "create":
+		if len(args) < 1 {
+			usage()
+		}
+		name, args = args[0], args[1:]
+	case "reset-password", "reset-totp", "enable":
+	default:
+		usage()
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	keyring, err := cfg.Keyring()
+	if err != nil {
+		log.Fatalf("Failed to initialize keyring: %v", err)
+	}
+	if err := database.Initialize(database.Config{
+		DBPath:        cfg.Database.Path,
+		MigrationsDir: cfg.Database.MigrationsDir,
+	}); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer database.Close()
+
+	admins := services.NewAdminService(database.DB, keyring, services.AdminOptions{})
+	system := services.AdminActor{}
+
+	if command == "create" {
+		admin, err := admins.CreateAdmin(system, email, name, readPassword())
+		if err != nil {
+			log.Fatalf("Failed to create admin %s: %v", email, err)
+		}
+		log.Printf("Created admin %s (%s)", admin.Email, admin.ID)
+		return
+	}
+
+	admin, err := admins.GetAdminByEmail(email)
+	if err != nil {
+		log.Fatalf("Failed to find admin %s: %v", email, err)
+	}
+	switch command {
+	case "reset-password":
+		err = admins.ResetPassword(system, admin.ID, readPassword())
+	case "reset-totp":
+		err = admins.DisableTOTP(system, admin.ID, "")
+	case "enable":
+		_, err = admins.SetAdminDisabled(system, admin.ID, false)
+	}
+	if err != nil {
+		log.Fatalf("Failed to %s for %s: %v", command, email, err)
+	}
+	log.Printf("Done: %s for %s", command, admin.Email)
+}
+
+func readPassword() string {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatalf("Failed to read password from standard input: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: admins create EMAIL NAME | reset-password EMAIL | reset-totp EMAIL | enable EMAIL [config flags]")
+	os.Exit(2)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// lifecycle owns the root context of the process. Background jobs started
+// with Go run until that context is cancelled once the HTTP server has drained.
+type lifecycle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycle{ctx: ctx, cancel: cancel}
+}
+
+// Go runs a background job until the lifecycle context is cancelled
+func (l *lifecycle) Go(name string, job func(ctx context.Context)) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		job(l.ctx)
+		log.Printf("Background job %s stopped", name)
+	}()
+}
+
+// Run serves HTTP until SIGINT or SIGTERM, then drains in-flight requests,
+// and cancels background jobs within timeout
+func (l *lifecycle) Run(server *http.Server, timeout time.Duration) error {
+	signals, stopSignals := signal.NotifyContext(l.ctx, os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
+
+	var runErr error
+	select {
+	case <-signals.Done():
+		log.Println("Shutdown signal received")
+	case err := <-serverErr:
+		runErr = err
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Stop accepting connections and let in-flight requests finish
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown error: %v", err)
+	}
+
+	// Cancel background jobs and wait for them to return
+	l.cancel()
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		log.Println("Timed out waiting for background jobs")
+	}
+
+	return runErr
+}
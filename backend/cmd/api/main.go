@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
+	"os"
 	// "path/filepath"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
+	"lynkr/internal/analytics"
+	"lynkr/internal/auth"
 	// ginSwagger "github.com/swaggo/gin-swagger"
 	"lynkr/internal/handlers"
+	"lynkr/internal/jobs"
 
 	// "github.com/lynkr/brand-activations/backend/internal/middleware"
 	"lynkr/internal/middleware"
@@ -21,9 +27,13 @@ import (
 	"lynkr/internal/services/user"
 	"lynkr/internal/ux"
 
+	"lynkr/pkg/config"
 	"lynkr/pkg/database"
+	"lynkr/pkg/mail"
+	"lynkr/pkg/money"
 	// "lynkr/pkg/geofencing"
 	"lynkr/pkg/privacy"
+	"lynkr/pkg/storage"
 
 	ginSwagger "github.com/swaggo/gin-swagger"
 
@@ -42,23 +52,76 @@ import (
 // @name Authorization
 
 func main() {
+	// Load configuration
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	log.Printf("Starting in %s mode", cfg.Environment)
+
 	// Initialize database
 	dbConfig := database.Config{
-		DBPath:        "./data/brand_activations.db",
-		MigrationsDir: "",
+		DBPath:        cfg.Database.Path,
+		MigrationsDir: cfg.Database.MigrationsDir,
 	}
 
 	if err := database.Initialize(dbConfig); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
-	defer database.Close()
+
+	// Background jobs and services with goroutines are registered here and
+	// stopped in order on SIGTERM
+	lc := newLifecycle()
 
 	// Initialize privacy components
-	anonymizer := privacy.NewAnonymizer("brand-activations-salt")
+	anonymizer := privacy.NewAnonymizer(cfg.Privacy.AnonymizerSalt)
 	retentionManager := privacy.NewRetentionManager(database.DB, anonymizer)
 
-	// Schedule data retention job to run daily
-	retentionManager.ScheduleRetentionJob(24 * time.Hour)
+	// Schedule data retention job
+	lc.Go("data retention", func(ctx context.Context) {
+		retentionManager.RunRetentionJob(ctx, cfg.Privacy.RetentionInterval.Duration)
+	})
+
+	// Initialize the background job queue
+	jobQueue := jobs.NewQueue(database.DB, cfg.Jobs.PollInterval.Duration)
+	for queue, workers := range cfg.Jobs.Concurrency {
+		jobQueue.SetConcurrency(queue, workers)
+	}
+
+	// Initialize the keyring that encrypts stored integration credentials and admin TOTP secrets
+	keyring, err := cfg.Keyring()
+	if err != nil {
+		log.Fatalf("Failed to initialize keyring: %v", err)
+	}
+
+	// Single sign-on for brand members is optional
+	ssoProvider, err := cfg.SSOProvider()
+	if err != nil {
+		log.Fatalf("Failed to initialize single sign-on: %v", err)
+	}
+
+	// Initialize the token service with the JWT signing keys
+	signingKeys, activeKeyID := cfg.SigningKeys()
+	keySet, err := auth.NewKeySet(signingKeys, activeKeyID)
+	if err != nil {
+		log.Fatalf("Failed to initialize signing keys: %v", err)
+	}
+	tokenService := auth.NewTokenService(database.DB, keySet, auth.TokenOptions{
+		AccessTTL:  cfg.Auth.AccessTokenTTL.Duration,
+		RefreshTTL: cfg.Auth.RefreshTokenTTL.Duration,
+	})
+
+	// Initialize the mail sender for member invitations
+	mailSender, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to initialize mail: %v", err)
+	}
+
+	// Initialize export file storage
+	exportStorage, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
 
 	// Initialize services
 	userService := user.NewUserService(database.DB)
@@ -67,24 +130,89 @@ func main() {
 	contentService := content.NewContentService(database.DB)
 	// content1Service := services.NewContentService(database.DB)
 	brandService := services.NewBrandService(database.DB)
+	brandMemberService := services.NewBrandMemberService(database.DB, mailSender, services.MemberOptions{
+		PortalURL:     cfg.Brands.PortalURL,
+		InvitationTTL: cfg.Brands.InvitationTTL.Duration,
+	})
+	brandAuditService := services.NewBrandAuditService(database.DB)
+	adminService := services.NewAdminService(database.DB, keyring, services.AdminOptions{})
+	adminAuditService := services.NewAdminAuditService(database.DB)
+	adminConsoleService := services.NewAdminConsoleService(database.DB)
+	organizerService := services.NewOrganizerService(database.DB)
+	brandSSOService := services.NewBrandSSOService(database.DB, ssoProvider, brandMemberService, services.SSOOptions{
+		PortalURL:            cfg.Brands.PortalURL,
+		AllowUnverifiedEmail: cfg.SSO.AllowUnverifiedEmail,
+	})
+	apiKeyService := services.NewAPIKeyService(database.DB, services.APIKeyOptions{
+		DefaultTTL: cfg.Brands.APIKeyTTL.Duration,
+		MaxTTL:     cfg.Brands.APIKeyMaxTTL.Duration,
+	})
+	campaignService := services.NewCampaignService(database.DB)
+	dashboardService := services.NewDashboardService(database.DB, brandService)
 	feedbackService := services.NewFeedbackService(database.DB)
 	sentimentService := services.NewSentimentService(database.DB)
 	analyticsService := services.NewAnalyticsService(database.DB)
-	ecommerceService := services.NewEcommerceService(database.DB)
+	ecommerceService := services.NewEcommerceService(database.DB, jobQueue, keyring, services.EcommerceOptions{
+		PublicBaseURL: cfg.Exports.PublicBaseURL,
+	})
 	discountService := services.NewDiscountService(database.DB)
+	currencyService := services.NewCurrencyService(database.DB)
 	pixelService := services.NewPixelService(database.DB)
-	aiTaggingService := services.NewAITaggingService(database.DB)
+	aiTaggingService := services.NewAITaggingService(database.DB, jobQueue)
 	conversionFunnelService := services.NewConversionFunnelService(database.DB)
+	attributionService := services.NewAttributionService(database.DB)
 	rewardsService := services.NewRewardsService(database.DB)
 	pulseSurveyService := services.NewPulseSurveyService(database.DB)
-	exportService := services.NewExportService(database.DB)
-	crmIntegrationService := services.NewCRMIntegrationService(database.DB)
+	exportService := services.NewExportService(database.DB, jobQueue, exportStorage,
+		storage.NewURLSigner(cfg.Exports.DownloadSecret), services.ExportOptions{
+			BaseURL:               cfg.Exports.PublicBaseURL,
+			LinkTTL:               cfg.Exports.DownloadLinkTTL.Duration,
+			SFTPDropDir:           cfg.Exports.SFTPDropDir,
+			AllowInsecureWebhooks: cfg.Environment == config.EnvDevelopment,
+			AllowPrivateWebhooks:  cfg.Environment == config.EnvDevelopment,
+		})
+	crmIntegrationService := services.NewCRMIntegrationService(database.DB, jobQueue, keyring, services.CRMOptions{
+		AllowInsecureBaseURLs: cfg.Environment == config.EnvDevelopment,
+		PublicBaseURL:         cfg.Exports.PublicBaseURL,
+	})
+
+	if cfg.Currency.RatesFile != "" {
+		rates, err := money.LoadRates(cfg.Currency.RatesFile)
+		if err != nil {
+			log.Fatalf("Failed to read exchange rates: %v", err)
+		}
+		if err := currencyService.LoadExchangeRates(rates); err != nil {
+			log.Fatalf("Failed to load exchange rates: %v", err)
+		}
+	}
+
+	// All job handlers are registered by the services above
+	if err := crmIntegrationService.ResumeSchedules(); err != nil {
+		log.Printf("Failed to resume CRM syncs: %v", err)
+	}
+	if err := exportService.ResumeSchedules(); err != nil {
+		log.Printf("Failed to resume export schedules: %v", err)
+	}
+	if err := ecommerceService.ResumeSchedules(); err != nil {
+		log.Printf("Failed to resume store syncs: %v", err)
+	}
+	lc.Go("job queue", jobQueue.Run)
+	lc.Go("token purge", func(ctx context.Context) {
+		tokenService.RunPurge(ctx, time.Hour)
+	})
+	lc.Go("export cleanup", func(ctx context.Context) {
+		exportService.RunExpiredExportCleanup(ctx, cfg.Exports.CleanupInterval.Duration)
+	})
+
+	aggregator := analytics.NewAggregator(database.DB)
+	lc.Go("analytics aggregation", aggregator.RunBatchProcessing)
 	// geofenceService := geofencing.NewGeofenceService()
 	// geofenceService, _ := geofencing.ParseGeofenceData("./data/geofence.json")
 
 	// Initialize performance components
 	dbOptimizer := performance.NewDatabaseOptimizer(database.DB)
 	cache := performance.NewCache()
+	lc.Go("cache cleanup", cache.RunCleanup)
 	loadTester := performance.NewLoadTester()
 
 	// Initialize security components
@@ -97,20 +225,28 @@ func main() {
 	// Initialize handlers
 	// userHandler := handlers.NewUserHandler(userService)
 	// eventHandler := handlers.NewEventHandler(eventService, geofenceService)
-	handler := handlers.NewHandler(userService, eventService, contentService)
+	handler := handlers.NewHandler(userService, eventService, contentService, tokenService)
 	// contentHandler := handlers.NewContentHandler(content1Service)
-	brandHandler := handlers.NewBrandHandler(brandService, "brand-activations-secret-key")
+	brandHandler := handlers.NewBrandHandler(brandService, campaignService, dashboardService)
+	brandMemberHandler := handlers.NewBrandMemberHandler(brandMemberService, brandAuditService, tokenService)
 	feedbackHandler := handlers.NewFeedbackHandler(feedbackService, sentimentService)
 	analyticsHandler := handlers.NewAnalyticsHandler(analyticsService)
 	ecommerceHandler := handlers.NewEcommerceHandler(ecommerceService)
 	discountHandler := handlers.NewDiscountHandler(discountService)
+	currencyHandler := handlers.NewCurrencyHandler(currencyService)
 	pixelHandler := handlers.NewPixelHandler(pixelService)
-	advancedAnalyticsHandler := handlers.NewAdvancedAnalyticsHandler(aiTaggingService, conversionFunnelService)
+	advancedAnalyticsHandler := handlers.NewAdvancedAnalyticsHandler(aiTaggingService, conversionFunnelService, attributionService)
 	rewardsHandler := handlers.NewRewardsHandler(rewardsService, pulseSurveyService)
 	exportHandler := handlers.NewExportHandler(exportService, crmIntegrationService)
 	performanceHandler := handlers.NewPerformanceHandler(dbOptimizer, cache, loadTester)
 	securityHandler := handlers.NewSecurityHandler(securityAudit, privacyEnhancer)
+	jobsHandler := handlers.NewJobsHandler(jobQueue)
 	uxHandler := handlers.NewUXHandler(usabilityTester)
+	authHandler := handlers.NewAuthHandler(tokenService)
+	adminHandler := handlers.NewAdminHandler(adminService, adminAuditService, securityAudit, tokenService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	brandSSOHandler := handlers.NewBrandSSOHandler(brandSSOService, brandMemberHandler)
+	adminConsoleHandler := handlers.NewAdminConsoleHandler(adminConsoleService, organizerService, brandMemberService, securityAudit, tokenService)
 
 	// Setup database optimization
 	dbOptimizer.SetupConnectionPool()
@@ -121,18 +257,21 @@ func main() {
 	privacyEnhancer.ImplementDataRetention()
 
 	// Initialize Gin
+	if cfg.IsProduction() {
+		gin.SetMode(gin.ReleaseMode)
+	}
 	r := gin.Default()
 
 	// Apply global middleware
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:8081", "http://localhost:3000"},
+		AllowOrigins:     cfg.Server.CORSOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 	}))
 	r.Use(gin.Recovery())
-	r.Use(middleware.RateLimitMiddleware(100, time.Minute)) // 100 requests per minute
+	r.Use(middleware.RateLimitMiddleware(cfg.Server.RateLimitPerMinute, time.Minute))
 
 	// API routes
 	api := r.Group("/api/v1")
@@ -140,14 +279,27 @@ func main() {
 	//public routes (no authentication required)
 	api.POST("/users/register", handler.CreateUser)
 	api.POST("/users/login", handler.Login)
-	api.POST("/brands/login", brandHandler.Login)
+	api.POST("/brands/login", brandMemberHandler.Login)
+	api.POST("/brands/invitations/preview", brandMemberHandler.PreviewInvitation)
+	api.POST("/brands/invitations/accept", brandMemberHandler.AcceptInvitation)
+	api.GET("/brands/sso", brandSSOHandler.GetSSOConfig)
+	api.GET("/brands/sso/start", brandSSOHandler.StartSSO)
+	api.GET("/brands/sso/callback", brandSSOHandler.SSOCallback)
+	api.POST("/brands/sso/exchange", brandSSOHandler.ExchangeSSOCode)
+	api.POST("/auth/refresh", authHandler.Refresh)
+	api.POST("/admin/login", adminHandler.Login)
 	api.POST("/webhooks/:integrationId", ecommerceHandler.HandleWebhook)
+	api.POST("/webhooks/crm/:integrationId", exportHandler.HandleCRMWebhook)
+	api.GET("/webhooks/crm/:integrationId", exportHandler.VerifyCRMWebhook)
 	api.GET("/pixel/track", pixelHandler.TrackPixel)
 	api.POST("/conversions/track", advancedAnalyticsHandler.TrackConversion)
 
+	//any authenticated principal
+	api.POST("/auth/logout", middleware.AuthMiddleware(tokenService), authHandler.Logout)
+
 	//user only routes
 	userRoutes := r.Group("/user/v1")
-	userRoutes.Use(middleware.AuthMiddleware())
+	userRoutes.Use(middleware.AuthMiddleware(tokenService))
 	userRoutes.Use(middleware.UserOnlyMiddleware())
 	userRoutes.PUT("/users/privacy", securityHandler.UpdatePrivacySettings)
 	userRoutes.POST("/events/:id/checkin", handler.CheckInEvent)
@@ -178,53 +330,105 @@ func main() {
 	userRoutes.POST("/analytics/track", analyticsHandler.TrackEvent) //need userID so to track user
 	userRoutes.POST("/pixel/search", pixelHandler.TrackSearch)
 
+	// Signed export download links carry their own authorization
+	r.GET("/brand/v1/export/:requestId/download", exportHandler.DownloadExport)
+
 	//brand only d
 	brandRoutes := r.Group("/brand/v1")
-	brandRoutes.Use(middleware.AuthMiddleware1())
+	brandRoutes.Use(middleware.BrandAuthMiddleware(tokenService, apiKeyService))
 	brandRoutes.Use(middleware.BrandOnlyMiddleware())
+	brandRoutes.Use(middleware.BrandMemberMiddleware(brandMemberService))
+	brandRoutes.Use(middleware.BrandAuditMiddleware(brandAuditService))
+	// can requires a permission of the member's brand role, see auth.BrandRolesWith,
+	// or the API key's scopes
+	can := middleware.BrandPermissionMiddleware
+	peopleOnly := middleware.NoAPIKeyMiddleware()
 
 	// brandRoutes.POST("/events", handler.CreateEvent)  //instead of brand creating the event organization are creating the events
-	brandRoutes.GET("/brands/dashboard", brandHandler.GetDashboardStats)
+	brandRoutes.GET("/brands/dashboard", can(auth.PermAnalyticsRead), brandHandler.GetDashboardStats)
 	brandRoutes.GET("/events", handler.ListEvents)
-	brandRoutes.GET("/events/:id/content", handler.GetEventContent)
-	brandRoutes.GET("/content/:id", handler.GetEventContent)
-	brandRoutes.GET("/content/tags/search", handler.SearchTags) //not working
-	brandRoutes.GET("/brands/campaigns", brandHandler.GetCampaigns)
-	brandRoutes.POST("/brands/campaigns", brandHandler.CreateCampaign)
-	brandRoutes.GET("/brands/content", brandHandler.GetBrandContent)
-	brandRoutes.GET("/events/:id/sentiment", feedbackHandler.GetEventSentiment)
-	brandRoutes.GET("/events/:id/analytics/engagement", analyticsHandler.GetEngagementMetrics)
-	brandRoutes.GET("/events/:id/analytics/attendance", analyticsHandler.GetAttendanceAnalytics) //works but got nothing for now
-	brandRoutes.GET("/events/:id/analytics/content", analyticsHandler.GetContentPerformance)
-	brandRoutes.GET("/events/:id/analytics/realtime", analyticsHandler.GetRealtimeStats)
-	brandRoutes.POST("/ecommerce/integrations", ecommerceHandler.CreateIntegration)
-	brandRoutes.GET("/ecommerce/integrations", ecommerceHandler.GetIntegration)
-	brandRoutes.GET("/events/:id/purchases/analytics", ecommerceHandler.GetPurchaseAnalytics)
-	brandRoutes.GET("/events/:id/purchases/top-products", ecommerceHandler.GetTopProducts)
-	brandRoutes.POST("/discount/generate", discountHandler.GenerateCode)
-	brandRoutes.GET("/events/:id/discount/analytics", discountHandler.GetCodeAnalytics)
-	brandRoutes.GET("/brands/discount/codes", discountHandler.GetBrandCodes)
-	brandRoutes.GET("/events/:id/pixel/analytics", pixelHandler.GetPixelAnalytics)
-	brandRoutes.GET("/pixel/generate", pixelHandler.GeneratePixelURL)
-	brandRoutes.POST("/content/:id/ai-process", advancedAnalyticsHandler.ProcessContentAI)
-	brandRoutes.GET("/brands/product-analytics", advancedAnalyticsHandler.GetProductAnalytics)
-	brandRoutes.GET("/events/:id/conversion-funnel", advancedAnalyticsHandler.GetConversionFunnel)
-	brandRoutes.GET("/events/:id/attribution-report", advancedAnalyticsHandler.GetAttributionReport)
-	brandRoutes.POST("/rewards/award", rewardsHandler.AwardReward)
-	brandRoutes.POST("/rewards/process-quality", rewardsHandler.ProcessQualityRewards)
-	brandRoutes.POST("/events/:id/surveys/schedule", rewardsHandler.ScheduleSurveys)
-	brandRoutes.GET("/events/:id/surveys/analytics", rewardsHandler.GetSurveyAnalytics)
-	brandRoutes.POST("/export/create", exportHandler.CreateExportRequest)
-	brandRoutes.GET("/export/:requestId/status", exportHandler.GetExportStatus)
+	brandRoutes.GET("/events/:id/content", can(auth.PermContentRead), handler.GetEventContent)
+	brandRoutes.GET("/content/:id", can(auth.PermContentRead), handler.GetEventContent)
+	brandRoutes.GET("/content/tags/search", can(auth.PermContentRead), handler.SearchTags) //not working
+	brandRoutes.GET("/brands/campaigns", can(auth.PermAnalyticsRead), brandHandler.GetCampaigns)
+	brandRoutes.POST("/brands/campaigns", can(auth.PermCampaignsWrite), brandHandler.CreateCampaign)
+	brandRoutes.GET("/brands/campaigns/:id", can(auth.PermAnalyticsRead), brandHandler.GetCampaign)
+	brandRoutes.PUT("/brands/campaigns/:id", can(auth.PermCampaignsWrite), brandHandler.UpdateCampaign)
+	brandRoutes.POST("/brands/campaigns/:id/status", can(auth.PermCampaignsWrite), brandHandler.UpdateCampaignStatus)
+	brandRoutes.POST("/brands/campaigns/:id/archive", can(auth.PermCampaignsWrite), brandHandler.ArchiveCampaign)
+	brandRoutes.POST("/brands/campaigns/:id/events", can(auth.PermCampaignsWrite), brandHandler.LinkCampaignEvent)
+	brandRoutes.DELETE("/brands/campaigns/:id/events/:eventId", can(auth.PermCampaignsWrite), brandHandler.UnlinkCampaignEvent)
+	brandRoutes.POST("/brands/campaigns/:id/expenses", can(auth.PermBillingWrite), brandHandler.RecordCampaignExpense)
+	brandRoutes.GET("/brands/campaigns/:id/rollup", can(auth.PermAnalyticsRead), brandHandler.GetCampaignRollup)
+	brandRoutes.GET("/brands/content", can(auth.PermContentRead), brandHandler.GetBrandContent)
+	brandRoutes.GET("/brands/reporting-currency", currencyHandler.GetReportingCurrency)
+	brandRoutes.PUT("/brands/reporting-currency", can(auth.PermBillingWrite), currencyHandler.SetReportingCurrency)
+	brandRoutes.GET("/exchange-rates", currencyHandler.GetExchangeRates)
+	brandRoutes.GET("/events/:id/sentiment", can(auth.PermAnalyticsRead), feedbackHandler.GetEventSentiment)
+	brandRoutes.GET("/events/:id/analytics/engagement", can(auth.PermAnalyticsRead), analyticsHandler.GetEngagementMetrics)
+	brandRoutes.GET("/events/:id/analytics/attendance", can(auth.PermAnalyticsRead), analyticsHandler.GetAttendanceAnalytics) //works but got nothing for now
+	brandRoutes.GET("/events/:id/analytics/content", can(auth.PermAnalyticsRead), analyticsHandler.GetContentPerformance)
+	brandRoutes.GET("/events/:id/analytics/realtime", can(auth.PermAnalyticsRead), analyticsHandler.GetRealtimeStats)
+	brandRoutes.POST("/ecommerce/integrations", can(auth.PermIntegrationsWrite), ecommerceHandler.CreateIntegration)
+	brandRoutes.GET("/ecommerce/integrations", can(auth.PermIntegrationsWrite), ecommerceHandler.GetIntegration)
+	brandRoutes.GET("/ecommerce/products", can(auth.PermAnalyticsRead), ecommerceHandler.ListCatalogProducts)
+	brandRoutes.GET("/ecommerce/products/:productId", can(auth.PermAnalyticsRead), ecommerceHandler.GetCatalogProduct)
+	brandRoutes.POST("/ecommerce/purchases/:purchaseId/refunds", can(auth.PermBillingWrite), ecommerceHandler.RefundPurchase)
+	brandRoutes.GET("/events/:id/purchases/analytics", can(auth.PermAnalyticsRead), ecommerceHandler.GetPurchaseAnalytics)
+	brandRoutes.GET("/events/:id/purchases/top-products", can(auth.PermAnalyticsRead), ecommerceHandler.GetTopProducts)
+	brandRoutes.POST("/discount/generate", can(auth.PermDiscountWrite), discountHandler.GenerateCode)
+	brandRoutes.GET("/events/:id/discount/analytics", can(auth.PermAnalyticsRead), discountHandler.GetCodeAnalytics)
+	brandRoutes.GET("/brands/discount/codes", can(auth.PermAnalyticsRead), discountHandler.GetBrandCodes)
+	brandRoutes.GET("/events/:id/pixel/analytics", can(auth.PermAnalyticsRead), pixelHandler.GetPixelAnalytics)
+	brandRoutes.GET("/pixel/generate", can(auth.PermIntegrationsWrite), pixelHandler.GeneratePixelURL)
+	brandRoutes.POST("/content/:id/ai-process", can(auth.PermContentReview), advancedAnalyticsHandler.ProcessContentAI)
+	brandRoutes.GET("/brands/product-analytics", can(auth.PermAnalyticsRead), advancedAnalyticsHandler.GetProductAnalytics)
+	brandRoutes.GET("/events/:id/conversion-funnel", can(auth.PermAnalyticsRead), advancedAnalyticsHandler.GetConversionFunnel)
+	brandRoutes.GET("/events/:id/attribution-report", can(auth.PermAnalyticsRead), advancedAnalyticsHandler.GetAttributionReport)
+	brandRoutes.GET("/events/:id/attribution/models", can(auth.PermAnalyticsRead), advancedAnalyticsHandler.CompareAttributionModels)
+	brandRoutes.POST("/rewards/award", can(auth.PermContentReview), rewardsHandler.AwardReward)
+	brandRoutes.POST("/rewards/process-quality", can(auth.PermContentReview), rewardsHandler.ProcessQualityRewards)
+	brandRoutes.POST("/events/:id/surveys/schedule", can(auth.PermEventsWrite), rewardsHandler.ScheduleSurveys)
+	brandRoutes.GET("/events/:id/surveys/analytics", can(auth.PermAnalyticsRead), rewardsHandler.GetSurveyAnalytics)
+	brandRoutes.POST("/export/create", can(auth.PermExportWrite), exportHandler.CreateExportRequest)
+	brandRoutes.GET("/export/:requestId/status", can(auth.PermExportWrite), exportHandler.GetExportStatus)
 	brandRoutes.GET("/export/formats", exportHandler.GetExportFormats)
-	brandRoutes.POST("/crm/integrations", exportHandler.CreateCRMIntegration)
-	brandRoutes.POST("/crm/:integrationId/sync/:eventId", exportHandler.SyncEventData)
+	brandRoutes.GET("/export/schedules", can(auth.PermExportWrite), exportHandler.ListExportSchedules)
+	brandRoutes.POST("/export/schedules", can(auth.PermExportWrite), exportHandler.CreateExportSchedule)
+	brandRoutes.GET("/export/schedules/:scheduleId", can(auth.PermExportWrite), exportHandler.GetExportSchedule)
+	brandRoutes.PUT("/export/schedules/:scheduleId", can(auth.PermExportWrite), exportHandler.UpdateExportSchedule)
+	brandRoutes.DELETE("/export/schedules/:scheduleId", can(auth.PermExportWrite), exportHandler.DeleteExportSchedule)
+	brandRoutes.POST("/export/schedules/:scheduleId/pause", can(auth.PermExportWrite), exportHandler.PauseExportSchedule)
+	brandRoutes.POST("/export/schedules/:scheduleId/resume", can(auth.PermExportWrite), exportHandler.ResumeExportSchedule)
+	brandRoutes.POST("/export/schedules/:scheduleId/run", can(auth.PermExportWrite), exportHandler.RunExportSchedule)
+	brandRoutes.GET("/export/schedules/:scheduleId/runs", can(auth.PermExportWrite), exportHandler.ListExportScheduleRuns)
+	brandRoutes.POST("/crm/integrations", can(auth.PermIntegrationsWrite), exportHandler.CreateCRMIntegration)
+	brandRoutes.GET("/crm/:integrationId", can(auth.PermIntegrationsWrite), exportHandler.GetCRMIntegration)
+	brandRoutes.PATCH("/crm/:integrationId", can(auth.PermIntegrationsWrite), exportHandler.UpdateCRMIntegration)
+	brandRoutes.POST("/crm/:integrationId/sync/:eventId", can(auth.PermIntegrationsWrite), exportHandler.SyncEventData)
+	brandRoutes.GET("/crm/:integrationId/syncs", can(auth.PermIntegrationsWrite), exportHandler.GetCRMSyncRuns)
 	brandRoutes.GET("/crm/types", exportHandler.GetCRMTypes)
-	brandRoutes.POST("/security/privacy/update", securityHandler.UpdatePrivacySettings)
-	brandRoutes.POST("/events", handler.CreateEvent)
+	brandRoutes.POST("/security/privacy/update", can(auth.PermSettingsWrite), securityHandler.UpdatePrivacySettings)
+	brandRoutes.POST("/events", can(auth.PermEventsWrite), handler.CreateEvent)
+	brandRoutes.POST("/session/brand", peopleOnly, brandMemberHandler.SwitchBrand)
+	brandRoutes.GET("/roles", brandMemberHandler.GetRoles)
+	brandRoutes.GET("/members", peopleOnly, brandMemberHandler.ListMembers)
+	brandRoutes.PUT("/members/:memberId/role", can(auth.PermMembersWrite), brandMemberHandler.UpdateMemberRole)
+	brandRoutes.DELETE("/members/:memberId", can(auth.PermMembersWrite), brandMemberHandler.RemoveMember)
+	brandRoutes.GET("/members/invitations", can(auth.PermMembersWrite), brandMemberHandler.ListInvitations)
+	brandRoutes.POST("/members/invitations", can(auth.PermMembersWrite), brandMemberHandler.InviteMember)
+	brandRoutes.POST("/members/invitations/:invitationId/resend", can(auth.PermMembersWrite), brandMemberHandler.ResendInvitation)
+	brandRoutes.DELETE("/members/invitations/:invitationId", can(auth.PermMembersWrite), brandMemberHandler.RevokeInvitation)
+	brandRoutes.GET("/audit-log", can(auth.PermAuditRead), brandMemberHandler.GetAuditLog)
+	brandRoutes.GET("/api-keys", can(auth.PermIntegrationsWrite), apiKeyHandler.ListAPIKeys)
+	brandRoutes.POST("/api-keys", can(auth.PermIntegrationsWrite), apiKeyHandler.CreateAPIKey)
+	brandRoutes.GET("/api-keys/:keyId", can(auth.PermIntegrationsWrite), apiKeyHandler.GetAPIKey)
+	brandRoutes.DELETE("/api-keys/:keyId", can(auth.PermIntegrationsWrite), apiKeyHandler.RevokeAPIKey)
 
 	adminRoutes := api.Group("/performance")
-	adminRoutes.Use(middleware.AdminOnlyMiddleware()) // New admin role needed
+	adminRoutes.Use(middleware.AuthMiddleware(tokenService))
+	adminRoutes.Use(middleware.AdminOnlyMiddleware())
+	adminRoutes.Use(middleware.AdminAuditMiddleware(adminAuditService))
 	adminRoutes.POST("/optimize-db", performanceHandler.OptimizeDatabase)
 	adminRoutes.GET("/db-metrics", performanceHandler.GetDatabaseMetrics)
 	adminRoutes.GET("/query-stats", performanceHandler.GetQueryStats)
@@ -241,6 +445,52 @@ func main() {
 	adminRoutes.GET("/ux/heatmap", uxHandler.GetHeatmapData)
 	adminRoutes.GET("/ux/journey", uxHandler.GetUserJourney)
 	adminRoutes.GET("/ux/pain-points", uxHandler.GetPainPoints)
+	adminRoutes.GET("/jobs", jobsHandler.ListJobs)
+	adminRoutes.GET("/jobs/stats", jobsHandler.GetJobStats)
+	adminRoutes.GET("/jobs/:id", jobsHandler.GetJob)
+	adminRoutes.POST("/jobs/:id/retry", jobsHandler.RetryJob)
+	adminRoutes.POST("/jobs/:id/cancel", jobsHandler.CancelJob)
+
+	//admin console
+	consoleRoutes := api.Group("/admin")
+	consoleRoutes.Use(middleware.AuthMiddleware(tokenService))
+	consoleRoutes.Use(middleware.AdminOnlyMiddleware())
+	consoleRoutes.Use(middleware.AdminAuditMiddleware(adminAuditService))
+	consoleRoutes.GET("/me", adminHandler.GetMe)
+	consoleRoutes.PUT("/me/password", adminHandler.ChangePassword)
+	consoleRoutes.POST("/me/totp/setup", adminHandler.SetupTOTP)
+	consoleRoutes.POST("/me/totp/enable", adminHandler.EnableTOTP)
+	consoleRoutes.POST("/me/totp/disable", adminHandler.DisableTOTP)
+	consoleRoutes.GET("/admins", adminHandler.ListAdmins)
+	consoleRoutes.POST("/admins", adminHandler.CreateAdmin)
+	consoleRoutes.POST("/admins/:adminId/disable", adminHandler.DisableAdmin)
+	consoleRoutes.POST("/admins/:adminId/enable", adminHandler.EnableAdmin)
+	consoleRoutes.POST("/admins/:adminId/totp/reset", adminHandler.ResetAdminTOTP)
+	consoleRoutes.GET("/audit-log", adminHandler.GetAuditLog)
+	consoleRoutes.GET("/security/events", adminHandler.GetSecurityEvents)
+	consoleRoutes.GET("/brands", adminConsoleHandler.ListBrands)
+	consoleRoutes.POST("/brands", adminConsoleHandler.CreateBrand)
+	consoleRoutes.GET("/brands/:brandId", adminConsoleHandler.GetBrand)
+	consoleRoutes.PUT("/brands/:brandId", adminConsoleHandler.UpdateBrand)
+	consoleRoutes.GET("/brands/:brandId/members", adminConsoleHandler.ListBrandMembers)
+	consoleRoutes.POST("/brands/:brandId/invitations", adminConsoleHandler.InviteBrandMember)
+	consoleRoutes.POST("/brands/:brandId/impersonate", adminConsoleHandler.ImpersonateBrand)
+	consoleRoutes.GET("/brands/:brandId/sso-domains", brandSSOHandler.ListSSODomains)
+	consoleRoutes.PUT("/brands/:brandId/sso-domains/:domain", brandSSOHandler.SetSSODomain)
+	consoleRoutes.DELETE("/brands/:brandId/sso-domains/:domain", brandSSOHandler.RemoveSSODomain)
+	consoleRoutes.GET("/organizers", adminConsoleHandler.ListOrganizers)
+	consoleRoutes.POST("/organizers", adminConsoleHandler.CreateOrganizer)
+	consoleRoutes.GET("/organizers/:organizerId", adminConsoleHandler.GetOrganizer)
+	consoleRoutes.PUT("/organizers/:organizerId", adminConsoleHandler.UpdateOrganizer)
+	consoleRoutes.DELETE("/organizers/:organizerId", adminConsoleHandler.DeleteOrganizer)
+	consoleRoutes.GET("/events", adminConsoleHandler.ListEvents)
+	consoleRoutes.POST("/events", adminConsoleHandler.CreateEvent)
+	consoleRoutes.GET("/events/:eventId", adminConsoleHandler.GetEvent)
+	consoleRoutes.PUT("/events/:eventId", adminConsoleHandler.UpdateEvent)
+	consoleRoutes.GET("/users", adminConsoleHandler.ListUsers)
+	consoleRoutes.GET("/users/:userId", adminConsoleHandler.GetUser)
+	consoleRoutes.POST("/users/:userId/disable", adminConsoleHandler.DisableUser)
+	consoleRoutes.POST("/users/:userId/enable", adminConsoleHandler.EnableUser)
 
 	// User routes
 	// api.GET("/users/profile", handler.)
@@ -364,9 +614,18 @@ func main() {
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	// Start server
-	log.Println("Starting server on :8080")
-	log.Println("API documentation available at http://localhost:8080/swagger/index.html")
-	if err := r.Run(":8080"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{
+		Addr:    cfg.Addr(),
+		Handler: r,
+	}
+
+	log.Printf("Starting server on %s", cfg.Addr())
+	log.Printf("API documentation available at http://localhost%s/swagger/index.html", cfg.Addr())
+	runErr := lc.Run(server, cfg.Server.ShutdownTimeout.Duration)
+
+	database.Close()
+	if runErr != nil {
+		log.Fatalf("Failed to start server: %v", runErr)
 	}
+	log.Println("Server stopped")
 }
@@ -0,0 +1,70 @@
+// Command credentials manages the master keys that encrypt stored integration
+// credentials.
+//
+//	credentials generate-key
+//	credentials reencrypt [config flags]
+//
+// reencrypt takes the same configuration as the API. Run it after adding a
+// new master key and making it the active one; afterwards the old key can be
+// removed from the configuration.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"lynkr/internal/services"
+	"lynkr/pkg/config"
+	"lynkr/pkg/database"
+	"lynkr/pkg/secrets"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "generate-key":
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			log.Fatalf("Failed to generate key: %v", err)
+		}
+		fmt.Println(key)
+	case "reencrypt":
+		reencrypt(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func reencrypt(args []string) {
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	keyring, err := cfg.Keyring()
+	if err != nil {
+		log.Fatalf("Failed to initialize keyring: %v", err)
+	}
+
+	if err := database.Initialize(database.Config{
+		DBPath:        cfg.Database.Path,
+		MigrationsDir: cfg.Database.MigrationsDir,
+	}); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	count, err := services.ReencryptCredentials(database.DB, keyring)
+	database.Close()
+	if err != nil {
+		log.Fatalf("Failed to re-encrypt credentials after %d values: %v", count, err)
+	}
+	log.Printf("Re-encrypted %d credentials with master key %q", count, keyring.ActiveKeyID())
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: credentials generate-key | reencrypt [config flags]")
+	os.Exit(2)
+}
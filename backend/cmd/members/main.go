@@ -0,0 +1,63 @@
+// Command members invites people to a brand, for example the first owner of
+// a new brand.
+//
+//	members invite BRAND_ID EMAIL ROLE [config flags]
+//
+// ROLE is owner, admin, analyst, content-reviewer or billing. The invitation
+// is emailed like invitations sent from the brand portal; the accept link is
+// also printed, for setups without a mail server.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"lynkr/internal/services"
+	"lynkr/pkg/config"
+	"lynkr/pkg/database"
+	"lynkr/pkg/mail"
+)
+
+func main() {
+	if len(os.Args) < 5 || os.Args[1] != "invite" {
+		usage()
+	}
+	brandID, email, role := os.Args[2], os.Args[3], os.Args[4]
+
+	cfg, err := config.Load(os.Args[5:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	sender, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to initialize mail: %v", err)
+	}
+	if err := database.Initialize(database.Config{
+		DBPath:        cfg.Database.Path,
+		MigrationsDir: cfg.Database.MigrationsDir,
+	}); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	members := services.NewBrandMemberService(database.DB, sender, services.MemberOptions{
+		PortalURL:     cfg.Brands.PortalURL,
+		InvitationTTL: cfg.Brands.InvitationTTL.Duration,
+	})
+	invitation, acceptURL, err := members.Invite(brandID, services.BrandActor{Type: services.ActorSystem}, email, role)
+	database.Close()
+	if err != nil {
+		log.Fatalf("Failed to invite %s: %v", email, err)
+	}
+
+	if !invitation.EmailSent {
+		log.Printf("The invitation email could not be sent")
+	}
+	log.Printf("Invited %s to brand %s as %s until %s", invitation.Email, brandID, role, invitation.ExpiresAt.Format("2006-01-02 15:04 MST"))
+	fmt.Println(acceptURL)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: members invite BRAND_ID EMAIL ROLE [config flags]")
+	os.Exit(2)
+}
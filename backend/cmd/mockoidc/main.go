@@ -0,0 +1,40 @@
+// Command mockoidc is a minimal OpenID Connect provider for trying brand
+// single sign-on locally. Its login page asks for any email address and name
+// and signs the user in without a password, so it must never be exposed.
+//
+//	mockoidc [-addr :9090] [-issuer http://localhost:9090] [-client-id lynkr]
+//	         [-client-secret SECRET] [-email-verified=true]
+//
+// Point the API at it with LYNKR_SSO_ISSUER and LYNKR_SSO_CLIENT_ID. The
+// signing key is generated on start, so tokens do not survive a restart.
+// Tests use the same provider through package oidctest.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"lynkr/pkg/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "address to listen on")
+	issuer := flag.String("issuer", "http://localhost:9090", "issuer URL the provider is reached at")
+	clientID := flag.String("client-id", "lynkr", "client ID to accept")
+	clientSecret := flag.String("client-secret", "", "client secret to require, empty for a public client")
+	emailVerified := flag.Bool("email-verified", true, "whether the login page marks emails as verified by default")
+	flag.Parse()
+
+	provider, err := oidctest.New(*issuer, oidctest.Options{
+		ClientID:      *clientID,
+		ClientSecret:  *clientSecret,
+		EmailVerified: *emailVerified,
+	})
+	if err != nil {
+		log.Fatalf("Failed to start mock provider: %v", err)
+	}
+
+	log.Printf("Mock OIDC provider for client %q listening on %s as %s", *clientID, *addr, provider.Issuer())
+	log.Fatal(http.ListenAndServe(*addr, provider))
+}
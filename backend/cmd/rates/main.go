@@ -0,0 +1,54 @@
+// Command rates loads the exchange rates analytics convert money with.
+//
+//	rates load FILE [config flags]
+//
+// FILE is a JSON exchange rate table such as
+// {"base": "USD", "rates": {"EUR": 0.92, "GBP": 0.79}}. Loading replaces the
+// stored rates; the API keeps using them until the next load or until it
+// starts with a configured rates file.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"lynkr/internal/services"
+	"lynkr/pkg/config"
+	"lynkr/pkg/database"
+	"lynkr/pkg/money"
+)
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "load" {
+		usage()
+	}
+
+	rates, err := money.LoadRates(os.Args[2])
+	if err != nil {
+		log.Fatalf("Failed to read exchange rates: %v", err)
+	}
+
+	cfg, err := config.Load(os.Args[3:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if err := database.Initialize(database.Config{
+		DBPath:        cfg.Database.Path,
+		MigrationsDir: cfg.Database.MigrationsDir,
+	}); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	err = services.NewCurrencyService(database.DB).LoadExchangeRates(rates)
+	database.Close()
+	if err != nil {
+		log.Fatalf("Failed to load exchange rates: %v", err)
+	}
+	log.Printf("Loaded %d exchange rates against %s", len(rates.Rates), rates.Base)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: rates load FILE [config flags]")
+	os.Exit(2)
+}
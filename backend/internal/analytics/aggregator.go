@@ -6,6 +6,7 @@
 package analytics
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
@@ -35,15 +36,21 @@ func NewAggregator(db *sql.DB) *Aggregator {
 	return &Aggregator{db: db}
 }
 
-func (a *Aggregator) StartBatchProcessing() {
+// RunBatchProcessing aggregates analytics every five minutes until ctx is cancelled
+func (a *Aggregator) RunBatchProcessing(ctx context.Context) {
 	ticker := time.NewTicker(5 * time.Minute)
-	go func() {
-		for range ticker.C {
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 			a.aggregateEngagementMetrics()
 			a.aggregateAttendanceData()
 			a.aggregateContentMetrics()
 		}
-	}()
+	}
 }
 
 func (a *Aggregator) aggregateEngagementMetrics() {
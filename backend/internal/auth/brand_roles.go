@@ -0,0 +1,100 @@
+/**
+ * Brand Roles
+ * The roles of brand members and the permissions each role grants
+ */
+
+package auth
+
+// Roles of a member within a brand
+const (
+	BrandRoleOwner           = "owner"
+	BrandRoleAdmin           = "admin"
+	BrandRoleAnalyst         = "analyst"
+	BrandRoleContentReviewer = "content-reviewer"
+	BrandRoleBilling         = "billing"
+)
+
+// Permission is an action brand routes can require
+type Permission string
+
+const (
+	PermAnalyticsRead     Permission = "analytics:read"     // dashboards, event analytics and reports
+	PermContentRead       Permission = "content:read"       // attendee content
+	PermContentReview     Permission = "content:review"     // AI processing of content and content rewards
+	PermCampaignsWrite    Permission = "campaigns:write"    // campaigns
+	PermDiscountWrite     Permission = "discount:write"     // discount codes
+	PermBillingWrite      Permission = "billing:write"      // campaign expenses, refunds and the reporting currency
+	PermEventsWrite       Permission = "events:write"       // events and their surveys
+	PermIntegrationsWrite Permission = "integrations:write" // store and CRM integrations, tracking pixels and API keys
+	PermExportWrite       Permission = "export:write"       // data exports and export schedules
+	PermMembersWrite      Permission = "members:write"      // invitations and member roles
+	PermSettingsWrite     Permission = "settings:write"     // brand settings such as privacy
+	PermAuditRead         Permission = "audit:read"         // the brand audit log
+)
+
+var allPermissions = []Permission{
+	PermAnalyticsRead, PermContentRead, PermContentReview, PermCampaignsWrite, PermDiscountWrite, PermBillingWrite,
+	PermEventsWrite, PermIntegrationsWrite, PermExportWrite, PermMembersWrite, PermSettingsWrite, PermAuditRead,
+}
+
+// brandRolePermissions lists what each role may do. Owners and admins may do
+// everything; only owners can grant or take away the owner role.
+var brandRolePermissions = map[string][]Permission{
+	BrandRoleOwner:           allPermissions,
+	BrandRoleAdmin:           allPermissions,
+	BrandRoleAnalyst:         {PermAnalyticsRead, PermContentRead, PermExportWrite},
+	BrandRoleContentReviewer: {PermContentRead, PermContentReview},
+	BrandRoleBilling:         {PermAnalyticsRead, PermBillingWrite},
+}
+
+// apiKeyScopes are the permissions an API key can be given. Keys cannot
+// manage members, integrations or other keys, so a leaked key cannot be used
+// to create more access.
+var apiKeyScopes = []Permission{
+	PermAnalyticsRead, PermContentRead, PermCampaignsWrite, PermDiscountWrite, PermEventsWrite, PermExportWrite,
+}
+
+// BrandRoles lists the brand roles from most to least privileged
+func BrandRoles() []string {
+	return []string{BrandRoleOwner, BrandRoleAdmin, BrandRoleAnalyst, BrandRoleContentReviewer, BrandRoleBilling}
+}
+
+// ValidBrandRole reports whether role is a brand role
+func ValidBrandRole(role string) bool {
+	_, ok := brandRolePermissions[role]
+	return ok
+}
+
+// BrandRolePermissions returns the permissions of a brand role
+func BrandRolePermissions(role string) []Permission {
+	return append([]Permission(nil), brandRolePermissions[role]...)
+}
+
+// BrandRolesWith returns the brand roles that have a permission
+func BrandRolesWith(permission Permission) []string {
+	var roles []string
+	for _, role := range BrandRoles() {
+		for _, granted := range brandRolePermissions[role] {
+			if granted == permission {
+				roles = append(roles, role)
+				break
+			}
+		}
+	}
+	return roles
+}
+
+// APIKeyScopes lists the permissions an API key can be given
+func APIKeyScopes() []Permission {
+	return append([]Permission(nil), apiKeyScopes...)
+}
+
+// ValidAPIKeyScope reports whether an API key can be given a permission
+func ValidAPIKeyScope(scope Permission) bool {
+	for _, allowed := range apiKeyScopes {
+		if allowed == scope {
+			return true
+		}
+	}
+	return false
+}
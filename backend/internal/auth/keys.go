@@ -0,0 +1,73 @@
+/**
+ * Signing Keys
+ * HS256 keys identified by a key ID so they can be rotated
+ */
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// KeySet signs access tokens with the active key and verifies them with the
+// key named by their kid header. To rotate, add a key, make it the active one
+// and remove the old key once the tokens it signed have expired.
+type KeySet struct {
+	keys     map[string][]byte
+	activeID string
+}
+
+// NewKeySet builds a key set from key IDs and secrets
+func NewKeySet(keys map[string]string, activeID string) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one signing key is required")
+	}
+	set := &KeySet{keys: make(map[string][]byte), activeID: activeID}
+	for id, secret := range keys {
+		if id == "" || secret == "" {
+			return nil, fmt.Errorf("signing keys need an ID and a secret")
+		}
+		set.keys[id] = []byte(secret)
+	}
+	if _, ok := set.keys[activeID]; !ok {
+		return nil, fmt.Errorf("active signing key %q is not configured", activeID)
+	}
+	return set, nil
+}
+
+// ActiveKeyID is the ID of the key new tokens are signed with
+func (ks *KeySet) ActiveKeyID() string {
+	return ks.activeID
+}
+
+// KeyIDs lists the configured key IDs
+func (ks *KeySet) KeyIDs() []string {
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = ks.activeID
+	return token.SignedString(ks.keys[ks.activeID])
+}
+
+// keyFunc resolves the verification key of a token from its kid header
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSigningKey, id)
+	}
+	return key, nil
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewKeySet(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     map[string]string
+		activeID string
+		wantErr  bool
+	}{
+		{name: "single key", keys: map[string]string{"k1": "secret"}, activeID: "k1"},
+		{name: "rotation", keys: map[string]string{"k1": "old", "k2": "new"}, activeID: "k2"},
+		{name: "no keys", keys: map[string]string{}, activeID: "k1", wantErr: true},
+		{name: "active key missing", keys: map[string]string{"k1": "secret"}, activeID: "k2", wantErr: true},
+		{name: "empty secret", keys: map[string]string{"k1": ""}, activeID: "k1", wantErr: true},
+		{name: "empty ID", keys: map[string]string{"": "secret"}, activeID: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := NewKeySet(tt.keys, tt.activeID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewKeySet err = %v, want error: %v", err, tt.wantErr)
+			}
+			if err == nil && set.ActiveKeyID() != tt.activeID {
+				t.Errorf("ActiveKeyID = %q, want %q", set.ActiveKeyID(), tt.activeID)
+			}
+		})
+	}
+}
+
+func TestKeyIDsAreSorted(t *testing.T) {
+	set := mustKeySet(t, map[string]string{"k3": "c", "k1": "a", "k2": "b"}, "k3")
+	if got := set.KeyIDs(); !reflect.DeepEqual(got, []string{"k1", "k2", "k3"}) {
+		t.Errorf("KeyIDs = %v", got)
+	}
+}
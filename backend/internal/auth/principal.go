@@ -0,0 +1,66 @@
+/**
+ * Principals
+ * The kinds of callers an access token can identify
+ */
+
+package auth
+
+import "fmt"
+
+// PrincipalType is the kind of account a token was issued to
+type PrincipalType string
+
+const (
+	PrincipalUser        PrincipalType = "user"
+	PrincipalBrandMember PrincipalType = "brand_member"
+	PrincipalAdmin       PrincipalType = "admin"
+	// PrincipalAPIKey is a brand API key. Keys authenticate every request
+	// themselves and are never issued tokens.
+	PrincipalAPIKey PrincipalType = "api_key"
+)
+
+// Principal is the authenticated caller of a request. ID is the user,
+// brand member or admin account ID, or the API key ID; BrandID is set for
+// brand members, API keys and admins impersonating a brand.
+type Principal struct {
+	Type    PrincipalType `json:"type"`
+	ID      string        `json:"id"`
+	BrandID string        `json:"brandId,omitempty"`
+}
+
+// Impersonating reports whether the principal is an admin acting as a brand
+func (p Principal) Impersonating() bool {
+	return p.Type == PrincipalAdmin && p.BrandID != ""
+}
+
+// Role is the route role of the principal, as checked by the role middlewares
+func (p Principal) Role() string {
+	switch p.Type {
+	case PrincipalBrandMember, PrincipalAPIKey:
+		return "brand"
+	case PrincipalAdmin:
+		return "admin"
+	default:
+		return "user"
+	}
+}
+
+func (p Principal) validate() error {
+	switch p.Type {
+	case PrincipalUser:
+		if p.BrandID != "" {
+			return fmt.Errorf("user principal cannot have a brand ID")
+		}
+	case PrincipalAdmin:
+	case PrincipalBrandMember:
+		if p.BrandID == "" {
+			return fmt.Errorf("brand member principal needs a brand ID")
+		}
+	default:
+		return fmt.Errorf("unknown principal type %q", p.Type)
+	}
+	if p.ID == "" {
+		return fmt.Errorf("principal needs an ID")
+	}
+	return nil
+}
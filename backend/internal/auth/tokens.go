@@ -0,0 +1,407 @@
+/**
+ * Token Service
+ * Issues short-lived access tokens and rotating refresh tokens, and revokes them
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidToken        = errors.New("invalid or expired token")
+	ErrTokenRevoked        = errors.New("token has been revoked")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when a rotated refresh token is
+	// presented again. The whole session is revoked, as the token may have
+	// been stolen.
+	ErrRefreshTokenReused = errors.New("refresh token was already used")
+)
+
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+	// sessionPrefix marks revocation list entries that revoke a whole session
+	sessionPrefix = "session:"
+)
+
+// Claims are the claims of an access token. The subject is the principal ID
+// and SessionID ties the token to its refresh token family.
+type Claims struct {
+	PrincipalType PrincipalType `json:"typ"`
+	BrandID       string        `json:"brand_id,omitempty"`
+	SessionID     string        `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// Principal returns the principal the token was issued to
+func (c *Claims) Principal() *Principal {
+	return &Principal{Type: c.PrincipalType, ID: c.Subject, BrandID: c.BrandID}
+}
+
+// TokenPair is returned on login and refresh. ExpiresIn is the lifetime of
+// the access token in seconds.
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	TokenType        string    `json:"tokenType"`
+	ExpiresIn        int       `json:"expiresIn"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// TokenOptions sets token lifetimes
+type TokenOptions struct {
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+type TokenService struct {
+	db      *sql.DB
+	keys    *KeySet
+	options TokenOptions
+}
+
+func NewTokenService(db *sql.DB, keys *KeySet, options TokenOptions) *TokenService {
+	if options.AccessTTL <= 0 {
+		options.AccessTTL = DefaultAccessTokenTTL
+	}
+	if options.RefreshTTL <= 0 {
+		options.RefreshTTL = DefaultRefreshTokenTTL
+	}
+	return &TokenService{db: db, keys: keys, options: options}
+}
+
+// Issue starts a session for a principal that just logged in
+func (ts *TokenService) Issue(principal Principal) (*TokenPair, error) {
+	if err := principal.validate(); err != nil {
+		return nil, err
+	}
+
+	sessionID, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, expiresAt, err := ts.storeRefreshToken(ts.db, sessionID, principal, ts.options.RefreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	return ts.tokenPair(principal, sessionID, refreshToken, expiresAt)
+}
+
+// IssueAccessToken starts a session without a refresh token, which ends when
+// the access token expires. It is used for brand impersonation, which admins
+// have to start again once the token runs out. The session is still recorded
+// like any other, with a refresh token nobody is given, so RevokeSessions
+// ends it.
+func (ts *TokenService) IssueAccessToken(principal Principal) (*TokenPair, error) {
+	if err := principal.validate(); err != nil {
+		return nil, err
+	}
+
+	sessionID, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := ts.storeRefreshToken(ts.db, sessionID, principal, ts.options.AccessTTL); err != nil {
+		return nil, err
+	}
+	return ts.tokenPair(principal, sessionID, "", time.Time{})
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. Every refresh token can be used once.
+func (ts *TokenService) Refresh(refreshToken string) (*TokenPair, error) {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id, sessionID string
+	var principal Principal
+	var brandID sql.NullString
+	var expiresAt time.Time
+	var rotatedAt, revokedAt sql.NullTime
+	err = tx.QueryRow(`
+		SELECT id, session_id, principal_type, subject, brand_id, expires_at, rotated_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = ?
+	`, hashToken(refreshToken)).Scan(&id, &sessionID, &principal.Type, &principal.ID, &brandID, &expiresAt, &rotatedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	principal.BrandID = brandID.String
+
+	if revokedAt.Valid || time.Now().After(expiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if rotatedAt.Valid {
+		if err := ts.revokeSession(tx, sessionID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to revoke session: %w", err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	// Only one of two concurrent refreshes with the same token wins
+	result, err := tx.Exec(`UPDATE refresh_tokens SET rotated_at = ? WHERE id = ? AND rotated_at IS NULL`, dbTime(time.Now()), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return nil, ErrRefreshTokenReused
+	}
+
+	next, nextExpiresAt, err := ts.storeRefreshToken(tx, sessionID, principal, ts.options.RefreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	return ts.tokenPair(principal, sessionID, next, nextExpiresAt)
+}
+
+// Authenticate verifies an access token and checks it has not been revoked
+func (ts *TokenService) Authenticate(accessToken string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(accessToken, claims, ts.keys.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if err := claims.Principal().validate(); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var revoked int
+	err = ts.db.QueryRow(`SELECT COUNT(*) FROM revoked_tokens WHERE token_id IN (?, ?)`,
+		claims.ID, sessionPrefix+claims.SessionID).Scan(&revoked)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if revoked > 0 {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// Logout revokes the access token and ends its session, so its refresh
+// tokens stop working as well
+func (ts *TokenService) Logout(claims *Claims) error {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to log out: %w", err)
+	}
+	defer tx.Rollback()
+
+	if claims.ExpiresAt != nil {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO revoked_tokens (token_id, expires_at) VALUES (?, ?)`,
+			claims.ID, dbTime(claims.ExpiresAt.Time))
+		if err != nil {
+			return fmt.Errorf("failed to revoke token: %w", err)
+		}
+	}
+	if err := ts.revokeSession(tx, claims.SessionID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to log out: %w", err)
+	}
+	return nil
+}
+
+// RevokeSessions ends every session of a principal, for example after a
+// password change
+func (ts *TokenService) RevokeSessions(principalType PrincipalType, principalID string) (int, error) {
+	tx, err := ts.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT DISTINCT session_id FROM refresh_tokens
+		WHERE principal_type = ? AND subject = ? AND revoked_at IS NULL
+	`, principalType, principalID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	var sessions []string
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&sessionID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+		sessions = append(sessions, sessionID)
+	}
+	rows.Close()
+
+	for _, sessionID := range sessions {
+		if err := ts.revokeSession(tx, sessionID); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return len(sessions), nil
+}
+
+// PurgeExpired removes refresh tokens and revocation list entries that have
+// expired, as expired tokens are rejected anyway
+func (ts *TokenService) PurgeExpired() (int64, error) {
+	now := dbTime(time.Now())
+	refreshTokens, err := ts.db.Exec(`DELETE FROM refresh_tokens WHERE expires_at < ?`, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge refresh tokens: %w", err)
+	}
+	revocations, err := ts.db.Exec(`DELETE FROM revoked_tokens WHERE expires_at < ?`, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge revoked tokens: %w", err)
+	}
+	purgedTokens, _ := refreshTokens.RowsAffected()
+	purgedRevocations, _ := revocations.RowsAffected()
+	return purgedTokens + purgedRevocations, nil
+}
+
+// RunPurge purges expired tokens every interval until ctx is cancelled
+func (ts *TokenService) RunPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := ts.PurgeExpired(); err != nil && ctx.Err() == nil {
+				log.Printf("Error purging expired tokens: %v", err)
+			}
+		}
+	}
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (ts *TokenService) storeRefreshToken(db execer, sessionID string, principal Principal, ttl time.Duration) (string, time.Time, error) {
+	id, err := randomID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	expiresAt := time.Now().UTC().Add(ttl).Truncate(time.Second)
+
+	_, err = db.Exec(`
+		INSERT INTO refresh_tokens (id, session_id, token_hash, principal_type, subject, brand_id, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, sessionID, hashToken(token), principal.Type, principal.ID, nullIfEmpty(principal.BrandID),
+		dbTime(expiresAt), dbTime(time.Now()))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	return token, expiresAt, nil
+}
+
+func (ts *TokenService) tokenPair(principal Principal, sessionID, refreshToken string, refreshExpiresAt time.Time) (*TokenPair, error) {
+	tokenID, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	claims := Claims{
+		PrincipalType: principal.Type,
+		BrandID:       principal.BrandID,
+		SessionID:     sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Subject:   principal.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ts.options.AccessTTL)),
+		},
+	}
+	accessToken, err := ts.keys.sign(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(ts.options.AccessTTL.Seconds()),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// revokeSession revokes a session's refresh tokens and puts the session on
+// the revocation list until its last refresh token would have expired, which
+// also rejects its access tokens
+func (ts *TokenService) revokeSession(tx *sql.Tx, sessionID string) error {
+	now := dbTime(time.Now())
+	_, err := tx.Exec(`UPDATE refresh_tokens SET revoked_at = ? WHERE session_id = ? AND revoked_at IS NULL`, now, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	// Access tokens of the session can outlive its refresh tokens by one access token lifetime
+	expiresAt := dbTime(time.Now().Add(ts.options.RefreshTTL + ts.options.AccessTTL))
+	_, err = tx.Exec(`
+		INSERT INTO revoked_tokens (token_id, expires_at) VALUES (?, ?)
+		ON CONFLICT (token_id) DO UPDATE SET expires_at = excluded.expires_at
+	`, sessionPrefix+sessionID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func dbTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
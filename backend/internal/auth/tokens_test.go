@@ -0,0 +1,335 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var testUser = Principal{Type: PrincipalUser, ID: "42"}
+
+// newTestDB returns a temporary database with the token tables
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "auth.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+
+	migration, err := os.ReadFile("../../../database/migrations/031_auth_tokens.sql")
+	if err != nil {
+		t.Fatalf("failed to read migration: %v", err)
+	}
+	if _, err := db.Exec(string(migration)); err != nil {
+		t.Fatalf("failed to apply migration: %v", err)
+	}
+	return db
+}
+
+func mustKeySet(t *testing.T, keys map[string]string, activeID string) *KeySet {
+	t.Helper()
+	set, err := NewKeySet(keys, activeID)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	return set
+}
+
+func newTestTokenService(t *testing.T) *TokenService {
+	t.Helper()
+	return NewTokenService(newTestDB(t), mustKeySet(t, map[string]string{"k1": "first-secret-first-secret-32byte"}, "k1"), TokenOptions{})
+}
+
+func mustIssue(t *testing.T, ts *TokenService, principal Principal) *TokenPair {
+	t.Helper()
+	pair, err := ts.Issue(principal)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	return pair
+}
+
+func TestIssueAndAuthenticate(t *testing.T) {
+	ts := newTestTokenService(t)
+	member := Principal{Type: PrincipalBrandMember, ID: "7", BrandID: "3"}
+
+	pair := mustIssue(t, ts, member)
+	if pair.TokenType != "Bearer" || pair.ExpiresIn != int(DefaultAccessTokenTTL.Seconds()) || pair.RefreshToken == "" {
+		t.Errorf("pair = %+v", pair)
+	}
+	claims, err := ts.Authenticate(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if got := *claims.Principal(); got != member || claims.SessionID == "" || claims.ID == "" {
+		t.Errorf("claims = %+v, want the brand member with a session and token ID", claims)
+	}
+
+	invalid := []Principal{
+		{Type: PrincipalUser, ID: "1", BrandID: "3"},
+		{Type: PrincipalBrandMember, ID: "7"},
+		{Type: PrincipalAPIKey, ID: "key_1", BrandID: "3"},
+		{Type: PrincipalAdmin},
+	}
+	for _, principal := range invalid {
+		if _, err := ts.Issue(principal); err == nil {
+			t.Errorf("Issue(%+v) succeeded, want an error", principal)
+		}
+	}
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	ts := newTestTokenService(t)
+	first := mustIssue(t, ts, testUser)
+
+	second, err := ts.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Error("refresh returned the same tokens")
+	}
+	firstClaims, _ := ts.Authenticate(first.AccessToken)
+	secondClaims, err := ts.Authenticate(second.AccessToken)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if firstClaims == nil || secondClaims.SessionID != firstClaims.SessionID {
+		t.Error("refreshed access token left the session")
+	}
+
+	third, err := ts.Refresh(second.RefreshToken)
+	if err != nil {
+		t.Fatalf("second Refresh: %v", err)
+	}
+	if _, err := ts.Refresh("not a token"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown refresh token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := ts.Authenticate(third.AccessToken); err != nil {
+		t.Errorf("Authenticate after two refreshes: %v", err)
+	}
+}
+
+func TestReusedRefreshTokenRevokesFamily(t *testing.T) {
+	ts := newTestTokenService(t)
+	first := mustIssue(t, ts, testUser)
+	other := mustIssue(t, ts, testUser)
+
+	second, err := ts.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// Someone replays the rotated token
+	if _, err := ts.Refresh(first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused refresh token: err = %v, want ErrRefreshTokenReused", err)
+	}
+
+	// Every token of the family stops working, including the legitimate ones
+	if _, err := ts.Refresh(second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("latest refresh token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	for name, token := range map[string]string{"first": first.AccessToken, "second": second.AccessToken} {
+		if _, err := ts.Authenticate(token); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("%s access token: err = %v, want ErrTokenRevoked", name, err)
+		}
+	}
+
+	// Other sessions of the same principal are unaffected
+	if _, err := ts.Authenticate(other.AccessToken); err != nil {
+		t.Errorf("other session: %v", err)
+	}
+	if _, err := ts.Refresh(other.RefreshToken); err != nil {
+		t.Errorf("other session refresh: %v", err)
+	}
+}
+
+func TestRevokedSessionsAreRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(t *testing.T, ts *TokenService, pair *TokenPair)
+	}{
+		{
+			name: "logout",
+			revoke: func(t *testing.T, ts *TokenService, pair *TokenPair) {
+				claims, err := ts.Authenticate(pair.AccessToken)
+				if err != nil {
+					t.Fatalf("Authenticate: %v", err)
+				}
+				if err := ts.Logout(claims); err != nil {
+					t.Fatalf("Logout: %v", err)
+				}
+			},
+		},
+		{
+			name: "revoke all sessions",
+			revoke: func(t *testing.T, ts *TokenService, pair *TokenPair) {
+				count, err := ts.RevokeSessions(testUser.Type, testUser.ID)
+				if err != nil || count != 1 {
+					t.Fatalf("RevokeSessions = %d, %v; want one session", count, err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestTokenService(t)
+			pair := mustIssue(t, ts, testUser)
+			otherUser := mustIssue(t, ts, Principal{Type: PrincipalUser, ID: "43"})
+
+			tt.revoke(t, ts, pair)
+
+			if _, err := ts.Authenticate(pair.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+				t.Errorf("access token: err = %v, want ErrTokenRevoked", err)
+			}
+			if _, err := ts.Refresh(pair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Errorf("refresh token: err = %v, want ErrInvalidRefreshToken", err)
+			}
+			if _, err := ts.Authenticate(otherUser.AccessToken); err != nil {
+				t.Errorf("another user's token: %v", err)
+			}
+		})
+	}
+}
+
+func TestAccessOnlySessionsCanBeRevoked(t *testing.T) {
+	ts := newTestTokenService(t)
+	admin := Principal{Type: PrincipalAdmin, ID: "adm_1", BrandID: "3"}
+
+	pair, err := ts.IssueAccessToken(admin)
+	if err != nil {
+		t.Fatalf("IssueAccessToken: %v", err)
+	}
+	if pair.RefreshToken != "" || !pair.RefreshExpiresAt.IsZero() {
+		t.Errorf("pair = %+v, want no refresh token", pair)
+	}
+	if _, err := ts.Authenticate(pair.AccessToken); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	if count, err := ts.RevokeSessions(PrincipalAdmin, "adm_1"); err != nil || count != 1 {
+		t.Fatalf("RevokeSessions = %d, %v; want one session", count, err)
+	}
+	if _, err := ts.Authenticate(pair.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Authenticate = %v, want ErrTokenRevoked", err)
+	}
+}
+
+func TestExpiredRefreshToken(t *testing.T) {
+	ts := newTestTokenService(t)
+	pair := mustIssue(t, ts, testUser)
+	if _, err := ts.db.Exec(`UPDATE refresh_tokens SET expires_at = ?`, dbTime(time.Now().Add(-time.Minute))); err != nil {
+		t.Fatalf("failed to expire token: %v", err)
+	}
+
+	if _, err := ts.Refresh(pair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh = %v, want ErrInvalidRefreshToken", err)
+	}
+	if purged, err := ts.PurgeExpired(); err != nil || purged != 1 {
+		t.Errorf("PurgeExpired = %d, %v; want the expired token", purged, err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	db := newTestDB(t)
+	const oldSecret, newSecret = "first-secret-first-secret-32byte", "second-secret-second-secret-32by"
+
+	before := NewTokenService(db, mustKeySet(t, map[string]string{"k1": oldSecret}, "k1"), TokenOptions{})
+	oldToken := mustIssue(t, before, testUser)
+
+	// Grace period: k2 signs, k1 still verifies
+	rotating := NewTokenService(db, mustKeySet(t, map[string]string{"k1": oldSecret, "k2": newSecret}, "k2"), TokenOptions{})
+	if _, err := rotating.Authenticate(oldToken.AccessToken); err != nil {
+		t.Errorf("token signed with the retired key: %v", err)
+	}
+	newToken := mustIssue(t, rotating, testUser)
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken.AccessToken, &Claims{})
+	if err != nil || parsed.Header["kid"] != "k2" {
+		t.Errorf("new token kid = %v, %v; want k2", parsed.Header["kid"], err)
+	}
+
+	// Refresh tokens are not signed, so sessions survive the rotation
+	if _, err := rotating.Refresh(oldToken.RefreshToken); err != nil {
+		t.Errorf("refresh across the rotation: %v", err)
+	}
+
+	// Once k1 is removed its tokens stop verifying
+	after := NewTokenService(db, mustKeySet(t, map[string]string{"k2": newSecret}, "k2"), TokenOptions{})
+	if _, err := after.Authenticate(oldToken.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token of a removed key: err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := after.Authenticate(newToken.AccessToken); err != nil {
+		t.Errorf("token of the active key: %v", err)
+	}
+}
+
+func TestAuthenticateRejectsForgedTokens(t *testing.T) {
+	ts := newTestTokenService(t)
+	secret := []byte("first-secret-first-secret-32byte")
+	valid := func() Claims {
+		now := time.Now()
+		return Claims{
+			PrincipalType: PrincipalUser,
+			SessionID:     "session",
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        "token",
+				Subject:   "42",
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			},
+		}
+	}
+	sign := func(method jwt.SigningMethod, kid string, claims Claims, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return signed
+	}
+
+	expired := valid()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	noExpiry := valid()
+	noExpiry.ExpiresAt = nil
+	unknownType := valid()
+	unknownType.PrincipalType = "root"
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{name: "control", token: sign(jwt.SigningMethodHS256, "k1", valid(), secret)},
+		{name: "alg none", token: sign(jwt.SigningMethodNone, "k1", valid(), jwt.UnsafeAllowNoneSignatureType), want: ErrInvalidToken},
+		{name: "HS384 with the right key", token: sign(jwt.SigningMethodHS384, "k1", valid(), secret), want: ErrInvalidToken},
+		{name: "HS512 with the right key", token: sign(jwt.SigningMethodHS512, "k1", valid(), secret), want: ErrInvalidToken},
+		{name: "wrong secret", token: sign(jwt.SigningMethodHS256, "k1", valid(), []byte("guessed")), want: ErrInvalidToken},
+		{name: "unknown kid", token: sign(jwt.SigningMethodHS256, "k9", valid(), secret), want: ErrInvalidToken},
+		{name: "no kid", token: sign(jwt.SigningMethodHS256, "", valid(), secret), want: ErrInvalidToken},
+		{name: "expired", token: sign(jwt.SigningMethodHS256, "k1", expired, secret), want: ErrInvalidToken},
+		{name: "no expiry", token: sign(jwt.SigningMethodHS256, "k1", noExpiry, secret), want: ErrInvalidToken},
+		{name: "unknown principal type", token: sign(jwt.SigningMethodHS256, "k1", unknownType, secret), want: ErrInvalidToken},
+		{name: "garbage", token: "not.a.jwt", want: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ts.Authenticate(tt.token); !errors.Is(err, tt.want) {
+				t.Errorf("Authenticate = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, base32 encoded
+var rfcSecret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestVerifyTOTP(t *testing.T) {
+	// The RFC's 8 digit codes end in the 6 digit ones
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / 30
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		now      time.Time
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "RFC vector at 59", secret: rfcSecret, code: "287082", now: time.Unix(59, 0), wantStep: 1, wantOK: true},
+		{name: "RFC vector at 1111111109", secret: rfcSecret, code: "081804", now: time.Unix(1111111109, 0), wantStep: 37037036, wantOK: true},
+		{name: "current code", secret: rfcSecret, code: "005924", now: now, wantStep: step, wantOK: true},
+		{name: "lowercase secret", secret: strings.ToLower(rfcSecret), code: "005924", now: now, wantStep: step, wantOK: true},
+		{name: "code of the previous period", secret: rfcSecret, code: "005924", now: now.Add(30 * time.Second), wantStep: step, wantOK: true},
+		{name: "code of the next period", secret: rfcSecret, code: "005924", now: now.Add(-30 * time.Second), wantStep: step, wantOK: true},
+		{name: "code two periods old", secret: rfcSecret, code: "005924", now: now.Add(time.Minute), wantOK: false},
+		{name: "replayed code", secret: rfcSecret, code: "005924", now: now, lastStep: step, wantOK: false},
+		{name: "wrong code", secret: rfcSecret, code: "005925", now: now, wantOK: false},
+		{name: "short code", secret: rfcSecret, code: "05924", now: now, wantOK: false},
+		{name: "invalid secret", secret: "not base32!", code: "005924", now: now, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := VerifyTOTP(tt.secret, tt.code, tt.now, tt.lastStep)
+			if ok != tt.wantOK || (ok && gotStep != tt.wantStep) {
+				t.Errorf("VerifyTOTP = %d, %v; want %d, %v", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes, %v; want 20", secret, len(key), err)
+	}
+
+	now := time.Now()
+	code := totpCode(key, now.Unix()/30)
+	if _, ok := VerifyTOTP(secret, code, now, 0); !ok {
+		t.Error("a code generated from the secret was rejected")
+	}
+}
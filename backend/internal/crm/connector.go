@@ -0,0 +1,307 @@
+/**
+ * CRM Connector
+ * Generic interface and registry for CRM integrations
+ */
+
+package crm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownType = errors.New("unknown CRM type")
+
+// Contact is a Lynkr attendee as it is sent to a CRM. Fields holds CRM field
+// names and values, already mapped from Lynkr attributes; for contacts that
+// were synced before it only holds the fields that changed.
+type Contact struct {
+	Email string
+	Name  string
+	// ExternalID is the CRM's record ID from a previous sync, if known
+	ExternalID string
+	Fields     map[string]interface{}
+}
+
+// Result is the outcome of upserting one contact
+type Result struct {
+	ExternalID string // the CRM's record ID, when the CRM reports it
+	Err        error
+}
+
+// Connector pushes contacts to one CRM account
+type Connector interface {
+	// UpsertContacts creates or updates up to BatchSize contacts, matched on
+	// email or external ID so repeated pushes don't create duplicates. It
+	// returns one result per contact, in order, or an error when the whole
+	// batch failed.
+	UpsertContacts(ctx context.Context, contacts []Contact) ([]Result, error)
+}
+
+// Config holds the per-integration settings a connector is built from
+type Config struct {
+	BaseURL   string            // API origin; empty uses the connector's default
+	APIKey    string            // API key or access token
+	APISecret string            // optional, used by some CRMs to sign webhooks
+	Settings  map[string]string // connector specific settings such as a list ID
+	Client    *http.Client
+}
+
+// Setting returns a connector specific setting
+func (c Config) Setting(name string) string {
+	return c.Settings[name]
+}
+
+// Info describes a registered CRM type
+type Info struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Settings lists the connector specific settings an integration must provide
+	Settings []string `json:"settings,omitempty"`
+	// DefaultFieldMapping maps Lynkr attributes to CRM fields for
+	// integrations without their own mapping
+	DefaultFieldMapping map[string]string `json:"defaultFieldMapping"`
+	// BatchSize is the most contacts the CRM accepts in one upsert request
+	BatchSize int `json:"batchSize"`
+}
+
+// Factory builds a connector for one integration
+type Factory func(config Config) (Connector, error)
+
+type registration struct {
+	info    Info
+	factory Factory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []registration
+)
+
+// Built-in connectors, listed in this order by Types
+func init() {
+	Register(Info{
+		ID:          "salesforce",
+		Name:        "Salesforce",
+		Description: "Salesforce CRM integration",
+		BatchSize:   200,
+		DefaultFieldMapping: map[string]string{
+			"first_name": "FirstName",
+			"last_name":  "LastName",
+			"event_id":   "EventId__c",
+			"source":     "LeadSource",
+		},
+	}, newSalesforceConnector)
+	Register(Info{
+		ID:          "hubspot",
+		Name:        "HubSpot",
+		Description: "HubSpot CRM integration",
+		BatchSize:   100,
+		DefaultFieldMapping: map[string]string{
+			"first_name": "firstname",
+			"last_name":  "lastname",
+			"event_id":   "event_id",
+			"source":     "source",
+		},
+	}, newHubSpotConnector)
+	Register(Info{
+		ID:          "mailchimp",
+		Name:        "Mailchimp",
+		Description: "Mailchimp email marketing integration",
+		BatchSize:   500,
+		Settings:    []string{"list_id"},
+		DefaultFieldMapping: map[string]string{
+			"first_name": "FNAME",
+			"last_name":  "LNAME",
+			"event_id":   "EVENT_ID",
+		},
+	}, newMailchimpConnector)
+}
+
+// Register makes a CRM type available for integrations. It panics if the ID
+// is taken. A BatchSize below one means contacts are upserted one at a time.
+func Register(info Info, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if info.BatchSize < 1 {
+		info.BatchSize = 1
+	}
+
+	for _, existing := range registry {
+		if existing.info.ID == info.ID {
+			panic("crm: connector registered twice: " + info.ID)
+		}
+	}
+	registry = append(registry, registration{info: info, factory: factory})
+}
+
+// Lookup returns the registered CRM type with the given ID
+func Lookup(crmType string) (Info, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, r := range registry {
+		if r.info.ID == crmType {
+			return r.info, true
+		}
+	}
+	return Info{}, false
+}
+
+// Types returns all registered CRM types in registration order
+func Types() []Info {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	types := make([]Info, len(registry))
+	for i, r := range registry {
+		types[i] = r.info
+	}
+	return types
+}
+
+// New builds a connector for an integration of the given CRM type
+func New(crmType string, config Config) (Connector, error) {
+	registryMu.RLock()
+	var factory Factory
+	var info Info
+	for _, r := range registry {
+		if r.info.ID == crmType {
+			factory, info = r.factory, r.info
+		}
+	}
+	registryMu.RUnlock()
+
+	if factory == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, crmType)
+	}
+	for _, setting := range info.Settings {
+		if config.Setting(setting) == "" {
+			return nil, fmt.Errorf("%s requires the %q setting", info.Name, setting)
+		}
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+
+	return factory(config)
+}
+
+// HTTPError is returned when a CRM API responds with an error status
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is the wait the CRM asked for with a Retry-After header
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("CRM API error: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("CRM API error: %d: %s", e.StatusCode, e.Body)
+}
+
+// RateLimited reports whether err is a rate limit response and how long the
+// CRM asked to wait before the next request
+func RateLimited(err error) (time.Duration, bool) {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return httpErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// sendJSON sends a JSON request and decodes the response into out, unless out
+// is nil. Error statuses are returned as an *HTTPError.
+func sendJSON(ctx context.Context, client *http.Client, method, url string, body, out interface{}, authorize func(*http.Request)) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	authorize(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &HTTPError{
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(string(message)),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	if out == nil {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode CRM response: %w", err)
+	}
+	return nil
+}
+
+func bearer(token string) func(*http.Request) {
+	return func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// matchResults builds the results of a batch for CRMs that report upserted
+// records and failures by email address rather than in request order
+func matchResults(crmName string, contacts []Contact, ids, failures map[string]string) []Result {
+	results := make([]Result, len(contacts))
+	for i, contact := range contacts {
+		email := normalizeEmail(contact.Email)
+		switch {
+		case ids[email] != "":
+			results[i].ExternalID = ids[email]
+		case failures[email] != "":
+			results[i].Err = errors.New(failures[email])
+		default:
+			results[i].Err = fmt.Errorf("contact missing from %s response", crmName)
+		}
+	}
+	return results
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
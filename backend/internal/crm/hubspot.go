@@ -0,0 +1,147 @@
+/**
+ * HubSpot Connector
+ * Upserts contacts through the HubSpot CRM v3 batch API and receives contact webhooks
+ */
+
+package crm
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const hubSpotDefaultBaseURL = "https://api.hubapi.com"
+
+type HubSpotConnector struct {
+	config Config
+}
+
+type hubSpotUpsertInput struct {
+	IDProperty string                 `json:"idProperty"`
+	ID         string                 `json:"id"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type hubSpotUpsertResponse struct {
+	Results []struct {
+		ID         string            `json:"id"`
+		Properties map[string]string `json:"properties"`
+	} `json:"results"`
+	Errors []struct {
+		Message string              `json:"message"`
+		Context map[string][]string `json:"context"`
+	} `json:"errors"`
+}
+
+// newHubSpotConnector uses a private app access token as the API key
+func newHubSpotConnector(config Config) (Connector, error) {
+	if config.BaseURL == "" {
+		config.BaseURL = hubSpotDefaultBaseURL
+	}
+	return &HubSpotConnector{config: config}, nil
+}
+
+// UpsertContacts matches contacts on their email address
+func (hc *HubSpotConnector) UpsertContacts(ctx context.Context, contacts []Contact) ([]Result, error) {
+	inputs := make([]hubSpotUpsertInput, len(contacts))
+	for i, contact := range contacts {
+		properties := map[string]interface{}{}
+		for field, value := range contact.Fields {
+			properties[field] = value
+		}
+		properties["email"] = contact.Email
+		inputs[i] = hubSpotUpsertInput{IDProperty: "email", ID: contact.Email, Properties: properties}
+	}
+
+	var response hubSpotUpsertResponse
+	url := hc.config.BaseURL + "/crm/v3/objects/contacts/batch/upsert"
+	if err := sendJSON(ctx, hc.config.Client, http.MethodPost, url, map[string]interface{}{"inputs": inputs}, &response, bearer(hc.config.APIKey)); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]string, len(response.Results))
+	for _, result := range response.Results {
+		ids[normalizeEmail(result.Properties["email"])] = result.ID
+	}
+	// Failed inputs are reported with their IDs, i.e. the email addresses
+	failures := make(map[string]string)
+	for _, failure := range response.Errors {
+		for _, values := range failure.Context {
+			for _, value := range values {
+				failures[normalizeEmail(value)] = failure.Message
+			}
+		}
+	}
+
+	return matchResults("HubSpot", contacts, ids, failures), nil
+}
+
+// hubSpotWebhookEvent is one entry of a HubSpot webhook notification
+type hubSpotWebhookEvent struct {
+	SubscriptionType string      `json:"subscriptionType"`
+	ObjectID         json.Number `json:"objectId"`
+	PropertyName     string      `json:"propertyName"`
+	PropertyValue    string      `json:"propertyValue"`
+	OccurredAt       int64       `json:"occurredAt"` // milliseconds
+}
+
+// ParseWebhook verifies a v3 request signature, the base64 HMAC-SHA256 of
+// method, URL, body and timestamp keyed with the app's client secret, which
+// is stored as the API secret. Opt-outs and GDPR deletions unsubscribe the
+// contact; other contact property changes are reported as field updates.
+func (hc *HubSpotConnector) ParseWebhook(request WebhookRequest) ([]ContactUpdate, error) {
+	if hc.config.APISecret == "" {
+		return nil, ErrWebhookNotConfigured
+	}
+
+	timestamp := request.Header.Get("X-HubSpot-Request-Timestamp")
+	millis, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.UnixMilli(millis)) > webhookMaxAge {
+		return nil, ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(hc.config.APISecret))
+	mac.Write([]byte(request.Method + request.URL + string(request.Body) + timestamp))
+	signature, err := base64.StdEncoding.DecodeString(request.Header.Get("X-HubSpot-Signature-v3"))
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var events []hubSpotWebhookEvent
+	decoder := json.NewDecoder(bytes.NewReader(request.Body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&events); err != nil {
+		return nil, ErrInvalidWebhook
+	}
+
+	var updates []ContactUpdate
+	for _, event := range events {
+		update := ContactUpdate{
+			ExternalID: event.ObjectID.String(),
+			OccurredAt: time.UnixMilli(event.OccurredAt).UTC(),
+		}
+		switch {
+		case event.SubscriptionType == "contact.privacyDeletion":
+			update.Unsubscribed = true
+		case event.SubscriptionType != "contact.propertyChange":
+			continue
+		case event.PropertyName == "hs_email_optout":
+			if event.PropertyValue != "true" {
+				continue
+			}
+			update.Unsubscribed = true
+		default:
+			update.Fields = map[string]interface{}{event.PropertyName: event.PropertyValue}
+		}
+		updates = append(updates, update)
+	}
+
+	return updates, nil
+}
@@ -0,0 +1,209 @@
+package crm
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestConnector(t *testing.T, crmType string, config Config) Connector {
+	t.Helper()
+	connector, err := New(crmType, config)
+	if err != nil {
+		t.Fatalf("New(%q): %v", crmType, err)
+	}
+	return connector
+}
+
+func TestHubSpotUpsertContacts(t *testing.T) {
+	var inputs []hubSpotUpsertInput
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/crm/v3/objects/contacts/batch/upsert" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer pat-token" {
+			t.Errorf("Authorization = %q, want the bearer token", got)
+		}
+		var body struct {
+			Inputs []hubSpotUpsertInput `json:"inputs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		inputs = body.Inputs
+
+		// HubSpot echoes emails as stored, reports failures by input ID and
+		// leaves out inputs it skipped
+		fmt.Fprint(w, `{
+			"results": [{"id": "101", "properties": {"email": "ada@example.com"}}],
+			"errors": [{"message": "Property values were not valid", "context": {"ids": ["grace@example.com"]}}]
+		}`)
+	}))
+	defer server.Close()
+
+	connector := newTestConnector(t, "hubspot", Config{BaseURL: server.URL + "/", APIKey: "pat-token", Client: server.Client()})
+	results, err := connector.UpsertContacts(context.Background(), []Contact{
+		{Email: "Ada@Example.com", Fields: map[string]interface{}{"firstname": "Ada", "points": 12}},
+		{Email: "grace@example.com", Fields: map[string]interface{}{"firstname": "Grace"}},
+		{Email: "alan@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("UpsertContacts: %v", err)
+	}
+
+	if len(inputs) != 3 {
+		t.Fatalf("sent %d inputs, want 3", len(inputs))
+	}
+	first := inputs[0]
+	if first.IDProperty != "email" || first.ID != "Ada@Example.com" {
+		t.Errorf("input = %+v, want an upsert on the email address", first)
+	}
+	if first.Properties["email"] != "Ada@Example.com" || first.Properties["firstname"] != "Ada" || first.Properties["points"] != float64(12) {
+		t.Errorf("properties = %v", first.Properties)
+	}
+	if _, ok := inputs[2].Properties["email"]; !ok {
+		t.Errorf("contact without fields is sent without its email property")
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if results[0].Err != nil || results[0].ExternalID != "101" {
+		t.Errorf("result 0 = %+v, want record 101", results[0])
+	}
+	if results[1].Err == nil || results[1].Err.Error() != "Property values were not valid" {
+		t.Errorf("result 1 = %+v, want the reported error", results[1])
+	}
+	if results[2].Err == nil || results[2].ExternalID != "" {
+		t.Errorf("result 2 = %+v, want an error for the missing contact", results[2])
+	}
+}
+
+func TestUpsertContactsErrorStatuses(t *testing.T) {
+	retryAt := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		name           string
+		status         int
+		retryAfter     string
+		wantLimited    bool
+		wantRetryAfter time.Duration
+	}{
+		{name: "rate limited in seconds", status: http.StatusTooManyRequests, retryAfter: "10", wantLimited: true, wantRetryAfter: 10 * time.Second},
+		{name: "rate limited until a date", status: http.StatusTooManyRequests, retryAfter: retryAt, wantLimited: true, wantRetryAfter: time.Hour},
+		{name: "rate limited without Retry-After", status: http.StatusTooManyRequests, wantLimited: true},
+		{name: "bad credentials", status: http.StatusUnauthorized},
+		{name: "CRM down", status: http.StatusServiceUnavailable, retryAfter: "5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, `{"message": "nope"}`)
+			}))
+			defer server.Close()
+
+			connector := newTestConnector(t, "hubspot", Config{BaseURL: server.URL, APIKey: "pat-token", Client: server.Client()})
+			results, err := connector.UpsertContacts(context.Background(), []Contact{{Email: "ada@example.com"}})
+			if results != nil {
+				t.Errorf("results = %v, want none when the batch failed", results)
+			}
+			var httpErr *HTTPError
+			if !errors.As(err, &httpErr) || httpErr.StatusCode != tt.status || httpErr.Body != `{"message": "nope"}` {
+				t.Fatalf("err = %v, want an HTTPError with status %d", err, tt.status)
+			}
+
+			wait, limited := RateLimited(err)
+			if limited != tt.wantLimited {
+				t.Errorf("RateLimited = %v, want %v", limited, tt.wantLimited)
+			}
+			// Dates are converted to a wait when the response arrives
+			if wait > tt.wantRetryAfter || wait < tt.wantRetryAfter-5*time.Second {
+				t.Errorf("RateLimited wait = %v, want %v", wait, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestHubSpotParseWebhook(t *testing.T) {
+	const webhookURL = "https://api.lynkr.test/api/v1/crm/webhooks/crm_1"
+	body := []byte(`[
+		{"subscriptionType": "contact.propertyChange", "objectId": 101, "propertyName": "hs_email_optout", "propertyValue": "true", "occurredAt": 1791000000000},
+		{"subscriptionType": "contact.propertyChange", "objectId": 102, "propertyName": "hs_email_optout", "propertyValue": "false", "occurredAt": 1791000000000},
+		{"subscriptionType": "contact.propertyChange", "objectId": 103, "propertyName": "firstname", "propertyValue": "Grace", "occurredAt": 1791000000000},
+		{"subscriptionType": "contact.privacyDeletion", "objectId": 104, "occurredAt": 1791000000000},
+		{"subscriptionType": "deal.creation", "objectId": 105, "occurredAt": 1791000000000}
+	]`)
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).UnixMilli(), 10)
+
+	sign := func(secret, timestamp string, body []byte) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(http.MethodPost + webhookURL + string(body) + timestamp))
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		signature string
+		wantErr   error
+	}{
+		{name: "valid", secret: "client-secret", timestamp: now, body: body, signature: sign("client-secret", now, body)},
+		{name: "tampered body", secret: "client-secret", timestamp: now, body: []byte(`[]`), signature: sign("client-secret", now, body), wantErr: ErrInvalidSignature},
+		{name: "other secret", secret: "client-secret", timestamp: now, body: body, signature: sign("other", now, body), wantErr: ErrInvalidSignature},
+		{name: "replayed", secret: "client-secret", timestamp: stale, body: body, signature: sign("client-secret", stale, body), wantErr: ErrInvalidSignature},
+		{name: "missing timestamp", secret: "client-secret", body: body, signature: sign("client-secret", "", body), wantErr: ErrInvalidSignature},
+		{name: "invalid payload", secret: "client-secret", timestamp: now, body: []byte(`{`), signature: sign("client-secret", now, []byte(`{`)), wantErr: ErrInvalidWebhook},
+		{name: "no secret configured", timestamp: now, body: body, signature: sign("", now, body), wantErr: ErrWebhookNotConfigured},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector := newTestConnector(t, "hubspot", Config{APIKey: "pat-token", APISecret: tt.secret})
+			header := http.Header{}
+			header.Set("X-HubSpot-Request-Timestamp", tt.timestamp)
+			header.Set("X-HubSpot-Signature-v3", tt.signature)
+
+			updates, err := connector.(WebhookReceiver).ParseWebhook(WebhookRequest{Method: http.MethodPost, URL: webhookURL, Header: header, Body: tt.body})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseWebhook = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if len(updates) != 3 {
+				t.Fatalf("got %d updates, want 3: %+v", len(updates), updates)
+			}
+			if updates[0].ExternalID != "101" || !updates[0].Unsubscribed {
+				t.Errorf("update 0 = %+v, want an opt-out", updates[0])
+			}
+			if updates[1].ExternalID != "103" || updates[1].Unsubscribed || updates[1].Fields["firstname"] != "Grace" {
+				t.Errorf("update 1 = %+v, want a field change", updates[1])
+			}
+			if updates[2].ExternalID != "104" || !updates[2].Unsubscribed {
+				t.Errorf("update 2 = %+v, want a deletion to unsubscribe", updates[2])
+			}
+			if !updates[0].OccurredAt.Equal(time.UnixMilli(1791000000000)) {
+				t.Errorf("OccurredAt = %v", updates[0].OccurredAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+/**
+ * Mailchimp Connector
+ * Adds contacts to a Mailchimp audience through the Marketing API and receives audience webhooks
+ */
+
+package crm
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type MailchimpConnector struct {
+	config Config
+	listID string
+}
+
+type mailchimpMember struct {
+	ID           string `json:"id"`
+	EmailAddress string `json:"email_address"`
+}
+
+type mailchimpBatchResponse struct {
+	NewMembers     []mailchimpMember `json:"new_members"`
+	UpdatedMembers []mailchimpMember `json:"updated_members"`
+	Errors         []struct {
+		EmailAddress string `json:"email_address"`
+		Error        string `json:"error"`
+	} `json:"errors"`
+}
+
+// newMailchimpConnector adds members to the audience in the list_id setting.
+// Without a base URL the datacenter is taken from the API key suffix, e.g.
+// the "us6" in "abc123-us6".
+func newMailchimpConnector(config Config) (Connector, error) {
+	if config.BaseURL == "" {
+		i := strings.LastIndex(config.APIKey, "-")
+		if i < 0 || i == len(config.APIKey)-1 {
+			return nil, errors.New("Mailchimp API key has no datacenter suffix")
+		}
+		config.BaseURL = "https://" + config.APIKey[i+1:] + ".api.mailchimp.com"
+	}
+	return &MailchimpConnector{config: config, listID: config.Setting("list_id")}, nil
+}
+
+// UpsertContacts batch subscribes new contacts and updates the merge fields
+// of audience members that already exist, leaving their subscription status
+// alone so members who unsubscribed stay unsubscribed. Mailchimp keys
+// members on their email address.
+func (mc *MailchimpConnector) UpsertContacts(ctx context.Context, contacts []Contact) ([]Result, error) {
+	members := make([]map[string]interface{}, len(contacts))
+	for i, contact := range contacts {
+		mergeFields := map[string]interface{}{}
+		for field, value := range contact.Fields {
+			mergeFields[field] = value
+		}
+		members[i] = map[string]interface{}{
+			"email_address": contact.Email,
+			"status_if_new": "subscribed",
+			"merge_fields":  mergeFields,
+		}
+	}
+
+	payload := map[string]interface{}{
+		"members":         members,
+		"update_existing": true,
+	}
+
+	var response mailchimpBatchResponse
+	endpoint := mc.config.BaseURL + "/3.0/lists/" + url.PathEscape(mc.listID)
+	if err := sendJSON(ctx, mc.config.Client, http.MethodPost, endpoint, payload, &response, mc.authorize); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]string)
+	for _, member := range append(response.NewMembers, response.UpdatedMembers...) {
+		ids[normalizeEmail(member.EmailAddress)] = member.ID
+	}
+	failures := make(map[string]string)
+	for _, failure := range response.Errors {
+		failures[normalizeEmail(failure.EmailAddress)] = failure.Error
+	}
+
+	return matchResults("Mailchimp", contacts, ids, failures), nil
+}
+
+// authorize uses HTTP basic auth; Mailchimp ignores the user name
+func (mc *MailchimpConnector) authorize(req *http.Request) {
+	req.SetBasicAuth("lynkr", mc.config.APIKey)
+}
+
+// ParseWebhook handles Mailchimp's form encoded audience webhooks. Mailchimp
+// doesn't sign webhooks, so the webhook URL must carry the API secret in its
+// "secret" query parameter. Unsubscribes and profile updates of the
+// configured audience are reported.
+func (mc *MailchimpConnector) ParseWebhook(request WebhookRequest) ([]ContactUpdate, error) {
+	if mc.config.APISecret == "" {
+		return nil, ErrWebhookNotConfigured
+	}
+
+	requestURL, err := url.Parse(request.URL)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	secret := requestURL.Query().Get("secret")
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(mc.config.APISecret)) != 1 {
+		return nil, ErrInvalidSignature
+	}
+
+	form, err := url.ParseQuery(string(request.Body))
+	if err != nil {
+		return nil, ErrInvalidWebhook
+	}
+	if form.Get("data[list_id]") != mc.listID {
+		return nil, nil
+	}
+
+	update := ContactUpdate{
+		Email:      form.Get("data[email]"),
+		ExternalID: form.Get("data[id]"),
+	}
+	if firedAt, err := time.Parse("2006-01-02 15:04:05", form.Get("fired_at")); err == nil {
+		update.OccurredAt = firedAt
+	}
+
+	switch form.Get("type") {
+	case "unsubscribe":
+		update.Unsubscribed = true
+	case "profile":
+		update.Fields = make(map[string]interface{})
+		for key, values := range form {
+			if strings.HasPrefix(key, "data[merges][") && strings.HasSuffix(key, "]") && len(values) > 0 {
+				update.Fields[strings.TrimSuffix(strings.TrimPrefix(key, "data[merges]["), "]")] = values[0]
+			}
+		}
+	default:
+		return nil, nil
+	}
+
+	return []ContactUpdate{update}, nil
+}
@@ -0,0 +1,203 @@
+package crm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestMailchimpUpsertContacts(t *testing.T) {
+	var payload struct {
+		Members []struct {
+			EmailAddress string                 `json:"email_address"`
+			Status       *string                `json:"status"`
+			StatusIfNew  string                 `json:"status_if_new"`
+			MergeFields  map[string]interface{} `json:"merge_fields"`
+		} `json:"members"`
+		UpdateExisting bool `json:"update_existing"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/3.0/lists/list 1" {
+			http.NotFound(w, r)
+			return
+		}
+		if _, key, ok := r.BasicAuth(); !ok || key != "key-us6" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+
+		fmt.Fprint(w, `{
+			"new_members": [{"id": "m1", "email_address": "ada@example.com"}],
+			"updated_members": [{"id": "m2", "email_address": "grace@example.com"}],
+			"errors": [{"email_address": "ALAN@example.com", "error": "Alan@example.com looks fake or invalid"}]
+		}`)
+	}))
+	defer server.Close()
+
+	connector := newTestConnector(t, "mailchimp", Config{
+		BaseURL:  server.URL,
+		APIKey:   "key-us6",
+		Settings: map[string]string{"list_id": "list 1"},
+		Client:   server.Client(),
+	})
+	results, err := connector.UpsertContacts(context.Background(), []Contact{
+		{Email: "ada@example.com", Fields: map[string]interface{}{"FNAME": "Ada"}},
+		{Email: "grace@example.com", ExternalID: "m2"},
+		{Email: "alan@example.com"},
+		{Email: "linus@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("UpsertContacts: %v", err)
+	}
+
+	if !payload.UpdateExisting || len(payload.Members) != 4 {
+		t.Fatalf("payload = %+v, want all members with update_existing", payload)
+	}
+	if member := payload.Members[0]; member.EmailAddress != "ada@example.com" || member.StatusIfNew != "subscribed" || member.MergeFields["FNAME"] != "Ada" {
+		t.Errorf("member 0 = %+v", member)
+	}
+	// Existing members keep their status, so an unsubscribe is never undone
+	for i, member := range payload.Members {
+		if member.Status != nil {
+			t.Errorf("member %d sets status %q, want it left to status_if_new", i, *member.Status)
+		}
+	}
+
+	tests := []struct {
+		externalID string
+		wantErr    string
+	}{
+		{externalID: "m1"},
+		{externalID: "m2"},
+		{wantErr: "Alan@example.com looks fake or invalid"},
+		{wantErr: "contact missing from Mailchimp response"},
+	}
+	if len(results) != len(tests) {
+		t.Fatalf("got %d results, want %d", len(results), len(tests))
+	}
+	for i, tt := range tests {
+		result := results[i]
+		if result.ExternalID != tt.externalID {
+			t.Errorf("result %d ExternalID = %q, want %q", i, result.ExternalID, tt.externalID)
+		}
+		if (result.Err == nil) != (tt.wantErr == "") || (result.Err != nil && result.Err.Error() != tt.wantErr) {
+			t.Errorf("result %d Err = %v, want %q", i, result.Err, tt.wantErr)
+		}
+	}
+}
+
+func TestNewMailchimpConnector(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		wantBaseURL string
+		wantErr     bool
+	}{
+		{name: "datacenter from API key", config: Config{APIKey: "abc123-us6", Settings: map[string]string{"list_id": "l1"}}, wantBaseURL: "https://us6.api.mailchimp.com"},
+		{name: "explicit base URL", config: Config{BaseURL: "http://localhost:8080/", APIKey: "abc123", Settings: map[string]string{"list_id": "l1"}}, wantBaseURL: "http://localhost:8080"},
+		{name: "API key without datacenter", config: Config{APIKey: "abc123", Settings: map[string]string{"list_id": "l1"}}, wantErr: true},
+		{name: "API key ending in a dash", config: Config{APIKey: "abc123-", Settings: map[string]string{"list_id": "l1"}}, wantErr: true},
+		{name: "missing list", config: Config{APIKey: "abc123-us6"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector, err := New("mailchimp", tt.config)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("New succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if got := connector.(*MailchimpConnector).config.BaseURL; got != tt.wantBaseURL {
+				t.Errorf("BaseURL = %q, want %q", got, tt.wantBaseURL)
+			}
+		})
+	}
+}
+
+func TestMailchimpParseWebhook(t *testing.T) {
+	const webhookURL = "https://api.lynkr.test/api/v1/crm/webhooks/crm_2"
+	profile := url.Values{
+		"type":                 {"profile"},
+		"fired_at":             {"2026-10-01 09:30:00"},
+		"data[id]":             {"m1"},
+		"data[email]":          {"ada@example.com"},
+		"data[list_id]":        {"l1"},
+		"data[merges][FNAME]":  {"Ada"},
+		"data[merges][POINTS]": {"12"},
+	}
+	unsubscribe := url.Values{
+		"type":          {"unsubscribe"},
+		"data[id]":      {"m2"},
+		"data[email]":   {"grace@example.com"},
+		"data[list_id]": {"l1"},
+	}
+	otherList := url.Values{
+		"type":          {"unsubscribe"},
+		"data[email]":   {"grace@example.com"},
+		"data[list_id]": {"l2"},
+	}
+
+	tests := []struct {
+		name        string
+		secret      string
+		query       string
+		body        url.Values
+		wantErr     error
+		wantUpdates []ContactUpdate
+	}{
+		{
+			name: "profile update", secret: "hook-secret", query: "?secret=hook-secret", body: profile,
+			wantUpdates: []ContactUpdate{{Email: "ada@example.com", ExternalID: "m1", Fields: map[string]interface{}{"FNAME": "Ada", "POINTS": "12"}}},
+		},
+		{
+			name: "unsubscribe", secret: "hook-secret", query: "?secret=hook-secret", body: unsubscribe,
+			wantUpdates: []ContactUpdate{{Email: "grace@example.com", ExternalID: "m2", Unsubscribed: true}},
+		},
+		{name: "other audience", secret: "hook-secret", query: "?secret=hook-secret", body: otherList},
+		{name: "wrong secret", secret: "hook-secret", query: "?secret=guess", body: unsubscribe, wantErr: ErrInvalidSignature},
+		{name: "missing secret", secret: "hook-secret", body: unsubscribe, wantErr: ErrInvalidSignature},
+		{name: "no secret configured", query: "?secret=", body: unsubscribe, wantErr: ErrWebhookNotConfigured},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector := newTestConnector(t, "mailchimp", Config{APIKey: "key-us6", APISecret: tt.secret, Settings: map[string]string{"list_id": "l1"}})
+			updates, err := connector.(WebhookReceiver).ParseWebhook(WebhookRequest{
+				Method: http.MethodPost,
+				URL:    webhookURL + tt.query,
+				Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+				Body:   []byte(tt.body.Encode()),
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseWebhook = %v, want %v", err, tt.wantErr)
+			}
+			if len(updates) != len(tt.wantUpdates) {
+				t.Fatalf("got %d updates, want %d", len(updates), len(tt.wantUpdates))
+			}
+			for i, want := range tt.wantUpdates {
+				got := updates[i]
+				if got.Email != want.Email || got.ExternalID != want.ExternalID || got.Unsubscribed != want.Unsubscribed || len(got.Fields) != len(want.Fields) {
+					t.Errorf("update %d = %+v, want %+v", i, got, want)
+				}
+				for field, value := range want.Fields {
+					if got.Fields[field] != value {
+						t.Errorf("field %s = %v, want %v", field, got.Fields[field], value)
+					}
+				}
+			}
+		})
+	}
+}
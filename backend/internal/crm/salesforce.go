@@ -0,0 +1,101 @@
+/**
+ * Salesforce Connector
+ * Upserts contacts through the Salesforce REST composite API
+ */
+
+package crm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	salesforceDefaultAPIVersion      = "v59.0"
+	salesforceDefaultExternalIDField = "Lynkr_Email__c"
+)
+
+type SalesforceConnector struct {
+	config          Config
+	apiVersion      string
+	externalIDField string
+}
+
+type salesforceSaveResult struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+	Errors  []struct {
+		StatusCode string `json:"statusCode"`
+		Message    string `json:"message"`
+	} `json:"errors"`
+}
+
+// newSalesforceConnector needs the org's instance URL as the base URL, e.g.
+// https://example.my.salesforce.com, and an OAuth access token as the API key.
+// Contacts are upserted on the external ID field in the external_id_field
+// setting, which holds the contact's email address.
+func newSalesforceConnector(config Config) (Connector, error) {
+	if config.BaseURL == "" {
+		return nil, errors.New("Salesforce requires the instance URL as base URL")
+	}
+
+	apiVersion := config.Setting("api_version")
+	if apiVersion == "" {
+		apiVersion = salesforceDefaultAPIVersion
+	}
+	externalIDField := config.Setting("external_id_field")
+	if externalIDField == "" {
+		externalIDField = salesforceDefaultExternalIDField
+	}
+	return &SalesforceConnector{config: config, apiVersion: apiVersion, externalIDField: externalIDField}, nil
+}
+
+func (sc *SalesforceConnector) UpsertContacts(ctx context.Context, contacts []Contact) ([]Result, error) {
+	records := make([]map[string]interface{}, len(contacts))
+	for i, contact := range contacts {
+		record := map[string]interface{}{}
+		for field, value := range contact.Fields {
+			record[field] = value
+		}
+		record["attributes"] = map[string]string{"type": "Contact"}
+		record["Email"] = contact.Email
+		record[sc.externalIDField] = normalizeEmail(contact.Email)
+		records[i] = record
+	}
+
+	payload := map[string]interface{}{
+		"allOrNone": false,
+		"records":   records,
+	}
+
+	// Save results come back in request order
+	var response []salesforceSaveResult
+	endpoint := sc.config.BaseURL + "/services/data/" + sc.apiVersion + "/composite/sobjects/Contact/" + url.PathEscape(sc.externalIDField)
+	if err := sendJSON(ctx, sc.config.Client, http.MethodPatch, endpoint, payload, &response, bearer(sc.config.APIKey)); err != nil {
+		return nil, err
+	}
+	if len(response) != len(contacts) {
+		return nil, fmt.Errorf("Salesforce returned %d results for %d contacts", len(response), len(contacts))
+	}
+
+	results := make([]Result, len(contacts))
+	for i, saved := range response {
+		if saved.Success {
+			results[i].ExternalID = saved.ID
+			continue
+		}
+		messages := make([]string, len(saved.Errors))
+		for j, e := range saved.Errors {
+			messages[j] = e.StatusCode + ": " + e.Message
+		}
+		if len(messages) == 0 {
+			messages = append(messages, "contact rejected by Salesforce")
+		}
+		results[i].Err = errors.New(strings.Join(messages, "; "))
+	}
+	return results, nil
+}
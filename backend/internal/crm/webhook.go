@@ -0,0 +1,47 @@
+/**
+ * CRM Webhooks
+ * Inbound webhook types for connectors that report contact changes back to Lynkr
+ */
+
+package crm
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrInvalidSignature     = errors.New("invalid webhook signature")
+	ErrInvalidWebhook       = errors.New("invalid webhook payload")
+	ErrWebhookNotConfigured = errors.New("webhooks need an API secret")
+)
+
+// webhookMaxAge is how old a signed webhook may be before it is rejected as a replay
+const webhookMaxAge = 5 * time.Minute
+
+// WebhookRequest is an inbound webhook as received by Lynkr
+type WebhookRequest struct {
+	Method string
+	URL    string // the full public URL the CRM sent the request to
+	Header http.Header
+	Body   []byte
+}
+
+// ContactUpdate is a change to a contact made in the CRM
+type ContactUpdate struct {
+	Email      string // empty when the CRM only reports its record ID
+	ExternalID string
+	// Unsubscribed is set when the contact opted out of marketing in the CRM
+	Unsubscribed bool
+	// Fields holds CRM fields that changed and their new values
+	Fields     map[string]interface{}
+	OccurredAt time.Time
+}
+
+// WebhookReceiver is implemented by connectors that accept inbound webhooks
+type WebhookReceiver interface {
+	// ParseWebhook verifies the request with the integration's API secret and
+	// returns the contact updates it carries
+	ParseWebhook(request WebhookRequest) ([]ContactUpdate, error)
+}
@@ -6,12 +6,33 @@
 package ecommerce
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
+var (
+	ErrInvalidSignature     = errors.New("invalid webhook signature")
+	ErrWebhookNotConfigured = errors.New("webhooks need an API secret")
+
+	// Store API errors. An *HTTPError unwraps to the one matching its status,
+	// so callers can test for them with errors.Is.
+	ErrNotFound      = errors.New("not found in store")
+	ErrUnauthorized  = errors.New("store rejected the API credentials")
+	ErrRateLimited   = errors.New("store API rate limit reached")
+	ErrInvalidInput  = errors.New("store rejected the request")
+	ErrUnavailable   = errors.New("store API unavailable")
+	ErrInvalidCursor = errors.New("invalid page cursor")
+
+	ErrUnknownPlatform = errors.New("unknown e-commerce platform")
+)
+
 type Product struct {
 	ID          string  `json:"id"`
 	Name        string  `json:"name"`
@@ -30,136 +51,207 @@ type Purchase struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// Order is a store order as reported by the platform
+type Order struct {
+	ID              string   `json:"id"`
+	Number          string   `json:"number"`
+	Email           string   `json:"email"`
+	CustomerID      string   `json:"customerId"`
+	Currency        string   `json:"currency"`
+	TotalPrice      float64  `json:"totalPrice"`
+	FinancialStatus string   `json:"financialStatus"`
+	Tags            []string `json:"tags"`
+	// Attributes holds the order's custom fields, such as those written by
+	// TrackConversion
+	Attributes    map[string]string `json:"attributes,omitempty"`
+	DiscountCodes []string          `json:"discountCodes,omitempty"`
+	LineItems     []OrderLineItem   `json:"lineItems"`
+	// Refunds are the refunds the order body carries, where the platform
+	// includes them; ListRefunds returns them with full detail
+	Refunds     []Refund   `json:"refunds,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	CancelledAt *time.Time `json:"cancelledAt,omitempty"`
+}
+
+type OrderLineItem struct {
+	ProductID string  `json:"productId"`
+	VariantID string  `json:"variantId"`
+	SKU       string  `json:"sku"`
+	Name      string  `json:"name"`
+	Quantity  int     `json:"quantity"`
+	Price     float64 `json:"price"`
+}
+
+// Refund is money returned on an order, possibly for some of its line items
+type Refund struct {
+	ID        string           `json:"id"`
+	OrderID   string           `json:"orderId"`
+	Amount    float64          `json:"amount"`
+	Reason    string           `json:"reason"`
+	LineItems []RefundLineItem `json:"lineItems"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+type RefundLineItem struct {
+	ProductID string  `json:"productId"`
+	Quantity  int     `json:"quantity"`
+	Amount    float64 `json:"amount"`
+}
+
+// Inventory is the stock of a product, per variant where the store tracks variants
+type Inventory struct {
+	ProductID string             `json:"productId"`
+	Quantity  int                `json:"quantity"`
+	Variants  []VariantInventory `json:"variants,omitempty"`
+}
+
+type VariantInventory struct {
+	VariantID string `json:"variantId"`
+	SKU       string `json:"sku"`
+	Quantity  int    `json:"quantity"`
+}
+
+// ProductPage is one page of a product listing. NextCursor is empty on the
+// last page.
+type ProductPage struct {
+	Products   []Product `json:"products"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+// OrderPage is one page of an order listing. NextCursor is empty on the last
+// page.
+type OrderPage struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+// Connector reads the catalog and order history of one store. Listings are
+// paginated with opaque cursors: an empty cursor requests the first page, and
+// each page carries the cursor of the next one.
 type Connector interface {
+	// GetProducts lists every product of the store
 	GetProducts(brandID string) ([]Product, error)
+	ListProducts(ctx context.Context, cursor string) (*ProductPage, error)
+	// ListOrders lists orders created or changed since the given time,
+	// including cancelled and refunded ones. Callers pass the same since
+	// with every page of a listing.
+	ListOrders(ctx context.Context, since time.Time, cursor string) (*OrderPage, error)
+	GetOrder(ctx context.Context, orderID string) (*Order, error)
+	ListRefunds(ctx context.Context, orderID string) ([]Refund, error)
+	GetInventory(ctx context.Context, productID string) (*Inventory, error)
 	CreatePurchase(userID, productID string, amount float64) (*Purchase, error)
 	TrackConversion(eventID, userID string, purchase *Purchase) error
 }
 
-type ShopifyConnector struct {
-	apiKey    string
-	apiSecret string
-	shopURL   string
-}
-
-func NewShopifyConnector(apiKey, apiSecret, shopURL string) *ShopifyConnector {
-	return &ShopifyConnector{
-		apiKey:    apiKey,
-		apiSecret: apiSecret,
-		shopURL:   shopURL,
+// New builds a connector for a store on one of the supported platforms. A nil
+// client uses a default one.
+func New(platformType, apiKey, apiSecret, storeURL string, client *http.Client) (Connector, error) {
+	switch platformType {
+	case "shopify":
+		return NewShopifyConnector(apiKey, apiSecret, storeURL, client), nil
+	case "woocommerce":
+		return NewWooCommerceConnector(apiKey, apiSecret, storeURL, client), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPlatform, platformType)
 	}
 }
 
-func (sc *ShopifyConnector) GetProducts(brandID string) ([]Product, error) {
-	// Simulate Shopify API call
-	products := []Product{
-		{
-			ID:          "prod_1",
-			Name:        "Sample Product",
-			Price:       29.99,
-			Description: "A great product from the event",
-			ImageURL:    "https://example.com/product.jpg",
-			BrandID:     brandID,
-		},
-	}
-	return products, nil
+// Supported reports whether New can build a connector for the platform
+func Supported(platformType string) bool {
+	return platformType == "shopify" || platformType == "woocommerce"
 }
 
-func (sc *ShopifyConnector) CreatePurchase(userID, productID string, amount float64) (*Purchase, error) {
-	purchase := &Purchase{
-		ID:        fmt.Sprintf("purchase_%d", time.Now().UnixNano()),
-		UserID:    userID,
-		ProductID: productID,
-		Amount:    amount,
-		Timestamp: time.Now(),
-	}
-	return purchase, nil
+// HTTPError is returned when a store API responds with an error status
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is the wait the store asked for with a Retry-After header
+	RetryAfter time.Duration
 }
 
-func (sc *ShopifyConnector) TrackConversion(eventID, userID string, purchase *Purchase) error {
-	// Track conversion in analytics
-	return nil
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("store API error: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("store API error: %d: %s", e.StatusCode, e.Body)
 }
 
-type WooCommerceConnector struct {
-	apiKey    string
-	apiSecret string
-	storeURL  string
+// Unwrap maps the status to one of the store API errors
+func (e *HTTPError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrUnavailable
+	default:
+		return ErrInvalidInput
+	}
 }
 
-func NewWooCommerceConnector(apiKey, apiSecret, storeURL string) *WooCommerceConnector {
-	return &WooCommerceConnector{
-		apiKey:    apiKey,
-		apiSecret: apiSecret,
-		storeURL:  storeURL,
+// RateLimited reports whether err is a rate limit response and how long the
+// store asked to wait before the next request
+func RateLimited(err error) (time.Duration, bool) {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return httpErr.RetryAfter, true
 	}
+	return 0, false
 }
 
-func (wc *WooCommerceConnector) GetProducts(brandID string) ([]Product, error) {
-	url := fmt.Sprintf("%s/wp-json/wc/v3/products", wc.storeURL)
-	
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	
-	req.SetBasicAuth(wc.apiKey, wc.apiSecret)
-	
-	client := &http.Client{Timeout: 10 * time.Second}
+// doJSON sends a request and decodes a JSON response into out, unless out is
+// nil. Error statuses are returned as an *HTTPError. It returns the response
+// headers, which carry pagination links for some platforms.
+func doJSON(ctx context.Context, client *http.Client, req *http.Request, out interface{}) (http.Header, error) {
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	
-	var wcProducts []struct {
-		ID          int     `json:"id"`
-		Name        string  `json:"name"`
-		Price       string  `json:"price"`
-		Description string  `json:"description"`
-		Images      []struct {
-			Src string `json:"src"`
-		} `json:"images"`
-	}
-	
-	if err := json.NewDecoder(resp.Body).Decode(&wcProducts); err != nil {
-		return nil, err
-	}
-	
-	products := make([]Product, len(wcProducts))
-	for i, wp := range wcProducts {
-		imageURL := ""
-		if len(wp.Images) > 0 {
-			imageURL = wp.Images[0].Src
-		}
-		
-		products[i] = Product{
-			ID:          fmt.Sprintf("%d", wp.ID),
-			Name:        wp.Name,
-			Price:       parsePrice(wp.Price),
-			Description: wp.Description,
-			ImageURL:    imageURL,
-			BrandID:     brandID,
+
+	if resp.StatusCode >= 400 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		httpErr := &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(message))}
+		if seconds, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil && seconds > 0 {
+			httpErr.RetryAfter = time.Duration(seconds * float64(time.Second))
 		}
+		return nil, httpErr
+	}
+	if out == nil {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return resp.Header, nil
 	}
-	
-	return products, nil
-}
-
-func (wc *WooCommerceConnector) CreatePurchase(userID, productID string, amount float64) (*Purchase, error) {
-	// Create order via WooCommerce API
-	purchase := &Purchase{
-		ID:        fmt.Sprintf("wc_purchase_%d", time.Now().UnixNano()),
-		UserID:    userID,
-		ProductID: productID,
-		Amount:    amount,
-		Timestamp: time.Now(),
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(out); err != nil {
+		return nil, fmt.Errorf("failed to decode store response: %w", err)
 	}
-	return purchase, nil
+	return resp.Header, nil
 }
 
-func (wc *WooCommerceConnector) TrackConversion(eventID, userID string, purchase *Purchase) error {
-	return nil
+// listAll collects every product by following cursors from the first page
+func listAll(ctx context.Context, connector Connector, brandID string) ([]Product, error) {
+	var products []Product
+	cursor := ""
+	for {
+		page, err := connector.ListProducts(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+		for _, product := range page.Products {
+			product.BrandID = brandID
+			products = append(products, product)
+		}
+		if page.NextCursor == "" {
+			return products, nil
+		}
+		cursor = page.NextCursor
+	}
 }
 
 func parsePrice(priceStr string) float64 {
@@ -167,4 +259,4 @@ func parsePrice(priceStr string) float64 {
 	var price float64
 	fmt.Sscanf(priceStr, "%f", &price)
 	return price
-}
\ No newline at end of file
+}
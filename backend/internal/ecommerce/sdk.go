@@ -6,16 +6,26 @@
 package ecommerce
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-
-	// "net/http"
+	"net/http"
+	"strconv"
 	"time"
 )
 
+// Headers of webhooks in the generic format, for platforms without a connector
+const (
+	SignatureHeader  = "X-Lynkr-Signature"
+	DeliveryIDHeader = "X-Lynkr-Delivery-Id"
+)
+
+var ErrWebhookRegistrationUnsupported = errors.New("webhooks must be registered in the store admin")
+
 type SDK struct {
 	apiKey    string
 	apiSecret string
@@ -45,18 +55,20 @@ func NewSDK(apiKey, apiSecret, baseURL string) *SDK {
 	}
 }
 
-// RegisterWebhook sets up webhook for purchase tracking
+// RegisterWebhook subscribes the integration's webhook URL to the store's
+// order webhooks. Platforms without a connector that can do this return
+// ErrWebhookRegistrationUnsupported; their webhooks are set up in the store
+// admin, signed as ValidateWebhook expects.
 func (sdk *SDK) RegisterWebhook(config IntegrationConfig) error {
-	payload := map[string]interface{}{
-		"webhook_url": config.WebhookURL,
-		"events":      []string{"order.created", "order.completed"},
-		"platform":    config.PlatformType,
+	connector, err := New(config.PlatformType, config.APIKey, config.APISecret, config.StoreURL, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrWebhookRegistrationUnsupported, config.PlatformType)
 	}
-
-	// Simulate webhook registration
-	fmt.Printf("Registering webhook for %s: %s\n", config.PlatformType, config.WebhookURL)
-	fmt.Printf("Webhook registration payload: %v\n", payload)
-	return nil
+	registrar, ok := connector.(WebhookRegistrar)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrWebhookRegistrationUnsupported, config.PlatformType)
+	}
+	return registrar.RegisterWebhooks(context.Background(), config.WebhookURL)
 }
 
 // ValidateWebhook verifies webhook signature
@@ -67,34 +79,165 @@ func (sdk *SDK) ValidateWebhook(payload []byte, signature string) bool {
 	return hmac.Equal([]byte(signature), []byte(expectedSignature))
 }
 
-// ProcessWebhook handles incoming webhook data
-func (sdk *SDK) ProcessWebhook(payload WebhookPayload) error {
+// VerifyWebhook checks the X-Lynkr-Signature header of a webhook in the
+// generic format with ValidateWebhook
+func (sdk *SDK) VerifyWebhook(body []byte, header http.Header) error {
+	if sdk.apiSecret == "" {
+		return ErrWebhookNotConfigured
+	}
+	if !sdk.ValidateWebhook(body, header.Get(SignatureHeader)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// WebhookDelivery reads the delivery ID from the X-Lynkr-Delivery-Id header
+// and the topic from the payload's event
+func (sdk *SDK) WebhookDelivery(body []byte, header http.Header) (WebhookDelivery, error) {
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Event == "" {
+		return WebhookDelivery{}, fmt.Errorf("%w: missing event", ErrInvalidWebhook)
+	}
+
+	delivery := WebhookDelivery{ID: header.Get(DeliveryIDHeader), Topic: payload.Event}
+	if delivery.ID == "" {
+		delivery.ID = bodyDeliveryID(body)
+	}
+	return delivery, nil
+}
+
+// ParseOrderWebhook decodes a webhook in the generic format
+func (sdk *SDK) ParseOrderWebhook(topic string, body []byte) (*Order, error) {
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	return sdk.ProcessWebhook(payload)
+}
+
+// ParseRefundWebhook decodes an order.refunded webhook in the generic format.
+// The data carries order_id, refund_id and the refunded amount, and
+// optionally product_id and reason.
+func (sdk *SDK) ParseRefundWebhook(topic string, body []byte) (*Refund, error) {
+	if topic != "order.refunded" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedWebhook, topic)
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+
+	orderID, ok := webhookString(payload.Data, "order_id")
+	if !ok || orderID == "" {
+		return nil, fmt.Errorf("%w: order_id is required", ErrInvalidWebhook)
+	}
+	refundID, ok := webhookString(payload.Data, "refund_id")
+	if !ok || refundID == "" {
+		return nil, fmt.Errorf("%w: refund_id is required", ErrInvalidWebhook)
+	}
+	amount, ok := webhookNumber(payload.Data, "amount")
+	if !ok || amount < 0 {
+		return nil, fmt.Errorf("%w: amount must be a positive number", ErrInvalidWebhook)
+	}
+	productID, _ := webhookString(payload.Data, "product_id")
+	reason, _ := webhookString(payload.Data, "reason")
+
+	refund := &Refund{ID: refundID, OrderID: orderID, Amount: amount, Reason: reason, CreatedAt: payload.Timestamp}
+	if refund.CreatedAt.IsZero() {
+		refund.CreatedAt = time.Now().UTC()
+	}
+	if productID != "" {
+		refund.LineItems = []RefundLineItem{{ProductID: productID, Quantity: 1, Amount: amount}}
+	}
+	return refund, nil
+}
+
+// ProcessWebhook maps a webhook in the generic format to the order it
+// reports. The data carries order_id, user_id and amount, and optionally
+// product_id, event_id, email and currency. order.cancelled marks the order
+// cancelled; refunds are reported with order.refunded.
+func (sdk *SDK) ProcessWebhook(payload WebhookPayload) (*Order, error) {
+	var financialStatus string
 	switch payload.Event {
 	case "order.created":
-		return sdk.handleOrderCreated(payload.Data)
+		financialStatus = "pending"
 	case "order.completed":
-		return sdk.handleOrderCompleted(payload.Data)
+		financialStatus = "paid"
+	case "order.cancelled":
+		financialStatus = "voided"
 	default:
-		return fmt.Errorf("unknown event type: %s", payload.Event)
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedWebhook, payload.Event)
 	}
-}
 
-func (sdk *SDK) handleOrderCreated(data map[string]interface{}) error {
-	orderID := data["order_id"].(string)
-	userID := data["user_id"].(string)
-	amount := data["amount"].(float64)
+	orderID, ok := webhookString(payload.Data, "order_id")
+	if !ok || orderID == "" {
+		return nil, fmt.Errorf("%w: order_id is required", ErrInvalidWebhook)
+	}
+	userID, ok := webhookString(payload.Data, "user_id")
+	if !ok {
+		return nil, fmt.Errorf("%w: user_id is required", ErrInvalidWebhook)
+	}
+	amount, ok := webhookNumber(payload.Data, "amount")
+	if !ok {
+		return nil, fmt.Errorf("%w: amount must be a number", ErrInvalidWebhook)
+	}
+	productID, _ := webhookString(payload.Data, "product_id")
+	eventID, _ := webhookString(payload.Data, "event_id")
+	email, _ := webhookString(payload.Data, "email")
+	currency, _ := webhookString(payload.Data, "currency")
 
-	fmt.Printf("Order created: %s for user %s, amount: %.2f\n", orderID, userID, amount)
-	return nil
+	createdAt := payload.Timestamp
+	if createdAt.IsZero() {
+		createdAt = time.Now().UTC()
+	}
+	order := &Order{
+		ID:              orderID,
+		Number:          orderID,
+		Email:           email,
+		Currency:        currency,
+		TotalPrice:      amount,
+		FinancialStatus: financialStatus,
+		Attributes:      map[string]string{"lynkr_user_id": userID},
+		CreatedAt:       createdAt,
+		UpdatedAt:       createdAt,
+	}
+	if payload.Event == "order.cancelled" {
+		order.CancelledAt = &createdAt
+	}
+	if eventID != "" {
+		order.Attributes["lynkr_event_id"] = eventID
+	}
+	if productID != "" {
+		order.LineItems = []OrderLineItem{{ProductID: productID, Quantity: 1, Price: amount}}
+	}
+	return order, nil
 }
 
-func (sdk *SDK) handleOrderCompleted(data map[string]interface{}) error {
-	orderID := data["order_id"].(string)
-	userID := data["user_id"].(string)
-	amount := data["amount"].(float64)
+// webhookString reads a string field of webhook data. Numeric IDs are
+// accepted and formatted without a fraction.
+func webhookString(data map[string]interface{}, key string) (string, bool) {
+	switch value := data[key].(type) {
+	case string:
+		return value, true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
 
-	fmt.Printf("Order completed: %s for user %s, amount: %.2f\n", orderID, userID, amount)
-	return nil
+// webhookNumber reads a numeric field of webhook data, which may also be a
+// decimal string
+func webhookNumber(data map[string]interface{}, key string) (float64, bool) {
+	switch value := data[key].(type) {
+	case float64:
+		return value, true
+	case string:
+		number, err := strconv.ParseFloat(value, 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
 }
 
 // CreateSecureToken generates secure token for API access
@@ -130,31 +273,3 @@ func (sdk *SDK) GetIntegrationStatus(platformType string) (map[string]interface{
 
 	return status, nil
 }
-
-// SyncProducts synchronizes products from e-commerce platform
-func (sdk *SDK) SyncProducts(connector Connector, brandID string) ([]Product, error) {
-	products, err := connector.GetProducts(brandID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to sync products: %w", err)
-	}
-
-	// Store products in database (simplified)
-	fmt.Printf("Synced %d products for brand %s\n", len(products), brandID)
-
-	return products, nil
-}
-
-// TrackPurchaseAttribution links purchases to events
-func (sdk *SDK) TrackPurchaseAttribution(eventID, userID string, purchase *Purchase) error {
-	attribution := map[string]interface{}{
-		"event_id":    eventID,
-		"user_id":     userID,
-		"purchase_id": purchase.ID,
-		"amount":      purchase.Amount,
-		"timestamp":   purchase.Timestamp,
-	}
-
-	// Store attribution data
-	fmt.Printf("Tracking purchase attribution: %+v\n", attribution)
-	return nil
-}
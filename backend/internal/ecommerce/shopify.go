@@ -0,0 +1,544 @@
+/**
+ * Shopify Connector
+ * Reads products and orders through the Shopify Admin REST API and receives order webhooks
+ */
+
+package ecommerce
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	shopifyAPIVersion = "2024-07"
+	// shopifyPageSize is the largest page the Admin API returns
+	shopifyPageSize = 250
+	// ShopifyHMACHeader carries the signature of a Shopify webhook
+	ShopifyHMACHeader = "X-Shopify-Hmac-Sha256"
+	// ShopifyTopicHeader and ShopifyWebhookIDHeader carry the topic and the
+	// delivery ID of a Shopify webhook
+	ShopifyTopicHeader     = "X-Shopify-Topic"
+	ShopifyWebhookIDHeader = "X-Shopify-Webhook-Id"
+)
+
+// ShopifyWebhookTopics are the webhooks RegisterWebhooks subscribes to
+var ShopifyWebhookTopics = []string{"orders/create", "orders/updated", "orders/cancelled", "refunds/create"}
+
+type ShopifyConnector struct {
+	apiKey    string // Admin API access token
+	apiSecret string // app client secret, signs webhooks
+	shopURL   string
+	client    *http.Client
+}
+
+type shopifyProduct struct {
+	ID       int64  `json:"id"`
+	Title    string `json:"title"`
+	BodyHTML string `json:"body_html"`
+	Variants []struct {
+		ID    int64  `json:"id"`
+		Price string `json:"price"`
+	} `json:"variants"`
+	Image *struct {
+		Src string `json:"src"`
+	} `json:"image"`
+}
+
+type shopifyOrder struct {
+	ID              int64      `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Currency        string     `json:"currency"`
+	TotalPrice      string     `json:"total_price"`
+	FinancialStatus string     `json:"financial_status"`
+	Tags            string     `json:"tags"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	CancelledAt     *time.Time `json:"cancelled_at"`
+	Customer        *struct {
+		ID int64 `json:"id"`
+	} `json:"customer"`
+	NoteAttributes []shopifyNoteAttribute `json:"note_attributes"`
+	DiscountCodes  []struct {
+		Code string `json:"code"`
+	} `json:"discount_codes"`
+	Refunds   []shopifyRefund `json:"refunds"`
+	LineItems []struct {
+		ProductID *int64 `json:"product_id"`
+		VariantID *int64 `json:"variant_id"`
+		SKU       string `json:"sku"`
+		Name      string `json:"name"`
+		Quantity  int    `json:"quantity"`
+		Price     string `json:"price"`
+	} `json:"line_items"`
+}
+
+type shopifyRefund struct {
+	ID           int64     `json:"id"`
+	OrderID      int64     `json:"order_id"`
+	Note         string    `json:"note"`
+	CreatedAt    time.Time `json:"created_at"`
+	Transactions []struct {
+		Kind   string `json:"kind"`
+		Status string `json:"status"`
+		Amount string `json:"amount"`
+	} `json:"transactions"`
+	RefundLineItems []struct {
+		Quantity int    `json:"quantity"`
+		Subtotal string `json:"subtotal"`
+		LineItem struct {
+			ProductID *int64 `json:"product_id"`
+		} `json:"line_item"`
+	} `json:"refund_line_items"`
+}
+
+type shopifyNoteAttribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// NewShopifyConnector connects to a shop with a custom app's Admin API access
+// token. The API secret is the app's client secret, used to verify webhooks.
+// shopURL may omit the scheme, e.g. "brand.myshopify.com". A nil client uses
+// a default one.
+func NewShopifyConnector(apiKey, apiSecret, shopURL string, client *http.Client) *ShopifyConnector {
+	if !strings.Contains(shopURL, "://") {
+		shopURL = "https://" + shopURL
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &ShopifyConnector{
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		shopURL:   strings.TrimRight(shopURL, "/"),
+		client:    client,
+	}
+}
+
+// GetProducts lists every product of the shop. A product's price is that of
+// its first variant.
+func (sc *ShopifyConnector) GetProducts(brandID string) ([]Product, error) {
+	return listAll(context.Background(), sc, brandID)
+}
+
+// ListProducts returns one page of products. Cursors are the API's page_info
+// tokens.
+func (sc *ShopifyConnector) ListProducts(ctx context.Context, cursor string) (*ProductPage, error) {
+	var response struct {
+		Products []shopifyProduct `json:"products"`
+	}
+	header, err := sc.send(ctx, http.MethodGet, sc.endpoint("/products.json", pageQuery(nil, cursor)), nil, &response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Shopify products: %w", err)
+	}
+
+	page := &ProductPage{NextCursor: nextPageInfo(header.Get("Link"))}
+	for _, sp := range response.Products {
+		product := Product{
+			ID:          strconv.FormatInt(sp.ID, 10),
+			Name:        sp.Title,
+			Description: sp.BodyHTML,
+		}
+		if len(sp.Variants) > 0 {
+			product.Price = parsePrice(sp.Variants[0].Price)
+		}
+		if sp.Image != nil {
+			product.ImageURL = sp.Image.Src
+		}
+		page.Products = append(page.Products, product)
+	}
+	return page, nil
+}
+
+// ListOrders lists orders of any status updated since the given time, oldest
+// update first
+func (sc *ShopifyConnector) ListOrders(ctx context.Context, since time.Time, cursor string) (*OrderPage, error) {
+	filter := url.Values{
+		"status":         {"any"},
+		"updated_at_min": {since.UTC().Format(time.RFC3339)},
+		"order":          {"updated_at asc"},
+	}
+
+	var response struct {
+		Orders []shopifyOrder `json:"orders"`
+	}
+	header, err := sc.send(ctx, http.MethodGet, sc.endpoint("/orders.json", pageQuery(filter, cursor)), nil, &response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Shopify orders: %w", err)
+	}
+
+	page := &OrderPage{NextCursor: nextPageInfo(header.Get("Link"))}
+	for _, so := range response.Orders {
+		page.Orders = append(page.Orders, *so.toOrder())
+	}
+	return page, nil
+}
+
+// GetOrder looks up one order, including archived and cancelled ones
+func (sc *ShopifyConnector) GetOrder(ctx context.Context, orderID string) (*Order, error) {
+	var response struct {
+		Order shopifyOrder `json:"order"`
+	}
+	endpoint := sc.endpoint("/orders/"+url.PathEscape(orderID)+".json", url.Values{"status": {"any"}})
+	if _, err := sc.send(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to get Shopify order: %w", err)
+	}
+	return response.Order.toOrder(), nil
+}
+
+// ListRefunds returns the refunds of an order
+func (sc *ShopifyConnector) ListRefunds(ctx context.Context, orderID string) ([]Refund, error) {
+	var response struct {
+		Refunds []shopifyRefund `json:"refunds"`
+	}
+	endpoint := sc.endpoint("/orders/"+url.PathEscape(orderID)+"/refunds.json", nil)
+	if _, err := sc.send(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to list Shopify refunds: %w", err)
+	}
+
+	refunds := make([]Refund, 0, len(response.Refunds))
+	for _, sr := range response.Refunds {
+		refunds = append(refunds, sr.toRefund())
+	}
+	return refunds, nil
+}
+
+// GetInventory returns the available quantity of each of the product's
+// variants, summed over the shop's locations
+func (sc *ShopifyConnector) GetInventory(ctx context.Context, productID string) (*Inventory, error) {
+	var response struct {
+		Product struct {
+			ID       int64 `json:"id"`
+			Variants []struct {
+				ID                int64  `json:"id"`
+				SKU               string `json:"sku"`
+				InventoryQuantity int    `json:"inventory_quantity"`
+			} `json:"variants"`
+		} `json:"product"`
+	}
+	endpoint := sc.endpoint("/products/"+url.PathEscape(productID)+".json", url.Values{"fields": {"id,variants"}})
+	if _, err := sc.send(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to get Shopify inventory: %w", err)
+	}
+
+	inventory := &Inventory{ProductID: strconv.FormatInt(response.Product.ID, 10)}
+	for _, variant := range response.Product.Variants {
+		inventory.Quantity += variant.InventoryQuantity
+		inventory.Variants = append(inventory.Variants, VariantInventory{
+			VariantID: strconv.FormatInt(variant.ID, 10),
+			SKU:       variant.SKU,
+			Quantity:  variant.InventoryQuantity,
+		})
+	}
+	return inventory, nil
+}
+
+// CreatePurchase creates a draft order for the product's first variant, so
+// the attendee can complete it through Shopify checkout. A lower amount than
+// the variant's price is applied as a discount. The purchase ID is the draft
+// order's ID.
+func (sc *ShopifyConnector) CreatePurchase(userID, productID string, amount float64) (*Purchase, error) {
+	ctx := context.Background()
+
+	var productResponse struct {
+		Product shopifyProduct `json:"product"`
+	}
+	endpoint := sc.endpoint("/products/"+url.PathEscape(productID)+".json", url.Values{"fields": {"id,variants"}})
+	if _, err := sc.send(ctx, http.MethodGet, endpoint, nil, &productResponse); err != nil {
+		return nil, fmt.Errorf("failed to get Shopify product: %w", err)
+	}
+	if len(productResponse.Product.Variants) == 0 {
+		return nil, fmt.Errorf("Shopify product %s has no variants", productID)
+	}
+	variant := productResponse.Product.Variants[0]
+
+	lineItem := map[string]interface{}{"variant_id": variant.ID, "quantity": 1}
+	if discount := parsePrice(variant.Price) - amount; amount > 0 && discount > 0 {
+		lineItem["applied_discount"] = map[string]interface{}{
+			"title":      "Lynkr event price",
+			"value_type": "fixed_amount",
+			"value":      strconv.FormatFloat(discount, 'f', 2, 64),
+			"amount":     strconv.FormatFloat(discount, 'f', 2, 64),
+		}
+	}
+	draft := map[string]interface{}{
+		"line_items":      []interface{}{lineItem},
+		"tags":            "lynkr",
+		"note_attributes": []shopifyNoteAttribute{{Name: "lynkr_user_id", Value: userID}},
+	}
+
+	var response struct {
+		DraftOrder struct {
+			ID         int64  `json:"id"`
+			TotalPrice string `json:"total_price"`
+		} `json:"draft_order"`
+	}
+	if _, err := sc.send(ctx, http.MethodPost, sc.endpoint("/draft_orders.json", nil), map[string]interface{}{"draft_order": draft}, &response); err != nil {
+		return nil, fmt.Errorf("failed to create Shopify draft order: %w", err)
+	}
+
+	return &Purchase{
+		ID:        strconv.FormatInt(response.DraftOrder.ID, 10),
+		UserID:    userID,
+		ProductID: productID,
+		Amount:    parsePrice(response.DraftOrder.TotalPrice),
+		Timestamp: time.Now(),
+	}, nil
+}
+
+// TrackConversion tags a draft order created by CreatePurchase with the event
+// and attendee. Shopify copies the tags and note attributes to the order when
+// the draft is completed, so store orders can be attributed later.
+func (sc *ShopifyConnector) TrackConversion(eventID, userID string, purchase *Purchase) error {
+	id, err := strconv.ParseInt(purchase.ID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid Shopify draft order ID %q", purchase.ID)
+	}
+
+	draft := map[string]interface{}{
+		"id":   id,
+		"tags": "lynkr, lynkr-event-" + eventID,
+		"note_attributes": []shopifyNoteAttribute{
+			{Name: "lynkr_user_id", Value: userID},
+			{Name: "lynkr_event_id", Value: eventID},
+		},
+	}
+	endpoint := sc.endpoint("/draft_orders/"+purchase.ID+".json", nil)
+	if _, err := sc.send(context.Background(), http.MethodPut, endpoint, map[string]interface{}{"draft_order": draft}, nil); err != nil {
+		return fmt.Errorf("failed to tag Shopify draft order: %w", err)
+	}
+	return nil
+}
+
+// RegisterWebhooks subscribes address to the given topics, or to
+// ShopifyWebhookTopics when none are given. Topics the address is already
+// subscribed to are skipped.
+func (sc *ShopifyConnector) RegisterWebhooks(ctx context.Context, address string, topics ...string) error {
+	if len(topics) == 0 {
+		topics = ShopifyWebhookTopics
+	}
+
+	for _, topic := range topics {
+		webhook := map[string]interface{}{"topic": topic, "address": address, "format": "json"}
+		_, err := sc.send(ctx, http.MethodPost, sc.endpoint("/webhooks.json", nil), map[string]interface{}{"webhook": webhook}, nil)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusUnprocessableEntity && strings.Contains(httpErr.Body, "already been taken") {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to register Shopify %s webhook: %w", topic, err)
+		}
+	}
+	return nil
+}
+
+// VerifyWebhook checks the X-Shopify-Hmac-Sha256 header, the base64
+// HMAC-SHA256 of the raw body keyed with the app's client secret
+func (sc *ShopifyConnector) VerifyWebhook(body []byte, header http.Header) error {
+	if sc.apiSecret == "" {
+		return ErrWebhookNotConfigured
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(header.Get(ShopifyHMACHeader))
+	if err != nil || len(signature) == 0 {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(sc.apiSecret))
+	mac.Write(body)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// WebhookDelivery reads the X-Shopify-Webhook-Id and X-Shopify-Topic headers
+func (sc *ShopifyConnector) WebhookDelivery(body []byte, header http.Header) (WebhookDelivery, error) {
+	delivery := WebhookDelivery{ID: header.Get(ShopifyWebhookIDHeader), Topic: header.Get(ShopifyTopicHeader)}
+	if delivery.Topic == "" {
+		return delivery, fmt.Errorf("%w: missing %s header", ErrInvalidWebhook, ShopifyTopicHeader)
+	}
+	if delivery.ID == "" {
+		delivery.ID = bodyDeliveryID(body)
+	}
+	return delivery, nil
+}
+
+// ParseOrderWebhook decodes the order of an orders/* webhook, whose body is
+// the order as the Admin API returns it
+func (sc *ShopifyConnector) ParseOrderWebhook(topic string, body []byte) (*Order, error) {
+	if !strings.HasPrefix(topic, "orders/") {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedWebhook, topic)
+	}
+
+	var order shopifyOrder
+	if err := json.Unmarshal(body, &order); err != nil || order.ID == 0 {
+		return nil, fmt.Errorf("%w: not a Shopify order", ErrInvalidWebhook)
+	}
+	return order.toOrder(), nil
+}
+
+// ParseRefundWebhook decodes the refund of a refunds/create webhook
+func (sc *ShopifyConnector) ParseRefundWebhook(topic string, body []byte) (*Refund, error) {
+	if topic != "refunds/create" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedWebhook, topic)
+	}
+
+	var refund shopifyRefund
+	if err := json.Unmarshal(body, &refund); err != nil || refund.ID == 0 || refund.OrderID == 0 {
+		return nil, fmt.Errorf("%w: not a Shopify refund", ErrInvalidWebhook)
+	}
+	converted := refund.toRefund()
+	return &converted, nil
+}
+
+// endpoint builds an Admin API URL for a path such as "/products.json"
+func (sc *ShopifyConnector) endpoint(path string, query url.Values) string {
+	endpoint := sc.shopURL + "/admin/api/" + shopifyAPIVersion + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	return endpoint
+}
+
+func (sc *ShopifyConnector) send(ctx context.Context, method, endpoint string, body, out interface{}) (http.Header, error) {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Shopify-Access-Token", sc.apiKey)
+
+	return doJSON(ctx, sc.client, req, out)
+}
+
+func (so shopifyOrder) toOrder() *Order {
+	order := &Order{
+		ID:              strconv.FormatInt(so.ID, 10),
+		Number:          so.Name,
+		Email:           so.Email,
+		Currency:        so.Currency,
+		TotalPrice:      parsePrice(so.TotalPrice),
+		FinancialStatus: so.FinancialStatus,
+		CreatedAt:       so.CreatedAt,
+		UpdatedAt:       so.UpdatedAt,
+		CancelledAt:     so.CancelledAt,
+	}
+	if so.Customer != nil {
+		order.CustomerID = strconv.FormatInt(so.Customer.ID, 10)
+	}
+	for _, tag := range strings.Split(so.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			order.Tags = append(order.Tags, tag)
+		}
+	}
+	if len(so.NoteAttributes) > 0 {
+		order.Attributes = make(map[string]string, len(so.NoteAttributes))
+		for _, attribute := range so.NoteAttributes {
+			order.Attributes[attribute.Name] = attribute.Value
+		}
+	}
+	for _, discount := range so.DiscountCodes {
+		order.DiscountCodes = append(order.DiscountCodes, discount.Code)
+	}
+	for _, item := range so.LineItems {
+		lineItem := OrderLineItem{
+			SKU:      item.SKU,
+			Name:     item.Name,
+			Quantity: item.Quantity,
+			Price:    parsePrice(item.Price),
+		}
+		if item.ProductID != nil {
+			lineItem.ProductID = strconv.FormatInt(*item.ProductID, 10)
+		}
+		if item.VariantID != nil {
+			lineItem.VariantID = strconv.FormatInt(*item.VariantID, 10)
+		}
+		order.LineItems = append(order.LineItems, lineItem)
+	}
+	for _, refund := range so.Refunds {
+		order.Refunds = append(order.Refunds, refund.toRefund())
+	}
+	return order
+}
+
+// toRefund converts a refund. The refunded amount is the sum of its
+// successful refund transactions.
+func (sr shopifyRefund) toRefund() Refund {
+	refund := Refund{
+		ID:        strconv.FormatInt(sr.ID, 10),
+		OrderID:   strconv.FormatInt(sr.OrderID, 10),
+		Reason:    sr.Note,
+		CreatedAt: sr.CreatedAt,
+	}
+	for _, transaction := range sr.Transactions {
+		if transaction.Kind == "refund" && transaction.Status == "success" {
+			refund.Amount += parsePrice(transaction.Amount)
+		}
+	}
+	for _, item := range sr.RefundLineItems {
+		lineItem := RefundLineItem{Quantity: item.Quantity, Amount: parsePrice(item.Subtotal)}
+		if item.LineItem.ProductID != nil {
+			lineItem.ProductID = strconv.FormatInt(*item.LineItem.ProductID, 10)
+		}
+		refund.LineItems = append(refund.LineItems, lineItem)
+	}
+	return refund
+}
+
+// pageQuery builds the query of a listing request. Requests for later pages
+// may only carry the page_info cursor and the page size; the filter is part
+// of the cursor.
+func pageQuery(filter url.Values, cursor string) url.Values {
+	query := url.Values{"limit": {strconv.Itoa(shopifyPageSize)}}
+	if cursor != "" {
+		query.Set("page_info", cursor)
+		return query
+	}
+	for name, values := range filter {
+		query[name] = values
+	}
+	return query
+}
+
+// nextPageInfo returns the page_info cursor of the rel="next" target of a
+// Link header, or "" on the last page
+func nextPageInfo(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		target, params, ok := strings.Cut(strings.TrimSpace(part), ";")
+		if !ok || !strings.Contains(params, `rel="next"`) {
+			continue
+		}
+		next, err := url.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+		if err != nil {
+			return ""
+		}
+		return next.Query().Get("page_info")
+	}
+	return ""
+}
@@ -0,0 +1,239 @@
+package ecommerce
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signWebhook returns the base64 HMAC-SHA256 signature both platforms send
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestShopifyGetProductsFollowsPages(t *testing.T) {
+	var requests []string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/admin/api/"+shopifyAPIVersion+"/products.json" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("X-Shopify-Access-Token"); got != "token" {
+			t.Errorf("access token = %q, want %q", got, "token")
+		}
+		requests = append(requests, r.URL.RawQuery)
+
+		switch r.URL.Query().Get("page_info") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/admin/api/%s/products.json?limit=250&page_info=page2>; rel="next"`, server.URL, shopifyAPIVersion))
+			fmt.Fprint(w, `{"products": [
+				{"id": 1, "title": "Cap", "variants": [{"id": 11, "price": "19.90"}, {"id": 12, "price": "24.90"}], "image": {"src": "https://cdn.test/cap.png"}},
+				{"id": 2, "title": "Shirt", "variants": []}
+			]}`)
+		case "page2":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/admin/api/%s/products.json?limit=250&page_info=page1>; rel="previous"`, server.URL, shopifyAPIVersion))
+			fmt.Fprint(w, `{"products": [{"id": 3, "title": "Mug", "variants": [{"id": 31, "price": "9.50"}]}]}`)
+		default:
+			t.Errorf("unexpected page_info %q", r.URL.Query().Get("page_info"))
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	connector := NewShopifyConnector("token", "secret", server.URL, server.Client())
+	products, err := connector.GetProducts("brand-1")
+	if err != nil {
+		t.Fatalf("GetProducts: %v", err)
+	}
+
+	want := []Product{
+		{ID: "1", Name: "Cap", Price: 19.90, ImageURL: "https://cdn.test/cap.png", BrandID: "brand-1"},
+		{ID: "2", Name: "Shirt", BrandID: "brand-1"},
+		{ID: "3", Name: "Mug", Price: 9.50, BrandID: "brand-1"},
+	}
+	if len(products) != len(want) {
+		t.Fatalf("got %d products, want %d", len(products), len(want))
+	}
+	for i := range want {
+		if products[i] != want[i] {
+			t.Errorf("product %d = %+v, want %+v", i, products[i], want[i])
+		}
+	}
+	if len(requests) != 2 || requests[1] != "limit=250&page_info=page2" {
+		t.Errorf("requests = %q, want a second request with only the cursor and the page size", requests)
+	}
+}
+
+func TestShopifyListOrdersSendsFilterOnFirstPageOnly(t *testing.T) {
+	since := time.Date(2026, 10, 1, 12, 0, 0, 0, time.FixedZone("EST", -5*3600))
+
+	tests := []struct {
+		name      string
+		cursor    string
+		wantQuery map[string]string
+	}{
+		{
+			name:   "first page",
+			cursor: "",
+			wantQuery: map[string]string{
+				"limit":          "250",
+				"status":         "any",
+				"updated_at_min": "2026-10-01T17:00:00Z",
+				"order":          "updated_at asc",
+				"page_info":      "",
+			},
+		},
+		{
+			name:   "later page",
+			cursor: "next",
+			wantQuery: map[string]string{
+				"limit":          "250",
+				"status":         "",
+				"updated_at_min": "",
+				"page_info":      "next",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for name, want := range tt.wantQuery {
+					if got := r.URL.Query().Get(name); got != want {
+						t.Errorf("query %s = %q, want %q", name, got, want)
+					}
+				}
+				fmt.Fprint(w, `{"orders": [{"id": 1001, "name": "#1001", "total_price": "42.00", "tags": "vip, event", "discount_codes": [{"code": "LYNKR10"}]}]}`)
+			}))
+			defer server.Close()
+
+			connector := NewShopifyConnector("token", "secret", server.URL, server.Client())
+			page, err := connector.ListOrders(context.Background(), since, tt.cursor)
+			if err != nil {
+				t.Fatalf("ListOrders: %v", err)
+			}
+			if page.NextCursor != "" {
+				t.Errorf("NextCursor = %q on the last page", page.NextCursor)
+			}
+			if len(page.Orders) != 1 {
+				t.Fatalf("got %d orders, want 1", len(page.Orders))
+			}
+			order := page.Orders[0]
+			if order.ID != "1001" || order.TotalPrice != 42 || len(order.Tags) != 2 || order.DiscountCodes[0] != "LYNKR10" {
+				t.Errorf("order = %+v", order)
+			}
+		})
+	}
+}
+
+func TestShopifyErrorStatuses(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		retryAfter     string
+		wantErr        error
+		wantLimited    bool
+		wantRetryAfter time.Duration
+	}{
+		{name: "rate limited with Retry-After", status: http.StatusTooManyRequests, retryAfter: "2.0", wantErr: ErrRateLimited, wantLimited: true, wantRetryAfter: 2 * time.Second},
+		{name: "rate limited without Retry-After", status: http.StatusTooManyRequests, wantErr: ErrRateLimited, wantLimited: true},
+		{name: "bad credentials", status: http.StatusUnauthorized, wantErr: ErrUnauthorized},
+		{name: "missing order", status: http.StatusNotFound, wantErr: ErrNotFound},
+		{name: "store down", status: http.StatusServiceUnavailable, retryAfter: "5", wantErr: ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, `{"errors": "nope"}`)
+			}))
+			defer server.Close()
+
+			connector := NewShopifyConnector("token", "secret", server.URL, server.Client())
+			_, err := connector.GetOrder(context.Background(), "1001")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			wait, limited := RateLimited(err)
+			if limited != tt.wantLimited || wait != tt.wantRetryAfter {
+				t.Errorf("RateLimited = (%v, %v), want (%v, %v)", wait, limited, tt.wantRetryAfter, tt.wantLimited)
+			}
+		})
+	}
+}
+
+func TestShopifyRetryAfterRateLimit(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0.01")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"order": {"id": 1001, "name": "#1001"}}`)
+	}))
+	defer server.Close()
+
+	connector := NewShopifyConnector("token", "secret", server.URL, server.Client())
+	_, err := connector.GetOrder(context.Background(), "1001")
+	wait, limited := RateLimited(err)
+	if !limited {
+		t.Fatalf("first call: err = %v, want a rate limit", err)
+	}
+
+	time.Sleep(wait)
+	order, err := connector.GetOrder(context.Background(), "1001")
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if order.ID != "1001" || calls != 2 {
+		t.Errorf("order = %+v after %d calls", order, calls)
+	}
+}
+
+func TestShopifyVerifyWebhook(t *testing.T) {
+	body := []byte(`{"id": 1001, "name": "#1001"}`)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		wantErr   error
+	}{
+		{name: "valid", secret: "secret", body: body, signature: signWebhook("secret", body)},
+		{name: "tampered body", secret: "secret", body: []byte(`{"id": 1002, "name": "#1001"}`), signature: signWebhook("secret", body), wantErr: ErrInvalidSignature},
+		{name: "other secret", secret: "secret", body: body, signature: signWebhook("other", body), wantErr: ErrInvalidSignature},
+		{name: "missing signature", secret: "secret", body: body, wantErr: ErrInvalidSignature},
+		{name: "signature not base64", secret: "secret", body: body, signature: "not base64!", wantErr: ErrInvalidSignature},
+		{name: "no secret configured", body: body, signature: signWebhook("", body), wantErr: ErrWebhookNotConfigured},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector := NewShopifyConnector("token", tt.secret, "brand.myshopify.com", nil)
+			header := http.Header{}
+			if tt.signature != "" {
+				header.Set(ShopifyHMACHeader, tt.signature)
+			}
+			if err := connector.VerifyWebhook(tt.body, header); !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyWebhook = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+/**
+ * E-commerce Webhooks
+ * Inbound order webhook types for connectors that receive store notifications
+ */
+
+package ecommerce
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrInvalidWebhook     = errors.New("invalid webhook payload")
+	ErrUnsupportedWebhook = errors.New("webhook topic is not handled")
+)
+
+// WebhookDelivery identifies one webhook sent by a store
+type WebhookDelivery struct {
+	// ID is the store's delivery ID, which stays the same when the store
+	// redelivers the webhook
+	ID    string
+	Topic string
+}
+
+// WebhookReceiver is implemented by connectors that accept order webhooks
+type WebhookReceiver interface {
+	// VerifyWebhook checks the signature of a raw webhook body against the
+	// integration's API secret
+	VerifyWebhook(body []byte, header http.Header) error
+	// WebhookDelivery reads the delivery ID and topic of a verified webhook
+	WebhookDelivery(body []byte, header http.Header) (WebhookDelivery, error)
+	// ParseOrderWebhook decodes the order carried by a webhook. Topics that
+	// carry no order return ErrUnsupportedWebhook.
+	ParseOrderWebhook(topic string, body []byte) (*Order, error)
+	// ParseRefundWebhook decodes the refund carried by a webhook. Topics that
+	// carry no refund return ErrUnsupportedWebhook.
+	ParseRefundWebhook(topic string, body []byte) (*Refund, error)
+}
+
+// WebhookRegistrar is implemented by connectors that can subscribe a URL to
+// the store's order webhooks
+type WebhookRegistrar interface {
+	RegisterWebhooks(ctx context.Context, address string, topics ...string) error
+}
+
+// bodyDeliveryID identifies a delivery by its body, for stores that do not
+// send a delivery ID
+func bodyDeliveryID(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,553 @@
+/**
+ * WooCommerce Connector
+ * Reads products and orders through the WooCommerce REST API v3 and receives order webhooks
+ */
+
+package ecommerce
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// wooPageSize is the largest page the REST API returns
+	wooPageSize = 100
+	// WooCommerce webhook headers: the signature, topic and delivery ID
+	WooSignatureHeader  = "X-WC-Webhook-Signature"
+	WooTopicHeader      = "X-WC-Webhook-Topic"
+	WooDeliveryIDHeader = "X-WC-Webhook-Delivery-ID"
+)
+
+// WooWebhookTopics are the webhooks RegisterWebhooks subscribes to
+var WooWebhookTopics = []string{"order.created", "order.updated"}
+
+type WooCommerceConnector struct {
+	apiKey    string // consumer key
+	apiSecret string // consumer secret
+	storeURL  string
+	client    *http.Client
+}
+
+type wooProduct struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Price       string `json:"price"`
+	Description string `json:"description"`
+	Images      []struct {
+		Src string `json:"src"`
+	} `json:"images"`
+}
+
+type wooOrder struct {
+	ID           int64   `json:"id"`
+	Number       string  `json:"number"`
+	Status       string  `json:"status"`
+	Currency     string  `json:"currency"`
+	Total        string  `json:"total"`
+	CustomerID   int64   `json:"customer_id"`
+	DateCreated  wooTime `json:"date_created_gmt"`
+	DateModified wooTime `json:"date_modified_gmt"`
+	Billing      struct {
+		Email string `json:"email"`
+	} `json:"billing"`
+	MetaData []struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	} `json:"meta_data"`
+	CouponLines []struct {
+		Code string `json:"code"`
+	} `json:"coupon_lines"`
+	Refunds []struct {
+		ID     int64  `json:"id"`
+		Reason string `json:"reason"`
+		Total  string `json:"total"` // negative
+	} `json:"refunds"`
+	LineItems []struct {
+		ProductID   int64   `json:"product_id"`
+		VariationID int64   `json:"variation_id"`
+		SKU         string  `json:"sku"`
+		Name        string  `json:"name"`
+		Quantity    int     `json:"quantity"`
+		Price       float64 `json:"price"`
+	} `json:"line_items"`
+}
+
+type wooMetaData struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// wooTime reads the API's GMT timestamps, which carry no zone offset
+type wooTime struct {
+	time.Time
+}
+
+func (t *wooTime) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil || value == "" {
+		return nil
+	}
+	parsed, err := time.Parse("2006-01-02T15:04:05", value)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed.UTC()
+	return nil
+}
+
+// NewWooCommerceConnector connects to a store with REST API consumer
+// credentials. A nil client uses a default one.
+func NewWooCommerceConnector(apiKey, apiSecret, storeURL string, client *http.Client) *WooCommerceConnector {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &WooCommerceConnector{
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		storeURL:  strings.TrimRight(storeURL, "/"),
+		client:    client,
+	}
+}
+
+// GetProducts lists every product of the store
+func (wc *WooCommerceConnector) GetProducts(brandID string) ([]Product, error) {
+	return listAll(context.Background(), wc, brandID)
+}
+
+// ListProducts returns one page of products. Cursors are page numbers.
+func (wc *WooCommerceConnector) ListProducts(ctx context.Context, cursor string) (*ProductPage, error) {
+	query, page, err := wooPageQuery(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var wcProducts []wooProduct
+	header, err := wc.send(ctx, http.MethodGet, "/products", query, nil, &wcProducts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list WooCommerce products: %w", err)
+	}
+
+	result := &ProductPage{NextCursor: wooNextCursor(header, page)}
+	for _, wp := range wcProducts {
+		imageURL := ""
+		if len(wp.Images) > 0 {
+			imageURL = wp.Images[0].Src
+		}
+		result.Products = append(result.Products, Product{
+			ID:          strconv.FormatInt(wp.ID, 10),
+			Name:        wp.Name,
+			Price:       parsePrice(wp.Price),
+			Description: wp.Description,
+			ImageURL:    imageURL,
+		})
+	}
+	return result, nil
+}
+
+// ListOrders lists orders of any status modified since the given time,
+// oldest first. Callers pass the same since with every page.
+func (wc *WooCommerceConnector) ListOrders(ctx context.Context, since time.Time, cursor string) (*OrderPage, error) {
+	query, page, err := wooPageQuery(cursor)
+	if err != nil {
+		return nil, err
+	}
+	query.Set("modified_after", since.UTC().Format("2006-01-02T15:04:05"))
+	query.Set("dates_are_gmt", "true")
+	query.Set("orderby", "date")
+	query.Set("order", "asc")
+
+	var wcOrders []wooOrder
+	header, err := wc.send(ctx, http.MethodGet, "/orders", query, nil, &wcOrders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list WooCommerce orders: %w", err)
+	}
+
+	result := &OrderPage{NextCursor: wooNextCursor(header, page)}
+	for _, wo := range wcOrders {
+		result.Orders = append(result.Orders, *wo.toOrder())
+	}
+	return result, nil
+}
+
+// GetOrder looks up one order
+func (wc *WooCommerceConnector) GetOrder(ctx context.Context, orderID string) (*Order, error) {
+	var wo wooOrder
+	if _, err := wc.send(ctx, http.MethodGet, "/orders/"+url.PathEscape(orderID), nil, nil, &wo); err != nil {
+		return nil, fmt.Errorf("failed to get WooCommerce order: %w", err)
+	}
+	return wo.toOrder(), nil
+}
+
+// ListRefunds returns the refunds of an order. WooCommerce reports refunded
+// quantities and totals as negative numbers; they are returned as positive.
+func (wc *WooCommerceConnector) ListRefunds(ctx context.Context, orderID string) ([]Refund, error) {
+	var wcRefunds []struct {
+		ID          int64   `json:"id"`
+		Reason      string  `json:"reason"`
+		Amount      string  `json:"amount"`
+		DateCreated wooTime `json:"date_created_gmt"`
+		LineItems   []struct {
+			ProductID int64  `json:"product_id"`
+			Quantity  int    `json:"quantity"`
+			Total     string `json:"total"`
+		} `json:"line_items"`
+	}
+	if _, err := wc.send(ctx, http.MethodGet, "/orders/"+url.PathEscape(orderID)+"/refunds", nil, nil, &wcRefunds); err != nil {
+		return nil, fmt.Errorf("failed to list WooCommerce refunds: %w", err)
+	}
+
+	refunds := make([]Refund, 0, len(wcRefunds))
+	for _, wr := range wcRefunds {
+		refund := Refund{
+			ID:        strconv.FormatInt(wr.ID, 10),
+			OrderID:   orderID,
+			Amount:    abs(parsePrice(wr.Amount)),
+			Reason:    wr.Reason,
+			CreatedAt: wr.DateCreated.Time,
+		}
+		for _, item := range wr.LineItems {
+			quantity := item.Quantity
+			if quantity < 0 {
+				quantity = -quantity
+			}
+			refund.LineItems = append(refund.LineItems, RefundLineItem{
+				ProductID: strconv.FormatInt(item.ProductID, 10),
+				Quantity:  quantity,
+				Amount:    abs(parsePrice(item.Total)),
+			})
+		}
+		refunds = append(refunds, refund)
+	}
+	return refunds, nil
+}
+
+// GetInventory returns the stock of a product and, for variable products, of
+// each variation. Products that don't manage stock report zero.
+func (wc *WooCommerceConnector) GetInventory(ctx context.Context, productID string) (*Inventory, error) {
+	var product struct {
+		ID            int64   `json:"id"`
+		SKU           string  `json:"sku"`
+		StockQuantity *int    `json:"stock_quantity"`
+		Variations    []int64 `json:"variations"`
+	}
+	if _, err := wc.send(ctx, http.MethodGet, "/products/"+url.PathEscape(productID), nil, nil, &product); err != nil {
+		return nil, fmt.Errorf("failed to get WooCommerce inventory: %w", err)
+	}
+
+	inventory := &Inventory{ProductID: strconv.FormatInt(product.ID, 10)}
+	if len(product.Variations) == 0 {
+		if product.StockQuantity != nil {
+			inventory.Quantity = *product.StockQuantity
+		}
+		return inventory, nil
+	}
+
+	cursor := ""
+	for {
+		query, page, err := wooPageQuery(cursor)
+		if err != nil {
+			return nil, err
+		}
+		var variations []struct {
+			ID            int64  `json:"id"`
+			SKU           string `json:"sku"`
+			StockQuantity *int   `json:"stock_quantity"`
+		}
+		header, err := wc.send(ctx, http.MethodGet, "/products/"+url.PathEscape(productID)+"/variations", query, nil, &variations)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get WooCommerce variations: %w", err)
+		}
+
+		for _, variation := range variations {
+			quantity := 0
+			if variation.StockQuantity != nil {
+				quantity = *variation.StockQuantity
+			}
+			inventory.Quantity += quantity
+			inventory.Variants = append(inventory.Variants, VariantInventory{
+				VariantID: strconv.FormatInt(variation.ID, 10),
+				SKU:       variation.SKU,
+				Quantity:  quantity,
+			})
+		}
+
+		if cursor = wooNextCursor(header, page); cursor == "" {
+			return inventory, nil
+		}
+	}
+}
+
+// CreatePurchase creates a pending order for one unit of the product at the
+// given amount, or at the product's price when amount is zero. The purchase
+// ID is the order's ID.
+func (wc *WooCommerceConnector) CreatePurchase(userID, productID string, amount float64) (*Purchase, error) {
+	id, err := strconv.ParseInt(productID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WooCommerce product ID %q", productID)
+	}
+
+	lineItem := map[string]interface{}{"product_id": id, "quantity": 1}
+	if amount > 0 {
+		total := strconv.FormatFloat(amount, 'f', 2, 64)
+		lineItem["subtotal"] = total
+		lineItem["total"] = total
+	}
+	order := map[string]interface{}{
+		"status":     "pending",
+		"set_paid":   false,
+		"line_items": []interface{}{lineItem},
+		"meta_data":  []wooMetaData{{Key: "lynkr_user_id", Value: userID}},
+	}
+
+	var created wooOrder
+	if _, err := wc.send(context.Background(), http.MethodPost, "/orders", nil, order, &created); err != nil {
+		return nil, fmt.Errorf("failed to create WooCommerce order: %w", err)
+	}
+
+	return &Purchase{
+		ID:        strconv.FormatInt(created.ID, 10),
+		UserID:    userID,
+		ProductID: productID,
+		Amount:    parsePrice(created.Total),
+		Timestamp: time.Now(),
+	}, nil
+}
+
+// TrackConversion records the event and attendee in the order's meta data
+func (wc *WooCommerceConnector) TrackConversion(eventID, userID string, purchase *Purchase) error {
+	update := map[string]interface{}{
+		"meta_data": []wooMetaData{
+			{Key: "lynkr_user_id", Value: userID},
+			{Key: "lynkr_event_id", Value: eventID},
+		},
+	}
+	if _, err := wc.send(context.Background(), http.MethodPut, "/orders/"+url.PathEscape(purchase.ID), nil, update, nil); err != nil {
+		return fmt.Errorf("failed to tag WooCommerce order: %w", err)
+	}
+	return nil
+}
+
+// RegisterWebhooks subscribes address to the given topics, or to
+// WooWebhookTopics when none are given, signed with the consumer secret.
+// Topics the address is already subscribed to are skipped.
+func (wc *WooCommerceConnector) RegisterWebhooks(ctx context.Context, address string, topics ...string) error {
+	if len(topics) == 0 {
+		topics = WooWebhookTopics
+	}
+
+	var existing []struct {
+		Topic       string `json:"topic"`
+		DeliveryURL string `json:"delivery_url"`
+	}
+	query := url.Values{"per_page": {strconv.Itoa(wooPageSize)}}
+	if _, err := wc.send(ctx, http.MethodGet, "/webhooks", query, nil, &existing); err != nil {
+		return fmt.Errorf("failed to list WooCommerce webhooks: %w", err)
+	}
+	subscribed := make(map[string]bool, len(existing))
+	for _, webhook := range existing {
+		if webhook.DeliveryURL == address {
+			subscribed[webhook.Topic] = true
+		}
+	}
+
+	for _, topic := range topics {
+		if subscribed[topic] {
+			continue
+		}
+		webhook := map[string]interface{}{
+			"name":         "Lynkr " + topic,
+			"topic":        topic,
+			"delivery_url": address,
+			"secret":       wc.apiSecret,
+			"status":       "active",
+		}
+		if _, err := wc.send(ctx, http.MethodPost, "/webhooks", nil, webhook, nil); err != nil {
+			return fmt.Errorf("failed to register WooCommerce %s webhook: %w", topic, err)
+		}
+	}
+	return nil
+}
+
+// VerifyWebhook checks the X-WC-Webhook-Signature header, the base64
+// HMAC-SHA256 of the raw body keyed with the webhook secret, which
+// RegisterWebhooks sets to the consumer secret
+func (wc *WooCommerceConnector) VerifyWebhook(body []byte, header http.Header) error {
+	if wc.apiSecret == "" {
+		return ErrWebhookNotConfigured
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(header.Get(WooSignatureHeader))
+	if err != nil || len(signature) == 0 {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(wc.apiSecret))
+	mac.Write(body)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// WebhookDelivery reads the X-WC-Webhook-Delivery-ID and X-WC-Webhook-Topic headers
+func (wc *WooCommerceConnector) WebhookDelivery(body []byte, header http.Header) (WebhookDelivery, error) {
+	delivery := WebhookDelivery{ID: header.Get(WooDeliveryIDHeader), Topic: header.Get(WooTopicHeader)}
+	if delivery.Topic == "" {
+		return delivery, fmt.Errorf("%w: missing %s header", ErrInvalidWebhook, WooTopicHeader)
+	}
+	if delivery.ID == "" {
+		delivery.ID = bodyDeliveryID(body)
+	}
+	return delivery, nil
+}
+
+// ParseOrderWebhook decodes the order of an order.* webhook, whose body is
+// the order as the REST API returns it
+func (wc *WooCommerceConnector) ParseOrderWebhook(topic string, body []byte) (*Order, error) {
+	if !strings.HasPrefix(topic, "order.") {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedWebhook, topic)
+	}
+
+	var order wooOrder
+	if err := json.Unmarshal(body, &order); err != nil || order.ID == 0 {
+		return nil, fmt.Errorf("%w: not a WooCommerce order", ErrInvalidWebhook)
+	}
+	return order.toOrder(), nil
+}
+
+// ParseRefundWebhook returns ErrUnsupportedWebhook: WooCommerce sends no refund
+// webhooks, refunds arrive with the order.updated webhook of their order
+func (wc *WooCommerceConnector) ParseRefundWebhook(topic string, body []byte) (*Refund, error) {
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedWebhook, topic)
+}
+
+// send calls the REST API at a path such as "/products"
+func (wc *WooCommerceConnector) send(ctx context.Context, method, path string, query url.Values, body, out interface{}) (http.Header, error) {
+	endpoint := wc.storeURL + "/wp-json/wc/v3" + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.SetBasicAuth(wc.apiKey, wc.apiSecret)
+
+	return doJSON(ctx, wc.client, req, out)
+}
+
+func (wo wooOrder) toOrder() *Order {
+	order := &Order{
+		ID:              strconv.FormatInt(wo.ID, 10),
+		Number:          wo.Number,
+		Email:           wo.Billing.Email,
+		Currency:        wo.Currency,
+		TotalPrice:      parsePrice(wo.Total),
+		FinancialStatus: wo.Status,
+		CreatedAt:       wo.DateCreated.Time,
+		UpdatedAt:       wo.DateModified.Time,
+	}
+	if wo.CustomerID != 0 {
+		order.CustomerID = strconv.FormatInt(wo.CustomerID, 10)
+	}
+	if wo.Status == "cancelled" {
+		cancelledAt := wo.DateModified.Time
+		order.CancelledAt = &cancelledAt
+	}
+	for _, meta := range wo.MetaData {
+		// Plugins store structured meta data too; only strings are kept
+		var value string
+		if json.Unmarshal(meta.Value, &value) != nil {
+			continue
+		}
+		if order.Attributes == nil {
+			order.Attributes = make(map[string]string)
+		}
+		order.Attributes[meta.Key] = value
+	}
+	for _, coupon := range wo.CouponLines {
+		order.DiscountCodes = append(order.DiscountCodes, coupon.Code)
+	}
+	for _, refund := range wo.Refunds {
+		// Orders only list refund totals; ListRefunds has the line items
+		order.Refunds = append(order.Refunds, Refund{
+			ID:        strconv.FormatInt(refund.ID, 10),
+			OrderID:   order.ID,
+			Amount:    abs(parsePrice(refund.Total)),
+			Reason:    refund.Reason,
+			CreatedAt: order.UpdatedAt,
+		})
+	}
+	for _, item := range wo.LineItems {
+		lineItem := OrderLineItem{
+			ProductID: strconv.FormatInt(item.ProductID, 10),
+			SKU:       item.SKU,
+			Name:      item.Name,
+			Quantity:  item.Quantity,
+			Price:     item.Price,
+		}
+		if item.VariationID != 0 {
+			lineItem.VariantID = strconv.FormatInt(item.VariationID, 10)
+		}
+		order.LineItems = append(order.LineItems, lineItem)
+	}
+	return order
+}
+
+// wooPageQuery builds the paging query for a page number cursor
+func wooPageQuery(cursor string) (url.Values, int, error) {
+	page := 1
+	if cursor != "" {
+		var err error
+		if page, err = strconv.Atoi(cursor); err != nil || page < 1 {
+			return nil, 0, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+		}
+	}
+	query := url.Values{
+		"page":     {strconv.Itoa(page)},
+		"per_page": {strconv.Itoa(wooPageSize)},
+	}
+	return query, page, nil
+}
+
+// wooNextCursor returns the next page number while X-WP-TotalPages reports
+// more pages
+func wooNextCursor(header http.Header, page int) string {
+	totalPages, err := strconv.Atoi(header.Get("X-WP-TotalPages"))
+	if err != nil || page >= totalPages {
+		return ""
+	}
+	return strconv.Itoa(page + 1)
+}
+
+func abs(value float64) float64 {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,200 @@
+package ecommerce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWooCommerceGetProductsFollowsPages(t *testing.T) {
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wp-json/wc/v3/products" {
+			http.NotFound(w, r)
+			return
+		}
+		if key, secret, ok := r.BasicAuth(); !ok || key != "ck_key" || secret != "cs_secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if got := r.URL.Query().Get("per_page"); got != "100" {
+			t.Errorf("per_page = %q, want 100", got)
+		}
+		pages = append(pages, r.URL.Query().Get("page"))
+
+		w.Header().Set("X-WP-TotalPages", "2")
+		switch r.URL.Query().Get("page") {
+		case "1":
+			fmt.Fprint(w, `[{"id": 1, "name": "Cap", "price": "19.90", "images": [{"src": "https://cdn.test/cap.png"}]}, {"id": 2, "name": "Shirt", "price": ""}]`)
+		case "2":
+			fmt.Fprint(w, `[{"id": 3, "name": "Mug", "price": "9.50"}]`)
+		default:
+			fmt.Fprint(w, `[]`)
+		}
+	}))
+	defer server.Close()
+
+	connector := NewWooCommerceConnector("ck_key", "cs_secret", server.URL+"/", server.Client())
+	products, err := connector.GetProducts("brand-1")
+	if err != nil {
+		t.Fatalf("GetProducts: %v", err)
+	}
+
+	want := []Product{
+		{ID: "1", Name: "Cap", Price: 19.90, ImageURL: "https://cdn.test/cap.png", BrandID: "brand-1"},
+		{ID: "2", Name: "Shirt", BrandID: "brand-1"},
+		{ID: "3", Name: "Mug", Price: 9.50, BrandID: "brand-1"},
+	}
+	if len(products) != len(want) {
+		t.Fatalf("got %d products, want %d", len(products), len(want))
+	}
+	for i := range want {
+		if products[i] != want[i] {
+			t.Errorf("product %d = %+v, want %+v", i, products[i], want[i])
+		}
+	}
+	if len(pages) != 2 || pages[0] != "1" || pages[1] != "2" {
+		t.Errorf("requested pages %q, want [1 2]", pages)
+	}
+}
+
+func TestWooCommerceListOrdersPaging(t *testing.T) {
+	since := time.Date(2026, 10, 1, 12, 0, 0, 0, time.FixedZone("EST", -5*3600))
+
+	tests := []struct {
+		name       string
+		cursor     string
+		totalPages string
+		wantPage   string
+		wantNext   string
+		wantErr    error
+	}{
+		{name: "first of two pages", cursor: "", totalPages: "2", wantPage: "1", wantNext: "2"},
+		{name: "last page", cursor: "2", totalPages: "2", wantPage: "2", wantNext: ""},
+		{name: "no total pages header", cursor: "", totalPages: "", wantPage: "1", wantNext: ""},
+		{name: "invalid cursor", cursor: "abc", wantErr: ErrInvalidCursor},
+		{name: "page zero", cursor: "0", wantErr: ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query := r.URL.Query()
+				if got := query.Get("page"); got != tt.wantPage {
+					t.Errorf("page = %q, want %q", got, tt.wantPage)
+				}
+				if got := query.Get("modified_after"); got != "2026-10-01T17:00:00" {
+					t.Errorf("modified_after = %q, want the GMT time", got)
+				}
+				if query.Get("dates_are_gmt") != "true" {
+					t.Error("dates_are_gmt is not set")
+				}
+				if tt.totalPages != "" {
+					w.Header().Set("X-WP-TotalPages", tt.totalPages)
+				}
+				fmt.Fprint(w, `[{"id": 55, "number": "55", "status": "cancelled", "total": "30.00",
+					"date_created_gmt": "2026-10-02T08:00:00", "date_modified_gmt": "2026-10-03T09:30:00",
+					"meta_data": [{"key": "lynkr_event_id", "value": "7"}, {"key": "_structured", "value": {"a": 1}}],
+					"refunds": [{"id": 9, "reason": "damaged", "total": "-5.00"}]}]`)
+			}))
+			defer server.Close()
+
+			connector := NewWooCommerceConnector("ck_key", "cs_secret", server.URL, server.Client())
+			page, err := connector.ListOrders(context.Background(), since, tt.cursor)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListOrders: %v", err)
+			}
+			if page.NextCursor != tt.wantNext {
+				t.Errorf("NextCursor = %q, want %q", page.NextCursor, tt.wantNext)
+			}
+			if len(page.Orders) != 1 {
+				t.Fatalf("got %d orders, want 1", len(page.Orders))
+			}
+			order := page.Orders[0]
+			if order.CancelledAt == nil || !order.CancelledAt.Equal(time.Date(2026, 10, 3, 9, 30, 0, 0, time.UTC)) {
+				t.Errorf("CancelledAt = %v, want the modification time", order.CancelledAt)
+			}
+			if len(order.Attributes) != 1 || order.Attributes["lynkr_event_id"] != "7" {
+				t.Errorf("Attributes = %v, want only the string meta data", order.Attributes)
+			}
+			if len(order.Refunds) != 1 || order.Refunds[0].Amount != 5 {
+				t.Errorf("Refunds = %+v, want one positive refund", order.Refunds)
+			}
+		})
+	}
+}
+
+func TestWooCommerceRetryAfterRateLimit(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0.01")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"code": "too_many_requests"}`)
+			return
+		}
+		fmt.Fprint(w, `{"id": 55, "number": "55", "status": "processing"}`)
+	}))
+	defer server.Close()
+
+	connector := NewWooCommerceConnector("ck_key", "cs_secret", server.URL, server.Client())
+	_, err := connector.GetOrder(context.Background(), "55")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("first call: err = %v, want ErrRateLimited", err)
+	}
+	wait, limited := RateLimited(err)
+	if !limited || wait != 10*time.Millisecond {
+		t.Fatalf("RateLimited = (%v, %v), want (10ms, true)", wait, limited)
+	}
+
+	time.Sleep(wait)
+	order, err := connector.GetOrder(context.Background(), "55")
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if order.ID != "55" || calls != 2 {
+		t.Errorf("order = %+v after %d calls", order, calls)
+	}
+}
+
+func TestWooCommerceVerifyWebhook(t *testing.T) {
+	body := []byte(`{"id": 55, "status": "processing"}`)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		wantErr   error
+	}{
+		{name: "valid", secret: "cs_secret", body: body, signature: signWebhook("cs_secret", body)},
+		{name: "tampered body", secret: "cs_secret", body: []byte(`{"id": 55, "status": "completed"}`), signature: signWebhook("cs_secret", body), wantErr: ErrInvalidSignature},
+		{name: "other secret", secret: "cs_secret", body: body, signature: signWebhook("cs_other", body), wantErr: ErrInvalidSignature},
+		{name: "missing signature", secret: "cs_secret", body: body, wantErr: ErrInvalidSignature},
+		{name: "no secret configured", body: body, signature: signWebhook("", body), wantErr: ErrWebhookNotConfigured},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connector := NewWooCommerceConnector("ck_key", tt.secret, "https://store.test", nil)
+			header := http.Header{}
+			if tt.signature != "" {
+				header.Set(WooSignatureHeader, tt.signature)
+			}
+			if err := connector.VerifyWebhook(tt.body, header); !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyWebhook = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+/**
+ * Admin Handlers
+ * HTTP handlers for admin login, admin accounts, TOTP, the admin audit log and security events
+ */
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"lynkr/internal/auth"
+	"lynkr/internal/middleware"
+	"lynkr/internal/security"
+	"lynkr/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	adminService  *services.AdminService
+	auditService  *services.AdminAuditService
+	securityAudit *security.SecurityAudit
+	tokens        *auth.TokenService
+}
+
+func NewAdminHandler(adminService *services.AdminService, auditService *services.AdminAuditService, securityAudit *security.SecurityAudit, tokens *auth.TokenService) *AdminHandler {
+	return &AdminHandler{
+		adminService:  adminService,
+		auditService:  auditService,
+		securityAudit: securityAudit,
+		tokens:        tokens,
+	}
+}
+
+// AdminLoginRequest is the body of an admin login. Code is the current TOTP
+// code, required once the admin enabled TOTP.
+type AdminLoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code"`
+}
+
+// AdminLoginResponse is a token pair along with the admin
+type AdminLoginResponse struct {
+	*auth.TokenPair
+	Admin *services.AdminAccount `json:"admin"`
+}
+
+// Login authenticates an admin. Without a TOTP code for an admin with TOTP
+// enabled it responds with totpRequired, so the client can ask for one.
+func (ah *AdminHandler) Login(c *gin.Context) {
+	var request AdminLoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	admin, err := ah.adminService.Authenticate(request.Email, request.Password, request.Code)
+	switch {
+	case errors.Is(err, services.ErrTOTPRequired):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "totpRequired": true})
+		return
+	case errors.Is(err, services.ErrInvalidCredentials), errors.Is(err, services.ErrInvalidTOTPCode):
+		ah.logSecurityEvent(c, "failed_login", "", fmt.Sprintf("Failed admin login for %s: %v", request.Email, err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	case errors.Is(err, services.ErrAdminLocked):
+		ah.logSecurityEvent(c, "suspicious_activity", "", fmt.Sprintf("Admin login for %s locked after repeated failures", request.Email))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+
+	pair, err := ah.tokens.Issue(auth.Principal{Type: auth.PrincipalAdmin, ID: admin.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	actor := services.AdminActor{ID: admin.ID, IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+	if err := ah.auditService.Record(actor, "admin.login", "admin", admin.ID, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	ah.logSecurityEvent(c, "login_attempt", admin.ID, "Admin login")
+
+	c.JSON(http.StatusOK, AdminLoginResponse{TokenPair: pair, Admin: admin})
+}
+
+// GetMe returns the admin making the request
+func (ah *AdminHandler) GetMe(c *gin.Context) {
+	admin, err := ah.adminService.GetAdmin(middleware.AdminActor(c).ID)
+	if err != nil {
+		writeAdminError(c, err, "Failed to get admin")
+		return
+	}
+	c.JSON(http.StatusOK, admin)
+}
+
+// ChangePassword changes the password of the admin making the request and
+// ends all their sessions
+func (ah *AdminHandler) ChangePassword(c *gin.Context) {
+	var request struct {
+		CurrentPassword string `json:"currentPassword" binding:"required"`
+		NewPassword     string `json:"newPassword" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	actor := middleware.AdminActor(c)
+	if err := ah.adminService.ChangePassword(actor, request.CurrentPassword, request.NewPassword); err != nil {
+		writeAdminError(c, err, "Failed to change password")
+		return
+	}
+	if _, err := ah.tokens.RevokeSessions(auth.PrincipalAdmin, actor.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end sessions"})
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed, log in again"})
+}
+
+// SetupTOTP starts setting up TOTP and returns the secret to add to an
+// authenticator app
+func (ah *AdminHandler) SetupTOTP(c *gin.Context) {
+	setup, err := ah.adminService.SetupTOTP(middleware.AdminActor(c).ID)
+	if err != nil {
+		writeAdminError(c, err, "Failed to set up TOTP")
+		return
+	}
+	c.JSON(http.StatusOK, setup)
+}
+
+// EnableTOTP enables TOTP once a code from the authenticator app checks out
+func (ah *AdminHandler) EnableTOTP(c *gin.Context) {
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if err := ah.adminService.EnableTOTP(middleware.AdminActor(c), request.Code); err != nil {
+		writeAdminError(c, err, "Failed to enable TOTP")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, gin.H{"message": "TOTP enabled"})
+}
+
+// DisableTOTP turns off TOTP for the admin making the request, confirmed
+// with a current code
+func (ah *AdminHandler) DisableTOTP(c *gin.Context) {
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	actor := middleware.AdminActor(c)
+	if err := ah.adminService.DisableTOTP(actor, actor.ID, request.Code); err != nil {
+		writeAdminError(c, err, "Failed to disable TOTP")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, gin.H{"message": "TOTP disabled"})
+}
+
+// ListAdmins returns every admin account
+func (ah *AdminHandler) ListAdmins(c *gin.Context) {
+	admins, err := ah.adminService.ListAdmins()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list admins"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"admins": admins})
+}
+
+// CreateAdmin adds another admin
+func (ah *AdminHandler) CreateAdmin(c *gin.Context) {
+	var request struct {
+		Email    string `json:"email" binding:"required"`
+		Name     string `json:"name" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	admin, err := ah.adminService.CreateAdmin(middleware.AdminActor(c), request.Email, request.Name, request.Password)
+	if err != nil {
+		writeAdminError(c, err, "Failed to create admin")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusCreated, admin)
+}
+
+// DisableAdmin disables another admin and ends their sessions
+func (ah *AdminHandler) DisableAdmin(c *gin.Context) {
+	admin, err := ah.adminService.SetAdminDisabled(middleware.AdminActor(c), c.Param("adminId"), true)
+	if err != nil {
+		writeAdminError(c, err, "Failed to disable admin")
+		return
+	}
+	if _, err := ah.tokens.RevokeSessions(auth.PrincipalAdmin, admin.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end sessions"})
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, admin)
+}
+
+// EnableAdmin re-enables a disabled admin
+func (ah *AdminHandler) EnableAdmin(c *gin.Context) {
+	admin, err := ah.adminService.SetAdminDisabled(middleware.AdminActor(c), c.Param("adminId"), false)
+	if err != nil {
+		writeAdminError(c, err, "Failed to enable admin")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, admin)
+}
+
+// ResetAdminTOTP turns off TOTP for another admin who lost their device
+func (ah *AdminHandler) ResetAdminTOTP(c *gin.Context) {
+	adminID := c.Param("adminId")
+	actor := middleware.AdminActor(c)
+	if adminID == actor.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Disable your own TOTP with a current code"})
+		return
+	}
+	if err := ah.adminService.DisableTOTP(actor, adminID, ""); err != nil {
+		writeAdminError(c, err, "Failed to reset TOTP")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, gin.H{"message": "TOTP reset"})
+}
+
+// GetAuditLog lists what admins changed, newest first. adminId, action,
+// targetType, targetId, from and to (YYYY-MM-DD) narrow the listing.
+func (ah *AdminHandler) GetAuditLog(c *gin.Context) {
+	limit, offset, ok := pageParams(c, 50, 200)
+	if !ok {
+		return
+	}
+	filter := services.AdminAuditFilter{
+		AdminID:    c.Query("adminId"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("targetType"),
+		TargetID:   c.Query("targetId"),
+		Limit:      limit,
+		Offset:     offset,
+	}
+	if from := c.Query("from"); from != "" {
+		parsed, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+			return
+		}
+		filter.From = parsed
+	}
+	if to := c.Query("to"); to != "" {
+		parsed, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+			return
+		}
+		filter.To = parsed.AddDate(0, 0, 1)
+	}
+
+	entries, err := ah.auditService.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "limit": filter.Limit, "offset": filter.Offset})
+}
+
+// GetSecurityEvents lists the most recent security events, such as failed
+// logins
+func (ah *AdminHandler) GetSecurityEvents(c *gin.Context) {
+	limit, _, ok := pageParams(c, 100, 500)
+	if !ok {
+		return
+	}
+
+	events, err := ah.securityAudit.GetSecurityEvents(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get security events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events, "limit": limit})
+}
+
+// logSecurityEvent records a security event. Failing to record one does not
+// fail the request.
+func (ah *AdminHandler) logSecurityEvent(c *gin.Context, eventType, adminID, details string) {
+	if err := ah.securityAudit.LogSecurityEvent(eventType, adminID, c.ClientIP(), c.Request.UserAgent(), details); err != nil {
+		log.Printf("Failed to log security event %s: %v", eventType, err)
+	}
+}
+
+// pageParams reads the limit and offset query parameters. It writes an error
+// response and returns false for invalid values.
+func pageParams(c *gin.Context, defaultLimit, maxLimit int) (int, int, bool) {
+	limit, offset := defaultLimit, 0
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return 0, 0, false
+		}
+		limit = parsed
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	if value := c.Query("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return 0, 0, false
+		}
+		offset = parsed
+	}
+	return limit, offset, true
+}
+
+func writeAdminError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrAdminNotFound), errors.Is(err, services.ErrBrandNotFound),
+		errors.Is(err, services.ErrOrganizerNotFound), errors.Is(err, services.ErrEventNotFound),
+		errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidAdmin), errors.Is(err, services.ErrInvalidBrand),
+		errors.Is(err, services.ErrInvalidOrganizer), errors.Is(err, services.ErrInvalidEvent),
+		errors.Is(err, services.ErrInvalidTOTPCode), errors.Is(err, services.ErrImpersonationReason):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	case errors.Is(err, services.ErrAdminExists), errors.Is(err, services.ErrTOTPAlreadyEnabled),
+		errors.Is(err, services.ErrTOTPNotSetUp), errors.Is(err, services.ErrOrganizerHasEvents):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,413 @@
+/**
+ * Admin Console Handlers
+ * HTTP handlers for admins managing brands, organizers, events and users, and impersonating brands
+ */
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"lynkr/internal/auth"
+	"lynkr/internal/middleware"
+	"lynkr/internal/security"
+	"lynkr/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminConsoleHandler struct {
+	consoleService   *services.AdminConsoleService
+	organizerService *services.OrganizerService
+	memberService    *services.BrandMemberService
+	securityAudit    *security.SecurityAudit
+	tokens           *auth.TokenService
+}
+
+func NewAdminConsoleHandler(consoleService *services.AdminConsoleService, organizerService *services.OrganizerService, memberService *services.BrandMemberService, securityAudit *security.SecurityAudit, tokens *auth.TokenService) *AdminConsoleHandler {
+	return &AdminConsoleHandler{
+		consoleService:   consoleService,
+		organizerService: organizerService,
+		memberService:    memberService,
+		securityAudit:    securityAudit,
+		tokens:           tokens,
+	}
+}
+
+// ListBrands returns brands by name; q searches by name
+func (ach *AdminConsoleHandler) ListBrands(c *gin.Context) {
+	limit, offset, ok := pageParams(c, 50, 200)
+	if !ok {
+		return
+	}
+	brands, err := ach.consoleService.ListBrands(c.Query("q"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list brands"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"brands": brands, "limit": limit, "offset": offset})
+}
+
+// GetBrand returns a brand
+func (ach *AdminConsoleHandler) GetBrand(c *gin.Context) {
+	brand, err := ach.consoleService.GetBrand(c.Param("brandId"))
+	if err != nil {
+		writeAdminError(c, err, "Failed to get brand")
+		return
+	}
+	c.JSON(http.StatusOK, brand)
+}
+
+// CreateBrand adds a brand. Invite its first owner afterwards.
+func (ach *AdminConsoleHandler) CreateBrand(c *gin.Context) {
+	var input services.BrandInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	brand, err := ach.consoleService.CreateBrand(middleware.AdminActor(c), input)
+	if err != nil {
+		writeAdminError(c, err, "Failed to create brand")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusCreated, brand)
+}
+
+// UpdateBrand replaces a brand's name, logo and contact info
+func (ach *AdminConsoleHandler) UpdateBrand(c *gin.Context) {
+	var input services.BrandInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	brand, err := ach.consoleService.UpdateBrand(middleware.AdminActor(c), c.Param("brandId"), input)
+	if err != nil {
+		writeAdminError(c, err, "Failed to update brand")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, brand)
+}
+
+// ListBrandMembers returns the members of a brand
+func (ach *AdminConsoleHandler) ListBrandMembers(c *gin.Context) {
+	brandID := c.Param("brandId")
+	if _, err := ach.consoleService.GetBrand(brandID); err != nil {
+		writeAdminError(c, err, "Failed to list members")
+		return
+	}
+	members, err := ach.memberService.ListMembers(brandID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list members"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// InviteBrandMember invites someone to a brand, for example the first owner
+// of a new brand. The invitation is recorded in the brand's audit log.
+func (ach *AdminConsoleHandler) InviteBrandMember(c *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required"`
+		Role  string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	admin := middleware.AdminActor(c)
+	actor := services.BrandActor{Type: string(auth.PrincipalAdmin), ID: admin.ID, IPAddress: admin.IPAddress, UserAgent: admin.UserAgent}
+	invitation, _, err := ach.memberService.Invite(c.Param("brandId"), actor, request.Email, request.Role)
+	if err != nil {
+		writeMemberError(c, err, "Failed to invite member")
+		return
+	}
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// ImpersonateBrand lets an admin act as a brand for support. It returns an
+// access token for the brand routes that expires with the access token
+// lifetime and cannot be refreshed. Starting the impersonation and every
+// request made with the token are recorded in the brand's audit log.
+func (ach *AdminConsoleHandler) ImpersonateBrand(c *gin.Context) {
+	var request struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required"})
+		return
+	}
+
+	actor := middleware.AdminActor(c)
+	brand, err := ach.consoleService.Impersonate(actor, c.Param("brandId"), request.Reason)
+	if err != nil {
+		writeAdminError(c, err, "Failed to impersonate brand")
+		return
+	}
+	pair, err := ach.tokens.IssueAccessToken(auth.Principal{Type: auth.PrincipalAdmin, ID: actor.ID, BrandID: brand.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	details := fmt.Sprintf("Admin %s impersonated brand %s: %s", actor.ID, brand.ID, request.Reason)
+	if err := ach.securityAudit.LogSecurityEvent("data_access", actor.ID, actor.IPAddress, actor.UserAgent, details); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to impersonate brand"})
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, gin.H{
+		"token":     pair.AccessToken,
+		"tokenType": pair.TokenType,
+		"expiresIn": pair.ExpiresIn,
+		"brand":     brand,
+	})
+}
+
+// ListOrganizers returns organizers by name; q searches by name
+func (ach *AdminConsoleHandler) ListOrganizers(c *gin.Context) {
+	limit, offset, ok := pageParams(c, 50, 200)
+	if !ok {
+		return
+	}
+	organizers, err := ach.organizerService.ListOrganizers(c.Query("q"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list organizers"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"organizers": organizers, "limit": limit, "offset": offset})
+}
+
+// GetOrganizer returns an organizer
+func (ach *AdminConsoleHandler) GetOrganizer(c *gin.Context) {
+	id, ok := int64Param(c, "organizerId")
+	if !ok {
+		return
+	}
+	organizer, err := ach.organizerService.GetOrganizer(id)
+	if err != nil {
+		writeAdminError(c, err, "Failed to get organizer")
+		return
+	}
+	c.JSON(http.StatusOK, organizer)
+}
+
+// CreateOrganizer adds an organizer
+func (ach *AdminConsoleHandler) CreateOrganizer(c *gin.Context) {
+	var input services.OrganizerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	organizer, err := ach.organizerService.CreateOrganizer(middleware.AdminActor(c), input)
+	if err != nil {
+		writeAdminError(c, err, "Failed to create organizer")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusCreated, organizer)
+}
+
+// UpdateOrganizer replaces an organizer's details
+func (ach *AdminConsoleHandler) UpdateOrganizer(c *gin.Context) {
+	id, ok := int64Param(c, "organizerId")
+	if !ok {
+		return
+	}
+	var input services.OrganizerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	organizer, err := ach.organizerService.UpdateOrganizer(middleware.AdminActor(c), id, input)
+	if err != nil {
+		writeAdminError(c, err, "Failed to update organizer")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, organizer)
+}
+
+// DeleteOrganizer removes an organizer without events
+func (ach *AdminConsoleHandler) DeleteOrganizer(c *gin.Context) {
+	id, ok := int64Param(c, "organizerId")
+	if !ok {
+		return
+	}
+	if err := ach.organizerService.DeleteOrganizer(middleware.AdminActor(c), id); err != nil {
+		writeAdminError(c, err, "Failed to delete organizer")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Organizer deleted"})
+}
+
+// ListEvents returns events, latest first. brandId and organizerId filter
+// and q searches by name.
+func (ach *AdminConsoleHandler) ListEvents(c *gin.Context) {
+	limit, offset, ok := pageParams(c, 50, 200)
+	if !ok {
+		return
+	}
+	events, err := ach.consoleService.ListEvents(services.AdminEventFilter{
+		BrandID:     c.Query("brandId"),
+		OrganizerID: c.Query("organizerId"),
+		Search:      c.Query("q"),
+		Limit:       limit,
+		Offset:      offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list events"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events, "limit": limit, "offset": offset})
+}
+
+// GetEvent returns an event
+func (ach *AdminConsoleHandler) GetEvent(c *gin.Context) {
+	id, ok := int64Param(c, "eventId")
+	if !ok {
+		return
+	}
+	event, err := ach.consoleService.GetEvent(id)
+	if err != nil {
+		writeAdminError(c, err, "Failed to get event")
+		return
+	}
+	c.JSON(http.StatusOK, event)
+}
+
+// CreateEvent adds an event for a brand, optionally run by an organizer
+func (ach *AdminConsoleHandler) CreateEvent(c *gin.Context) {
+	var input services.EventInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	event, err := ach.consoleService.CreateEvent(middleware.AdminActor(c), input)
+	if err != nil {
+		writeAdminError(c, err, "Failed to create event")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusCreated, event)
+}
+
+// UpdateEvent replaces an event's details, brand and organizer
+func (ach *AdminConsoleHandler) UpdateEvent(c *gin.Context) {
+	id, ok := int64Param(c, "eventId")
+	if !ok {
+		return
+	}
+	var input services.EventInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	event, err := ach.consoleService.UpdateEvent(middleware.AdminActor(c), id, input)
+	if err != nil {
+		writeAdminError(c, err, "Failed to update event")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, event)
+}
+
+// ListUsers returns app users, newest first; q searches usernames and emails
+func (ach *AdminConsoleHandler) ListUsers(c *gin.Context) {
+	limit, offset, ok := pageParams(c, 50, 200)
+	if !ok {
+		return
+	}
+	users, err := ach.consoleService.ListUsers(c.Query("q"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users, "limit": limit, "offset": offset})
+}
+
+// GetUser returns an app user
+func (ach *AdminConsoleHandler) GetUser(c *gin.Context) {
+	id, ok := int64Param(c, "userId")
+	if !ok {
+		return
+	}
+	user, err := ach.consoleService.GetUser(uint(id))
+	if err != nil {
+		writeAdminError(c, err, "Failed to get user")
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// DisableUser stops a user from logging in and ends their sessions
+func (ach *AdminConsoleHandler) DisableUser(c *gin.Context) {
+	ach.setUserDisabled(c, true)
+}
+
+// EnableUser lets a disabled user log in again
+func (ach *AdminConsoleHandler) EnableUser(c *gin.Context) {
+	ach.setUserDisabled(c, false)
+}
+
+func (ach *AdminConsoleHandler) setUserDisabled(c *gin.Context, disabled bool) {
+	id, ok := int64Param(c, "userId")
+	if !ok {
+		return
+	}
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	// The reason is optional, so an empty body is fine
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	user, err := ach.consoleService.SetUserDisabled(middleware.AdminActor(c), uint(id), disabled, request.Reason)
+	if err != nil {
+		writeAdminError(c, err, "Failed to update user")
+		return
+	}
+	if disabled {
+		if _, err := ach.tokens.RevokeSessions(auth.PrincipalUser, strconv.FormatUint(uint64(user.ID), 10)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end sessions"})
+			return
+		}
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, user)
+}
+
+// int64Param reads a numeric route parameter. It writes an error response
+// and returns false when the parameter is not a positive number.
+func int64Param(c *gin.Context, name string) (int64, bool) {
+	value, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || value <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+		return 0, false
+	}
+	return value, true
+}
@@ -1,12 +1,16 @@
 /**
  * Advanced Analytics Handlers
- * HTTP handlers for AI tagging and conversion funnel analytics
+ * HTTP handlers for AI tagging, conversion funnel and attribution analytics
  */
 
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"lynkr/internal/services"
 
@@ -16,12 +20,14 @@ import (
 type AdvancedAnalyticsHandler struct {
 	aiTaggingService        *services.AITaggingService
 	conversionFunnelService *services.ConversionFunnelService
+	attributionService      *services.AttributionService
 }
 
-func NewAdvancedAnalyticsHandler(aiTaggingService *services.AITaggingService, conversionFunnelService *services.ConversionFunnelService) *AdvancedAnalyticsHandler {
+func NewAdvancedAnalyticsHandler(aiTaggingService *services.AITaggingService, conversionFunnelService *services.ConversionFunnelService, attributionService *services.AttributionService) *AdvancedAnalyticsHandler {
 	return &AdvancedAnalyticsHandler{
 		aiTaggingService:        aiTaggingService,
 		conversionFunnelService: conversionFunnelService,
+		attributionService:      attributionService,
 	}
 }
 
@@ -37,13 +43,13 @@ func (aah *AdvancedAnalyticsHandler) ProcessContentAI(c *gin.Context) {
 		return
 	}
 
-	result, err := aah.aiTaggingService.ProcessContent(contentID, request.MediaURL)
+	job, err := aah.aiTaggingService.QueueContentProcessing(contentID, request.MediaURL)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process content"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue content processing"})
 		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	c.JSON(http.StatusAccepted, gin.H{"status": "queued", "jobId": job.ID})
 }
 
 func (aah *AdvancedAnalyticsHandler) GetProductAnalytics(c *gin.Context) {
@@ -92,6 +98,56 @@ func (aah *AdvancedAnalyticsHandler) GetAttributionReport(c *gin.Context) {
 	c.JSON(http.StatusOK, report)
 }
 
+// CompareAttributionModels reports the event's attributed conversions and
+// revenue under each of the models given as a comma separated list, all by
+// default. lookbackDays and halfLifeDays override the defaults of 30 and 7.
+func (aah *AdvancedAnalyticsHandler) CompareAttributionModels(c *gin.Context) {
+	brandID := c.GetString("brandID")
+	if brandID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Brand ID required"})
+		return
+	}
+
+	var options services.AttributionOptions
+	if models := c.Query("models"); models != "" {
+		options.Models = strings.Split(models, ",")
+	}
+	if value := c.Query("lookbackDays"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lookbackDays"})
+			return
+		}
+		options.Lookback = time.Duration(days) * 24 * time.Hour
+	}
+	if value := c.Query("halfLifeDays"); value != "" {
+		days, err := strconv.ParseFloat(value, 64)
+		if err != nil || days <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid halfLifeDays"})
+			return
+		}
+		options.HalfLife = time.Duration(days * float64(24*time.Hour))
+	}
+
+	options, err := services.NormalizeAttributionOptions(options)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	comparison, err := aah.attributionService.CompareModels(brandID, c.Param("id"), options)
+	if errors.Is(err, services.ErrEventNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compare attribution models"})
+		return
+	}
+
+	c.JSON(http.StatusOK, comparison)
+}
+
 func (aah *AdvancedAnalyticsHandler) TrackConversion(c *gin.Context) {
 	userID := c.GetHeader("X-User-ID")
 	if userID == "" {
@@ -0,0 +1,103 @@
+/**
+ * API Key Handlers
+ * HTTP handlers for managing a brand's API keys
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"lynkr/internal/auth"
+	"lynkr/internal/middleware"
+	"lynkr/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+}
+
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService}
+}
+
+// CreateAPIKeyResponse holds a new API key. Key is only ever shown here.
+type CreateAPIKeyResponse struct {
+	*services.APIKey
+	Key string `json:"key"`
+}
+
+// ListAPIKeys returns the brand's API keys along with the scopes keys can have
+func (akh *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := akh.apiKeyService.ListAPIKeys(c.GetString("brandID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"apiKeys": keys,
+		"scopes":  auth.APIKeyScopes(),
+	})
+}
+
+// GetAPIKey returns one of the brand's API keys
+func (akh *APIKeyHandler) GetAPIKey(c *gin.Context) {
+	apiKey, err := akh.apiKeyService.GetAPIKey(c.GetString("brandID"), c.Param("keyId"))
+	if err != nil {
+		writeAPIKeyError(c, err, "Failed to get API key")
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKey)
+}
+
+// CreateAPIKey creates an API key with a name, scopes and an optional expiry
+func (akh *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var input services.APIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	apiKey, key, err := akh.apiKeyService.CreateAPIKey(c.GetString("brandID"), middleware.BrandActor(c), input)
+	if err != nil {
+		writeAPIKeyError(c, err, "Failed to create API key")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{APIKey: apiKey, Key: key})
+}
+
+// RevokeAPIKey stops an API key from working
+func (akh *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	brandID := c.GetString("brandID")
+	if err := akh.apiKeyService.RevokeAPIKey(brandID, middleware.BrandActor(c), c.Param("keyId")); err != nil {
+		writeAPIKeyError(c, err, "Failed to revoke API key")
+		return
+	}
+
+	apiKey, err := akh.apiKeyService.GetAPIKey(brandID, c.Param("keyId"))
+	if err != nil {
+		writeAPIKeyError(c, err, "Failed to get API key")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, apiKey)
+}
+
+func writeAPIKeyError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrAPIKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidAPIKey):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,73 @@
+/**
+ * Auth Handlers
+ * HTTP handlers for refreshing tokens and logging out
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"lynkr/internal/auth"
+	"lynkr/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthHandler struct {
+	tokens *auth.TokenService
+}
+
+func NewAuthHandler(tokens *auth.TokenService) *AuthHandler {
+	return &AuthHandler{tokens: tokens}
+}
+
+// Refresh exchanges a refresh token for a new token pair. The refresh token
+// can only be used once; reusing it ends the session.
+func (ah *AuthHandler) Refresh(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	pair, err := ah.tokens.Refresh(request.RefreshToken)
+	switch {
+	case errors.Is(err, auth.ErrInvalidRefreshToken), errors.Is(err, auth.ErrRefreshTokenReused):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pair)
+}
+
+// Logout revokes the access token of the request and ends its session
+func (ah *AuthHandler) Logout(c *gin.Context) {
+	claims, ok := middleware.CurrentTokenClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if err := ah.tokens.Logout(claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// currentUserID returns the ID of the app user making the request
+func currentUserID(c *gin.Context) (string, bool) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok || principal.Type != auth.PrincipalUser {
+		return "", false
+	}
+	return principal.ID, true
+}
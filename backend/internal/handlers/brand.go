@@ -1,133 +1,85 @@
 /**
  * Brand Handlers
- * HTTP handlers for brand authentication and management
+ * HTTP handlers for brand dashboards, campaigns and content
  */
 
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 
 	// "golang.org/x/crypto/bcrypt"
 	"lynkr/internal/services"
 )
 
 type BrandHandler struct {
-	brandService *services.BrandService
-	jwtSecret    []byte
+	brandService     *services.BrandService
+	campaignService  *services.CampaignService
+	dashboardService *services.DashboardService
 }
 
-type BrandLoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+type CampaignRequest struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	StartDate   string  `json:"startDate"`
+	EndDate     string  `json:"endDate"`
+	Budget      float64 `json:"budget"`
 }
 
-type BrandLoginResponse struct {
-	Token string      `json:"token"`
-	User  interface{} `json:"user"`
-}
-
-type BrandClaims struct {
-	BrandID string `json:"brandId"`
-	UserID  string `json:"userId"`
-	Role    string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-func NewBrandHandler(brandService *services.BrandService, jwtSecret string) *BrandHandler {
+func NewBrandHandler(brandService *services.BrandService, campaignService *services.CampaignService, dashboardService *services.DashboardService) *BrandHandler {
 	return &BrandHandler{
-		brandService: brandService,
-		jwtSecret:    []byte(jwtSecret),
+		brandService:     brandService,
+		campaignService:  campaignService,
+		dashboardService: dashboardService,
 	}
 }
 
-// Login handles brand user authentication
-func (bh *BrandHandler) Login(c *gin.Context) {
-	var req BrandLoginRequest
-	// if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-	// 	http.Error(w, "Invalid request body", http.StatusBadRequest)
-	// 	return
-	// }
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// GetDashboardStats returns dashboard statistics for a date range
+func (bh *BrandHandler) GetDashboardStats(c *gin.Context) {
+	brandID := c.GetString("brandID")
+	if brandID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Brand ID required"})
 		return
 	}
 
-	// Validate credentials (simplified - in real implementation would check database)
-	if req.Email == "brand@example.com" && req.Password == "password" {
-		// Generate JWT token
-		claims := BrandClaims{
-			BrandID: "brand_1",
-			UserID:  "user_1",
-			Role:    "brand",
-			RegisteredClaims: jwt.RegisteredClaims{
-				ID:        "brand_1",
-				ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-				IssuedAt:  jwt.NewNumericDate(time.Now()),
-			},
-		}
+	filter := services.DashboardFilter{GroupBy: c.DefaultQuery("groupBy", services.DashboardGroupByMonth)}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		tokenString, err := token.SignedString(bh.jwtSecret)
+	if from := c.Query("from"); from != "" {
+		parsed, err := time.Parse("2006-01-02", from)
 		if err != nil {
-			// http.Error(w, "Failed to generate token", http.StatusInternalServerError)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
 			return
 		}
+		filter.From = parsed
+	}
 
-		user := map[string]interface{}{
-			"id":      "user_1",
-			"name":    "Brand Manager",
-			"email":   req.Email,
-			"brandId": 123,
-			"role":    "brand",
-		}
-
-		response := BrandLoginResponse{
-			Token: tokenString,
-			User:  user,
+	if to := c.Query("to"); to != "" {
+		parsed, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+			return
 		}
+		// Include the whole end day
+		filter.To = parsed.AddDate(0, 0, 1)
+	}
 
-		// w.Header().Set("Content-Type", "application/json")
-		// json.NewEncoder(w).Encode(response)
-		c.JSON(http.StatusOK, response)
-	} else {
-		// http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	filter, err := services.NormalizeDashboardFilter(filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-}
 
-// GetDashboardStats returns dashboard statistics
-func (bh *BrandHandler) GetDashboardStats(c *gin.Context) {
-	brandID := c.GetString("brandID")
-	if brandID == "" {
-		// http.Error(w, "Brand ID required", http.StatusBadRequest)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Brand ID required"})
+	stats, err := bh.dashboardService.GetDashboardStats(brandID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get dashboard statistics"})
 		return
 	}
-	// Simulate dashboard data
-	stats := map[string]interface{}{
-		"totalAttendees": 1247,
-		"contentPieces":  89,
-		"engagementRate": 23.5,
-		"conversionRate": 4.2,
-		"attendanceData": []map[string]interface{}{
-			{"date": "2024-01", "attendees": 120},
-			{"date": "2024-02", "attendees": 180},
-			{"date": "2024-03", "attendees": 250},
-			{"date": "2024-04", "attendees": 320},
-			{"date": "2024-05", "attendees": 280},
-			{"date": "2024-06", "attendees": 380},
-		},
-	}
-
-	// w.Header().Set("Content-Type", "application/json")
-	// json.NewEncoder(w).Encode(stats)
-	//fmt.Printf(brandID.[string])
+
 	c.JSON(http.StatusOK, stats)
 }
 
@@ -139,117 +91,287 @@ func (bh *BrandHandler) GetCampaigns(c *gin.Context) {
 		return
 	}
 
-	campaigns := []map[string]interface{}{
-		{
-			"id":        "1",
-			"name":      "Tech Conference 2024",
-			"status":    "active",
-			"startDate": "2024-03-15",
-			"endDate":   "2024-03-17",
-			"budget":    50000,
-			"attendees": 1247,
-		},
-		{
-			"id":        "2",
-			"name":      "Product Launch Event",
-			"status":    "completed",
-			"startDate": "2024-02-10",
-			"endDate":   "2024-02-12",
-			"budget":    75000,
-			"attendees": 890,
-		},
-	}
-
-	// w.Header().Set("Content-Type", "application/json")
-	// json.NewEncoder(w).Encode(map[string]interface{}{
-	// 	"campaigns": campaigns,
-	// })
-	c.JSON(http.StatusOK, map[string]interface{}{
-		"campaigns": campaigns,
-	})
+	includeArchived := c.Query("includeArchived") == "true"
+
+	campaigns, err := bh.campaignService.ListCampaigns(brandID, includeArchived)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get campaigns"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"campaigns": campaigns})
 }
 
-// CreateCampaign creates a new campaign
+// GetCampaign returns a single brand campaign
+func (bh *BrandHandler) GetCampaign(c *gin.Context) {
+	brandID, campaignID, ok := bh.campaignParams(c)
+	if !ok {
+		return
+	}
+
+	campaign, err := bh.campaignService.GetCampaign(brandID, campaignID)
+	if err != nil {
+		respondCampaignError(c, err, "Failed to get campaign")
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// CreateCampaign creates a new campaign in draft status
 func (bh *BrandHandler) CreateCampaign(c *gin.Context) {
 	brandID := c.GetString("brandID")
 	if brandID == "" {
-		// http.Error(w, "Brand ID required", http.StatusBadRequest)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Brand ID required"})
 		return
 	}
 
-	var campaign map[string]interface{}
-	// if err := json.NewDecoder(r.Body).Decode(&campaign); err != nil {
-	// 	http.Error(w, "Invalid request body", http.StatusBadRequest)
-	// 	return
-	// }
-	if err := c.ShouldBindJSON(&campaign); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	input, ok := bindCampaignInput(c)
+	if !ok {
+		return
 	}
 
-	// Add campaign ID and default values
-	campaign["id"] = time.Now().UnixNano()
-	campaign["status"] = "draft"
-	campaign["attendees"] = 0
-	campaign["brandId"] = brandID
+	campaign, err := bh.campaignService.CreateCampaign(brandID, input)
+	if err != nil {
+		respondCampaignError(c, err, "Failed to create campaign")
+		return
+	}
 
-	// w.Header().Set("Content-Type", "application/json")
-	// json.NewEncoder(w).Encode(map[string]interface{}{
-	// 	"campaign": campaign,
-	// 	"message":  "Campaign created successfully",
-	// })
-	c.JSON(http.StatusOK, map[string]interface{}{
+	c.JSON(http.StatusCreated, gin.H{
 		"campaign": campaign,
 		"message":  "Campaign created successfully",
 	})
 }
 
+// UpdateCampaign updates campaign details and budget
+func (bh *BrandHandler) UpdateCampaign(c *gin.Context) {
+	brandID, campaignID, ok := bh.campaignParams(c)
+	if !ok {
+		return
+	}
+
+	input, ok := bindCampaignInput(c)
+	if !ok {
+		return
+	}
+
+	campaign, err := bh.campaignService.UpdateCampaign(brandID, campaignID, input)
+	if err != nil {
+		respondCampaignError(c, err, "Failed to update campaign")
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// UpdateCampaignStatus moves a campaign to the next lifecycle status
+func (bh *BrandHandler) UpdateCampaignStatus(c *gin.Context) {
+	brandID, campaignID, ok := bh.campaignParams(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Status string `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Status == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status required"})
+		return
+	}
+
+	campaign, err := bh.campaignService.TransitionStatus(brandID, campaignID, request.Status)
+	if err != nil {
+		respondCampaignError(c, err, "Failed to update campaign status")
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// ArchiveCampaign archives a campaign
+func (bh *BrandHandler) ArchiveCampaign(c *gin.Context) {
+	brandID, campaignID, ok := bh.campaignParams(c)
+	if !ok {
+		return
+	}
+
+	if err := bh.campaignService.ArchiveCampaign(brandID, campaignID); err != nil {
+		respondCampaignError(c, err, "Failed to archive campaign")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "archived"})
+}
+
+// LinkCampaignEvent attaches an event to a campaign
+func (bh *BrandHandler) LinkCampaignEvent(c *gin.Context) {
+	brandID, campaignID, ok := bh.campaignParams(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		EventID string `json:"eventId"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.EventID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Event ID required"})
+		return
+	}
+
+	if err := bh.campaignService.LinkEvent(brandID, campaignID, request.EventID); err != nil {
+		respondCampaignError(c, err, "Failed to link event")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "linked"})
+}
+
+// UnlinkCampaignEvent detaches an event from a campaign
+func (bh *BrandHandler) UnlinkCampaignEvent(c *gin.Context) {
+	brandID, campaignID, ok := bh.campaignParams(c)
+	if !ok {
+		return
+	}
+
+	if err := bh.campaignService.UnlinkEvent(brandID, campaignID, c.Param("eventId")); err != nil {
+		respondCampaignError(c, err, "Failed to unlink event")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "unlinked"})
+}
+
+// RecordCampaignExpense books spend against a campaign budget
+func (bh *BrandHandler) RecordCampaignExpense(c *gin.Context) {
+	brandID, campaignID, ok := bh.campaignParams(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Amount      float64   `json:"amount"`
+		Category    string    `json:"category"`
+		Description string    `json:"description"`
+		IncurredAt  time.Time `json:"incurredAt"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	expense, err := bh.campaignService.RecordExpense(
+		brandID, campaignID, request.Amount, request.Category, request.Description, request.IncurredAt,
+	)
+	if err != nil {
+		respondCampaignError(c, err, "Failed to record expense")
+		return
+	}
+
+	c.JSON(http.StatusCreated, expense)
+}
+
+// GetCampaignRollup returns attendees, content, revenue and budget totals for a campaign
+func (bh *BrandHandler) GetCampaignRollup(c *gin.Context) {
+	brandID, campaignID, ok := bh.campaignParams(c)
+	if !ok {
+		return
+	}
+
+	rollup, err := bh.campaignService.GetCampaignRollup(brandID, campaignID)
+	if err != nil {
+		respondCampaignError(c, err, "Failed to get campaign rollup")
+		return
+	}
+
+	c.JSON(http.StatusOK, rollup)
+}
+
 // GetBrandContent returns content accessible to the brand
 func (bh *BrandHandler) GetBrandContent(c *gin.Context) {
 	brandID := c.GetString("brandID")
 	if brandID == "" {
-		// http.Error(w, "Brand ID required", http.StatusBadRequest)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Brand ID required"})
 		return
 	}
 
-	content := []map[string]interface{}{
-		{
-			"id":        "1",
-			"mediaUrl":  "https://via.placeholder.com/300x300",
-			"mediaType": "photo",
-			"caption":   "Amazing product demo at the tech conference!",
-			"tags":      []string{"tech", "product-demo", "innovation"},
-			"createdAt": "2024-03-15T10:30:00Z",
-			"eventName": "Tech Conference 2024",
-			"engagement": map[string]int{
-				"views":  1250,
-				"shares": 45,
-				"likes":  189,
-			},
-		},
-		{
-			"id":        "2",
-			"mediaUrl":  "https://via.placeholder.com/300x300",
-			"mediaType": "photo",
-			"caption":   "Great networking session with industry leaders",
-			"tags":      []string{"networking", "conference", "business"},
-			"createdAt": "2024-03-15T14:20:00Z",
-			"eventName": "Tech Conference 2024",
-			"engagement": map[string]int{
-				"views":  890,
-				"shares": 23,
-				"likes":  156,
-			},
-		},
-	}
-
-	// w.Header().Set("Content-Type", "application/json")
-	// json.NewEncoder(w).Encode(map[string]interface{}{
-	// 	"content": content,
-	// })
-	c.JSON(http.StatusOK, map[string]interface{}{
-		"content": content,
-	})
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		offset = 0
+	}
+
+	content, err := bh.brandService.GetBrandContent(brandID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get brand content"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"content": content})
+}
+
+func (bh *BrandHandler) campaignParams(c *gin.Context) (string, int64, bool) {
+	brandID := c.GetString("brandID")
+	if brandID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Brand ID required"})
+		return "", 0, false
+	}
 
+	campaignID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return "", 0, false
+	}
+
+	return brandID, campaignID, true
+}
+
+func bindCampaignInput(c *gin.Context) (services.CampaignInput, bool) {
+	var request CampaignRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return services.CampaignInput{}, false
+	}
+
+	startDate, err := parseCampaignDate(request.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date"})
+		return services.CampaignInput{}, false
+	}
+	endDate, err := parseCampaignDate(request.EndDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date"})
+		return services.CampaignInput{}, false
+	}
+
+	return services.CampaignInput{
+		Name:        request.Name,
+		Description: request.Description,
+		StartDate:   startDate,
+		EndDate:     endDate,
+		Budget:      request.Budget,
+	}, true
+}
+
+// parseCampaignDate accepts both the portal's YYYY-MM-DD dates and RFC3339 timestamps
+func parseCampaignDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func respondCampaignError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrCampaignNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+	case errors.Is(err, services.ErrInvalidCampaign), errors.Is(err, services.ErrEventNotOwnedByBrand):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidCampaignTransition), errors.Is(err, services.ErrCampaignArchived):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
 }
@@ -0,0 +1,366 @@
+/**
+ * Brand Member Handlers
+ * HTTP handlers for brand login, members, invitations and the brand audit log
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"lynkr/internal/auth"
+	"lynkr/internal/middleware"
+	"lynkr/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BrandMemberHandler struct {
+	memberService *services.BrandMemberService
+	auditService  *services.BrandAuditService
+	tokens        *auth.TokenService
+}
+
+type BrandLoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	BrandID  string `json:"brandId"` // optional, defaults to the account's first brand
+}
+
+type BrandLoginResponse struct {
+	*auth.TokenPair
+	User *services.BrandUser `json:"user"`
+}
+
+func NewBrandMemberHandler(memberService *services.BrandMemberService, auditService *services.BrandAuditService, tokens *auth.TokenService) *BrandMemberHandler {
+	return &BrandMemberHandler{
+		memberService: memberService,
+		auditService:  auditService,
+		tokens:        tokens,
+	}
+}
+
+// Login handles brand member authentication
+func (bmh *BrandMemberHandler) Login(c *gin.Context) {
+	var req BrandLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := bmh.memberService.Authenticate(req.Email, req.Password, req.BrandID)
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	case errors.Is(err, services.ErrNotBrandMember):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this brand"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+
+	bmh.startSession(c, user, "member.login")
+}
+
+// SwitchBrand starts a session for another brand of the logged in member
+// and ends the current one
+func (bmh *BrandMemberHandler) SwitchBrand(c *gin.Context) {
+	var request struct {
+		BrandID string `json:"brandId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok || principal.Type != auth.PrincipalBrandMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Brand member access required"})
+		return
+	}
+
+	user, err := bmh.memberService.GetBrandUser(principal.ID, request.BrandID)
+	if errors.Is(err, services.ErrNotBrandMember) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this brand"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to switch brand"})
+		return
+	}
+
+	if claims, ok := middleware.CurrentTokenClaims(c); ok {
+		if err := bmh.tokens.Logout(claims); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to switch brand"})
+			return
+		}
+	}
+	middleware.MarkAudited(c)
+	bmh.startSession(c, user, "member.login")
+}
+
+// PreviewInvitation shows the brand and role an invitation token is for
+func (bmh *BrandMemberHandler) PreviewInvitation(c *gin.Context) {
+	var request struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	preview, err := bmh.memberService.PreviewInvitation(request.Token)
+	if errors.Is(err, services.ErrInvalidInvitation) || errors.Is(err, services.ErrBrandNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": services.ErrInvalidInvitation.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// AcceptInvitation joins the brand of an invitation and logs the member in
+func (bmh *BrandMemberHandler) AcceptInvitation(c *gin.Context) {
+	var request struct {
+		Token    string `json:"token" binding:"required"`
+		Name     string `json:"name"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, err := bmh.memberService.AcceptInvitation(request.Token, request.Name, request.Password)
+	switch {
+	case errors.Is(err, services.ErrInvalidInvitation):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrInvalidMember):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password for the existing account"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	bmh.startSession(c, user, "")
+}
+
+// ListMembers returns the members of the brand
+func (bmh *BrandMemberHandler) ListMembers(c *gin.Context) {
+	members, err := bmh.memberService.ListMembers(c.GetString("brandID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list members"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// GetRoles lists the brand roles and the permissions each one grants
+func (bmh *BrandMemberHandler) GetRoles(c *gin.Context) {
+	roles := []gin.H{}
+	for _, role := range auth.BrandRoles() {
+		roles = append(roles, gin.H{"role": role, "permissions": auth.BrandRolePermissions(role)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// UpdateMemberRole changes the role of a member
+func (bmh *BrandMemberHandler) UpdateMemberRole(c *gin.Context) {
+	var request struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	member, err := bmh.memberService.UpdateMemberRole(c.GetString("brandID"), middleware.BrandActor(c), c.Param("memberId"), request.Role)
+	if err != nil {
+		writeMemberError(c, err, "Failed to update member role")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveMember takes a member out of the brand
+func (bmh *BrandMemberHandler) RemoveMember(c *gin.Context) {
+	if err := bmh.memberService.RemoveMember(c.GetString("brandID"), middleware.BrandActor(c), c.Param("memberId")); err != nil {
+		writeMemberError(c, err, "Failed to remove member")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+// ListInvitations returns the brand's open invitations
+func (bmh *BrandMemberHandler) ListInvitations(c *gin.Context) {
+	invitations, err := bmh.memberService.ListInvitations(c.GetString("brandID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+// InviteMember emails an invitation to join the brand
+func (bmh *BrandMemberHandler) InviteMember(c *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required"`
+		Role  string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	invitation, _, err := bmh.memberService.Invite(c.GetString("brandID"), middleware.BrandActor(c), request.Email, request.Role)
+	if err != nil {
+		writeMemberError(c, err, "Failed to invite member")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// ResendInvitation emails an invitation again with a new link
+func (bmh *BrandMemberHandler) ResendInvitation(c *gin.Context) {
+	invitation, _, err := bmh.memberService.ResendInvitation(c.GetString("brandID"), middleware.BrandActor(c), c.Param("invitationId"))
+	if err != nil {
+		writeMemberError(c, err, "Failed to resend invitation")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, invitation)
+}
+
+// RevokeInvitation withdraws an invitation
+func (bmh *BrandMemberHandler) RevokeInvitation(c *gin.Context) {
+	if err := bmh.memberService.RevokeInvitation(c.GetString("brandID"), middleware.BrandActor(c), c.Param("invitationId")); err != nil {
+		writeMemberError(c, err, "Failed to revoke invitation")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
+
+// GetAuditLog lists who did what within the brand, newest first. actorId,
+// action, from and to (YYYY-MM-DD) narrow the listing.
+func (bmh *BrandMemberHandler) GetAuditLog(c *gin.Context) {
+	filter := services.BrandAuditFilter{
+		ActorID: c.Query("actorId"),
+		Action:  c.Query("action"),
+		Limit:   50,
+	}
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		filter.Limit = parsed
+	}
+	if filter.Limit > 200 {
+		filter.Limit = 200
+	}
+	if value := c.Query("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+		filter.Offset = parsed
+	}
+	if from := c.Query("from"); from != "" {
+		parsed, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+			return
+		}
+		filter.From = parsed
+	}
+	if to := c.Query("to"); to != "" {
+		parsed, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+			return
+		}
+		filter.To = parsed.AddDate(0, 0, 1)
+	}
+
+	entries, err := bmh.auditService.List(c.GetString("brandID"), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "limit": filter.Limit, "offset": filter.Offset})
+}
+
+// startSession issues a token pair for a brand member and records the login
+// in the brand audit log
+func (bmh *BrandMemberHandler) startSession(c *gin.Context, user *services.BrandUser, auditAction string) {
+	pair, err := bmh.tokens.Issue(auth.Principal{
+		Type:    auth.PrincipalBrandMember,
+		ID:      user.ID,
+		BrandID: user.BrandID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	if auditAction != "" {
+		actor := services.BrandActor{
+			Type:      string(auth.PrincipalBrandMember),
+			ID:        user.ID,
+			Role:      user.Role,
+			IPAddress: c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		}
+		if err := bmh.auditService.Record(user.BrandID, actor, auditAction, "", "", nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, BrandLoginResponse{TokenPair: pair, User: user})
+}
+
+func writeMemberError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrMemberNotFound), errors.Is(err, services.ErrInvitationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidBrandRole), errors.Is(err, services.ErrInvalidMember):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOwnerRequired):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrLastOwner), errors.Is(err, services.ErrAlreadyBrandMember),
+		errors.Is(err, services.ErrInvalidInvitation):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrBrandNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Brand not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
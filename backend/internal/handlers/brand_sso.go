@@ -0,0 +1,166 @@
+/**
+ * Brand SSO Handlers
+ * HTTP handlers for brand single sign-on and the SSO domains admins assign to brands
+ */
+
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"lynkr/internal/middleware"
+	"lynkr/internal/services"
+	"lynkr/pkg/oidc"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BrandSSOHandler struct {
+	ssoService    *services.BrandSSOService
+	memberHandler *BrandMemberHandler
+}
+
+func NewBrandSSOHandler(ssoService *services.BrandSSOService, memberHandler *BrandMemberHandler) *BrandSSOHandler {
+	return &BrandSSOHandler{ssoService: ssoService, memberHandler: memberHandler}
+}
+
+// GetSSOConfig tells the brand portal whether to offer single sign-on
+func (bsh *BrandSSOHandler) GetSSOConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"enabled": bsh.ssoService.Enabled()})
+}
+
+// StartSSO sends the browser to the identity provider. brandId optionally
+// picks the brand to log in to and redirect the portal page to return to.
+func (bsh *BrandSSOHandler) StartSSO(c *gin.Context) {
+	authURL, err := bsh.ssoService.StartLogin(c.Request.Context(), c.Query("brandId"), c.Query("redirect"))
+	if errors.Is(err, services.ErrSSODisabled) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to start single sign-on: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to reach the identity provider"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// SSOCallback receives the browser back from the identity provider and
+// sends it on to the brand portal with a login code, or an error to show
+func (bsh *BrandSSOHandler) SSOCallback(c *gin.Context) {
+	if providerError := c.Query("error"); providerError != "" {
+		message := c.Query("error_description")
+		if message == "" {
+			message = providerError
+		}
+		c.Redirect(http.StatusFound, bsh.ssoService.ErrorURL("The identity provider refused the sign-in: "+message))
+		return
+	}
+
+	portalURL, err := bsh.ssoService.CompleteLogin(c.Request.Context(), c.Query("state"), c.Query("code"))
+	if err != nil {
+		var message string
+		switch {
+		case errors.Is(err, services.ErrInvalidSSORequest), errors.Is(err, services.ErrSSOEmailRequired):
+			message = err.Error()
+		case errors.Is(err, services.ErrNotBrandMember):
+			message = "Your account is not a member of any brand yet"
+		case errors.Is(err, services.ErrSSODisabled):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		default:
+			if !errors.Is(err, oidc.ErrExchange) && !errors.Is(err, oidc.ErrInvalidIDToken) {
+				log.Printf("Failed to complete single sign-on: %v", err)
+			}
+			message = "Single sign-on failed, please try again"
+		}
+		c.Redirect(http.StatusFound, bsh.ssoService.ErrorURL(message))
+		return
+	}
+
+	c.Redirect(http.StatusFound, portalURL)
+}
+
+// ExchangeSSOCode logs in the member a login code from the callback belongs to
+func (bsh *BrandSSOHandler) ExchangeSSOCode(c *gin.Context) {
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, err := bsh.ssoService.RedeemLogin(request.Code)
+	switch {
+	case errors.Is(err, services.ErrInvalidSSOCode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrNotBrandMember):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this brand"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+
+	bsh.memberHandler.startSession(c, user, "member.sso_login")
+}
+
+// ListSSODomains returns the email domains claimed by a brand
+func (bsh *BrandSSOHandler) ListSSODomains(c *gin.Context) {
+	domains, err := bsh.ssoService.ListSSODomains(c.Param("brandId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list SSO domains"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"domains": domains})
+}
+
+// SetSSODomain claims an email domain for a brand with the role its users join as
+func (bsh *BrandSSOHandler) SetSSODomain(c *gin.Context) {
+	var request struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A role is required"})
+		return
+	}
+
+	domain, err := bsh.ssoService.SetSSODomain(middleware.AdminActor(c), c.Param("brandId"), c.Param("domain"), request.Role)
+	if err != nil {
+		writeSSODomainError(c, err, "Failed to set SSO domain")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, domain)
+}
+
+// RemoveSSODomain releases a brand's claim on an email domain
+func (bsh *BrandSSOHandler) RemoveSSODomain(c *gin.Context) {
+	if err := bsh.ssoService.RemoveSSODomain(middleware.AdminActor(c), c.Param("brandId"), c.Param("domain")); err != nil {
+		writeSSODomainError(c, err, "Failed to remove SSO domain")
+		return
+	}
+
+	middleware.MarkAudited(c)
+	c.JSON(http.StatusOK, gin.H{"message": "SSO domain removed"})
+}
+
+func writeSSODomainError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSSODomain):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSSODomainNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrBrandNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Brand not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,68 @@
+/**
+ * Currency Handlers
+ * HTTP handlers for exchange rates and a brand's reporting currency
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"lynkr/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CurrencyHandler struct {
+	currencyService *services.CurrencyService
+}
+
+func NewCurrencyHandler(currencyService *services.CurrencyService) *CurrencyHandler {
+	return &CurrencyHandler{currencyService: currencyService}
+}
+
+// GetExchangeRates returns the exchange rates analytics convert with
+func (ch *CurrencyHandler) GetExchangeRates(c *gin.Context) {
+	rates, err := ch.currencyService.GetExchangeRates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get exchange rates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rates)
+}
+
+// GetReportingCurrency returns the currency the brand's analytics are reported in
+func (ch *CurrencyHandler) GetReportingCurrency(c *gin.Context) {
+	currency, err := ch.currencyService.GetReportingCurrency(c.GetString("brandID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get reporting currency"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"currency": currency})
+}
+
+// SetReportingCurrency changes the currency the brand's analytics are reported in
+func (ch *CurrencyHandler) SetReportingCurrency(c *gin.Context) {
+	var request struct {
+		Currency string `json:"currency" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	currency, err := ch.currencyService.SetReportingCurrency(c.GetString("brandID"), request.Currency)
+	switch {
+	case errors.Is(err, services.ErrInvalidCurrency):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrBrandNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Brand not found"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set reporting currency"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"currency": currency})
+	}
+}
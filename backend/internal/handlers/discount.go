@@ -6,6 +6,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
@@ -76,9 +77,10 @@ func (dh *DiscountHandler) RedeemCode(c *gin.Context) {
 	}
 
 	var request struct {
-		Code    string  `json:"code"`
-		OrderID string  `json:"orderId"`
-		Amount  float64 `json:"amount"`
+		Code     string  `json:"code"`
+		OrderID  string  `json:"orderId"`
+		Amount   float64 `json:"amount"`
+		Currency string  `json:"currency"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -95,8 +97,12 @@ func (dh *DiscountHandler) RedeemCode(c *gin.Context) {
 
 	// Redeem code
 	redemption, err := dh.discountService.RedeemCode(
-		discountCode.ID, userID, request.OrderID, request.Amount,
+		discountCode.ID, userID, request.OrderID, request.Amount, request.Currency,
 	)
+	if errors.Is(err, services.ErrInvalidCurrency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem code"})
 		return
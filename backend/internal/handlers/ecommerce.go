@@ -6,7 +6,10 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 
 	"lynkr/internal/services"
 
@@ -33,6 +36,7 @@ func (eh *EcommerceHandler) CreateIntegration(c *gin.Context) {
 	var request struct {
 		PlatformType string `json:"platformType"`
 		APIKey       string `json:"apiKey"`
+		APISecret    string `json:"apiSecret"`
 		StoreURL     string `json:"storeUrl"`
 	}
 
@@ -42,7 +46,7 @@ func (eh *EcommerceHandler) CreateIntegration(c *gin.Context) {
 	}
 
 	integration, err := eh.ecommerceService.CreateIntegration(
-		brandID, request.PlatformType, request.APIKey, request.StoreURL,
+		brandID, request.PlatformType, request.APIKey, request.APISecret, request.StoreURL,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create integration"})
@@ -69,8 +73,8 @@ func (eh *EcommerceHandler) GetIntegration(c *gin.Context) {
 }
 
 func (eh *EcommerceHandler) TrackPurchase(c *gin.Context) {
-	userID := c.GetString("id")
-	if userID == "" {
+	userID, ok := currentUserID(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
@@ -79,16 +83,25 @@ func (eh *EcommerceHandler) TrackPurchase(c *gin.Context) {
 		ProductID string  `json:"productId"`
 		EventID   string  `json:"eventId"`
 		Amount    float64 `json:"amount"`
+		Currency  string  `json:"currency"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
+	if request.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be positive"})
+		return
+	}
 
 	purchase, err := eh.ecommerceService.TrackPurchase(
-		userID, request.ProductID, request.EventID, request.Amount,
+		userID, request.ProductID, request.EventID, request.Amount, request.Currency,
 	)
+	if errors.Is(err, services.ErrInvalidCurrency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to track purchase"})
 		return
@@ -110,7 +123,7 @@ func (eh *EcommerceHandler) GetPurchaseAnalytics(c *gin.Context) {
 }
 
 func (eh *EcommerceHandler) GetTopProducts(c *gin.Context) {
-	eventID := c.GetString("brandID")
+	eventID := c.Param("id")
 
 	products, err := eh.ecommerceService.GetTopProducts(eventID, 10)
 	if err != nil {
@@ -121,29 +134,113 @@ func (eh *EcommerceHandler) GetTopProducts(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"products": products})
 }
 
-func (eh *EcommerceHandler) HandleWebhook(c *gin.Context) {
-	integrationID := c.Param("integrationId")
-	if integrationID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Integration ID required"})
+// RefundPurchase records a refund the brand issued outside its connected
+// store. Without an amount the rest of the purchase is refunded.
+func (eh *EcommerceHandler) RefundPurchase(c *gin.Context) {
+	var request struct {
+		Amount float64 `json:"amount"`
+		Reason string  `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
 
-	var payload map[string]interface{}
-	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook payload"})
+	purchase, err := eh.ecommerceService.RefundPurchase(c.GetString("brandID"), c.Param("purchaseId"), request.Amount, request.Reason)
+	switch {
+	case errors.Is(err, services.ErrPurchaseNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase not found"})
+	case errors.Is(err, services.ErrInvalidRefund):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refund purchase"})
+	default:
+		c.JSON(http.StatusOK, purchase)
+	}
+}
+
+// ListCatalogProducts browses the brand's synced catalog. q searches names,
+// descriptions and store product IDs; includeDeleted=true adds products
+// removed from the store.
+func (eh *EcommerceHandler) ListCatalogProducts(c *gin.Context) {
+	limit, offset := 50, 0
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = parsed
+	}
+	if limit > 200 {
+		limit = 200
+	}
+	if value := c.Query("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+		offset = parsed
+	}
+
+	products, err := eh.ecommerceService.ListCatalog(c.GetString("brandID"), services.CatalogFilter{
+		Query:          c.Query("q"),
+		IncludeDeleted: c.Query("includeDeleted") == "true",
+		Limit:          limit,
+		Offset:         offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list products"})
 		return
 	}
 
-	eventType, ok := payload["event"].(string)
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event type"})
+	c.JSON(http.StatusOK, gin.H{"products": products, "limit": limit, "offset": offset})
+}
+
+// GetCatalogProduct returns one synced product with its price history
+func (eh *EcommerceHandler) GetCatalogProduct(c *gin.Context) {
+	product, err := eh.ecommerceService.GetCatalogProduct(c.GetString("brandID"), c.Param("productId"))
+	if errors.Is(err, services.ErrProductNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get product"})
 		return
 	}
 
-	switch eventType {
-	case "order.created", "order.completed":
-		c.JSON(http.StatusOK, gin.H{"status": "processed"})
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event type"})
+	c.JSON(http.StatusOK, product)
+}
+
+// HandleWebhook receives order webhooks from a connected store. The request
+// is authenticated by the store's signature, not a Lynkr token. Webhooks are
+// stored and acknowledged right away and processed in the background.
+func (eh *EcommerceHandler) HandleWebhook(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook payload"})
+		return
 	}
+
+	receipt, err := eh.ecommerceService.HandleWebhook(c.Param("integrationId"), services.EcommerceWebhookRequest{
+		Header: c.Request.Header,
+		Body:   body,
+	})
+	switch {
+	case errors.Is(err, services.ErrIntegrationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Integration not found"})
+		return
+	case errors.Is(err, services.ErrEcommerceWebhookUnauthorized):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook signature"})
+		return
+	case errors.Is(err, services.ErrInvalidEcommerceWebhook):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook payload"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, receipt)
 }
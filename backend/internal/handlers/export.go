@@ -6,7 +6,13 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"lynkr/internal/services"
 
@@ -32,10 +38,17 @@ func (eh *ExportHandler) CreateExportRequest(c *gin.Context) {
 		return
 	}
 
+	// eventId and dataType are the single-value forms the portal still sends
 	var request struct {
-		EventID  string `json:"eventId"`
-		DataType string `json:"dataType"`
-		Format   string `json:"format"`
+		EventID    string              `json:"eventId"`
+		EventIDs   []string            `json:"eventIds"`
+		CampaignID int64               `json:"campaignId"`
+		DataType   string              `json:"dataType"`
+		DataTypes  []string            `json:"dataTypes"`
+		Format     string              `json:"format"`
+		From       string              `json:"from"`
+		To         string              `json:"to"`
+		Fields     map[string][]string `json:"fields"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -43,8 +56,51 @@ func (eh *ExportHandler) CreateExportRequest(c *gin.Context) {
 		return
 	}
 
-	exportReq, err := eh.exportService.CreateExportRequest(brandID, request.EventID, request.DataType, request.Format)
-	if err != nil {
+	spec := services.ExportSpec{
+		DataTypes:  request.DataTypes,
+		EventIDs:   request.EventIDs,
+		CampaignID: request.CampaignID,
+		Fields:     request.Fields,
+		Format:     request.Format,
+	}
+	if request.DataType != "" {
+		spec.DataTypes = append([]string{request.DataType}, spec.DataTypes...)
+	}
+	if request.EventID != "" {
+		spec.EventIDs = append([]string{request.EventID}, spec.EventIDs...)
+	}
+
+	if request.From != "" {
+		from, err := time.Parse("2006-01-02", request.From)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+			return
+		}
+		spec.From = &from
+	}
+	if request.To != "" {
+		to, err := time.Parse("2006-01-02", request.To)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+			return
+		}
+		// Include the whole end day
+		to = to.AddDate(0, 0, 1)
+		spec.To = &to
+	}
+
+	exportReq, err := eh.exportService.CreateExportRequest(brandID, spec)
+	switch {
+	case errors.Is(err, services.ErrInvalidExport):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrEventNotOwnedByBrand):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrCampaignNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create export request"})
 		return
 	}
@@ -53,17 +109,58 @@ func (eh *ExportHandler) CreateExportRequest(c *gin.Context) {
 }
 
 func (eh *ExportHandler) GetExportStatus(c *gin.Context) {
+	brandID := c.GetString("brandID")
 	requestID := c.Param("requestId")
 
-	exportReq, err := eh.exportService.GetExportStatus(requestID)
-	if err != nil {
+	exportReq, err := eh.exportService.GetExportStatus(brandID, requestID)
+	if errors.Is(err, services.ErrExportNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Export request not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get export request"})
+		return
+	}
 
 	c.JSON(http.StatusOK, exportReq)
 }
 
+// DownloadExport streams an export file. The signed link is the authorization,
+// so this route sits outside the brand auth middleware.
+func (eh *ExportHandler) DownloadExport(c *gin.Context) {
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || c.Query("signature") == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid download link"})
+		return
+	}
+
+	exportReq, file, size, err := eh.exportService.OpenExportDownload(c.Request.Context(), c.Param("requestId"), expires, c.Query("signature"))
+	switch {
+	case errors.Is(err, services.ErrInvalidDownloadLink):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid download link"})
+		return
+	case errors.Is(err, services.ErrExportNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export request not found"})
+		return
+	case errors.Is(err, services.ErrExportNotReady):
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is not ready yet"})
+		return
+	case errors.Is(err, services.ErrExportExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "Export has expired"})
+		return
+	case err != nil:
+		log.Printf("Failed to open export %s: %v", c.Param("requestId"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download export"})
+		return
+	}
+	defer file.Close()
+
+	c.DataFromReader(http.StatusOK, size, exportReq.ContentType(), file, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, exportReq.FileName()),
+		"Cache-Control":       "private, no-store",
+	})
+}
+
 func (eh *ExportHandler) CreateCRMIntegration(c *gin.Context) {
 	brandID := c.GetString("brandID")
 	if brandID == "" {
@@ -72,11 +169,14 @@ func (eh *ExportHandler) CreateCRMIntegration(c *gin.Context) {
 	}
 
 	var request struct {
-		CRMType      string `json:"crmType"`
-		APIKey       string `json:"apiKey"`
-		APISecret    string `json:"apiSecret"`
-		WebhookURL   string `json:"webhookUrl"`
-		SyncInterval int    `json:"syncInterval"`
+		CRMType      string            `json:"crmType"`
+		APIKey       string            `json:"apiKey"`
+		APISecret    string            `json:"apiSecret"`
+		WebhookURL   string            `json:"webhookUrl"`
+		BaseURL      string            `json:"baseUrl"`
+		Settings     map[string]string `json:"settings"`
+		FieldMapping map[string]string `json:"fieldMapping"`
+		SyncInterval int               `json:"syncInterval"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -84,10 +184,20 @@ func (eh *ExportHandler) CreateCRMIntegration(c *gin.Context) {
 		return
 	}
 
-	integration, err := eh.crmIntegrationService.CreateIntegration(
-		brandID, request.CRMType, request.APIKey, request.APISecret,
-		request.WebhookURL, request.SyncInterval,
-	)
+	integration, err := eh.crmIntegrationService.CreateIntegration(brandID, services.CRMIntegrationInput{
+		CRMType:      request.CRMType,
+		APIKey:       request.APIKey,
+		APISecret:    request.APISecret,
+		WebhookURL:   request.WebhookURL,
+		BaseURL:      request.BaseURL,
+		Settings:     request.Settings,
+		FieldMapping: request.FieldMapping,
+		SyncInterval: request.SyncInterval,
+	})
+	if errors.Is(err, services.ErrInvalidCRMIntegration) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create CRM integration"})
 		return
@@ -99,30 +209,163 @@ func (eh *ExportHandler) CreateCRMIntegration(c *gin.Context) {
 	c.JSON(http.StatusOK, integration)
 }
 
+func (eh *ExportHandler) GetCRMIntegration(c *gin.Context) {
+	integration, err := eh.crmIntegrationService.GetIntegration(c.GetString("brandID"), c.Param("integrationId"))
+	if errors.Is(err, services.ErrCRMIntegrationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "CRM integration not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get CRM integration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, integration)
+}
+
+// UpdateCRMIntegration changes the API secret, base URL, connector settings or
+// field mapping of an integration; omitted fields are kept
+func (eh *ExportHandler) UpdateCRMIntegration(c *gin.Context) {
+	var request struct {
+		APISecret    *string           `json:"apiSecret"`
+		BaseURL      *string           `json:"baseUrl"`
+		Settings     map[string]string `json:"settings"`
+		FieldMapping map[string]string `json:"fieldMapping"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	integration, err := eh.crmIntegrationService.UpdateIntegration(c.GetString("brandID"), c.Param("integrationId"), services.CRMIntegrationUpdate{
+		APISecret:    request.APISecret,
+		BaseURL:      request.BaseURL,
+		Settings:     request.Settings,
+		FieldMapping: request.FieldMapping,
+	})
+	switch {
+	case errors.Is(err, services.ErrCRMIntegrationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "CRM integration not found"})
+		return
+	case errors.Is(err, services.ErrInvalidCRMIntegration):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update CRM integration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, integration)
+}
+
 func (eh *ExportHandler) SyncEventData(c *gin.Context) {
+	brandID := c.GetString("brandID")
 	integrationID := c.Param("integrationId")
 	eventID := c.Param("eventId")
 
-	err := eh.crmIntegrationService.SyncEventData(integrationID, eventID)
+	job, err := eh.crmIntegrationService.QueueEventSync(brandID, integrationID, eventID)
+	switch {
+	case errors.Is(err, services.ErrCRMIntegrationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "CRM integration not found"})
+		return
+	case errors.Is(err, services.ErrCRMEventNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue event data sync"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "queued", "jobId": job.ID})
+}
+
+// GetCRMSyncRuns lists an integration's recent syncs with their counts of
+// synced, unchanged and failed contacts
+func (eh *ExportHandler) GetCRMSyncRuns(c *gin.Context) {
+	limit := 50
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = parsed
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	runs, err := eh.crmIntegrationService.ListSyncRuns(c.GetString("brandID"), c.Param("integrationId"), limit)
+	if errors.Is(err, services.ErrCRMIntegrationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "CRM integration not found"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync event data"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list CRM syncs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"syncs": runs})
+}
+
+// HandleCRMWebhook receives unsubscribes and contact changes from a CRM. The
+// request is authenticated by the CRM's signature, not a Lynkr token.
+func (eh *ExportHandler) HandleCRMWebhook(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook payload"})
+		return
+	}
+
+	result, err := eh.crmIntegrationService.HandleWebhook(c.Param("integrationId"), services.CRMWebhookRequest{
+		Method:     c.Request.Method,
+		RequestURI: c.Request.URL.RequestURI(),
+		Header:     c.Request.Header,
+		Body:       body,
+	})
+	switch {
+	case errors.Is(err, services.ErrCRMIntegrationNotFound), errors.Is(err, services.ErrCRMWebhooksNotSupported):
+		c.JSON(http.StatusNotFound, gin.H{"error": "CRM webhook not found"})
+		return
+	case errors.Is(err, services.ErrCRMWebhookUnauthorized):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook signature"})
+		return
+	case errors.Is(err, services.ErrInvalidCRMWebhook):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook payload"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process webhook"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "synced"})
+	c.JSON(http.StatusOK, result)
+}
+
+// VerifyCRMWebhook answers the GET request Mailchimp sends to validate a
+// webhook URL before saving it
+func (eh *ExportHandler) VerifyCRMWebhook(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
 func (eh *ExportHandler) GetExportFormats(c *gin.Context) {
+	var formatList []map[string]string
+	for _, format := range eh.exportService.ExportFormats() {
+		formatList = append(formatList, map[string]string{
+			"id":          format.ID,
+			"name":        format.Name,
+			"description": format.Description,
+		})
+	}
+
 	formats := gin.H{
-		"formats": []map[string]string{
-			{"id": "csv", "name": "CSV", "description": "Comma-separated values"},
-			{"id": "json", "name": "JSON", "description": "JavaScript Object Notation"},
-		},
+		"formats": formatList,
 		"dataTypes": []map[string]string{
 			{"id": "attendance", "name": "Attendance Data", "description": "Event attendance records"},
 			{"id": "content", "name": "Content Data", "description": "User-generated content"},
 			{"id": "analytics", "name": "Analytics Data", "description": "Event analytics and metrics"},
 			{"id": "feedback", "name": "Feedback Data", "description": "Polls and survey responses"},
+			{"id": "all", "name": "All Data", "description": "Every data type, bundled in a zip archive"},
 		},
 	}
 
@@ -130,13 +373,8 @@ func (eh *ExportHandler) GetExportFormats(c *gin.Context) {
 }
 
 func (eh *ExportHandler) GetCRMTypes(c *gin.Context) {
-	crmTypes := gin.H{
-		"crmTypes": []map[string]string{
-			{"id": "salesforce", "name": "Salesforce", "description": "Salesforce CRM integration"},
-			{"id": "hubspot", "name": "HubSpot", "description": "HubSpot CRM integration"},
-			{"id": "mailchimp", "name": "Mailchimp", "description": "Mailchimp email marketing integration"},
-		},
-	}
-
-	c.JSON(http.StatusOK, crmTypes)
+	c.JSON(http.StatusOK, gin.H{
+		"crmTypes":   eh.crmIntegrationService.CRMTypes(),
+		"attributes": eh.crmIntegrationService.CRMAttributes(),
+	})
 }
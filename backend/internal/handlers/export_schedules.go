@@ -0,0 +1,189 @@
+/**
+ * Export Schedule Handlers
+ * HTTP handlers for recurring exports and their run history
+ */
+
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"lynkr/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportScheduleRequest is the body of schedule create and update requests
+type exportScheduleRequest struct {
+	Name        string                  `json:"name"`
+	Cron        string                  `json:"cron"`
+	DataType    string                  `json:"dataType"`
+	DataTypes   []string                `json:"dataTypes"`
+	Format      string                  `json:"format"`
+	EventIDs    []string                `json:"eventIds"`
+	CampaignID  int64                   `json:"campaignId"`
+	Fields      map[string][]string     `json:"fields"`
+	Incremental bool                    `json:"incremental"`
+	Delivery    services.ExportDelivery `json:"delivery"`
+}
+
+func (r exportScheduleRequest) input() services.ExportScheduleInput {
+	spec := services.ExportSpec{
+		DataTypes:  r.DataTypes,
+		EventIDs:   r.EventIDs,
+		CampaignID: r.CampaignID,
+		Fields:     r.Fields,
+		Format:     r.Format,
+	}
+	if r.DataType != "" {
+		spec.DataTypes = append([]string{r.DataType}, spec.DataTypes...)
+	}
+
+	return services.ExportScheduleInput{
+		Name:        r.Name,
+		Cron:        r.Cron,
+		Spec:        spec,
+		Incremental: r.Incremental,
+		Delivery:    r.Delivery,
+	}
+}
+
+func (eh *ExportHandler) ListExportSchedules(c *gin.Context) {
+	schedules, err := eh.exportService.ListExportSchedules(c.GetString("brandID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get export schedules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+}
+
+func (eh *ExportHandler) CreateExportSchedule(c *gin.Context) {
+	brandID := c.GetString("brandID")
+	if brandID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Brand ID required"})
+		return
+	}
+
+	var request exportScheduleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	schedule, err := eh.exportService.CreateExportSchedule(brandID, request.input())
+	if err != nil {
+		writeExportScheduleError(c, err, "Failed to create export schedule")
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+func (eh *ExportHandler) GetExportSchedule(c *gin.Context) {
+	schedule, err := eh.exportService.GetExportSchedule(c.GetString("brandID"), c.Param("scheduleId"))
+	if err != nil {
+		writeExportScheduleError(c, err, "Failed to get export schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+func (eh *ExportHandler) UpdateExportSchedule(c *gin.Context) {
+	var request exportScheduleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	schedule, err := eh.exportService.UpdateExportSchedule(c.GetString("brandID"), c.Param("scheduleId"), request.input())
+	if err != nil {
+		writeExportScheduleError(c, err, "Failed to update export schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+func (eh *ExportHandler) DeleteExportSchedule(c *gin.Context) {
+	err := eh.exportService.DeleteExportSchedule(c.GetString("brandID"), c.Param("scheduleId"))
+	if err != nil {
+		writeExportScheduleError(c, err, "Failed to delete export schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+func (eh *ExportHandler) PauseExportSchedule(c *gin.Context) {
+	eh.setExportScheduleStatus(c, "paused")
+}
+
+func (eh *ExportHandler) ResumeExportSchedule(c *gin.Context) {
+	eh.setExportScheduleStatus(c, "active")
+}
+
+func (eh *ExportHandler) setExportScheduleStatus(c *gin.Context, status string) {
+	schedule, err := eh.exportService.SetExportScheduleStatus(c.GetString("brandID"), c.Param("scheduleId"), status)
+	if err != nil {
+		writeExportScheduleError(c, err, "Failed to update export schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// RunExportSchedule starts a run right away; poll it like any other export
+func (eh *ExportHandler) RunExportSchedule(c *gin.Context) {
+	exportReq, err := eh.exportService.RunExportSchedule(c.GetString("brandID"), c.Param("scheduleId"))
+	if err != nil {
+		writeExportScheduleError(c, err, "Failed to run export schedule")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, exportReq)
+}
+
+func (eh *ExportHandler) ListExportScheduleRuns(c *gin.Context) {
+	limit := 50
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = parsed
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	runs, err := eh.exportService.ListExportScheduleRuns(c.GetString("brandID"), c.Param("scheduleId"), limit)
+	if err != nil {
+		writeExportScheduleError(c, err, "Failed to get export schedule runs")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+// writeExportScheduleError maps schedule errors to HTTP responses
+func writeExportScheduleError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrExportScheduleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export schedule not found"})
+	case errors.Is(err, services.ErrInvalidExport):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrEventNotOwnedByBrand):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCampaignNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"time"
 
+	"lynkr/internal/auth"
 	"lynkr/internal/middleware"
 	"lynkr/internal/services/content"
 	"lynkr/internal/services/event"
@@ -20,14 +21,16 @@ type Handler struct {
 	UserService    *user.UserService
 	EventService   *event.EventService
 	ContentService *content.ContentService
+	Tokens         *auth.TokenService
 }
 
 // NewHandler creates a new handler with the given services
-func NewHandler(userService *user.UserService, eventService *event.EventService, contentService *content.ContentService) *Handler {
+func NewHandler(userService *user.UserService, eventService *event.EventService, contentService *content.ContentService, tokens *auth.TokenService) *Handler {
 	return &Handler{
 		UserService:    userService,
 		EventService:   eventService,
 		ContentService: contentService,
+		Tokens:         tokens,
 	}
 }
 
@@ -46,7 +49,7 @@ func (h *Handler) RegisterRoutes(router *gin.Engine) {
 
 	// Protected routes
 	protected := v1.Group("/")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(h.Tokens))
 	{
 		protected.PUT("/users/consent", h.UpdateConsent)
 		protected.POST("/events", h.CreateEvent)
@@ -62,7 +65,7 @@ func (h *Handler) RegisterRoutes(router *gin.Engine) {
 
 	// Admin routes
 	admin := v1.Group("/admin")
-	admin.Use(middleware.AuthMiddleware(), middleware.RoleMiddleware("admin"))
+	admin.Use(middleware.AuthMiddleware(h.Tokens), middleware.RoleMiddleware("admin"))
 	{
 		admin.GET("/users", h.ListUsers)
 	}
@@ -121,16 +124,20 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
-	// Generate a JWT token
-	token, err := middleware.GenerateToken(user.ID, "user")
+	// Start a session with an access and a refresh token
+	pair, err := h.Tokens.Issue(auth.Principal{Type: auth.PrincipalUser, ID: strconv.FormatUint(uint64(user.ID), 10)})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user":  user,
+		"token":            pair.AccessToken,
+		"tokenType":        pair.TokenType,
+		"expiresIn":        pair.ExpiresIn,
+		"refreshToken":     pair.RefreshToken,
+		"refreshExpiresAt": pair.RefreshExpiresAt,
+		"user":             user,
 	})
 }
 
@@ -0,0 +1,99 @@
+/**
+ * Job Queue Handlers
+ * Admin HTTP handlers for inspecting, retrying and cancelling background jobs
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"lynkr/internal/jobs"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JobsHandler struct {
+	queue *jobs.Queue
+}
+
+func NewJobsHandler(queue *jobs.Queue) *JobsHandler {
+	return &JobsHandler{queue: queue}
+}
+
+// ListJobs returns jobs filtered by queue, type and status
+func (jh *JobsHandler) ListJobs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	list, err := jh.queue.List(jobs.ListFilter{
+		Queue:  c.Query("queue"),
+		Type:   c.Query("type"),
+		Status: c.Query("status"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list jobs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": list})
+}
+
+// GetJob returns a single job
+func (jh *JobsHandler) GetJob(c *gin.Context) {
+	job, err := jh.queue.Get(c.Param("id"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// GetJobStats returns job counts per queue and status
+func (jh *JobsHandler) GetJobStats(c *gin.Context) {
+	stats, err := jh.queue.Stats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get job stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"queues": stats})
+}
+
+// RetryJob re-queues a dead or cancelled job
+func (jh *JobsHandler) RetryJob(c *gin.Context) {
+	job, err := jh.queue.Retry(c.Param("id"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelJob cancels a pending or running job
+func (jh *JobsHandler) CancelJob(c *gin.Context) {
+	job, err := jh.queue.Cancel(c.Param("id"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func respondJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	case errors.Is(err, jobs.ErrInvalidJobState):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update job"})
+	}
+}
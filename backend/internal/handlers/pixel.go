@@ -65,8 +65,8 @@ func (ph *PixelHandler) TrackPixel(c *gin.Context) {
 }
 
 func (ph *PixelHandler) TrackSearch(c *gin.Context) {
-	userID := c.GetString("id")
-	if userID == "" {
+	userID, ok := currentUserID(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
@@ -0,0 +1,504 @@
+/**
+ * Job Queue
+ * SQLite-backed background job queue with retries, backoff and dead-lettering
+ */
+
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+	StatusCancelled = "cancelled"
+)
+
+const defaultMaxAttempts = 5
+
+var (
+	ErrJobNotFound     = errors.New("job not found")
+	ErrInvalidJobState = errors.New("job cannot be changed in its current state")
+	ErrUnknownJobType  = errors.New("unknown job type")
+)
+
+type Job struct {
+	ID          string          `json:"id"`
+	Queue       string          `json:"queue"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	LastError   string          `json:"lastError,omitempty"`
+	DedupeKey   string          `json:"dedupeKey,omitempty"`
+	RunAt       time.Time       `json:"runAt"`
+	StartedAt   *time.Time      `json:"startedAt,omitempty"`
+	CompletedAt *time.Time      `json:"completedAt,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+}
+
+// Decode unmarshals the job payload into v
+func (j *Job) Decode(v interface{}) error {
+	if err := json.Unmarshal(j.Payload, v); err != nil {
+		return Permanent(fmt.Errorf("invalid %s payload: %w", j.Type, err))
+	}
+	return nil
+}
+
+// LastAttempt reports whether a failure of the current run dead-letters the job
+func (j *Job) LastAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
+
+// Handler processes a job. Returning an error schedules a retry unless the
+// error is wrapped with Permanent or the job is on its last attempt.
+type Handler func(ctx context.Context, job *Job) error
+
+// CancelHook cleans up after a job that was cancelled, e.g. by marking the
+// work it stood for as abandoned. It runs whether or not the job had started.
+type CancelHook func(job *Job) error
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not worth retrying so the job is dead-lettered immediately
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// RetryAfter asks for the next attempt to wait at least delay, e.g. when an
+// API answered with a Retry-After header. The regular backoff still applies
+// when it is longer.
+func RetryAfter(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &retryAfterError{err: err, delay: delay}
+}
+
+// retryDelay returns the delay requested with RetryAfter, if any
+func retryDelay(err error) time.Duration {
+	var retryAfter *retryAfterError
+	if errors.As(err, &retryAfter) {
+		return retryAfter.delay
+	}
+	return 0
+}
+
+// WillRetry reports whether a job failing with err on its current attempt is retried
+func (j *Job) WillRetry(err error) bool {
+	return err != nil && !IsPermanent(err) && !j.LastAttempt()
+}
+
+// EnqueueOptions tune a single job. Zero values use the defaults.
+type EnqueueOptions struct {
+	RunAt       time.Time
+	MaxAttempts int
+	// DedupeKey keeps at most one pending job per key; enqueueing again
+	// returns the waiting job. A running job may queue its own follow-up.
+	DedupeKey string
+}
+
+type ListFilter struct {
+	Queue  string
+	Type   string
+	Status string
+	Limit  int
+	Offset int
+}
+
+type jobType struct {
+	queue   string
+	handler Handler
+}
+
+type Queue struct {
+	db           *sql.DB
+	pollInterval time.Duration
+	backoff      func(attempt int) time.Duration
+
+	mu          sync.Mutex
+	types       map[string]jobType
+	cancelHooks map[string]CancelHook
+	concurrency map[string]int
+	running     map[string]context.CancelFunc
+}
+
+func NewQueue(db *sql.DB, pollInterval time.Duration) *Queue {
+	return &Queue{
+		db:           db,
+		pollInterval: pollInterval,
+		backoff:      ExponentialBackoff(30*time.Second, time.Hour),
+		types:        make(map[string]jobType),
+		cancelHooks:  make(map[string]CancelHook),
+		concurrency:  make(map[string]int),
+		running:      make(map[string]context.CancelFunc),
+	}
+}
+
+// ExponentialBackoff doubles the delay after every failed attempt up to max
+func ExponentialBackoff(base, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		delay := base
+		for i := 1; i < attempt && delay < max; i++ {
+			delay *= 2
+		}
+		if delay > max {
+			delay = max
+		}
+		return delay
+	}
+}
+
+// SetConcurrency limits how many jobs of a queue run at the same time
+func (q *Queue) SetConcurrency(queue string, workers int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if workers < 1 {
+		workers = 1
+	}
+	q.concurrency[queue] = workers
+}
+
+// Register binds a job type to the queue that runs it and its handler.
+// Handlers must be registered before Run is called.
+func (q *Queue) Register(name, queue string, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.types[name] = jobType{queue: queue, handler: handler}
+	if _, ok := q.concurrency[queue]; !ok {
+		q.concurrency[queue] = 1
+	}
+}
+
+// OnCancel sets the hook run after a job of the given type is cancelled.
+// Hooks must be set before Run is called.
+func (q *Queue) OnCancel(name string, hook CancelHook) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.cancelHooks[name] = hook
+}
+
+// Enqueue stores a new job to be picked up by the queue workers
+func (q *Queue) Enqueue(name string, payload interface{}, opts EnqueueOptions) (*Job, error) {
+	q.mu.Lock()
+	registered, ok := q.types[name]
+	q.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJobType, name)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	if opts.DedupeKey != "" {
+		if existing, err := q.findActive(opts.DedupeKey); err == nil {
+			return existing, nil
+		}
+	}
+
+	now := time.Now().UTC()
+	runAt := opts.RunAt.UTC()
+	if opts.RunAt.IsZero() {
+		runAt = now
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	jobID, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		ID:          jobID,
+		Queue:       registered.queue,
+		Type:        name,
+		Payload:     data,
+		Status:      StatusPending,
+		MaxAttempts: maxAttempts,
+		DedupeKey:   opts.DedupeKey,
+		RunAt:       runAt,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	query := `
+		INSERT INTO jobs (id, queue, type, payload, status, attempts, max_attempts, dedupe_key, run_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?, ?, ?)
+	`
+
+	_, err = q.db.Exec(query, job.ID, job.Queue, job.Type, string(job.Payload), job.Status,
+		job.MaxAttempts, nullString(job.DedupeKey), job.RunAt, now, now)
+	if err != nil {
+		// Another enqueue with the same key won the race
+		if opts.DedupeKey != "" {
+			if existing, findErr := q.findActive(opts.DedupeKey); findErr == nil {
+				return existing, nil
+			}
+		}
+		return nil, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+
+	return job, nil
+}
+
+// Get returns a single job
+func (q *Queue) Get(jobID string) (*Job, error) {
+	row := q.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, jobID)
+	job, err := scanJob(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return job, nil
+}
+
+// List returns jobs matching the filter, newest first
+func (q *Queue) List(filter ListFilter) ([]Job, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.Queue != "" {
+		conditions = append(conditions, "queue = ?")
+		args = append(args, filter.Queue)
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+
+	query := `SELECT ` + jobColumns + ` FROM jobs`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	query += " ORDER BY created_at DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, filter.Offset)
+
+	rows, err := q.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// Retry puts a dead or cancelled job back on its queue with a fresh set of attempts.
+// A job whose dedupe key already has a pending job cannot be retried.
+func (q *Queue) Retry(jobID string) (*Job, error) {
+	now := time.Now().UTC()
+	result, err := q.db.Exec(`
+		UPDATE OR IGNORE jobs SET status = ?, attempts = 0, run_at = ?, completed_at = NULL, updated_at = ?
+		WHERE id = ? AND status IN (?, ?)
+	`, StatusPending, now, now, jobID, StatusDead, StatusCancelled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retry job: %w", err)
+	}
+
+	if err := q.checkTransition(result, jobID); err != nil {
+		return nil, err
+	}
+	return q.Get(jobID)
+}
+
+// Cancel stops a pending job from running, or signals a running job to stop,
+// and runs the cancel hook of its type
+func (q *Queue) Cancel(jobID string) (*Job, error) {
+	now := time.Now().UTC()
+	result, err := q.db.Exec(`
+		UPDATE jobs SET status = ?, completed_at = ?, updated_at = ?
+		WHERE id = ? AND status IN (?, ?)
+	`, StatusCancelled, now, now, jobID, StatusPending, StatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	if err := q.checkTransition(result, jobID); err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	if cancel, ok := q.running[jobID]; ok {
+		cancel()
+	}
+	q.mu.Unlock()
+
+	job, err := q.Get(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	hook := q.cancelHooks[job.Type]
+	q.mu.Unlock()
+	if hook != nil {
+		if err := hook(job); err != nil {
+			log.Printf("Cancel hook of job %s (%s) failed: %v", job.ID, job.Type, err)
+		}
+	}
+
+	return job, nil
+}
+
+// Stats returns job counts per queue and status
+func (q *Queue) Stats() (map[string]map[string]int, error) {
+	rows, err := q.db.Query(`SELECT queue, status, COUNT(*) FROM jobs GROUP BY queue, status`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make(map[string]map[string]int)
+	for rows.Next() {
+		var queue, status string
+		var count int
+		if err := rows.Scan(&queue, &status, &count); err != nil {
+			return nil, fmt.Errorf("failed to get job stats: %w", err)
+		}
+		if stats[queue] == nil {
+			stats[queue] = make(map[string]int)
+		}
+		stats[queue][status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get job stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+func (q *Queue) findActive(dedupeKey string) (*Job, error) {
+	row := q.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE dedupe_key = ? AND status = ?`,
+		dedupeKey, StatusPending)
+	return scanJob(row)
+}
+
+// checkTransition distinguishes a missing job from one in the wrong state
+func (q *Queue) checkTransition(result sql.Result, jobID string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+	if _, err := q.Get(jobID); err != nil {
+		return err
+	}
+	return ErrInvalidJobState
+}
+
+const jobColumns = `id, queue, type, payload, status, attempts, max_attempts, last_error, dedupe_key,
+	run_at, started_at, completed_at, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row rowScanner) (*Job, error) {
+	var job Job
+	var payload string
+	var lastError, dedupeKey sql.NullString
+	var startedAt, completedAt sql.NullTime
+
+	err := row.Scan(&job.ID, &job.Queue, &job.Type, &payload, &job.Status, &job.Attempts, &job.MaxAttempts,
+		&lastError, &dedupeKey, &job.RunAt, &startedAt, &completedAt, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Payload = json.RawMessage(payload)
+	job.LastError = lastError.String
+	job.DedupeKey = dedupeKey.String
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+
+	return &job, nil
+}
+
+// newJobID returns a random job ID, unique even for jobs enqueued at the same time
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return "job_" + hex.EncodeToString(b), nil
+}
+
+func nullString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
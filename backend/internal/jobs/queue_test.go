@@ -0,0 +1,255 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const testJobType = "test.job"
+
+// newTestQueue returns a queue on a temporary database with the jobs table,
+// with testJobType registered on the "default" queue to run handler
+func newTestQueue(t *testing.T, handler Handler) *Queue {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+
+	migration, err := os.ReadFile("../../../database/migrations/020_job_queue.sql")
+	if err != nil {
+		t.Fatalf("failed to read migration: %v", err)
+	}
+	if _, err := db.Exec(string(migration)); err != nil {
+		t.Fatalf("failed to apply migration: %v", err)
+	}
+
+	queue := NewQueue(db, 10*time.Millisecond)
+	if handler == nil {
+		handler = func(ctx context.Context, job *Job) error { return nil }
+	}
+	queue.Register(testJobType, "default", handler)
+	return queue
+}
+
+func mustEnqueue(t *testing.T, q *Queue, opts EnqueueOptions) *Job {
+	t.Helper()
+	job, err := q.Enqueue(testJobType, map[string]string{"id": "1"}, opts)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	return job
+}
+
+func mustGet(t *testing.T, q *Queue, jobID string) *Job {
+	t.Helper()
+	job, err := q.Get(jobID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	return job
+}
+
+func TestEnqueue(t *testing.T) {
+	q := newTestQueue(t, nil)
+	runAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	job := mustEnqueue(t, q, EnqueueOptions{RunAt: runAt, MaxAttempts: 3})
+	stored := mustGet(t, q, job.ID)
+	if stored.Queue != "default" || stored.Status != StatusPending || stored.Attempts != 0 || stored.MaxAttempts != 3 {
+		t.Errorf("job = %+v", stored)
+	}
+	if !stored.RunAt.Equal(runAt) || string(stored.Payload) != `{"id":"1"}` {
+		t.Errorf("run_at = %v, payload = %s", stored.RunAt, stored.Payload)
+	}
+
+	defaults := mustEnqueue(t, q, EnqueueOptions{})
+	if defaults.MaxAttempts != defaultMaxAttempts || time.Since(defaults.RunAt) > time.Minute {
+		t.Errorf("job = %+v, want the default attempts and to run now", defaults)
+	}
+
+	if _, err := q.Enqueue("unknown.job", nil, EnqueueOptions{}); !errors.Is(err, ErrUnknownJobType) {
+		t.Errorf("unknown type: err = %v, want ErrUnknownJobType", err)
+	}
+}
+
+func TestEnqueueConcurrentJobsGetUniqueIDs(t *testing.T) {
+	q := newTestQueue(t, nil)
+
+	const count = 50
+	ids := make(chan string, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			job, err := q.Enqueue(testJobType, nil, EnqueueOptions{})
+			if err != nil {
+				t.Errorf("Enqueue: %v", err)
+				return
+			}
+			ids <- job.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("job ID %s was issued twice", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != count {
+		t.Errorf("enqueued %d jobs, want %d", len(seen), count)
+	}
+}
+
+func TestEnqueueDedupe(t *testing.T) {
+	q := newTestQueue(t, nil)
+
+	first := mustEnqueue(t, q, EnqueueOptions{DedupeKey: "sync:1"})
+	again := mustEnqueue(t, q, EnqueueOptions{DedupeKey: "sync:1"})
+	if again.ID != first.ID {
+		t.Errorf("second enqueue created job %s, want the pending job %s", again.ID, first.ID)
+	}
+	other := mustEnqueue(t, q, EnqueueOptions{DedupeKey: "sync:2"})
+	if other.ID == first.ID {
+		t.Error("a different key returned the same job")
+	}
+
+	// Once the job runs, it may queue its own follow-up
+	if _, err := q.claim("default"); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	followUp := mustEnqueue(t, q, EnqueueOptions{DedupeKey: "sync:1"})
+	if followUp.ID == first.ID {
+		t.Error("follow-up of a running job was deduplicated against it")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	var cancelled []string
+	q := newTestQueue(t, nil)
+	q.OnCancel(testJobType, func(job *Job) error {
+		cancelled = append(cancelled, job.ID)
+		return nil
+	})
+
+	job := mustEnqueue(t, q, EnqueueOptions{})
+	got, err := q.Cancel(job.ID)
+	if err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if got.Status != StatusCancelled || got.CompletedAt == nil {
+		t.Errorf("job = %+v, want it cancelled", got)
+	}
+	if len(cancelled) != 1 || cancelled[0] != job.ID {
+		t.Errorf("cancel hook ran for %v, want %s", cancelled, job.ID)
+	}
+
+	if _, err := q.Cancel(job.ID); !errors.Is(err, ErrInvalidJobState) {
+		t.Errorf("cancelling twice: err = %v, want ErrInvalidJobState", err)
+	}
+	if _, err := q.Cancel("job_missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("missing job: err = %v, want ErrJobNotFound", err)
+	}
+	if len(cancelled) != 1 {
+		t.Errorf("cancel hook ran %d times, want once", len(cancelled))
+	}
+
+	// A failing hook doesn't undo the cancel
+	q.OnCancel(testJobType, func(job *Job) error { return errors.New("cleanup failed") })
+	job = mustEnqueue(t, q, EnqueueOptions{})
+	if got, err := q.Cancel(job.ID); err != nil || got.Status != StatusCancelled {
+		t.Errorf("Cancel with a failing hook = %v, %v", got, err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	q := newTestQueue(t, nil)
+
+	job := mustEnqueue(t, q, EnqueueOptions{DedupeKey: "sync:1"})
+	if _, err := q.Retry(job.ID); !errors.Is(err, ErrInvalidJobState) {
+		t.Errorf("retrying a pending job: err = %v, want ErrInvalidJobState", err)
+	}
+
+	if _, err := q.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	retried, err := q.Retry(job.ID)
+	if err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	if retried.Status != StatusPending || retried.Attempts != 0 || retried.CompletedAt != nil {
+		t.Errorf("job = %+v, want it pending with fresh attempts", retried)
+	}
+
+	// Another pending job took the key while this one was cancelled
+	if _, err := q.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	mustEnqueue(t, q, EnqueueOptions{DedupeKey: "sync:1"})
+	if _, err := q.Retry(job.ID); !errors.Is(err, ErrInvalidJobState) {
+		t.Errorf("retrying a superseded job: err = %v, want ErrInvalidJobState", err)
+	}
+}
+
+func TestListAndStats(t *testing.T) {
+	q := newTestQueue(t, nil)
+	q.Register("other.job", "other", func(ctx context.Context, job *Job) error { return nil })
+
+	for i := 0; i < 3; i++ {
+		mustEnqueue(t, q, EnqueueOptions{})
+	}
+	cancelled := mustEnqueue(t, q, EnqueueOptions{})
+	if _, err := q.Cancel(cancelled.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if _, err := q.Enqueue("other.job", nil, EnqueueOptions{}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   int
+	}{
+		{name: "all", filter: ListFilter{}, want: 5},
+		{name: "by queue", filter: ListFilter{Queue: "default"}, want: 4},
+		{name: "by type", filter: ListFilter{Type: "other.job"}, want: 1},
+		{name: "by status", filter: ListFilter{Status: StatusCancelled}, want: 1},
+		{name: "limited", filter: ListFilter{Limit: 2}, want: 2},
+		{name: "offset", filter: ListFilter{Offset: 4}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs, err := q.List(tt.filter)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(jobs) != tt.want {
+				t.Errorf("got %d jobs, want %d", len(jobs), tt.want)
+			}
+		})
+	}
+
+	stats, err := q.Stats()
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats["default"][StatusPending] != 3 || stats["default"][StatusCancelled] != 1 || stats["other"][StatusPending] != 1 {
+		t.Errorf("stats = %v", stats)
+	}
+}
@@ -0,0 +1,215 @@
+/**
+ * Job Workers
+ * Claims and runs queued jobs with a per-queue concurrency limit
+ */
+
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Run starts the workers for every registered queue and blocks until ctx is
+// cancelled. Jobs interrupted by cancellation go back to pending without
+// using up an attempt.
+func (q *Queue) Run(ctx context.Context) {
+	if err := q.recoverInterrupted(); err != nil {
+		log.Printf("Failed to recover interrupted jobs: %v", err)
+	}
+
+	q.mu.Lock()
+	concurrency := make(map[string]int, len(q.concurrency))
+	for queue, workers := range q.concurrency {
+		concurrency[queue] = workers
+	}
+	q.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for queue, workers := range concurrency {
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(queue string) {
+				defer wg.Done()
+				q.work(ctx, queue)
+			}(queue)
+		}
+		log.Printf("Started %d worker(s) for job queue %s", workers, queue)
+	}
+
+	wg.Wait()
+}
+
+// recoverInterrupted returns jobs left running by a previous process to the queue.
+// The queue assumes a single API process owns the database.
+func (q *Queue) recoverInterrupted() error {
+	return q.requeueRunning("")
+}
+
+// requeueRunning puts running jobs matching the condition back to pending
+// without counting the interrupted attempt. A job whose dedupe key already has
+// a pending successor is cancelled instead.
+func (q *Queue) requeueRunning(condition string, args ...interface{}) error {
+	now := time.Now().UTC()
+	where := "status = ?"
+	if condition != "" {
+		where += " AND " + condition
+	}
+
+	_, err := q.db.Exec(`
+		UPDATE OR IGNORE jobs SET status = ?, attempts = MAX(attempts - 1, 0), run_at = ?, updated_at = ?
+		WHERE `+where, append([]interface{}{StatusPending, now, now, StatusRunning}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.db.Exec(`
+		UPDATE jobs SET status = ?, last_error = ?, completed_at = ?, updated_at = ?
+		WHERE `+where,
+		append([]interface{}{StatusCancelled, "superseded by a pending job with the same dedupe key", now, now, StatusRunning}, args...)...)
+	return err
+}
+
+func (q *Queue) work(ctx context.Context, queue string) {
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		job, err := q.claim(queue)
+		if err != nil {
+			log.Printf("Failed to claim job from %s: %v", queue, err)
+		}
+		if job != nil {
+			q.execute(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim marks the next due job of the queue as running. Returns nil when the queue is empty.
+func (q *Queue) claim(queue string) (*Job, error) {
+	for {
+		now := time.Now().UTC()
+
+		var jobID string
+		err := q.db.QueryRow(`
+			SELECT id FROM jobs
+			WHERE queue = ? AND status = ? AND run_at <= ?
+			ORDER BY run_at
+			LIMIT 1
+		`, queue, StatusPending, now).Scan(&jobID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		result, err := q.db.Exec(`
+			UPDATE jobs SET status = ?, attempts = attempts + 1, started_at = ?, updated_at = ?
+			WHERE id = ? AND status = ?
+		`, StatusRunning, now, now, jobID, StatusPending)
+		if err != nil {
+			return nil, err
+		}
+
+		// Another worker claimed it first, try the next job
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			continue
+		}
+
+		return q.Get(jobID)
+	}
+}
+
+func (q *Queue) execute(ctx context.Context, job *Job) {
+	q.mu.Lock()
+	registered, ok := q.types[job.Type]
+	jobCtx, cancel := context.WithCancel(ctx)
+	q.running[job.ID] = cancel
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, job.ID)
+		q.mu.Unlock()
+		cancel()
+	}()
+
+	var err error
+	if !ok {
+		err = Permanent(fmt.Errorf("%w: %s", ErrUnknownJobType, job.Type))
+	} else {
+		err = q.safeCall(jobCtx, registered.handler, job)
+	}
+
+	now := time.Now().UTC()
+
+	switch {
+	case err == nil:
+		_, err = q.db.Exec(`
+			UPDATE jobs SET status = ?, last_error = NULL, completed_at = ?, updated_at = ?
+			WHERE id = ? AND status = ?
+		`, StatusSucceeded, now, now, job.ID, StatusRunning)
+
+	case ctx.Err() != nil:
+		// Shutting down: put the job back for the next start
+		err = q.requeueRunning("id = ?", job.ID)
+
+	case !job.WillRetry(err):
+		log.Printf("Job %s (%s) moved to dead letters after %d attempt(s): %v", job.ID, job.Type, job.Attempts, err)
+		_, err = q.db.Exec(`
+			UPDATE jobs SET status = ?, last_error = ?, completed_at = ?, updated_at = ?
+			WHERE id = ? AND status = ?
+		`, StatusDead, err.Error(), now, now, job.ID, StatusRunning)
+
+	default:
+		delay := q.backoff(job.Attempts)
+		if requested := retryDelay(err); requested > delay {
+			delay = requested
+		}
+		retryAt := now.Add(delay)
+		log.Printf("Job %s (%s) failed, retrying at %s: %v", job.ID, job.Type, retryAt.Format(time.RFC3339), err)
+		message := err.Error()
+		_, err = q.db.Exec(`
+			UPDATE OR IGNORE jobs SET status = ?, last_error = ?, run_at = ?, updated_at = ?
+			WHERE id = ? AND status = ?
+		`, StatusPending, message, retryAt, now, job.ID, StatusRunning)
+		if err == nil {
+			// A job that queued its own successor cannot be retried alongside it
+			_, err = q.db.Exec(`
+				UPDATE jobs SET status = ?, last_error = ?, completed_at = ?, updated_at = ?
+				WHERE id = ? AND status = ?
+			`, StatusCancelled, "superseded by a pending job with the same dedupe key: "+message, now, now, job.ID, StatusRunning)
+		}
+	}
+
+	if err != nil {
+		log.Printf("Failed to record result of job %s: %v", job.ID, err)
+	}
+}
+
+// safeCall turns a handler panic into a job failure instead of crashing the worker
+func (q *Queue) safeCall(ctx context.Context, handler Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
@@ -0,0 +1,194 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// runOnce claims the next job of the default queue and executes it with ctx
+func runOnce(t *testing.T, q *Queue, ctx context.Context) *Job {
+	t.Helper()
+	job, err := q.claim("default")
+	if err != nil || job == nil {
+		t.Fatalf("claim = %v, %v; want a job", job, err)
+	}
+	q.execute(ctx, job)
+	return mustGet(t, q, job.ID)
+}
+
+func TestExecuteOutcomes(t *testing.T) {
+	errFailed := errors.New("CRM unavailable")
+
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		err          error
+		panics       bool
+		wantStatus   string
+		wantError    string
+		wantRetryMin time.Duration // how far in the future a retry is scheduled
+	}{
+		{name: "success", wantStatus: StatusSucceeded},
+		{name: "failure is retried with backoff", err: errFailed, wantStatus: StatusPending, wantError: errFailed.Error(), wantRetryMin: time.Minute},
+		{name: "Retry-After beyond the backoff", err: RetryAfter(errFailed, time.Hour), wantStatus: StatusPending, wantError: errFailed.Error(), wantRetryMin: time.Hour},
+		{name: "Retry-After within the backoff", err: RetryAfter(errFailed, time.Second), wantStatus: StatusPending, wantError: errFailed.Error(), wantRetryMin: time.Minute},
+		{name: "permanent failure", err: Permanent(errFailed), wantStatus: StatusDead, wantError: errFailed.Error()},
+		{name: "last attempt", maxAttempts: 1, err: errFailed, wantStatus: StatusDead, wantError: errFailed.Error()},
+		{name: "panic", panics: true, wantStatus: StatusPending, wantError: "job panicked: boom", wantRetryMin: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQueue(t, func(ctx context.Context, job *Job) error {
+				if tt.panics {
+					panic("boom")
+				}
+				return tt.err
+			})
+			q.backoff = func(attempt int) time.Duration { return time.Duration(attempt) * time.Minute }
+			job := mustEnqueue(t, q, EnqueueOptions{MaxAttempts: tt.maxAttempts})
+
+			started := time.Now()
+			got := runOnce(t, q, context.Background())
+			if got.Status != tt.wantStatus || got.LastError != tt.wantError || got.Attempts != 1 {
+				t.Errorf("job = %s after %d attempt(s) with %q; want %s after 1 with %q",
+					got.Status, got.Attempts, got.LastError, tt.wantStatus, tt.wantError)
+			}
+			if tt.wantStatus == StatusPending {
+				if delay := got.RunAt.Sub(started); delay < tt.wantRetryMin || delay > tt.wantRetryMin+time.Minute {
+					t.Errorf("retry in %v, want %v", delay, tt.wantRetryMin)
+				}
+			} else if got.CompletedAt == nil {
+				t.Error("finished job has no completion time")
+			}
+			if next, _ := q.claim("default"); next != nil && tt.wantStatus == StatusPending {
+				t.Errorf("retry of job %s was claimed before it was due", job.ID)
+			}
+		})
+	}
+}
+
+func TestExecuteSupersededByFollowUp(t *testing.T) {
+	var q *Queue
+	q = newTestQueue(t, func(ctx context.Context, job *Job) error {
+		if _, err := q.Enqueue(testJobType, nil, EnqueueOptions{DedupeKey: "sync:1"}); err != nil {
+			return Permanent(err)
+		}
+		return errors.New("try again")
+	})
+	job := mustEnqueue(t, q, EnqueueOptions{DedupeKey: "sync:1"})
+
+	got := runOnce(t, q, context.Background())
+	if got.Status != StatusCancelled {
+		t.Errorf("job = %s, want it cancelled in favor of its follow-up", got.Status)
+	}
+	pending, err := q.List(ListFilter{Status: StatusPending})
+	if err != nil || len(pending) != 1 || pending[0].ID == job.ID {
+		t.Errorf("pending jobs = %v, %v; want only the follow-up", pending, err)
+	}
+}
+
+func TestInterruptedJobsKeepTheirAttempt(t *testing.T) {
+	ctx, shutdown := context.WithCancel(context.Background())
+	q := newTestQueue(t, func(jobCtx context.Context, job *Job) error {
+		shutdown()
+		<-jobCtx.Done()
+		return jobCtx.Err()
+	})
+	mustEnqueue(t, q, EnqueueOptions{MaxAttempts: 1})
+
+	got := runOnce(t, q, ctx)
+	if got.Status != StatusPending || got.Attempts != 0 {
+		t.Errorf("job = %s after %d attempt(s), want pending with none used", got.Status, got.Attempts)
+	}
+}
+
+func TestRecoverInterrupted(t *testing.T) {
+	q := newTestQueue(t, nil)
+
+	// Left running by a crashed process
+	crashed := mustEnqueue(t, q, EnqueueOptions{})
+	if _, err := q.claim("default"); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	// Left running while its follow-up was already queued
+	superseded := mustEnqueue(t, q, EnqueueOptions{DedupeKey: "sync:1"})
+	if _, err := q.claim("default"); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	followUp := mustEnqueue(t, q, EnqueueOptions{DedupeKey: "sync:1", RunAt: time.Now().Add(time.Hour)})
+
+	if err := q.recoverInterrupted(); err != nil {
+		t.Fatalf("recoverInterrupted: %v", err)
+	}
+
+	if got := mustGet(t, q, crashed.ID); got.Status != StatusPending || got.Attempts != 0 {
+		t.Errorf("crashed job = %s after %d attempt(s), want pending with none used", got.Status, got.Attempts)
+	}
+	if got := mustGet(t, q, superseded.ID); got.Status != StatusCancelled {
+		t.Errorf("superseded job = %s, want cancelled", got.Status)
+	}
+	if got := mustGet(t, q, followUp.ID); got.Status != StatusPending {
+		t.Errorf("follow-up = %s, want pending", got.Status)
+	}
+}
+
+func TestRunCancelsRunningJob(t *testing.T) {
+	started := make(chan string)
+	stopped := make(chan error, 1)
+	q := newTestQueue(t, func(ctx context.Context, job *Job) error {
+		started <- job.ID
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return ctx.Err()
+	})
+	hooked := make(chan string, 1)
+	q.OnCancel(testJobType, func(job *Job) error {
+		hooked <- job.Status
+		return nil
+	})
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		shutdown()
+		<-done
+	}()
+
+	job := mustEnqueue(t, q, EnqueueOptions{})
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not started")
+	}
+
+	if _, err := q.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("handler stopped with %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("running job was not signalled to stop")
+	}
+	if status := <-hooked; status != StatusCancelled {
+		t.Errorf("cancel hook saw status %s, want %s", status, StatusCancelled)
+	}
+
+	// The worker must not turn the cancelled job back into a retry
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if got := mustGet(t, q, job.ID); got.Status != StatusCancelled {
+			t.Fatalf("job = %s after the handler returned, want it to stay cancelled", got.Status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
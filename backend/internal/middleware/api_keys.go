@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"lynkr/internal/auth"
+	"lynkr/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BrandAuthMiddleware authenticates the brand routes with either an access
+// token, like AuthMiddleware, or a brand API key sent the same way as
+// "Bearer lynkr_...". API keys set their brand as "brandID" and their scopes
+// as "apiKeyScopes", which BrandPermissionMiddleware checks.
+func BrandAuthMiddleware(tokens *auth.TokenService, apiKeys *services.APIKeyService) gin.HandlerFunc {
+	authenticateToken := AuthMiddleware(tokens)
+	return func(c *gin.Context) {
+		key, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "+services.APIKeyPrefix)
+		if !ok {
+			authenticateToken(c)
+			return
+		}
+
+		apiKey, err := apiKeys.Authenticate(services.APIKeyPrefix+key, c.ClientIP())
+		if errors.Is(err, services.ErrAPIKeyRejected) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid, expired or revoked API key"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate API key"})
+			c.Abort()
+			return
+		}
+
+		principal := &auth.Principal{Type: auth.PrincipalAPIKey, ID: apiKey.ID, BrandID: apiKey.BrandID}
+		c.Set("principal", principal)
+		c.Set("brandID", apiKey.BrandID)
+		c.Set("apiKeyScopes", apiKey.Scopes)
+		c.Set("role", principal.Role())
+		c.Next()
+	}
+}
+
+// NoAPIKeyMiddleware keeps API keys off brand routes that are only meant for
+// people, such as switching brands
+func NoAPIKeyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if principal, ok := CurrentPrincipal(c); ok && principal.Type == auth.PrincipalAPIKey {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot use this route"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lynkr/internal/auth"
+	"lynkr/internal/services"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDB returns a database with the tables brand authentication needs
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "lynkr.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+
+	for _, name := range []string{"031_auth_tokens.sql", "032_brand_members.sql", "034_brand_api_keys.sql"} {
+		migration, err := os.ReadFile(filepath.Join("../../../database/migrations", name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if _, err := db.Exec(string(migration)); err != nil {
+			t.Fatalf("failed to apply %s: %v", name, err)
+		}
+	}
+	return db
+}
+
+// newBrandRouter serves GET /analytics and POST /campaigns the way the brand
+// routes are set up, along with GET /members for people only
+func newBrandRouter(t *testing.T, db *sql.DB) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	keys, err := auth.NewKeySet(map[string]string{"k1": "test-secret"}, "k1")
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	tokens := auth.NewTokenService(db, keys, auth.TokenOptions{})
+	apiKeys := services.NewAPIKeyService(db, services.APIKeyOptions{})
+
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"brandId": c.GetString("brandID")}) }
+	r := gin.New()
+	brandRoutes := r.Group("/")
+	brandRoutes.Use(BrandAuthMiddleware(tokens, apiKeys))
+	brandRoutes.Use(BrandOnlyMiddleware())
+	brandRoutes.GET("/analytics", BrandPermissionMiddleware(auth.PermAnalyticsRead), ok)
+	brandRoutes.POST("/campaigns", BrandPermissionMiddleware(auth.PermCampaignsWrite), ok)
+	brandRoutes.GET("/members", NoAPIKeyMiddleware(), ok)
+	return r
+}
+
+func TestBrandRoutesWithAPIKeys(t *testing.T) {
+	db := newTestDB(t)
+	router := newBrandRouter(t, db)
+	apiKeys := services.NewAPIKeyService(db, services.APIKeyOptions{})
+	actor := services.BrandActor{Type: string(auth.PrincipalBrandMember), ID: "member_1", Role: auth.BrandRoleOwner}
+
+	create := func(name string) (*services.APIKey, string) {
+		apiKey, key, err := apiKeys.CreateAPIKey("1", actor, services.APIKeyInput{Name: name, Scopes: []auth.Permission{auth.PermAnalyticsRead}})
+		if err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		return apiKey, key
+	}
+	_, key := create("active")
+	expired, expiredKey := create("expired")
+	if _, err := db.Exec(`UPDATE brand_api_keys SET expires_at = ? WHERE id = ?`, time.Now().Add(-time.Minute).UTC(), expired.ID); err != nil {
+		t.Fatalf("failed to expire key: %v", err)
+	}
+	revoked, revokedKey := create("revoked")
+	if err := apiKeys.RevokeAPIKey("1", actor, revoked.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		key        string
+		wantStatus int
+	}{
+		{name: "key within its scopes", method: http.MethodGet, path: "/analytics", key: key, wantStatus: http.StatusOK},
+		{name: "key outside its scopes", method: http.MethodPost, path: "/campaigns", key: key, wantStatus: http.StatusForbidden},
+		{name: "route for people only", method: http.MethodGet, path: "/members", key: key, wantStatus: http.StatusForbidden},
+		{name: "expired key", method: http.MethodGet, path: "/analytics", key: expiredKey, wantStatus: http.StatusUnauthorized},
+		{name: "revoked key", method: http.MethodGet, path: "/analytics", key: revokedKey, wantStatus: http.StatusUnauthorized},
+		{name: "unknown key", method: http.MethodGet, path: "/analytics", key: services.APIKeyPrefix + "unknown", wantStatus: http.StatusUnauthorized},
+		{name: "not a key or token", method: http.MethodGet, path: "/analytics", key: "garbage", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, w.Code, w.Body.String(), tt.wantStatus)
+			}
+		})
+	}
+}
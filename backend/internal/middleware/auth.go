@@ -2,51 +2,19 @@ package middleware
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
-	"time"
 
-	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-)
+	"lynkr/internal/auth"
 
-var (
-	// Secret key for JWT signing - in production, this should be loaded from environment variables
-	jwtSecret = []byte("brand-activations-secret-key")
+	"github.com/gin-gonic/gin"
 )
 
-// JWTClaims represents the claims in the JWT
-type JWTClaims struct {
-	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-type BrandClaims struct {
-	BrandID string `json:"brandId"`
-	UserID  string `json:"userId"`
-	Role    string `json:"role"`
-	jwt.RegisteredClaims
-}
-
-// GenerateToken generates a JWT token for a user
-func GenerateToken(userID uint, role string) (string, error) {
-	claims := JWTClaims{
-		UserID: userID,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
-}
-
-// AuthMiddleware validates JWT tokens
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware authenticates the access token of a request and sets its
+// principal in the context. User tokens also set "userID", and brand member
+// tokens and admins impersonating a brand "brandID", which the handlers read.
+func AuthMiddleware(tokens *auth.TokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -63,79 +31,65 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Parse and validate the token
-		token, err := jwt.ParseWithClaims(parts[1], &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
-			}
-			return jwtSecret, nil
-		})
-
-		if err != nil {
+		claims, err := tokens.Authenticate(parts[1])
+		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenRevoked) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
-
-		// Set the user claims in the context
-		if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-			fmt.Print(claims.UserID)
-			c.Set("userID", claims.UserID)
-			c.Set("role", claims.Role)
-			c.Next()
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			c.Abort()
-			return
-		}
-	}
-}
-
-func AuthMiddleware1() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate token"})
 			c.Abort()
 			return
 		}
 
-		// Extract the token from the header
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token}"})
-			c.Abort()
-			return
+		principal := claims.Principal()
+		switch principal.Type {
+		case auth.PrincipalUser:
+			userID, err := strconv.ParseUint(principal.ID, 10, 0)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+				c.Abort()
+				return
+			}
+			c.Set("userID", uint(userID))
+		case auth.PrincipalBrandMember:
+			c.Set("brandID", principal.BrandID)
+		case auth.PrincipalAdmin:
+			if principal.Impersonating() {
+				c.Set("brandID", principal.BrandID)
+			}
 		}
 
-		// Parse and validate the token
-		token, err := jwt.ParseWithClaims(parts[1], &BrandClaims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
-			}
-			return jwtSecret, nil
-		})
+		c.Set("principal", principal)
+		c.Set("tokenClaims", claims)
+		c.Set("role", principal.Role())
+		c.Next()
+	}
+}
 
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
-			return
-		}
+// CurrentPrincipal returns the principal authenticated by AuthMiddleware
+func CurrentPrincipal(c *gin.Context) (*auth.Principal, bool) {
+	value, exists := c.Get("principal")
+	if !exists {
+		return nil, false
+	}
+	principal, ok := value.(*auth.Principal)
+	return principal, ok
+}
 
-		// Set the user claims in the context
-		if claims, ok := token.Claims.(*BrandClaims); ok && token.Valid {
-			fmt.Print(claims.UserID)
-			c.Set("brandID", claims.BrandID)
-			c.Set("role", claims.Role)
-			c.Next()
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			c.Abort()
-			return
-		}
+// CurrentTokenClaims returns the claims of the access token authenticated by AuthMiddleware
+func CurrentTokenClaims(c *gin.Context) (*auth.Claims, bool) {
+	value, exists := c.Get("tokenClaims")
+	if !exists {
+		return nil, false
 	}
+	claims, ok := value.(*auth.Claims)
+	return claims, ok
 }
 
+// AdminOnlyMiddleware allows admins. Impersonation tokens only work on the
+// brand routes.
 func AdminOnlyMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role := c.GetString("role")
@@ -144,14 +98,24 @@ func AdminOnlyMiddleware() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		if principal, ok := CurrentPrincipal(c); ok && principal.Impersonating() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Impersonation tokens cannot be used for admin routes"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
 // RoleMiddleware checks if the user has the required role
 func RoleMiddleware(roles ...string) gin.HandlerFunc {
+	return contextRoleMiddleware("role", roles...)
+}
+
+// contextRoleMiddleware allows requests whose context value under key is one of roles
+func contextRoleMiddleware(key string, roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userRole, exists := c.Get("role")
+		userRole, exists := c.Get(key)
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User role not found"})
 			c.Abort()
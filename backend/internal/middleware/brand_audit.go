@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"lynkr/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditedKey marks requests whose handler already wrote a detailed audit entry
+const auditedKey = "audited"
+
+// MarkAudited tells BrandAuditMiddleware that the handler recorded the
+// request in the audit log itself
+func MarkAudited(c *gin.Context) {
+	c.Set(auditedKey, true)
+}
+
+// BrandAuditMiddleware records every successful change made through the
+// brand routes in the brand audit log, with the route as its action and the
+// route parameters as details. While an admin impersonates the brand, reads
+// are recorded as well.
+func BrandAuditMiddleware(audit *services.BrandAuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		principal, _ := CurrentPrincipal(c)
+		if !isWrite(c.Request.Method) && (principal == nil || !principal.Impersonating()) {
+			return
+		}
+		brandID := c.GetString("brandID")
+		if brandID == "" || c.Writer.Status() >= http.StatusBadRequest || c.GetBool(auditedKey) {
+			return
+		}
+
+		details := map[string]interface{}{"status": c.Writer.Status()}
+		targetID := ""
+		for _, param := range c.Params {
+			details[param.Key] = param.Value
+			if targetID == "" {
+				targetID = param.Value
+			}
+		}
+		action := c.Request.Method + " " + c.FullPath()
+		if err := audit.Record(brandID, BrandActor(c), action, "", targetID, details); err != nil {
+			log.Printf("Failed to audit %s for brand %s: %v", action, brandID, err)
+		}
+	}
+}
+
+func isWrite(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
@@ -1,8 +1,13 @@
 package middleware
 
 import (
-	"github.com/gin-gonic/gin"
+	"errors"
 	"net/http"
+
+	"lynkr/internal/auth"
+	"lynkr/internal/services"
+
+	"github.com/gin-gonic/gin"
 )
 
 func UserOnlyMiddleware() gin.HandlerFunc {
@@ -17,10 +22,11 @@ func UserOnlyMiddleware() gin.HandlerFunc {
 	}
 }
 
+// BrandOnlyMiddleware allows brand members and admins impersonating a brand
 func BrandOnlyMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role := c.GetString("role")
-		if role != "brand" && role != "admin" {
+		if role != "brand" && (role != "admin" || c.GetString("brandID") == "") {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Brand access required"})
 			c.Abort()
 			return
@@ -40,3 +46,71 @@ func UserOrBrandMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// BrandMemberMiddleware checks that a brand member still belongs to the brand
+// of their token and sets their "brandRole". Removing a member or changing
+// their role takes effect on their next request.
+func BrandMemberMiddleware(members *services.BrandMemberService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := CurrentPrincipal(c)
+		if !ok || principal.Type != auth.PrincipalBrandMember {
+			c.Next()
+			return
+		}
+
+		role, err := members.MemberRole(principal.BrandID, principal.ID)
+		if errors.Is(err, services.ErrNotBrandMember) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this brand"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check brand membership"})
+			c.Abort()
+			return
+		}
+
+		c.Set("brandRole", role)
+		c.Next()
+	}
+}
+
+// BrandPermissionMiddleware allows brand members whose role grants the
+// permission and API keys with the permission as a scope. Admins
+// impersonating the brand are always allowed.
+func BrandPermissionMiddleware(permission auth.Permission) gin.HandlerFunc {
+	check := contextRoleMiddleware("brandRole", auth.BrandRolesWith(permission)...)
+	return func(c *gin.Context) {
+		if c.GetString("role") == "admin" {
+			c.Next()
+			return
+		}
+		if value, ok := c.Get("apiKeyScopes"); ok {
+			scopes, _ := value.([]auth.Permission)
+			for _, scope := range scopes {
+				if scope == permission {
+					c.Next()
+					return
+				}
+			}
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key lacks the " + string(permission) + " scope"})
+			c.Abort()
+			return
+		}
+		check(c)
+	}
+}
+
+// BrandActor describes the caller of a brand route for the audit log
+func BrandActor(c *gin.Context) services.BrandActor {
+	actor := services.BrandActor{
+		Role:      c.GetString("brandRole"),
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if principal, ok := CurrentPrincipal(c); ok {
+		actor.Type = string(principal.Type)
+		actor.ID = principal.ID
+	}
+	return actor
+}
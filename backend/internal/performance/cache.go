@@ -6,6 +6,7 @@
 package performance
 
 import (
+	"context"
 	// "encoding/json"
 	"sync"
 	"time"
@@ -22,14 +23,9 @@ type Cache struct {
 }
 
 func NewCache() *Cache {
-	cache := &Cache{
+	return &Cache{
 		items: make(map[string]CacheItem),
 	}
-
-	// Start cleanup routine
-	go cache.cleanup()
-
-	return cache
 }
 
 func (c *Cache) Set(key string, value interface{}, ttl time.Duration) {
@@ -68,19 +64,30 @@ func (c *Cache) Clear() {
 	c.items = make(map[string]CacheItem)
 }
 
-func (c *Cache) cleanup() {
+// RunCleanup evicts expired items every five minutes until ctx is cancelled
+func (c *Cache) RunCleanup(ctx context.Context) {
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		c.mutex.Lock()
-		now := time.Now()
-		for key, item := range c.items {
-			if now.After(item.ExpiresAt) {
-				delete(c.items, key)
-			}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.cleanup()
+		}
+	}
+}
+
+func (c *Cache) cleanup() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for key, item := range c.items {
+		if now.After(item.ExpiresAt) {
+			delete(c.items, key)
 		}
-		c.mutex.Unlock()
 	}
 }
 
@@ -155,7 +155,7 @@ func (sa *SecurityAudit) LogSecurityEvent(eventType, userID, ipAddress, userAgen
 
 func (sa *SecurityAudit) GetSecurityEvents(limit int) ([]SecurityEvent, error) {
 	query := `
-		SELECT id, type, user_id, ip_address, user_agent, details, created_at
+		SELECT id, type, COALESCE(user_id, ''), COALESCE(ip_address, ''), COALESCE(user_agent, ''), COALESCE(details, ''), created_at
 		FROM security_events
 		ORDER BY created_at DESC
 		LIMIT ?
@@ -167,17 +167,17 @@ func (sa *SecurityAudit) GetSecurityEvents(limit int) ([]SecurityEvent, error) {
 	}
 	defer rows.Close()
 	
-	var events []SecurityEvent
+	events := []SecurityEvent{}
 	for rows.Next() {
 		var event SecurityEvent
 		err := rows.Scan(&event.ID, &event.Type, &event.UserID, &event.IPAddress, &event.UserAgent, &event.Details, &event.CreatedAt)
 		if err != nil {
-			continue
+			return nil, fmt.Errorf("failed to read security event: %w", err)
 		}
 		events = append(events, event)
 	}
 	
-	return events, nil
+	return events, rows.Err()
 }
 
 func (sa *SecurityAudit) storeVulnerability(vuln VulnerabilityReport) error {
@@ -0,0 +1,474 @@
+/**
+ * Admin Service
+ * Platform admin accounts, their login and TOTP second factor
+ */
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"lynkr/internal/auth"
+	"lynkr/pkg/secrets"
+)
+
+var (
+	ErrAdminNotFound      = errors.New("admin not found")
+	ErrAdminExists        = errors.New("an admin with this email already exists")
+	ErrInvalidAdmin       = errors.New("invalid admin details")
+	ErrAdminLocked        = errors.New("too many failed logins, try again later")
+	ErrTOTPRequired       = errors.New("a TOTP code is required")
+	ErrInvalidTOTPCode    = errors.New("invalid TOTP code")
+	ErrTOTPAlreadyEnabled = errors.New("TOTP is already enabled")
+	ErrTOTPNotSetUp       = errors.New("TOTP has not been set up")
+)
+
+// AdminAccount is a platform admin
+type AdminAccount struct {
+	ID          string     `json:"id"`
+	Email       string     `json:"email"`
+	Name        string     `json:"name"`
+	TOTPEnabled bool       `json:"totpEnabled"`
+	Disabled    bool       `json:"disabled"`
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// TOTPSetup is returned when an admin starts setting up TOTP. URI is the
+// otpauth:// link authenticator apps read from a QR code.
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// AdminOptions configures admin logins. After MaxFailedLogins failed
+// attempts in a row an account is locked for LockoutDuration.
+type AdminOptions struct {
+	TOTPIssuer      string
+	MaxFailedLogins int
+	LockoutDuration time.Duration
+}
+
+type AdminService struct {
+	db      *sql.DB
+	keyring *secrets.Keyring
+	options AdminOptions
+}
+
+func NewAdminService(db *sql.DB, keyring *secrets.Keyring, options AdminOptions) *AdminService {
+	if options.TOTPIssuer == "" {
+		options.TOTPIssuer = "Lynkr"
+	}
+	if options.MaxFailedLogins <= 0 {
+		options.MaxFailedLogins = 5
+	}
+	if options.LockoutDuration <= 0 {
+		options.LockoutDuration = 30 * time.Minute
+	}
+	return &AdminService{db: db, keyring: keyring, options: options}
+}
+
+const adminColumns = `id, email, name, totp_enabled_at IS NOT NULL, disabled_at IS NOT NULL, last_login_at, created_at`
+
+// CreateAdmin adds a platform admin
+func (as *AdminService) CreateAdmin(actor AdminActor, email, name, password string) (*AdminAccount, error) {
+	email, err := validateEmail(email)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid email address", ErrInvalidAdmin)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || len(password) < minPasswordLength {
+		return nil, fmt.Errorf("%w: a name and a password of at least %d characters are required", ErrInvalidAdmin, minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	tx, err := as.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create admin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM admin_accounts WHERE email = ?`, email).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to create admin: %w", err)
+	}
+	if exists > 0 {
+		return nil, ErrAdminExists
+	}
+
+	id := fmt.Sprintf("admin_%d", time.Now().UnixNano())
+	now := sqliteTime(time.Now())
+	_, err = tx.Exec(`
+		INSERT INTO admin_accounts (id, email, name, password_hash, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+	`, id, email, name, string(hash), now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create admin: %w", err)
+	}
+	if err := recordAdminAudit(tx, actor, "admin.created", "admin", id, map[string]interface{}{"email": email}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create admin: %w", err)
+	}
+	return as.GetAdmin(id)
+}
+
+// Authenticate checks an admin's password and, once TOTP is enabled, their
+// TOTP code. Without a code it returns ErrTOTPRequired, so clients can ask
+// for one. Failed attempts count towards locking the account.
+func (as *AdminService) Authenticate(email, password, code string) (*AdminAccount, error) {
+	var id, passwordHash string
+	var totpSecret sql.NullString
+	var totpEnabled, disabled bool
+	var totpLastStep sql.NullInt64
+	var lockedUntil sql.NullTime
+	err := as.db.QueryRow(`
+		SELECT id, password_hash, totp_secret, totp_enabled_at IS NOT NULL, totp_last_step, locked_until, disabled_at IS NOT NULL
+		FROM admin_accounts WHERE email = ?
+	`, normalizeEmail(email)).Scan(&id, &passwordHash, &totpSecret, &totpEnabled, &totpLastStep, &lockedUntil, &disabled)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate admin: %w", err)
+	}
+	if disabled {
+		return nil, ErrInvalidCredentials
+	}
+	if lockedUntil.Valid && time.Now().Before(lockedUntil.Time) {
+		return nil, ErrAdminLocked
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) != nil {
+		return nil, as.failLogin(id, ErrInvalidCredentials)
+	}
+
+	var step sql.NullInt64
+	if totpEnabled {
+		if code == "" {
+			return nil, ErrTOTPRequired
+		}
+		secret, err := as.keyring.Decrypt(totpSecret.String)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+		}
+		matched, ok := auth.VerifyTOTP(secret, code, time.Now(), totpLastStep.Int64)
+		if !ok {
+			return nil, as.failLogin(id, ErrInvalidTOTPCode)
+		}
+		step = sql.NullInt64{Int64: matched, Valid: true}
+	}
+
+	_, err = as.db.Exec(`
+		UPDATE admin_accounts
+		SET failed_login_count = 0, locked_until = NULL, last_login_at = ?, totp_last_step = COALESCE(?, totp_last_step)
+		WHERE id = ?
+	`, sqliteTime(time.Now()), step, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record login: %w", err)
+	}
+	return as.GetAdmin(id)
+}
+
+// failLogin counts a failed login and locks the account once there were too
+// many. It returns ErrAdminLocked when this attempt locked it, and reason
+// otherwise.
+func (as *AdminService) failLogin(id string, reason error) error {
+	var failed int
+	err := as.db.QueryRow(`
+		UPDATE admin_accounts SET failed_login_count = failed_login_count + 1 WHERE id = ?
+		RETURNING failed_login_count
+	`, id).Scan(&failed)
+	if err != nil {
+		return fmt.Errorf("failed to record failed login: %w", err)
+	}
+	if failed < as.options.MaxFailedLogins {
+		return reason
+	}
+
+	_, err = as.db.Exec(`UPDATE admin_accounts SET failed_login_count = 0, locked_until = ? WHERE id = ?`,
+		sqliteTime(time.Now().Add(as.options.LockoutDuration)), id)
+	if err != nil {
+		return fmt.Errorf("failed to lock admin: %w", err)
+	}
+	return ErrAdminLocked
+}
+
+// GetAdmin returns an admin account
+func (as *AdminService) GetAdmin(id string) (*AdminAccount, error) {
+	admin, err := scanAdmin(as.db.QueryRow(`SELECT `+adminColumns+` FROM admin_accounts WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrAdminNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get admin: %w", err)
+	}
+	return admin, nil
+}
+
+// GetAdminByEmail returns the admin account with an email address
+func (as *AdminService) GetAdminByEmail(email string) (*AdminAccount, error) {
+	admin, err := scanAdmin(as.db.QueryRow(`SELECT `+adminColumns+` FROM admin_accounts WHERE email = ?`, normalizeEmail(email)))
+	if err == sql.ErrNoRows {
+		return nil, ErrAdminNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get admin: %w", err)
+	}
+	return admin, nil
+}
+
+// ListAdmins returns every admin account
+func (as *AdminService) ListAdmins() ([]AdminAccount, error) {
+	rows, err := as.db.Query(`SELECT ` + adminColumns + ` FROM admin_accounts ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list admins: %w", err)
+	}
+	defer rows.Close()
+
+	admins := []AdminAccount{}
+	for rows.Next() {
+		admin, err := scanAdmin(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list admins: %w", err)
+		}
+		admins = append(admins, *admin)
+	}
+	return admins, rows.Err()
+}
+
+// SetAdminDisabled disables or re-enables an admin account. Admins cannot
+// disable themselves, so there is always someone left to undo it.
+func (as *AdminService) SetAdminDisabled(actor AdminActor, id string, disabled bool) (*AdminAccount, error) {
+	if disabled && actor.ID == id {
+		return nil, fmt.Errorf("%w: admins cannot disable themselves", ErrInvalidAdmin)
+	}
+
+	var disabledAt interface{}
+	action := "admin.enabled"
+	if disabled {
+		disabledAt = sqliteTime(time.Now())
+		action = "admin.disabled"
+	}
+	tx, err := as.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update admin: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE admin_accounts SET disabled_at = ?, updated_at = ? WHERE id = ?`, disabledAt, sqliteTime(time.Now()), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update admin: %w", err)
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return nil, ErrAdminNotFound
+	}
+	if err := recordAdminAudit(tx, actor, action, "admin", id, nil); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update admin: %w", err)
+	}
+	return as.GetAdmin(id)
+}
+
+// ChangePassword sets a new password after checking the current one
+func (as *AdminService) ChangePassword(actor AdminActor, currentPassword, newPassword string) error {
+	var passwordHash string
+	err := as.db.QueryRow(`SELECT password_hash FROM admin_accounts WHERE id = ?`, actor.ID).Scan(&passwordHash)
+	if err == sql.ErrNoRows {
+		return ErrAdminNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(currentPassword)) != nil {
+		return ErrInvalidCredentials
+	}
+	return as.setPassword(actor, actor.ID, newPassword)
+}
+
+// ResetPassword sets an admin's password without the current one, for the
+// command line
+func (as *AdminService) ResetPassword(actor AdminActor, id, password string) error {
+	return as.setPassword(actor, id, password)
+}
+
+func (as *AdminService) setPassword(actor AdminActor, id, password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("%w: passwords need at least %d characters", ErrInvalidAdmin, minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	tx, err := as.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE admin_accounts SET password_hash = ?, failed_login_count = 0, locked_until = NULL, updated_at = ? WHERE id = ?
+	`, string(hash), sqliteTime(time.Now()), id)
+	if err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrAdminNotFound
+	}
+	if err := recordAdminAudit(tx, actor, "admin.password_changed", "admin", id, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+	return nil
+}
+
+// SetupTOTP starts setting up TOTP for an admin with a new secret. TOTP is
+// enabled once EnableTOTP confirms a code generated from the secret.
+func (as *AdminService) SetupTOTP(id string) (*TOTPSetup, error) {
+	admin, err := as.GetAdmin(id)
+	if err != nil {
+		return nil, err
+	}
+	if admin.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := as.keyring.Encrypt(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt TOTP secret: %w", err)
+	}
+	_, err = as.db.Exec(`UPDATE admin_accounts SET totp_secret = ?, totp_last_step = NULL, updated_at = ? WHERE id = ?`,
+		encrypted, sqliteTime(time.Now()), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up TOTP: %w", err)
+	}
+
+	return &TOTPSetup{Secret: secret, URI: auth.TOTPURI(as.options.TOTPIssuer, admin.Email, secret)}, nil
+}
+
+// EnableTOTP enables TOTP for the acting admin once a code from the secret of
+// SetupTOTP checks out
+func (as *AdminService) EnableTOTP(actor AdminActor, code string) error {
+	var secret sql.NullString
+	var enabled bool
+	err := as.db.QueryRow(`SELECT totp_secret, totp_enabled_at IS NOT NULL FROM admin_accounts WHERE id = ?`, actor.ID).
+		Scan(&secret, &enabled)
+	if err == sql.ErrNoRows {
+		return ErrAdminNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	if enabled {
+		return ErrTOTPAlreadyEnabled
+	}
+	if !secret.Valid {
+		return ErrTOTPNotSetUp
+	}
+
+	plain, err := as.keyring.Decrypt(secret.String)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	step, ok := auth.VerifyTOTP(plain, code, time.Now(), 0)
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+
+	tx, err := as.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := sqliteTime(time.Now())
+	_, err = tx.Exec(`UPDATE admin_accounts SET totp_enabled_at = ?, totp_last_step = ?, updated_at = ? WHERE id = ?`,
+		now, step, now, actor.ID)
+	if err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	if err := recordAdminAudit(tx, actor, "admin.totp_enabled", "admin", actor.ID, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	return nil
+}
+
+// DisableTOTP turns TOTP off for an admin. Admins turning off their own
+// TOTP confirm with a current code; another admin or the command line can
+// reset it for an admin who lost their device.
+func (as *AdminService) DisableTOTP(actor AdminActor, id, code string) error {
+	var secret sql.NullString
+	var lastStep sql.NullInt64
+	err := as.db.QueryRow(`SELECT totp_secret, totp_last_step FROM admin_accounts WHERE id = ?`, id).Scan(&secret, &lastStep)
+	if err == sql.ErrNoRows {
+		return ErrAdminNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to disable TOTP: %w", err)
+	}
+	if !secret.Valid {
+		return ErrTOTPNotSetUp
+	}
+	if actor.ID == id {
+		plain, err := as.keyring.Decrypt(secret.String)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+		}
+		if _, ok := auth.VerifyTOTP(plain, code, time.Now(), lastStep.Int64); !ok {
+			return ErrInvalidTOTPCode
+		}
+	}
+
+	tx, err := as.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to disable TOTP: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE admin_accounts SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = ? WHERE id = ?
+	`, sqliteTime(time.Now()), id)
+	if err != nil {
+		return fmt.Errorf("failed to disable TOTP: %w", err)
+	}
+	if err := recordAdminAudit(tx, actor, "admin.totp_disabled", "admin", id, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to disable TOTP: %w", err)
+	}
+	return nil
+}
+
+func scanAdmin(row rowScanner) (*AdminAccount, error) {
+	var admin AdminAccount
+	var lastLoginAt sql.NullTime
+	if err := row.Scan(&admin.ID, &admin.Email, &admin.Name, &admin.TOTPEnabled, &admin.Disabled, &lastLoginAt, &admin.CreatedAt); err != nil {
+		return nil, err
+	}
+	if lastLoginAt.Valid {
+		admin.LastLoginAt = &lastLoginAt.Time
+	}
+	return &admin, nil
+}
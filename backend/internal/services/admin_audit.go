@@ -0,0 +1,155 @@
+/**
+ * Admin Audit Service
+ * Records what platform admins change and lists the admin audit log
+ */
+
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"lynkr/internal/auth"
+)
+
+// AdminActor is the admin making a change. ID is empty for changes made from
+// the command line.
+type AdminActor struct {
+	ID        string
+	IPAddress string
+	UserAgent string
+}
+
+// brandActor is the admin as seen in the audit log of a brand
+func (actor AdminActor) brandActor() BrandActor {
+	brandActor := BrandActor{Type: string(auth.PrincipalAdmin), ID: actor.ID, IPAddress: actor.IPAddress, UserAgent: actor.UserAgent}
+	if actor.ID == "" {
+		brandActor.Type = ActorSystem
+	}
+	return brandActor
+}
+
+// AdminAuditEntry is one recorded admin change
+type AdminAuditEntry struct {
+	ID         int64                  `json:"id"`
+	AdminID    string                 `json:"adminId,omitempty"`
+	AdminEmail string                 `json:"adminEmail,omitempty"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"targetType,omitempty"`
+	TargetID   string                 `json:"targetId,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	IPAddress  string                 `json:"ipAddress,omitempty"`
+	UserAgent  string                 `json:"userAgent,omitempty"`
+	CreatedAt  time.Time              `json:"createdAt"`
+}
+
+// AdminAuditFilter narrows an admin audit log listing
+type AdminAuditFilter struct {
+	AdminID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       time.Time
+	To         time.Time
+	Limit      int
+	Offset     int
+}
+
+type AdminAuditService struct {
+	db *sql.DB
+}
+
+func NewAdminAuditService(db *sql.DB) *AdminAuditService {
+	return &AdminAuditService{db: db}
+}
+
+// Record adds an entry to the admin audit log
+func (aas *AdminAuditService) Record(actor AdminActor, action, targetType, targetID string, details map[string]interface{}) error {
+	return recordAdminAudit(aas.db, actor, action, targetType, targetID, details)
+}
+
+// List returns the admin audit log, newest first
+func (aas *AdminAuditService) List(filter AdminAuditFilter) ([]AdminAuditEntry, error) {
+	query := `
+		SELECT l.id, COALESCE(l.admin_id, ''), COALESCE(a.email, ''), l.action,
+		       COALESCE(l.target_type, ''), COALESCE(l.target_id, ''), COALESCE(l.details, ''),
+		       COALESCE(l.ip_address, ''), COALESCE(l.user_agent, ''), l.created_at
+		FROM admin_audit_log l
+		LEFT JOIN admin_accounts a ON a.id = l.admin_id
+		WHERE 1 = 1
+	`
+	var args []interface{}
+	if filter.AdminID != "" {
+		query += ` AND l.admin_id = ?`
+		args = append(args, filter.AdminID)
+	}
+	if filter.Action != "" {
+		query += ` AND l.action = ?`
+		args = append(args, filter.Action)
+	}
+	if filter.TargetType != "" {
+		query += ` AND l.target_type = ?`
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query += ` AND l.target_id = ?`
+		args = append(args, filter.TargetID)
+	}
+	if !filter.From.IsZero() {
+		query += ` AND l.created_at >= ?`
+		args = append(args, sqliteTime(filter.From))
+	}
+	if !filter.To.IsZero() {
+		query += ` AND l.created_at < ?`
+		args = append(args, sqliteTime(filter.To))
+	}
+	query += ` ORDER BY l.created_at DESC, l.id DESC LIMIT ? OFFSET ?`
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := aas.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list admin audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AdminAuditEntry{}
+	for rows.Next() {
+		var entry AdminAuditEntry
+		var details string
+		if err := rows.Scan(&entry.ID, &entry.AdminID, &entry.AdminEmail, &entry.Action, &entry.TargetType,
+			&entry.TargetID, &details, &entry.IPAddress, &entry.UserAgent, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to list admin audit log: %w", err)
+		}
+		if details != "" {
+			if err := json.Unmarshal([]byte(details), &entry.Details); err != nil {
+				return nil, fmt.Errorf("failed to decode audit details: %w", err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func recordAdminAudit(db auditExecer, actor AdminActor, action, targetType, targetID string, details map[string]interface{}) error {
+	var detailsJSON interface{}
+	if len(details) > 0 {
+		encoded, err := json.Marshal(details)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+		detailsJSON = string(encoded)
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO admin_audit_log (admin_id, action, target_type, target_id, details, ip_address, user_agent, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, nullIfEmpty(actor.ID), action, nullIfEmpty(targetType), nullIfEmpty(targetID), detailsJSON,
+		nullIfEmpty(actor.IPAddress), nullIfEmpty(actor.UserAgent), sqliteTime(time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to record admin audit entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,538 @@
+/**
+ * Admin Console Service
+ * Platform-wide management of brands, events and users for admins
+ */
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"lynkr/pkg/geofencing"
+)
+
+var (
+	ErrInvalidBrand = errors.New("invalid brand details")
+	ErrInvalidEvent = errors.New("invalid event details")
+	ErrUserNotFound = errors.New("user not found")
+	// ErrImpersonationReason is returned when a brand is impersonated
+	// without saying why
+	ErrImpersonationReason = errors.New("a reason is required to impersonate a brand")
+)
+
+// AdminBrand is a brand as listed in the admin console
+type AdminBrand struct {
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	LogoURL           string    `json:"logoUrl,omitempty"`
+	ContactInfo       string    `json:"contactInfo"`
+	ReportingCurrency string    `json:"reportingCurrency,omitempty"`
+	MemberCount       int       `json:"memberCount"`
+	EventCount        int       `json:"eventCount"`
+	CreatedAt         time.Time `json:"createdAt"`
+}
+
+// BrandInput holds the editable fields of a brand
+type BrandInput struct {
+	Name        string `json:"name"`
+	LogoURL     string `json:"logoUrl"`
+	ContactInfo string `json:"contactInfo"`
+}
+
+// AdminEvent is an event as listed in the admin console
+type AdminEvent struct {
+	ID              int64     `json:"id"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description,omitempty"`
+	Location        string    `json:"location"`
+	GeofenceData    string    `json:"geofenceData,omitempty"`
+	StartTime       time.Time `json:"startTime"`
+	EndTime         time.Time `json:"endTime"`
+	BrandID         string    `json:"brandId"`
+	BrandName       string    `json:"brandName,omitempty"`
+	OrganizerID     *int64    `json:"organizerId,omitempty"`
+	OrganizerName   string    `json:"organizerName,omitempty"`
+	AttendanceCount int       `json:"attendanceCount"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// EventInput holds the editable fields of an event. OrganizerID is optional.
+type EventInput struct {
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Location     string    `json:"location"`
+	GeofenceData string    `json:"geofenceData"`
+	StartTime    time.Time `json:"startTime"`
+	EndTime      time.Time `json:"endTime"`
+	BrandID      int64     `json:"brandId"`
+	OrganizerID  *int64    `json:"organizerId"`
+}
+
+// AdminEventFilter narrows an event listing
+type AdminEventFilter struct {
+	BrandID     string
+	OrganizerID string
+	Search      string
+	Limit       int
+	Offset      int
+}
+
+// AdminUser is an app user as listed in the admin console
+type AdminUser struct {
+	ID                uint       `json:"id"`
+	Username          string     `json:"username"`
+	Email             string     `json:"email"`
+	Disabled          bool       `json:"disabled"`
+	DisabledAt        *time.Time `json:"disabledAt,omitempty"`
+	DeletionRequested bool       `json:"deletionRequested"`
+	AttendanceCount   int        `json:"attendanceCount"`
+	CreatedAt         time.Time  `json:"createdAt"`
+}
+
+type AdminConsoleService struct {
+	db *sql.DB
+}
+
+func NewAdminConsoleService(db *sql.DB) *AdminConsoleService {
+	return &AdminConsoleService{db: db}
+}
+
+const adminBrandQuery = `
+	SELECT CAST(b.id AS TEXT), b.name, COALESCE(b.logo_url, ''), b.contact_info, COALESCE(b.reporting_currency, ''),
+	       (SELECT COUNT(*) FROM brand_members m WHERE m.brand_id = CAST(b.id AS TEXT)),
+	       (SELECT COUNT(*) FROM events e WHERE e.brand_id = b.id),
+	       b.created_at
+	FROM brands b
+`
+
+// ListBrands returns brands by name, optionally only those whose name
+// contains search
+func (acs *AdminConsoleService) ListBrands(search string, limit, offset int) ([]AdminBrand, error) {
+	rows, err := acs.db.Query(adminBrandQuery+`
+		WHERE ? = '' OR b.name LIKE '%' || ? || '%'
+		ORDER BY b.name, b.id LIMIT ? OFFSET ?
+	`, search, search, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list brands: %w", err)
+	}
+	defer rows.Close()
+
+	brands := []AdminBrand{}
+	for rows.Next() {
+		brand, err := scanAdminBrand(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list brands: %w", err)
+		}
+		brands = append(brands, *brand)
+	}
+	return brands, rows.Err()
+}
+
+// GetBrand returns a brand
+func (acs *AdminConsoleService) GetBrand(brandID string) (*AdminBrand, error) {
+	brand, err := scanAdminBrand(acs.db.QueryRow(adminBrandQuery+` WHERE CAST(b.id AS TEXT) = ?`, brandID))
+	if err == sql.ErrNoRows {
+		return nil, ErrBrandNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brand: %w", err)
+	}
+	return brand, nil
+}
+
+// CreateBrand adds a brand. Its first owner is invited separately.
+func (acs *AdminConsoleService) CreateBrand(actor AdminActor, input BrandInput) (*AdminBrand, error) {
+	input, err := validateBrand(input)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := acs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create brand: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := sqliteTime(time.Now())
+	result, err := tx.Exec(`INSERT INTO brands (name, logo_url, contact_info, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+		input.Name, nullIfEmpty(input.LogoURL), input.ContactInfo, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create brand: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create brand: %w", err)
+	}
+	brandID := fmt.Sprint(id)
+	if err := recordAdminAudit(tx, actor, "brand.created", "brand", brandID, map[string]interface{}{"name": input.Name}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create brand: %w", err)
+	}
+	return acs.GetBrand(brandID)
+}
+
+// UpdateBrand replaces the editable fields of a brand
+func (acs *AdminConsoleService) UpdateBrand(actor AdminActor, brandID string, input BrandInput) (*AdminBrand, error) {
+	input, err := validateBrand(input)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := acs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update brand: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE brands SET name = ?, logo_url = ?, contact_info = ?, updated_at = ? WHERE CAST(id AS TEXT) = ?`,
+		input.Name, nullIfEmpty(input.LogoURL), input.ContactInfo, sqliteTime(time.Now()), brandID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update brand: %w", err)
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return nil, ErrBrandNotFound
+	}
+	details := map[string]interface{}{"name": input.Name, "contactInfo": input.ContactInfo}
+	if err := recordAdminAudit(tx, actor, "brand.updated", "brand", brandID, details); err != nil {
+		return nil, err
+	}
+	if err := recordBrandAudit(tx, brandID, actor.brandActor(), "brand.updated", "brand", brandID, details); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update brand: %w", err)
+	}
+	return acs.GetBrand(brandID)
+}
+
+// Impersonate records that an admin acts as a brand for support, in both the
+// admin audit log and the audit log of the brand, and returns the brand
+func (acs *AdminConsoleService) Impersonate(actor AdminActor, brandID, reason string) (*AdminBrand, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrImpersonationReason
+	}
+	brand, err := acs.GetBrand(brandID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := acs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to impersonate brand: %w", err)
+	}
+	defer tx.Rollback()
+
+	details := map[string]interface{}{"reason": reason}
+	if err := recordAdminAudit(tx, actor, "brand.impersonated", "brand", brandID, details); err != nil {
+		return nil, err
+	}
+	if err := recordBrandAudit(tx, brandID, actor.brandActor(), "admin.impersonation_started", "brand", brandID, details); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to impersonate brand: %w", err)
+	}
+	return brand, nil
+}
+
+const adminEventQuery = `
+	SELECT e.id, e.name, COALESCE(e.description, ''), e.location, COALESCE(e.geofence_data, ''), e.start_time, e.end_time,
+	       CAST(e.brand_id AS TEXT), COALESCE(b.name, ''), e.organizer_id, COALESCE(o.name, ''),
+	       (SELECT COUNT(*) FROM attendances a WHERE a.event_id = e.id), e.created_at
+	FROM events e
+	LEFT JOIN brands b ON b.id = e.brand_id
+	LEFT JOIN organizers o ON o.id = e.organizer_id
+`
+
+// ListEvents returns events, latest first
+func (acs *AdminConsoleService) ListEvents(filter AdminEventFilter) ([]AdminEvent, error) {
+	query := adminEventQuery + ` WHERE 1 = 1`
+	var args []interface{}
+	if filter.BrandID != "" {
+		query += ` AND CAST(e.brand_id AS TEXT) = ?`
+		args = append(args, filter.BrandID)
+	}
+	if filter.OrganizerID != "" {
+		query += ` AND CAST(e.organizer_id AS TEXT) = ?`
+		args = append(args, filter.OrganizerID)
+	}
+	if filter.Search != "" {
+		query += ` AND e.name LIKE '%' || ? || '%'`
+		args = append(args, filter.Search)
+	}
+	query += ` ORDER BY e.start_time DESC, e.id DESC LIMIT ? OFFSET ?`
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := acs.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []AdminEvent{}
+	for rows.Next() {
+		event, err := scanAdminEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list events: %w", err)
+		}
+		events = append(events, *event)
+	}
+	return events, rows.Err()
+}
+
+// GetEvent returns an event
+func (acs *AdminConsoleService) GetEvent(id int64) (*AdminEvent, error) {
+	event, err := scanAdminEvent(acs.db.QueryRow(adminEventQuery+` WHERE e.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrEventNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event: %w", err)
+	}
+	return event, nil
+}
+
+// CreateEvent adds an event for a brand, optionally run by an organizer
+func (acs *AdminConsoleService) CreateEvent(actor AdminActor, input EventInput) (*AdminEvent, error) {
+	tx, err := acs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event: %w", err)
+	}
+	defer tx.Rollback()
+
+	input, err = validateEvent(tx, input)
+	if err != nil {
+		return nil, err
+	}
+	now := sqliteTime(time.Now())
+	result, err := tx.Exec(`
+		INSERT INTO events (name, description, location, geofence_data, start_time, end_time, brand_id, organizer_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, input.Name, input.Description, input.Location, input.GeofenceData, input.StartTime, input.EndTime,
+		input.BrandID, input.OrganizerID, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event: %w", err)
+	}
+	details := map[string]interface{}{"name": input.Name, "brandId": input.BrandID}
+	if input.OrganizerID != nil {
+		details["organizerId"] = *input.OrganizerID
+	}
+	if err := recordAdminAudit(tx, actor, "event.created", "event", fmt.Sprint(id), details); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create event: %w", err)
+	}
+	return acs.GetEvent(id)
+}
+
+// UpdateEvent replaces the editable fields of an event, including its brand
+// and organizer
+func (acs *AdminConsoleService) UpdateEvent(actor AdminActor, id int64, input EventInput) (*AdminEvent, error) {
+	tx, err := acs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update event: %w", err)
+	}
+	defer tx.Rollback()
+
+	input, err = validateEvent(tx, input)
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec(`
+		UPDATE events
+		SET name = ?, description = ?, location = ?, geofence_data = ?, start_time = ?, end_time = ?,
+		    brand_id = ?, organizer_id = ?, updated_at = ?
+		WHERE id = ?
+	`, input.Name, input.Description, input.Location, input.GeofenceData, input.StartTime, input.EndTime,
+		input.BrandID, input.OrganizerID, sqliteTime(time.Now()), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update event: %w", err)
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return nil, ErrEventNotFound
+	}
+	details := map[string]interface{}{"name": input.Name, "brandId": input.BrandID}
+	if input.OrganizerID != nil {
+		details["organizerId"] = *input.OrganizerID
+	}
+	if err := recordAdminAudit(tx, actor, "event.updated", "event", fmt.Sprint(id), details); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update event: %w", err)
+	}
+	return acs.GetEvent(id)
+}
+
+const adminUserQuery = `
+	SELECT u.id, u.username, u.email, u.disabled_at, COALESCE(u.deletion_requested, 0),
+	       (SELECT COUNT(*) FROM attendances a WHERE a.user_id = u.id), u.created_at
+	FROM users u
+`
+
+// ListUsers returns app users, newest first, optionally only those whose
+// username or email contains search
+func (acs *AdminConsoleService) ListUsers(search string, limit, offset int) ([]AdminUser, error) {
+	rows, err := acs.db.Query(adminUserQuery+`
+		WHERE ? = '' OR u.username LIKE '%' || ? || '%' OR u.email LIKE '%' || ? || '%'
+		ORDER BY u.created_at DESC, u.id DESC LIMIT ? OFFSET ?
+	`, search, search, search, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []AdminUser{}
+	for rows.Next() {
+		user, err := scanAdminUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list users: %w", err)
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+// GetUser returns an app user
+func (acs *AdminConsoleService) GetUser(id uint) (*AdminUser, error) {
+	user, err := scanAdminUser(acs.db.QueryRow(adminUserQuery+` WHERE u.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+// SetUserDisabled disables or re-enables an app user. Disabled users cannot
+// log in; the caller revokes their sessions.
+func (acs *AdminConsoleService) SetUserDisabled(actor AdminActor, id uint, disabled bool, reason string) (*AdminUser, error) {
+	var disabledAt interface{}
+	action := "user.enabled"
+	if disabled {
+		disabledAt = sqliteTime(time.Now())
+		action = "user.disabled"
+	}
+
+	tx, err := acs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE users SET disabled_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, disabledAt, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return nil, ErrUserNotFound
+	}
+	var details map[string]interface{}
+	if reason = strings.TrimSpace(reason); reason != "" {
+		details = map[string]interface{}{"reason": reason}
+	}
+	if err := recordAdminAudit(tx, actor, action, "user", fmt.Sprint(id), details); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	return acs.GetUser(id)
+}
+
+func validateBrand(input BrandInput) (BrandInput, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	input.LogoURL = strings.TrimSpace(input.LogoURL)
+	input.ContactInfo = strings.TrimSpace(input.ContactInfo)
+	if input.Name == "" || input.ContactInfo == "" {
+		return input, fmt.Errorf("%w: a name and contact info are required", ErrInvalidBrand)
+	}
+	return input, nil
+}
+
+// validateEvent checks an event's fields and that its brand and organizer exist
+func validateEvent(tx *sql.Tx, input EventInput) (EventInput, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	input.Location = strings.TrimSpace(input.Location)
+	if input.Name == "" || input.Location == "" {
+		return input, fmt.Errorf("%w: a name and a location are required", ErrInvalidEvent)
+	}
+	if input.StartTime.IsZero() || !input.EndTime.After(input.StartTime) {
+		return input, fmt.Errorf("%w: the event has to end after it starts", ErrInvalidEvent)
+	}
+	if input.GeofenceData != "" {
+		if _, err := geofencing.ParseGeofenceData(input.GeofenceData); err != nil {
+			return input, fmt.Errorf("%w: invalid geofence: %v", ErrInvalidEvent, err)
+		}
+	}
+
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM brands WHERE id = ?`, input.BrandID).Scan(&count); err != nil {
+		return input, fmt.Errorf("failed to check brand: %w", err)
+	}
+	if count == 0 {
+		return input, ErrBrandNotFound
+	}
+	if input.OrganizerID != nil {
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM organizers WHERE id = ?`, *input.OrganizerID).Scan(&count); err != nil {
+			return input, fmt.Errorf("failed to check organizer: %w", err)
+		}
+		if count == 0 {
+			return input, ErrOrganizerNotFound
+		}
+	}
+	return input, nil
+}
+
+func scanAdminBrand(row rowScanner) (*AdminBrand, error) {
+	var brand AdminBrand
+	err := row.Scan(&brand.ID, &brand.Name, &brand.LogoURL, &brand.ContactInfo, &brand.ReportingCurrency,
+		&brand.MemberCount, &brand.EventCount, &brand.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &brand, nil
+}
+
+func scanAdminEvent(row rowScanner) (*AdminEvent, error) {
+	var event AdminEvent
+	var organizerID sql.NullInt64
+	err := row.Scan(&event.ID, &event.Name, &event.Description, &event.Location, &event.GeofenceData,
+		&event.StartTime, &event.EndTime, &event.BrandID, &event.BrandName, &organizerID, &event.OrganizerName,
+		&event.AttendanceCount, &event.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if organizerID.Valid {
+		event.OrganizerID = &organizerID.Int64
+	}
+	return &event, nil
+}
+
+func scanAdminUser(row rowScanner) (*AdminUser, error) {
+	var user AdminUser
+	var disabledAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &disabledAt, &user.DeletionRequested,
+		&user.AttendanceCount, &user.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if disabledAt.Valid {
+		user.Disabled = true
+		user.DisabledAt = &disabledAt.Time
+	}
+	return &user, nil
+}
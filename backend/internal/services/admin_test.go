@@ -0,0 +1,248 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"lynkr/internal/auth"
+	"lynkr/pkg/secrets"
+)
+
+const testAdminPassword = "correct horse battery"
+
+func newTestAdminService(t *testing.T) *AdminService {
+	t.Helper()
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	keyring, err := secrets.NewKeyring(map[string]string{"k1": key}, "k1")
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return NewAdminService(newTestDB(t), keyring, AdminOptions{MaxFailedLogins: 3})
+}
+
+func mustCreateAdmin(t *testing.T, as *AdminService, email string) *AdminAccount {
+	t.Helper()
+	admin, err := as.CreateAdmin(AdminActor{}, email, "Ops", testAdminPassword)
+	if err != nil {
+		t.Fatalf("CreateAdmin: %v", err)
+	}
+	return admin
+}
+
+// totpCodeAt computes the code of a TOTP secret for a 30 second time step,
+// the way authenticator apps do
+func totpCodeAt(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("invalid TOTP secret: %v", err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+// mustEnableTOTP turns on TOTP for an admin and returns the secret and the
+// time step of the code that confirmed it
+func mustEnableTOTP(t *testing.T, as *AdminService, admin *AdminAccount) (string, int64) {
+	t.Helper()
+	setup, err := as.SetupTOTP(admin.ID)
+	if err != nil {
+		t.Fatalf("SetupTOTP: %v", err)
+	}
+	step := time.Now().Unix() / 30
+	if err := as.EnableTOTP(AdminActor{ID: admin.ID}, totpCodeAt(t, setup.Secret, step)); err != nil {
+		t.Fatalf("EnableTOTP: %v", err)
+	}
+	return setup.Secret, step
+}
+
+func TestAdminPasswordLogin(t *testing.T) {
+	as := newTestAdminService(t)
+	admin := mustCreateAdmin(t, as, "Ops@Lynkr.test")
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantErr  error
+	}{
+		{name: "valid", email: "ops@lynkr.test", password: testAdminPassword},
+		{name: "email in another case", email: " OPS@lynkr.test ", password: testAdminPassword},
+		{name: "wrong password", email: "ops@lynkr.test", password: "wrong password", wantErr: ErrInvalidCredentials},
+		{name: "unknown admin", email: "nobody@lynkr.test", password: testAdminPassword, wantErr: ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := as.Authenticate(tt.email, tt.password, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (got.ID != admin.ID || got.LastLoginAt == nil) {
+				t.Errorf("Authenticate = %+v, want admin %s with the login recorded", got, admin.ID)
+			}
+		})
+	}
+
+	if _, err := as.SetAdminDisabled(AdminActor{}, admin.ID, true); err != nil {
+		t.Fatalf("SetAdminDisabled: %v", err)
+	}
+	if _, err := as.Authenticate("ops@lynkr.test", testAdminPassword, ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("disabled admin logging in = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestAdminLockout(t *testing.T) {
+	as := newTestAdminService(t)
+	mustCreateAdmin(t, as, "ops@lynkr.test")
+
+	for i := 1; i < 3; i++ {
+		if _, err := as.Authenticate("ops@lynkr.test", "wrong password", ""); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("failed login %d = %v, want ErrInvalidCredentials", i, err)
+		}
+	}
+	if _, err := as.Authenticate("ops@lynkr.test", "wrong password", ""); !errors.Is(err, ErrAdminLocked) {
+		t.Fatalf("third failed login = %v, want ErrAdminLocked", err)
+	}
+	if _, err := as.Authenticate("ops@lynkr.test", testAdminPassword, ""); !errors.Is(err, ErrAdminLocked) {
+		t.Errorf("login while locked = %v, want ErrAdminLocked even with the right password", err)
+	}
+}
+
+func TestAdminTOTPLogin(t *testing.T) {
+	as := newTestAdminService(t)
+	admin := mustCreateAdmin(t, as, "ops@lynkr.test")
+	secret, enabledStep := mustEnableTOTP(t, as, admin)
+
+	// Codes of the step that enabled TOTP are used up, the next step's code
+	// is within the allowed clock drift
+	nextCode := totpCodeAt(t, secret, enabledStep+1)
+	wrongCode := "000000"
+	if wrongCode == nextCode {
+		wrongCode = "111111"
+	}
+
+	steps := []struct {
+		name    string
+		code    string
+		wantErr error
+	}{
+		{name: "no code", code: "", wantErr: ErrTOTPRequired},
+		{name: "wrong code", code: wrongCode, wantErr: ErrInvalidTOTPCode},
+		{name: "code that enabled TOTP", code: totpCodeAt(t, secret, enabledStep), wantErr: ErrInvalidTOTPCode},
+		{name: "valid code", code: nextCode},
+		{name: "replayed code", code: nextCode, wantErr: ErrInvalidTOTPCode},
+	}
+
+	// The steps run in order, each depending on the ones before
+	for _, step := range steps {
+		if _, err := as.Authenticate("ops@lynkr.test", testAdminPassword, step.code); !errors.Is(err, step.wantErr) {
+			t.Errorf("%s: Authenticate err = %v, want %v", step.name, err, step.wantErr)
+		}
+	}
+
+	if _, err := as.Authenticate("ops@lynkr.test", "wrong password", nextCode); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password with a code = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestEnableTOTP(t *testing.T) {
+	as := newTestAdminService(t)
+	admin := mustCreateAdmin(t, as, "ops@lynkr.test")
+	actor := AdminActor{ID: admin.ID}
+
+	if err := as.EnableTOTP(actor, "123456"); !errors.Is(err, ErrTOTPNotSetUp) {
+		t.Errorf("EnableTOTP before SetupTOTP = %v, want ErrTOTPNotSetUp", err)
+	}
+	setup, err := as.SetupTOTP(admin.ID)
+	if err != nil {
+		t.Fatalf("SetupTOTP: %v", err)
+	}
+	var stored string
+	as.db.QueryRow(`SELECT totp_secret FROM admin_accounts WHERE id = ?`, admin.ID).Scan(&stored)
+	if !secrets.IsEncrypted(stored) {
+		t.Error("TOTP secret stored in the clear")
+	}
+
+	step := time.Now().Unix() / 30
+	if err := as.EnableTOTP(actor, totpCodeAt(t, setup.Secret, step+5)); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Errorf("EnableTOTP with a code from the future = %v, want ErrInvalidTOTPCode", err)
+	}
+	if err := as.EnableTOTP(actor, totpCodeAt(t, setup.Secret, step)); err != nil {
+		t.Fatalf("EnableTOTP: %v", err)
+	}
+	if _, err := as.SetupTOTP(admin.ID); !errors.Is(err, ErrTOTPAlreadyEnabled) {
+		t.Errorf("SetupTOTP once enabled = %v, want ErrTOTPAlreadyEnabled", err)
+	}
+
+	// Turning it off again needs a fresh code
+	if err := as.DisableTOTP(actor, admin.ID, totpCodeAt(t, setup.Secret, step)); !errors.Is(err, ErrInvalidTOTPCode) {
+		t.Errorf("DisableTOTP with the used code = %v, want ErrInvalidTOTPCode", err)
+	}
+	if err := as.DisableTOTP(actor, admin.ID, totpCodeAt(t, setup.Secret, step+1)); err != nil {
+		t.Fatalf("DisableTOTP: %v", err)
+	}
+	if got, _ := as.GetAdmin(admin.ID); got.TOTPEnabled {
+		t.Error("TOTP still enabled")
+	}
+}
+
+func TestImpersonation(t *testing.T) {
+	as := newTestAdminService(t)
+	db := as.db
+	admin := mustCreateAdmin(t, as, "ops@lynkr.test")
+	mustExec(t, db, `INSERT INTO brands (id, name, contact_info) VALUES (1, 'Acme', 'a@acme.test')`)
+	console := NewAdminConsoleService(db)
+	actor := AdminActor{ID: admin.ID, IPAddress: "203.0.113.7"}
+
+	if _, err := console.Impersonate(actor, "1", "  "); !errors.Is(err, ErrImpersonationReason) {
+		t.Errorf("Impersonate without a reason = %v, want ErrImpersonationReason", err)
+	}
+	brand, err := console.Impersonate(actor, "1", "ticket 1234")
+	if err != nil {
+		t.Fatalf("Impersonate: %v", err)
+	}
+
+	var adminAudits, brandAudits int
+	db.QueryRow(`SELECT COUNT(*) FROM admin_audit_log WHERE admin_id = ? AND action = 'brand.impersonated' AND target_id = '1'`, admin.ID).Scan(&adminAudits)
+	db.QueryRow(`SELECT COUNT(*) FROM brand_audit_log WHERE brand_id = '1' AND actor_type = ? AND actor_id = ? AND action = 'admin.impersonation_started'`,
+		string(auth.PrincipalAdmin), admin.ID).Scan(&brandAudits)
+	if adminAudits != 1 || brandAudits != 1 {
+		t.Errorf("impersonation audited %d time(s) for the admin and %d for the brand, want once each", adminAudits, brandAudits)
+	}
+
+	// The impersonation token ends with the admin's sessions
+	keys, err := auth.NewKeySet(map[string]string{"k1": "first-secret-first-secret-32byte"}, "k1")
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	tokens := auth.NewTokenService(db, keys, auth.TokenOptions{})
+	pair, err := tokens.IssueAccessToken(auth.Principal{Type: auth.PrincipalAdmin, ID: admin.ID, BrandID: brand.ID})
+	if err != nil {
+		t.Fatalf("IssueAccessToken: %v", err)
+	}
+	claims, err := tokens.Authenticate(pair.AccessToken)
+	if err != nil || claims.BrandID != brand.ID {
+		t.Fatalf("Authenticate = %+v, %v; want a token for brand %s", claims, err, brand.ID)
+	}
+	if _, err := tokens.RevokeSessions(auth.PrincipalAdmin, admin.ID); err != nil {
+		t.Fatalf("RevokeSessions: %v", err)
+	}
+	if _, err := tokens.Authenticate(pair.AccessToken); !errors.Is(err, auth.ErrTokenRevoked) {
+		t.Errorf("impersonation token after revoking the admin's sessions = %v, want ErrTokenRevoked", err)
+	}
+}
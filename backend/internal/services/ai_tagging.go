@@ -6,11 +6,14 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
+
+	"lynkr/internal/jobs"
 )
 
 type ProductDetection struct {
@@ -33,12 +36,40 @@ type AITaggingResult struct {
 	ProcessedAt time.Time          `json:"processedAt"`
 }
 
+// AITaggingJobType is the job that runs product detection on the ai queue
+const AITaggingJobType = "ai.tag_content"
+
 type AITaggingService struct {
-	db *sql.DB
+	db    *sql.DB
+	queue *jobs.Queue
+}
+
+type aiTaggingJobPayload struct {
+	ContentID string `json:"contentId"`
+	MediaURL  string `json:"mediaUrl"`
+}
+
+func NewAITaggingService(db *sql.DB, queue *jobs.Queue) *AITaggingService {
+	ats := &AITaggingService{db: db, queue: queue}
+	queue.Register(AITaggingJobType, "ai", ats.handleTaggingJob)
+	return ats
 }
 
-func NewAITaggingService(db *sql.DB) *AITaggingService {
-	return &AITaggingService{db: db}
+// QueueContentProcessing queues AI tagging of a content item
+func (ats *AITaggingService) QueueContentProcessing(contentID, mediaURL string) (*jobs.Job, error) {
+	return ats.queue.Enqueue(AITaggingJobType, aiTaggingJobPayload{ContentID: contentID, MediaURL: mediaURL}, jobs.EnqueueOptions{
+		DedupeKey: AITaggingJobType + ":" + contentID,
+	})
+}
+
+func (ats *AITaggingService) handleTaggingJob(ctx context.Context, job *jobs.Job) error {
+	var payload aiTaggingJobPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	_, err := ats.ProcessContent(payload.ContentID, payload.MediaURL)
+	return err
 }
 
 func (ats *AITaggingService) ProcessContent(contentID, mediaURL string) (*AITaggingResult, error) {
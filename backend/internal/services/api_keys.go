@@ -0,0 +1,313 @@
+/**
+ * API Key Service
+ * Scoped brand API keys for server-to-server integrations
+ */
+
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"lynkr/internal/auth"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrInvalidAPIKey  = errors.New("invalid API key details")
+	ErrAPIKeyRejected = errors.New("API key is invalid, expired or revoked")
+)
+
+// APIKeyPrefix starts every API key, which tells keys apart from access tokens
+const APIKeyPrefix = "lynkr_"
+
+// API key statuses
+const (
+	APIKeyActive  = "active"
+	APIKeyExpired = "expired"
+	APIKeyRevoked = "revoked"
+)
+
+// apiKeyDisplayLength is how much of a key is stored and shown in the clear
+const apiKeyDisplayLength = len(APIKeyPrefix) + 6
+
+// lastUsedInterval limits how often using a key updates its last use
+const lastUsedInterval = time.Minute
+
+// APIKey is a brand API key. The key itself is only returned when it is
+// created; Prefix is enough to recognize it afterwards.
+type APIKey struct {
+	ID         string            `json:"id"`
+	BrandID    string            `json:"brandId"`
+	Name       string            `json:"name"`
+	Prefix     string            `json:"prefix"`
+	Scopes     []auth.Permission `json:"scopes"`
+	CreatedBy  string            `json:"createdBy,omitempty"`
+	Status     string            `json:"status"`
+	ExpiresAt  time.Time         `json:"expiresAt"`
+	LastUsedAt *time.Time        `json:"lastUsedAt,omitempty"`
+	LastUsedIP string            `json:"lastUsedIp,omitempty"`
+	RevokedAt  *time.Time        `json:"revokedAt,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt"`
+}
+
+// APIKeyInput describes a new API key. Without ExpiresAt the key expires
+// after the default lifetime.
+type APIKeyInput struct {
+	Name      string            `json:"name"`
+	Scopes    []auth.Permission `json:"scopes"`
+	ExpiresAt *time.Time        `json:"expiresAt"`
+}
+
+// APIKeyOptions sets API key lifetimes
+type APIKeyOptions struct {
+	DefaultTTL time.Duration // lifetime of keys created without an expiry
+	MaxTTL     time.Duration // longest lifetime a key can be created with
+}
+
+type APIKeyService struct {
+	db      *sql.DB
+	options APIKeyOptions
+}
+
+func NewAPIKeyService(db *sql.DB, options APIKeyOptions) *APIKeyService {
+	if options.DefaultTTL <= 0 {
+		options.DefaultTTL = 90 * 24 * time.Hour
+	}
+	if options.MaxTTL <= 0 {
+		options.MaxTTL = 365 * 24 * time.Hour
+	}
+	if options.DefaultTTL > options.MaxTTL {
+		options.DefaultTTL = options.MaxTTL
+	}
+	return &APIKeyService{db: db, options: options}
+}
+
+const apiKeyQuery = `
+	SELECT id, brand_id, name, key_prefix, scopes, COALESCE(created_by, ''), expires_at,
+	       last_used_at, COALESCE(last_used_ip, ''), revoked_at, created_at
+	FROM brand_api_keys
+`
+
+// CreateAPIKey creates an API key for a brand and returns it along with the
+// key, which cannot be retrieved again
+func (aks *APIKeyService) CreateAPIKey(brandID string, actor BrandActor, input APIKeyInput) (*APIKey, string, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	name, scopes, expiresAt, err := aks.validateAPIKey(input, now)
+	if err != nil {
+		return nil, "", err
+	}
+	scopesJSON, err := json.Marshal(scopes)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode scopes: %w", err)
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+	apiKey := &APIKey{
+		ID:        fmt.Sprintf("apikey_%d", time.Now().UnixNano()),
+		BrandID:   brandID,
+		Name:      name,
+		Prefix:    key[:apiKeyDisplayLength],
+		Scopes:    scopes,
+		CreatedBy: actor.memberID(),
+		Status:    APIKeyActive,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}
+
+	tx, err := aks.db.Begin()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO brand_api_keys (id, brand_id, name, key_prefix, key_hash, scopes, created_by, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, apiKey.ID, brandID, name, apiKey.Prefix, hashSecretToken(key), string(scopesJSON),
+		nullIfEmpty(apiKey.CreatedBy), sqliteTime(expiresAt), sqliteTime(now))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+	details := map[string]interface{}{"name": name, "scopes": scopes, "expiresAt": expiresAt}
+	if err := recordBrandAudit(tx, brandID, actor, "api_key.created", "api_key", apiKey.ID, details); err != nil {
+		return nil, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+	return apiKey, key, nil
+}
+
+// ListAPIKeys returns the API keys of a brand, newest first, including
+// expired and revoked ones
+func (aks *APIKeyService) ListAPIKeys(brandID string) ([]APIKey, error) {
+	rows, err := aks.db.Query(apiKeyQuery+` WHERE brand_id = ? ORDER BY created_at DESC, id DESC`, brandID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	now := time.Now()
+	for rows.Next() {
+		apiKey, err := scanAPIKey(rows, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list API keys: %w", err)
+		}
+		keys = append(keys, *apiKey)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKey returns an API key of a brand
+func (aks *APIKeyService) GetAPIKey(brandID, id string) (*APIKey, error) {
+	apiKey, err := scanAPIKey(aks.db.QueryRow(apiKeyQuery+` WHERE brand_id = ? AND id = ?`, brandID, id), time.Now())
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return apiKey, nil
+}
+
+// RevokeAPIKey stops an API key from working. Revoking a revoked key does
+// nothing.
+func (aks *APIKeyService) RevokeAPIKey(brandID string, actor BrandActor, id string) error {
+	tx, err := aks.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	defer tx.Rollback()
+
+	var name string
+	var revokedAt sql.NullTime
+	err = tx.QueryRow(`SELECT name, revoked_at FROM brand_api_keys WHERE brand_id = ? AND id = ?`, brandID, id).Scan(&name, &revokedAt)
+	if err == sql.ErrNoRows {
+		return ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if revokedAt.Valid {
+		return nil
+	}
+
+	if _, err := tx.Exec(`UPDATE brand_api_keys SET revoked_at = ? WHERE id = ?`, sqliteTime(time.Now()), id); err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if err := recordBrandAudit(tx, brandID, actor, "api_key.revoked", "api_key", id, map[string]interface{}{"name": name}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return nil
+}
+
+// Authenticate looks up an active API key and records its use from ipAddress
+func (aks *APIKeyService) Authenticate(key, ipAddress string) (*APIKey, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return nil, ErrAPIKeyRejected
+	}
+	now := time.Now()
+	apiKey, err := scanAPIKey(aks.db.QueryRow(apiKeyQuery+` WHERE key_hash = ?`, hashSecretToken(key)), now)
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyRejected
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate API key: %w", err)
+	}
+	if apiKey.Status != APIKeyActive {
+		return nil, ErrAPIKeyRejected
+	}
+
+	// Busy integrations would otherwise write on every request
+	_, err = aks.db.Exec(`
+		UPDATE brand_api_keys SET last_used_at = ?, last_used_ip = ?
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ? OR COALESCE(last_used_ip, '') != ?)
+	`, sqliteTime(now), nullIfEmpty(ipAddress), apiKey.ID, sqliteTime(now.Add(-lastUsedInterval)), ipAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record API key use: %w", err)
+	}
+	return apiKey, nil
+}
+
+func (aks *APIKeyService) validateAPIKey(input APIKeyInput, now time.Time) (string, []auth.Permission, time.Time, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" || len(name) > 100 {
+		return "", nil, time.Time{}, fmt.Errorf("%w: a name of up to 100 characters is required", ErrInvalidAPIKey)
+	}
+
+	if len(input.Scopes) == 0 {
+		return "", nil, time.Time{}, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKey)
+	}
+	scopes := make([]auth.Permission, 0, len(input.Scopes))
+	seen := make(map[auth.Permission]bool)
+	for _, scope := range input.Scopes {
+		if !auth.ValidAPIKeyScope(scope) {
+			return "", nil, time.Time{}, fmt.Errorf("%w: API keys cannot have the %q scope", ErrInvalidAPIKey, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	expiresAt := now.Add(aks.options.DefaultTTL)
+	if input.ExpiresAt != nil {
+		expiresAt = input.ExpiresAt.UTC().Truncate(time.Second)
+		if !expiresAt.After(now) {
+			return "", nil, time.Time{}, fmt.Errorf("%w: the expiry has to be in the future", ErrInvalidAPIKey)
+		}
+		if expiresAt.After(now.Add(aks.options.MaxTTL)) {
+			return "", nil, time.Time{}, fmt.Errorf("%w: keys expire after at most %d days", ErrInvalidAPIKey, int(aks.options.MaxTTL.Hours()/24))
+		}
+	}
+	return name, scopes, expiresAt, nil
+}
+
+func generateAPIKey() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func scanAPIKey(row rowScanner, now time.Time) (*APIKey, error) {
+	var apiKey APIKey
+	var scopes string
+	var lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&apiKey.ID, &apiKey.BrandID, &apiKey.Name, &apiKey.Prefix, &scopes, &apiKey.CreatedBy,
+		&apiKey.ExpiresAt, &lastUsedAt, &apiKey.LastUsedIP, &revokedAt, &apiKey.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &apiKey.Scopes); err != nil {
+		return nil, fmt.Errorf("failed to decode scopes: %w", err)
+	}
+	if lastUsedAt.Valid {
+		apiKey.LastUsedAt = &lastUsedAt.Time
+	}
+	switch {
+	case revokedAt.Valid:
+		apiKey.RevokedAt = &revokedAt.Time
+		apiKey.Status = APIKeyRevoked
+	case !now.Before(apiKey.ExpiresAt):
+		apiKey.Status = APIKeyExpired
+	default:
+		apiKey.Status = APIKeyActive
+	}
+	return &apiKey, nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"lynkr/internal/auth"
+)
+
+var testBrandActor = BrandActor{Type: string(auth.PrincipalBrandMember), ID: "member_1", Role: auth.BrandRoleOwner}
+
+func mustCreateAPIKey(t *testing.T, aks *APIKeyService, input APIKeyInput) (*APIKey, string) {
+	t.Helper()
+	apiKey, key, err := aks.CreateAPIKey("1", testBrandActor, input)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	return apiKey, key
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	aks := NewAPIKeyService(newTestDB(t), APIKeyOptions{DefaultTTL: 30 * 24 * time.Hour, MaxTTL: 90 * 24 * time.Hour})
+	at := func(d time.Duration) *time.Time {
+		expiresAt := time.Now().Add(d)
+		return &expiresAt
+	}
+	scopes := []auth.Permission{auth.PermAnalyticsRead}
+
+	tests := []struct {
+		name    string
+		input   APIKeyInput
+		wantErr bool
+	}{
+		{name: "default expiry", input: APIKeyInput{Name: "BI", Scopes: scopes}},
+		{name: "expiry within the maximum", input: APIKeyInput{Name: "BI", Scopes: scopes, ExpiresAt: at(89 * 24 * time.Hour)}},
+		{name: "expiry beyond the maximum", input: APIKeyInput{Name: "BI", Scopes: scopes, ExpiresAt: at(91 * 24 * time.Hour)}, wantErr: true},
+		{name: "expiry in the past", input: APIKeyInput{Name: "BI", Scopes: scopes, ExpiresAt: at(-time.Hour)}, wantErr: true},
+		{name: "no name", input: APIKeyInput{Name: "  ", Scopes: scopes}, wantErr: true},
+		{name: "long name", input: APIKeyInput{Name: strings.Repeat("x", 101), Scopes: scopes}, wantErr: true},
+		{name: "no scopes", input: APIKeyInput{Name: "BI"}, wantErr: true},
+		{name: "scope keys cannot have", input: APIKeyInput{Name: "BI", Scopes: []auth.Permission{auth.PermMembersWrite}}, wantErr: true},
+		{name: "unknown scope", input: APIKeyInput{Name: "BI", Scopes: []auth.Permission{"everything"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := aks.CreateAPIKey("1", testBrandActor, tt.input)
+			if tt.wantErr && !errors.Is(err, ErrInvalidAPIKey) {
+				t.Errorf("CreateAPIKey err = %v, want ErrInvalidAPIKey", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("CreateAPIKey: %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	db := newTestDB(t)
+	aks := NewAPIKeyService(db, APIKeyOptions{DefaultTTL: 30 * 24 * time.Hour})
+
+	apiKey, key := mustCreateAPIKey(t, aks, APIKeyInput{
+		Name:   " BI export ",
+		Scopes: []auth.Permission{auth.PermAnalyticsRead, auth.PermExportWrite, auth.PermAnalyticsRead},
+	})
+	if !strings.HasPrefix(key, APIKeyPrefix) || !strings.HasPrefix(key, apiKey.Prefix) {
+		t.Errorf("key %.10q does not start with %q and its prefix %q", key, APIKeyPrefix, apiKey.Prefix)
+	}
+	if apiKey.Name != "BI export" || len(apiKey.Scopes) != 2 || apiKey.Status != APIKeyActive {
+		t.Errorf("key = %q with scopes %v, %s; want trimmed name, deduplicated scopes, active", apiKey.Name, apiKey.Scopes, apiKey.Status)
+	}
+	if ttl := time.Until(apiKey.ExpiresAt); ttl < 29*24*time.Hour || ttl > 30*24*time.Hour {
+		t.Errorf("key expires in %v, want the default lifetime", ttl)
+	}
+
+	// Only the hash of the key is stored
+	var stored int
+	db.QueryRow(`SELECT COUNT(*) FROM brand_api_keys WHERE key_hash = ? OR key_prefix = ?`, key, key).Scan(&stored)
+	if stored != 0 {
+		t.Error("the key was stored in the clear")
+	}
+	var audited int
+	db.QueryRow(`SELECT COUNT(*) FROM brand_audit_log WHERE action = 'api_key.created' AND target_id = ?`, apiKey.ID).Scan(&audited)
+	if audited != 1 {
+		t.Errorf("%d audit entries for the created key, want 1", audited)
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	db := newTestDB(t)
+	aks := NewAPIKeyService(db, APIKeyOptions{})
+	scopes := []auth.Permission{auth.PermAnalyticsRead}
+
+	active, activeKey := mustCreateAPIKey(t, aks, APIKeyInput{Name: "active", Scopes: scopes})
+	expired, expiredKey := mustCreateAPIKey(t, aks, APIKeyInput{Name: "expired", Scopes: scopes})
+	mustExec(t, db, `UPDATE brand_api_keys SET expires_at = ? WHERE id = ?`, sqliteTime(time.Now().Add(-time.Minute)), expired.ID)
+	revoked, revokedKey := mustCreateAPIKey(t, aks, APIKeyInput{Name: "revoked", Scopes: scopes})
+	if err := aks.RevokeAPIKey("1", testBrandActor, revoked.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		wantID  string
+		wantErr error
+	}{
+		{name: "active key", key: activeKey, wantID: active.ID},
+		{name: "expired key", key: expiredKey, wantErr: ErrAPIKeyRejected},
+		{name: "revoked key", key: revokedKey, wantErr: ErrAPIKeyRejected},
+		{name: "unknown key", key: APIKeyPrefix + "unknown", wantErr: ErrAPIKeyRejected},
+		{name: "key without the prefix", key: strings.TrimPrefix(activeKey, APIKeyPrefix), wantErr: ErrAPIKeyRejected},
+		{name: "another key with the same prefix", key: activeKey[:len(activeKey)-1] + "x", wantErr: ErrAPIKeyRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiKey, err := aks.Authenticate(tt.key, "203.0.113.7")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (apiKey.ID != tt.wantID || apiKey.BrandID != "1" || len(apiKey.Scopes) != 1) {
+				t.Errorf("Authenticate = %+v, want key %s of brand 1", apiKey, tt.wantID)
+			}
+		})
+	}
+
+	got, err := aks.GetAPIKey("1", active.ID)
+	if err != nil {
+		t.Fatalf("GetAPIKey: %v", err)
+	}
+	if got.LastUsedAt == nil || got.LastUsedIP != "203.0.113.7" {
+		t.Errorf("last use = %v from %q, want it recorded", got.LastUsedAt, got.LastUsedIP)
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	db := newTestDB(t)
+	aks := NewAPIKeyService(db, APIKeyOptions{})
+	apiKey, _ := mustCreateAPIKey(t, aks, APIKeyInput{Name: "BI", Scopes: []auth.Permission{auth.PermAnalyticsRead}})
+
+	if err := aks.RevokeAPIKey("2", testBrandActor, apiKey.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("revoking another brand's key = %v, want ErrAPIKeyNotFound", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := aks.RevokeAPIKey("1", testBrandActor, apiKey.ID); err != nil {
+			t.Fatalf("RevokeAPIKey: %v", err)
+		}
+	}
+
+	got, err := aks.GetAPIKey("1", apiKey.ID)
+	if err != nil {
+		t.Fatalf("GetAPIKey: %v", err)
+	}
+	if got.Status != APIKeyRevoked || got.RevokedAt == nil {
+		t.Errorf("key = %s, want revoked", got.Status)
+	}
+	var audited int
+	db.QueryRow(`SELECT COUNT(*) FROM brand_audit_log WHERE action = 'api_key.revoked'`).Scan(&audited)
+	if audited != 1 {
+		t.Errorf("%d revocations audited, want 1: revoking again does nothing", audited)
+	}
+}
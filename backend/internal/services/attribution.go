@@ -0,0 +1,478 @@
+/**
+ * Attribution Service
+ * Multi-touch attribution of purchases to the touchpoints that preceded them
+ */
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Attribution models
+const (
+	AttributionLastTouch     = "last_touch"
+	AttributionFirstTouch    = "first_touch"
+	AttributionLinear        = "linear"
+	AttributionTimeDecay     = "time_decay"
+	AttributionPositionBased = "position_based"
+)
+
+// AttributionModels lists the supported models in the order they are compared
+var AttributionModels = []string{
+	AttributionLastTouch,
+	AttributionFirstTouch,
+	AttributionLinear,
+	AttributionTimeDecay,
+	AttributionPositionBased,
+}
+
+// Touchpoint types
+const (
+	TouchpointAttendance         = "attendance"
+	TouchpointContentView        = "content_view"
+	TouchpointPixel              = "pixel"
+	TouchpointSurveyResponse     = "survey_response"
+	TouchpointDiscountRedemption = "discount_redemption"
+)
+
+const (
+	defaultAttributionHalfLife = 7 * 24 * time.Hour
+	maxAttributionLookback     = 365 * 24 * time.Hour
+
+	// Position-based attribution gives the first and the last touchpoint this
+	// share each and splits the rest over the touchpoints in between
+	positionEndShare = 0.4
+)
+
+var ErrEventNotFound = errors.New("event not found")
+
+// Touchpoint is an interaction of a user with one of a brand's events.
+// Detail is the pixel event type, content ID, survey ID or discount code.
+type Touchpoint struct {
+	Type       string    `json:"type"`
+	EventID    string    `json:"eventId"`
+	Detail     string    `json:"detail"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+// AttributionOptions selects the models to apply and how far before a
+// purchase touchpoints count
+type AttributionOptions struct {
+	Models   []string
+	Lookback time.Duration
+	HalfLife time.Duration // of time-decay attribution
+}
+
+// NormalizeAttributionOptions fills in defaults and validates the options
+func NormalizeAttributionOptions(options AttributionOptions) (AttributionOptions, error) {
+	if len(options.Models) == 0 {
+		options.Models = AttributionModels
+	}
+	seen := make(map[string]bool)
+	models := []string{}
+	for _, model := range options.Models {
+		model = strings.TrimSpace(model)
+		if !isAttributionModel(model) {
+			return options, fmt.Errorf("unsupported attribution model: %s", model)
+		}
+		if !seen[model] {
+			seen[model] = true
+			models = append(models, model)
+		}
+	}
+	options.Models = models
+
+	if options.Lookback == 0 {
+		options.Lookback = purchaseAttributionWindow
+	}
+	if options.Lookback < 0 || options.Lookback > maxAttributionLookback {
+		return options, fmt.Errorf("attribution lookback must be between 1 and 365 days")
+	}
+	if options.HalfLife == 0 {
+		options.HalfLife = defaultAttributionHalfLife
+	}
+	if options.HalfLife < 0 {
+		return options, fmt.Errorf("attribution half-life must be positive")
+	}
+	return options, nil
+}
+
+func isAttributionModel(model string) bool {
+	for _, supported := range AttributionModels {
+		if model == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// TouchpointCredit is the share of conversions and revenue a model gives to
+// one kind of touchpoint
+type TouchpointCredit struct {
+	Conversions float64 `json:"conversions"`
+	Revenue     float64 `json:"revenue"`
+}
+
+// ModelAttribution is an event's attributed conversions and revenue under one model
+type ModelAttribution struct {
+	Model        string                       `json:"model"`
+	Conversions  float64                      `json:"conversions"`
+	Revenue      float64                      `json:"revenue"`
+	ByTouchpoint map[string]*TouchpointCredit `json:"byTouchpoint"`
+}
+
+// AttributionComparison reports an event's attributed conversions and
+// revenue under several models. Revenue is net of refunds, in the brand's
+// reporting currency.
+type AttributionComparison struct {
+	EventID      string             `json:"eventId"`
+	Currency     string             `json:"currency"`
+	LookbackDays float64            `json:"lookbackDays"`
+	HalfLifeDays float64            `json:"halfLifeDays"`
+	Purchases    int                `json:"purchases"` // purchases preceded by a touchpoint of the event
+	Models       []ModelAttribution `json:"models"`
+	MissingRates []string           `json:"missingRates"`
+}
+
+type AttributionService struct {
+	db *sql.DB
+}
+
+func NewAttributionService(db *sql.DB) *AttributionService {
+	return &AttributionService{db: db}
+}
+
+// attributionPurchase is a sold purchase with its net amount
+type attributionPurchase struct {
+	userID    string
+	net       int64
+	currency  string
+	createdAt time.Time
+}
+
+// attributionCredit accumulates credit, with revenue in minor units of the
+// reporting currency
+type attributionCredit struct {
+	conversions float64
+	revenue     float64
+}
+
+func (ac *attributionCredit) add(credit, net float64) {
+	ac.conversions += credit
+	ac.revenue += credit * net
+}
+
+// touchpointCredit rounds the accumulated credit for a response
+func (ac *attributionCredit) touchpointCredit(converter *reportingConverter) *TouchpointCredit {
+	return &TouchpointCredit{
+		Conversions: math.Round(ac.conversions*1000) / 1000,
+		Revenue:     converter.major(int64(math.Round(ac.revenue))),
+	}
+}
+
+// CompareModels attributes the brand's purchases to the touchpoints within
+// the lookback window before each of them, across all of the brand's events,
+// and reports the credit the event's touchpoints receive under each model
+func (as *AttributionService) CompareModels(brandID, eventID string, options AttributionOptions) (*AttributionComparison, error) {
+	options, err := NormalizeAttributionOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var found string
+	err = as.db.QueryRow(`SELECT CAST(id AS TEXT) FROM events WHERE CAST(id AS TEXT) = ? AND CAST(brand_id AS TEXT) = ?`,
+		eventID, brandID).Scan(&found)
+	if err == sql.ErrNoRows {
+		return nil, ErrEventNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event: %w", err)
+	}
+
+	converter, err := newReportingConverter(as.db, brandID)
+	if err != nil {
+		return nil, err
+	}
+
+	purchases, err := as.eventAudiencePurchases(brandID, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]*attributionCredit)
+	byType := make(map[string]map[string]*attributionCredit)
+	for _, model := range options.Models {
+		totals[model] = &attributionCredit{}
+		byType[model] = make(map[string]*attributionCredit)
+	}
+
+	comparison := &AttributionComparison{
+		EventID:      eventID,
+		Currency:     converter.currency,
+		LookbackDays: options.Lookback.Hours() / 24,
+		HalfLifeDays: options.HalfLife.Hours() / 24,
+	}
+	touchpoints, err := as.audienceTouchpoints(brandID, eventID, purchases, options.Lookback)
+	if err != nil {
+		return nil, err
+	}
+	for _, purchase := range purchases {
+		timeline := touchpointWindow(touchpoints[purchase.userID], purchase.createdAt.Add(-options.Lookback), purchase.createdAt)
+		if !touchesEvent(timeline, eventID) {
+			continue
+		}
+		comparison.Purchases++
+
+		net := float64(converter.convert(purchase.net, purchase.currency))
+		for _, model := range options.Models {
+			credits := attributionCredits(model, timeline, purchase.createdAt, options.HalfLife)
+			for i, touchpoint := range timeline {
+				if touchpoint.EventID != eventID || credits[i] == 0 {
+					continue
+				}
+				totals[model].add(credits[i], net)
+				if byType[model][touchpoint.Type] == nil {
+					byType[model][touchpoint.Type] = &attributionCredit{}
+				}
+				byType[model][touchpoint.Type].add(credits[i], net)
+			}
+		}
+	}
+
+	for _, model := range options.Models {
+		total := totals[model].touchpointCredit(converter)
+		result := ModelAttribution{
+			Model:        model,
+			Conversions:  total.Conversions,
+			Revenue:      total.Revenue,
+			ByTouchpoint: make(map[string]*TouchpointCredit),
+		}
+		for touchpointType, credit := range byType[model] {
+			result.ByTouchpoint[touchpointType] = credit.touchpointCredit(converter)
+		}
+		comparison.Models = append(comparison.Models, result)
+	}
+	comparison.MissingRates = converter.missingRates()
+
+	return comparison, nil
+}
+
+// eventAudienceCTE selects the users who interacted with an event as
+// audience(user_id). It takes the event ID five times.
+const eventAudienceCTE = `
+	WITH audience(user_id) AS (
+		SELECT CAST(user_id AS TEXT) FROM attendances WHERE CAST(event_id AS TEXT) = ?
+		UNION
+		SELECT ca.user_id FROM content_analytics ca
+		JOIN content c ON CAST(c.id AS TEXT) = ca.content_id
+		WHERE CAST(c.event_id AS TEXT) = ? AND ca.action = 'view'
+		UNION
+		SELECT user_id FROM pixel_events WHERE event_id = ?
+		UNION
+		SELECT r.user_id FROM pulse_survey_responses r
+		JOIN pulse_surveys s ON s.id = r.survey_id
+		WHERE s.event_id = ?
+		UNION
+		SELECT cr.user_id FROM code_redemptions cr
+		JOIN discount_codes dc ON dc.id = cr.code_id
+		WHERE dc.event_id = ?
+	)
+`
+
+// eventAudiencePurchases returns the brand's sold purchases by users who
+// interacted with the event
+func (as *AttributionService) eventAudiencePurchases(brandID, eventID string) ([]attributionPurchase, error) {
+	query := eventAudienceCTE + `
+		SELECT p.user_id, p.amount_minor - p.refunded_minor, p.currency, datetime(p.created_at)
+		FROM purchases p
+		WHERE ` + soldPurchaseCondition + `
+		  AND (p.event_id IN (SELECT CAST(id AS TEXT) FROM events WHERE CAST(brand_id AS TEXT) = ?)
+		       OR p.integration_id IN (SELECT id FROM ecommerce_integrations WHERE brand_id = ?))
+		  AND p.user_id IN (SELECT user_id FROM audience)
+		ORDER BY p.created_at
+	`
+	rows, err := as.db.Query(query, eventID, eventID, eventID, eventID, eventID, brandID, brandID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attribution purchases: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []attributionPurchase
+	for rows.Next() {
+		var purchase attributionPurchase
+		var createdAt string
+		if err := rows.Scan(&purchase.userID, &purchase.net, &purchase.currency, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to get attribution purchases: %w", err)
+		}
+		purchase.createdAt, err = time.Parse("2006-01-02 15:04:05", createdAt)
+		if err != nil {
+			continue
+		}
+		purchases = append(purchases, purchase)
+	}
+	return purchases, rows.Err()
+}
+
+// audienceTouchpoints returns the touchpoints of the event's audience with
+// the brand's events from the lookback window before their first purchase up
+// to their last one, by user and oldest first
+func (as *AttributionService) audienceTouchpoints(brandID, eventID string, purchases []attributionPurchase, lookback time.Duration) (map[string][]Touchpoint, error) {
+	byUser := make(map[string][]Touchpoint)
+	if len(purchases) == 0 {
+		return byUser, nil
+	}
+	first, last := purchases[0].createdAt, purchases[0].createdAt
+	for _, purchase := range purchases[1:] {
+		if purchase.createdAt.Before(first) {
+			first = purchase.createdAt
+		}
+		if purchase.createdAt.After(last) {
+			last = purchase.createdAt
+		}
+	}
+
+	query := eventAudienceCTE + `
+		SELECT CAST(a.user_id AS TEXT), 'attendance', CAST(a.event_id AS TEXT), CAST(a.id AS TEXT), datetime(a.check_in_time)
+		FROM attendances a
+		JOIN events e ON e.id = a.event_id
+		WHERE CAST(a.user_id AS TEXT) IN (SELECT user_id FROM audience) AND CAST(e.brand_id AS TEXT) = ?
+		  AND datetime(a.check_in_time) BETWEEN ? AND ?
+		UNION ALL
+		SELECT ca.user_id, 'content_view', CAST(c.event_id AS TEXT), ca.content_id, datetime(ca.created_at)
+		FROM content_analytics ca
+		JOIN content c ON CAST(c.id AS TEXT) = ca.content_id
+		JOIN events e ON e.id = c.event_id
+		WHERE ca.user_id IN (SELECT user_id FROM audience) AND ca.action = 'view' AND CAST(e.brand_id AS TEXT) = ?
+		  AND datetime(ca.created_at) BETWEEN ? AND ?
+		UNION ALL
+		SELECT pe.user_id, 'pixel', pe.event_id, pe.event_type, datetime(pe.created_at)
+		FROM pixel_events pe
+		JOIN events e ON CAST(e.id AS TEXT) = pe.event_id
+		WHERE pe.user_id IN (SELECT user_id FROM audience) AND CAST(e.brand_id AS TEXT) = ?
+		  AND datetime(pe.created_at) BETWEEN ? AND ?
+		UNION ALL
+		SELECT r.user_id, 'survey_response', s.event_id, s.id, datetime(r.completed_at)
+		FROM pulse_survey_responses r
+		JOIN pulse_surveys s ON s.id = r.survey_id
+		JOIN events e ON CAST(e.id AS TEXT) = s.event_id
+		WHERE r.user_id IN (SELECT user_id FROM audience) AND CAST(e.brand_id AS TEXT) = ?
+		  AND datetime(r.completed_at) BETWEEN ? AND ?
+		UNION ALL
+		SELECT cr.user_id, 'discount_redemption', dc.event_id, dc.code, datetime(cr.created_at)
+		FROM code_redemptions cr
+		JOIN discount_codes dc ON dc.id = cr.code_id
+		JOIN events e ON CAST(e.id AS TEXT) = dc.event_id
+		WHERE cr.user_id IN (SELECT user_id FROM audience) AND CAST(e.brand_id AS TEXT) = ?
+		  AND datetime(cr.created_at) BETWEEN ? AND ?
+	`
+	from, to := sqliteTime(first.Add(-lookback)), sqliteTime(last)
+	args := []interface{}{eventID, eventID, eventID, eventID, eventID}
+	for i := 0; i < 5; i++ {
+		args = append(args, brandID, from, to)
+	}
+
+	rows, err := as.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get touchpoints: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, occurredAt string
+		var touchpoint Touchpoint
+		if err := rows.Scan(&userID, &touchpoint.Type, &touchpoint.EventID, &touchpoint.Detail, &occurredAt); err != nil {
+			return nil, fmt.Errorf("failed to get touchpoints: %w", err)
+		}
+		touchpoint.OccurredAt, err = time.Parse("2006-01-02 15:04:05", occurredAt)
+		if err != nil {
+			continue
+		}
+		byUser[userID] = append(byUser[userID], touchpoint)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get touchpoints: %w", err)
+	}
+
+	for _, timeline := range byUser {
+		sort.SliceStable(timeline, func(i, j int) bool {
+			return timeline[i].OccurredAt.Before(timeline[j].OccurredAt)
+		})
+	}
+	return byUser, nil
+}
+
+// touchpointWindow returns the touchpoints of a sorted timeline that occurred
+// between from and to, both included
+func touchpointWindow(timeline []Touchpoint, from, to time.Time) []Touchpoint {
+	start := sort.Search(len(timeline), func(i int) bool {
+		return !timeline[i].OccurredAt.Before(from)
+	})
+	end := sort.Search(len(timeline), func(i int) bool {
+		return timeline[i].OccurredAt.After(to)
+	})
+	if start >= end {
+		return nil
+	}
+	return timeline[start:end]
+}
+
+func touchesEvent(timeline []Touchpoint, eventID string) bool {
+	for _, touchpoint := range timeline {
+		if touchpoint.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+// attributionCredits splits one conversion over a timeline, oldest
+// touchpoint first. The credits add up to 1 unless the timeline is empty.
+func attributionCredits(model string, timeline []Touchpoint, conversionAt time.Time, halfLife time.Duration) []float64 {
+	n := len(timeline)
+	credits := make([]float64, n)
+	if n == 0 {
+		return credits
+	}
+
+	switch model {
+	case AttributionFirstTouch:
+		credits[0] = 1
+	case AttributionLinear:
+		for i := range credits {
+			credits[i] = 1 / float64(n)
+		}
+	case AttributionTimeDecay:
+		// A touchpoint one half-life older than another gets half its credit
+		total := 0.0
+		for i, touchpoint := range timeline {
+			age := conversionAt.Sub(touchpoint.OccurredAt)
+			credits[i] = math.Exp2(-float64(age) / float64(halfLife))
+			total += credits[i]
+		}
+		for i := range credits {
+			credits[i] /= total
+		}
+	case AttributionPositionBased:
+		switch n {
+		case 1:
+			credits[0] = 1
+		case 2:
+			credits[0], credits[1] = 0.5, 0.5
+		default:
+			credits[0], credits[n-1] = positionEndShare, positionEndShare
+			for i := 1; i < n-1; i++ {
+				credits[i] = (1 - 2*positionEndShare) / float64(n-2)
+			}
+		}
+	default:
+		credits[n-1] = 1
+	}
+	return credits
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// timelineAt returns touchpoints that occurred the given durations before conversionAt
+func timelineAt(conversionAt time.Time, ages ...time.Duration) []Touchpoint {
+	timeline := make([]Touchpoint, len(ages))
+	for i, age := range ages {
+		timeline[i] = Touchpoint{Type: TouchpointAttendance, EventID: "1", OccurredAt: conversionAt.Add(-age)}
+	}
+	return timeline
+}
+
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestAttributionCredits(t *testing.T) {
+	conversionAt := time.Date(2026, 9, 15, 12, 0, 0, 0, time.UTC)
+	week := 7 * 24 * time.Hour
+	three := timelineAt(conversionAt, 14*24*time.Hour, week, 0)
+
+	tests := []struct {
+		name     string
+		model    string
+		timeline []Touchpoint
+		want     []float64
+	}{
+		{name: "last touch", model: AttributionLastTouch, timeline: three, want: []float64{0, 0, 1}},
+		{name: "first touch", model: AttributionFirstTouch, timeline: three, want: []float64{1, 0, 0}},
+		{name: "linear", model: AttributionLinear, timeline: three, want: []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}},
+		{name: "time decay halves per half-life", model: AttributionTimeDecay, timeline: three, want: []float64{1.0 / 7, 2.0 / 7, 4.0 / 7}},
+		{name: "time decay of one touchpoint", model: AttributionTimeDecay, timeline: timelineAt(conversionAt, 3*week), want: []float64{1}},
+		{name: "position based, one touchpoint", model: AttributionPositionBased, timeline: timelineAt(conversionAt, time.Hour), want: []float64{1}},
+		{name: "position based, two touchpoints", model: AttributionPositionBased, timeline: timelineAt(conversionAt, 2*time.Hour, time.Hour), want: []float64{0.5, 0.5}},
+		{name: "position based, three touchpoints", model: AttributionPositionBased, timeline: three, want: []float64{0.4, 0.2, 0.4}},
+		{name: "position based, four touchpoints", model: AttributionPositionBased, timeline: timelineAt(conversionAt, 4*time.Hour, 3*time.Hour, 2*time.Hour, time.Hour), want: []float64{0.4, 0.1, 0.1, 0.4}},
+		{name: "unknown model is last touch", model: "", timeline: three, want: []float64{0, 0, 1}},
+		{name: "empty timeline", model: AttributionLinear, timeline: nil, want: []float64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := attributionCredits(tt.model, tt.timeline, conversionAt, week)
+			if len(got) != len(tt.want) {
+				t.Fatalf("attributionCredits = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !closeTo(got[i], tt.want[i]) {
+					t.Errorf("attributionCredits = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestAttributionCreditsAddUpToOne(t *testing.T) {
+	conversionAt := time.Date(2026, 9, 15, 12, 0, 0, 0, time.UTC)
+	for _, model := range AttributionModels {
+		for n := 1; n <= 6; n++ {
+			ages := make([]time.Duration, n)
+			for i := range ages {
+				ages[i] = time.Duration(n-i) * 36 * time.Hour
+			}
+			total := 0.0
+			for _, credit := range attributionCredits(model, timelineAt(conversionAt, ages...), conversionAt, defaultAttributionHalfLife) {
+				if credit < 0 {
+					t.Errorf("%s with %d touchpoints gave a negative credit", model, n)
+				}
+				total += credit
+			}
+			if !closeTo(total, 1) {
+				t.Errorf("%s credits for %d touchpoints add up to %v, want 1", model, n, total)
+			}
+		}
+	}
+}
+
+func TestTouchpointWindow(t *testing.T) {
+	conversionAt := time.Date(2026, 9, 15, 12, 0, 0, 0, time.UTC)
+	timeline := timelineAt(conversionAt, 48*time.Hour, 24*time.Hour, 0, -time.Hour)
+
+	tests := []struct {
+		name string
+		from time.Time
+		want int
+	}{
+		{name: "bounds included", from: conversionAt.Add(-24 * time.Hour), want: 2},
+		{name: "whole history", from: conversionAt.Add(-72 * time.Hour), want: 3},
+		{name: "nothing before", from: conversionAt.Add(time.Minute), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := touchpointWindow(timeline, tt.from, conversionAt)
+			if len(got) != tt.want {
+				t.Errorf("touchpointWindow = %d touchpoint(s), want %d", len(got), tt.want)
+			}
+			for _, touchpoint := range got {
+				if touchpoint.OccurredAt.Before(tt.from) || touchpoint.OccurredAt.After(conversionAt) {
+					t.Errorf("touchpoint at %v is outside the window", touchpoint.OccurredAt)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareModels(t *testing.T) {
+	db := newTestDB(t)
+	mustExec(t, db, `INSERT INTO brands (id, name, contact_info) VALUES (1, 'Acme', 'a@acme.test'), (2, 'Beta', 'b@beta.test')`)
+	mustExec(t, db, `
+		INSERT INTO events (id, name, location, start_time, end_time, brand_id) VALUES
+			(1, 'Launch', 'Berlin', '2026-09-01 18:00:00', '2026-09-01 22:00:00', 1),
+			(2, 'Pop-up', 'Hamburg', '2026-09-05 18:00:00', '2026-09-05 22:00:00', 1),
+			(3, 'Other brand', 'Munich', '2026-09-03 18:00:00', '2026-09-03 22:00:00', 2)
+	`)
+	// User 1 saw the launch page, visited another brand's event, attended the
+	// pop-up and bought a day later. User 2 attended the launch, bought the
+	// next day and again long after the lookback. User 3 only bought from the
+	// other brand.
+	mustExec(t, db, `
+		INSERT INTO pixel_events (id, user_id, event_id, brand_id, event_type, created_at) VALUES
+			('px_1', '1', '1', '1', 'page_view', '2026-09-01 10:00:00'),
+			('px_2', '1', '3', '2', 'page_view', '2026-09-03 10:00:00'),
+			('px_3', '3', '3', '2', 'page_view', '2026-09-03 10:00:00')
+	`)
+	mustExec(t, db, `
+		INSERT INTO attendances (user_id, event_id, check_in_time) VALUES
+			(1, 2, '2026-09-05 18:00:00'),
+			(2, 1, '2026-09-10 18:00:00')
+	`)
+	mustExec(t, db, `
+		INSERT INTO purchases (id, user_id, product_id, event_id, amount_minor, refunded_minor, currency, status, created_at) VALUES
+			('p_1', '1', 'prod_1', '2', 10000, 0, 'USD', 'completed', '2026-09-06 12:00:00'),
+			('p_2', '2', 'prod_1', '1', 6000, 1000, 'USD', 'partially_refunded', '2026-09-11 12:00:00'),
+			('p_3', '2', 'prod_1', '1', 2500, 0, 'USD', 'completed', '2026-12-20 12:00:00'),
+			('p_4', '3', 'prod_1', '3', 9900, 0, 'USD', 'completed', '2026-09-04 12:00:00')
+	`)
+
+	comparison, err := NewAttributionService(db).CompareModels("1", "1", AttributionOptions{})
+	if err != nil {
+		t.Fatalf("CompareModels: %v", err)
+	}
+	if comparison.Purchases != 2 {
+		t.Errorf("purchases = %d, want 2", comparison.Purchases)
+	}
+
+	// Revenue is net of refunds: 100 from user 1 and 50 from user 2
+	tests := []struct {
+		model           string
+		wantConversions float64
+		wantRevenue     float64
+		wantPixel       float64
+	}{
+		{model: AttributionLastTouch, wantConversions: 1, wantRevenue: 50, wantPixel: 0},
+		{model: AttributionFirstTouch, wantConversions: 2, wantRevenue: 150, wantPixel: 1},
+		{model: AttributionLinear, wantConversions: 1.5, wantRevenue: 100, wantPixel: 0.5},
+		{model: AttributionPositionBased, wantConversions: 1.5, wantRevenue: 100, wantPixel: 0.5},
+	}
+	models := make(map[string]ModelAttribution)
+	for _, result := range comparison.Models {
+		models[result.Model] = result
+	}
+	for _, tt := range tests {
+		got, ok := models[tt.model]
+		if !ok {
+			t.Errorf("model %s missing from the comparison", tt.model)
+			continue
+		}
+		if got.Conversions != tt.wantConversions || got.Revenue != tt.wantRevenue {
+			t.Errorf("%s = %v conversions, %v revenue; want %v, %v",
+				tt.model, got.Conversions, got.Revenue, tt.wantConversions, tt.wantRevenue)
+		}
+		var pixel float64
+		if credit := got.ByTouchpoint[TouchpointPixel]; credit != nil {
+			pixel = credit.Conversions
+		}
+		if pixel != tt.wantPixel {
+			t.Errorf("%s pixel conversions = %v, want %v", tt.model, pixel, tt.wantPixel)
+		}
+	}
+
+	if _, err := NewAttributionService(db).CompareModels("1", "3", AttributionOptions{}); err != ErrEventNotFound {
+		t.Errorf("CompareModels for another brand's event = %v, want ErrEventNotFound", err)
+	}
+}
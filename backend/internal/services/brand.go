@@ -7,7 +7,9 @@ package services
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -22,14 +24,6 @@ type Brand struct {
 	UpdatedAt   time.Time `json:"updatedAt"`
 }
 
-type BrandUser struct {
-	ID      string `json:"id"`
-	BrandID string `json:"brandId"`
-	Name    string `json:"name"`
-	Email   string `json:"email"`
-	Role    string `json:"role"`
-}
-
 type BrandService struct {
 	db *sql.DB
 }
@@ -58,35 +52,239 @@ func (bs *BrandService) GetBrand(brandID string) (*Brand, error) {
 	return &brand, nil
 }
 
-// AuthenticateBrandUser validates brand user credentials
-func (bs *BrandService) AuthenticateBrandUser(email, password string) (*BrandUser, error) {
-	// Simplified authentication - in real implementation would hash passwords
-	if email == "brand@example.com" && password == "password" {
-		return &BrandUser{
-			ID:      "user_1",
-			BrandID: "brand_1",
-			Name:    "Brand Manager",
-			Email:   email,
-			Role:    "admin",
-		}, nil
+// GetBrandAnalytics returns analytics data for a brand's events within a date range
+func (bs *BrandService) GetBrandAnalytics(brandID string, from, to time.Time) (map[string]interface{}, error) {
+	fromStr, toStr := sqliteTime(from), sqliteTime(to)
+
+	attendanceQuery := `
+		SELECT COUNT(DISTINCT a.user_id)
+		FROM attendances a
+		JOIN events e ON a.event_id = e.id
+		WHERE e.brand_id = ? AND a.check_in_time >= ? AND a.check_in_time < ?
+	`
+	var totalAttendees int
+	if err := bs.db.QueryRow(attendanceQuery, brandID, fromStr, toStr).Scan(&totalAttendees); err != nil {
+		return nil, fmt.Errorf("failed to get brand attendance: %w", err)
+	}
+
+	contentQuery := `
+		SELECT COUNT(c.id), COUNT(DISTINCT c.user_id)
+		FROM content c
+		JOIN events e ON c.event_id = e.id
+		WHERE e.brand_id = ? AND c.created_at >= ? AND c.created_at < ?
+	`
+	var contentPieces, contentCreators int
+	if err := bs.db.QueryRow(contentQuery, brandID, fromStr, toStr).Scan(&contentPieces, &contentCreators); err != nil {
+		return nil, fmt.Errorf("failed to get brand content: %w", err)
+	}
+
+	// Engaged users are attendees who created content or interacted with the brand's content
+	engagementQuery := `
+		SELECT COUNT(DISTINCT user_id) FROM (
+			SELECT c.user_id AS user_id
+			FROM content c
+			JOIN events e ON c.event_id = e.id
+			WHERE e.brand_id = ? AND c.created_at >= ? AND c.created_at < ?
+			UNION
+			SELECT ca.user_id AS user_id
+			FROM content_analytics ca
+			JOIN content c ON ca.content_id = c.id
+			JOIN events e ON c.event_id = e.id
+			WHERE e.brand_id = ? AND ca.user_id IS NOT NULL AND ca.created_at >= ? AND ca.created_at < ?
+		)
+	`
+	var engagedUsers int
+	err := bs.db.QueryRow(engagementQuery, brandID, fromStr, toStr, brandID, fromStr, toStr).Scan(&engagedUsers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brand engagement: %w", err)
+	}
+
+	viewsQuery := `
+		SELECT COUNT(*)
+		FROM content_analytics ca
+		JOIN content c ON ca.content_id = c.id
+		JOIN events e ON c.event_id = e.id
+		WHERE e.brand_id = ? AND ca.action = 'view' AND ca.created_at >= ? AND ca.created_at < ?
+	`
+	var contentViews int
+	if err := bs.db.QueryRow(viewsQuery, brandID, fromStr, toStr).Scan(&contentViews); err != nil {
+		return nil, fmt.Errorf("failed to get brand content views: %w", err)
+	}
+
+	visitsQuery := `
+		SELECT COUNT(*), COUNT(DISTINCT user_id)
+		FROM pixel_events
+		WHERE brand_id = ? AND created_at >= ? AND created_at < ?
+	`
+	var pixelEvents, websiteVisitors int
+	if err := bs.db.QueryRow(visitsQuery, brandID, fromStr, toStr).Scan(&pixelEvents, &websiteVisitors); err != nil {
+		return nil, fmt.Errorf("failed to get brand pixel events: %w", err)
+	}
+
+	// Revenue is in the brand's reporting currency and net of refunds;
+	// cancelled and pending orders are not counted
+	purchaseQuery := `
+		SELECT COUNT(p.id), COUNT(DISTINCT p.user_id)
+		FROM purchases p
+		JOIN events e ON p.event_id = e.id
+		WHERE e.brand_id = ? AND ` + soldPurchaseCondition + ` AND p.created_at >= ? AND p.created_at < ?
+	`
+	var purchases, buyers int
+	if err := bs.db.QueryRow(purchaseQuery, brandID, fromStr, toStr).Scan(&purchases, &buyers); err != nil {
+		return nil, fmt.Errorf("failed to get brand purchases: %w", err)
+	}
+
+	converter, err := newReportingConverter(bs.db, brandID)
+	if err != nil {
+		return nil, err
+	}
+	revenueQuery := `
+		SELECT p.currency, ` + grossRevenueSQL + `, ` + refundsSQL + `
+		FROM purchases p
+		JOIN events e ON p.event_id = e.id
+		WHERE e.brand_id = ? AND ` + soldPurchaseCondition + ` AND p.created_at >= ? AND p.created_at < ?
+		GROUP BY p.currency
+	`
+	revenueRows, err := bs.db.Query(revenueQuery, brandID, fromStr, toStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brand revenue: %w", err)
+	}
+	defer revenueRows.Close()
+	var sales revenue
+	for revenueRows.Next() {
+		var currency string
+		var gross, refunds int64
+		if err := revenueRows.Scan(&currency, &gross, &refunds); err != nil {
+			return nil, fmt.Errorf("failed to get brand revenue: %w", err)
+		}
+		sales.add(converter, currency, gross, refunds)
+	}
+	revenueRows.Close()
+
+	topEventsQuery := `
+		SELECT e.id, e.name, COUNT(DISTINCT a.user_id) AS attendees
+		FROM events e
+		JOIN attendances a ON a.event_id = e.id
+		WHERE e.brand_id = ? AND a.check_in_time >= ? AND a.check_in_time < ?
+		GROUP BY e.id
+		ORDER BY attendees DESC
+		LIMIT 5
+	`
+	rows, err := bs.db.Query(topEventsQuery, brandID, fromStr, toStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brand top events: %w", err)
+	}
+	defer rows.Close()
+
+	topEvents := []map[string]interface{}{}
+	for rows.Next() {
+		var eventID, name string
+		var attendees int
+		if err := rows.Scan(&eventID, &name, &attendees); err != nil {
+			return nil, fmt.Errorf("failed to get brand top events: %w", err)
+		}
+		topEvents = append(topEvents, map[string]interface{}{
+			"id":        eventID,
+			"name":      name,
+			"attendees": attendees,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get brand top events: %w", err)
+	}
+
+	engagementRate := 0.0
+	conversionRate := 0.0
+	if totalAttendees > 0 {
+		engagementRate = float64(engagedUsers) / float64(totalAttendees) * 100
+		conversionRate = float64(buyers) / float64(totalAttendees) * 100
 	}
-	
-	return nil, fmt.Errorf("invalid credentials")
-}
 
-// GetBrandAnalytics returns analytics data for a brand
-func (bs *BrandService) GetBrandAnalytics(brandID string) (map[string]interface{}, error) {
-	// Simulate analytics data
 	analytics := map[string]interface{}{
-		"totalAttendees":  1247,
-		"contentPieces":   89,
-		"engagementRate":  23.5,
-		"conversionRate":  4.2,
-		"topEvents": []map[string]interface{}{
-			{"name": "Tech Conference 2024", "attendees": 1247},
-			{"name": "Product Launch", "attendees": 890},
-		},
+		"totalAttendees":  totalAttendees,
+		"contentPieces":   contentPieces,
+		"contentCreators": contentCreators,
+		"contentViews":    contentViews,
+		"engagedUsers":    engagedUsers,
+		"engagementRate":  engagementRate,
+		"websiteVisitors": websiteVisitors,
+		"pixelEvents":     pixelEvents,
+		"purchases":       purchases,
+		"buyers":          buyers,
+		"currency":        converter.currency,
+		"revenue":         converter.major(sales.net()),
+		"grossRevenue":    converter.major(sales.gross),
+		"refunds":         converter.major(sales.refunds),
+		"netRevenue":      converter.major(sales.net()),
+		"missingRates":    converter.missingRates(),
+		"conversionRate":  conversionRate,
+		"topEvents":       topEvents,
 	}
-	
+
 	return analytics, nil
-}
\ No newline at end of file
+}
+
+// GetBrandContent returns user-generated content from the brand's events
+func (bs *BrandService) GetBrandContent(brandID string, limit, offset int) ([]map[string]interface{}, error) {
+	query := `
+		SELECT c.id, c.url, c.type, COALESCE(c.caption, ''), COALESCE(c.tags, ''), c.created_at,
+			e.name, COALESCE(c.view_count, 0), COALESCE(c.share_count, 0),
+			(SELECT COUNT(*) FROM content_analytics ca WHERE ca.content_id = c.id AND ca.action = 'like')
+		FROM content c
+		JOIN events e ON c.event_id = e.id
+		WHERE e.brand_id = ?
+		ORDER BY c.created_at DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := bs.db.Query(query, brandID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brand content: %w", err)
+	}
+	defer rows.Close()
+
+	content := []map[string]interface{}{}
+	for rows.Next() {
+		var contentID, mediaURL, mediaType, caption, tags, eventName string
+		var createdAt time.Time
+		var views, shares, likes int
+
+		err := rows.Scan(&contentID, &mediaURL, &mediaType, &caption, &tags, &createdAt,
+			&eventName, &views, &shares, &likes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get brand content: %w", err)
+		}
+
+		tagList := []string{}
+		if tags != "" {
+			if err := json.Unmarshal([]byte(tags), &tagList); err != nil {
+				tagList = strings.Split(tags, ",")
+			}
+		}
+
+		content = append(content, map[string]interface{}{
+			"id":        contentID,
+			"mediaUrl":  mediaURL,
+			"mediaType": mediaType,
+			"caption":   caption,
+			"tags":      tagList,
+			"createdAt": createdAt.Format(time.RFC3339),
+			"eventName": eventName,
+			"engagement": map[string]int{
+				"views":  views,
+				"shares": shares,
+				"likes":  likes,
+			},
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get brand content: %w", err)
+	}
+
+	return content, nil
+}
+
+// sqliteTime formats a time the way SQLite's CURRENT_TIMESTAMP stores it so range comparisons sort correctly
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
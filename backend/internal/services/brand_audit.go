@@ -0,0 +1,148 @@
+/**
+ * Brand Audit Service
+ * Records who did what within a brand and lists the brand audit log
+ */
+
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ActorSystem marks audit entries of changes made from the command line
+const ActorSystem = "system"
+
+// BrandActor is whoever makes a change to a brand. Role is the actor's brand
+// role, empty for platform admins and the command line.
+type BrandActor struct {
+	Type      string
+	ID        string
+	Role      string
+	IPAddress string
+	UserAgent string
+}
+
+// BrandAuditEntry is one recorded change within a brand
+type BrandAuditEntry struct {
+	ID         int64                  `json:"id"`
+	BrandID    string                 `json:"brandId"`
+	ActorType  string                 `json:"actorType"`
+	ActorID    string                 `json:"actorId,omitempty"`
+	ActorEmail string                 `json:"actorEmail,omitempty"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"targetType,omitempty"`
+	TargetID   string                 `json:"targetId,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	IPAddress  string                 `json:"ipAddress,omitempty"`
+	UserAgent  string                 `json:"userAgent,omitempty"`
+	CreatedAt  time.Time              `json:"createdAt"`
+}
+
+// BrandAuditFilter narrows an audit log listing
+type BrandAuditFilter struct {
+	ActorID string
+	Action  string
+	From    time.Time
+	To      time.Time
+	Limit   int
+	Offset  int
+}
+
+type BrandAuditService struct {
+	db *sql.DB
+}
+
+func NewBrandAuditService(db *sql.DB) *BrandAuditService {
+	return &BrandAuditService{db: db}
+}
+
+// Record adds an entry to the brand's audit log
+func (bas *BrandAuditService) Record(brandID string, actor BrandActor, action, targetType, targetID string, details map[string]interface{}) error {
+	return recordBrandAudit(bas.db, brandID, actor, action, targetType, targetID, details)
+}
+
+// List returns the brand's audit log, newest first
+func (bas *BrandAuditService) List(brandID string, filter BrandAuditFilter) ([]BrandAuditEntry, error) {
+	query := `
+		SELECT l.id, l.brand_id, l.actor_type, COALESCE(l.actor_id, ''), COALESCE(a.email, ad.email, ''), l.action,
+		       COALESCE(l.target_type, ''), COALESCE(l.target_id, ''), COALESCE(l.details, ''),
+		       COALESCE(l.ip_address, ''), COALESCE(l.user_agent, ''), l.created_at
+		FROM brand_audit_log l
+		LEFT JOIN brand_accounts a ON l.actor_type = 'brand_member' AND a.id = l.actor_id
+		LEFT JOIN admin_accounts ad ON l.actor_type = 'admin' AND ad.id = l.actor_id
+		WHERE l.brand_id = ?
+	`
+	args := []interface{}{brandID}
+	if filter.ActorID != "" {
+		query += ` AND l.actor_id = ?`
+		args = append(args, filter.ActorID)
+	}
+	if filter.Action != "" {
+		query += ` AND l.action = ?`
+		args = append(args, filter.Action)
+	}
+	if !filter.From.IsZero() {
+		query += ` AND l.created_at >= ?`
+		args = append(args, sqliteTime(filter.From))
+	}
+	if !filter.To.IsZero() {
+		query += ` AND l.created_at < ?`
+		args = append(args, sqliteTime(filter.To))
+	}
+	query += ` ORDER BY l.created_at DESC, l.id DESC LIMIT ? OFFSET ?`
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := bas.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []BrandAuditEntry{}
+	for rows.Next() {
+		var entry BrandAuditEntry
+		var details string
+		if err := rows.Scan(&entry.ID, &entry.BrandID, &entry.ActorType, &entry.ActorID, &entry.ActorEmail, &entry.Action,
+			&entry.TargetType, &entry.TargetID, &details, &entry.IPAddress, &entry.UserAgent, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to list audit log: %w", err)
+		}
+		if details != "" {
+			if err := json.Unmarshal([]byte(details), &entry.Details); err != nil {
+				return nil, fmt.Errorf("failed to decode audit details: %w", err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// auditExecer is satisfied by both *sql.DB and *sql.Tx, so changes can be
+// audited in the transaction that makes them
+type auditExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func recordBrandAudit(db auditExecer, brandID string, actor BrandActor, action, targetType, targetID string, details map[string]interface{}) error {
+	var detailsJSON interface{}
+	if len(details) > 0 {
+		encoded, err := json.Marshal(details)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+		detailsJSON = string(encoded)
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO brand_audit_log (brand_id, actor_type, actor_id, action, target_type, target_id, details, ip_address, user_agent, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, brandID, actor.Type, nullIfEmpty(actor.ID), action, nullIfEmpty(targetType), nullIfEmpty(targetID), detailsJSON,
+		nullIfEmpty(actor.IPAddress), nullIfEmpty(actor.UserAgent), sqliteTime(time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,800 @@
+/**
+ * Brand Member Service
+ * Brand accounts, their roles within brands and member invitations
+ */
+
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"lynkr/internal/auth"
+	mailer "lynkr/pkg/mail"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrNotBrandMember     = errors.New("not a member of this brand")
+	ErrMemberNotFound     = errors.New("member not found")
+	ErrAlreadyBrandMember = errors.New("already a member of this brand")
+	ErrInvalidBrandRole   = errors.New("invalid brand role")
+	ErrInvalidMember      = errors.New("invalid member details")
+	ErrOwnerRequired      = errors.New("only owners can grant or change the owner role")
+	ErrLastOwner          = errors.New("a brand needs at least one owner")
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvalidInvitation  = errors.New("invitation is invalid, expired or already used")
+)
+
+// Invitation statuses
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+const minPasswordLength = 8
+
+// BrandUser is a brand account logged in to one of its brands
+type BrandUser struct {
+	ID          string            `json:"id"`
+	BrandID     string            `json:"brandId"`
+	Name        string            `json:"name"`
+	Email       string            `json:"email"`
+	Role        string            `json:"role"`
+	Permissions []auth.Permission `json:"permissions"`
+	Brands      []BrandMembership `json:"brands"` // every brand the account is a member of
+}
+
+// BrandMembership is an account's role within one brand
+type BrandMembership struct {
+	BrandID   string `json:"brandId"`
+	BrandName string `json:"brandName"`
+	Role      string `json:"role"`
+}
+
+// BrandMember is a member as listed to the brand
+type BrandMember struct {
+	ID          string     `json:"id"`
+	Email       string     `json:"email"`
+	Name        string     `json:"name"`
+	Role        string     `json:"role"`
+	InvitedBy   string     `json:"invitedBy,omitempty"`
+	JoinedAt    time.Time  `json:"joinedAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty"`
+}
+
+// BrandInvitation is an invitation to join a brand. The token that accepts
+// it is only ever emailed.
+type BrandInvitation struct {
+	ID        string    `json:"id"`
+	BrandID   string    `json:"brandId"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invitedBy,omitempty"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+	EmailSent bool      `json:"emailSent"`
+}
+
+// InvitationPreview is what the invitee sees before accepting.
+// AccountExists tells the portal to ask for the existing password.
+type InvitationPreview struct {
+	BrandName     string    `json:"brandName"`
+	Email         string    `json:"email"`
+	Role          string    `json:"role"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	AccountExists bool      `json:"accountExists"`
+}
+
+// MemberOptions configures invitations
+type MemberOptions struct {
+	PortalURL     string        // origin of the brand portal the invitation links to
+	InvitationTTL time.Duration // how long an invitation can be accepted
+}
+
+type BrandMemberService struct {
+	db      *sql.DB
+	mailer  mailer.Sender
+	options MemberOptions
+}
+
+func NewBrandMemberService(db *sql.DB, sender mailer.Sender, options MemberOptions) *BrandMemberService {
+	if options.InvitationTTL <= 0 {
+		options.InvitationTTL = 7 * 24 * time.Hour
+	}
+	return &BrandMemberService{db: db, mailer: sender, options: options}
+}
+
+// Authenticate checks a brand account's credentials and logs it in to a
+// brand. Without a brand ID the account's first brand is used.
+func (bms *BrandMemberService) Authenticate(email, password, brandID string) (*BrandUser, error) {
+	var accountID string
+	var passwordHash sql.NullString
+	err := bms.db.QueryRow(`SELECT id, password_hash FROM brand_accounts WHERE email = ?`, normalizeEmail(email)).
+		Scan(&accountID, &passwordHash)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate brand account: %w", err)
+	}
+	if !passwordHash.Valid || bcrypt.CompareHashAndPassword([]byte(passwordHash.String), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	user, err := bms.GetBrandUser(accountID, brandID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := bms.db.Exec(`UPDATE brand_accounts SET last_login_at = ? WHERE id = ?`, sqliteTime(time.Now()), accountID); err != nil {
+		return nil, fmt.Errorf("failed to record login: %w", err)
+	}
+	return user, nil
+}
+
+// GetBrandUser returns an account as a member of a brand, or of its first
+// brand without a brand ID
+func (bms *BrandMemberService) GetBrandUser(accountID, brandID string) (*BrandUser, error) {
+	user := &BrandUser{ID: accountID}
+	err := bms.db.QueryRow(`SELECT email, name FROM brand_accounts WHERE id = ?`, accountID).Scan(&user.Email, &user.Name)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotBrandMember
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brand account: %w", err)
+	}
+
+	rows, err := bms.db.Query(`
+		SELECT m.brand_id, COALESCE(b.name, ''), m.role
+		FROM brand_members m
+		LEFT JOIN brands b ON CAST(b.id AS TEXT) = m.brand_id
+		WHERE m.account_id = ?
+		ORDER BY m.created_at, m.brand_id
+	`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brand memberships: %w", err)
+	}
+	defer rows.Close()
+
+	user.Brands = []BrandMembership{}
+	for rows.Next() {
+		var membership BrandMembership
+		if err := rows.Scan(&membership.BrandID, &membership.BrandName, &membership.Role); err != nil {
+			return nil, fmt.Errorf("failed to get brand memberships: %w", err)
+		}
+		user.Brands = append(user.Brands, membership)
+		if user.BrandID == "" && (brandID == "" || membership.BrandID == brandID) {
+			user.BrandID = membership.BrandID
+			user.Role = membership.Role
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get brand memberships: %w", err)
+	}
+	if user.BrandID == "" {
+		return nil, ErrNotBrandMember
+	}
+
+	user.Permissions = auth.BrandRolePermissions(user.Role)
+	return user, nil
+}
+
+// MemberRole returns the role of an account within a brand
+func (bms *BrandMemberService) MemberRole(brandID, accountID string) (string, error) {
+	var role string
+	err := bms.db.QueryRow(`SELECT role FROM brand_members WHERE brand_id = ? AND account_id = ?`, brandID, accountID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrNotBrandMember
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get member role: %w", err)
+	}
+	return role, nil
+}
+
+// ListMembers returns the members of a brand, owners first
+func (bms *BrandMemberService) ListMembers(brandID string) ([]BrandMember, error) {
+	rows, err := bms.db.Query(`
+		SELECT a.id, a.email, a.name, m.role, COALESCE(m.invited_by, ''), m.created_at, a.last_login_at
+		FROM brand_members m
+		JOIN brand_accounts a ON a.id = m.account_id
+		WHERE m.brand_id = ?
+		ORDER BY CASE m.role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END, a.name, a.email
+	`, brandID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []BrandMember{}
+	for rows.Next() {
+		member, err := scanBrandMember(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list members: %w", err)
+		}
+		members = append(members, *member)
+	}
+	return members, rows.Err()
+}
+
+// UpdateMemberRole changes the role of a member. Only owners can make
+// someone an owner or change the role of an owner, and the last owner
+// cannot step down.
+func (bms *BrandMemberService) UpdateMemberRole(brandID string, actor BrandActor, accountID, role string) (*BrandMember, error) {
+	if !auth.ValidBrandRole(role) {
+		return nil, ErrInvalidBrandRole
+	}
+
+	tx, err := bms.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update member role: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := memberRole(tx, brandID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if current == role {
+		return bms.getMember(tx, brandID, accountID)
+	}
+	if (role == auth.BrandRoleOwner || current == auth.BrandRoleOwner) && !actor.canManageOwners() {
+		return nil, ErrOwnerRequired
+	}
+	if current == auth.BrandRoleOwner {
+		if err := ensureAnotherOwner(tx, brandID, accountID); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE brand_members SET role = ?, updated_at = ? WHERE brand_id = ? AND account_id = ?`,
+		role, sqliteTime(time.Now()), brandID, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update member role: %w", err)
+	}
+	details := map[string]interface{}{"from": current, "to": role}
+	if err := recordBrandAudit(tx, brandID, actor, "member.role_changed", "member", accountID, details); err != nil {
+		return nil, err
+	}
+
+	member, err := bms.getMember(tx, brandID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update member role: %w", err)
+	}
+	return member, nil
+}
+
+// RemoveMember takes an account out of a brand. The account itself remains
+// and keeps its other brands.
+func (bms *BrandMemberService) RemoveMember(brandID string, actor BrandActor, accountID string) error {
+	tx, err := bms.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+	defer tx.Rollback()
+
+	member, err := bms.getMember(tx, brandID, accountID)
+	if err != nil {
+		return err
+	}
+	if member.Role == auth.BrandRoleOwner {
+		if !actor.canManageOwners() {
+			return ErrOwnerRequired
+		}
+		if err := ensureAnotherOwner(tx, brandID, accountID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM brand_members WHERE brand_id = ? AND account_id = ?`, brandID, accountID); err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+	details := map[string]interface{}{"email": member.Email, "role": member.Role}
+	if err := recordBrandAudit(tx, brandID, actor, "member.removed", "member", accountID, details); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+	return nil
+}
+
+// Invite emails an invitation to join a brand with a role. A new invitation
+// replaces a pending one for the same email. The returned URL accepts the
+// invitation; it is only meant for the command line.
+func (bms *BrandMemberService) Invite(brandID string, actor BrandActor, email, role string) (*BrandInvitation, string, error) {
+	email, err := validateEmail(email)
+	if err != nil {
+		return nil, "", err
+	}
+	if !auth.ValidBrandRole(role) {
+		return nil, "", ErrInvalidBrandRole
+	}
+	if role == auth.BrandRoleOwner && !actor.canManageOwners() {
+		return nil, "", ErrOwnerRequired
+	}
+	brandName, err := bms.brandName(brandID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tx, err := bms.db.Begin()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create invitation: %w", err)
+	}
+	defer tx.Rollback()
+
+	var members int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM brand_members m JOIN brand_accounts a ON a.id = m.account_id
+		WHERE m.brand_id = ? AND a.email = ?
+	`, brandID, email).Scan(&members)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create invitation: %w", err)
+	}
+	if members > 0 {
+		return nil, "", ErrAlreadyBrandMember
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	_, err = tx.Exec(`
+		UPDATE brand_invitations SET revoked_at = ?
+		WHERE brand_id = ? AND email = ? AND accepted_at IS NULL AND revoked_at IS NULL
+	`, sqliteTime(now), brandID, email)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to replace invitation: %w", err)
+	}
+
+	token, tokenHash, err := generateInvitationToken()
+	if err != nil {
+		return nil, "", err
+	}
+	invitation := &BrandInvitation{
+		ID:        fmt.Sprintf("invitation_%d", time.Now().UnixNano()),
+		BrandID:   brandID,
+		Email:     email,
+		Role:      role,
+		InvitedBy: actor.memberID(),
+		Status:    InvitationPending,
+		ExpiresAt: now.Add(bms.options.InvitationTTL),
+		CreatedAt: now,
+	}
+	_, err = tx.Exec(`
+		INSERT INTO brand_invitations (id, brand_id, email, role, token_hash, invited_by, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, invitation.ID, brandID, email, role, tokenHash, nullIfEmpty(invitation.InvitedBy),
+		sqliteTime(invitation.ExpiresAt), sqliteTime(now))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create invitation: %w", err)
+	}
+	details := map[string]interface{}{"email": email, "role": role}
+	if err := recordBrandAudit(tx, brandID, actor, "member.invited", "invitation", invitation.ID, details); err != nil {
+		return nil, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	acceptURL := bms.acceptURL(token)
+	invitation.EmailSent = bms.sendInvitation(brandName, invitation, acceptURL)
+	return invitation, acceptURL, nil
+}
+
+// ResendInvitation emails a pending invitation again with a new token and
+// expiry. The previously emailed link stops working.
+func (bms *BrandMemberService) ResendInvitation(brandID string, actor BrandActor, invitationID string) (*BrandInvitation, string, error) {
+	brandName, err := bms.brandName(brandID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tx, err := bms.db.Begin()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resend invitation: %w", err)
+	}
+	defer tx.Rollback()
+
+	invitation, err := getInvitation(tx, brandID, invitationID)
+	if err != nil {
+		return nil, "", err
+	}
+	if invitation.Status != InvitationPending && invitation.Status != InvitationExpired {
+		return nil, "", ErrInvalidInvitation
+	}
+	if invitation.Role == auth.BrandRoleOwner && !actor.canManageOwners() {
+		return nil, "", ErrOwnerRequired
+	}
+
+	token, tokenHash, err := generateInvitationToken()
+	if err != nil {
+		return nil, "", err
+	}
+	invitation.ExpiresAt = time.Now().UTC().Truncate(time.Second).Add(bms.options.InvitationTTL)
+	invitation.Status = InvitationPending
+	_, err = tx.Exec(`UPDATE brand_invitations SET token_hash = ?, expires_at = ? WHERE id = ?`,
+		tokenHash, sqliteTime(invitation.ExpiresAt), invitation.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resend invitation: %w", err)
+	}
+	details := map[string]interface{}{"email": invitation.Email, "role": invitation.Role}
+	if err := recordBrandAudit(tx, brandID, actor, "invitation.resent", "invitation", invitation.ID, details); err != nil {
+		return nil, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("failed to resend invitation: %w", err)
+	}
+
+	acceptURL := bms.acceptURL(token)
+	invitation.EmailSent = bms.sendInvitation(brandName, invitation, acceptURL)
+	return invitation, acceptURL, nil
+}
+
+// RevokeInvitation withdraws a pending invitation
+func (bms *BrandMemberService) RevokeInvitation(brandID string, actor BrandActor, invitationID string) error {
+	tx, err := bms.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	defer tx.Rollback()
+
+	invitation, err := getInvitation(tx, brandID, invitationID)
+	if err != nil {
+		return err
+	}
+	if invitation.Status != InvitationPending && invitation.Status != InvitationExpired {
+		return ErrInvalidInvitation
+	}
+
+	if _, err := tx.Exec(`UPDATE brand_invitations SET revoked_at = ? WHERE id = ?`, sqliteTime(time.Now()), invitationID); err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	details := map[string]interface{}{"email": invitation.Email, "role": invitation.Role}
+	if err := recordBrandAudit(tx, brandID, actor, "invitation.revoked", "invitation", invitationID, details); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	return nil
+}
+
+// ListInvitations returns the brand's open invitations, including expired
+// ones that can still be resent
+func (bms *BrandMemberService) ListInvitations(brandID string) ([]BrandInvitation, error) {
+	rows, err := bms.db.Query(invitationSelect+`
+		WHERE brand_id = ? AND accepted_at IS NULL AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, brandID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []BrandInvitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list invitations: %w", err)
+		}
+		invitations = append(invitations, *invitation)
+	}
+	return invitations, rows.Err()
+}
+
+// PreviewInvitation returns the brand and role an invitation token is for
+func (bms *BrandMemberService) PreviewInvitation(token string) (*InvitationPreview, error) {
+	invitation, err := pendingInvitation(bms.db, token)
+	if err != nil {
+		return nil, err
+	}
+	brandName, err := bms.brandName(invitation.BrandID)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts int
+	if err := bms.db.QueryRow(`SELECT COUNT(*) FROM brand_accounts WHERE email = ?`, invitation.Email).Scan(&accounts); err != nil {
+		return nil, fmt.Errorf("failed to preview invitation: %w", err)
+	}
+	return &InvitationPreview{
+		BrandName:     brandName,
+		Email:         invitation.Email,
+		Role:          invitation.Role,
+		ExpiresAt:     invitation.ExpiresAt,
+		AccountExists: accounts > 0,
+	}, nil
+}
+
+// AcceptInvitation adds the invited email to the brand. Someone without a
+// brand account creates one with a name and password; someone with an
+// account confirms it with their password.
+func (bms *BrandMemberService) AcceptInvitation(token, name, password string) (*BrandUser, error) {
+	tx, err := bms.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+	defer tx.Rollback()
+
+	invitation, err := pendingInvitation(tx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	now := sqliteTime(time.Now())
+	var accountID string
+	var passwordHash sql.NullString
+	err = tx.QueryRow(`SELECT id, password_hash FROM brand_accounts WHERE email = ?`, invitation.Email).Scan(&accountID, &passwordHash)
+	switch {
+	case err == sql.ErrNoRows:
+		name = strings.TrimSpace(name)
+		if name == "" || len(password) < minPasswordLength {
+			return nil, fmt.Errorf("%w: a name and a password of at least %d characters are required", ErrInvalidMember, minPasswordLength)
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
+		accountID = fmt.Sprintf("account_%d", time.Now().UnixNano())
+		_, err = tx.Exec(`
+			INSERT INTO brand_accounts (id, email, name, password_hash, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		`, accountID, invitation.Email, name, string(hash), now, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create brand account: %w", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	case passwordHash.Valid:
+		if bcrypt.CompareHashAndPassword([]byte(passwordHash.String), []byte(password)) != nil {
+			return nil, ErrInvalidCredentials
+		}
+	default:
+		// The account has no password yet, e.g. one created by single sign-on
+		if len(password) < minPasswordLength {
+			return nil, fmt.Errorf("%w: a password of at least %d characters is required", ErrInvalidMember, minPasswordLength)
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE brand_accounts SET password_hash = ?, updated_at = ? WHERE id = ?`, string(hash), now, accountID); err != nil {
+			return nil, fmt.Errorf("failed to set password: %w", err)
+		}
+	}
+
+	// An account that already joined keeps its role
+	_, err = tx.Exec(`
+		INSERT OR IGNORE INTO brand_members (brand_id, account_id, role, invited_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, invitation.BrandID, accountID, invitation.Role, nullIfEmpty(invitation.InvitedBy), now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add member: %w", err)
+	}
+	_, err = tx.Exec(`UPDATE brand_invitations SET accepted_at = ?, accepted_by = ? WHERE id = ?`, now, accountID, invitation.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+	actor := BrandActor{Type: string(auth.PrincipalBrandMember), ID: accountID}
+	details := map[string]interface{}{"invitationId": invitation.ID, "role": invitation.Role}
+	if err := recordBrandAudit(tx, invitation.BrandID, actor, "member.joined", "member", accountID, details); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to accept invitation: %w", err)
+	}
+	return bms.GetBrandUser(accountID, invitation.BrandID)
+}
+
+func (bms *BrandMemberService) brandName(brandID string) (string, error) {
+	var name string
+	err := bms.db.QueryRow(`SELECT name FROM brands WHERE CAST(id AS TEXT) = ?`, brandID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", ErrBrandNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get brand: %w", err)
+	}
+	return name, nil
+}
+
+func (bms *BrandMemberService) getMember(db rowQuerier, brandID, accountID string) (*BrandMember, error) {
+	member, err := scanBrandMember(db.QueryRow(`
+		SELECT a.id, a.email, a.name, m.role, COALESCE(m.invited_by, ''), m.created_at, a.last_login_at
+		FROM brand_members m
+		JOIN brand_accounts a ON a.id = m.account_id
+		WHERE m.brand_id = ? AND m.account_id = ?
+	`, brandID, accountID))
+	if err == sql.ErrNoRows {
+		return nil, ErrMemberNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+	return member, nil
+}
+
+func (bms *BrandMemberService) acceptURL(token string) string {
+	return strings.TrimRight(bms.options.PortalURL, "/") + "/invitations/accept?token=" + url.QueryEscape(token)
+}
+
+// sendInvitation emails the invitation link. Failures are logged and the
+// invitation can be resent.
+func (bms *BrandMemberService) sendInvitation(brandName string, invitation *BrandInvitation, acceptURL string) bool {
+	if bms.mailer == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := bms.mailer.Send(ctx, mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You're invited to join %s on Lynkr", brandName),
+		Body: fmt.Sprintf("You have been invited to join %s on Lynkr as %s.\n\n"+
+			"Accept the invitation here:\n%s\n\n"+
+			"The link expires on %s. If you did not expect this invitation you can ignore this email.\n",
+			brandName, invitation.Role, acceptURL, invitation.ExpiresAt.Format("January 2, 2006 15:04 MST")),
+	})
+	if err != nil {
+		log.Printf("Failed to email invitation %s: %v", invitation.ID, err)
+		return false
+	}
+	return true
+}
+
+// canManageOwners reports whether the actor may grant or take away the
+// owner role: brand owners, platform admins and the command line
+func (actor BrandActor) canManageOwners() bool {
+	return actor.Role == auth.BrandRoleOwner || actor.Type == string(auth.PrincipalAdmin) || actor.Type == ActorSystem
+}
+
+// memberID is the brand account behind the actor, if any
+func (actor BrandActor) memberID() string {
+	if actor.Type != string(auth.PrincipalBrandMember) {
+		return ""
+	}
+	return actor.ID
+}
+
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func memberRole(db rowQuerier, brandID, accountID string) (string, error) {
+	var role string
+	err := db.QueryRow(`SELECT role FROM brand_members WHERE brand_id = ? AND account_id = ?`, brandID, accountID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrMemberNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get member role: %w", err)
+	}
+	return role, nil
+}
+
+func ensureAnotherOwner(db rowQuerier, brandID, accountID string) error {
+	var owners int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM brand_members WHERE brand_id = ? AND role = 'owner' AND account_id != ?
+	`, brandID, accountID).Scan(&owners)
+	if err != nil {
+		return fmt.Errorf("failed to count owners: %w", err)
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+const invitationSelect = `
+	SELECT id, brand_id, email, role, COALESCE(invited_by, ''), expires_at, created_at,
+	       accepted_at IS NOT NULL, revoked_at IS NOT NULL
+	FROM brand_invitations
+`
+
+func getInvitation(db rowQuerier, brandID, invitationID string) (*BrandInvitation, error) {
+	invitation, err := scanInvitation(db.QueryRow(invitationSelect+` WHERE brand_id = ? AND id = ?`, brandID, invitationID))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	return invitation, nil
+}
+
+// pendingInvitation looks up the invitation an emailed token accepts
+func pendingInvitation(db rowQuerier, token string) (*BrandInvitation, error) {
+	invitation, err := scanInvitation(db.QueryRow(invitationSelect+` WHERE token_hash = ?`, hashSecretToken(token)))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidInvitation
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	if invitation.Status != InvitationPending {
+		return nil, ErrInvalidInvitation
+	}
+	return invitation, nil
+}
+
+func scanInvitation(row rowScanner) (*BrandInvitation, error) {
+	var invitation BrandInvitation
+	var accepted, revoked bool
+	if err := row.Scan(&invitation.ID, &invitation.BrandID, &invitation.Email, &invitation.Role, &invitation.InvitedBy,
+		&invitation.ExpiresAt, &invitation.CreatedAt, &accepted, &revoked); err != nil {
+		return nil, err
+	}
+	switch {
+	case accepted:
+		invitation.Status = InvitationAccepted
+	case revoked:
+		invitation.Status = InvitationRevoked
+	case time.Now().After(invitation.ExpiresAt):
+		invitation.Status = InvitationExpired
+	default:
+		invitation.Status = InvitationPending
+	}
+	return &invitation, nil
+}
+
+func scanBrandMember(row rowScanner) (*BrandMember, error) {
+	var member BrandMember
+	var lastLogin sql.NullTime
+	if err := row.Scan(&member.ID, &member.Email, &member.Name, &member.Role, &member.InvitedBy, &member.JoinedAt, &lastLogin); err != nil {
+		return nil, err
+	}
+	if lastLogin.Valid {
+		member.LastLoginAt = &lastLogin.Time
+	}
+	return &member, nil
+}
+
+func generateInvitationToken() (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	return token, hashSecretToken(token), nil
+}
+
+func hashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validateEmail normalizes an email address and rejects anything that is
+// not a bare address
+func validateEmail(email string) (string, error) {
+	email = normalizeEmail(email)
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", fmt.Errorf("%w: invalid email address", ErrInvalidMember)
+	}
+	return email, nil
+}
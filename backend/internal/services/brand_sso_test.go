@@ -0,0 +1,349 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"testing"
+
+	"lynkr/pkg/mail"
+	"lynkr/pkg/oidc"
+	"lynkr/pkg/oidc/oidctest"
+)
+
+// ssoTest is a brand SSO service wired to a mock provider, with two brands
+type ssoTest struct {
+	db       *sql.DB
+	provider *oidctest.Provider
+	members  *BrandMemberService
+	sso      *BrandSSOService
+}
+
+func newSSOTest(t *testing.T, options SSOOptions) *ssoTest {
+	t.Helper()
+	db := newTestDB(t)
+	if _, err := db.Exec(`INSERT INTO brands (id, name, contact_info) VALUES (1, 'Acme', 'a@acme.test'), (2, 'Beta', 'b@beta.test')`); err != nil {
+		t.Fatalf("failed to create brands: %v", err)
+	}
+
+	mockProvider, server := oidctest.NewServer(oidctest.Options{ClientID: "lynkr", ClientSecret: "s3cret"})
+	t.Cleanup(server.Close)
+	provider, err := oidc.New(oidc.Config{
+		Issuer:       mockProvider.Issuer(),
+		ClientID:     "lynkr",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://api.test/api/v1/brands/sso/callback",
+	})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	sender, err := mail.New(mail.Config{Dir: t.TempDir(), From: "no-reply@lynkr.test"})
+	if err != nil {
+		t.Fatalf("failed to create mail sender: %v", err)
+	}
+	members := NewBrandMemberService(db, sender, MemberOptions{})
+	if options.PortalURL == "" {
+		options.PortalURL = "http://portal.test"
+	}
+	return &ssoTest{
+		db:       db,
+		provider: mockProvider,
+		members:  members,
+		sso:      NewBrandSSOService(db, provider, members, options),
+	}
+}
+
+// login runs the whole sign-in: start, provider login, callback and redeeming
+// the portal's login code
+func (st *ssoTest) login(t *testing.T, brandID string, user oidctest.User) (*BrandUser, error) {
+	t.Helper()
+	ctx := context.Background()
+	authURL, err := st.sso.StartLogin(ctx, brandID, "/dashboard")
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	callback, err := st.provider.Login(authURL, user)
+	if err != nil {
+		t.Fatalf("provider login: %v", err)
+	}
+	portalURL, err := st.sso.CompleteLogin(ctx, callback.Query().Get("state"), callback.Query().Get("code"))
+	if err != nil {
+		return nil, err
+	}
+	portal, err := url.Parse(portalURL)
+	if err != nil {
+		t.Fatalf("invalid portal URL %q: %v", portalURL, err)
+	}
+	if portal.Host != "portal.test" || portal.Path != "/sso/callback" || portal.Query().Get("redirect") != "/dashboard" {
+		t.Errorf("portal URL = %s", portalURL)
+	}
+	return st.sso.RedeemLogin(portal.Query().Get("code"))
+}
+
+func (st *ssoTest) count(t *testing.T, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := st.db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("count query failed: %v", err)
+	}
+	return n
+}
+
+func TestBrandSSOStateAndCodesWorkOnce(t *testing.T) {
+	st := newSSOTest(t, SSOOptions{})
+	if _, err := st.sso.SetSSODomain(AdminActor{}, "1", "acme.test", "analyst"); err != nil {
+		t.Fatalf("SetSSODomain: %v", err)
+	}
+	ctx := context.Background()
+
+	authURL, err := st.sso.StartLogin(ctx, "", "//evil.test/phish")
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	query := mustParseURL(t, authURL).Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" || query.Get("nonce") == "" {
+		t.Fatalf("authorization URL lacks PKCE or a nonce: %s", authURL)
+	}
+	callback, err := st.provider.Login(authURL, oidctest.User{Email: "jane@acme.test", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("provider login: %v", err)
+	}
+	state, code := callback.Query().Get("state"), callback.Query().Get("code")
+
+	if _, err := st.sso.CompleteLogin(ctx, state+"x", code); !errors.Is(err, ErrInvalidSSORequest) {
+		t.Errorf("unknown state: err = %v, want ErrInvalidSSORequest", err)
+	}
+	portalURL, err := st.sso.CompleteLogin(ctx, state, code)
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if _, err := st.sso.CompleteLogin(ctx, state, code); !errors.Is(err, ErrInvalidSSORequest) {
+		t.Errorf("replayed state: err = %v, want ErrInvalidSSORequest", err)
+	}
+
+	portal := mustParseURL(t, portalURL)
+	if redirect := portal.Query().Get("redirect"); redirect != "" {
+		t.Errorf("redirect = %q, want off-site redirects dropped", redirect)
+	}
+	loginCode := portal.Query().Get("code")
+	user, err := st.sso.RedeemLogin(loginCode)
+	if err != nil {
+		t.Fatalf("RedeemLogin: %v", err)
+	}
+	if user.Email != "jane@acme.test" || user.BrandID != "1" {
+		t.Errorf("user = %+v", user)
+	}
+	if _, err := st.sso.RedeemLogin(loginCode); !errors.Is(err, ErrInvalidSSOCode) {
+		t.Errorf("reused login code: err = %v, want ErrInvalidSSOCode", err)
+	}
+}
+
+func TestBrandSSORejectsWrongCodeVerifier(t *testing.T) {
+	st := newSSOTest(t, SSOOptions{})
+	ctx := context.Background()
+
+	authURL, err := st.sso.StartLogin(ctx, "", "")
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	// A code intercepted on its way back cannot be redeemed without the verifier
+	if _, err := st.db.Exec(`UPDATE brand_sso_requests SET code_verifier = 'not-the-verifier'`); err != nil {
+		t.Fatalf("failed to replace verifier: %v", err)
+	}
+	callback, err := st.provider.Login(authURL, oidctest.User{Email: "jane@acme.test", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("provider login: %v", err)
+	}
+	_, err = st.sso.CompleteLogin(ctx, callback.Query().Get("state"), callback.Query().Get("code"))
+	if !errors.Is(err, oidc.ErrExchange) {
+		t.Errorf("err = %v, want oidc.ErrExchange", err)
+	}
+}
+
+func TestBrandSSOEmailVerification(t *testing.T) {
+	tests := []struct {
+		name                 string
+		allowUnverifiedEmail bool
+		emailVerified        bool
+		wantErr              error
+	}{
+		{name: "verified email", emailVerified: true},
+		{name: "unverified email", wantErr: ErrSSOEmailRequired},
+		{name: "unverified email allowed", allowUnverifiedEmail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newSSOTest(t, SSOOptions{AllowUnverifiedEmail: tt.allowUnverifiedEmail})
+			if _, err := st.sso.SetSSODomain(AdminActor{}, "1", "acme.test", "analyst"); err != nil {
+				t.Fatalf("SetSSODomain: %v", err)
+			}
+
+			user, err := st.login(t, "", oidctest.User{Email: "jane@acme.test", EmailVerified: tt.emailVerified})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			wantAccounts := 1
+			if tt.wantErr != nil {
+				wantAccounts = 0
+			} else if user.Email != "jane@acme.test" {
+				t.Errorf("user = %+v", user)
+			}
+			if n := st.count(t, `SELECT COUNT(*) FROM brand_accounts`); n != wantAccounts {
+				t.Errorf("%d accounts, want %d", n, wantAccounts)
+			}
+		})
+	}
+}
+
+func TestBrandSSORefusesPeopleWithoutBrand(t *testing.T) {
+	st := newSSOTest(t, SSOOptions{})
+	if _, err := st.sso.SetSSODomain(AdminActor{}, "1", "acme.test", "analyst"); err != nil {
+		t.Fatalf("SetSSODomain: %v", err)
+	}
+
+	_, err := st.login(t, "", oidctest.User{Email: "someone@elsewhere.test", EmailVerified: true})
+	if !errors.Is(err, ErrNotBrandMember) {
+		t.Fatalf("err = %v, want ErrNotBrandMember", err)
+	}
+	if n := st.count(t, `SELECT COUNT(*) FROM brand_accounts`); n != 0 {
+		t.Errorf("%d accounts created for a refused login", n)
+	}
+	if n := st.count(t, `SELECT COUNT(*) FROM brand_sso_identities`); n != 0 {
+		t.Errorf("%d identities linked for a refused login", n)
+	}
+}
+
+func TestBrandSSODomainAutoJoin(t *testing.T) {
+	st := newSSOTest(t, SSOOptions{})
+	if _, err := st.sso.SetSSODomain(AdminActor{}, "1", "ACME.test", "analyst"); err != nil {
+		t.Fatalf("SetSSODomain: %v", err)
+	}
+
+	user, err := st.login(t, "", oidctest.User{Email: "Jane@Acme.test", Name: "Jane Doe", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if user.BrandID != "1" || user.Role != "analyst" || user.Name != "Jane Doe" || user.Email != "jane@acme.test" {
+		t.Errorf("user = %+v, want a new analyst of brand 1", user)
+	}
+	if n := st.count(t, `SELECT COUNT(*) FROM brand_accounts WHERE id = ? AND password_hash IS NULL`, user.ID); n != 1 {
+		t.Error("account created by single sign-on has a password")
+	}
+	if n := st.count(t, `SELECT COUNT(*) FROM brand_audit_log WHERE brand_id = '1' AND action = 'member.joined'`); n != 1 {
+		t.Errorf("%d member.joined audit entries, want 1", n)
+	}
+
+	// The same identity logs in to the same account, even with a new email
+	again, err := st.login(t, "", oidctest.User{Email: "jane.doe@acme.test", Subject: "mock|jane@acme.test", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if again.ID != user.ID {
+		t.Errorf("second login signed in account %s, want %s", again.ID, user.ID)
+	}
+
+	// A member who was removed is not added back by the domain claim
+	if err := st.members.RemoveMember("1", BrandActor{}, user.ID); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+	if _, err := st.login(t, "", oidctest.User{Email: "jane@acme.test", EmailVerified: true}); !errors.Is(err, ErrNotBrandMember) {
+		t.Errorf("login after removal: err = %v, want ErrNotBrandMember", err)
+	}
+}
+
+func TestBrandSSOLinksExistingAccountAndAcceptsInvitations(t *testing.T) {
+	st := newSSOTest(t, SSOOptions{})
+	if _, err := st.sso.SetSSODomain(AdminActor{}, "1", "acme.test", "analyst"); err != nil {
+		t.Fatalf("SetSSODomain: %v", err)
+	}
+	first, err := st.login(t, "", oidctest.User{Email: "jane@acme.test", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+
+	if _, _, err := st.members.Invite("2", BrandActor{}, "jane@acme.test", "admin"); err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	// A second provider identity with the same verified email links to the same account
+	user, err := st.login(t, "2", oidctest.User{Email: "jane@acme.test", Subject: "other|jane", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if user.ID != first.ID {
+		t.Errorf("signed in account %s, want the existing account %s", user.ID, first.ID)
+	}
+	if user.BrandID != "2" || user.Role != "admin" || len(user.Brands) != 2 {
+		t.Errorf("user = %+v, want an admin of brand 2 who is in both brands", user)
+	}
+	if n := st.count(t, `SELECT COUNT(*) FROM brand_invitations WHERE accepted_at IS NULL`); n != 0 {
+		t.Errorf("%d invitations still pending", n)
+	}
+}
+
+func TestBrandSSODomainManagement(t *testing.T) {
+	st := newSSOTest(t, SSOOptions{})
+
+	tests := []struct {
+		name    string
+		brandID string
+		domain  string
+		role    string
+		wantErr error
+	}{
+		{name: "valid", brandID: "1", domain: "Acme.Test", role: "analyst"},
+		{name: "owner role", brandID: "1", domain: "acme.test", role: "owner", wantErr: ErrInvalidSSODomain},
+		{name: "unknown role", brandID: "1", domain: "acme.test", role: "viewer", wantErr: ErrInvalidSSODomain},
+		{name: "not a domain", brandID: "1", domain: "not a domain", role: "analyst", wantErr: ErrInvalidSSODomain},
+		{name: "unknown brand", brandID: "99", domain: "acme.test", role: "analyst", wantErr: ErrBrandNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domain, err := st.sso.SetSSODomain(AdminActor{}, tt.brandID, tt.domain, tt.role)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && domain.Domain != "acme.test" {
+				t.Errorf("domain = %q, want it lower-cased", domain.Domain)
+			}
+		})
+	}
+
+	domains, err := st.sso.ListSSODomains("1")
+	if err != nil || len(domains) != 1 {
+		t.Fatalf("ListSSODomains = %v, %v; want one domain", domains, err)
+	}
+	if err := st.sso.RemoveSSODomain(AdminActor{}, "1", "acme.test"); err != nil {
+		t.Fatalf("RemoveSSODomain: %v", err)
+	}
+	if err := st.sso.RemoveSSODomain(AdminActor{}, "1", "acme.test"); !errors.Is(err, ErrSSODomainNotFound) {
+		t.Errorf("second removal: err = %v, want ErrSSODomainNotFound", err)
+	}
+	if n := st.count(t, `SELECT COUNT(*) FROM admin_audit_log WHERE action LIKE 'brand.sso_domain_%'`); n != 2 {
+		t.Errorf("%d admin audit entries, want 2", n)
+	}
+}
+
+func TestBrandSSODisabled(t *testing.T) {
+	sso := NewBrandSSOService(nil, nil, nil, SSOOptions{})
+	if sso.Enabled() {
+		t.Error("Enabled without a provider")
+	}
+	if _, err := sso.StartLogin(context.Background(), "", ""); !errors.Is(err, ErrSSODisabled) {
+		t.Errorf("StartLogin: err = %v, want ErrSSODisabled", err)
+	}
+	if _, err := sso.CompleteLogin(context.Background(), "state", "code"); !errors.Is(err, ErrSSODisabled) {
+		t.Errorf("CompleteLogin: err = %v, want ErrSSODisabled", err)
+	}
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("invalid URL %q: %v", raw, err)
+	}
+	return parsed
+}
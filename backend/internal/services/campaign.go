@@ -0,0 +1,498 @@
+/**
+ * Campaign Service
+ * Handles brand campaign lifecycle, event linking and budget tracking
+ */
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	CampaignStatusDraft     = "draft"
+	CampaignStatusScheduled = "scheduled"
+	CampaignStatusActive    = "active"
+	CampaignStatusCompleted = "completed"
+)
+
+var (
+	ErrCampaignNotFound          = errors.New("campaign not found")
+	ErrInvalidCampaign           = errors.New("invalid campaign")
+	ErrCampaignArchived          = errors.New("campaign is archived")
+	ErrInvalidCampaignTransition = errors.New("invalid campaign status transition")
+	ErrEventNotOwnedByBrand      = errors.New("event does not belong to brand")
+)
+
+// campaignTransitions lists the statuses each status may move to.
+// Scheduled campaigns can be pulled back to draft; completed is terminal.
+var campaignTransitions = map[string][]string{
+	CampaignStatusDraft:     {CampaignStatusScheduled},
+	CampaignStatusScheduled: {CampaignStatusDraft, CampaignStatusActive},
+	CampaignStatusActive:    {CampaignStatusCompleted},
+	CampaignStatusCompleted: {},
+}
+
+type Campaign struct {
+	ID          int64      `json:"id"`
+	BrandID     string     `json:"brandId"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	StartDate   time.Time  `json:"startDate"`
+	EndDate     time.Time  `json:"endDate"`
+	Budget      float64    `json:"budget"`
+	Spent       float64    `json:"spent"`
+	Attendees   int        `json:"attendees"`
+	EventIDs    []string   `json:"eventIds"`
+	ArchivedAt  *time.Time `json:"archivedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+type CampaignInput struct {
+	Name        string
+	Description string
+	StartDate   time.Time
+	EndDate     time.Time
+	Budget      float64
+}
+
+type CampaignExpense struct {
+	ID          string    `json:"id"`
+	CampaignID  int64     `json:"campaignId"`
+	Amount      float64   `json:"amount"`
+	Category    string    `json:"category"`
+	Description string    `json:"description"`
+	IncurredAt  time.Time `json:"incurredAt"`
+}
+
+// CampaignRollup reports revenue in the brand's reporting currency, net of
+// refunds, and calculates ROI from it. Budget and expenses are taken to be in
+// the reporting currency.
+type CampaignRollup struct {
+	CampaignID      int64    `json:"campaignId"`
+	Events          int      `json:"events"`
+	Attendees       int      `json:"attendees"`
+	ContentPieces   int      `json:"contentPieces"`
+	Currency        string   `json:"currency"`
+	Revenue         float64  `json:"revenue"`
+	GrossRevenue    float64  `json:"grossRevenue"`
+	Refunds         float64  `json:"refunds"`
+	MissingRates    []string `json:"missingRates"`
+	Budget          float64  `json:"budget"`
+	Spent           float64  `json:"spent"`
+	RemainingBudget float64  `json:"remainingBudget"`
+	ROI             float64  `json:"roi"`
+}
+
+type CampaignService struct {
+	db *sql.DB
+}
+
+func NewCampaignService(db *sql.DB) *CampaignService {
+	return &CampaignService{db: db}
+}
+
+func (cs *CampaignService) CreateCampaign(brandID string, input CampaignInput) (*Campaign, error) {
+	if err := validateCampaignInput(input); err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO campaigns (brand_id, name, description, start_date, end_date, budget, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	result, err := cs.db.Exec(query, brandID, input.Name, input.Description, input.StartDate, input.EndDate,
+		input.Budget, CampaignStatusDraft, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create campaign: %w", err)
+	}
+
+	campaignID, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create campaign: %w", err)
+	}
+
+	return &Campaign{
+		ID:          campaignID,
+		BrandID:     brandID,
+		Name:        input.Name,
+		Description: input.Description,
+		Status:      CampaignStatusDraft,
+		StartDate:   input.StartDate,
+		EndDate:     input.EndDate,
+		Budget:      input.Budget,
+		EventIDs:    []string{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+func (cs *CampaignService) UpdateCampaign(brandID string, campaignID int64, input CampaignInput) (*Campaign, error) {
+	if err := validateCampaignInput(input); err != nil {
+		return nil, err
+	}
+
+	campaign, err := cs.GetCampaign(brandID, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	if campaign.ArchivedAt != nil {
+		return nil, ErrCampaignArchived
+	}
+
+	query := `
+		UPDATE campaigns
+		SET name = ?, description = ?, start_date = ?, end_date = ?, budget = ?, updated_at = ?
+		WHERE id = ? AND brand_id = ?
+	`
+
+	_, err = cs.db.Exec(query, input.Name, input.Description, input.StartDate, input.EndDate, input.Budget,
+		time.Now(), campaignID, brandID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update campaign: %w", err)
+	}
+
+	return cs.GetCampaign(brandID, campaignID)
+}
+
+func (cs *CampaignService) GetCampaign(brandID string, campaignID int64) (*Campaign, error) {
+	query := `
+		SELECT c.id, c.brand_id, c.name, COALESCE(c.description, ''), COALESCE(c.status, 'draft'),
+			c.start_date, c.end_date, COALESCE(c.budget, 0), c.archived_at, c.created_at, c.updated_at,
+			(SELECT COALESCE(SUM(ce.amount), 0) FROM campaign_expenses ce WHERE ce.campaign_id = c.id),
+			(SELECT COUNT(DISTINCT a.user_id) FROM attendances a
+				JOIN campaign_events cev ON a.event_id = cev.event_id WHERE cev.campaign_id = c.id)
+		FROM campaigns c
+		WHERE c.id = ? AND c.brand_id = ?
+	`
+
+	campaign, err := scanCampaign(cs.db.QueryRow(query, campaignID, brandID))
+	if err == sql.ErrNoRows {
+		return nil, ErrCampaignNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign: %w", err)
+	}
+
+	campaign.EventIDs, err = cs.getCampaignEventIDs(campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	return campaign, nil
+}
+
+func (cs *CampaignService) ListCampaigns(brandID string, includeArchived bool) ([]Campaign, error) {
+	query := `
+		SELECT c.id, c.brand_id, c.name, COALESCE(c.description, ''), COALESCE(c.status, 'draft'),
+			c.start_date, c.end_date, COALESCE(c.budget, 0), c.archived_at, c.created_at, c.updated_at,
+			(SELECT COALESCE(SUM(ce.amount), 0) FROM campaign_expenses ce WHERE ce.campaign_id = c.id),
+			(SELECT COUNT(DISTINCT a.user_id) FROM attendances a
+				JOIN campaign_events cev ON a.event_id = cev.event_id WHERE cev.campaign_id = c.id)
+		FROM campaigns c
+		WHERE c.brand_id = ?
+	`
+	if !includeArchived {
+		query += ` AND c.archived_at IS NULL`
+	}
+	query += ` ORDER BY c.start_date DESC`
+
+	rows, err := cs.db.Query(query, brandID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list campaigns: %w", err)
+	}
+	defer rows.Close()
+
+	campaigns := []Campaign{}
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list campaigns: %w", err)
+		}
+		campaigns = append(campaigns, *campaign)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list campaigns: %w", err)
+	}
+
+	for i := range campaigns {
+		eventIDs, err := cs.getCampaignEventIDs(campaigns[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		campaigns[i].EventIDs = eventIDs
+	}
+
+	return campaigns, nil
+}
+
+// TransitionStatus moves a campaign through draft → scheduled → active → completed
+func (cs *CampaignService) TransitionStatus(brandID string, campaignID int64, status string) (*Campaign, error) {
+	campaign, err := cs.GetCampaign(brandID, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	if campaign.ArchivedAt != nil {
+		return nil, ErrCampaignArchived
+	}
+
+	if !canTransitionCampaign(campaign.Status, status) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidCampaignTransition, campaign.Status, status)
+	}
+
+	query := `UPDATE campaigns SET status = ?, updated_at = ? WHERE id = ? AND brand_id = ?`
+	if _, err := cs.db.Exec(query, status, time.Now(), campaignID, brandID); err != nil {
+		return nil, fmt.Errorf("failed to update campaign status: %w", err)
+	}
+
+	campaign.Status = status
+	campaign.UpdatedAt = time.Now()
+	return campaign, nil
+}
+
+// ArchiveCampaign hides a campaign from listings while keeping its history
+func (cs *CampaignService) ArchiveCampaign(brandID string, campaignID int64) error {
+	query := `UPDATE campaigns SET archived_at = ?, updated_at = ? WHERE id = ? AND brand_id = ? AND archived_at IS NULL`
+
+	now := time.Now()
+	result, err := cs.db.Exec(query, now, now, campaignID, brandID)
+	if err != nil {
+		return fmt.Errorf("failed to archive campaign: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		if _, err := cs.GetCampaign(brandID, campaignID); err != nil {
+			return err
+		}
+		return ErrCampaignArchived
+	}
+
+	return nil
+}
+
+// LinkEvent attaches one of the brand's events to a campaign
+func (cs *CampaignService) LinkEvent(brandID string, campaignID int64, eventID string) error {
+	campaign, err := cs.GetCampaign(brandID, campaignID)
+	if err != nil {
+		return err
+	}
+	if campaign.ArchivedAt != nil {
+		return ErrCampaignArchived
+	}
+
+	var ownerID string
+	err = cs.db.QueryRow(`SELECT brand_id FROM events WHERE id = ?`, eventID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != brandID) {
+		return ErrEventNotOwnedByBrand
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up event: %w", err)
+	}
+
+	query := `INSERT OR IGNORE INTO campaign_events (campaign_id, event_id, created_at) VALUES (?, ?, ?)`
+	if _, err := cs.db.Exec(query, campaignID, eventID, time.Now()); err != nil {
+		return fmt.Errorf("failed to link event to campaign: %w", err)
+	}
+
+	return nil
+}
+
+func (cs *CampaignService) UnlinkEvent(brandID string, campaignID int64, eventID string) error {
+	if _, err := cs.GetCampaign(brandID, campaignID); err != nil {
+		return err
+	}
+
+	query := `DELETE FROM campaign_events WHERE campaign_id = ? AND event_id = ?`
+	if _, err := cs.db.Exec(query, campaignID, eventID); err != nil {
+		return fmt.Errorf("failed to unlink event from campaign: %w", err)
+	}
+
+	return nil
+}
+
+// RecordExpense books spend against the campaign budget
+func (cs *CampaignService) RecordExpense(brandID string, campaignID int64, amount float64, category, description string, incurredAt time.Time) (*CampaignExpense, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: expense amount must be positive", ErrInvalidCampaign)
+	}
+
+	campaign, err := cs.GetCampaign(brandID, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	if campaign.ArchivedAt != nil {
+		return nil, ErrCampaignArchived
+	}
+
+	if incurredAt.IsZero() {
+		incurredAt = time.Now()
+	}
+
+	expenseID := fmt.Sprintf("expense_%d", time.Now().UnixNano())
+	query := `
+		INSERT INTO campaign_expenses (id, campaign_id, amount, category, description, incurred_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = cs.db.Exec(query, expenseID, campaignID, amount, category, description, incurredAt, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to record campaign expense: %w", err)
+	}
+
+	return &CampaignExpense{
+		ID:          expenseID,
+		CampaignID:  campaignID,
+		Amount:      amount,
+		Category:    category,
+		Description: description,
+		IncurredAt:  incurredAt,
+	}, nil
+}
+
+// GetCampaignRollup aggregates attendees, content and revenue across the campaign's events
+func (cs *CampaignService) GetCampaignRollup(brandID string, campaignID int64) (*CampaignRollup, error) {
+	campaign, err := cs.GetCampaign(brandID, campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	rollup := &CampaignRollup{
+		CampaignID: campaignID,
+		Events:     len(campaign.EventIDs),
+		Attendees:  campaign.Attendees,
+		Budget:     campaign.Budget,
+		Spent:      campaign.Spent,
+	}
+
+	contentQuery := `
+		SELECT COUNT(c.id)
+		FROM content c
+		JOIN campaign_events ce ON c.event_id = ce.event_id
+		WHERE ce.campaign_id = ?
+	`
+	if err := cs.db.QueryRow(contentQuery, campaignID).Scan(&rollup.ContentPieces); err != nil {
+		return nil, fmt.Errorf("failed to get campaign content: %w", err)
+	}
+
+	converter, err := newReportingConverter(cs.db, brandID)
+	if err != nil {
+		return nil, err
+	}
+	revenueQuery := `
+		SELECT p.currency, ` + grossRevenueSQL + `, ` + refundsSQL + `
+		FROM purchases p
+		JOIN campaign_events ce ON p.event_id = ce.event_id
+		WHERE ce.campaign_id = ? AND ` + soldPurchaseCondition + `
+		GROUP BY p.currency
+	`
+	rows, err := cs.db.Query(revenueQuery, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign revenue: %w", err)
+	}
+	defer rows.Close()
+
+	var total revenue
+	for rows.Next() {
+		var currency string
+		var gross, refunds int64
+		if err := rows.Scan(&currency, &gross, &refunds); err != nil {
+			return nil, fmt.Errorf("failed to get campaign revenue: %w", err)
+		}
+		total.add(converter, currency, gross, refunds)
+	}
+	rollup.Currency = converter.currency
+	rollup.Revenue = converter.major(total.net())
+	rollup.GrossRevenue = converter.major(total.gross)
+	rollup.Refunds = converter.major(total.refunds)
+	rollup.MissingRates = converter.missingRates()
+
+	rollup.RemainingBudget = rollup.Budget - rollup.Spent
+	if rollup.Spent > 0 {
+		rollup.ROI = (rollup.Revenue - rollup.Spent) / rollup.Spent * 100
+	}
+
+	return rollup, nil
+}
+
+func (cs *CampaignService) getCampaignEventIDs(campaignID int64) ([]string, error) {
+	rows, err := cs.db.Query(`SELECT event_id FROM campaign_events WHERE campaign_id = ? ORDER BY created_at`, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign events: %w", err)
+	}
+	defer rows.Close()
+
+	eventIDs := []string{}
+	for rows.Next() {
+		var eventID string
+		if err := rows.Scan(&eventID); err != nil {
+			return nil, fmt.Errorf("failed to get campaign events: %w", err)
+		}
+		eventIDs = append(eventIDs, eventID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get campaign events: %w", err)
+	}
+
+	return eventIDs, nil
+}
+
+type campaignScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCampaign(row campaignScanner) (*Campaign, error) {
+	var campaign Campaign
+	var archivedAt, updatedAt sql.NullTime
+
+	err := row.Scan(
+		&campaign.ID, &campaign.BrandID, &campaign.Name, &campaign.Description, &campaign.Status,
+		&campaign.StartDate, &campaign.EndDate, &campaign.Budget, &archivedAt, &campaign.CreatedAt, &updatedAt,
+		&campaign.Spent, &campaign.Attendees,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if archivedAt.Valid {
+		campaign.ArchivedAt = &archivedAt.Time
+	}
+	campaign.UpdatedAt = campaign.CreatedAt
+	if updatedAt.Valid {
+		campaign.UpdatedAt = updatedAt.Time
+	}
+
+	return &campaign, nil
+}
+
+func validateCampaignInput(input CampaignInput) error {
+	if strings.TrimSpace(input.Name) == "" {
+		return fmt.Errorf("%w: campaign name is required", ErrInvalidCampaign)
+	}
+	if input.StartDate.IsZero() || input.EndDate.IsZero() {
+		return fmt.Errorf("%w: campaign start and end dates are required", ErrInvalidCampaign)
+	}
+	if input.EndDate.Before(input.StartDate) {
+		return fmt.Errorf("%w: campaign end date must not be before start date", ErrInvalidCampaign)
+	}
+	if input.Budget < 0 {
+		return fmt.Errorf("%w: campaign budget must not be negative", ErrInvalidCampaign)
+	}
+	return nil
+}
+
+func canTransitionCampaign(from, to string) bool {
+	for _, next := range campaignTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
@@ -19,13 +19,19 @@ type FunnelStage struct {
 	Rate        float64 `json:"rate"`
 }
 
+// ConversionFunnel reports revenue in the brand's reporting currency, net of
+// refunds, and calculates ROI from it
 type ConversionFunnel struct {
-	EventID    string        `json:"eventId"`
-	BrandID    string        `json:"brandId"`
-	Stages     []FunnelStage `json:"stages"`
-	TotalUsers int           `json:"totalUsers"`
-	Revenue    float64       `json:"revenue"`
-	ROI        float64       `json:"roi"`
+	EventID      string        `json:"eventId"`
+	BrandID      string        `json:"brandId"`
+	Stages       []FunnelStage `json:"stages"`
+	TotalUsers   int           `json:"totalUsers"`
+	Currency     string        `json:"currency"`
+	Revenue      float64       `json:"revenue"`
+	GrossRevenue float64       `json:"grossRevenue"`
+	Refunds      float64       `json:"refunds"`
+	ROI          float64       `json:"roi"`
+	MissingRates []string      `json:"missingRates"`
 }
 
 type ConversionFunnelService struct {
@@ -66,11 +72,20 @@ func (cfs *ConversionFunnelService) GetConversionFunnel(eventID, brandID string)
 	stages[3].Conversions = stages[3].Users
 
 	// Get purchases
-	purchaseQuery := `SELECT COUNT(DISTINCT user_id), COALESCE(SUM(amount), 0) FROM purchases WHERE event_id = ?`
-	var revenue float64
-	cfs.db.QueryRow(purchaseQuery, eventID).Scan(&stages[4].Users, &revenue)
+	purchaseQuery := `SELECT COUNT(DISTINCT p.user_id) FROM purchases p WHERE p.event_id = ? AND ` + soldPurchaseCondition
+	cfs.db.QueryRow(purchaseQuery, eventID).Scan(&stages[4].Users)
 	stages[4].Conversions = stages[4].Users
 
+	converter, err := newReportingConverter(cfs.db, brandID)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := cfs.eventRevenue(eventID, converter)
+	if err != nil {
+		return nil, err
+	}
+	revenue := converter.major(totals.net())
+
 	// Calculate conversion rates
 	totalUsers := stages[0].Users
 	for i := range stages {
@@ -88,25 +103,64 @@ func (cfs *ConversionFunnelService) GetConversionFunnel(eventID, brandID string)
 	}
 
 	return &ConversionFunnel{
-		EventID:    eventID,
-		BrandID:    brandID,
-		Stages:     stages,
-		TotalUsers: totalUsers,
-		Revenue:    revenue,
-		ROI:        roi,
+		EventID:      eventID,
+		BrandID:      brandID,
+		Stages:       stages,
+		TotalUsers:   totalUsers,
+		Currency:     converter.currency,
+		Revenue:      revenue,
+		GrossRevenue: converter.major(totals.gross),
+		Refunds:      converter.major(totals.refunds),
+		ROI:          roi,
+		MissingRates: converter.missingRates(),
 	}, nil
 }
 
+// eventRevenue totals the event's sales in the converter's currency
+func (cfs *ConversionFunnelService) eventRevenue(eventID string, converter *reportingConverter) (revenue, error) {
+	query := `
+		SELECT p.currency, ` + grossRevenueSQL + `, ` + refundsSQL + `
+		FROM purchases p
+		WHERE p.event_id = ? AND ` + soldPurchaseCondition + `
+		GROUP BY p.currency
+	`
+	rows, err := cfs.db.Query(query, eventID)
+	if err != nil {
+		return revenue{}, fmt.Errorf("failed to get event revenue: %w", err)
+	}
+	defer rows.Close()
+
+	var total revenue
+	for rows.Next() {
+		var currency string
+		var gross, refunds int64
+		if err := rows.Scan(&currency, &gross, &refunds); err != nil {
+			return revenue{}, fmt.Errorf("failed to get event revenue: %w", err)
+		}
+		total.add(converter, currency, gross, refunds)
+	}
+	return total, rows.Err()
+}
+
+// GetAttributionReport breaks the event's sales down by attribution type.
+// Revenue is in the reporting currency of the event's brand and net of refunds.
 func (cfs *ConversionFunnelService) GetAttributionReport(eventID string) (map[string]interface{}, error) {
+	converter, err := newEventReportingConverter(cfs.db, eventID)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT 
+		SELECT
 			pa.attribution_type,
+			p.currency,
 			COUNT(*) as count,
-			SUM(p.amount) as revenue
+			` + grossRevenueSQL + ` as gross_revenue,
+			` + refundsSQL + ` as refunds
 		FROM purchase_attribution pa
 		JOIN purchases p ON pa.purchase_id = p.id
-		WHERE pa.event_id = ?
-		GROUP BY pa.attribution_type
+		WHERE pa.event_id = ? AND ` + soldPurchaseCondition + `
+		GROUP BY pa.attribution_type, p.currency
 	`
 
 	rows, err := cfs.db.Query(query, eventID)
@@ -115,29 +169,40 @@ func (cfs *ConversionFunnelService) GetAttributionReport(eventID string) (map[st
 	}
 	defer rows.Close()
 
-	attribution := make(map[string]map[string]interface{})
-	totalRevenue := 0.0
+	purchases := make(map[string]int)
+	revenues := make(map[string]*revenue)
+	var total revenue
 	totalPurchases := 0
 
 	for rows.Next() {
-		var attrType string
+		var attrType, currency string
 		var count int
-		var revenue float64
+		var gross, refunds int64
 
-		err := rows.Scan(&attrType, &count, &revenue)
+		err := rows.Scan(&attrType, &currency, &count, &gross, &refunds)
 		if err != nil {
 			continue
 		}
 
-		attribution[attrType] = map[string]interface{}{
-			"purchases": count,
-			"revenue":   revenue,
+		if revenues[attrType] == nil {
+			revenues[attrType] = &revenue{}
 		}
-
-		totalRevenue += revenue
+		revenues[attrType].add(converter, currency, gross, refunds)
+		purchases[attrType] += count
+		total.add(converter, currency, gross, refunds)
 		totalPurchases += count
 	}
 
+	attribution := make(map[string]map[string]interface{})
+	for attrType, typeRevenue := range revenues {
+		attribution[attrType] = map[string]interface{}{
+			"purchases":    purchases[attrType],
+			"revenue":      converter.major(typeRevenue.net()),
+			"grossRevenue": converter.major(typeRevenue.gross),
+			"refunds":      converter.major(typeRevenue.refunds),
+		}
+	}
+
 	// Calculate percentages
 	// for _, data := range attribution {
 	// 	if totalRevenue > 0 {
@@ -149,9 +214,13 @@ func (cfs *ConversionFunnelService) GetAttributionReport(eventID string) (map[st
 	// }
 
 	return map[string]interface{}{
-		"attribution":    attribution,
-		"totalRevenue":   totalRevenue,
-		"totalPurchases": totalPurchases,
+		"attribution":       attribution,
+		"currency":          converter.currency,
+		"totalRevenue":      converter.major(total.net()),
+		"totalGrossRevenue": converter.major(total.gross),
+		"totalRefunds":      converter.major(total.refunds),
+		"totalPurchases":    totalPurchases,
+		"missingRates":      converter.missingRates(),
 	}, nil
 }
 
@@ -0,0 +1,87 @@
+/**
+ * Integration Credentials
+ * Re-encryption of stored CRM and e-commerce credentials and admin TOTP secrets after a master key rotation
+ */
+
+package services
+
+import (
+	"database/sql"
+	"fmt"
+
+	"lynkr/pkg/secrets"
+)
+
+// credentialColumns lists the columns holding encrypted integration credentials
+// and other secrets encrypted with the master key
+var credentialColumns = []struct {
+	table  string
+	column string
+}{
+	{"crm_integrations", "api_key"},
+	{"crm_integrations", "api_secret"},
+	{"ecommerce_integrations", "api_key"},
+	{"admin_accounts", "totp_secret"},
+}
+
+// ReencryptCredentials re-wraps every stored credential with the keyring's
+// active master key and encrypts credentials still stored in plain text. It
+// returns the number of values rewritten. Each table is updated in one
+// transaction, so a failure leaves it as it was.
+func ReencryptCredentials(db *sql.DB, keyring *secrets.Keyring) (int, error) {
+	total := 0
+	for _, target := range credentialColumns {
+		count, err := reencryptColumn(db, keyring, target.table, target.column)
+		if err != nil {
+			return total, fmt.Errorf("failed to re-encrypt %s.%s: %w", target.table, target.column, err)
+		}
+		total += count
+	}
+	return total, nil
+}
+
+func reencryptColumn(db *sql.DB, keyring *secrets.Keyring, table, column string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Table and column names come from credentialColumns, never from input
+	rows, err := tx.Query(`SELECT id, ` + column + ` FROM ` + table + ` WHERE ` + column + ` IS NOT NULL AND ` + column + ` != ''`)
+	if err != nil {
+		return 0, err
+	}
+
+	updates := make(map[string]string)
+	for rows.Next() {
+		var id, value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		rewrapped, changed, err := keyring.Rewrap(value)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("row %s: %w", id, err)
+		}
+		if changed {
+			updates[id] = rewrapped
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, value := range updates {
+		if _, err := tx.Exec(`UPDATE `+table+` SET `+column+` = ? WHERE id = ?`, value, id); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(updates), nil
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"testing"
+
+	"lynkr/pkg/secrets"
+)
+
+func TestReencryptCredentials(t *testing.T) {
+	db := newTestDB(t)
+	oldKey, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	newKey, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	before, err := secrets.NewKeyring(map[string]string{"old": oldKey}, "old")
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	rotating, err := secrets.NewKeyring(map[string]string{"old": oldKey, "new": newKey}, "new")
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+
+	// Start without the plain text sample integrations the migrations seed
+	mustExec(t, db, `DELETE FROM crm_integrations`)
+	mustExec(t, db, `DELETE FROM ecommerce_integrations`)
+
+	onOldKey, _ := before.Encrypt("crm key")
+	onNewKey, _ := rotating.Encrypt("crm secret")
+	totpSecret, _ := before.Encrypt("JBSWY3DPEHPK3PXP")
+	mustExec(t, db, `INSERT INTO brands (id, name, contact_info) VALUES (1, 'Acme', 'a@acme.test')`)
+	mustExec(t, db, `INSERT INTO crm_integrations (id, brand_id, crm_type, api_key, api_secret) VALUES ('crm_1', '1', 'hubspot', ?, ?)`, onOldKey, onNewKey)
+	mustExec(t, db, `INSERT INTO ecommerce_integrations (id, brand_id, platform_type, api_key, store_url) VALUES ('ecom_1', '1', 'shopify', 'legacy plain key', 'acme.myshopify.com')`)
+	mustExec(t, db, `INSERT INTO admin_accounts (id, email, name, password_hash, totp_secret) VALUES ('adm_1', 'ops@lynkr.test', 'Ops', 'x', ?)`, totpSecret)
+
+	count, err := ReencryptCredentials(db, rotating)
+	if err != nil {
+		t.Fatalf("ReencryptCredentials: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("rewrote %d values, want 3: the old key's two and the plain text one", count)
+	}
+
+	var apiSecret string
+	db.QueryRow(`SELECT api_secret FROM crm_integrations WHERE id = 'crm_1'`).Scan(&apiSecret)
+	if apiSecret != onNewKey {
+		t.Error("a value already on the active key was rewritten")
+	}
+
+	// The retired key is no longer needed to read any credential
+	after, err := secrets.NewKeyring(map[string]string{"new": newKey}, "new")
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: `SELECT api_key FROM crm_integrations WHERE id = 'crm_1'`, want: "crm key"},
+		{query: `SELECT api_secret FROM crm_integrations WHERE id = 'crm_1'`, want: "crm secret"},
+		{query: `SELECT api_key FROM ecommerce_integrations WHERE id = 'ecom_1'`, want: "legacy plain key"},
+		{query: `SELECT totp_secret FROM admin_accounts WHERE id = 'adm_1'`, want: "JBSWY3DPEHPK3PXP"},
+	}
+	for _, tt := range tests {
+		var stored string
+		if err := db.QueryRow(tt.query).Scan(&stored); err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if !secrets.IsEncrypted(stored) {
+			t.Errorf("%s left plain text", tt.query)
+		}
+		if plain, err := after.Decrypt(stored); err != nil || plain != tt.want {
+			t.Errorf("%s decrypts to %q, %v; want %q", tt.query, plain, err, tt.want)
+		}
+	}
+
+	// Running it again finds nothing left to do
+	if count, err := ReencryptCredentials(db, rotating); err != nil || count != 0 {
+		t.Errorf("second run rewrote %d values, %v; want none", count, err)
+	}
+}
+
+func TestReencryptCredentialsLeavesTableOnError(t *testing.T) {
+	db := newTestDB(t)
+	key, _ := secrets.GenerateKey()
+	keyring, err := secrets.NewKeyring(map[string]string{"k1": key}, "k1")
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+
+	mustExec(t, db, `DELETE FROM crm_integrations`)
+	mustExec(t, db, `INSERT INTO brands (id, name, contact_info) VALUES (1, 'Acme', 'a@acme.test'), (2, 'Beta', 'b@beta.test')`)
+	mustExec(t, db, `INSERT INTO crm_integrations (id, brand_id, crm_type, api_key) VALUES ('crm_1', '1', 'hubspot', 'plain key')`)
+	mustExec(t, db, `INSERT INTO crm_integrations (id, brand_id, crm_type, api_key) VALUES ('crm_2', '2', 'hubspot', 'enc:v1:gone:AAAA:AAAA')`)
+
+	if _, err := ReencryptCredentials(db, keyring); err == nil {
+		t.Fatal("ReencryptCredentials succeeded with a value on an unknown key")
+	}
+	var apiKey string
+	db.QueryRow(`SELECT api_key FROM crm_integrations WHERE id = 'crm_1'`).Scan(&apiKey)
+	if apiKey != "plain key" {
+		t.Errorf("api_key = %q, want the table left as it was", apiKey)
+	}
+}
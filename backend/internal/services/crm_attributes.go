@@ -0,0 +1,209 @@
+/**
+ * CRM Attributes
+ * Lynkr attendee attributes that brands can map to CRM fields
+ */
+
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"lynkr/internal/crm"
+	"lynkr/pkg/export"
+)
+
+// CRMAttribute is a Lynkr attribute that can be mapped to a CRM field
+type CRMAttribute struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+}
+
+// crmSurveyPrefix maps the answer to a pulse survey question, e.g. "survey.q1"
+const crmSurveyPrefix = "survey."
+
+var crmAttributes = []CRMAttribute{
+	{"user_id", "Lynkr user ID"},
+	{"name", "Full name"},
+	{"first_name", "First name"},
+	{"last_name", "Last name"},
+	{"event_id", "Event ID"},
+	{"event_name", "Event name"},
+	{"attended", "Whether the contact checked in"},
+	{"check_in_time", "First check-in time"},
+	{"check_out_time", "Last check-out time"},
+	{"duration_minutes", "Minutes between check-in and check-out"},
+	{"sentiment_score", "Average sentiment of the contact's content at the event"},
+	{"points", "Total reward points"},
+	{"level", "Reward level"},
+	{"source", "Always \"Lynkr Event\""},
+	{crmSurveyPrefix + "<questionId>", "Answer to a pulse survey question of the event"},
+}
+
+// CRMAttributes returns the Lynkr attributes that can be mapped to CRM fields
+func (cis *CRMIntegrationService) CRMAttributes() []CRMAttribute {
+	return crmAttributes
+}
+
+func isCRMAttribute(attribute string) bool {
+	if strings.HasPrefix(attribute, crmSurveyPrefix) {
+		return len(attribute) > len(crmSurveyPrefix)
+	}
+	for _, known := range crmAttributes {
+		if known.ID == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+// mapCRMContact applies a field mapping. Attributes without a value are left
+// out so they don't clear fields in the CRM.
+func mapCRMContact(contact CRMContact, fieldMapping map[string]string) crm.Contact {
+	fields := make(map[string]interface{}, len(fieldMapping))
+	for attribute, field := range fieldMapping {
+		value, ok := contact.Attributes[attribute]
+		if !ok || value == nil {
+			continue
+		}
+		if t, ok := value.(time.Time); ok {
+			value = t.UTC().Format(time.RFC3339)
+		}
+		fields[field] = value
+	}
+
+	return crm.Contact{Email: contact.Email, Name: contact.Name, Fields: fields}
+}
+
+// crmConsentType is the consent a user must have granted, in their latest
+// consent record, to be synced to a CRM
+const crmConsentType = "marketing_communications"
+
+// getEventContacts loads the consenting attendees of an event with their attributes
+func (cis *CRMIntegrationService) getEventContacts(eventID string) ([]CRMContact, error) {
+	query := `
+		SELECT u.id, u.email, u.username, e.name, MIN(a.check_in_time), MAX(a.check_out_time),
+		       (SELECT AVG(CAST(json_extract(sa.result, '$.score') AS REAL))
+		        FROM sentiment_analysis sa JOIN content c ON sa.content_id = c.id
+		        WHERE c.user_id = u.id AND c.event_id = a.event_id),
+		       COALESCE(up.total_points, 0), COALESCE(up.level, 1)
+		FROM attendances a
+		JOIN users u ON u.id = a.user_id
+		JOIN events e ON e.id = a.event_id
+		LEFT JOIN user_points up ON up.user_id = u.id
+		WHERE a.event_id = ? AND (
+			SELECT ucr.granted FROM user_consent_records ucr
+			WHERE ucr.user_id = u.id AND ucr.consent_type = ?
+			ORDER BY ucr.created_at DESC, ucr.id DESC LIMIT 1
+		) = 1
+		GROUP BY u.id
+	`
+
+	rows, err := cis.db.Query(query, eventID, crmConsentType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contacts []CRMContact
+	for rows.Next() {
+		var userID, email, name, eventName string
+		var checkIn, checkOut, sentiment interface{}
+		var points, level int64
+		if err := rows.Scan(&userID, &email, &name, &eventName, &checkIn, &checkOut, &sentiment, &points, &level); err != nil {
+			return nil, err
+		}
+
+		firstName, lastName := name, ""
+		if i := strings.Index(name, " "); i >= 0 {
+			firstName, lastName = name[:i], strings.TrimSpace(name[i+1:])
+		}
+
+		attributes := map[string]interface{}{
+			"user_id":    userID,
+			"name":       name,
+			"first_name": firstName,
+			"last_name":  lastName,
+			"event_id":   eventID,
+			"event_name": eventName,
+			"attended":   true,
+			"points":     points,
+			"level":      level,
+			"source":     "Lynkr Event",
+		}
+		checkInTime, _ := export.Convert(export.TypeTime, checkIn)
+		checkOutTime, _ := export.Convert(export.TypeTime, checkOut)
+		attributes["check_in_time"] = checkInTime
+		attributes["check_out_time"] = checkOutTime
+		if in, ok := checkInTime.(time.Time); ok {
+			if out, ok := checkOutTime.(time.Time); ok {
+				attributes["duration_minutes"] = int64(out.Sub(in).Minutes())
+			}
+		}
+		attributes["sentiment_score"], _ = export.Convert(export.TypeFloat, sentiment)
+
+		contacts = append(contacts, CRMContact{
+			ID:         userID,
+			Email:      email,
+			Name:       name,
+			EventID:    eventID,
+			Attributes: attributes,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	answers, err := cis.getSurveyAnswers(eventID)
+	if err != nil {
+		return nil, err
+	}
+	for _, contact := range contacts {
+		for questionID, answer := range answers[contact.ID] {
+			contact.Attributes[crmSurveyPrefix+questionID] = answer
+		}
+	}
+
+	return contacts, nil
+}
+
+// getSurveyAnswers returns each user's answers to the event's pulse surveys by
+// question ID. Later surveys win when question IDs repeat.
+func (cis *CRMIntegrationService) getSurveyAnswers(eventID string) (map[string]map[string]interface{}, error) {
+	query := `
+		SELECT psr.user_id, psr.responses
+		FROM pulse_survey_responses psr
+		JOIN pulse_surveys ps ON ps.id = psr.survey_id
+		WHERE ps.event_id = ?
+		ORDER BY psr.completed_at
+	`
+
+	rows, err := cis.db.Query(query, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get survey answers: %w", err)
+	}
+	defer rows.Close()
+
+	answers := make(map[string]map[string]interface{})
+	for rows.Next() {
+		var userID, responsesJSON string
+		if err := rows.Scan(&userID, &responsesJSON); err != nil {
+			return nil, fmt.Errorf("failed to get survey answers: %w", err)
+		}
+
+		var responses map[string]interface{}
+		if json.Unmarshal([]byte(responsesJSON), &responses) != nil {
+			continue
+		}
+		if answers[userID] == nil {
+			answers[userID] = make(map[string]interface{})
+		}
+		for questionID, answer := range responses {
+			answers[userID][questionID] = answer
+		}
+	}
+
+	return answers, rows.Err()
+}
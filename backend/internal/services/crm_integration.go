@@ -6,281 +6,548 @@
 package services
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
+	"context"
 	"database/sql"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
+
+	"lynkr/internal/crm"
+	"lynkr/internal/jobs"
+	"lynkr/pkg/secrets"
+)
+
+var (
+	ErrCRMIntegrationNotFound = errors.New("CRM integration not found")
+	ErrInvalidCRMIntegration  = errors.New("invalid CRM integration")
+	ErrCRMEventNotFound       = errors.New("event not found")
 )
 
 type CRMIntegration struct {
-	ID           string `json:"id"`
-	BrandID      string `json:"brandId"`
-	CRMType      string `json:"crmType"`
-	APIKey       string `json:"apiKey"`
-	APISecret    string `json:"apiSecret"`
-	WebhookURL   string `json:"webhookUrl"`
-	SyncInterval int    `json:"syncInterval"`
-	Status       string `json:"status"`
+	ID           string            `json:"id"`
+	BrandID      string            `json:"brandId"`
+	CRMType      string            `json:"crmType"`
+	APIKey       string            `json:"apiKey"`
+	APISecret    string            `json:"apiSecret"`
+	WebhookURL   string            `json:"webhookUrl"`
+	BaseURL      string            `json:"baseUrl,omitempty"`
+	Settings     map[string]string `json:"settings,omitempty"`
+	FieldMapping map[string]string `json:"fieldMapping"`
+	SyncInterval int               `json:"syncInterval"`
+	Status       string            `json:"status"`
+	// InboundWebhookURL is where the CRM should send contact webhooks, for
+	// connectors that accept them
+	InboundWebhookURL string `json:"inboundWebhookUrl,omitempty"`
+}
+
+// CRMIntegrationInput holds the settings of a new CRM integration
+type CRMIntegrationInput struct {
+	CRMType      string
+	APIKey       string
+	APISecret    string
+	WebhookURL   string
+	BaseURL      string
+	Settings     map[string]string
+	FieldMapping map[string]string // empty uses the connector's default mapping
+	SyncInterval int
+}
+
+// CRMIntegrationUpdate changes the connection settings of an integration.
+// Nil fields are left unchanged.
+type CRMIntegrationUpdate struct {
+	APISecret    *string
+	BaseURL      *string
+	Settings     map[string]string
+	FieldMapping map[string]string
 }
 
+// CRMContact is a consenting attendee of an event with the Lynkr attributes
+// that can be mapped to CRM fields
 type CRMContact struct {
-	ID       string                 `json:"id"`
-	Email    string                 `json:"email"`
-	Name     string                 `json:"name"`
-	EventID  string                 `json:"eventId"`
-	Metadata map[string]interface{} `json:"metadata"`
+	ID         string                 `json:"id"`
+	Email      string                 `json:"email"`
+	Name       string                 `json:"name"`
+	EventID    string                 `json:"eventId"`
+	Attributes map[string]interface{} `json:"attributes"`
 }
 
+// CRM job types run on the crm queue
+const (
+	CRMScheduledSyncJobType = "crm.scheduled_sync"
+	CRMEventSyncJobType     = "crm.sync_event"
+)
+
 type CRMIntegrationService struct {
-	db *sql.DB
+	db      *sql.DB
+	queue   *jobs.Queue
+	keyring *secrets.Keyring
+	options CRMOptions
+	client  *http.Client
+}
+
+// CRMOptions control how CRM connectors are reached
+type CRMOptions struct {
+	// AllowInsecureBaseURLs accepts plain http CRM base URLs, for development
+	// and for pointing integrations at local test servers
+	AllowInsecureBaseURLs bool
+	// PublicBaseURL is the origin CRMs reach Lynkr on, used to verify signed
+	// webhooks and to show inbound webhook URLs
+	PublicBaseURL string
+}
+
+type crmSyncJobPayload struct {
+	IntegrationID string `json:"integrationId"`
+	EventID       string `json:"eventId,omitempty"`
+}
+
+func NewCRMIntegrationService(db *sql.DB, queue *jobs.Queue, keyring *secrets.Keyring, options CRMOptions) *CRMIntegrationService {
+	cis := &CRMIntegrationService{
+		db:      db,
+		queue:   queue,
+		keyring: keyring,
+		options: options,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+	queue.Register(CRMScheduledSyncJobType, "crm", cis.handleScheduledSyncJob)
+	queue.Register(CRMEventSyncJobType, "crm", cis.handleEventSyncJob)
+	return cis
+}
+
+// ResumeSchedules makes sure every active integration has its next sync queued
+func (cis *CRMIntegrationService) ResumeSchedules() error {
+	rows, err := cis.db.Query(`SELECT id FROM crm_integrations WHERE status = 'active' AND sync_interval > 0`)
+	if err != nil {
+		return fmt.Errorf("failed to load CRM integrations: %w", err)
+	}
+	defer rows.Close()
+
+	var integrationIDs []string
+	for rows.Next() {
+		var integrationID string
+		if err := rows.Scan(&integrationID); err == nil {
+			integrationIDs = append(integrationIDs, integrationID)
+		}
+	}
+
+	for _, integrationID := range integrationIDs {
+		if err := cis.ScheduleSync(integrationID); err != nil {
+			log.Printf("Failed to resume CRM sync for %s: %v", integrationID, err)
+		}
+	}
+
+	return nil
 }
 
-func NewCRMIntegrationService(db *sql.DB) *CRMIntegrationService {
-	return &CRMIntegrationService{db: db}
+// CRMTypes returns the registered CRM connectors
+func (cis *CRMIntegrationService) CRMTypes() []crm.Info {
+	return crm.Types()
 }
 
-func (cis *CRMIntegrationService) CreateIntegration(brandID, crmType, apiKey, apiSecret, webhookURL string, syncInterval int) (*CRMIntegration, error) {
-	integrationID := fmt.Sprintf("crm_%d", time.Now().UnixNano())
-	
+func (cis *CRMIntegrationService) CreateIntegration(brandID string, input CRMIntegrationInput) (*CRMIntegration, error) {
+	integration := &CRMIntegration{
+		ID:           fmt.Sprintf("crm_%d", time.Now().UnixNano()),
+		BrandID:      brandID,
+		CRMType:      input.CRMType,
+		APIKey:       input.APIKey,
+		APISecret:    input.APISecret,
+		WebhookURL:   input.WebhookURL,
+		BaseURL:      strings.TrimRight(input.BaseURL, "/"),
+		Settings:     input.Settings,
+		FieldMapping: input.FieldMapping,
+		SyncInterval: input.SyncInterval,
+		Status:       "active",
+	}
+
+	info, ok := crm.Lookup(input.CRMType)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported CRM type %q", ErrInvalidCRMIntegration, input.CRMType)
+	}
+	if input.APIKey == "" {
+		return nil, fmt.Errorf("%w: an API key is required", ErrInvalidCRMIntegration)
+	}
+	if len(integration.FieldMapping) == 0 {
+		integration.FieldMapping = info.DefaultFieldMapping
+	}
+	if err := cis.validateIntegration(integration); err != nil {
+		return nil, err
+	}
+
+	var existing int
+	cis.db.QueryRow(`SELECT COUNT(*) FROM crm_integrations WHERE brand_id = ? AND crm_type = ?`, brandID, input.CRMType).Scan(&existing)
+	if existing > 0 {
+		return nil, fmt.Errorf("%w: the brand already has a %s integration", ErrInvalidCRMIntegration, info.Name)
+	}
+
+	settings, fieldMapping, err := encodeCRMSettings(integration)
+	if err != nil {
+		return nil, err
+	}
+	apiKey, apiSecret, err := cis.encryptCredentials(integration)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		INSERT INTO crm_integrations (id, brand_id, crm_type, api_key, api_secret, webhook_url, sync_interval, status, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO crm_integrations (id, brand_id, crm_type, api_key, api_secret, webhook_url, base_url, settings, field_mapping, sync_interval, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	
-	_, err := cis.db.Exec(query, integrationID, brandID, crmType, apiKey, apiSecret, webhookURL, syncInterval, "active", time.Now())
+
+	_, err = cis.db.Exec(query, integration.ID, brandID, integration.CRMType, apiKey, apiSecret, integration.WebhookURL,
+		integration.BaseURL, settings, fieldMapping, integration.SyncInterval, integration.Status, time.Now())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create CRM integration: %w", err)
 	}
-	
-	return &CRMIntegration{
-		ID:           integrationID,
-		BrandID:      brandID,
-		CRMType:      crmType,
-		APIKey:       apiKey,
-		APISecret:    apiSecret,
-		WebhookURL:   webhookURL,
-		SyncInterval: syncInterval,
-		Status:       "active",
-	}, nil
+
+	return cis.present(integration), nil
 }
 
-func (cis *CRMIntegrationService) SyncEventData(integrationID, eventID string) error {
-	integration, err := cis.getIntegration(integrationID)
+// UpdateIntegration changes the base URL, connector settings or field mapping
+// of one of the brand's integrations
+func (cis *CRMIntegrationService) UpdateIntegration(brandID, integrationID string, update CRMIntegrationUpdate) (*CRMIntegration, error) {
+	integration, err := cis.getBrandIntegration(brandID, integrationID)
 	if err != nil {
-		return fmt.Errorf("failed to get integration: %w", err)
+		return nil, err
+	}
+
+	if update.APISecret != nil {
+		integration.APISecret = *update.APISecret
+	}
+	if update.BaseURL != nil {
+		integration.BaseURL = strings.TrimRight(*update.BaseURL, "/")
 	}
-	
-	contacts, err := cis.getEventContacts(eventID)
+	if update.Settings != nil {
+		integration.Settings = update.Settings
+	}
+	if update.FieldMapping != nil {
+		integration.FieldMapping = update.FieldMapping
+	}
+	if err := cis.validateIntegration(integration); err != nil {
+		return nil, err
+	}
+
+	settings, fieldMapping, err := encodeCRMSettings(integration)
 	if err != nil {
-		return fmt.Errorf("failed to get event contacts: %w", err)
-	}
-	
-	switch integration.CRMType {
-	case "salesforce":
-		return cis.syncToSalesforce(integration, contacts)
-	case "hubspot":
-		return cis.syncToHubspot(integration, contacts)
-	case "mailchimp":
-		return cis.syncToMailchimp(integration, contacts)
-	default:
-		return fmt.Errorf("unsupported CRM type: %s", integration.CRMType)
+		return nil, err
+	}
+	_, apiSecret, err := cis.encryptCredentials(integration)
+	if err != nil {
+		return nil, err
 	}
-}
 
-func (cis *CRMIntegrationService) syncToSalesforce(integration *CRMIntegration, contacts []CRMContact) error {
-	for _, contact := range contacts {
-		payload := map[string]interface{}{
-			"Email":     contact.Email,
-			"FirstName": contact.Name,
-			"EventId__c": contact.EventID,
-			"Source":    "Lynkr Event",
-		}
-		
-		err := cis.sendToCRM("https://api.salesforce.com/services/data/v52.0/sobjects/Contact/", integration, payload)
-		if err != nil {
-			return fmt.Errorf("failed to sync contact to Salesforce: %w", err)
-		}
+	query := `
+		UPDATE crm_integrations SET api_secret = ?, base_url = ?, settings = ?, field_mapping = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	if _, err := cis.db.Exec(query, apiSecret, integration.BaseURL, settings, fieldMapping, time.Now(), integration.ID); err != nil {
+		return nil, fmt.Errorf("failed to update CRM integration: %w", err)
 	}
-	return nil
+
+	return cis.present(integration), nil
 }
 
-func (cis *CRMIntegrationService) syncToHubspot(integration *CRMIntegration, contacts []CRMContact) error {
-	for _, contact := range contacts {
-		payload := map[string]interface{}{
-			"properties": map[string]interface{}{
-				"email":     contact.Email,
-				"firstname": contact.Name,
-				"event_id":  contact.EventID,
-				"source":    "Lynkr Event",
-			},
-		}
-		
-		err := cis.sendToCRM("https://api.hubapi.com/crm/v3/objects/contacts", integration, payload)
-		if err != nil {
-			return fmt.Errorf("failed to sync contact to HubSpot: %w", err)
-		}
+// GetIntegration returns one of the brand's integrations with its
+// credentials masked
+func (cis *CRMIntegrationService) GetIntegration(brandID, integrationID string) (*CRMIntegration, error) {
+	integration, err := cis.getBrandIntegration(brandID, integrationID)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return cis.present(integration), nil
 }
 
-func (cis *CRMIntegrationService) syncToMailchimp(integration *CRMIntegration, contacts []CRMContact) error {
-	for _, contact := range contacts {
-		payload := map[string]interface{}{
-			"email_address": contact.Email,
-			"status":        "subscribed",
-			"merge_fields": map[string]interface{}{
-				"FNAME":    contact.Name,
-				"EVENT_ID": contact.EventID,
-			},
-			"tags": []string{"lynkr-event"},
-		}
-		
-		err := cis.sendToCRM("https://us1.api.mailchimp.com/3.0/lists/LIST_ID/members", integration, payload)
-		if err != nil {
-			return fmt.Errorf("failed to sync contact to Mailchimp: %w", err)
-		}
+// getBrandIntegration loads one of the brand's integrations with decrypted
+// credentials
+func (cis *CRMIntegrationService) getBrandIntegration(brandID, integrationID string) (*CRMIntegration, error) {
+	integration, err := cis.getIntegration(integrationID)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	if integration.BrandID != brandID {
+		return nil, ErrCRMIntegrationNotFound
+	}
+	return integration, nil
+}
+
+// present prepares an integration for API responses. Credentials never leave
+// the service unmasked.
+func (cis *CRMIntegrationService) present(integration *CRMIntegration) *CRMIntegration {
+	cis.setWebhookURL(integration)
+	presented := *integration
+	presented.APIKey = secrets.Mask(integration.APIKey)
+	presented.APISecret = secrets.Mask(integration.APISecret)
+	return &presented
 }
 
-func (cis *CRMIntegrationService) sendToCRM(url string, integration *CRMIntegration, payload map[string]interface{}) error {
-	jsonData, err := json.Marshal(payload)
+// encryptCredentials returns the API key and secret as stored at rest
+func (cis *CRMIntegrationService) encryptCredentials(integration *CRMIntegration) (string, string, error) {
+	apiKey, err := cis.keyring.Encrypt(integration.APIKey)
 	if err != nil {
-		return err
+		return "", "", fmt.Errorf("failed to encrypt CRM API key: %w", err)
 	}
-	
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	apiSecret, err := cis.keyring.Encrypt(integration.APISecret)
 	if err != nil {
-		return err
+		return "", "", fmt.Errorf("failed to encrypt CRM API secret: %w", err)
 	}
-	
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+integration.APIKey)
-	
-	// Add signature for security
-	signature := cis.generateSignature(string(jsonData), integration.APISecret)
-	req.Header.Set("X-Lynkr-Signature", signature)
-	
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
+	return apiKey, apiSecret, nil
+}
+
+// validateIntegration checks the base URL and field mapping and that a
+// connector can be built from the integration's settings
+func (cis *CRMIntegrationService) validateIntegration(integration *CRMIntegration) error {
+	if integration.BaseURL != "" {
+		base, err := url.Parse(integration.BaseURL)
+		if err != nil || base.Host == "" {
+			return fmt.Errorf("%w: invalid base URL", ErrInvalidCRMIntegration)
+		}
+		if base.Scheme != "https" && !(base.Scheme == "http" && cis.options.AllowInsecureBaseURLs) {
+			return fmt.Errorf("%w: base URL must use https", ErrInvalidCRMIntegration)
+		}
 	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("CRM API error: %d", resp.StatusCode)
+
+	for attribute, field := range integration.FieldMapping {
+		if !isCRMAttribute(attribute) {
+			return fmt.Errorf("%w: unknown Lynkr attribute %q", ErrInvalidCRMIntegration, attribute)
+		}
+		if strings.TrimSpace(field) == "" {
+			return fmt.Errorf("%w: no CRM field given for %q", ErrInvalidCRMIntegration, attribute)
+		}
+	}
+
+	if _, err := cis.connector(integration); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCRMIntegration, err)
 	}
-	
 	return nil
 }
 
+// connector builds the CRM connector of an integration
+func (cis *CRMIntegrationService) connector(integration *CRMIntegration) (crm.Connector, error) {
+	return crm.New(integration.CRMType, crm.Config{
+		BaseURL:   integration.BaseURL,
+		APIKey:    integration.APIKey,
+		APISecret: integration.APISecret,
+		Settings:  integration.Settings,
+		Client:    cis.client,
+	})
+}
+
+func encodeCRMSettings(integration *CRMIntegration) (sql.NullString, sql.NullString, error) {
+	var settings, fieldMapping sql.NullString
+	if len(integration.Settings) > 0 {
+		data, err := json.Marshal(integration.Settings)
+		if err != nil {
+			return settings, fieldMapping, fmt.Errorf("failed to encode CRM settings: %w", err)
+		}
+		settings = sql.NullString{String: string(data), Valid: true}
+	}
+	if len(integration.FieldMapping) > 0 {
+		data, err := json.Marshal(integration.FieldMapping)
+		if err != nil {
+			return settings, fieldMapping, fmt.Errorf("failed to encode CRM field mapping: %w", err)
+		}
+		fieldMapping = sql.NullString{String: string(data), Valid: true}
+	}
+	return settings, fieldMapping, nil
+}
+
 func (cis *CRMIntegrationService) getIntegration(integrationID string) (*CRMIntegration, error) {
 	query := `
-		SELECT id, brand_id, crm_type, api_key, api_secret, webhook_url, sync_interval, status
+		SELECT id, brand_id, crm_type, api_key, api_secret, webhook_url, base_url, settings, field_mapping, sync_interval, status
 		FROM crm_integrations WHERE id = ?
 	`
-	
+
 	var integration CRMIntegration
+	var apiSecret, webhookURL, baseURL, settings, fieldMapping sql.NullString
+	var syncInterval sql.NullInt64
 	err := cis.db.QueryRow(query, integrationID).Scan(
 		&integration.ID, &integration.BrandID, &integration.CRMType,
-		&integration.APIKey, &integration.APISecret, &integration.WebhookURL,
-		&integration.SyncInterval, &integration.Status,
+		&integration.APIKey, &apiSecret, &webhookURL, &baseURL, &settings, &fieldMapping,
+		&syncInterval, &integration.Status,
 	)
-	
+	if err == sql.ErrNoRows {
+		return nil, ErrCRMIntegrationNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("integration not found: %w", err)
+		return nil, fmt.Errorf("failed to get CRM integration: %w", err)
+	}
+
+	if integration.APIKey, err = cis.keyring.Decrypt(integration.APIKey); err != nil {
+		return nil, fmt.Errorf("failed to decrypt CRM API key: %w", err)
+	}
+	if integration.APISecret, err = cis.keyring.Decrypt(apiSecret.String); err != nil {
+		return nil, fmt.Errorf("failed to decrypt CRM API secret: %w", err)
+	}
+	integration.WebhookURL = webhookURL.String
+	integration.BaseURL = baseURL.String
+	integration.SyncInterval = int(syncInterval.Int64)
+	if settings.Valid {
+		json.Unmarshal([]byte(settings.String), &integration.Settings)
 	}
-	
+
+	// Integrations without their own mapping use the connector's default
+	if fieldMapping.Valid {
+		json.Unmarshal([]byte(fieldMapping.String), &integration.FieldMapping)
+	}
+	if len(integration.FieldMapping) == 0 {
+		if info, ok := crm.Lookup(integration.CRMType); ok {
+			integration.FieldMapping = info.DefaultFieldMapping
+		}
+	}
+
 	return &integration, nil
 }
 
-func (cis *CRMIntegrationService) getEventContacts(eventID string) ([]CRMContact, error) {
-	query := `
-		SELECT u.id, u.email, u.name, a.event_id
-		FROM users u
-		JOIN attendances a ON u.id = a.user_id
-		WHERE a.event_id = ? AND u.consent_marketing = 1
-	`
-	
-	rows, err := cis.db.Query(query, eventID)
+// ScheduleSync queues the next periodic sync of an integration. Only one
+// pending sync is kept per integration.
+func (cis *CRMIntegrationService) ScheduleSync(integrationID string) error {
+	integration, err := cis.getIntegration(integrationID)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-	
-	var contacts []CRMContact
-	for rows.Next() {
-		var contact CRMContact
-		err := rows.Scan(&contact.ID, &contact.Email, &contact.Name, &contact.EventID)
-		if err != nil {
-			continue
-		}
-		
-		contact.Metadata = map[string]interface{}{
-			"source":      "lynkr_event",
-			"sync_date":   time.Now().Format(time.RFC3339),
-		}
-		
-		contacts = append(contacts, contact)
+	if integration.SyncInterval <= 0 {
+		return fmt.Errorf("invalid sync interval: %d", integration.SyncInterval)
 	}
-	
-	return contacts, nil
+
+	_, err = cis.queue.Enqueue(CRMScheduledSyncJobType, crmSyncJobPayload{IntegrationID: integrationID}, jobs.EnqueueOptions{
+		RunAt:     time.Now().Add(time.Duration(integration.SyncInterval) * time.Minute),
+		DedupeKey: CRMScheduledSyncJobType + ":" + integrationID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to schedule CRM sync: %w", err)
+	}
+
+	return nil
 }
 
-func (cis *CRMIntegrationService) generateSignature(data, secret string) string {
-	mac := hmac.New(sha256.New, []byte(secret))
-	mac.Write([]byte(data))
-	return hex.EncodeToString(mac.Sum(nil))
+// QueueEventSync queues a one-off sync of an event's contacts
+func (cis *CRMIntegrationService) QueueEventSync(brandID, integrationID, eventID string) (*jobs.Job, error) {
+	if _, err := cis.getBrandIntegration(brandID, integrationID); err != nil {
+		return nil, err
+	}
+
+	var eventBrandID string
+	err := cis.db.QueryRow(`SELECT brand_id FROM events WHERE id = ?`, eventID).Scan(&eventBrandID)
+	if err == sql.ErrNoRows || (err == nil && eventBrandID != brandID) {
+		return nil, ErrCRMEventNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event: %w", err)
+	}
+
+	return cis.queue.Enqueue(CRMEventSyncJobType, crmSyncJobPayload{IntegrationID: integrationID, EventID: eventID}, jobs.EnqueueOptions{
+		DedupeKey: CRMEventSyncJobType + ":" + integrationID + ":" + eventID,
+	})
 }
 
-func (cis *CRMIntegrationService) ScheduleSync(integrationID string) error {
-	integration, err := cis.getIntegration(integrationID)
+// handleScheduledSyncJob syncs the brand's events with activity since the
+// last successful sync and queues the next run
+func (cis *CRMIntegrationService) handleScheduledSyncJob(ctx context.Context, job *jobs.Job) error {
+	var payload crmSyncJobPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	integration, err := cis.getIntegration(payload.IntegrationID)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if integration.Status != "active" {
+		return nil
+	}
+
+	// Queue the next run first so a failing sync does not break the schedule
+	if err := cis.ScheduleSync(integration.ID); err != nil {
+		log.Printf("Failed to schedule next CRM sync for %s: %v", integration.ID, err)
+	}
+
+	startedAt := time.Now().UTC()
+	eventIDs, err := cis.getChangedEvents(integration)
 	if err != nil {
 		return err
 	}
-	
-	// Schedule sync based on interval
-	go func() {
-		ticker := time.NewTicker(time.Duration(integration.SyncInterval) * time.Minute)
-		defer ticker.Stop()
-		
-		for range ticker.C {
-			// Get recent events for this brand
-			events := cis.getRecentEvents(integration.BrandID)
-			for _, eventID := range events {
-				cis.SyncEventData(integrationID, eventID)
-			}
+
+	// On shutdown the sync stops between events; the ledger skips contacts
+	// that were already pushed when it resumes
+	for _, eventID := range eventIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
-	}()
-	
+		if _, err := cis.syncEvent(ctx, integration, eventID, CRMSyncScheduled); err != nil {
+			return err
+		}
+	}
+
+	// Activity during this run is picked up by the next one
+	if _, err := cis.db.Exec(`UPDATE crm_integrations SET last_sync = ?, updated_at = ? WHERE id = ?`, startedAt, time.Now().UTC(), integration.ID); err != nil {
+		return fmt.Errorf("failed to update last sync time: %w", err)
+	}
+
 	return nil
 }
 
-func (cis *CRMIntegrationService) getRecentEvents(brandID string) []string {
-	query := `
-		SELECT id FROM events 
-		WHERE brand_id = ? AND created_at > datetime('now', '-1 day')
-	`
-	
-	rows, err := cis.db.Query(query, brandID)
+func (cis *CRMIntegrationService) handleEventSyncJob(ctx context.Context, job *jobs.Job) error {
+	var payload crmSyncJobPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	integration, err := cis.getIntegration(payload.IntegrationID)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	_, err = cis.syncEvent(ctx, integration, payload.EventID, CRMSyncManual)
+	return err
+}
+
+// getChangedEvents returns the brand's events whose attendees checked in or
+// out, posted content, answered surveys, earned points or changed their
+// marketing consent since the last sync; every event on the first sync.
+// Oldest events come first so a contact ends up with their latest event.
+func (cis *CRMIntegrationService) getChangedEvents(integration *CRMIntegration) ([]string, error) {
+	var lastSync sql.NullTime
+	if err := cis.db.QueryRow(`SELECT last_sync FROM crm_integrations WHERE id = ?`, integration.ID).Scan(&lastSync); err != nil {
+		return nil, fmt.Errorf("failed to get last sync time: %w", err)
+	}
+
+	query := `SELECT e.id FROM events e WHERE e.brand_id = ?`
+	args := []interface{}{integration.BrandID}
+	if lastSync.Valid {
+		query += ` AND (
+			EXISTS (SELECT 1 FROM attendances a WHERE a.event_id = e.id
+			        AND (datetime(a.check_in_time) > datetime(?) OR datetime(a.check_out_time) > datetime(?)))
+			OR EXISTS (SELECT 1 FROM content c WHERE c.event_id = e.id AND datetime(c.created_at) > datetime(?))
+			OR EXISTS (SELECT 1 FROM pulse_survey_responses psr JOIN pulse_surveys ps ON ps.id = psr.survey_id
+			           WHERE ps.event_id = e.id AND datetime(psr.completed_at) > datetime(?))
+			OR EXISTS (SELECT 1 FROM attendances a JOIN user_points up ON up.user_id = a.user_id
+			           WHERE a.event_id = e.id AND datetime(up.updated_at) > datetime(?))
+			OR EXISTS (SELECT 1 FROM attendances a JOIN user_consent_records ucr ON ucr.user_id = a.user_id
+			           WHERE a.event_id = e.id AND ucr.consent_type = ? AND datetime(ucr.created_at) > datetime(?))
+		)`
+		since := lastSync.Time.UTC()
+		args = append(args, since, since, since, since, since, crmConsentType, since)
+	}
+	query += ` ORDER BY e.start_time, e.id`
+
+	rows, err := cis.db.Query(query, args...)
 	if err != nil {
-		return []string{}
+		return nil, fmt.Errorf("failed to get changed events: %w", err)
 	}
 	defer rows.Close()
-	
+
 	var events []string
 	for rows.Next() {
 		var eventID string
-		if err := rows.Scan(&eventID); err == nil {
-			events = append(events, eventID)
+		if err := rows.Scan(&eventID); err != nil {
+			return nil, fmt.Errorf("failed to get changed events: %w", err)
 		}
+		events = append(events, eventID)
 	}
-	
-	return events
-}
\ No newline at end of file
+
+	return events, rows.Err()
+}
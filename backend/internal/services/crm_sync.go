@@ -0,0 +1,377 @@
+/**
+ * CRM Sync
+ * Incremental contact sync with a per-contact ledger, batching and rate limit handling
+ */
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"lynkr/internal/crm"
+	"lynkr/internal/jobs"
+)
+
+// CRM sync types, as stored in crm_sync_logs
+const (
+	CRMSyncManual    = "manual"
+	CRMSyncScheduled = "scheduled"
+	CRMSyncWebhook   = "webhook"
+)
+
+const (
+	// crmMaxRateLimitWait is the longest a sync waits in place for a rate
+	// limit to clear; longer waits are handed back to the job queue
+	crmMaxRateLimitWait    = 30 * time.Second
+	crmMaxRateLimitRetries = 3
+	// crmMaxReportedFailures caps the failed contacts kept per sync run
+	crmMaxReportedFailures = 100
+)
+
+// CRMSyncRun summarizes one sync of an event's contacts, or one inbound
+// webhook, whose matched contacts count as synced
+type CRMSyncRun struct {
+	ID            int64            `json:"id"`
+	IntegrationID string           `json:"integrationId"`
+	EventID       string           `json:"eventId,omitempty"`
+	SyncType      string           `json:"syncType"`
+	Status        string           `json:"status"` // success, partial or failed
+	Synced        int              `json:"recordsSynced"`
+	Skipped       int              `json:"recordsSkipped"` // unchanged since their last sync
+	Failed        int              `json:"recordsFailed"`
+	Failures      []CRMSyncFailure `json:"failures,omitempty"`
+	Error         string           `json:"error,omitempty"`
+	StartedAt     time.Time        `json:"startedAt"`
+	CompletedAt   *time.Time       `json:"completedAt,omitempty"`
+}
+
+// CRMSyncFailure is a contact the CRM rejected
+type CRMSyncFailure struct {
+	UserID string `json:"userId"`
+	Email  string `json:"email"`
+	Error  string `json:"error"`
+}
+
+// crmLedgerEntry is what the CRM last accepted for a contact
+type crmLedgerEntry struct {
+	Email      string
+	ExternalID string
+	Fields     map[string]json.RawMessage
+	Synced     bool
+}
+
+type crmPendingContact struct {
+	userID string
+	fields map[string]interface{} // all mapped fields, recorded in the ledger on success
+	push   crm.Contact            // only the changed fields
+}
+
+// SyncEventData pushes the consenting attendees of an event to the CRM. Only
+// contacts whose mapped fields changed since their last sync are sent, and
+// only the changed fields. Contacts the CRM rejects are reported in the run
+// without failing the sync.
+func (cis *CRMIntegrationService) SyncEventData(ctx context.Context, integrationID, eventID string) (*CRMSyncRun, error) {
+	integration, err := cis.getIntegration(integrationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get integration: %w", err)
+	}
+
+	return cis.syncEvent(ctx, integration, eventID, CRMSyncManual)
+}
+
+func (cis *CRMIntegrationService) syncEvent(ctx context.Context, integration *CRMIntegration, eventID, syncType string) (*CRMSyncRun, error) {
+	run := &CRMSyncRun{
+		IntegrationID: integration.ID,
+		EventID:       eventID,
+		SyncType:      syncType,
+		StartedAt:     time.Now().UTC(),
+	}
+
+	err := cis.pushEventContacts(ctx, integration, run)
+	if recordErr := cis.recordSyncRun(run, err); recordErr != nil {
+		log.Printf("Failed to record CRM sync of event %s: %v", eventID, recordErr)
+	}
+	return run, err
+}
+
+func (cis *CRMIntegrationService) pushEventContacts(ctx context.Context, integration *CRMIntegration, run *CRMSyncRun) error {
+	info, _ := crm.Lookup(integration.CRMType)
+	connector, err := cis.connector(integration)
+	if err != nil {
+		return jobs.Permanent(fmt.Errorf("failed to set up %s connector: %w", integration.CRMType, err))
+	}
+
+	contacts, err := cis.getEventContacts(run.EventID)
+	if err != nil {
+		return fmt.Errorf("failed to get event contacts: %w", err)
+	}
+
+	ledger, err := cis.loadLedger(integration.ID)
+	if err != nil {
+		return err
+	}
+
+	var pending []crmPendingContact
+	for _, contact := range contacts {
+		mapped := mapCRMContact(contact, integration.FieldMapping)
+		entry := ledger[contact.ID]
+		if entry != nil && entry.Email != contact.Email {
+			// Upserts are keyed on email, so a new address is a new CRM contact
+			entry = nil
+		}
+
+		changed := changedCRMFields(mapped.Fields, entry)
+		if entry != nil && entry.Synced && len(changed) == 0 {
+			run.Skipped++
+			continue
+		}
+
+		push := mapped
+		push.Fields = changed
+		if entry != nil {
+			push.ExternalID = entry.ExternalID
+		}
+		pending = append(pending, crmPendingContact{userID: contact.ID, fields: mapped.Fields, push: push})
+	}
+
+	for start := 0; start < len(pending); start += info.BatchSize {
+		end := start + info.BatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		if err := cis.pushBatch(ctx, integration, connector, pending[start:end], run); err != nil {
+			return fmt.Errorf("failed to sync contacts to %s: %w", integration.CRMType, err)
+		}
+	}
+
+	return nil
+}
+
+// pushBatch upserts a batch and records the outcome of every contact in the
+// ledger. Short rate limits are waited out; longer ones fail the batch with
+// the requested delay so the job queue retries it later.
+func (cis *CRMIntegrationService) pushBatch(ctx context.Context, integration *CRMIntegration, connector crm.Connector, batch []crmPendingContact, run *CRMSyncRun) error {
+	contacts := make([]crm.Contact, len(batch))
+	for i, pending := range batch {
+		contacts[i] = pending.push
+	}
+
+	var results []crm.Result
+	for attempt := 0; ; attempt++ {
+		var err error
+		results, err = connector.UpsertContacts(ctx, contacts)
+		if err == nil {
+			break
+		}
+
+		wait, limited := crm.RateLimited(err)
+		if !limited {
+			return err
+		}
+		if wait == 0 {
+			wait = time.Second << attempt
+		}
+		if attempt >= crmMaxRateLimitRetries || wait > crmMaxRateLimitWait {
+			return jobs.RetryAfter(err, wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	for i, result := range results {
+		pending := batch[i]
+		if result.Err != nil {
+			run.Failed++
+			if len(run.Failures) < crmMaxReportedFailures {
+				run.Failures = append(run.Failures, CRMSyncFailure{UserID: pending.userID, Email: pending.push.Email, Error: result.Err.Error()})
+			}
+			if err := cis.markLedgerFailed(integration.ID, pending, result.Err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		run.Synced++
+		if err := cis.markLedgerSynced(integration.ID, pending, result.ExternalID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// changedCRMFields returns the fields whose value differs from what the CRM
+// last accepted, or all fields for contacts that were never synced
+func changedCRMFields(fields map[string]interface{}, entry *crmLedgerEntry) map[string]interface{} {
+	changed := make(map[string]interface{})
+	for field, value := range fields {
+		encoded, err := json.Marshal(value)
+		if err != nil || entry == nil || !bytes.Equal(encoded, entry.Fields[field]) {
+			changed[field] = value
+		}
+	}
+	return changed
+}
+
+func (cis *CRMIntegrationService) loadLedger(integrationID string) (map[string]*crmLedgerEntry, error) {
+	rows, err := cis.db.Query(`
+		SELECT user_id, email, external_id, fields, status
+		FROM crm_sync_ledger WHERE integration_id = ?
+	`, integrationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CRM sync ledger: %w", err)
+	}
+	defer rows.Close()
+
+	ledger := make(map[string]*crmLedgerEntry)
+	for rows.Next() {
+		var userID, fields, status string
+		var externalID sql.NullString
+		entry := &crmLedgerEntry{}
+		if err := rows.Scan(&userID, &entry.Email, &externalID, &fields, &status); err != nil {
+			return nil, fmt.Errorf("failed to load CRM sync ledger: %w", err)
+		}
+		entry.ExternalID = externalID.String
+		entry.Synced = status == "synced"
+		json.Unmarshal([]byte(fields), &entry.Fields)
+		ledger[userID] = entry
+	}
+
+	return ledger, rows.Err()
+}
+
+func (cis *CRMIntegrationService) markLedgerSynced(integrationID string, pending crmPendingContact, externalID string) error {
+	fields, err := json.Marshal(pending.fields)
+	if err != nil {
+		return fmt.Errorf("failed to encode CRM fields: %w", err)
+	}
+
+	now := time.Now().UTC()
+	_, err = cis.db.Exec(`
+		INSERT INTO crm_sync_ledger (integration_id, user_id, email, external_id, fields, status, last_error, synced_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 'synced', NULL, ?, ?)
+		ON CONFLICT (integration_id, user_id) DO UPDATE SET
+			email = excluded.email,
+			external_id = COALESCE(excluded.external_id, crm_sync_ledger.external_id),
+			fields = excluded.fields,
+			status = 'synced',
+			last_error = NULL,
+			synced_at = excluded.synced_at,
+			updated_at = excluded.updated_at
+	`, integrationID, pending.userID, pending.push.Email, sql.NullString{String: externalID, Valid: externalID != ""}, string(fields), now, now)
+	if err != nil {
+		return fmt.Errorf("failed to update CRM sync ledger: %w", err)
+	}
+	return nil
+}
+
+// markLedgerFailed keeps the fields the CRM last accepted, so the next sync
+// sends the same changes again
+func (cis *CRMIntegrationService) markLedgerFailed(integrationID string, pending crmPendingContact, syncErr error) error {
+	now := time.Now().UTC()
+	_, err := cis.db.Exec(`
+		INSERT INTO crm_sync_ledger (integration_id, user_id, email, fields, status, last_error, updated_at)
+		VALUES (?, ?, ?, '{}', 'failed', ?, ?)
+		ON CONFLICT (integration_id, user_id) DO UPDATE SET
+			status = 'failed',
+			last_error = excluded.last_error,
+			updated_at = excluded.updated_at
+	`, integrationID, pending.userID, pending.push.Email, syncErr.Error(), now)
+	if err != nil {
+		return fmt.Errorf("failed to update CRM sync ledger: %w", err)
+	}
+	return nil
+}
+
+// recordSyncRun completes the run and writes it to crm_sync_logs
+func (cis *CRMIntegrationService) recordSyncRun(run *CRMSyncRun, syncErr error) error {
+	completedAt := time.Now().UTC()
+	run.CompletedAt = &completedAt
+
+	switch {
+	case syncErr != nil:
+		run.Status = "failed"
+		run.Error = syncErr.Error()
+	case run.Failed == 0:
+		run.Status = "success"
+	case run.Synced == 0 && run.Skipped == 0:
+		run.Status = "failed"
+		run.Error = "every contact was rejected by the CRM"
+	default:
+		run.Status = "partial"
+	}
+
+	var failures sql.NullString
+	if len(run.Failures) > 0 {
+		data, err := json.Marshal(run.Failures)
+		if err != nil {
+			return fmt.Errorf("failed to encode sync failures: %w", err)
+		}
+		failures = sql.NullString{String: string(data), Valid: true}
+	}
+
+	result, err := cis.db.Exec(`
+		INSERT INTO crm_sync_logs (
+			integration_id, event_id, sync_type, records_synced, records_skipped, records_failed,
+			status, error_message, failures, started_at, completed_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, run.IntegrationID, sql.NullString{String: run.EventID, Valid: run.EventID != ""}, run.SyncType, run.Synced, run.Skipped, run.Failed,
+		run.Status, sql.NullString{String: run.Error, Valid: run.Error != ""}, failures, run.StartedAt, completedAt)
+	if err != nil {
+		return err
+	}
+
+	run.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// ListSyncRuns returns the most recent sync runs of a brand's integration
+func (cis *CRMIntegrationService) ListSyncRuns(brandID, integrationID string, limit int) ([]CRMSyncRun, error) {
+	if _, err := cis.getBrandIntegration(brandID, integrationID); err != nil {
+		return nil, err
+	}
+
+	rows, err := cis.db.Query(`
+		SELECT id, integration_id, event_id, sync_type, status, records_synced,
+		       COALESCE(records_skipped, 0), COALESCE(records_failed, 0),
+		       failures, error_message, started_at, completed_at
+		FROM crm_sync_logs WHERE integration_id = ?
+		ORDER BY started_at DESC, id DESC LIMIT ?
+	`, integrationID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CRM syncs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []CRMSyncRun{}
+	for rows.Next() {
+		var run CRMSyncRun
+		var eventID, failures, errorMessage sql.NullString
+		var completedAt sql.NullTime
+		if err := rows.Scan(&run.ID, &run.IntegrationID, &eventID, &run.SyncType, &run.Status,
+			&run.Synced, &run.Skipped, &run.Failed, &failures, &errorMessage, &run.StartedAt, &completedAt); err != nil {
+			return nil, fmt.Errorf("failed to list CRM syncs: %w", err)
+		}
+		run.EventID = eventID.String
+		run.Error = errorMessage.String
+		if failures.Valid {
+			json.Unmarshal([]byte(failures.String), &run.Failures)
+		}
+		if completedAt.Valid {
+			run.CompletedAt = &completedAt.Time
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"lynkr/internal/crm"
+	"lynkr/internal/jobs"
+	"lynkr/pkg/secrets"
+)
+
+// fakeCRMContact is a contact as a fake CRM received it
+type fakeCRMContact struct {
+	Email  string
+	Fields map[string]interface{}
+}
+
+// fakeCRM answers HubSpot batch upserts and Mailchimp batch subscribes,
+// accepting every contact except the rejected ones
+type fakeCRM struct {
+	mu      sync.Mutex
+	batches [][]fakeCRMContact
+	reject  map[string]bool
+	// rateLimits are Retry-After values answered, in order, before accepting requests
+	rateLimits []string
+	calls      int
+}
+
+func (f *fakeCRM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if len(f.rateLimits) > 0 {
+		w.Header().Set("Retry-After", f.rateLimits[0])
+		f.rateLimits = f.rateLimits[1:]
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	var batch []fakeCRMContact
+	switch {
+	case r.URL.Path == "/crm/v3/objects/contacts/batch/upsert":
+		var request struct {
+			Inputs []struct {
+				ID         string                 `json:"id"`
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"inputs"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		type record struct {
+			ID         string            `json:"id"`
+			Properties map[string]string `json:"properties"`
+		}
+		response := struct {
+			Results []record                 `json:"results"`
+			Errors  []map[string]interface{} `json:"errors"`
+		}{}
+		for _, input := range request.Inputs {
+			delete(input.Properties, "email")
+			batch = append(batch, fakeCRMContact{Email: input.ID, Fields: input.Properties})
+			if f.reject[input.ID] {
+				response.Errors = append(response.Errors, map[string]interface{}{
+					"message": "Property values were not valid",
+					"context": map[string][]string{"ids": {input.ID}},
+				})
+				continue
+			}
+			response.Results = append(response.Results, record{ID: "hs-" + input.ID, Properties: map[string]string{"email": input.ID}})
+		}
+		json.NewEncoder(w).Encode(response)
+	case strings.HasPrefix(r.URL.Path, "/3.0/lists/"):
+		var request struct {
+			Members []struct {
+				EmailAddress string                 `json:"email_address"`
+				MergeFields  map[string]interface{} `json:"merge_fields"`
+			} `json:"members"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		response := struct {
+			NewMembers []map[string]string `json:"new_members"`
+			Errors     []map[string]string `json:"errors"`
+		}{}
+		for _, member := range request.Members {
+			batch = append(batch, fakeCRMContact{Email: member.EmailAddress, Fields: member.MergeFields})
+			if f.reject[member.EmailAddress] {
+				response.Errors = append(response.Errors, map[string]string{"email_address": member.EmailAddress, "error": "looks fake or invalid"})
+				continue
+			}
+			response.NewMembers = append(response.NewMembers, map[string]string{"id": "mc-" + member.EmailAddress, "email_address": member.EmailAddress})
+		}
+		json.NewEncoder(w).Encode(response)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	f.batches = append(f.batches, batch)
+}
+
+// takeBatches returns and forgets the batches received so far
+func (f *fakeCRM) takeBatches() [][]fakeCRMContact {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	batches := f.batches
+	f.batches = nil
+	return batches
+}
+
+// crmSyncTest is a CRM integration of brand 1 pointed at a fake CRM, with
+// event 1 attended by consenting guests guest001@example.com and up
+type crmSyncTest struct {
+	db          *sql.DB
+	crm         *fakeCRM
+	service     *CRMIntegrationService
+	integration *CRMIntegration
+}
+
+func newCRMSyncTest(t *testing.T, crmType string, guests int) *crmSyncTest {
+	t.Helper()
+	db := newTestDB(t)
+	mustExec(t, db, `INSERT INTO brands (id, name, contact_info) VALUES (1, 'Acme', 'a@acme.test')`)
+	mustExec(t, db, `INSERT INTO events (id, name, location, start_time, end_time, brand_id) VALUES (1, 'Launch', 'Berlin', '2026-10-01 18:00:00', '2026-10-01 22:00:00', 1)`)
+	for i := 1; i <= guests; i++ {
+		mustExec(t, db, `INSERT INTO users (id, username, email) VALUES (?, ?, ?)`, i, fmt.Sprintf("Guest %03d", i), fmt.Sprintf("guest%03d@example.com", i))
+		mustExec(t, db, `INSERT INTO attendances (user_id, event_id, check_in_time) VALUES (?, 1, '2026-10-01 18:30:00')`, i)
+		mustExec(t, db, `INSERT INTO user_consent_records (user_id, consent_type, granted, version) VALUES (?, ?, 1, '1')`, i, crmConsentType)
+	}
+
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	keyring, err := secrets.NewKeyring(map[string]string{"test": key}, "test")
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+
+	fake := &fakeCRM{reject: map[string]bool{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	service := NewCRMIntegrationService(db, jobs.NewQueue(db, time.Minute), keyring, CRMOptions{AllowInsecureBaseURLs: true})
+	integration, err := service.CreateIntegration("1", CRMIntegrationInput{
+		CRMType:  crmType,
+		APIKey:   "key-us6",
+		BaseURL:  server.URL,
+		Settings: map[string]string{"list_id": "l1"},
+	})
+	if err != nil {
+		t.Fatalf("CreateIntegration: %v", err)
+	}
+
+	return &crmSyncTest{db: db, crm: fake, service: service, integration: integration}
+}
+
+func (ct *crmSyncTest) sync(t *testing.T) *CRMSyncRun {
+	t.Helper()
+	run, err := ct.service.SyncEventData(context.Background(), ct.integration.ID, "1")
+	if err != nil {
+		t.Fatalf("SyncEventData: %v", err)
+	}
+	return run
+}
+
+func checkRun(t *testing.T, run *CRMSyncRun, status string, synced, skipped, failed int) {
+	t.Helper()
+	if run.Status != status || run.Synced != synced || run.Skipped != skipped || run.Failed != failed {
+		t.Errorf("run = %s with %d synced, %d skipped, %d failed; want %s with %d, %d, %d",
+			run.Status, run.Synced, run.Skipped, run.Failed, status, synced, skipped, failed)
+	}
+}
+
+func TestCRMSyncBatchesAndSkipsUnchangedContacts(t *testing.T) {
+	ct := newCRMSyncTest(t, "hubspot", 150)
+
+	run := ct.sync(t)
+	checkRun(t, run, "success", 150, 0, 0)
+	batches := ct.crm.takeBatches()
+	if len(batches) != 2 || len(batches[0]) != 100 || len(batches[1]) != 50 {
+		t.Fatalf("sent %d batches, want batches of 100 and 50", len(batches))
+	}
+	first := batches[0][0]
+	if first.Email != "guest001@example.com" || first.Fields["firstname"] != "Guest" || first.Fields["lastname"] != "001" ||
+		first.Fields["event_id"] != "1" || first.Fields["source"] != "Lynkr Event" {
+		t.Errorf("first contact = %+v, want all mapped fields", first)
+	}
+
+	var externalID string
+	ct.db.QueryRow(`SELECT external_id FROM crm_sync_ledger WHERE integration_id = ? AND user_id = '1'`, ct.integration.ID).Scan(&externalID)
+	if externalID != "hs-guest001@example.com" {
+		t.Errorf("ledger external_id = %q, want the HubSpot record ID", externalID)
+	}
+
+	// Nothing changed, so nothing is sent
+	run = ct.sync(t)
+	checkRun(t, run, "success", 0, 150, 0)
+	if batches := ct.crm.takeBatches(); len(batches) != 0 {
+		t.Errorf("sent %d batches for unchanged contacts", len(batches))
+	}
+
+	// Only the changed field of the changed contact is sent
+	mustExec(t, ct.db, `UPDATE users SET username = 'Guest Seven' WHERE id = 7`)
+	run = ct.sync(t)
+	checkRun(t, run, "success", 1, 149, 0)
+	batches = ct.crm.takeBatches()
+	if len(batches) != 1 || len(batches[0]) != 1 {
+		t.Fatalf("sent %v, want one batch with the changed contact", batches)
+	}
+	changed := batches[0][0]
+	if changed.Email != "guest007@example.com" || len(changed.Fields) != 1 || changed.Fields["lastname"] != "Seven" {
+		t.Errorf("changed contact = %+v, want only the new last name", changed)
+	}
+
+	var logs int
+	ct.db.QueryRow(`SELECT COUNT(*) FROM crm_sync_logs WHERE integration_id = ?`, ct.integration.ID).Scan(&logs)
+	if logs != 3 {
+		t.Errorf("recorded %d sync runs, want 3", logs)
+	}
+}
+
+func TestCRMSyncRecordsPartialFailures(t *testing.T) {
+	ct := newCRMSyncTest(t, "mailchimp", 3)
+	ct.crm.reject["guest002@example.com"] = true
+
+	run := ct.sync(t)
+	checkRun(t, run, "partial", 2, 0, 1)
+	if len(run.Failures) != 1 || run.Failures[0].UserID != "2" || run.Failures[0].Email != "guest002@example.com" || run.Failures[0].Error != "looks fake or invalid" {
+		t.Errorf("failures = %+v, want the rejected contact", run.Failures)
+	}
+
+	var status, lastError string
+	ct.db.QueryRow(`SELECT status, last_error FROM crm_sync_ledger WHERE integration_id = ? AND user_id = '2'`, ct.integration.ID).Scan(&status, &lastError)
+	if status != "failed" || lastError != "looks fake or invalid" {
+		t.Errorf("ledger = %s (%s), want the failure recorded", status, lastError)
+	}
+	ct.crm.takeBatches()
+
+	// The rejected contact is sent again, in full, while the others are skipped
+	delete(ct.crm.reject, "guest002@example.com")
+	run = ct.sync(t)
+	checkRun(t, run, "success", 1, 2, 0)
+	batches := ct.crm.takeBatches()
+	if len(batches) != 1 || len(batches[0]) != 1 {
+		t.Fatalf("sent %v, want one batch with the failed contact", batches)
+	}
+	if retried := batches[0][0]; retried.Email != "guest002@example.com" || len(retried.Fields) != 3 {
+		t.Errorf("retried contact = %+v, want all mapped fields", retried)
+	}
+
+	runs, err := ct.service.ListSyncRuns("1", ct.integration.ID, 10)
+	if err != nil {
+		t.Fatalf("ListSyncRuns: %v", err)
+	}
+	if len(runs) != 2 || runs[1].Status != "partial" || len(runs[1].Failures) != 1 {
+		t.Errorf("sync runs = %+v, want the partial run with its failure", runs)
+	}
+}
+
+func TestCRMSyncFailsWhenEveryContactIsRejected(t *testing.T) {
+	ct := newCRMSyncTest(t, "hubspot", 2)
+	ct.crm.reject["guest001@example.com"] = true
+	ct.crm.reject["guest002@example.com"] = true
+
+	run := ct.sync(t)
+	checkRun(t, run, "failed", 0, 0, 2)
+	if run.Error == "" {
+		t.Error("run has no error")
+	}
+}
+
+func TestCRMSyncRateLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		rateLimits  []string
+		wantRetry   time.Duration // the delay handed to the job queue, if the sync fails
+		wantCalls   int
+		wantSynced  int
+		wantLimited bool
+	}{
+		{name: "short limit is waited out", rateLimits: []string{"1"}, wantCalls: 2, wantSynced: 2},
+		{name: "long limit goes back to the queue", rateLimits: []string{"120"}, wantRetry: 2 * time.Minute, wantCalls: 1, wantLimited: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ct := newCRMSyncTest(t, "hubspot", 2)
+			ct.crm.rateLimits = tt.rateLimits
+
+			run, err := ct.service.SyncEventData(context.Background(), ct.integration.ID, "1")
+			wait, limited := crm.RateLimited(err)
+			if limited != tt.wantLimited || wait != tt.wantRetry {
+				t.Fatalf("err = %v, want a rate limit of %v: %v", err, tt.wantRetry, tt.wantLimited)
+			}
+			if ct.crm.calls != tt.wantCalls || run.Synced != tt.wantSynced {
+				t.Errorf("synced %d contacts in %d calls, want %d in %d", run.Synced, ct.crm.calls, tt.wantSynced, tt.wantCalls)
+			}
+
+			var ledger int
+			ct.db.QueryRow(`SELECT COUNT(*) FROM crm_sync_ledger WHERE integration_id = ?`, ct.integration.ID).Scan(&ledger)
+			if ledger != tt.wantSynced {
+				t.Errorf("ledger has %d contacts, want %d", ledger, tt.wantSynced)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+/**
+ * CRM Webhooks
+ * Applies unsubscribes and contact changes reported by CRMs to Lynkr
+ */
+
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"lynkr/internal/crm"
+)
+
+var (
+	ErrCRMWebhooksNotSupported = errors.New("CRM does not send webhooks")
+	ErrInvalidCRMWebhook       = errors.New("invalid CRM webhook")
+	ErrCRMWebhookUnauthorized  = errors.New("CRM webhook signature could not be verified")
+)
+
+// crmWebhookPath is where CRMs deliver webhooks, followed by the integration ID
+const crmWebhookPath = "/api/v1/webhooks/crm/"
+
+// CRMWebhookRequest is an inbound CRM webhook as received by the API
+type CRMWebhookRequest struct {
+	Method     string
+	RequestURI string // path and query
+	Header     http.Header
+	Body       []byte
+}
+
+// CRMWebhookResult summarizes what an inbound webhook changed
+type CRMWebhookResult struct {
+	Unsubscribed  int `json:"unsubscribed"`
+	FieldsUpdated int `json:"fieldsUpdated"`
+	// Unmatched counts contacts this integration never synced; they are ignored
+	Unmatched int `json:"unmatched"`
+}
+
+// setWebhookURL fills in the inbound webhook URL for connectors that accept webhooks
+func (cis *CRMIntegrationService) setWebhookURL(integration *CRMIntegration) {
+	connector, err := cis.connector(integration)
+	if err != nil {
+		return
+	}
+	if _, ok := connector.(crm.WebhookReceiver); ok {
+		integration.InboundWebhookURL = strings.TrimRight(cis.options.PublicBaseURL, "/") + crmWebhookPath + integration.ID
+	}
+}
+
+// HandleWebhook verifies an inbound CRM webhook and applies its changes. An
+// unsubscribe revokes the contact's marketing consent, so no CRM receives
+// them again until they opt back in through Lynkr. Changed CRM fields are
+// recorded in the sync ledger, so the next sync pushes Lynkr's value again
+// for attributes Lynkr owns.
+func (cis *CRMIntegrationService) HandleWebhook(integrationID string, request CRMWebhookRequest) (*CRMWebhookResult, error) {
+	integration, err := cis.getIntegration(integrationID)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, err := cis.connector(integration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up %s connector: %w", integration.CRMType, err)
+	}
+	receiver, ok := connector.(crm.WebhookReceiver)
+	if !ok {
+		return nil, ErrCRMWebhooksNotSupported
+	}
+
+	updates, err := receiver.ParseWebhook(crm.WebhookRequest{
+		Method: request.Method,
+		URL:    strings.TrimRight(cis.options.PublicBaseURL, "/") + request.RequestURI,
+		Header: request.Header,
+		Body:   request.Body,
+	})
+	switch {
+	case errors.Is(err, crm.ErrInvalidSignature), errors.Is(err, crm.ErrWebhookNotConfigured):
+		return nil, fmt.Errorf("%w: %v", ErrCRMWebhookUnauthorized, err)
+	case errors.Is(err, crm.ErrInvalidWebhook):
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCRMWebhook, err)
+	case err != nil:
+		return nil, err
+	}
+
+	run := &CRMSyncRun{IntegrationID: integration.ID, SyncType: CRMSyncWebhook, StartedAt: time.Now().UTC()}
+	result := &CRMWebhookResult{}
+	err = cis.applyContactUpdates(integration, updates, result, run)
+	if recordErr := cis.recordSyncRun(run, err); recordErr != nil {
+		log.Printf("Failed to record CRM webhook for %s: %v", integration.ID, recordErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (cis *CRMIntegrationService) applyContactUpdates(integration *CRMIntegration, updates []crm.ContactUpdate, result *CRMWebhookResult, run *CRMSyncRun) error {
+	// Only mapped fields are tracked in the ledger
+	mappedFields := make(map[string]bool, len(integration.FieldMapping))
+	for _, field := range integration.FieldMapping {
+		mappedFields[field] = true
+	}
+
+	for _, update := range updates {
+		userID, err := cis.findSyncedContact(integration.ID, update)
+		if err != nil {
+			return err
+		}
+		if userID == "" {
+			result.Unmatched++
+			run.Skipped++
+			continue
+		}
+		run.Synced++
+
+		if update.Unsubscribed {
+			revoked, err := cis.revokeMarketingConsent(integration, userID, update)
+			if err != nil {
+				return err
+			}
+			if revoked {
+				result.Unsubscribed++
+			}
+		}
+
+		fields := make(map[string]interface{})
+		for field, value := range update.Fields {
+			if mappedFields[field] {
+				fields[field] = value
+			}
+		}
+		if len(fields) > 0 {
+			if err := cis.recordCRMFields(integration.ID, userID, fields); err != nil {
+				return err
+			}
+			result.FieldsUpdated += len(fields)
+		}
+	}
+
+	return nil
+}
+
+// findSyncedContact returns the Lynkr user a CRM contact was synced from,
+// matched on the CRM's record ID or the email address
+func (cis *CRMIntegrationService) findSyncedContact(integrationID string, update crm.ContactUpdate) (string, error) {
+	var userID string
+	err := cis.db.QueryRow(`
+		SELECT user_id FROM crm_sync_ledger
+		WHERE integration_id = ? AND (
+			(? != '' AND external_id = ?) OR (? != '' AND email = ? COLLATE NOCASE)
+		)
+		LIMIT 1
+	`, integrationID, update.ExternalID, update.ExternalID, update.Email, update.Email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find CRM contact: %w", err)
+	}
+	return userID, nil
+}
+
+// revokeMarketingConsent records a CRM unsubscribe as a consent withdrawal
+// and writes it to the privacy audit log. Users without granted consent are
+// left alone, which keeps redelivered webhooks from adding records.
+func (cis *CRMIntegrationService) revokeMarketingConsent(integration *CRMIntegration, userID string, update crm.ContactUpdate) (bool, error) {
+	tx, err := cis.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke consent: %w", err)
+	}
+	defer tx.Rollback()
+
+	var granted sql.NullBool
+	err = tx.QueryRow(`
+		SELECT granted FROM user_consent_records
+		WHERE user_id = ? AND consent_type = ?
+		ORDER BY created_at DESC, id DESC LIMIT 1
+	`, userID, crmConsentType).Scan(&granted)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to revoke consent: %w", err)
+	}
+	if !granted.Bool {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_consent_records (user_id, consent_type, granted, version, user_agent)
+		VALUES (?, ?, 0, COALESCE((SELECT version FROM consent_types WHERE type = ?), '1.0'), ?)
+	`, userID, crmConsentType, crmConsentType, "crm-webhook/"+integration.CRMType)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke consent: %w", err)
+	}
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"consentType":   crmConsentType,
+		"granted":       false,
+		"source":        "crm_webhook",
+		"crmType":       integration.CRMType,
+		"integrationId": integration.ID,
+		"brandId":       integration.BrandID,
+		"occurredAt":    update.OccurredAt,
+	})
+	_, err = tx.Exec(`
+		INSERT INTO privacy_audit_log (action, user_id, details, created_at)
+		VALUES ('consent_updated', ?, ?, ?)
+	`, userID, string(details), time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to write consent audit log: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to revoke consent: %w", err)
+	}
+	return true, nil
+}
+
+// recordCRMFields stores field values changed in the CRM as the contact's
+// last known CRM state
+func (cis *CRMIntegrationService) recordCRMFields(integrationID, userID string, changed map[string]interface{}) error {
+	var fieldsJSON string
+	err := cis.db.QueryRow(`SELECT fields FROM crm_sync_ledger WHERE integration_id = ? AND user_id = ?`, integrationID, userID).Scan(&fieldsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update CRM sync ledger: %w", err)
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal([]byte(fieldsJSON), &fields); err != nil {
+		return fmt.Errorf("failed to decode CRM sync ledger fields: %w", err)
+	}
+	for field, value := range changed {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode CRM fields: %w", err)
+		}
+		fields[field] = encoded
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to encode CRM fields: %w", err)
+	}
+	_, err = cis.db.Exec(`
+		UPDATE crm_sync_ledger SET fields = ?, updated_at = ?
+		WHERE integration_id = ? AND user_id = ?
+	`, string(data), time.Now().UTC(), integrationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update CRM sync ledger: %w", err)
+	}
+	return nil
+}
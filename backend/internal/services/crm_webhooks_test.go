@@ -0,0 +1,40 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRecordCRMFields(t *testing.T) {
+	db := newTestDB(t)
+	cis := &CRMIntegrationService{db: db}
+	mustExec(t, db, `
+		INSERT INTO crm_sync_ledger (integration_id, user_id, email, fields, status) VALUES
+			('crm_1', '1', 'ada@example.com', '{"FNAME":"Ada","POINTS":10}', 'synced'),
+			('crm_1', '2', 'grace@example.com', '{"FNAME":', 'synced')
+	`)
+
+	if err := cis.recordCRMFields("crm_1", "1", map[string]interface{}{"POINTS": 25, "LNAME": "Lovelace"}); err != nil {
+		t.Fatalf("recordCRMFields: %v", err)
+	}
+	var fieldsJSON string
+	db.QueryRow(`SELECT fields FROM crm_sync_ledger WHERE user_id = '1'`).Scan(&fieldsJSON)
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(fieldsJSON), &fields); err != nil {
+		t.Fatalf("ledger fields %q: %v", fieldsJSON, err)
+	}
+	want := map[string]interface{}{"FNAME": "Ada", "LNAME": "Lovelace", "POINTS": float64(25)}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("ledger fields = %v, want %v", fields, want)
+	}
+
+	// A ledger entry that cannot be read is not replaced by the changed fields alone
+	if err := cis.recordCRMFields("crm_1", "2", map[string]interface{}{"LNAME": "Hopper"}); err == nil {
+		t.Error("recordCRMFields succeeded on a corrupt ledger entry")
+	}
+	db.QueryRow(`SELECT fields FROM crm_sync_ledger WHERE user_id = '2'`).Scan(&fieldsJSON)
+	if fieldsJSON != `{"FNAME":` {
+		t.Errorf("corrupt ledger fields were rewritten to %s", fieldsJSON)
+	}
+}
@@ -0,0 +1,212 @@
+/**
+ * Currency Service
+ * Exchange rates and the currency each brand's money totals are reported in
+ */
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"lynkr/pkg/money"
+)
+
+var (
+	ErrInvalidCurrency = errors.New("invalid currency")
+	ErrBrandNotFound   = errors.New("brand not found")
+)
+
+type CurrencyService struct {
+	db *sql.DB
+}
+
+func NewCurrencyService(db *sql.DB) *CurrencyService {
+	return &CurrencyService{db: db}
+}
+
+// LoadExchangeRates replaces the exchange rate table, for example with a
+// rates file read by money.LoadRates
+func (cs *CurrencyService) LoadExchangeRates(rates *money.Rates) error {
+	tx, err := cs.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to load exchange rates: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM exchange_rates`); err != nil {
+		return fmt.Errorf("failed to load exchange rates: %w", err)
+	}
+	now := time.Now().UTC()
+	for currency, rate := range rates.Rates {
+		_, err := tx.Exec(`INSERT INTO exchange_rates (currency, base_currency, rate, updated_at) VALUES (?, ?, ?, ?)`,
+			currency, rates.Base, rate, now)
+		if err != nil {
+			return fmt.Errorf("failed to load exchange rate of %s: %w", currency, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to load exchange rates: %w", err)
+	}
+	return nil
+}
+
+// GetExchangeRates returns the loaded exchange rates. Without a rates file
+// only the default currency is known.
+func (cs *CurrencyService) GetExchangeRates() (*money.Rates, error) {
+	return loadExchangeRates(cs.db)
+}
+
+// GetReportingCurrency returns the currency the brand's analytics are reported in
+func (cs *CurrencyService) GetReportingCurrency(brandID string) (string, error) {
+	rates, err := loadExchangeRates(cs.db)
+	if err != nil {
+		return "", err
+	}
+	return brandReportingCurrency(cs.db, brandID, rates)
+}
+
+// SetReportingCurrency changes the currency the brand's analytics are
+// reported in. Only currencies with an exchange rate can be chosen.
+func (cs *CurrencyService) SetReportingCurrency(brandID, currency string) (string, error) {
+	currency, err := money.Normalize(currency)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidCurrency, err)
+	}
+	rates, err := loadExchangeRates(cs.db)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := rates.Rates[currency]; !ok {
+		return "", fmt.Errorf("%w: no exchange rate for %s", ErrInvalidCurrency, currency)
+	}
+
+	result, err := cs.db.Exec(`UPDATE brands SET reporting_currency = ?, updated_at = ? WHERE CAST(id AS TEXT) = ?`,
+		currency, time.Now(), brandID)
+	if err != nil {
+		return "", fmt.Errorf("failed to set reporting currency: %w", err)
+	}
+	if count, err := result.RowsAffected(); err == nil && count == 0 {
+		return "", ErrBrandNotFound
+	}
+	return currency, nil
+}
+
+// loadExchangeRates reads the exchange rate table
+func loadExchangeRates(db *sql.DB) (*money.Rates, error) {
+	rows, err := db.Query(`SELECT currency, base_currency, rate FROM exchange_rates`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := &money.Rates{Base: money.DefaultCurrency, Rates: map[string]float64{}}
+	for rows.Next() {
+		var currency string
+		var rate float64
+		if err := rows.Scan(&currency, &rates.Base, &rate); err != nil {
+			return nil, fmt.Errorf("failed to load exchange rates: %w", err)
+		}
+		rates.Rates[currency] = rate
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load exchange rates: %w", err)
+	}
+	rates.Rates[rates.Base] = 1
+	return rates, nil
+}
+
+// brandReportingCurrency is the brand's chosen currency, or the base currency
+// of the exchange rates when it chose none
+func brandReportingCurrency(db *sql.DB, brandID string, rates *money.Rates) (string, error) {
+	var currency sql.NullString
+	err := db.QueryRow(`SELECT reporting_currency FROM brands WHERE CAST(id AS TEXT) = ?`, brandID).Scan(&currency)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to get reporting currency: %w", err)
+	}
+	if currency.String == "" {
+		return rates.Base, nil
+	}
+	return currency.String, nil
+}
+
+// reportingConverter totals money recorded in several currencies in a
+// brand's reporting currency. Amounts in currencies without an exchange rate
+// are left out of the totals and listed by missingRates.
+type reportingConverter struct {
+	currency string
+	rates    *money.Rates
+	missing  map[string]bool
+}
+
+// newReportingConverter converts to the brand's reporting currency
+func newReportingConverter(db *sql.DB, brandID string) (*reportingConverter, error) {
+	rates, err := loadExchangeRates(db)
+	if err != nil {
+		return nil, err
+	}
+	currency, err := brandReportingCurrency(db, brandID, rates)
+	if err != nil {
+		return nil, err
+	}
+	// A currency whose rate was dropped from the rates file cannot be reported in
+	if _, ok := rates.Rates[currency]; !ok {
+		currency = rates.Base
+	}
+	return &reportingConverter{currency: currency, rates: rates, missing: map[string]bool{}}, nil
+}
+
+// newEventReportingConverter converts to the reporting currency of the event's brand
+func newEventReportingConverter(db *sql.DB, eventID string) (*reportingConverter, error) {
+	var brandID string
+	err := db.QueryRow(`SELECT CAST(brand_id AS TEXT) FROM events WHERE CAST(id AS TEXT) = ?`, eventID).Scan(&brandID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get event brand: %w", err)
+	}
+	return newReportingConverter(db, brandID)
+}
+
+// convert returns minor units of the reporting currency
+func (rc *reportingConverter) convert(minor int64, currency string) int64 {
+	converted, err := rc.rates.Convert(minor, currency, rc.currency)
+	if err != nil {
+		rc.missing[currency] = true
+		return 0
+	}
+	return converted
+}
+
+// major formats minor units of the reporting currency for a response
+func (rc *reportingConverter) major(minor int64) float64 {
+	return money.ToMajor(minor, rc.currency)
+}
+
+// revenue is gross revenue and refunds in minor units of a reporting currency
+type revenue struct {
+	gross   int64
+	refunds int64
+}
+
+// add converts gross revenue and refunds in another currency and adds them
+func (r *revenue) add(rc *reportingConverter, currency string, gross, refunds int64) {
+	r.gross += rc.convert(gross, currency)
+	r.refunds += rc.convert(refunds, currency)
+}
+
+func (r revenue) net() int64 {
+	return r.gross - r.refunds
+}
+
+// missingRates lists the currencies that were left out of the totals
+func (rc *reportingConverter) missingRates() []string {
+	missing := []string{}
+	for currency := range rc.missing {
+		missing = append(missing, currency)
+	}
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"lynkr/pkg/money"
+)
+
+func mustLoadRates(t *testing.T, cs *CurrencyService, base string, rates map[string]float64) {
+	t.Helper()
+	table, err := money.NewRates(base, rates)
+	if err != nil {
+		t.Fatalf("NewRates: %v", err)
+	}
+	if err := cs.LoadExchangeRates(table); err != nil {
+		t.Fatalf("LoadExchangeRates: %v", err)
+	}
+}
+
+func TestMultiCurrencyMigration(t *testing.T) {
+	db := newTestDBBefore(t, "030_multi_currency.sql")
+	mustExec(t, db, `
+		INSERT INTO purchases (id, user_id, product_id, amount, refunded_amount, currency, status) VALUES
+			('p_usd', '1', '1', 19.99, 5.01, 'USD', 'partially_refunded'),
+			('p_none', '1', '1', 0.29, 0, NULL, 'completed'),
+			('p_jpy', '1', '1', 1500, 0, 'jpy', 'completed'),
+			('p_kwd', '1', '1', 12.345, 12.345, 'KWD', 'refunded')
+	`)
+	mustExec(t, db, `
+		INSERT INTO purchase_refunds (purchase_id, external_refund_id, amount, source, refunded_at) VALUES
+			('p_usd', 'r_1', 5.01, 'webhook', CURRENT_TIMESTAMP),
+			('p_kwd', 'r_2', 12.345, 'webhook', CURRENT_TIMESTAMP)
+	`)
+	mustExec(t, db, `INSERT INTO code_redemptions (id, code_id, user_id, order_id, amount, discount_applied) VALUES ('cr_1', 'c_1', '1', 'o_1', 49.95, 4.995)`)
+
+	applyMigration(t, db, "030_multi_currency.sql")
+
+	purchases := []struct {
+		id           string
+		wantAmount   int64
+		wantRefunded int64
+		wantCurrency string
+	}{
+		{id: "p_usd", wantAmount: 1999, wantRefunded: 501, wantCurrency: "USD"},
+		{id: "p_none", wantAmount: 29, wantRefunded: 0, wantCurrency: "USD"},
+		{id: "p_jpy", wantAmount: 1500, wantRefunded: 0, wantCurrency: "JPY"},
+		{id: "p_kwd", wantAmount: 12345, wantRefunded: 12345, wantCurrency: "KWD"},
+	}
+	for _, tt := range purchases {
+		var amount, refunded int64
+		var currency string
+		err := db.QueryRow(`SELECT amount_minor, refunded_minor, currency FROM purchases WHERE id = ?`, tt.id).Scan(&amount, &refunded, &currency)
+		if err != nil {
+			t.Fatalf("purchase %s: %v", tt.id, err)
+		}
+		if amount != tt.wantAmount || refunded != tt.wantRefunded || currency != tt.wantCurrency {
+			t.Errorf("purchase %s = %d, refunded %d %s; want %d, refunded %d %s",
+				tt.id, amount, refunded, currency, tt.wantAmount, tt.wantRefunded, tt.wantCurrency)
+		}
+	}
+
+	refunds := map[string]int64{}
+	rows, err := db.Query(`SELECT purchase_id, amount_minor FROM purchase_refunds`)
+	if err != nil {
+		t.Fatalf("failed to list refunds: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var purchaseID string
+		var amount int64
+		if err := rows.Scan(&purchaseID, &amount); err != nil {
+			t.Fatalf("failed to scan refund: %v", err)
+		}
+		refunds[purchaseID] = amount
+	}
+	if want := map[string]int64{"p_usd": 501, "p_kwd": 12345}; !reflect.DeepEqual(refunds, want) {
+		t.Errorf("refunds = %v, want %v in the currency of their purchase", refunds, want)
+	}
+
+	var amount, discount int64
+	var currency string
+	if err := db.QueryRow(`SELECT amount_minor, discount_minor, currency FROM code_redemptions WHERE id = 'cr_1'`).Scan(&amount, &discount, &currency); err != nil {
+		t.Fatalf("redemption: %v", err)
+	}
+	if amount != 4995 || discount != 500 || currency != "USD" {
+		t.Errorf("redemption = %d, discount %d %s; want 4995, discount 500 USD", amount, discount, currency)
+	}
+}
+
+func TestReportingConverter(t *testing.T) {
+	db := newTestDB(t)
+	cs := NewCurrencyService(db)
+	mustExec(t, db, `INSERT INTO brands (id, name, contact_info) VALUES (1, 'Acme', 'a@acme.test')`)
+	mustLoadRates(t, cs, "USD", map[string]float64{"EUR": 0.5, "JPY": 100})
+	if _, err := cs.SetReportingCurrency("1", "eur"); err != nil {
+		t.Fatalf("SetReportingCurrency: %v", err)
+	}
+
+	converter, err := newReportingConverter(db, "1")
+	if err != nil {
+		t.Fatalf("newReportingConverter: %v", err)
+	}
+	var total revenue
+	total.add(converter, "USD", 1000, 200) // 5.00 and 1.00 EUR
+	total.add(converter, "JPY", 1000, 0)   // 5.00 EUR
+	total.add(converter, "GBP", 1000, 0)   // no rate
+	total.add(converter, "CHF", 500, 500)  // no rate
+
+	if total.gross != 1000 || total.refunds != 100 || total.net() != 900 {
+		t.Errorf("revenue = %d gross, %d refunds, %d net; want 1000, 100 and 900 cents of EUR", total.gross, total.refunds, total.net())
+	}
+	if got := converter.missingRates(); !reflect.DeepEqual(got, []string{"CHF", "GBP"}) {
+		t.Errorf("missingRates = %v, want [CHF GBP]", got)
+	}
+	if got := converter.major(900); got != 9 {
+		t.Errorf("major(900) = %v, want 9", got)
+	}
+
+	// A reporting currency dropped from the rates falls back to the base
+	mustLoadRates(t, cs, "USD", map[string]float64{"JPY": 100})
+	converter, err = newReportingConverter(db, "1")
+	if err != nil {
+		t.Fatalf("newReportingConverter: %v", err)
+	}
+	if got := converter.convert(1000, "JPY"); got != 1000 || converter.currency != "USD" {
+		t.Errorf("convert = %d %s, want 1000 USD", got, converter.currency)
+	}
+	if got := converter.missingRates(); len(got) != 0 {
+		t.Errorf("missingRates = %v, want none", got)
+	}
+}
+
+func TestSetReportingCurrency(t *testing.T) {
+	db := newTestDB(t)
+	cs := NewCurrencyService(db)
+	mustExec(t, db, `INSERT INTO brands (id, name, contact_info) VALUES (1, 'Acme', 'a@acme.test')`)
+	mustLoadRates(t, cs, "USD", map[string]float64{"EUR": 0.92})
+
+	if currency, err := cs.GetReportingCurrency("1"); err != nil || currency != "USD" {
+		t.Errorf("GetReportingCurrency = %q, %v; want the base currency", currency, err)
+	}
+
+	tests := []struct {
+		name     string
+		brandID  string
+		currency string
+		wantErr  error
+	}{
+		{name: "currency with a rate", brandID: "1", currency: " eur ", wantErr: nil},
+		{name: "currency without a rate", brandID: "1", currency: "GBP", wantErr: ErrInvalidCurrency},
+		{name: "invalid code", brandID: "1", currency: "euro", wantErr: ErrInvalidCurrency},
+		{name: "unknown brand", brandID: "2", currency: "EUR", wantErr: ErrBrandNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := cs.SetReportingCurrency(tt.brandID, tt.currency); !errors.Is(err, tt.wantErr) {
+				t.Errorf("SetReportingCurrency err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if currency, err := cs.GetReportingCurrency("1"); err != nil || currency != "EUR" {
+		t.Errorf("GetReportingCurrency = %q, %v; want EUR", currency, err)
+	}
+}
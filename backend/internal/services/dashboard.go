@@ -0,0 +1,311 @@
+/**
+ * Brand Dashboard Service
+ * Builds brand-scoped dashboard statistics with period-over-period comparison
+ */
+
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	DashboardGroupByDay   = "day"
+	DashboardGroupByWeek  = "week"
+	DashboardGroupByMonth = "month"
+)
+
+// dashboardBuckets maps a grouping to the SQLite strftime format used to bucket rows
+var dashboardBuckets = map[string]string{
+	DashboardGroupByDay:   "%Y-%m-%d",
+	DashboardGroupByWeek:  "%Y-W%W",
+	DashboardGroupByMonth: "%Y-%m",
+}
+
+// dashboardComparedMetrics are the totals reported against the previous period
+var dashboardComparedMetrics = []string{
+	"totalAttendees", "contentPieces", "contentViews", "engagementRate",
+	"websiteVisitors", "purchases", "revenue", "grossRevenue", "refunds", "conversionRate",
+}
+
+type DashboardFilter struct {
+	From    time.Time
+	To      time.Time
+	GroupBy string
+}
+
+type DashboardService struct {
+	db           *sql.DB
+	brandService *BrandService
+}
+
+func NewDashboardService(db *sql.DB, brandService *BrandService) *DashboardService {
+	return &DashboardService{
+		db:           db,
+		brandService: brandService,
+	}
+}
+
+// NormalizeDashboardFilter fills in the default range (last six months, grouped by month)
+func NormalizeDashboardFilter(filter DashboardFilter) (DashboardFilter, error) {
+	if filter.To.IsZero() {
+		filter.To = time.Now()
+	}
+	if filter.From.IsZero() {
+		filter.From = filter.To.AddDate(0, -6, 0)
+	}
+	if !filter.From.Before(filter.To) {
+		return filter, fmt.Errorf("dashboard range start must be before end")
+	}
+	if filter.GroupBy == "" {
+		filter.GroupBy = DashboardGroupByMonth
+	}
+	if _, ok := dashboardBuckets[filter.GroupBy]; !ok {
+		return filter, fmt.Errorf("unsupported dashboard grouping: %s", filter.GroupBy)
+	}
+	return filter, nil
+}
+
+// GetDashboardStats returns totals for the requested range, the equivalent
+// previous period and a time series of attendance, content and revenue
+func (ds *DashboardService) GetDashboardStats(brandID string, filter DashboardFilter) (map[string]interface{}, error) {
+	filter, err := NormalizeDashboardFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := ds.brandService.GetBrandAnalytics(brandID, filter.From, filter.To)
+	if err != nil {
+		return nil, err
+	}
+
+	periodLength := filter.To.Sub(filter.From)
+	previousFrom := filter.From.Add(-periodLength)
+	previous, err := ds.brandService.GetBrandAnalytics(brandID, previousFrom, filter.From)
+	if err != nil {
+		return nil, err
+	}
+
+	attendanceData, err := ds.getAttendanceSeries(brandID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	contentData, err := ds.getContentSeries(brandID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	revenueData, err := ds.getRevenueSeries(brandID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]interface{})
+	previousTotals := make(map[string]interface{})
+	for _, metric := range dashboardComparedMetrics {
+		previousTotals[metric] = previous[metric]
+		changes[metric] = percentChange(toFloat(previous[metric]), toFloat(current[metric]))
+	}
+
+	stats := current
+	stats["attendanceData"] = attendanceData
+	stats["contentData"] = contentData
+	stats["revenueData"] = revenueData
+	stats["previousPeriod"] = map[string]interface{}{
+		"from":   previousFrom.Format(time.RFC3339),
+		"to":     filter.From.Format(time.RFC3339),
+		"totals": previousTotals,
+	}
+	stats["changes"] = changes
+	stats["period"] = map[string]interface{}{
+		"from":    filter.From.Format(time.RFC3339),
+		"to":      filter.To.Format(time.RFC3339),
+		"groupBy": filter.GroupBy,
+	}
+
+	return stats, nil
+}
+
+func (ds *DashboardService) getAttendanceSeries(brandID string, filter DashboardFilter) ([]map[string]interface{}, error) {
+	query := `
+		SELECT strftime(?, a.check_in_time) AS bucket, COUNT(DISTINCT a.user_id)
+		FROM attendances a
+		JOIN events e ON a.event_id = e.id
+		WHERE e.brand_id = ? AND a.check_in_time >= ? AND a.check_in_time < ?
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+
+	return ds.querySeries(query, "attendees", brandID, filter)
+}
+
+func (ds *DashboardService) getContentSeries(brandID string, filter DashboardFilter) ([]map[string]interface{}, error) {
+	query := `
+		SELECT strftime(?, c.created_at) AS bucket, COUNT(c.id)
+		FROM content c
+		JOIN events e ON c.event_id = e.id
+		WHERE e.brand_id = ? AND c.created_at >= ? AND c.created_at < ?
+		GROUP BY bucket
+		ORDER BY bucket
+	`
+
+	return ds.querySeries(query, "contentPieces", brandID, filter)
+}
+
+// getRevenueSeries reports net revenue with gross revenue and refunds next to
+// it, in the brand's reporting currency
+func (ds *DashboardService) getRevenueSeries(brandID string, filter DashboardFilter) ([]map[string]interface{}, error) {
+	converter, err := newReportingConverter(ds.db, brandID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT strftime(?, p.created_at) AS bucket, p.currency, ` + grossRevenueSQL + `, ` + refundsSQL + `
+		FROM purchases p
+		JOIN events e ON p.event_id = e.id
+		WHERE e.brand_id = ? AND ` + soldPurchaseCondition + ` AND p.created_at >= ? AND p.created_at < ?
+		GROUP BY bucket, p.currency
+		ORDER BY bucket
+	`
+
+	rows, err := ds.db.Query(query, dashboardBuckets[filter.GroupBy], brandID, sqliteTime(filter.From), sqliteTime(filter.To))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dashboard revenue series: %w", err)
+	}
+	defer rows.Close()
+
+	values := make(map[string]*revenue)
+	for rows.Next() {
+		var bucket sql.NullString
+		var currency string
+		var gross, refunds int64
+		if err := rows.Scan(&bucket, &currency, &gross, &refunds); err != nil || !bucket.Valid {
+			continue
+		}
+		if values[bucket.String] == nil {
+			values[bucket.String] = &revenue{}
+		}
+		values[bucket.String].add(converter, currency, gross, refunds)
+	}
+
+	series := []map[string]interface{}{}
+	for _, bucket := range dashboardBucketLabels(filter) {
+		var value revenue
+		if values[bucket] != nil {
+			value = *values[bucket]
+		}
+		series = append(series, map[string]interface{}{
+			"date":         bucket,
+			"revenue":      converter.major(value.net()),
+			"grossRevenue": converter.major(value.gross),
+			"refunds":      converter.major(value.refunds),
+		})
+	}
+
+	return series, nil
+}
+
+// querySeries runs a bucketed query and returns one point per bucket, including empty buckets
+func (ds *DashboardService) querySeries(query, valueKey, brandID string, filter DashboardFilter) ([]map[string]interface{}, error) {
+	format := dashboardBuckets[filter.GroupBy]
+
+	rows, err := ds.db.Query(query, format, brandID, sqliteTime(filter.From), sqliteTime(filter.To))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dashboard %s series: %w", valueKey, err)
+	}
+	defer rows.Close()
+
+	values := make(map[string]float64)
+	for rows.Next() {
+		var bucket sql.NullString
+		var value float64
+		if err := rows.Scan(&bucket, &value); err != nil || !bucket.Valid {
+			continue
+		}
+		values[bucket.String] = value
+	}
+
+	series := []map[string]interface{}{}
+	for _, bucket := range dashboardBucketLabels(filter) {
+		series = append(series, map[string]interface{}{
+			"date":   bucket,
+			valueKey: values[bucket],
+		})
+	}
+
+	return series, nil
+}
+
+// dashboardBucketLabels lists every bucket label in the range so charts have no gaps
+func dashboardBucketLabels(filter DashboardFilter) []string {
+	var labels []string
+	seen := make(map[string]bool)
+
+	cursor := filter.From.UTC()
+	end := filter.To.UTC()
+	for cursor.Before(end) {
+		label := formatDashboardBucket(cursor, filter.GroupBy)
+		if !seen[label] {
+			seen[label] = true
+			labels = append(labels, label)
+		}
+
+		switch filter.GroupBy {
+		case DashboardGroupByMonth:
+			cursor = time.Date(cursor.Year(), cursor.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case DashboardGroupByWeek:
+			next := time.Date(cursor.Year(), cursor.Month(), cursor.Day()+7-int(cursor.Weekday()+6)%7, 0, 0, 0, 0, time.UTC)
+			// %W restarts at week 00 on January 1st, so the new year gets its own bucket
+			if newYear := time.Date(cursor.Year()+1, 1, 1, 0, 0, 0, 0, time.UTC); newYear.Before(next) {
+				next = newYear
+			}
+			cursor = next
+		default:
+			cursor = time.Date(cursor.Year(), cursor.Month(), cursor.Day()+1, 0, 0, 0, 0, time.UTC)
+		}
+	}
+
+	return labels
+}
+
+// formatDashboardBucket mirrors the strftime formats in dashboardBuckets
+func formatDashboardBucket(t time.Time, groupBy string) string {
+	switch groupBy {
+	case DashboardGroupByMonth:
+		return t.Format("2006-01")
+	case DashboardGroupByWeek:
+		// %W: week of year with Monday as the first day of the week (00-53)
+		yearDay := t.YearDay() - 1
+		weekday := (int(t.Weekday()) + 6) % 7
+		return fmt.Sprintf("%d-W%02d", t.Year(), (yearDay+7-weekday)/7)
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+func percentChange(previous, current float64) float64 {
+	if previous == 0 {
+		if current == 0 {
+			return 0
+		}
+		return 100
+	}
+	return (current - previous) / previous * 100
+}
+
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		return 0
+	}
+}
@@ -9,8 +9,11 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"fmt"
+	"math"
 	"strings"
 	"time"
+
+	"lynkr/pkg/money"
 )
 
 type DiscountCode struct {
@@ -25,13 +28,17 @@ type DiscountCode struct {
 	CreatedAt   time.Time `json:"createdAt"`
 }
 
+// CodeRedemption stores the order amount in minor units of its currency;
+// Amount is the same amount in major units for responses
 type CodeRedemption struct {
-	ID        string    `json:"id"`
-	CodeID    string    `json:"codeId"`
-	UserID    string    `json:"userId"`
-	OrderID   string    `json:"orderId"`
-	Amount    float64   `json:"amount"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID          string    `json:"id"`
+	CodeID      string    `json:"codeId"`
+	UserID      string    `json:"userId"`
+	OrderID     string    `json:"orderId"`
+	AmountMinor int64     `json:"amountMinor"`
+	Currency    string    `json:"currency"`
+	Amount      float64   `json:"amount"`
+	CreatedAt   time.Time `json:"createdAt"`
 }
 
 type DiscountService struct {
@@ -91,7 +98,12 @@ func (ds *DiscountService) ValidateCode(code string) (*DiscountCode, error) {
 	return &dc, nil
 }
 
-func (ds *DiscountService) RedeemCode(codeID, userID, orderID string, amount float64) (*CodeRedemption, error) {
+func (ds *DiscountService) RedeemCode(codeID, userID, orderID string, amount float64, currency string) (*CodeRedemption, error) {
+	currency, err := money.Normalize(currency)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCurrency, err)
+	}
+	amountMinor := money.ToMinor(amount, currency)
 	redemptionID := fmt.Sprintf("redemption_%d", time.Now().UnixNano())
 
 	tx, err := ds.db.Begin()
@@ -100,14 +112,20 @@ func (ds *DiscountService) RedeemCode(codeID, userID, orderID string, amount flo
 	}
 	defer tx.Rollback()
 
+	var discountPct float64
+	if err := tx.QueryRow(`SELECT discount_pct FROM discount_codes WHERE id = ?`, codeID).Scan(&discountPct); err != nil {
+		return nil, fmt.Errorf("failed to get discount code: %w", err)
+	}
+	discountMinor := int64(math.Round(float64(amountMinor) * discountPct / 100))
+
 	// Insert redemption
 	query1 := `
-		INSERT INTO code_redemptions (id, code_id, user_id, order_id, amount, created_at)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO code_redemptions (id, code_id, user_id, order_id, amount_minor, discount_minor, currency, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	now := time.Now()
-	_, err = tx.Exec(query1, redemptionID, codeID, userID, orderID, amount, now)
+	_, err = tx.Exec(query1, redemptionID, codeID, userID, orderID, amountMinor, discountMinor, currency, now)
 	if err != nil {
 		return nil, fmt.Errorf("failed to record redemption: %w", err)
 	}
@@ -124,39 +142,56 @@ func (ds *DiscountService) RedeemCode(codeID, userID, orderID string, amount flo
 	}
 
 	return &CodeRedemption{
-		ID:        redemptionID,
-		CodeID:    codeID,
-		UserID:    userID,
-		OrderID:   orderID,
-		Amount:    amount,
-		CreatedAt: now,
+		ID:          redemptionID,
+		CodeID:      codeID,
+		UserID:      userID,
+		OrderID:     orderID,
+		AmountMinor: amountMinor,
+		Currency:    currency,
+		Amount:      money.ToMajor(amountMinor, currency),
+		CreatedAt:   now,
 	}, nil
 }
 
+// GetCodeAnalytics reports redemptions and redeemed order revenue per code.
+// Revenue is in the reporting currency of the event's brand.
 func (ds *DiscountService) GetCodeAnalytics(eventID string) (map[string]interface{}, error) {
+	converter, err := newEventReportingConverter(ds.db, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	revenueQuery := `
+		SELECT cr.code_id, cr.currency, COALESCE(SUM(cr.amount_minor), 0), COALESCE(SUM(cr.discount_minor), 0)
+		FROM code_redemptions cr
+		JOIN discount_codes dc ON dc.id = cr.code_id
+		WHERE dc.event_id = ?
+		GROUP BY cr.code_id, cr.currency
+	`
+	revenueRows, err := ds.db.Query(revenueQuery, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get code revenue: %w", err)
+	}
+	defer revenueRows.Close()
+
+	revenues := make(map[string]int64)
+	discounts := make(map[string]int64)
+	for revenueRows.Next() {
+		var codeID, currency string
+		var amount, discount int64
+		if err := revenueRows.Scan(&codeID, &currency, &amount, &discount); err != nil {
+			return nil, fmt.Errorf("failed to get code revenue: %w", err)
+		}
+		revenues[codeID] += converter.convert(amount, currency)
+		discounts[codeID] += converter.convert(discount, currency)
+	}
+	revenueRows.Close()
+
 	query := `
--- 		SELECT 
--- 			dc.code,
--- 			dc.discount_pct,
--- 			dc.used_count,
--- 			dc.max_uses,
--- 			COALESCE(SUM(cr.amount), 0) as total_revenue
--- 		FROM discount_codes dc
--- 		LEFT JOIN code_redemptions cr ON dc.id = cr.code_id
--- 		WHERE dc.event_id = ?
--- 		GROUP BY dc.id
--- 		ORDER BY dc.used_count DESC
-SELECT 
-    dc.code,
-    dc.discount_pct,
-    dc.used_count,
-    dc.max_uses,
-    COALESCE(COUNT(dcu.id), 0) as actual_usage
-FROM discount_codes dc
-LEFT JOIN discount_code_usage dcu ON dc.id = dcu.discount_code_id
-WHERE dc.event_id = ?
-GROUP BY dc.id
-ORDER BY dc.used_count DESC
+		SELECT dc.id, dc.code, dc.discount_pct, dc.used_count, dc.max_uses
+		FROM discount_codes dc
+		WHERE dc.event_id = ?
+		ORDER BY dc.used_count DESC
 	`
 
 	rows, err := ds.db.Query(query, eventID)
@@ -167,15 +202,14 @@ ORDER BY dc.used_count DESC
 
 	var codes []map[string]interface{}
 	totalRedemptions := 0
-	totalRevenue := 0.0
+	var totalRevenue, totalDiscounts int64
 
 	for rows.Next() {
-		var code string
+		var codeID, code string
 		var discountPct float64
 		var usedCount, maxUses int
-		var revenue float64
 
-		err := rows.Scan(&code, &discountPct, &usedCount, &maxUses, &revenue)
+		err := rows.Scan(&codeID, &code, &discountPct, &usedCount, &maxUses)
 		if err != nil {
 			continue
 		}
@@ -185,17 +219,22 @@ ORDER BY dc.used_count DESC
 			"discountPct": discountPct,
 			"usedCount":   usedCount,
 			"maxUses":     maxUses,
-			"revenue":     revenue,
+			"revenue":     converter.major(revenues[codeID]),
+			"discounts":   converter.major(discounts[codeID]),
 		})
 
 		totalRedemptions += usedCount
-		totalRevenue += revenue
+		totalRevenue += revenues[codeID]
+		totalDiscounts += discounts[codeID]
 	}
 
 	return map[string]interface{}{
 		"codes":            codes,
+		"currency":         converter.currency,
 		"totalRedemptions": totalRedemptions,
-		"totalRevenue":     totalRevenue,
+		"totalRevenue":     converter.major(totalRevenue),
+		"totalDiscounts":   converter.major(totalDiscounts),
+		"missingRates":     converter.missingRates(),
 	}, nil
 }
 
@@ -7,12 +7,32 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"sort"
+	"strings"
 	"time"
+
+	"lynkr/internal/ecommerce"
+	"lynkr/internal/jobs"
+	"lynkr/pkg/money"
+	"lynkr/pkg/secrets"
 )
 
+var ErrIntegrationNotFound = errors.New("integration not found")
+
 type EcommerceService struct {
-	db *sql.DB
+	db      *sql.DB
+	queue   *jobs.Queue
+	keyring *secrets.Keyring
+	options EcommerceOptions
+}
+
+// EcommerceOptions control how stores reach Lynkr
+type EcommerceOptions struct {
+	// PublicBaseURL is the origin stores deliver webhooks to
+	PublicBaseURL string
 }
 
 type Integration struct {
@@ -20,120 +40,240 @@ type Integration struct {
 	BrandID      string `json:"brandId"`
 	PlatformType string `json:"platformType"`
 	APIKey       string `json:"apiKey"`
+	APISecret    string `json:"apiSecret,omitempty"`
 	StoreURL     string `json:"storeUrl"`
 	WebhookURL   string `json:"webhookUrl"`
+	SyncInterval int    `json:"syncInterval"` // minutes between catalog syncs
 	Status       string `json:"status"`
 }
 
+// Purchase amounts are kept in minor units of the purchase's currency.
+// Amount and RefundedAmount repeat them in major units for display.
 type Purchase struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"userId"`
-	ProductID string    `json:"productId"`
-	EventID   string    `json:"eventId"`
-	Amount    float64   `json:"amount"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID             string    `json:"id"`
+	UserID         string    `json:"userId"`
+	ProductID      string    `json:"productId"`
+	EventID        string    `json:"eventId"`
+	AmountMinor    int64     `json:"amountMinor"`
+	RefundedMinor  int64     `json:"refundedMinor"`
+	Currency       string    `json:"currency"`
+	Amount         float64   `json:"amount"`
+	RefundedAmount float64   `json:"refundedAmount"`
+	Status         string    `json:"status"`
+	CreatedAt      time.Time `json:"createdAt"`
 }
 
-func NewEcommerceService(db *sql.DB) *EcommerceService {
-	return &EcommerceService{db: db}
+func (p *Purchase) setMajorAmounts() {
+	p.Amount = money.ToMajor(p.AmountMinor, p.Currency)
+	p.RefundedAmount = money.ToMajor(p.RefundedMinor, p.Currency)
 }
 
-func (es *EcommerceService) CreateIntegration(brandID, platformType, apiKey, storeURL string) (*Integration, error) {
+// defaultCatalogSyncInterval is the catalog sync interval of new integrations, in minutes
+const defaultCatalogSyncInterval = 360
+
+func NewEcommerceService(db *sql.DB, queue *jobs.Queue, keyring *secrets.Keyring, options EcommerceOptions) *EcommerceService {
+	es := &EcommerceService{db: db, queue: queue, keyring: keyring, options: options}
+	queue.Register(CatalogSyncJobType, "ecommerce", es.handleCatalogSyncJob)
+	queue.Register(OrderWebhookJobType, "ecommerce", es.handleOrderWebhookJob)
+	queue.Register(WebhookRegistrationJobType, "ecommerce", es.handleWebhookRegistrationJob)
+	queue.Register(OrderReconcileJobType, "ecommerce", es.handleOrderReconcileJob)
+	return es
+}
+
+// CreateIntegration connects a store. The API secret is optional for
+// platforms that authenticate with a single token, but order webhooks are
+// signed with it. For platforms with a connector the store's catalog is
+// synced right away, the webhook URL is subscribed to order webhooks and
+// recent orders are reconciled once the catalog had time to sync.
+func (es *EcommerceService) CreateIntegration(brandID, platformType, apiKey, apiSecret, storeURL string) (*Integration, error) {
 	integrationID := fmt.Sprintf("integration_%d", time.Now().UnixNano())
-	webhookURL := fmt.Sprintf("https://api.lynkr.com/webhooks/%s", integrationID)
+	webhookURL := strings.TrimRight(es.options.PublicBaseURL, "/") + ecommerceWebhookPath + integrationID
 
 	query := `
-		INSERT INTO ecommerce_integrations (id, brand_id, platform_type, api_key, store_url, webhook_url, status, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO ecommerce_integrations (id, brand_id, platform_type, api_key, api_secret, store_url, webhook_url, sync_interval, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := es.db.Exec(query, integrationID, brandID, platformType, apiKey, storeURL, webhookURL, "active", time.Now())
+	encryptedKey, err := es.keyring.Encrypt(apiKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt integration API key: %w", err)
+	}
+	encryptedSecret, err := es.keyring.Encrypt(apiSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt integration API secret: %w", err)
+	}
+
+	_, err = es.db.Exec(query, integrationID, brandID, platformType, encryptedKey, encryptedSecret, storeURL, webhookURL,
+		defaultCatalogSyncInterval, "active", time.Now())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create integration: %w", err)
 	}
 
+	if ecommerce.Supported(platformType) {
+		if err := es.scheduleCatalogSync(integrationID, time.Now()); err != nil {
+			log.Printf("Failed to queue catalog sync for %s: %v", integrationID, err)
+		}
+		if err := es.scheduleOrderReconcile(integrationID, time.Now().Add(unknownProductRetryDelay)); err != nil {
+			log.Printf("Failed to queue order reconciliation for %s: %v", integrationID, err)
+		}
+		if apiSecret != "" {
+			if err := es.scheduleWebhookRegistration(integrationID); err != nil {
+				log.Printf("Failed to queue webhook registration for %s: %v", integrationID, err)
+			}
+		}
+	}
+
 	return &Integration{
 		ID:           integrationID,
 		BrandID:      brandID,
 		PlatformType: platformType,
-		APIKey:       apiKey,
+		APIKey:       secrets.Mask(apiKey),
+		APISecret:    secrets.Mask(apiSecret),
 		StoreURL:     storeURL,
 		WebhookURL:   webhookURL,
+		SyncInterval: defaultCatalogSyncInterval,
 		Status:       "active",
 	}, nil
 }
 
+// GetIntegration returns the brand's active integration with its credentials masked
 func (es *EcommerceService) GetIntegration(brandID string) (*Integration, error) {
+	integration, err := es.getIntegration(`brand_id = ? AND status = 'active'`, brandID)
+	if err != nil {
+		return nil, err
+	}
+	integration.APIKey = secrets.Mask(integration.APIKey)
+	integration.APISecret = secrets.Mask(integration.APISecret)
+	return integration, nil
+}
+
+// getIntegration loads the integration matching a condition with its
+// credentials decrypted
+func (es *EcommerceService) getIntegration(condition string, args ...interface{}) (*Integration, error) {
 	query := `
-		SELECT id, brand_id, platform_type, api_key, store_url, webhook_url, status
-		FROM ecommerce_integrations WHERE brand_id = ? AND status = 'active'
-	`
+		SELECT id, brand_id, platform_type, api_key, api_secret, store_url, webhook_url, sync_interval, status
+		FROM ecommerce_integrations WHERE ` + condition
 
 	var integration Integration
-	err := es.db.QueryRow(query, brandID).Scan(
+	var apiSecret, webhookURL sql.NullString
+	var syncInterval sql.NullInt64
+	err := es.db.QueryRow(query, args...).Scan(
 		&integration.ID, &integration.BrandID, &integration.PlatformType,
-		&integration.APIKey, &integration.StoreURL, &integration.WebhookURL,
-		&integration.Status,
+		&integration.APIKey, &apiSecret, &integration.StoreURL, &webhookURL,
+		&syncInterval, &integration.Status,
 	)
-
+	if err == sql.ErrNoRows {
+		return nil, ErrIntegrationNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get integration: %w", err)
 	}
 
+	if integration.APIKey, err = es.keyring.Decrypt(integration.APIKey); err != nil {
+		return nil, fmt.Errorf("failed to decrypt integration API key: %w", err)
+	}
+	if integration.APISecret, err = es.keyring.Decrypt(apiSecret.String); err != nil {
+		return nil, fmt.Errorf("failed to decrypt integration API secret: %w", err)
+	}
+	integration.WebhookURL = webhookURL.String
+	integration.SyncInterval = int(syncInterval.Int64)
+
 	return &integration, nil
 }
 
-func (es *EcommerceService) TrackPurchase(userID, productID, eventID string, amount float64) (*Purchase, error) {
+// connector builds the store connector of an integration
+func (es *EcommerceService) connector(integration *Integration) (ecommerce.Connector, error) {
+	return ecommerce.New(integration.PlatformType, integration.APIKey, integration.APISecret, integration.StoreURL, nil)
+}
+
+// TrackPurchase records a purchase reported by the app. The amount is in
+// major units of the currency, which defaults to USD.
+func (es *EcommerceService) TrackPurchase(userID, productID, eventID string, amount float64, currency string) (*Purchase, error) {
+	currency, err := money.Normalize(currency)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCurrency, err)
+	}
 	purchaseID := fmt.Sprintf("purchase_%d", time.Now().UnixNano())
+	amountMinor := money.ToMinor(amount, currency)
 
 	query := `
-		INSERT INTO purchases (id, user_id, product_id, event_id, amount, status, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO purchases (id, user_id, product_id, event_id, amount_minor, currency, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := es.db.Exec(query, purchaseID, userID, productID, eventID, amount, "completed", time.Now())
+	_, err = es.db.Exec(query, purchaseID, userID, productID, eventID, amountMinor, currency, "completed", time.Now())
 	if err != nil {
 		return nil, fmt.Errorf("failed to track purchase: %w", err)
 	}
 
-	return &Purchase{
-		ID:        purchaseID,
-		UserID:    userID,
-		ProductID: productID,
-		EventID:   eventID,
-		Amount:    amount,
-		Status:    "completed",
-		CreatedAt: time.Now(),
-	}, nil
+	purchase := &Purchase{
+		ID:          purchaseID,
+		UserID:      userID,
+		ProductID:   productID,
+		EventID:     eventID,
+		AmountMinor: amountMinor,
+		Currency:    currency,
+		Status:      "completed",
+		CreatedAt:   time.Now(),
+	}
+	purchase.setMajorAmounts()
+	return purchase, nil
 }
 
+// GetPurchaseAnalytics summarizes the event's sales in the reporting currency
+// of its brand. Total revenue is net of refunds; gross revenue and refunds are
+// reported next to it.
 func (es *EcommerceService) GetPurchaseAnalytics(eventID string) (map[string]interface{}, error) {
+	converter, err := newEventReportingConverter(es.db, eventID)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
--- 		SELECT 
--- 			COUNT(*) as total_purchases,
--- 			SUM(amount) as total_revenue,
--- 			AVG(amount) as avg_order_value,
--- 			COUNT(DISTINCT user_id) as unique_buyers
--- 		FROM purchases 
--- 		WHERE event_id = ? AND status = 'completed'
-SELECT 
+		SELECT
 			COUNT(*) as total_purchases,
-			COALESCE(SUM(amount), 0) as total_revenue,
-			COALESCE(AVG(amount), 0) as avg_order_value,
-			COUNT(DISTINCT user_id) as unique_buyers
-		FROM purchases 
-		WHERE event_id = ? AND status = 'completed'
-	`
+			COUNT(DISTINCT p.user_id) as unique_buyers,
+			COUNT(CASE WHEN p.status IN ('partially_refunded', 'refunded') THEN 1 END) as refunded_purchases
+		FROM purchases p
+		WHERE p.event_id = ? AND ` + soldPurchaseCondition
 
-	var totalPurchases, uniqueBuyers int
-	var totalRevenue, avgOrderValue float64
-
-	err := es.db.QueryRow(query, eventID).Scan(&totalPurchases, &totalRevenue, &avgOrderValue, &uniqueBuyers)
+	var totalPurchases, uniqueBuyers, refundedPurchases, cancelledPurchases int
+	err = es.db.QueryRow(query, eventID).Scan(&totalPurchases, &uniqueBuyers, &refundedPurchases)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get purchase analytics: %w", err)
+	}
+	err = es.db.QueryRow(`SELECT COUNT(*) FROM purchases WHERE event_id = ? AND status = 'cancelled'`, eventID).Scan(&cancelledPurchases)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get purchase analytics: %w", err)
 	}
 
+	revenueQuery := `
+		SELECT p.currency, ` + grossRevenueSQL + `, ` + refundsSQL + `
+		FROM purchases p
+		WHERE p.event_id = ? AND ` + soldPurchaseCondition + `
+		GROUP BY p.currency
+	`
+	rows, err := es.db.Query(revenueQuery, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get purchase revenue: %w", err)
+	}
+	defer rows.Close()
+
+	var total revenue
+	for rows.Next() {
+		var currency string
+		var gross, refunds int64
+		if err := rows.Scan(&currency, &gross, &refunds); err != nil {
+			return nil, fmt.Errorf("failed to get purchase revenue: %w", err)
+		}
+		total.add(converter, currency, gross, refunds)
+	}
+
+	avgOrderValue := 0.0
+	if totalPurchases > 0 {
+		avgOrderValue = converter.major(total.gross) / float64(totalPurchases)
+	}
+
 	conversionRate := 0.0
 	if totalPurchases > 0 {
 		// Get total attendees for conversion rate
@@ -147,54 +287,91 @@ SELECT
 	}
 
 	return map[string]interface{}{
-		"totalPurchases": totalPurchases,
-		"totalRevenue":   totalRevenue,
-		"avgOrderValue":  avgOrderValue,
-		"uniqueBuyers":   uniqueBuyers,
-		"conversionRate": conversionRate,
+		"currency":           converter.currency,
+		"totalPurchases":     totalPurchases,
+		"totalRevenue":       converter.major(total.net()),
+		"grossRevenue":       converter.major(total.gross),
+		"refunds":            converter.major(total.refunds),
+		"netRevenue":         converter.major(total.net()),
+		"refundedPurchases":  refundedPurchases,
+		"cancelledPurchases": cancelledPurchases,
+		"avgOrderValue":      avgOrderValue,
+		"uniqueBuyers":       uniqueBuyers,
+		"conversionRate":     conversionRate,
+		"missingRates":       converter.missingRates(),
 	}, nil
 }
 
+// GetTopProducts returns the event's best selling products with their names
+// from the synced catalog. Revenue is in the reporting currency of the
+// event's brand and total revenue is net of refunds.
 func (es *EcommerceService) GetTopProducts(eventID string, limit int) ([]map[string]interface{}, error) {
+	converter, err := newEventReportingConverter(es.db, eventID)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
--- 		SELECT 
--- 			product_id,
--- 			COUNT(*) as purchase_count,
--- 			SUM(amount) as total_revenue
--- 		FROM purchase_products 
--- 		WHERE event_id = ? AND status = 'completed'
--- 		GROUP BY product_id
--- 		ORDER BY purchase_count DESC
--- 		LIMIT ?
-        SELECT pp.product_name, SUM(pp.quantity) as total_sold
-        FROM purchase_products pp
-        JOIN purchases p ON pp.purchase_id = p.id  
-        WHERE p.event_id = ? AND p.status = 'completed'
-        GROUP BY pp.product_id
-        ORDER BY total_sold DESC
+		SELECT p.product_id, COALESCE(pr.name, ''), p.currency, COUNT(*), ` + grossRevenueSQL + `, ` + refundsSQL + `
+		FROM purchases p
+		LEFT JOIN products pr ON pr.id = p.product_id
+		WHERE p.event_id = ? AND ` + soldPurchaseCondition + `
+		GROUP BY p.product_id, p.currency
 	`
 
-	rows, err := es.db.Query(query, eventID, limit)
+	rows, err := es.db.Query(query, eventID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get top products: %w", err)
 	}
 	defer rows.Close()
 
-	var products []map[string]interface{}
+	type productSales struct {
+		id, name string
+		count    int
+		revenue  revenue
+	}
+	byProduct := make(map[string]*productSales)
+	var ranked []*productSales
 	for rows.Next() {
-		var productID string
+		var productID, productName, currency string
 		var purchaseCount int
-		var totalRevenue float64
+		var gross, refunds int64
 
-		err := rows.Scan(&productID, &purchaseCount, &totalRevenue)
+		err := rows.Scan(&productID, &productName, &currency, &purchaseCount, &gross, &refunds)
 		if err != nil {
 			continue
 		}
 
+		sales, ok := byProduct[productID]
+		if !ok {
+			sales = &productSales{id: productID, name: productName}
+			byProduct[productID] = sales
+			ranked = append(ranked, sales)
+		}
+		sales.count += purchaseCount
+		sales.revenue.add(converter, currency, gross, refunds)
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].count != ranked[j].count {
+			return ranked[i].count > ranked[j].count
+		}
+		return ranked[i].revenue.net() > ranked[j].revenue.net()
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	products := []map[string]interface{}{}
+	for _, sales := range ranked {
 		products = append(products, map[string]interface{}{
-			"productId":     productID,
-			"purchaseCount": purchaseCount,
-			"totalRevenue":  totalRevenue,
+			"productId":     sales.id,
+			"productName":   sales.name,
+			"purchaseCount": sales.count,
+			"currency":      converter.currency,
+			"grossRevenue":  converter.major(sales.revenue.gross),
+			"refunds":       converter.major(sales.revenue.refunds),
+			"totalRevenue":  converter.major(sales.revenue.net()),
 		})
 	}
 
@@ -0,0 +1,552 @@
+/**
+ * E-commerce Webhooks
+ * Receives order webhooks from connected stores and records them as attributed purchases
+ */
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"lynkr/internal/ecommerce"
+	"lynkr/internal/jobs"
+	"lynkr/pkg/money"
+)
+
+var (
+	ErrInvalidEcommerceWebhook      = errors.New("invalid e-commerce webhook")
+	ErrEcommerceWebhookUnauthorized = errors.New("e-commerce webhook signature could not be verified")
+
+	// errUnknownOrderProducts is returned while an order references products
+	// the catalog has not synced yet
+	errUnknownOrderProducts = errors.New("order references products missing from the catalog")
+)
+
+const (
+	// OrderWebhookJobType records one stored order webhook as purchases
+	OrderWebhookJobType = "ecommerce.order_webhook"
+	// WebhookRegistrationJobType subscribes an integration to its store's order webhooks
+	WebhookRegistrationJobType = "ecommerce.webhook_registration"
+
+	// ecommerceWebhookPath is where stores deliver webhooks, followed by the integration ID
+	ecommerceWebhookPath = "/api/v1/webhooks/"
+	// purchaseAttributionWindow is how long after checking in to a brand's
+	// event a purchase from its store is attributed to the event
+	purchaseAttributionWindow = 30 * 24 * time.Hour
+	// unknownProductRetryDelay leaves time for the catalog sync queued when an
+	// order references products the catalog does not have yet
+	unknownProductRetryDelay = 2 * time.Minute
+)
+
+// EcommerceWebhookRequest is an inbound store webhook as received by the API
+type EcommerceWebhookRequest struct {
+	Header http.Header
+	Body   []byte
+}
+
+// EcommerceWebhookReceipt acknowledges a stored webhook. Duplicate is set
+// when the delivery was received before; it is not processed again.
+type EcommerceWebhookReceipt struct {
+	DeliveryID string `json:"deliveryId"`
+	Topic      string `json:"topic"`
+	Duplicate  bool   `json:"duplicate"`
+}
+
+// OrderRecordResult summarizes the purchases recorded from a store order
+type OrderRecordResult struct {
+	Purchases int    `json:"purchases"`
+	Refunds   int    `json:"refunds"` // refunds applied for the first time
+	UserID    string `json:"userId,omitempty"`
+	EventID   string `json:"eventId,omitempty"`
+	// Unmatched is set when the order's customer is not a Lynkr user; the
+	// order is not recorded
+	Unmatched bool `json:"unmatched"`
+}
+
+// orderAttribution is the event a store order is credited to
+type orderAttribution struct {
+	EventID  string
+	Type     string // direct, discount_code or event, as in purchase_attribution
+	SourceID string
+}
+
+type orderWebhookJobPayload struct {
+	WebhookEventID int64 `json:"webhookEventId"`
+}
+
+type webhookRegistrationJobPayload struct {
+	IntegrationID string `json:"integrationId"`
+}
+
+// HandleWebhook verifies an inbound store webhook, stores its raw payload and
+// queues it for processing. Redelivered webhooks are recognized by their
+// delivery ID and acknowledged without being processed again.
+func (es *EcommerceService) HandleWebhook(integrationID string, request EcommerceWebhookRequest) (*EcommerceWebhookReceipt, error) {
+	integration, err := es.getIntegration(`id = ?`, integrationID)
+	if err != nil {
+		return nil, err
+	}
+	receiver, err := es.webhookReceiver(integration)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := receiver.VerifyWebhook(request.Body, request.Header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEcommerceWebhookUnauthorized, err)
+	}
+	delivery, err := receiver.WebhookDelivery(request.Body, request.Header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEcommerceWebhook, err)
+	}
+
+	receipt := &EcommerceWebhookReceipt{DeliveryID: delivery.ID, Topic: delivery.Topic}
+	stored, err := es.db.Exec(`
+		INSERT OR IGNORE INTO webhook_events (integration_id, delivery_id, event_type, payload, status, created_at)
+		VALUES (?, ?, ?, ?, 'pending', ?)
+	`, integration.ID, delivery.ID, delivery.Topic, string(request.Body), time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to store webhook: %w", err)
+	}
+	if count, err := stored.RowsAffected(); err == nil && count == 0 {
+		receipt.Duplicate = true
+		return receipt, nil
+	}
+
+	webhookEventID, err := stored.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to store webhook: %w", err)
+	}
+	_, err = es.queue.Enqueue(OrderWebhookJobType, orderWebhookJobPayload{WebhookEventID: webhookEventID}, jobs.EnqueueOptions{
+		DedupeKey: fmt.Sprintf("%s:%d", OrderWebhookJobType, webhookEventID),
+	})
+	if err != nil {
+		// Forget the delivery so the store's redelivery is accepted
+		es.db.Exec(`DELETE FROM webhook_events WHERE id = ?`, webhookEventID)
+		return nil, fmt.Errorf("failed to queue webhook: %w", err)
+	}
+
+	return receipt, nil
+}
+
+// webhookReceiver returns the integration's connector when it receives
+// webhooks itself. Platforms without a connector, and connectors that leave
+// webhooks to the SDK, read webhooks in the generic SDK format.
+func (es *EcommerceService) webhookReceiver(integration *Integration) (ecommerce.WebhookReceiver, error) {
+	if ecommerce.Supported(integration.PlatformType) {
+		connector, err := es.connector(integration)
+		if err != nil {
+			return nil, err
+		}
+		if receiver, ok := connector.(ecommerce.WebhookReceiver); ok {
+			return receiver, nil
+		}
+	}
+	return ecommerce.NewSDK(integration.APIKey, integration.APISecret, es.options.PublicBaseURL), nil
+}
+
+// handleOrderWebhookJob records the order of a stored webhook. Webhooks that
+// carry no order are marked processed; webhooks that keep failing are marked
+// failed when the job gives up.
+func (es *EcommerceService) handleOrderWebhookJob(ctx context.Context, job *jobs.Job) error {
+	var payload orderWebhookJobPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	var integrationID, topic, body, status string
+	err := es.db.QueryRow(`
+		SELECT integration_id, event_type, payload, status FROM webhook_events WHERE id = ?
+	`, payload.WebhookEventID).Scan(&integrationID, &topic, &body, &status)
+	if err == sql.ErrNoRows {
+		return jobs.Permanent(fmt.Errorf("webhook %d not found", payload.WebhookEventID))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load webhook: %w", err)
+	}
+	if status == "processed" {
+		return nil
+	}
+
+	err = es.processOrderWebhook(integrationID, topic, []byte(body))
+	if err != nil && job.WillRetry(err) {
+		es.db.Exec(`UPDATE webhook_events SET retry_count = ?, last_error = ? WHERE id = ?`,
+			job.Attempts, err.Error(), payload.WebhookEventID)
+		return err
+	}
+
+	status = "processed"
+	lastError := sql.NullString{}
+	if err != nil {
+		status = "failed"
+		lastError = sql.NullString{String: err.Error(), Valid: true}
+	}
+	_, updateErr := es.db.Exec(`
+		UPDATE webhook_events SET status = ?, retry_count = ?, last_error = ?, processed_at = ? WHERE id = ?
+	`, status, job.Attempts, lastError, time.Now().UTC(), payload.WebhookEventID)
+	if updateErr != nil {
+		log.Printf("Failed to update webhook %d: %v", payload.WebhookEventID, updateErr)
+	}
+	return err
+}
+
+func (es *EcommerceService) processOrderWebhook(integrationID, topic string, body []byte) error {
+	integration, err := es.getIntegration(`id = ?`, integrationID)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	receiver, err := es.webhookReceiver(integration)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	order, err := receiver.ParseOrderWebhook(topic, body)
+	if errors.Is(err, ecommerce.ErrUnsupportedWebhook) {
+		return es.processRefundWebhook(integration, receiver, topic, body)
+	}
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	result, err := es.RecordOrder(integration, order, RefundSourceWebhook)
+	if errors.Is(err, errUnknownOrderProducts) {
+		if syncErr := es.requestCatalogSync(integration.ID); syncErr != nil {
+			log.Printf("Failed to queue catalog sync for %s: %v", integration.ID, syncErr)
+		}
+		return jobs.RetryAfter(err, unknownProductRetryDelay)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Recorded %s order %s from %s: %d purchase(s), %d refund(s), user %q, event %q",
+		topic, order.ID, integration.ID, result.Purchases, result.Refunds, result.UserID, result.EventID)
+	return nil
+}
+
+// processRefundWebhook applies the refund of a webhook to the purchases of
+// its order. Webhooks that carry neither an order nor a refund are ignored.
+func (es *EcommerceService) processRefundWebhook(integration *Integration, receiver ecommerce.WebhookReceiver, topic string, body []byte) error {
+	refund, err := receiver.ParseRefundWebhook(topic, body)
+	if errors.Is(err, ecommerce.ErrUnsupportedWebhook) {
+		return nil
+	}
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	applied, err := es.RecordRefunds(integration, refund.OrderID, []ecommerce.Refund{*refund}, RefundSourceWebhook)
+	if err != nil {
+		return err
+	}
+	log.Printf("Recorded %s refund %s of order %s from %s: %d applied", topic, refund.ID, refund.OrderID, integration.ID, applied)
+	return nil
+}
+
+// RecordOrder stores a store order as one purchase per product, attributed to
+// an event of the integration's brand, and applies the refunds it carries.
+// Recording an order again updates the purchases' amounts and statuses unless
+// the order is older than the version already recorded; the attribution of a
+// purchase never changes. source tells where refunds came from.
+func (es *EcommerceService) RecordOrder(integration *Integration, order *ecommerce.Order, source string) (*OrderRecordResult, error) {
+	result := &OrderRecordResult{}
+
+	userID, err := es.matchOrderUser(order)
+	if err != nil {
+		return nil, err
+	}
+	if userID == "" {
+		result.Unmatched = true
+		return result, nil
+	}
+	result.UserID = userID
+
+	amounts, err := es.orderProductAmounts(integration, order, orderCurrency(order))
+	if err != nil {
+		return nil, err
+	}
+	if len(amounts) == 0 {
+		return result, nil
+	}
+
+	attribution, err := es.attributeOrder(integration.BrandID, userID, order)
+	if err != nil {
+		return nil, err
+	}
+	result.EventID = attribution.EventID
+
+	attributionData, _ := json.Marshal(map[string]interface{}{
+		"source":          "store_order",
+		"integrationId":   integration.ID,
+		"orderNumber":     order.Number,
+		"attributionType": attribution.Type,
+		"sourceId":        attribution.SourceID,
+	})
+
+	tx, err := es.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to record order: %w", err)
+	}
+	defer tx.Rollback()
+
+	orderUpdatedAt := order.UpdatedAt.UTC()
+	if order.UpdatedAt.IsZero() {
+		orderUpdatedAt = time.Now().UTC()
+	}
+	status := purchaseStatus(order)
+	currency := orderCurrency(order)
+	suffix := strings.TrimPrefix(integration.ID, "integration_")
+	for productID, amount := range amounts {
+		purchaseID := "purchase_" + suffix + "_" + order.ID + "_" + strings.TrimPrefix(productID, "prod_"+suffix+"_")
+		_, err := tx.Exec(`
+			INSERT INTO purchases (id, user_id, product_id, event_id, integration_id, external_order_id, amount_minor, currency, status,
+				attribution_data, order_updated_at, cancelled_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				amount_minor = excluded.amount_minor,
+				currency = excluded.currency,
+				status = excluded.status,
+				order_updated_at = excluded.order_updated_at,
+				cancelled_at = excluded.cancelled_at,
+				updated_at = excluded.updated_at
+			WHERE purchases.order_updated_at IS NULL
+			   OR datetime(excluded.order_updated_at) >= datetime(purchases.order_updated_at)
+		`, purchaseID, userID, productID, nullIfEmpty(attribution.EventID), integration.ID, order.ID, amount,
+			currency, status, string(attributionData), orderUpdatedAt, order.CancelledAt,
+			order.CreatedAt.UTC(), time.Now().UTC())
+		if err != nil {
+			return nil, fmt.Errorf("failed to record purchase: %w", err)
+		}
+
+		if attribution.EventID != "" {
+			_, err = tx.Exec(`
+				INSERT INTO purchase_attribution (purchase_id, event_id, user_id, attribution_type, source_id, attribution_value)
+				SELECT ?, ?, ?, ?, ?, 1.0
+				WHERE NOT EXISTS (SELECT 1 FROM purchase_attribution WHERE purchase_id = ?)
+			`, purchaseID, attribution.EventID, userID, attribution.Type, nullIfEmpty(attribution.SourceID), purchaseID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to record purchase attribution: %w", err)
+			}
+		}
+		result.Purchases++
+	}
+
+	if result.Refunds, err = applyRefunds(tx, integration, order.ID, order.Refunds, source); err != nil {
+		return nil, err
+	}
+	if err := settleOrderPurchases(tx, integration.ID, order.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to record order: %w", err)
+	}
+	return result, nil
+}
+
+// matchOrderUser finds the Lynkr user who placed an order: the user recorded
+// on the order by TrackConversion, or else the user with the order's email
+func (es *EcommerceService) matchOrderUser(order *ecommerce.Order) (string, error) {
+	var userID string
+	if candidate := order.Attributes["lynkr_user_id"]; candidate != "" {
+		err := es.db.QueryRow(`SELECT CAST(id AS TEXT) FROM users WHERE CAST(id AS TEXT) = ?`, candidate).Scan(&userID)
+		if err == nil {
+			return userID, nil
+		}
+		if err != sql.ErrNoRows {
+			return "", fmt.Errorf("failed to match order customer: %w", err)
+		}
+	}
+	if order.Email == "" {
+		return "", nil
+	}
+
+	err := es.db.QueryRow(`SELECT CAST(id AS TEXT) FROM users WHERE email = ? COLLATE NOCASE`, order.Email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to match order customer: %w", err)
+	}
+	return userID, nil
+}
+
+// orderProductAmounts sums the order's line items per catalog product, in
+// minor units of the order's currency.
+// Line items without a store product, such as custom items, are left out.
+// Platforms without a catalog sync keep the store's product IDs; for the
+// others errUnknownOrderProducts is returned while a product is missing.
+func (es *EcommerceService) orderProductAmounts(integration *Integration, order *ecommerce.Order, currency string) (map[string]int64, error) {
+	amounts := make(map[string]int64)
+	var missing []string
+	for _, item := range order.LineItems {
+		if item.ProductID == "" || item.ProductID == "0" {
+			continue
+		}
+		quantity := item.Quantity
+		if quantity <= 0 {
+			quantity = 1
+		}
+
+		productID := item.ProductID
+		if ecommerce.Supported(integration.PlatformType) {
+			err := es.db.QueryRow(`SELECT id FROM products WHERE integration_id = ? AND external_id = ?`,
+				integration.ID, item.ProductID).Scan(&productID)
+			if err == sql.ErrNoRows {
+				missing = append(missing, item.ProductID)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to look up order products: %w", err)
+			}
+		}
+		amounts[productID] += money.ToMinor(item.Price*float64(quantity), currency)
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", errUnknownOrderProducts, strings.Join(missing, ", "))
+	}
+	return amounts, nil
+}
+
+// attributeOrder credits an order to one of the brand's events. An event
+// recorded on the order by TrackConversion wins, then an event discount code
+// used on the order, then the user's latest check-in to a brand event within
+// the attribution window. Orders matching none are not attributed.
+func (es *EcommerceService) attributeOrder(brandID, userID string, order *ecommerce.Order) (orderAttribution, error) {
+	candidates := []string{order.Attributes["lynkr_event_id"]}
+	for _, tag := range order.Tags {
+		if strings.HasPrefix(tag, "lynkr-event-") {
+			candidates = append(candidates, strings.TrimPrefix(tag, "lynkr-event-"))
+		}
+	}
+	for _, eventID := range candidates {
+		if eventID == "" {
+			continue
+		}
+		var found string
+		err := es.db.QueryRow(`SELECT CAST(id AS TEXT) FROM events WHERE CAST(id AS TEXT) = ? AND CAST(brand_id AS TEXT) = ?`,
+			eventID, brandID).Scan(&found)
+		if err == nil {
+			return orderAttribution{EventID: found, Type: "direct"}, nil
+		}
+		if err != sql.ErrNoRows {
+			return orderAttribution{}, fmt.Errorf("failed to attribute order: %w", err)
+		}
+	}
+
+	for _, code := range order.DiscountCodes {
+		var attribution orderAttribution
+		err := es.db.QueryRow(`
+			SELECT id, event_id FROM discount_codes WHERE code = ? COLLATE NOCASE AND brand_id = ?
+		`, code, brandID).Scan(&attribution.SourceID, &attribution.EventID)
+		if err == nil {
+			attribution.Type = "discount_code"
+			return attribution, nil
+		}
+		if err != sql.ErrNoRows {
+			return orderAttribution{}, fmt.Errorf("failed to attribute order: %w", err)
+		}
+	}
+
+	placedAt := order.CreatedAt
+	if placedAt.IsZero() {
+		placedAt = time.Now()
+	}
+	var eventID string
+	err := es.db.QueryRow(`
+		SELECT CAST(a.event_id AS TEXT) FROM attendances a
+		JOIN events e ON e.id = a.event_id
+		WHERE CAST(a.user_id AS TEXT) = ? AND CAST(e.brand_id AS TEXT) = ?
+		  AND datetime(a.check_in_time) BETWEEN ? AND ?
+		ORDER BY datetime(a.check_in_time) DESC LIMIT 1
+	`, userID, brandID, sqliteTime(placedAt.Add(-purchaseAttributionWindow)), sqliteTime(placedAt)).Scan(&eventID)
+	if err == sql.ErrNoRows {
+		return orderAttribution{}, nil
+	}
+	if err != nil {
+		return orderAttribution{}, fmt.Errorf("failed to attribute order: %w", err)
+	}
+	return orderAttribution{EventID: eventID, Type: "event"}, nil
+}
+
+// purchaseStatus maps a store order's state to a purchase status. Partial
+// refunds are left to the refund ledger, see settlePurchases.
+func purchaseStatus(order *ecommerce.Order) string {
+	if order.CancelledAt != nil {
+		return "cancelled"
+	}
+	switch strings.ToLower(order.FinancialStatus) {
+	case "refunded":
+		return "refunded"
+	case "voided", "failed", "cancelled", "trash":
+		return "cancelled"
+	case "", "pending", "authorized", "on-hold", "checkout-draft":
+		return "pending"
+	default:
+		return "completed"
+	}
+}
+
+// orderCurrency is the order's ISO 4217 currency. Orders without a usable
+// code are recorded in the default currency.
+func orderCurrency(order *ecommerce.Order) string {
+	currency, err := money.Normalize(order.Currency)
+	if err != nil {
+		return money.DefaultCurrency
+	}
+	return currency
+}
+
+// scheduleWebhookRegistration queues the subscription of an integration's
+// webhook URL to its store's order webhooks
+func (es *EcommerceService) scheduleWebhookRegistration(integrationID string) error {
+	_, err := es.queue.Enqueue(WebhookRegistrationJobType, webhookRegistrationJobPayload{IntegrationID: integrationID}, jobs.EnqueueOptions{
+		DedupeKey: WebhookRegistrationJobType + ":" + integrationID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to schedule webhook registration: %w", err)
+	}
+	return nil
+}
+
+func (es *EcommerceService) handleWebhookRegistrationJob(ctx context.Context, job *jobs.Job) error {
+	var payload webhookRegistrationJobPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	integration, err := es.getIntegration(`id = ?`, payload.IntegrationID)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	connector, err := es.connector(integration)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	registrar, ok := connector.(ecommerce.WebhookRegistrar)
+	if !ok {
+		return nil
+	}
+
+	err = registrar.RegisterWebhooks(ctx, integration.WebhookURL)
+	if wait, limited := ecommerce.RateLimited(err); limited {
+		return jobs.RetryAfter(err, wait)
+	}
+	if errors.Is(err, ecommerce.ErrUnauthorized) || errors.Is(err, ecommerce.ErrInvalidInput) {
+		return jobs.Permanent(err)
+	}
+	return err
+}
+
+// nullIfEmpty stores empty strings as NULL
+func nullIfEmpty(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
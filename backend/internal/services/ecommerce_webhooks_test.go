@@ -0,0 +1,30 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWebhookReceiver(t *testing.T) {
+	es := &EcommerceService{options: EcommerceOptions{PublicBaseURL: "https://api.lynkr.test"}}
+
+	tests := []struct {
+		platform string
+		want     string
+	}{
+		{platform: "shopify", want: "*ecommerce.ShopifyConnector"},
+		{platform: "woocommerce", want: "*ecommerce.WooCommerceConnector"},
+		{platform: "custom", want: "*ecommerce.SDK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			receiver, err := es.webhookReceiver(&Integration{PlatformType: tt.platform, APIKey: "key", APISecret: "secret", StoreURL: "https://shop.example.com"})
+			if err != nil {
+				t.Fatalf("webhookReceiver: %v", err)
+			}
+			if got := fmt.Sprintf("%T", receiver); got != tt.want {
+				t.Errorf("receiver = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
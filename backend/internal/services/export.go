@@ -6,314 +6,854 @@
 package services
 
 import (
+	"archive/zip"
+	"context"
 	"database/sql"
-	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
 	"strings"
 	"time"
+
+	"lynkr/internal/jobs"
+	"lynkr/pkg/export"
+	"lynkr/pkg/storage"
+)
+
+// ExportJobType is the job that generates an export file on the exports queue
+const ExportJobType = "export.generate"
+
+// exportRetention is how long generated files can be downloaded
+const exportRetention = 7 * 24 * time.Hour
+
+var (
+	ErrExportNotFound      = errors.New("export request not found")
+	ErrExportNotReady      = errors.New("export is not ready yet")
+	ErrExportExpired       = errors.New("export has expired")
+	ErrInvalidDownloadLink = errors.New("invalid download link")
+	ErrInvalidExport       = errors.New("invalid export request")
+	ErrExportCancelled     = errors.New("export was cancelled")
 )
 
 type ExportService struct {
-	db *sql.DB
+	db      *sql.DB
+	queue   *jobs.Queue
+	storage storage.Storage
+	signer  *storage.URLSigner
+	options ExportOptions
+	client  *http.Client
+}
+
+// ExportOptions control the signed download links handed out for export files
+// and where scheduled exports are delivered
+type ExportOptions struct {
+	BaseURL     string        // public origin of the API, e.g. https://api.lynkr.com
+	LinkTTL     time.Duration // lifetime of a single link, capped by the export expiry
+	SFTPDropDir string        // directory the SFTP delivery stand-in writes to
+
+	// AllowInsecureWebhooks accepts plain http webhook targets, for development
+	AllowInsecureWebhooks bool
+	// AllowPrivateWebhooks accepts webhook targets on loopback, private and
+	// link-local addresses, for development
+	AllowPrivateWebhooks bool
 }
 
 type ExportRequest struct {
-	ID        string    `json:"id"`
-	BrandID   string    `json:"brandId"`
-	EventID   string    `json:"eventId"`
-	DataType  string    `json:"dataType"`
-	Format    string    `json:"format"`
-	Status    string    `json:"status"`
-	FileURL   string    `json:"fileUrl"`
-	CreatedAt time.Time `json:"createdAt"`
-	ExpiresAt time.Time `json:"expiresAt"`
+	ID          string      `json:"id"`
+	BrandID     string      `json:"brandId"`
+	EventID     string      `json:"eventId,omitempty"`
+	DataType    string      `json:"dataType"`
+	Format      string      `json:"format"`
+	Spec        *ExportSpec `json:"spec,omitempty"`
+	Status      string      `json:"status"`
+	FileURL     string      `json:"fileUrl"`
+	FileSize    int64       `json:"fileSize"`
+	RecordCount int         `json:"recordCount"`
+	Error       string      `json:"error,omitempty"`
+	JobID       string      `json:"jobId,omitempty"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	CompletedAt *time.Time  `json:"completedAt,omitempty"`
+	ExpiresAt   time.Time   `json:"expiresAt"`
+
+	// Set on runs of an export schedule
+	ScheduleID     string     `json:"scheduleId,omitempty"`
+	DeliveryStatus string     `json:"deliveryStatus,omitempty"`
+	DeliveryError  string     `json:"deliveryError,omitempty"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+
+	filePath string
+}
+
+// ExportSpec describes what an export contains. Exports with more than one
+// data type are bundled into a zip archive with a manifest.
+type ExportSpec struct {
+	DataTypes  []string            `json:"dataTypes"`
+	EventIDs   []string            `json:"eventIds,omitempty"`
+	CampaignID int64               `json:"campaignId,omitempty"`
+	From       *time.Time          `json:"from,omitempty"`
+	To         *time.Time          `json:"to,omitempty"` // exclusive
+	Fields     map[string][]string `json:"fields,omitempty"`
+	Format     string              `json:"format"`
+}
+
+// maxExportEvents caps the number of events in a single export
+const maxExportEvents = 500
+
+// exportManifest is written as manifest.json into multi-dataset archives
+type exportManifest struct {
+	RequestID   string               `json:"requestId"`
+	BrandID     string               `json:"brandId"`
+	Format      string               `json:"format"`
+	GeneratedAt time.Time            `json:"generatedAt"`
+	EventIDs    []string             `json:"eventIds"`
+	CampaignID  int64                `json:"campaignId,omitempty"`
+	From        *time.Time           `json:"from,omitempty"`
+	To          *time.Time           `json:"to,omitempty"`
+	Files       []exportManifestFile `json:"files"`
+}
+
+type exportManifestFile struct {
+	Name     string                 `json:"name"`
+	DataType string                 `json:"dataType"`
+	Records  int                    `json:"records"`
+	Columns  []exportManifestColumn `json:"columns"`
+}
+
+type exportManifestColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type exportJobPayload struct {
+	RequestID string `json:"requestId"`
 }
 
-func NewExportService(db *sql.DB) *ExportService {
-	return &ExportService{db: db}
+func NewExportService(db *sql.DB, queue *jobs.Queue, store storage.Storage, signer *storage.URLSigner, options ExportOptions) *ExportService {
+	es := &ExportService{
+		db:      db,
+		queue:   queue,
+		storage: store,
+		signer:  signer,
+		options: options,
+		client:  newWebhookClient(options.AllowPrivateWebhooks),
+	}
+	queue.Register(ExportJobType, "exports", es.handleExportJob)
+	queue.Register(ExportScheduleJobType, "exports", es.handleScheduledExportJob)
+	queue.Register(ExportDeliveryJobType, "exports", es.handleDeliveryJob)
+	queue.OnCancel(ExportJobType, es.cancelExportJob)
+	queue.OnCancel(ExportDeliveryJobType, es.cancelDeliveryJob)
+	return es
 }
 
-func (es *ExportService) CreateExportRequest(brandID, eventID, dataType, format string) (*ExportRequest, error) {
+// CreateExportRequest validates the spec, checks that every event belongs to
+// the brand and queues the export
+func (es *ExportService) CreateExportRequest(brandID string, spec ExportSpec) (*ExportRequest, error) {
+	return es.createExportRequest(brandID, spec, "")
+}
+
+// createExportRequest queues an export, recording the schedule it runs for if any
+func (es *ExportService) createExportRequest(brandID string, spec ExportSpec, scheduleID string) (*ExportRequest, error) {
+	spec, err := es.resolveExportSpec(brandID, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode export options: %w", err)
+	}
+
+	// Single-event, single-dataset exports keep filling the legacy columns
+	dataType := "all"
+	if len(spec.DataTypes) == 1 {
+		dataType = spec.DataTypes[0]
+	}
+	var eventID sql.NullString
+	if len(spec.EventIDs) == 1 {
+		eventID = sql.NullString{String: spec.EventIDs[0], Valid: true}
+	}
+	var schedule sql.NullString
+	if scheduleID != "" {
+		schedule = sql.NullString{String: scheduleID, Valid: true}
+	}
+
 	requestID := fmt.Sprintf("export_%d", time.Now().UnixNano())
 
 	query := `
-		INSERT INTO export_requests (id, export_request_id, brand_id, event_id, data_type, format, status, created_at)
-    VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO export_requests (id, export_request_id, brand_id, event_id, data_type, format, options, schedule_id, status, created_at, expires_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	now := time.Now()
-	expiresAt := now.Add(7 * 24 * time.Hour) // Expires in 7 days
+	now := time.Now().UTC()
+	expiresAt := now.Add(exportRetention)
 
-	_, err := es.db.Exec(query, requestID, requestID, brandID, eventID, dataType, format, "processing", now)
+	_, err = es.db.Exec(query, requestID, requestID, brandID, eventID, dataType, spec.Format, string(options), schedule, "processing", now, expiresAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create export request: %w", err)
 	}
 
-	// Process export asynchronously
-	go es.processExport(requestID, brandID, eventID, dataType, format)
+	// Process export on the job queue
+	job, err := es.queue.Enqueue(ExportJobType, exportJobPayload{RequestID: requestID}, jobs.EnqueueOptions{
+		DedupeKey: ExportJobType + ":" + requestID,
+	})
+	if err != nil {
+		es.failExport(requestID, err)
+		return nil, fmt.Errorf("failed to queue export: %w", err)
+	}
 
 	return &ExportRequest{
-		ID:        requestID,
-		BrandID:   brandID,
-		EventID:   eventID,
-		DataType:  dataType,
-		Format:    format,
-		Status:    "processing",
-		CreatedAt: now,
-		ExpiresAt: expiresAt,
+		ID:         requestID,
+		BrandID:    brandID,
+		EventID:    eventID.String,
+		DataType:   dataType,
+		Format:     spec.Format,
+		Spec:       &spec,
+		Status:     "processing",
+		JobID:      job.ID,
+		CreatedAt:  now,
+		ExpiresAt:  expiresAt,
+		ScheduleID: scheduleID,
 	}, nil
 }
 
-func (es *ExportService) processExport(requestID, brandID, eventID, dataType, format string) {
-	var data []map[string]interface{}
-	var err error
+// resolveExportSpec validates a spec and expands its campaign into event IDs
+func (es *ExportService) resolveExportSpec(brandID string, spec ExportSpec) (ExportSpec, error) {
+	spec, err := validateExportSpec(spec)
+	if err != nil {
+		return spec, err
+	}
 
-	switch dataType {
-	case "attendance":
-		data, err = es.exportAttendanceData(eventID)
-	case "content":
-		data, err = es.exportContentData(eventID)
-	case "analytics":
-		data, err = es.exportAnalyticsData(eventID)
-	case "feedback":
-		data, err = es.exportFeedbackData(eventID)
-	default:
-		err = fmt.Errorf("unsupported data type: %s", dataType)
+	eventIDs := uniqueStrings(spec.EventIDs)
+	if spec.CampaignID != 0 {
+		campaignEvents, err := es.campaignEventIDs(brandID, spec.CampaignID)
+		if err != nil {
+			return spec, err
+		}
+		eventIDs = uniqueStrings(append(eventIDs, campaignEvents...))
+	}
+	switch {
+	case len(eventIDs) == 0:
+		return spec, fmt.Errorf("%w: at least one event or a campaign with events is required", ErrInvalidExport)
+	case len(eventIDs) > maxExportEvents:
+		return spec, fmt.Errorf("%w: at most %d events can be exported at once", ErrInvalidExport, maxExportEvents)
 	}
 
-	if err != nil {
-		es.updateExportStatus(requestID, "failed", "")
-		return
-	}
-	var fileContent string
-	switch format {
-	case "csv":
-		fileContent = es.convertToCSV(data)
-	case "json":
-		fileContent = es.convertToJSON(data)
-	default:
-		es.updateExportStatus(requestID, "failed", "")
-		return
-	}
-	fmt.Print(fileContent)
-	// In production, would upload to cloud storage
-	fileURL := fmt.Sprintf("https://exports.lynkr.com/%s.%s", requestID, format)
-	es.updateExportStatus(requestID, "completed", fileURL)
-}
-
-func (es *ExportService) exportAttendanceData(eventID string) ([]map[string]interface{}, error) {
-	query := `
-		SELECT u.id, u.email, a.checkin_time, a.checkout_time
-		FROM attendances a
-		JOIN users u ON a.user_id = u.id
-		WHERE a.event_id = ?
-	`
+	if err := es.checkEventOwnership(brandID, eventIDs); err != nil {
+		return spec, err
+	}
+	spec.EventIDs = eventIDs
 
-	rows, err := es.db.Query(query, eventID)
+	return spec, nil
+}
+
+// validateExportSpec checks the format, data types, fields and date range of a spec
+func validateExportSpec(spec ExportSpec) (ExportSpec, error) {
+	if _, ok := export.Lookup(spec.Format); !ok {
+		return spec, fmt.Errorf("%w: unsupported format %q", ErrInvalidExport, spec.Format)
+	}
+
+	dataTypes, err := normalizeExportDataTypes(spec.DataTypes)
 	if err != nil {
-		return nil, err
+		return spec, err
 	}
-	defer rows.Close()
+	spec.DataTypes = dataTypes
 
-	var data []map[string]interface{}
-	for rows.Next() {
-		var userID, email string
-		var checkinTime, checkoutTime sql.NullString
+	for dataType, fields := range spec.Fields {
+		dataset, ok := exportDatasets[dataType]
+		if !ok || !containsString(spec.DataTypes, dataType) {
+			return spec, fmt.Errorf("%w: fields given for %q which is not exported", ErrInvalidExport, dataType)
+		}
+		for _, field := range fields {
+			if !dataset.hasColumn(field) {
+				return spec, fmt.Errorf("%w: unknown %s field %q", ErrInvalidExport, dataType, field)
+			}
+		}
+	}
 
-		err := rows.Scan(&userID, &email, &checkinTime, &checkoutTime)
-		if err != nil {
+	if spec.From != nil && spec.To != nil && !spec.From.Before(*spec.To) {
+		return spec, fmt.Errorf("%w: from must be before to", ErrInvalidExport)
+	}
+
+	return spec, nil
+}
+
+// normalizeExportDataTypes validates and de-duplicates data types, expanding
+// "all" and ordering them as they are bundled
+func normalizeExportDataTypes(dataTypes []string) ([]string, error) {
+	requested := make(map[string]bool)
+	for _, dataType := range dataTypes {
+		if dataType == "all" {
+			for _, name := range exportDataTypes {
+				requested[name] = true
+			}
 			continue
 		}
+		if _, ok := exportDatasets[dataType]; !ok {
+			return nil, fmt.Errorf("%w: unsupported data type %q", ErrInvalidExport, dataType)
+		}
+		requested[dataType] = true
+	}
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("%w: at least one data type is required", ErrInvalidExport)
+	}
+
+	var normalized []string
+	for _, name := range exportDataTypes {
+		if requested[name] {
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized, nil
+}
+
+// campaignEventIDs returns the events linked to one of the brand's campaigns
+func (es *ExportService) campaignEventIDs(brandID string, campaignID int64) ([]string, error) {
+	var ownerID string
+	err := es.db.QueryRow(`SELECT brand_id FROM campaigns WHERE id = ?`, campaignID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != brandID) {
+		return nil, ErrCampaignNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up campaign: %w", err)
+	}
+
+	rows, err := es.db.Query(`SELECT event_id FROM campaign_events WHERE campaign_id = ? ORDER BY created_at`, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign events: %w", err)
+	}
+	defer rows.Close()
 
-		record := map[string]interface{}{
-			"user_id":       userID,
-			"email":         email,
-			"checkin_time":  checkinTime.String,
-			"checkout_time": checkoutTime.String,
+	var eventIDs []string
+	for rows.Next() {
+		var eventID string
+		if err := rows.Scan(&eventID); err != nil {
+			return nil, fmt.Errorf("failed to get campaign events: %w", err)
 		}
-		data = append(data, record)
+		eventIDs = append(eventIDs, eventID)
 	}
 
-	return data, nil
+	return eventIDs, rows.Err()
 }
 
-func (es *ExportService) exportContentData(eventID string) ([]map[string]interface{}, error) {
-	query := `
-		SELECT c.id, c.user_id, c.media_type, c.caption, c.view_count, c.share_count, c.created_at
-		FROM content c
-		WHERE c.event_id = ?
-	`
+// checkEventOwnership returns ErrEventNotOwnedByBrand unless every event
+// exists and belongs to the brand
+func (es *ExportService) checkEventOwnership(brandID string, eventIDs []string) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(eventIDs)), ", ")
+	args := make([]interface{}, len(eventIDs))
+	for i, eventID := range eventIDs {
+		args[i] = eventID
+	}
 
-	rows, err := es.db.Query(query, eventID)
+	rows, err := es.db.Query(`SELECT id, brand_id FROM events WHERE id IN (`+placeholders+`)`, args...)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to look up events: %w", err)
 	}
 	defer rows.Close()
 
-	var data []map[string]interface{}
+	owned := make(map[string]bool, len(eventIDs))
 	for rows.Next() {
-		var contentID, userID, mediaType, caption string
-		var viewCount, shareCount int
-		var createdAt string
+		var eventID, ownerID string
+		if err := rows.Scan(&eventID, &ownerID); err != nil {
+			return fmt.Errorf("failed to look up events: %w", err)
+		}
+		owned[eventID] = ownerID == brandID
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to look up events: %w", err)
+	}
 
-		err := rows.Scan(&contentID, &userID, &mediaType, &caption, &viewCount, &shareCount, &createdAt)
+	for _, eventID := range eventIDs {
+		if !owned[eventID] {
+			return fmt.Errorf("%w: %s", ErrEventNotOwnedByBrand, eventID)
+		}
+	}
+	return nil
+}
+
+// handleExportJob generates the export of a queued request. The request is
+// only marked failed once the job has no attempts left.
+func (es *ExportService) handleExportJob(ctx context.Context, job *jobs.Job) error {
+	var payload exportJobPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	req, err := es.getExportRequest(payload.RequestID)
+	if errors.Is(err, ErrExportNotFound) {
+		return jobs.Permanent(fmt.Errorf("export request %s not found", payload.RequestID))
+	}
+	if err != nil {
+		return err
+	}
+	if req.Status != "processing" {
+		return nil
+	}
+
+	err = es.processExport(ctx, req)
+	if err != nil && ctx.Err() == nil && !job.WillRetry(err) {
+		es.failExport(payload.RequestID, err)
+	}
+
+	// Scheduled runs are handed on to their delivery target
+	if err == nil && req.ScheduleID != "" {
+		es.queueDelivery(req)
+	}
+	return err
+}
+
+// processExport streams the export into storage. If ctx is cancelled before
+// the result is recorded the request stays 'processing' and the job runs again.
+func (es *ExportService) processExport(ctx context.Context, req *ExportRequest) error {
+	spec := *req.Spec
+	for _, dataType := range spec.DataTypes {
+		if _, ok := exportDatasets[dataType]; !ok {
+			return jobs.Permanent(fmt.Errorf("unsupported data type: %s", dataType))
+		}
+	}
+	format, ok := export.Lookup(spec.Format)
+	if !ok {
+		return jobs.Permanent(fmt.Errorf("unsupported format: %s", spec.Format))
+	}
+
+	extension := format.Extension
+	write := func(w io.Writer) (int, error) {
+		dataType := spec.DataTypes[0]
+		return es.writeDataset(ctx, exportDatasets[dataType], spec.Fields[dataType], spec, format, w)
+	}
+	if len(spec.DataTypes) > 1 {
+		extension = "zip"
+		write = func(w io.Writer) (int, error) {
+			return es.writeArchive(ctx, req, format, w)
+		}
+	}
+
+	type result struct {
+		records int
+		err     error
+	}
+
+	reader, writer := io.Pipe()
+	file := &countingWriter{w: writer}
+	done := make(chan result, 1)
+	go func() {
+		records, err := write(file)
+		writer.CloseWithError(err)
+		done <- result{records, err}
+	}()
+
+	key := exportFileKey(req.BrandID, req.ID, extension)
+	putErr := es.storage.Put(ctx, key, reader, -1)
+	reader.CloseWithError(putErr) // unblocks the writer if the upload failed
+	written := <-done
+
+	if written.err != nil {
+		return fmt.Errorf("failed to write export: %w", written.err)
+	}
+	if putErr != nil {
+		return fmt.Errorf("failed to store export file: %w", putErr)
+	}
+
+	return es.completeExport(req.ID, key, file.n, written.records)
+}
+
+// writeArchive writes one file per data type and a manifest into a zip archive
+func (es *ExportService) writeArchive(ctx context.Context, req *ExportRequest, format export.Format, w io.Writer) (int, error) {
+	spec := *req.Spec
+	archive := zip.NewWriter(w)
+	manifest := exportManifest{
+		RequestID:   req.ID,
+		BrandID:     req.BrandID,
+		Format:      format.ID,
+		GeneratedAt: time.Now().UTC(),
+		EventIDs:    spec.EventIDs,
+		CampaignID:  spec.CampaignID,
+		From:        spec.From,
+		To:          spec.To,
+	}
+
+	total := 0
+	for _, dataType := range spec.DataTypes {
+		dataset := exportDatasets[dataType]
+		name := dataType + "." + format.Extension
+
+		entry, err := archive.Create(name)
 		if err != nil {
-			continue
+			return total, err
+		}
+		records, err := es.writeDataset(ctx, dataset, spec.Fields[dataType], spec, format, entry)
+		if err != nil {
+			return total, fmt.Errorf("%s: %w", dataType, err)
 		}
+		total += records
 
-		record := map[string]interface{}{
-			"content_id":  contentID,
-			"user_id":     userID,
-			"media_type":  mediaType,
-			"caption":     caption,
-			"view_count":  viewCount,
-			"share_count": shareCount,
-			"created_at":  createdAt,
+		schema, _, _ := dataset.query(spec.Fields[dataType], spec.EventIDs, exportTimeRange{})
+		file := exportManifestFile{Name: name, DataType: dataType, Records: records}
+		for _, column := range schema.Columns {
+			file.Columns = append(file.Columns, exportManifestColumn{Name: column.Name, Type: column.Type.String()})
 		}
-		data = append(data, record)
+		manifest.Files = append(manifest.Files, file)
 	}
 
-	return data, nil
+	entry, err := archive.Create("manifest.json")
+	if err != nil {
+		return total, err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return total, err
+	}
+
+	return total, archive.Close()
 }
 
-func (es *ExportService) exportAnalyticsData(eventID string) ([]map[string]interface{}, error) {
-	query := `
-		SELECT 
-			COUNT(DISTINCT a.user_id) as total_attendees,
-			COUNT(DISTINCT c.id) as total_content,
-			SUM(c.view_count) as total_views,
-			SUM(c.share_count) as total_shares
-		FROM events e
-		LEFT JOIN attendances a ON e.id = a.event_id
-		LEFT JOIN content c ON e.id = c.event_id
-		WHERE e.id = ?
-	`
+// writeDataset queries a dataset and writes it in the given format
+func (es *ExportService) writeDataset(ctx context.Context, dataset exportDataset, fields []string, spec ExportSpec, format export.Format, w io.Writer) (int, error) {
+	timeRange := exportTimeRange{}
+	if spec.From != nil {
+		timeRange.from = sqliteTime(*spec.From)
+	}
+	if spec.To != nil {
+		timeRange.to = sqliteTime(*spec.To)
+	}
 
-	var totalAttendees, totalContent, totalViews, totalShares int
-	err := es.db.QueryRow(query, eventID).Scan(&totalAttendees, &totalContent, &totalViews, &totalShares)
+	schema, query, args := dataset.query(fields, spec.EventIDs, timeRange)
+	out, err := format.NewWriter(w, schema)
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+
+	rows, err := es.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns := schema.Columns
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
 	}
 
-	data := []map[string]interface{}{
-		{
-			"metric":       "total_attendees",
-			"value":        totalAttendees,
-			"event_id":     eventID,
-			"generated_at": time.Now().Format(time.RFC3339),
-		},
-		{
-			"metric":       "total_content",
-			"value":        totalContent,
-			"event_id":     eventID,
-			"generated_at": time.Now().Format(time.RFC3339),
-		},
-		{
-			"metric":       "total_views",
-			"value":        totalViews,
-			"event_id":     eventID,
-			"generated_at": time.Now().Format(time.RFC3339),
-		},
-		{
-			"metric":       "total_shares",
-			"value":        totalShares,
-			"event_id":     eventID,
-			"generated_at": time.Now().Format(time.RFC3339),
-		},
-	}
-
-	return data, nil
-}
-
-func (es *ExportService) exportFeedbackData(eventID string) ([]map[string]interface{}, error) {
+	records := 0
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return records, err
+		}
+
+		row := make(export.Row, len(columns))
+		for i, column := range columns {
+			if row[i], err = export.Convert(column.Type, values[i]); err != nil {
+				return records, fmt.Errorf("invalid %s value: %w", column.Name, err)
+			}
+		}
+		if err := out.WriteRow(row); err != nil {
+			return records, err
+		}
+		records++
+	}
+	if err := rows.Err(); err != nil {
+		return records, err
+	}
+
+	return records, out.Close()
+}
+
+// exportFileKey is the storage key of an export file
+func exportFileKey(brandID, requestID, extension string) string {
+	return fmt.Sprintf("exports/%s/%s.%s", brandID, requestID, extension)
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func (es *ExportService) completeExport(requestID, filePath string, fileSize int64, recordCount int) error {
 	query := `
-		SELECT pv.user_id, pv.poll_id, pv.option_id, pv.created_at
-		FROM poll_votes pv
-		JOIN polls p ON pv.poll_id = p.id
-		WHERE p.event_id = ?
+		UPDATE export_requests
+		SET status = 'completed', file_path = ?, file_size = ?, record_count = ?, error_message = NULL, completed_at = ?
+		WHERE id = ?
 	`
 
-	rows, err := es.db.Query(query, eventID)
+	if _, err := es.db.Exec(query, filePath, fileSize, recordCount, time.Now().UTC(), requestID); err != nil {
+		return fmt.Errorf("failed to complete export request: %w", err)
+	}
+	return nil
+}
+
+func (es *ExportService) failExport(requestID string, cause error) {
+	query := `UPDATE export_requests SET status = 'failed', error_message = ? WHERE id = ? AND status = 'processing'`
+	es.db.Exec(query, cause.Error(), requestID)
+}
+
+// cancelExportJob fails the request of a cancelled export job, which would
+// otherwise stay processing
+func (es *ExportService) cancelExportJob(job *jobs.Job) error {
+	var payload exportJobPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	es.failExport(payload.RequestID, ErrExportCancelled)
+	return nil
+}
+
+// GetExportStatus returns a brand's export request with a signed download link once it is ready
+func (es *ExportService) GetExportStatus(brandID, requestID string) (*ExportRequest, error) {
+	req, err := es.getExportRequest(requestID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	if req.BrandID != brandID {
+		return nil, ErrExportNotFound
+	}
 
-	var data []map[string]interface{}
-	for rows.Next() {
-		var userID, pollID, optionID, createdAt string
+	if req.Status == "completed" && time.Now().Before(req.ExpiresAt) {
+		req.FileURL = es.DownloadURL(req)
+	}
 
-		err := rows.Scan(&userID, &pollID, &optionID, &createdAt)
-		if err != nil {
-			continue
-		}
+	return req, nil
+}
 
-		record := map[string]interface{}{
-			"user_id":    userID,
-			"poll_id":    pollID,
-			"option_id":  optionID,
-			"created_at": createdAt,
-		}
-		data = append(data, record)
+// DownloadURL returns a signed link to the export file. The link expires after
+// the configured TTL or when the export itself expires, whichever is first.
+func (es *ExportService) DownloadURL(req *ExportRequest) string {
+	expiresAt := time.Now().Add(es.options.LinkTTL)
+	if req.ExpiresAt.Before(expiresAt) {
+		expiresAt = req.ExpiresAt
 	}
 
-	return data, nil
+	signature := es.signer.Sign(downloadResource(req.ID), expiresAt)
+	return fmt.Sprintf("%s/brand/v1/export/%s/download?expires=%d&signature=%s",
+		strings.TrimRight(es.options.BaseURL, "/"), url.PathEscape(req.ID), expiresAt.Unix(), signature)
 }
 
-func (es *ExportService) convertToCSV(data []map[string]interface{}) string {
-	if len(data) == 0 {
-		return ""
+// OpenExportDownload checks a signed download link and opens the export file.
+// The caller must close the returned reader.
+func (es *ExportService) OpenExportDownload(ctx context.Context, requestID string, expires int64, signature string) (*ExportRequest, io.ReadCloser, int64, error) {
+	switch err := es.signer.Verify(downloadResource(requestID), expires, signature); {
+	case errors.Is(err, storage.ErrLinkExpired):
+		return nil, nil, 0, ErrExportExpired
+	case err != nil:
+		return nil, nil, 0, ErrInvalidDownloadLink
 	}
 
-	var builder strings.Builder
-	writer := csv.NewWriter(&builder)
+	req, err := es.getExportRequest(requestID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
 
-	// Write header
-	var headers []string
-	for key := range data[0] {
-		headers = append(headers, key)
+	switch {
+	case req.Status == "expired" || !time.Now().Before(req.ExpiresAt):
+		return nil, nil, 0, ErrExportExpired
+	case req.Status != "completed" || req.filePath == "":
+		return nil, nil, 0, ErrExportNotReady
 	}
-	writer.Write(headers)
 
-	// Write data
-	for _, record := range data {
-		var row []string
-		for _, header := range headers {
-			row = append(row, fmt.Sprintf("%v", record[header]))
-		}
-		writer.Write(row)
+	file, size, err := es.storage.Open(ctx, req.filePath)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, 0, ErrExportExpired
 	}
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to open export file: %w", err)
+	}
+
+	es.db.Exec(`UPDATE export_requests SET downloaded_at = ? WHERE id = ?`, time.Now().UTC(), requestID)
 
-	writer.Flush()
-	return builder.String()
+	return req, file, size, nil
 }
 
-func (es *ExportService) convertToJSON(data []map[string]interface{}) string {
-	jsonData, _ := json.MarshalIndent(data, "", "  ")
-	return string(jsonData)
+// CollectExpiredExports deletes the files of expired exports and marks them expired
+func (es *ExportService) CollectExpiredExports(ctx context.Context) (int, error) {
+	rows, err := es.db.Query(`
+		SELECT id, COALESCE(file_path, '') FROM export_requests
+		WHERE status != 'expired' AND expires_at IS NOT NULL AND expires_at < ?
+	`, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired exports: %w", err)
+	}
+
+	type expiredExport struct{ id, filePath string }
+	var expired []expiredExport
+	for rows.Next() {
+		var export expiredExport
+		if err := rows.Scan(&export.id, &export.filePath); err == nil {
+			expired = append(expired, export)
+		}
+	}
+	rows.Close()
+
+	collected := 0
+	for _, export := range expired {
+		if err := ctx.Err(); err != nil {
+			return collected, err
+		}
+		if export.filePath != "" {
+			if err := es.storage.Delete(ctx, export.filePath); err != nil {
+				log.Printf("Failed to delete expired export %s: %v", export.id, err)
+				continue
+			}
+		}
+
+		_, err := es.db.Exec(`UPDATE export_requests SET status = 'expired', file_path = NULL WHERE id = ?`, export.id)
+		if err != nil {
+			return collected, fmt.Errorf("failed to expire export request: %w", err)
+		}
+		collected++
+	}
+
+	return collected, nil
 }
 
-func (es *ExportService) updateExportStatus(requestID, status, fileURL string) {
-	query := `UPDATE export_requests SET status = ?, file_url = ? WHERE id = ?`
-	es.db.Exec(query, status, fileURL, requestID)
+// RunExpiredExportCleanup garbage-collects expired export files until ctx is cancelled
+func (es *ExportService) RunExpiredExportCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			collected, err := es.CollectExpiredExports(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Error collecting expired exports: %v", err)
+			}
+			if collected > 0 {
+				log.Printf("Removed %d expired export file(s)", collected)
+			}
+		}
+	}
 }
 
-func (es *ExportService) GetExportStatus(requestID string) (*ExportRequest, error) {
+func (es *ExportService) getExportRequest(requestID string) (*ExportRequest, error) {
 	query := `
-		SELECT id, brand_id, event_id, data_type, format, status, file_url, created_at, expires_at
+		SELECT id, brand_id, event_id, data_type, format, options, status, file_path, file_size, record_count,
+		       error_message, created_at, completed_at, expires_at,
+		       schedule_id, delivery_status, delivery_error, delivered_at
 		FROM export_requests WHERE id = ?
 	`
 
+	return scanExportRequest(es.db.QueryRow(query, requestID))
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanExportRequest scans a row selected with the columns of getExportRequest
+func scanExportRequest(row rowScanner) (*ExportRequest, error) {
 	var req ExportRequest
-	err := es.db.QueryRow(query, requestID).Scan(
-		&req.ID, &req.BrandID, &req.EventID, &req.DataType,
-		&req.Format, &req.Status, &req.FileURL, &req.CreatedAt, &req.ExpiresAt,
+	var eventID, options, filePath, errorMessage sql.NullString
+	var scheduleID, deliveryStatus, deliveryError sql.NullString
+	var fileSize, recordCount sql.NullInt64
+	var completedAt, expiresAt, deliveredAt sql.NullTime
+
+	err := row.Scan(
+		&req.ID, &req.BrandID, &eventID, &req.DataType, &req.Format, &options, &req.Status,
+		&filePath, &fileSize, &recordCount, &errorMessage, &req.CreatedAt, &completedAt, &expiresAt,
+		&scheduleID, &deliveryStatus, &deliveryError, &deliveredAt,
 	)
-
+	if err == sql.ErrNoRows {
+		return nil, ErrExportNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("export request not found: %w", err)
+		return nil, fmt.Errorf("failed to get export request: %w", err)
+	}
+
+	req.ScheduleID = scheduleID.String
+	req.DeliveryStatus = deliveryStatus.String
+	req.DeliveryError = deliveryError.String
+	if deliveredAt.Valid {
+		req.DeliveredAt = &deliveredAt.Time
+	}
+	req.EventID = eventID.String
+	req.filePath = filePath.String
+	req.FileSize = fileSize.Int64
+	req.RecordCount = int(recordCount.Int64)
+	req.Error = errorMessage.String
+	if completedAt.Valid {
+		req.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		req.ExpiresAt = expiresAt.Time
+	} else {
+		req.ExpiresAt = req.CreatedAt.Add(exportRetention)
+	}
+
+	// Requests created before export options existed describe a single
+	// dataset in their columns
+	req.Spec = &ExportSpec{}
+	if !options.Valid || json.Unmarshal([]byte(options.String), req.Spec) != nil {
+		req.Spec = &ExportSpec{DataTypes: []string{req.DataType}, Format: req.Format}
+		if req.DataType == "all" {
+			req.Spec.DataTypes = exportDataTypes
+		}
+		if req.EventID != "" {
+			req.Spec.EventIDs = []string{req.EventID}
+		}
 	}
 
 	return &req, nil
 }
+
+// FileName is the name the export file is downloaded as
+func (req *ExportRequest) FileName() string {
+	return req.DataType + "-" + path.Base(req.filePath)
+}
+
+// ContentType is the MIME type of the export file
+func (req *ExportRequest) ContentType() string {
+	if path.Ext(req.filePath) == ".zip" {
+		return "application/zip"
+	}
+	if format, ok := export.Lookup(req.Format); ok {
+		return format.ContentType
+	}
+	return "application/octet-stream"
+}
+
+// ExportFormats returns the registered export file formats
+func (es *ExportService) ExportFormats() []export.Format {
+	return export.Formats()
+}
+
+func downloadResource(requestID string) string {
+	return "export:" + requestID
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueStrings drops empty and repeated values, keeping the first occurrence
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, value := range values {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,168 @@
+/**
+ * Export Datasets
+ * Typed schemas and queries for each exportable data type
+ */
+
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"lynkr/pkg/export"
+)
+
+// exportDataTypes lists the exportable data types in the order they are
+// bundled into multi-dataset exports
+var exportDataTypes = []string{"attendance", "content", "analytics", "feedback"}
+
+// exportDataset is an exportable data type. Queries are built from the
+// selected columns and filtered by event IDs and the export date range.
+type exportDataset struct {
+	name        string
+	columns     []exportColumn
+	from        string // FROM and JOIN clauses
+	eventColumn string // column holding the event ID
+	timeColumn  string // column the date range applies to, if any
+	orderBy     string
+}
+
+// exportColumn is a schema column and the SQL expression selecting it
+type exportColumn struct {
+	export.Column
+	expr string
+}
+
+var exportDatasets = map[string]exportDataset{
+	"attendance": {
+		name: "attendance",
+		columns: []exportColumn{
+			{export.Column{Name: "event_id", Type: export.TypeString}, "a.event_id"},
+			{export.Column{Name: "user_id", Type: export.TypeString}, "u.id"},
+			{export.Column{Name: "email", Type: export.TypeString}, "u.email"},
+			{export.Column{Name: "check_in_time", Type: export.TypeTime}, "a.check_in_time"},
+			{export.Column{Name: "check_out_time", Type: export.TypeTime}, "a.check_out_time"},
+			{export.Column{Name: "duration_minutes", Type: export.TypeInt},
+				"CAST(ROUND((julianday(a.check_out_time) - julianday(a.check_in_time)) * 1440) AS INTEGER)"},
+		},
+		from:        "attendances a JOIN users u ON a.user_id = u.id",
+		eventColumn: "a.event_id",
+		timeColumn:  "a.check_in_time",
+		orderBy:     "a.event_id, a.check_in_time, a.id",
+	},
+	"content": {
+		name: "content",
+		columns: []exportColumn{
+			{export.Column{Name: "event_id", Type: export.TypeString}, "c.event_id"},
+			{export.Column{Name: "content_id", Type: export.TypeString}, "c.id"},
+			{export.Column{Name: "user_id", Type: export.TypeString}, "c.user_id"},
+			{export.Column{Name: "media_type", Type: export.TypeString}, "c.type"},
+			{export.Column{Name: "caption", Type: export.TypeString}, "c.caption"},
+			{export.Column{Name: "view_count", Type: export.TypeInt}, "c.view_count"},
+			{export.Column{Name: "share_count", Type: export.TypeInt}, "c.share_count"},
+			{export.Column{Name: "created_at", Type: export.TypeTime}, "c.created_at"},
+		},
+		from:        "content c",
+		eventColumn: "c.event_id",
+		timeColumn:  "c.created_at",
+		orderBy:     "c.event_id, c.created_at, c.id",
+	},
+	// One row per event. Each metric is counted separately so attendances
+	// and content don't multiply, and the date range applies inside each count.
+	"analytics": {
+		name: "analytics",
+		columns: []exportColumn{
+			{export.Column{Name: "event_id", Type: export.TypeString}, "e.id"},
+			{export.Column{Name: "event_name", Type: export.TypeString}, "e.name"},
+			{export.Column{Name: "total_attendees", Type: export.TypeInt},
+				"(SELECT COUNT(DISTINCT a.user_id) FROM attendances a WHERE a.event_id = e.id AND " + exportRangeCondition("a.check_in_time") + ")"},
+			{export.Column{Name: "total_content", Type: export.TypeInt},
+				"(SELECT COUNT(*) FROM content c WHERE c.event_id = e.id AND " + exportRangeCondition("c.created_at") + ")"},
+			{export.Column{Name: "total_views", Type: export.TypeInt},
+				"(SELECT COALESCE(SUM(c.view_count), 0) FROM content c WHERE c.event_id = e.id AND " + exportRangeCondition("c.created_at") + ")"},
+			{export.Column{Name: "total_shares", Type: export.TypeInt},
+				"(SELECT COALESCE(SUM(c.share_count), 0) FROM content c WHERE c.event_id = e.id AND " + exportRangeCondition("c.created_at") + ")"},
+			{export.Column{Name: "generated_at", Type: export.TypeTime}, "CURRENT_TIMESTAMP"},
+		},
+		from:        "events e",
+		eventColumn: "e.id",
+		orderBy:     "e.id",
+	},
+	"feedback": {
+		name: "feedback",
+		columns: []exportColumn{
+			{export.Column{Name: "event_id", Type: export.TypeString}, "p.event_id"},
+			{export.Column{Name: "user_id", Type: export.TypeString}, "pv.user_id"},
+			{export.Column{Name: "poll_id", Type: export.TypeString}, "pv.poll_id"},
+			{export.Column{Name: "question", Type: export.TypeString}, "p.question"},
+			{export.Column{Name: "option_id", Type: export.TypeString}, "pv.option_id"},
+			{export.Column{Name: "option_text", Type: export.TypeString}, "po.text"},
+			{export.Column{Name: "created_at", Type: export.TypeTime}, "pv.created_at"},
+		},
+		from:        "poll_votes pv JOIN polls p ON pv.poll_id = p.id LEFT JOIN poll_options po ON pv.option_id = po.id",
+		eventColumn: "p.event_id",
+		timeColumn:  "pv.created_at",
+		orderBy:     "p.event_id, pv.created_at, pv.id",
+	},
+}
+
+// exportRangeCondition filters a timestamp column by the :from and :to
+// parameters. Either bound may be NULL for an open range.
+func exportRangeCondition(column string) string {
+	return fmt.Sprintf("(:from IS NULL OR datetime(%[1]s) >= :from) AND (:to IS NULL OR datetime(%[1]s) < :to)", column)
+}
+
+// hasColumn reports whether the dataset has a column with the given name
+func (d exportDataset) hasColumn(name string) bool {
+	for _, column := range d.columns {
+		if column.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// query builds the schema, SQL and arguments for the selected fields (all
+// columns when empty, always in schema order) of the given events
+func (d exportDataset) query(fields []string, eventIDs []string, exportRange exportTimeRange) (export.Schema, string, []interface{}) {
+	selected := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		selected[field] = true
+	}
+
+	schema := export.Schema{Name: d.name}
+	var selects []string
+	for _, column := range d.columns {
+		if len(fields) > 0 && !selected[column.Name] {
+			continue
+		}
+		schema.Columns = append(schema.Columns, column.Column)
+		selects = append(selects, column.expr)
+	}
+
+	args := []interface{}{
+		sql.Named("from", exportRange.from),
+		sql.Named("to", exportRange.to),
+	}
+	placeholders := make([]string, len(eventIDs))
+	for i, eventID := range eventIDs {
+		name := fmt.Sprintf("event%d", i)
+		placeholders[i] = ":" + name
+		args = append(args, sql.Named(name, eventID))
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s IN (%s)",
+		strings.Join(selects, ", "), d.from, d.eventColumn, strings.Join(placeholders, ", "))
+	if d.timeColumn != "" {
+		query += " AND " + exportRangeCondition(d.timeColumn)
+	}
+	query += " ORDER BY " + d.orderBy
+
+	return schema, query, args
+}
+
+// exportTimeRange holds the bound values of the :from and :to parameters
+type exportTimeRange struct {
+	from, to interface{}
+}
@@ -0,0 +1,973 @@
+/**
+ * Export Schedules
+ * Recurring exports that run on a cron schedule and are delivered to the brand
+ */
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"lynkr/internal/jobs"
+	"lynkr/pkg/cron"
+	"lynkr/pkg/storage"
+)
+
+const (
+	// ExportScheduleJobType runs one occurrence of an export schedule
+	ExportScheduleJobType = "export.scheduled"
+	// ExportDeliveryJobType sends a finished scheduled export to its delivery target
+	ExportDeliveryJobType = "export.deliver"
+)
+
+// minScheduleInterval is the shortest time allowed between two scheduled runs
+const minScheduleInterval = time.Hour
+
+// Export delivery targets
+const (
+	DeliveryStorage = "storage"
+	DeliverySFTP    = "sftp"
+	DeliveryWebhook = "webhook"
+)
+
+var (
+	ErrExportScheduleNotFound  = errors.New("export schedule not found")
+	ErrExportDeliveryCancelled = errors.New("delivery was cancelled")
+)
+
+var deliveryHostPattern = regexp.MustCompile(`^[A-Za-z0-9.-]+(:[0-9]+)?$`)
+
+// errNonPublicWebhookAddress is returned when a webhook would connect to an
+// address on the API's own networks
+var errNonPublicWebhookAddress = errors.New("webhook address is not public")
+
+// webhookLookupTimeout bounds resolving a webhook host when a schedule is saved
+const webhookLookupTimeout = 5 * time.Second
+
+// nonPublicNetworks are reserved ranges webhooks must not reach, next to the
+// loopback, private, link-local and multicast addresses net.IP recognizes.
+// 100.64.0.0/10 and 192.0.0.0/24 hold the metadata services of some clouds.
+var nonPublicNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("192.0.0.0/24"),
+	mustParseCIDR("198.18.0.0/15"),
+	mustParseCIDR("240.0.0.0/4"),
+}
+
+// ExportSchedule is a recurring export. Each run is an export request that
+// shows up in status polling and in the schedule's run history.
+type ExportSchedule struct {
+	ID          string         `json:"id"`
+	BrandID     string         `json:"brandId"`
+	Name        string         `json:"name"`
+	Cron        string         `json:"cron"`
+	Spec        ExportSpec     `json:"spec"`
+	Incremental bool           `json:"incremental"`
+	Delivery    ExportDelivery `json:"delivery"`
+	Status      string         `json:"status"`
+	LastRun     *time.Time     `json:"lastRun,omitempty"`
+	NextRun     *time.Time     `json:"nextRun,omitempty"`
+	LastError   string         `json:"lastError,omitempty"`
+	CreatedAt   time.Time      `json:"createdAt"`
+}
+
+// ExportDelivery is where the files of scheduled runs are sent. Without a
+// type, runs are only available through status polling and download links.
+type ExportDelivery struct {
+	Type   string `json:"type,omitempty"`   // storage, sftp or webhook
+	Path   string `json:"path,omitempty"`   // storage and sftp: directory the file is written to
+	Host   string `json:"host,omitempty"`   // sftp: server the file is uploaded to
+	URL    string `json:"url,omitempty"`    // webhook: endpoint notified with a download link
+	Secret string `json:"secret,omitempty"` // webhook: signing secret, only returned when the schedule is saved
+}
+
+// ExportScheduleInput holds the settings of a schedule being created or updated
+type ExportScheduleInput struct {
+	Name        string
+	Cron        string
+	Spec        ExportSpec
+	Incremental bool
+	Delivery    ExportDelivery
+}
+
+type exportScheduleJobPayload struct {
+	ScheduleID string    `json:"scheduleId"`
+	RunAt      time.Time `json:"runAt"`
+}
+
+type exportDeliveryJobPayload struct {
+	RequestID string `json:"requestId"`
+}
+
+// exportWebhookPayload is the body POSTed to webhook delivery targets
+type exportWebhookPayload struct {
+	Event        string     `json:"event"`
+	ScheduleID   string     `json:"scheduleId"`
+	ScheduleName string     `json:"scheduleName"`
+	RequestID    string     `json:"requestId"`
+	BrandID      string     `json:"brandId"`
+	DataTypes    []string   `json:"dataTypes"`
+	Format       string     `json:"format"`
+	FileName     string     `json:"fileName"`
+	FileSize     int64      `json:"fileSize"`
+	RecordCount  int        `json:"recordCount"`
+	DownloadURL  string     `json:"downloadUrl"`
+	CompletedAt  *time.Time `json:"completedAt,omitempty"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+}
+
+// CreateExportSchedule validates and stores a schedule and queues its first run.
+// The returned schedule includes the webhook signing secret.
+func (es *ExportService) CreateExportSchedule(brandID string, input ExportScheduleInput) (*ExportSchedule, error) {
+	schedule := &ExportSchedule{
+		ID:        fmt.Sprintf("schedule_%d", time.Now().UnixNano()),
+		BrandID:   brandID,
+		Status:    "active",
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := es.applyScheduleInput(schedule, input); err != nil {
+		return nil, err
+	}
+
+	options, delivery, err := encodeScheduleSettings(schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO scheduled_exports (id, brand_id, name, data_type, format, schedule_cron, options, incremental, delivery, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = es.db.Exec(query, schedule.ID, brandID, schedule.Name, scheduleDataType(schedule.Spec), schedule.Spec.Format,
+		schedule.Cron, options, schedule.Incremental, delivery, schedule.Status, schedule.CreatedAt, schedule.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export schedule: %w", err)
+	}
+
+	if err := es.scheduleNextRun(schedule, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// UpdateExportSchedule replaces a schedule's settings and reschedules its next
+// run. A webhook keeps its signing secret while the URL stays the same.
+func (es *ExportService) UpdateExportSchedule(brandID, scheduleID string, input ExportScheduleInput) (*ExportSchedule, error) {
+	schedule, err := es.getBrandExportSchedule(brandID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := schedule.Delivery
+	if input.Delivery.Type == DeliveryWebhook && previous.Type == DeliveryWebhook && previous.URL == input.Delivery.URL {
+		input.Delivery.Secret = previous.Secret
+	}
+	if err := es.applyScheduleInput(schedule, input); err != nil {
+		return nil, err
+	}
+
+	options, delivery, err := encodeScheduleSettings(schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE scheduled_exports
+		SET name = ?, data_type = ?, format = ?, schedule_cron = ?, options = ?, incremental = ?, delivery = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	_, err = es.db.Exec(query, schedule.Name, scheduleDataType(schedule.Spec), schedule.Spec.Format, schedule.Cron,
+		options, schedule.Incremental, delivery, time.Now().UTC(), schedule.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update export schedule: %w", err)
+	}
+
+	if schedule.Status == "active" {
+		if err := es.scheduleNextRun(schedule, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	return schedule, nil
+}
+
+// SetExportScheduleStatus pauses or resumes a schedule. Resuming queues the
+// next run from now; runs missed while paused are skipped.
+func (es *ExportService) SetExportScheduleStatus(brandID, scheduleID, status string) (*ExportSchedule, error) {
+	if status != "active" && status != "paused" {
+		return nil, fmt.Errorf("%w: unsupported schedule status %q", ErrInvalidExport, status)
+	}
+
+	schedule, err := es.getBrandExportSchedule(brandID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = es.db.Exec(`UPDATE scheduled_exports SET status = ?, next_run = NULL, updated_at = ? WHERE id = ?`,
+		status, time.Now().UTC(), scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update export schedule: %w", err)
+	}
+	schedule.Status = status
+	schedule.NextRun = nil
+
+	if status == "active" {
+		if err := es.scheduleNextRun(schedule, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	schedule.Delivery.Secret = ""
+	return schedule, nil
+}
+
+// DeleteExportSchedule removes a schedule. Its past runs stay in export_requests.
+func (es *ExportService) DeleteExportSchedule(brandID, scheduleID string) error {
+	if _, err := es.getBrandExportSchedule(brandID, scheduleID); err != nil {
+		return err
+	}
+
+	if _, err := es.db.Exec(`DELETE FROM scheduled_exports WHERE id = ?`, scheduleID); err != nil {
+		return fmt.Errorf("failed to delete export schedule: %w", err)
+	}
+	return nil
+}
+
+// GetExportSchedule returns one of the brand's schedules
+func (es *ExportService) GetExportSchedule(brandID, scheduleID string) (*ExportSchedule, error) {
+	schedule, err := es.getBrandExportSchedule(brandID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.Delivery.Secret = ""
+	return schedule, nil
+}
+
+// ListExportSchedules returns the brand's schedules, newest first
+func (es *ExportService) ListExportSchedules(brandID string) ([]ExportSchedule, error) {
+	rows, err := es.db.Query(`SELECT `+exportScheduleColumns+` FROM scheduled_exports WHERE brand_id = ? ORDER BY created_at DESC`, brandID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list export schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []ExportSchedule{}
+	for rows.Next() {
+		schedule, err := scanExportSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedule.Delivery.Secret = ""
+		schedules = append(schedules, *schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+// ListExportScheduleRuns returns the most recent runs of a schedule with
+// download links for the ones that are ready
+func (es *ExportService) ListExportScheduleRuns(brandID, scheduleID string, limit int) ([]ExportRequest, error) {
+	if _, err := es.getBrandExportSchedule(brandID, scheduleID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, brand_id, event_id, data_type, format, options, status, file_path, file_size, record_count,
+		       error_message, created_at, completed_at, expires_at,
+		       schedule_id, delivery_status, delivery_error, delivered_at
+		FROM export_requests WHERE brand_id = ? AND schedule_id = ?
+		ORDER BY created_at DESC LIMIT ?
+	`
+
+	rows, err := es.db.Query(query, brandID, scheduleID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list export schedule runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []ExportRequest{}
+	for rows.Next() {
+		req, err := scanExportRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		if req.Status == "completed" && time.Now().Before(req.ExpiresAt) {
+			req.FileURL = es.DownloadURL(req)
+		}
+		runs = append(runs, *req)
+	}
+
+	return runs, rows.Err()
+}
+
+// RunExportSchedule starts a run of a schedule right away without moving its
+// next scheduled run
+func (es *ExportService) RunExportSchedule(brandID, scheduleID string) (*ExportRequest, error) {
+	schedule, err := es.getBrandExportSchedule(brandID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	return es.startScheduledRun(schedule, time.Now().UTC())
+}
+
+// ResumeSchedules makes sure every active export schedule has its next run
+// queued. A run missed while the server was down is run once on startup.
+func (es *ExportService) ResumeSchedules() error {
+	rows, err := es.db.Query(`SELECT ` + exportScheduleColumns + ` FROM scheduled_exports WHERE status = 'active'`)
+	if err != nil {
+		return fmt.Errorf("failed to load export schedules: %w", err)
+	}
+
+	var schedules []*ExportSchedule
+	for rows.Next() {
+		schedule, err := scanExportSchedule(rows)
+		if err != nil {
+			log.Printf("Failed to load export schedule: %v", err)
+			continue
+		}
+		schedules = append(schedules, schedule)
+	}
+	rows.Close()
+
+	for _, schedule := range schedules {
+		if schedule.NextRun == nil {
+			err = es.scheduleNextRun(schedule, time.Now())
+		} else {
+			err = es.enqueueScheduledRun(schedule.ID, *schedule.NextRun)
+		}
+		if err != nil {
+			log.Printf("Failed to resume export schedule %s: %v", schedule.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// applyScheduleInput validates the input and copies it onto the schedule
+func (es *ExportService) applyScheduleInput(schedule *ExportSchedule, input ExportScheduleInput) error {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return fmt.Errorf("%w: a schedule name is required", ErrInvalidExport)
+	}
+	if _, err := parseScheduleCron(input.Cron); err != nil {
+		return err
+	}
+
+	// Each run exports up to its start, or the time since the previous run
+	// when incremental, so fixed date ranges don't apply
+	spec := input.Spec
+	spec.From, spec.To = nil, nil
+	spec, err := validateExportSpec(spec)
+	if err != nil {
+		return err
+	}
+	spec.EventIDs = uniqueStrings(spec.EventIDs)
+	if len(spec.EventIDs) > 0 || spec.CampaignID != 0 {
+		if _, err := es.resolveExportSpec(schedule.BrandID, spec); err != nil {
+			return err
+		}
+	}
+
+	delivery, err := es.validateDelivery(input.Delivery)
+	if err != nil {
+		return err
+	}
+
+	schedule.Name = input.Name
+	schedule.Cron = strings.TrimSpace(input.Cron)
+	schedule.Spec = spec
+	schedule.Incremental = input.Incremental
+	schedule.Delivery = delivery
+	return nil
+}
+
+// parseScheduleCron parses a schedule's cron expression and rejects schedules
+// that never run or run more often than minScheduleInterval
+func parseScheduleCron(expr string) (*cron.Schedule, error) {
+	schedule, err := cron.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+
+	previous := schedule.Next(time.Now().UTC())
+	if previous.IsZero() {
+		return nil, fmt.Errorf("%w: cron expression %q never runs", ErrInvalidExport, expr)
+	}
+	for i := 0; i < 24; i++ {
+		next := schedule.Next(previous)
+		if next.IsZero() {
+			break
+		}
+		if next.Sub(previous) < minScheduleInterval {
+			return nil, fmt.Errorf("%w: schedules can run at most once every %s", ErrInvalidExport, minScheduleInterval)
+		}
+		previous = next
+	}
+
+	return schedule, nil
+}
+
+// validateDelivery normalizes a delivery target, generating a signing secret
+// for new webhooks
+func (es *ExportService) validateDelivery(delivery ExportDelivery) (ExportDelivery, error) {
+	switch delivery.Type {
+	case "":
+		return ExportDelivery{}, nil
+
+	case DeliveryStorage:
+		return ExportDelivery{Type: DeliveryStorage, Path: cleanDeliveryPath(delivery.Path)}, nil
+
+	case DeliverySFTP:
+		if !deliveryHostPattern.MatchString(delivery.Host) {
+			return delivery, fmt.Errorf("%w: a valid SFTP host is required", ErrInvalidExport)
+		}
+		return ExportDelivery{Type: DeliverySFTP, Host: strings.ToLower(delivery.Host), Path: cleanDeliveryPath(delivery.Path)}, nil
+
+	case DeliveryWebhook:
+		target, err := url.Parse(delivery.URL)
+		if err != nil || target.Host == "" {
+			return delivery, fmt.Errorf("%w: a valid webhook URL is required", ErrInvalidExport)
+		}
+		if target.Scheme != "https" && !(target.Scheme == "http" && es.options.AllowInsecureWebhooks) {
+			return delivery, fmt.Errorf("%w: webhook URLs must use https", ErrInvalidExport)
+		}
+		if !es.options.AllowPrivateWebhooks {
+			if err := checkWebhookHost(target.Hostname()); err != nil {
+				return delivery, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+			}
+		}
+
+		secret := delivery.Secret
+		if secret == "" {
+			if secret, err = generateWebhookSecret(); err != nil {
+				return delivery, err
+			}
+		}
+		return ExportDelivery{Type: DeliveryWebhook, URL: target.String(), Secret: secret}, nil
+
+	default:
+		return delivery, fmt.Errorf("%w: unsupported delivery type %q", ErrInvalidExport, delivery.Type)
+	}
+}
+
+// checkWebhookHost resolves a webhook host and rejects it when any of its
+// addresses is not public. The webhook client checks again on every
+// connection, as the host can resolve differently by then.
+func checkWebhookHost(host string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookLookupTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("webhook host %s cannot be resolved", host)
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return fmt.Errorf("webhook host %s resolves to the non-public address %s", host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// publicIP reports whether an address is reachable on the internet rather
+// than on the API's own networks. Link-local addresses include the cloud
+// metadata address 169.254.169.254.
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// newWebhookClient returns the client webhooks are posted with. Unless private
+// targets are allowed, every address it connects to has to be public, which
+// also covers redirects and hosts re-pointed after the schedule was saved
+// (DNS rebinding). Proxies are not used, as they would connect on its behalf.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("%w: %s", errNonPublicWebhookAddress, host)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: 30 * time.Second, Transport: transport}
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// cleanDeliveryPath turns a user supplied directory into a relative path that
+// cannot climb out of the brand's delivery folder
+func cleanDeliveryPath(dir string) string {
+	return strings.Trim(path.Clean("/"+dir), "/")
+}
+
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// scheduleNextRun stores and queues the first run of the schedule after the given time
+func (es *ExportService) scheduleNextRun(schedule *ExportSchedule, after time.Time) error {
+	parsed, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return fmt.Errorf("invalid cron expression for schedule %s: %w", schedule.ID, err)
+	}
+	next := parsed.Next(after.UTC())
+	if next.IsZero() {
+		return fmt.Errorf("export schedule %s never runs again", schedule.ID)
+	}
+
+	if _, err := es.db.Exec(`UPDATE scheduled_exports SET next_run = ? WHERE id = ?`, next, schedule.ID); err != nil {
+		return fmt.Errorf("failed to update next run: %w", err)
+	}
+	schedule.NextRun = &next
+
+	return es.enqueueScheduledRun(schedule.ID, next)
+}
+
+// enqueueScheduledRun queues the run of a schedule at runAt. Runs are keyed by
+// their time, so rescheduling leaves the old run queued; it is skipped when it
+// no longer matches the schedule's next_run.
+func (es *ExportService) enqueueScheduledRun(scheduleID string, runAt time.Time) error {
+	_, err := es.queue.Enqueue(ExportScheduleJobType, exportScheduleJobPayload{ScheduleID: scheduleID, RunAt: runAt.UTC()}, jobs.EnqueueOptions{
+		RunAt:     runAt,
+		DedupeKey: fmt.Sprintf("%s:%s:%d", ExportScheduleJobType, scheduleID, runAt.Unix()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to schedule export: %w", err)
+	}
+	return nil
+}
+
+// handleScheduledExportJob starts a run of a schedule and queues the next one
+func (es *ExportService) handleScheduledExportJob(ctx context.Context, job *jobs.Job) error {
+	var payload exportScheduleJobPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	schedule, err := es.getExportSchedule(payload.ScheduleID)
+	if errors.Is(err, ErrExportScheduleNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Paused, deleted or rescheduled since this run was queued
+	if schedule.Status != "active" || schedule.NextRun == nil || schedule.NextRun.Unix() != payload.RunAt.Unix() {
+		return nil
+	}
+
+	// Queue the next run first so a failing run does not break the schedule
+	after := payload.RunAt
+	if now := time.Now(); now.After(after) {
+		after = now
+	}
+	if err := es.scheduleNextRun(schedule, after); err != nil {
+		log.Printf("Failed to schedule next run of export schedule %s: %v", schedule.ID, err)
+	}
+
+	if _, err := es.startScheduledRun(schedule, payload.RunAt); err != nil {
+		return jobs.Permanent(err)
+	}
+	return nil
+}
+
+// startScheduledRun creates the export request of a run ending at runAt. The
+// outcome is recorded on the schedule; a failed incremental run leaves
+// last_run alone so the next run covers its window too.
+func (es *ExportService) startScheduledRun(schedule *ExportSchedule, runAt time.Time) (*ExportRequest, error) {
+	spec := schedule.Spec
+
+	if schedule.Incremental {
+		from := schedule.CreatedAt
+		if schedule.LastRun != nil {
+			from = *schedule.LastRun
+		}
+		to := runAt
+		spec.From, spec.To = &from, &to
+	}
+
+	var err error
+	if len(spec.EventIDs) == 0 && spec.CampaignID == 0 {
+		spec.EventIDs, err = es.brandEventIDs(schedule.BrandID)
+	}
+
+	var req *ExportRequest
+	if err == nil {
+		req, err = es.createExportRequest(schedule.BrandID, spec, schedule.ID)
+	}
+
+	if err != nil {
+		es.db.Exec(`UPDATE scheduled_exports SET last_error = ? WHERE id = ?`, err.Error(), schedule.ID)
+		return nil, fmt.Errorf("export schedule %s: %w", schedule.ID, err)
+	}
+
+	if schedule.LastRun == nil || runAt.After(*schedule.LastRun) {
+		es.db.Exec(`UPDATE scheduled_exports SET last_run = ?, last_error = NULL WHERE id = ?`, runAt, schedule.ID)
+	} else {
+		es.db.Exec(`UPDATE scheduled_exports SET last_error = NULL WHERE id = ?`, schedule.ID)
+	}
+
+	return req, nil
+}
+
+// brandEventIDs returns the brand's most recent events for schedules that
+// export every event
+func (es *ExportService) brandEventIDs(brandID string) ([]string, error) {
+	rows, err := es.db.Query(`SELECT id FROM events WHERE brand_id = ? ORDER BY start_time DESC LIMIT ?`, brandID, maxExportEvents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get brand events: %w", err)
+	}
+	defer rows.Close()
+
+	var eventIDs []string
+	for rows.Next() {
+		var eventID string
+		if err := rows.Scan(&eventID); err != nil {
+			return nil, fmt.Errorf("failed to get brand events: %w", err)
+		}
+		eventIDs = append(eventIDs, eventID)
+	}
+
+	return eventIDs, rows.Err()
+}
+
+// queueDelivery hands a completed scheduled run to its delivery target
+func (es *ExportService) queueDelivery(req *ExportRequest) {
+	schedule, err := es.getExportSchedule(req.ScheduleID)
+	if err != nil || schedule.Delivery.Type == "" {
+		return
+	}
+
+	es.db.Exec(`UPDATE export_requests SET delivery_status = 'pending' WHERE id = ?`, req.ID)
+
+	_, err = es.queue.Enqueue(ExportDeliveryJobType, exportDeliveryJobPayload{RequestID: req.ID}, jobs.EnqueueOptions{
+		DedupeKey: ExportDeliveryJobType + ":" + req.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to queue delivery of export %s: %v", req.ID, err)
+		es.recordDelivery(req.ID, err)
+	}
+}
+
+// handleDeliveryJob delivers a scheduled run. The run is only marked failed
+// once the job has no attempts left.
+func (es *ExportService) handleDeliveryJob(ctx context.Context, job *jobs.Job) error {
+	var payload exportDeliveryJobPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	req, err := es.getExportRequest(payload.RequestID)
+	if errors.Is(err, ErrExportNotFound) {
+		return jobs.Permanent(fmt.Errorf("export request %s not found", payload.RequestID))
+	}
+	if err != nil {
+		return err
+	}
+	if req.Status != "completed" {
+		return jobs.Permanent(fmt.Errorf("export request %s is %s", req.ID, req.Status))
+	}
+
+	schedule, err := es.getExportSchedule(req.ScheduleID)
+	if err == nil {
+		err = es.deliverExport(ctx, schedule, req)
+	}
+	if errors.Is(err, ErrExportScheduleNotFound) {
+		err = jobs.Permanent(err)
+	}
+
+	if err == nil || (ctx.Err() == nil && !job.WillRetry(err)) {
+		es.recordDelivery(req.ID, err)
+	}
+	return err
+}
+
+// cancelDeliveryJob fails the delivery of a cancelled delivery job, which
+// would otherwise stay pending
+func (es *ExportService) cancelDeliveryJob(job *jobs.Job) error {
+	var payload exportDeliveryJobPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	es.recordDelivery(payload.RequestID, ErrExportDeliveryCancelled)
+	return nil
+}
+
+// deliverExport sends the export file of a run to the schedule's delivery target
+func (es *ExportService) deliverExport(ctx context.Context, schedule *ExportSchedule, req *ExportRequest) error {
+	delivery := schedule.Delivery
+	name := deliveryFileName(schedule, req)
+
+	switch delivery.Type {
+	case DeliveryStorage:
+		key := path.Join("deliveries", schedule.BrandID, delivery.Path, name)
+		return es.copyExportFile(ctx, req, es.storage, key)
+
+	case DeliverySFTP:
+		// Stand-in until an SFTP client is added: files land in a local drop
+		// directory laid out as <brand>/<host>/<path>
+		drop, err := storage.NewLocalStorage(es.options.SFTPDropDir)
+		if err != nil {
+			return fmt.Errorf("failed to open SFTP drop directory: %w", err)
+		}
+		key := path.Join(schedule.BrandID, delivery.Host, delivery.Path, name)
+		return es.copyExportFile(ctx, req, drop, key)
+
+	case DeliveryWebhook:
+		return es.postExportWebhook(ctx, schedule, req, name)
+
+	default:
+		return jobs.Permanent(fmt.Errorf("unsupported delivery type: %q", delivery.Type))
+	}
+}
+
+// copyExportFile copies the export file of a request into a storage backend
+func (es *ExportService) copyExportFile(ctx context.Context, req *ExportRequest, target storage.Storage, key string) error {
+	file, size, err := es.storage.Open(ctx, req.filePath)
+	if errors.Is(err, storage.ErrNotFound) {
+		return jobs.Permanent(fmt.Errorf("export file of %s is gone", req.ID))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open export file: %w", err)
+	}
+	defer file.Close()
+
+	if err := target.Put(ctx, key, file, size); err != nil {
+		return fmt.Errorf("failed to deliver export file: %w", err)
+	}
+	return nil
+}
+
+// postExportWebhook notifies a webhook with a signed download link. The body
+// is signed with HMAC-SHA256 over "<timestamp>.<body>" using the schedule's secret.
+func (es *ExportService) postExportWebhook(ctx context.Context, schedule *ExportSchedule, req *ExportRequest, name string) error {
+	body, err := json.Marshal(exportWebhookPayload{
+		Event:        "export.completed",
+		ScheduleID:   schedule.ID,
+		ScheduleName: schedule.Name,
+		RequestID:    req.ID,
+		BrandID:      req.BrandID,
+		DataTypes:    req.Spec.DataTypes,
+		Format:       req.Format,
+		FileName:     name,
+		FileSize:     req.FileSize,
+		RecordCount:  req.RecordCount,
+		DownloadURL:  es.DownloadURL(req),
+		CompletedAt:  req.CompletedAt,
+		ExpiresAt:    req.ExpiresAt,
+	})
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, schedule.Delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Lynkr-Event", "export.completed")
+	httpReq.Header.Set("X-Lynkr-Timestamp", timestamp)
+	httpReq.Header.Set("X-Lynkr-Signature", signWebhook(schedule.Delivery.Secret, timestamp, body))
+
+	resp, err := es.client.Do(httpReq)
+	if errors.Is(err, errNonPublicWebhookAddress) {
+		return jobs.Permanent(fmt.Errorf("webhook request failed: %w", err))
+	}
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return jobs.Permanent(fmt.Errorf("webhook responded with status %d", resp.StatusCode))
+	default:
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// recordDelivery stores the outcome of delivering a run
+func (es *ExportService) recordDelivery(requestID string, cause error) {
+	if cause == nil {
+		es.db.Exec(`UPDATE export_requests SET delivery_status = 'delivered', delivery_error = NULL, delivered_at = ? WHERE id = ?`,
+			time.Now().UTC(), requestID)
+		return
+	}
+	es.db.Exec(`UPDATE export_requests SET delivery_status = 'failed', delivery_error = ? WHERE id = ?`, cause.Error(), requestID)
+}
+
+// deliveryFileName names a delivered file after the schedule and the run time
+func deliveryFileName(schedule *ExportSchedule, req *ExportRequest) string {
+	var slug strings.Builder
+	for _, r := range strings.ToLower(schedule.Name) {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			slug.WriteRune(r)
+		case slug.Len() > 0 && !strings.HasSuffix(slug.String(), "-"):
+			slug.WriteByte('-')
+		}
+	}
+	name := strings.TrimSuffix(slug.String(), "-")
+	if name == "" {
+		name = "export"
+	}
+
+	return name + "-" + req.CreatedAt.UTC().Format("2006-01-02-1504") + path.Ext(req.filePath)
+}
+
+// scheduleDataType is the legacy data_type column value of a schedule
+func scheduleDataType(spec ExportSpec) string {
+	if len(spec.DataTypes) == 1 {
+		return spec.DataTypes[0]
+	}
+	return "all"
+}
+
+func encodeScheduleSettings(schedule *ExportSchedule) (string, sql.NullString, error) {
+	options, err := json.Marshal(schedule.Spec)
+	if err != nil {
+		return "", sql.NullString{}, fmt.Errorf("failed to encode export options: %w", err)
+	}
+	if schedule.Delivery.Type == "" {
+		return string(options), sql.NullString{}, nil
+	}
+
+	delivery, err := json.Marshal(schedule.Delivery)
+	if err != nil {
+		return "", sql.NullString{}, fmt.Errorf("failed to encode export delivery: %w", err)
+	}
+	return string(options), sql.NullString{String: string(delivery), Valid: true}, nil
+}
+
+const exportScheduleColumns = `id, brand_id, name, data_type, format, schedule_cron, options, incremental, delivery,
+	status, last_run, next_run, last_error, created_at`
+
+// getBrandExportSchedule returns a schedule if it belongs to the brand
+func (es *ExportService) getBrandExportSchedule(brandID, scheduleID string) (*ExportSchedule, error) {
+	schedule, err := es.getExportSchedule(scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.BrandID != brandID {
+		return nil, ErrExportScheduleNotFound
+	}
+	return schedule, nil
+}
+
+func (es *ExportService) getExportSchedule(scheduleID string) (*ExportSchedule, error) {
+	row := es.db.QueryRow(`SELECT `+exportScheduleColumns+` FROM scheduled_exports WHERE id = ?`, scheduleID)
+	return scanExportSchedule(row)
+}
+
+func scanExportSchedule(row rowScanner) (*ExportSchedule, error) {
+	var schedule ExportSchedule
+	var dataType, format string
+	var options, delivery, lastError sql.NullString
+	var incremental sql.NullBool
+	var lastRun, nextRun, createdAt sql.NullTime
+
+	err := row.Scan(
+		&schedule.ID, &schedule.BrandID, &schedule.Name, &dataType, &format, &schedule.Cron, &options,
+		&incremental, &delivery, &schedule.Status, &lastRun, &nextRun, &lastError, &createdAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrExportScheduleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export schedule: %w", err)
+	}
+
+	schedule.Incremental = incremental.Bool
+	schedule.LastError = lastError.String
+	schedule.CreatedAt = createdAt.Time
+	if lastRun.Valid {
+		schedule.LastRun = &lastRun.Time
+	}
+	if nextRun.Valid {
+		schedule.NextRun = &nextRun.Time
+	}
+
+	// Schedules created before export options existed name a single
+	// dataset and export every event
+	if !options.Valid || json.Unmarshal([]byte(options.String), &schedule.Spec) != nil {
+		schedule.Spec = ExportSpec{DataTypes: []string{dataType}, Format: format}
+		if dataType == "all" {
+			schedule.Spec.DataTypes = exportDataTypes
+		}
+	}
+	if delivery.Valid {
+		if err := json.Unmarshal([]byte(delivery.String), &schedule.Delivery); err != nil {
+			return nil, fmt.Errorf("invalid delivery of export schedule %s: %w", schedule.ID, err)
+		}
+	}
+
+	return &schedule, nil
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lynkr/internal/jobs"
+)
+
+func newTestExportService(t *testing.T, options ExportOptions) (*ExportService, *jobs.Queue) {
+	t.Helper()
+	db := newTestDB(t)
+	queue := jobs.NewQueue(db, time.Minute)
+	return NewExportService(db, queue, nil, nil, options), queue
+}
+
+func TestParseScheduleCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "0 * * * *"},
+		{expr: "0 9 * * mon-fri"},
+		{expr: "30 6 1 */3 *"},
+		{expr: "@daily"},
+		{expr: "*/30 * * * *", wantErr: true},
+		{expr: "0,30 9 * * *", wantErr: true},
+		{expr: "0 0 30 2 *", wantErr: true},
+		{expr: "every day", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := parseScheduleCron(tt.expr)
+		if tt.wantErr && !errors.Is(err, ErrInvalidExport) {
+			t.Errorf("parseScheduleCron(%q) err = %v, want ErrInvalidExport", tt.expr, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("parseScheduleCron(%q): %v", tt.expr, err)
+		}
+	}
+}
+
+func TestScheduleNextRun(t *testing.T) {
+	es, queue := newTestExportService(t, ExportOptions{})
+	schedule, err := es.CreateExportSchedule("1", ExportScheduleInput{
+		Name: "Monthly attendance",
+		Cron: "0 6 1 * *",
+		Spec: ExportSpec{DataTypes: []string{"attendance"}, Format: "csv"},
+	})
+	if err != nil {
+		t.Fatalf("CreateExportSchedule: %v", err)
+	}
+
+	after := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	if err := es.scheduleNextRun(schedule, after); err != nil {
+		t.Fatalf("scheduleNextRun: %v", err)
+	}
+	want := time.Date(2024, 2, 1, 6, 0, 0, 0, time.UTC)
+	if schedule.NextRun == nil || !schedule.NextRun.Equal(want) {
+		t.Errorf("next run = %v, want %s", schedule.NextRun, want)
+	}
+	stored, err := es.GetExportSchedule("1", schedule.ID)
+	if err != nil {
+		t.Fatalf("GetExportSchedule: %v", err)
+	}
+	if stored.NextRun == nil || !stored.NextRun.Equal(want) {
+		t.Errorf("stored next run = %v, want %s", stored.NextRun, want)
+	}
+
+	pending, err := queue.List(jobs.ListFilter{Type: ExportScheduleJobType, Status: jobs.StatusPending})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	found := false
+	for _, job := range pending {
+		if job.RunAt.Equal(want) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no run queued for %s among %d pending runs", want, len(pending))
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "93.184.215.14", want: true},
+		{ip: "2606:2800:21f:cb07:6820:80da:af6b:8b2c", want: true},
+		{ip: "127.0.0.1"},
+		{ip: "127.8.8.8"},
+		{ip: "::1"},
+		{ip: "10.0.0.5"},
+		{ip: "172.16.3.4"},
+		{ip: "192.168.1.1"},
+		{ip: "fd00:ec2::254"},
+		{ip: "169.254.169.254"},
+		{ip: "fe80::1"},
+		{ip: "0.0.0.0"},
+		{ip: "::"},
+		{ip: "100.100.100.200"},
+		{ip: "192.0.0.192"},
+		{ip: "224.0.0.1"},
+		{ip: "::ffff:10.0.0.1"},
+		{ip: "::ffff:169.254.169.254"},
+	}
+	for _, tt := range tests {
+		if got := publicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("publicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestValidateWebhookDelivery(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		options ExportOptions
+		wantErr bool
+	}{
+		{name: "public address", url: "https://93.184.215.14/hooks/lynkr"},
+		{name: "plain http", url: "http://93.184.215.14/hooks/lynkr", wantErr: true},
+		{name: "plain http in development", url: "http://93.184.215.14/hooks/lynkr", options: ExportOptions{AllowInsecureWebhooks: true}},
+		{name: "loopback", url: "https://127.0.0.1/hooks", wantErr: true},
+		{name: "localhost", url: "https://localhost:8443/hooks", wantErr: true},
+		{name: "IPv6 loopback", url: "https://[::1]/hooks", wantErr: true},
+		{name: "private network", url: "https://10.1.2.3/hooks", wantErr: true},
+		{name: "cloud metadata", url: "https://169.254.169.254/latest/meta-data/", wantErr: true},
+		{name: "IPv6 cloud metadata", url: "https://[fd00:ec2::254]/latest/meta-data/", wantErr: true},
+		{name: "IPv4-mapped private address", url: "https://[::ffff:192.168.0.1]/hooks", wantErr: true},
+		{name: "unresolvable host", url: "https://lynkr-webhooks.invalid/hooks", wantErr: true},
+		{name: "loopback in development", url: "https://127.0.0.1/hooks", options: ExportOptions{AllowPrivateWebhooks: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := &ExportService{options: tt.options}
+			delivery, err := es.validateDelivery(ExportDelivery{Type: DeliveryWebhook, URL: tt.url})
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidExport) {
+					t.Errorf("validateDelivery err = %v, want ErrInvalidExport", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateDelivery: %v", err)
+			}
+			if !strings.HasPrefix(delivery.Secret, "whsec_") {
+				t.Errorf("secret = %q, want a generated signing secret", delivery.Secret)
+			}
+		})
+	}
+}
+
+func TestWebhookClientRefusesNonPublicAddresses(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// A host that passed validation but now resolves to loopback ends up here
+	_, err := newWebhookClient(false).Post(server.URL, "application/json", strings.NewReader("{}"))
+	if !errors.Is(err, errNonPublicWebhookAddress) {
+		t.Errorf("posting to %s = %v, want errNonPublicWebhookAddress", server.URL, err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("server received %d request(s), want none", n)
+	}
+
+	resp, err := newWebhookClient(true).Post(server.URL, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("posting with private targets allowed: %v", err)
+	}
+	resp.Body.Close()
+	if n := requests.Load(); n != 1 {
+		t.Errorf("server received %d request(s), want 1", n)
+	}
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"lynkr/internal/jobs"
+)
+
+func TestCancelledExportJobsFailTheirRequest(t *testing.T) {
+	tests := []struct {
+		name              string
+		jobType           string
+		status            string
+		deliveryStatus    string
+		wantStatus        string
+		wantError         string
+		wantDelivery      string
+		wantDeliveryError string
+	}{
+		{
+			name: "queued export", jobType: ExportJobType, status: "processing",
+			wantStatus: "failed", wantError: ErrExportCancelled.Error(),
+		},
+		{
+			name: "export completed before the cancel", jobType: ExportJobType, status: "completed",
+			wantStatus: "completed",
+		},
+		{
+			name: "queued delivery", jobType: ExportDeliveryJobType, status: "completed", deliveryStatus: "pending",
+			wantStatus: "completed", wantDelivery: "failed", wantDeliveryError: ErrExportDeliveryCancelled.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			queue := jobs.NewQueue(db, time.Minute)
+			NewExportService(db, queue, nil, nil, ExportOptions{})
+
+			_, err := db.Exec(`
+				INSERT INTO export_requests (id, brand_id, data_type, format, status, delivery_status, expires_at)
+				VALUES ('exp_1', '1', 'attendance', 'csv', ?, ?, ?)
+			`, tt.status, sql.NullString{String: tt.deliveryStatus, Valid: tt.deliveryStatus != ""}, time.Now().Add(time.Hour))
+			if err != nil {
+				t.Fatalf("failed to create export request: %v", err)
+			}
+			job, err := queue.Enqueue(tt.jobType, exportJobPayload{RequestID: "exp_1"}, jobs.EnqueueOptions{})
+			if err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+
+			job, err = queue.Cancel(job.ID)
+			if err != nil {
+				t.Fatalf("Cancel: %v", err)
+			}
+			if job.Status != jobs.StatusCancelled {
+				t.Errorf("job status = %s, want %s", job.Status, jobs.StatusCancelled)
+			}
+
+			var status string
+			var errorMessage, deliveryStatus, deliveryError sql.NullString
+			db.QueryRow(`SELECT status, error_message, delivery_status, delivery_error FROM export_requests WHERE id = 'exp_1'`).
+				Scan(&status, &errorMessage, &deliveryStatus, &deliveryError)
+			if status != tt.wantStatus || errorMessage.String != tt.wantError {
+				t.Errorf("request = %s (%q), want %s (%q)", status, errorMessage.String, tt.wantStatus, tt.wantError)
+			}
+			if deliveryStatus.String != tt.wantDelivery || deliveryError.String != tt.wantDeliveryError {
+				t.Errorf("delivery = %s (%q), want %s (%q)", deliveryStatus.String, deliveryError.String, tt.wantDelivery, tt.wantDeliveryError)
+			}
+		})
+	}
+}
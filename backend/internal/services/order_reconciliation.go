@@ -0,0 +1,184 @@
+/**
+ * Order Reconciliation
+ * Scheduled pass over connected stores' recent orders that catches status
+ * changes and refunds webhooks missed
+ */
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"lynkr/internal/ecommerce"
+	"lynkr/internal/jobs"
+)
+
+// OrderReconcileJobType reconciles one integration's orders on the ecommerce queue
+const OrderReconcileJobType = "ecommerce.order_reconcile"
+
+// OrderReconcileResult counts what an order reconciliation recorded
+type OrderReconcileResult struct {
+	Orders    int `json:"orders"`
+	Purchases int `json:"purchases"`
+	Refunds   int `json:"refunds"`
+	// Skipped counts orders with products the catalog has not synced yet;
+	// the next reconciliation reads them again
+	Skipped int `json:"skipped"`
+}
+
+type orderReconcileJobPayload struct {
+	IntegrationID string `json:"integrationId"`
+}
+
+// scheduleOrderReconcile queues an order reconciliation. Only one pending
+// reconciliation is kept per integration.
+func (es *EcommerceService) scheduleOrderReconcile(integrationID string, runAt time.Time) error {
+	_, err := es.queue.Enqueue(OrderReconcileJobType, orderReconcileJobPayload{IntegrationID: integrationID}, jobs.EnqueueOptions{
+		RunAt:     runAt,
+		DedupeKey: OrderReconcileJobType + ":" + integrationID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to schedule order reconciliation: %w", err)
+	}
+	return nil
+}
+
+// handleOrderReconcileJob reconciles an integration's orders and queues the next run
+func (es *EcommerceService) handleOrderReconcileJob(ctx context.Context, job *jobs.Job) error {
+	var payload orderReconcileJobPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	integration, err := es.getIntegration(`id = ?`, payload.IntegrationID)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if integration.Status != "active" {
+		return nil
+	}
+	connector, err := es.connector(integration)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	// Queue the next run first so a failing reconciliation does not break the schedule
+	if integration.SyncInterval > 0 {
+		next := time.Now().Add(time.Duration(integration.SyncInterval) * time.Minute)
+		if err := es.scheduleOrderReconcile(integration.ID, next); err != nil {
+			log.Printf("Failed to schedule next order reconciliation for %s: %v", integration.ID, err)
+		}
+	}
+
+	result, err := es.reconcileOrders(ctx, integration, connector)
+	if err != nil {
+		if wait, limited := ecommerce.RateLimited(err); limited {
+			return jobs.RetryAfter(err, wait)
+		}
+		if errors.Is(err, ecommerce.ErrUnauthorized) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+
+	log.Printf("Reconciled orders of %s: %d orders, %d purchases, %d new refunds, %d skipped",
+		integration.ID, result.Orders, result.Purchases, result.Refunds, result.Skipped)
+	return nil
+}
+
+// reconcileOrders records every order the store changed since the last
+// reconciliation, or within the attribution window on the first one. Refunds
+// are read from the store for orders reporting any, so partial refunds are
+// split over the right products.
+func (es *EcommerceService) reconcileOrders(ctx context.Context, integration *Integration, connector ecommerce.Connector) (*OrderReconcileResult, error) {
+	startedAt := time.Now().UTC()
+	result := &OrderReconcileResult{}
+
+	var lastOrderSync sql.NullTime
+	err := es.db.QueryRow(`SELECT last_order_sync FROM ecommerce_integrations WHERE id = ?`, integration.ID).Scan(&lastOrderSync)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load last order reconciliation: %w", err)
+	}
+	since := startedAt.Add(-purchaseAttributionWindow)
+	if lastOrderSync.Valid {
+		since = lastOrderSync.Time
+	}
+
+	// The next reconciliation resumes at the earliest skipped order
+	resumeAt := startedAt
+	cursor := ""
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		page, err := connector.ListOrders(ctx, since, cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range page.Orders {
+			order := &page.Orders[i]
+			if needsRefundDetail(order) {
+				refunds, err := connector.ListRefunds(ctx, order.ID)
+				if err != nil {
+					return nil, err
+				}
+				order.Refunds = refunds
+			}
+
+			recorded, err := es.RecordOrder(integration, order, RefundSourceReconciliation)
+			if errors.Is(err, errUnknownOrderProducts) {
+				result.Skipped++
+				if !order.UpdatedAt.IsZero() && order.UpdatedAt.Before(resumeAt) {
+					resumeAt = order.UpdatedAt.UTC()
+				}
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			result.Orders++
+			result.Purchases += recorded.Purchases
+			result.Refunds += recorded.Refunds
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	if result.Skipped > 0 {
+		if err := es.requestCatalogSync(integration.ID); err != nil {
+			log.Printf("Failed to queue catalog sync for %s: %v", integration.ID, err)
+		}
+	}
+
+	_, err = es.db.Exec(`UPDATE ecommerce_integrations SET last_order_sync = ?, updated_at = ? WHERE id = ?`,
+		resumeAt, time.Now().UTC(), integration.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update last order reconciliation: %w", err)
+	}
+
+	return result, nil
+}
+
+// needsRefundDetail reports whether an order has refunds the listing does not
+// split over line items
+func needsRefundDetail(order *ecommerce.Order) bool {
+	if len(order.Refunds) == 0 {
+		return strings.Contains(strings.ToLower(order.FinancialStatus), "refunded")
+	}
+	for _, refund := range order.Refunds {
+		if len(refund.LineItems) == 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+/**
+ * Organizer Service
+ * Event organizers, managed by platform admins
+ */
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrOrganizerNotFound  = errors.New("organizer not found")
+	ErrInvalidOrganizer   = errors.New("invalid organizer details")
+	ErrOrganizerHasEvents = errors.New("organizer still has events")
+)
+
+// Organizer runs events on behalf of brands
+type Organizer struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	ContactEmail string    `json:"contactEmail,omitempty"`
+	Website      string    `json:"website,omitempty"`
+	EventCount   int       `json:"eventCount"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// OrganizerInput holds the editable fields of an organizer
+type OrganizerInput struct {
+	Name         string `json:"name"`
+	ContactEmail string `json:"contactEmail"`
+	Website      string `json:"website"`
+}
+
+type OrganizerService struct {
+	db *sql.DB
+}
+
+func NewOrganizerService(db *sql.DB) *OrganizerService {
+	return &OrganizerService{db: db}
+}
+
+const organizerQuery = `
+	SELECT o.id, o.name, COALESCE(o.contact_email, ''), COALESCE(o.website, ''),
+	       (SELECT COUNT(*) FROM events e WHERE e.organizer_id = o.id), o.created_at, o.updated_at
+	FROM organizers o
+`
+
+// ListOrganizers returns organizers by name, optionally only those whose
+// name contains search
+func (ogs *OrganizerService) ListOrganizers(search string, limit, offset int) ([]Organizer, error) {
+	rows, err := ogs.db.Query(organizerQuery+`
+		WHERE ? = '' OR o.name LIKE '%' || ? || '%'
+		ORDER BY o.name, o.id LIMIT ? OFFSET ?
+	`, search, search, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizers: %w", err)
+	}
+	defer rows.Close()
+
+	organizers := []Organizer{}
+	for rows.Next() {
+		organizer, err := scanOrganizer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list organizers: %w", err)
+		}
+		organizers = append(organizers, *organizer)
+	}
+	return organizers, rows.Err()
+}
+
+// GetOrganizer returns an organizer
+func (ogs *OrganizerService) GetOrganizer(id int64) (*Organizer, error) {
+	organizer, err := scanOrganizer(ogs.db.QueryRow(organizerQuery+` WHERE o.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrOrganizerNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organizer: %w", err)
+	}
+	return organizer, nil
+}
+
+// CreateOrganizer adds an organizer
+func (ogs *OrganizerService) CreateOrganizer(actor AdminActor, input OrganizerInput) (*Organizer, error) {
+	input, err := validateOrganizer(input)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := ogs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organizer: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := sqliteTime(time.Now())
+	result, err := tx.Exec(`
+		INSERT INTO organizers (name, contact_email, website, created_at, updated_at) VALUES (?, ?, ?, ?, ?)
+	`, input.Name, nullIfEmpty(input.ContactEmail), nullIfEmpty(input.Website), now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organizer: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organizer: %w", err)
+	}
+	if err := recordAdminAudit(tx, actor, "organizer.created", "organizer", fmt.Sprint(id), map[string]interface{}{"name": input.Name}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create organizer: %w", err)
+	}
+	return ogs.GetOrganizer(id)
+}
+
+// UpdateOrganizer replaces the editable fields of an organizer
+func (ogs *OrganizerService) UpdateOrganizer(actor AdminActor, id int64, input OrganizerInput) (*Organizer, error) {
+	input, err := validateOrganizer(input)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := ogs.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update organizer: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE organizers SET name = ?, contact_email = ?, website = ?, updated_at = ? WHERE id = ?
+	`, input.Name, nullIfEmpty(input.ContactEmail), nullIfEmpty(input.Website), sqliteTime(time.Now()), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update organizer: %w", err)
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return nil, ErrOrganizerNotFound
+	}
+	if err := recordAdminAudit(tx, actor, "organizer.updated", "organizer", fmt.Sprint(id), map[string]interface{}{"name": input.Name}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update organizer: %w", err)
+	}
+	return ogs.GetOrganizer(id)
+}
+
+// DeleteOrganizer removes an organizer without events. Events have to be
+// moved to another organizer first.
+func (ogs *OrganizerService) DeleteOrganizer(actor AdminActor, id int64) error {
+	tx, err := ogs.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to delete organizer: %w", err)
+	}
+	defer tx.Rollback()
+
+	var events int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM events WHERE organizer_id = ?`, id).Scan(&events); err != nil {
+		return fmt.Errorf("failed to delete organizer: %w", err)
+	}
+	if events > 0 {
+		return ErrOrganizerHasEvents
+	}
+	result, err := tx.Exec(`DELETE FROM organizers WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete organizer: %w", err)
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return ErrOrganizerNotFound
+	}
+	if err := recordAdminAudit(tx, actor, "organizer.deleted", "organizer", fmt.Sprint(id), nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete organizer: %w", err)
+	}
+	return nil
+}
+
+func validateOrganizer(input OrganizerInput) (OrganizerInput, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	input.Website = strings.TrimSpace(input.Website)
+	if input.Name == "" {
+		return input, fmt.Errorf("%w: a name is required", ErrInvalidOrganizer)
+	}
+	if input.ContactEmail != "" {
+		email, err := validateEmail(input.ContactEmail)
+		if err != nil {
+			return input, fmt.Errorf("%w: invalid contact email", ErrInvalidOrganizer)
+		}
+		input.ContactEmail = email
+	}
+	return input, nil
+}
+
+func scanOrganizer(row rowScanner) (*Organizer, error) {
+	var organizer Organizer
+	err := row.Scan(&organizer.ID, &organizer.Name, &organizer.ContactEmail, &organizer.Website,
+		&organizer.EventCount, &organizer.CreatedAt, &organizer.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &organizer, nil
+}
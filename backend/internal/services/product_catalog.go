@@ -0,0 +1,405 @@
+/**
+ * Product Catalog
+ * Scheduled sync of connected stores' products and the brand's catalog browser
+ */
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"lynkr/internal/ecommerce"
+	"lynkr/internal/jobs"
+)
+
+var ErrProductNotFound = errors.New("product not found")
+
+// CatalogSyncJobType syncs one integration's products on the ecommerce queue
+const CatalogSyncJobType = "ecommerce.catalog_sync"
+
+// priceHistoryLimit is how many price changes are returned with a product
+const priceHistoryLimit = 100
+
+// CatalogProduct is a product synced from a brand's store
+type CatalogProduct struct {
+	ID            string       `json:"id"`
+	IntegrationID string       `json:"integrationId"`
+	ExternalID    string       `json:"externalId"`
+	Name          string       `json:"name"`
+	Description   string       `json:"description"`
+	Price         float64      `json:"price"`
+	ImageURL      string       `json:"imageUrl"`
+	Status        string       `json:"status"`
+	LastSyncedAt  *time.Time   `json:"lastSyncedAt,omitempty"`
+	DeletedAt     *time.Time   `json:"deletedAt,omitempty"`
+	UpdatedAt     time.Time    `json:"updatedAt"`
+	PriceHistory  []PricePoint `json:"priceHistory,omitempty"`
+}
+
+// PricePoint is a price a product had from RecordedAt on
+type PricePoint struct {
+	Price      float64   `json:"price"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// CatalogFilter narrows a catalog listing. Query matches product names,
+// descriptions and store product IDs.
+type CatalogFilter struct {
+	Query          string
+	IncludeDeleted bool
+	Limit          int
+	Offset         int
+}
+
+// CatalogSyncResult counts what a catalog sync changed
+type CatalogSyncResult struct {
+	Added     int `json:"added"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Removed   int `json:"removed"`
+}
+
+type catalogSyncJobPayload struct {
+	IntegrationID string `json:"integrationId"`
+}
+
+// ResumeSchedules makes sure every active integration with a connector has
+// its next catalog sync and order reconciliation queued. Integrations that
+// were never synced or reconciled run right away.
+func (es *EcommerceService) ResumeSchedules() error {
+	rows, err := es.db.Query(`SELECT id, platform_type, last_sync, last_order_sync, sync_interval FROM ecommerce_integrations WHERE status = 'active' AND sync_interval > 0`)
+	if err != nil {
+		return fmt.Errorf("failed to load integrations: %w", err)
+	}
+	defer rows.Close()
+
+	syncAt := make(map[string]time.Time)
+	reconcileAt := make(map[string]time.Time)
+	for rows.Next() {
+		var integrationID, platformType string
+		var lastSync, lastOrderSync sql.NullTime
+		var syncInterval int
+		if err := rows.Scan(&integrationID, &platformType, &lastSync, &lastOrderSync, &syncInterval); err != nil || !ecommerce.Supported(platformType) {
+			continue
+		}
+		interval := time.Duration(syncInterval) * time.Minute
+		syncAt[integrationID] = nextScheduledRun(lastSync, interval)
+		reconcileAt[integrationID] = nextScheduledRun(lastOrderSync, interval)
+	}
+	rows.Close()
+
+	for integrationID, next := range syncAt {
+		if err := es.scheduleCatalogSync(integrationID, next); err != nil {
+			log.Printf("Failed to resume catalog sync for %s: %v", integrationID, err)
+		}
+	}
+	for integrationID, next := range reconcileAt {
+		if err := es.scheduleOrderReconcile(integrationID, next); err != nil {
+			log.Printf("Failed to resume order reconciliation for %s: %v", integrationID, err)
+		}
+	}
+
+	return nil
+}
+
+// nextScheduledRun is when a job last run at lastRun is due again, or now
+// when it never ran or is overdue
+func nextScheduledRun(lastRun sql.NullTime, interval time.Duration) time.Time {
+	next := time.Now()
+	if lastRun.Valid {
+		if due := lastRun.Time.Add(interval); due.After(next) {
+			next = due
+		}
+	}
+	return next
+}
+
+// scheduleCatalogSync queues a catalog sync. Only one pending sync is kept
+// per integration.
+func (es *EcommerceService) scheduleCatalogSync(integrationID string, runAt time.Time) error {
+	_, err := es.queue.Enqueue(CatalogSyncJobType, catalogSyncJobPayload{IntegrationID: integrationID}, jobs.EnqueueOptions{
+		RunAt:     runAt,
+		DedupeKey: CatalogSyncJobType + ":" + integrationID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to schedule catalog sync: %w", err)
+	}
+	return nil
+}
+
+// requestCatalogSync queues a sync to run right away without waiting for the
+// scheduled one. Only one requested sync is kept per integration.
+func (es *EcommerceService) requestCatalogSync(integrationID string) error {
+	_, err := es.queue.Enqueue(CatalogSyncJobType, catalogSyncJobPayload{IntegrationID: integrationID}, jobs.EnqueueOptions{
+		DedupeKey: CatalogSyncJobType + ":" + integrationID + ":requested",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to request catalog sync: %w", err)
+	}
+	return nil
+}
+
+// handleCatalogSyncJob syncs an integration's catalog and queues the next run
+func (es *EcommerceService) handleCatalogSyncJob(ctx context.Context, job *jobs.Job) error {
+	var payload catalogSyncJobPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	integration, err := es.getIntegration(`id = ?`, payload.IntegrationID)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if integration.Status != "active" {
+		return nil
+	}
+	connector, err := es.connector(integration)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	// Queue the next run first so a failing sync does not break the schedule
+	if integration.SyncInterval > 0 {
+		next := time.Now().Add(time.Duration(integration.SyncInterval) * time.Minute)
+		if err := es.scheduleCatalogSync(integration.ID, next); err != nil {
+			log.Printf("Failed to schedule next catalog sync for %s: %v", integration.ID, err)
+		}
+	}
+
+	result, err := es.syncCatalog(ctx, integration, connector)
+	if err != nil {
+		if wait, limited := ecommerce.RateLimited(err); limited {
+			return jobs.RetryAfter(err, wait)
+		}
+		if errors.Is(err, ecommerce.ErrUnauthorized) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+
+	log.Printf("Synced catalog of %s: %d added, %d updated, %d unchanged, %d removed",
+		integration.ID, result.Added, result.Updated, result.Unchanged, result.Removed)
+	return nil
+}
+
+// syncCatalog upserts every product the store lists and soft-deletes the
+// ones it no longer lists. Removal only happens after a complete listing, so
+// an interrupted sync never deletes products.
+func (es *EcommerceService) syncCatalog(ctx context.Context, integration *Integration, connector ecommerce.Connector) (*CatalogSyncResult, error) {
+	startedAt := time.Now().UTC()
+	result := &CatalogSyncResult{}
+
+	cursor := ""
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		page, err := connector.ListProducts(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+		if err := es.upsertProducts(integration, page.Products, startedAt, result); err != nil {
+			return nil, err
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	now := time.Now().UTC()
+	removed, err := es.db.Exec(`
+		UPDATE products SET status = 'deleted', deleted_at = ?, updated_at = ?
+		WHERE integration_id = ? AND deleted_at IS NULL
+		  AND (last_synced_at IS NULL OR datetime(last_synced_at) < datetime(?))
+	`, now, now, integration.ID, startedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove products: %w", err)
+	}
+	if count, err := removed.RowsAffected(); err == nil {
+		result.Removed = int(count)
+	}
+
+	if _, err := es.db.Exec(`UPDATE ecommerce_integrations SET last_sync = ?, updated_at = ? WHERE id = ?`, startedAt, now, integration.ID); err != nil {
+		return nil, fmt.Errorf("failed to update last sync time: %w", err)
+	}
+
+	return result, nil
+}
+
+// upsertProducts stores one page of store products in a single transaction.
+// Products are matched on their store ID; a changed price is added to the
+// price history and removed products that reappear are restored.
+func (es *EcommerceService) upsertProducts(integration *Integration, products []ecommerce.Product, syncedAt time.Time, result *CatalogSyncResult) error {
+	tx, err := es.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for _, product := range products {
+		var productID, name, description, imageURL string
+		var price float64
+		var deletedAt sql.NullTime
+		err := tx.QueryRow(`
+			SELECT id, name, COALESCE(description, ''), price, COALESCE(image_url, ''), deleted_at
+			FROM products WHERE integration_id = ? AND external_id = ?
+		`, integration.ID, product.ID).Scan(&productID, &name, &description, &price, &imageURL, &deletedAt)
+
+		switch {
+		case err == sql.ErrNoRows:
+			productID = "prod_" + strings.TrimPrefix(integration.ID, "integration_") + "_" + product.ID
+			_, err = tx.Exec(`
+				INSERT INTO products (id, brand_id, integration_id, external_id, name, description, price, image_url, status, last_synced_at, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'active', ?, ?, ?)
+			`, productID, integration.BrandID, integration.ID, product.ID, product.Name, product.Description,
+				product.Price, product.ImageURL, syncedAt, now, now)
+			if err != nil {
+				return fmt.Errorf("failed to add product %s: %w", product.ID, err)
+			}
+			if err := recordPrice(tx, productID, product.Price, now); err != nil {
+				return err
+			}
+			result.Added++
+
+		case err != nil:
+			return fmt.Errorf("failed to get product %s: %w", product.ID, err)
+
+		case name == product.Name && description == product.Description && price == product.Price &&
+			imageURL == product.ImageURL && !deletedAt.Valid:
+			if _, err := tx.Exec(`UPDATE products SET last_synced_at = ? WHERE id = ?`, syncedAt, productID); err != nil {
+				return fmt.Errorf("failed to update product %s: %w", product.ID, err)
+			}
+			result.Unchanged++
+
+		default:
+			_, err = tx.Exec(`
+				UPDATE products SET name = ?, description = ?, price = ?, image_url = ?, status = 'active',
+				       deleted_at = NULL, last_synced_at = ?, updated_at = ?
+				WHERE id = ?
+			`, product.Name, product.Description, product.Price, product.ImageURL, syncedAt, now, productID)
+			if err != nil {
+				return fmt.Errorf("failed to update product %s: %w", product.ID, err)
+			}
+			if price != product.Price {
+				if err := recordPrice(tx, productID, product.Price, now); err != nil {
+					return err
+				}
+			}
+			result.Updated++
+		}
+	}
+
+	return tx.Commit()
+}
+
+func recordPrice(tx *sql.Tx, productID string, price float64, at time.Time) error {
+	if _, err := tx.Exec(`INSERT INTO product_price_history (product_id, price, recorded_at) VALUES (?, ?, ?)`, productID, price, at); err != nil {
+		return fmt.Errorf("failed to record price of %s: %w", productID, err)
+	}
+	return nil
+}
+
+// ListCatalog returns the brand's synced products, most recently changed
+// first. Removed products are only included on request.
+func (es *EcommerceService) ListCatalog(brandID string, filter CatalogFilter) ([]CatalogProduct, error) {
+	query := `
+		SELECT id, integration_id, external_id, name, COALESCE(description, ''), price, COALESCE(image_url, ''),
+		       COALESCE(status, 'active'), last_synced_at, deleted_at, updated_at
+		FROM products WHERE brand_id = ?
+	`
+	args := []interface{}{brandID}
+	if !filter.IncludeDeleted {
+		query += ` AND deleted_at IS NULL`
+	}
+	if search := strings.TrimSpace(filter.Query); search != "" {
+		pattern := "%" + escapeLike(search) + "%"
+		query += ` AND (name LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\' OR external_id = ?)`
+		args = append(args, pattern, pattern, search)
+	}
+	query += ` ORDER BY updated_at DESC, id LIMIT ? OFFSET ?`
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := es.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list products: %w", err)
+	}
+	defer rows.Close()
+
+	products := []CatalogProduct{}
+	for rows.Next() {
+		product, err := scanCatalogProduct(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list products: %w", err)
+		}
+		products = append(products, *product)
+	}
+
+	return products, rows.Err()
+}
+
+// GetCatalogProduct returns one of the brand's products with its price history,
+// newest price first
+func (es *EcommerceService) GetCatalogProduct(brandID, productID string) (*CatalogProduct, error) {
+	row := es.db.QueryRow(`
+		SELECT id, integration_id, external_id, name, COALESCE(description, ''), price, COALESCE(image_url, ''),
+		       COALESCE(status, 'active'), last_synced_at, deleted_at, updated_at
+		FROM products WHERE id = ? AND brand_id = ?
+	`, productID, brandID)
+	product, err := scanCatalogProduct(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	rows, err := es.db.Query(`
+		SELECT price, recorded_at FROM product_price_history
+		WHERE product_id = ? ORDER BY recorded_at DESC, id DESC LIMIT ?
+	`, productID, priceHistoryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var point PricePoint
+		if err := rows.Scan(&point.Price, &point.RecordedAt); err != nil {
+			return nil, fmt.Errorf("failed to get price history: %w", err)
+		}
+		product.PriceHistory = append(product.PriceHistory, point)
+	}
+
+	return product, rows.Err()
+}
+
+func scanCatalogProduct(row rowScanner) (*CatalogProduct, error) {
+	var product CatalogProduct
+	var lastSyncedAt, deletedAt, updatedAt sql.NullTime
+	err := row.Scan(&product.ID, &product.IntegrationID, &product.ExternalID, &product.Name, &product.Description,
+		&product.Price, &product.ImageURL, &product.Status, &lastSyncedAt, &deletedAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastSyncedAt.Valid {
+		product.LastSyncedAt = &lastSyncedAt.Time
+	}
+	if deletedAt.Valid {
+		product.DeletedAt = &deletedAt.Time
+	}
+	product.UpdatedAt = updatedAt.Time
+	return &product, nil
+}
+
+// escapeLike escapes the LIKE wildcards in a search term
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
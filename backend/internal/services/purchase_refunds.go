@@ -0,0 +1,285 @@
+/**
+ * Purchase Refunds
+ * Ledger of refunds applied to purchases and the purchase statuses derived from it
+ */
+
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"lynkr/internal/ecommerce"
+	"lynkr/pkg/money"
+)
+
+var (
+	ErrPurchaseNotFound = errors.New("purchase not found")
+	ErrInvalidRefund    = errors.New("invalid refund")
+)
+
+// Where a refund was learned from, as stored in purchase_refunds.source
+const (
+	RefundSourceWebhook        = "webhook"
+	RefundSourceReconciliation = "reconciliation"
+	RefundSourceManual         = "manual"
+)
+
+// Revenue queries count purchases that were paid for, including ones refunded
+// later. Gross revenue sums their amounts and net revenue subtracts the
+// refunded amounts. Pending and cancelled purchases are not sales. The sums
+// are in minor units, so queries group them by p.currency and convert them
+// with a reportingConverter. The fragments expect purchases to be aliased as p.
+const (
+	soldPurchaseCondition = `p.status IN ('completed', 'partially_refunded', 'refunded')`
+	grossRevenueSQL       = `COALESCE(SUM(p.amount_minor), 0)`
+	refundsSQL            = `COALESCE(SUM(p.refunded_minor), 0)`
+)
+
+// RecordRefunds applies store refunds to the purchases recorded from an order
+// and returns how many were new. Refunds of orders that were never recorded,
+// for example because the customer is not a Lynkr user, are ignored.
+func (es *EcommerceService) RecordRefunds(integration *Integration, orderID string, refunds []ecommerce.Refund, source string) (int, error) {
+	tx, err := es.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to record refunds: %w", err)
+	}
+	defer tx.Rollback()
+
+	applied, err := applyRefunds(tx, integration, orderID, refunds, source)
+	if err != nil {
+		return 0, err
+	}
+	if err := settleOrderPurchases(tx, integration.ID, orderID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to record refunds: %w", err)
+	}
+	return applied, nil
+}
+
+// RefundPurchase records a refund the brand issued outside a connected store.
+// A zero amount refunds what is left of the purchase.
+func (es *EcommerceService) RefundPurchase(brandID, purchaseID string, amount float64, reason string) (*Purchase, error) {
+	purchase, err := es.getBrandPurchase(brandID, purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	if purchase.Status != "completed" && purchase.Status != "partially_refunded" {
+		return nil, fmt.Errorf("%w: %s purchases cannot be refunded", ErrInvalidRefund, purchase.Status)
+	}
+	remaining := purchase.AmountMinor - purchase.RefundedMinor
+	refundMinor := money.ToMinor(amount, purchase.Currency)
+	if amount == 0 {
+		refundMinor = remaining
+	}
+	if refundMinor <= 0 || refundMinor > remaining {
+		return nil, fmt.Errorf("%w: amount must be between 0 and %v %s", ErrInvalidRefund,
+			money.ToMajor(remaining, purchase.Currency), purchase.Currency)
+	}
+
+	tx, err := es.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to refund purchase: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	_, err = tx.Exec(`
+		INSERT INTO purchase_refunds (purchase_id, external_refund_id, amount_minor, reason, source, refunded_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, purchaseID, fmt.Sprintf("manual_%d", now.UnixNano()), refundMinor, nullIfEmpty(reason), RefundSourceManual, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refund purchase: %w", err)
+	}
+	if err := settlePurchases(tx, `id = ?`, purchaseID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to refund purchase: %w", err)
+	}
+
+	return es.getBrandPurchase(brandID, purchaseID)
+}
+
+// getBrandPurchase loads a purchase of one of the brand's products, events or stores
+func (es *EcommerceService) getBrandPurchase(brandID, purchaseID string) (*Purchase, error) {
+	var purchase Purchase
+	var eventID sql.NullString
+	err := es.db.QueryRow(`
+		SELECT p.id, p.user_id, p.product_id, p.event_id, p.amount_minor, p.refunded_minor, p.currency, p.status, p.created_at
+		FROM purchases p
+		LEFT JOIN products pr ON pr.id = p.product_id
+		LEFT JOIN events e ON e.id = p.event_id
+		LEFT JOIN ecommerce_integrations i ON i.id = p.integration_id
+		WHERE p.id = ? AND (pr.brand_id = ? OR CAST(e.brand_id AS TEXT) = ? OR i.brand_id = ?)
+	`, purchaseID, brandID, brandID, brandID).Scan(
+		&purchase.ID, &purchase.UserID, &purchase.ProductID, &eventID, &purchase.AmountMinor,
+		&purchase.RefundedMinor, &purchase.Currency, &purchase.Status, &purchase.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrPurchaseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get purchase: %w", err)
+	}
+	purchase.EventID = eventID.String
+	purchase.setMajorAmounts()
+	return &purchase, nil
+}
+
+// applyRefunds adds store refunds to the ledger of the order's purchases and
+// returns how many were new. A refund is split over the purchases of the
+// products it lists, in proportion to their refunded line amounts, or over
+// all of the order's purchases when it lists none, such as shipping refunds.
+// Refunds already in the ledger are left alone, so refunds can be applied
+// from both webhooks and reconciliation. Refund amounts are in the order's
+// currency.
+func applyRefunds(tx *sql.Tx, integration *Integration, orderID string, refunds []ecommerce.Refund, source string) (int, error) {
+	if len(refunds) == 0 {
+		return 0, nil
+	}
+
+	rows, err := tx.Query(`
+		SELECT p.id, p.amount_minor, p.currency, COALESCE(pr.external_id, p.product_id)
+		FROM purchases p
+		LEFT JOIN products pr ON pr.id = p.product_id
+		WHERE p.integration_id = ? AND p.external_order_id = ?
+	`, integration.ID, orderID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load order purchases: %w", err)
+	}
+	byProduct := make(map[string]orderPurchase)
+	var purchases []orderPurchase
+	for rows.Next() {
+		var purchase orderPurchase
+		var externalProductID string
+		if err := rows.Scan(&purchase.id, &purchase.amount, &purchase.currency, &externalProductID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to load order purchases: %w", err)
+		}
+		byProduct[externalProductID] = purchase
+		purchases = append(purchases, purchase)
+	}
+	rows.Close()
+	if len(purchases) == 0 {
+		return 0, nil
+	}
+	// The purchases of an order share its currency
+	currency := purchases[0].currency
+
+	applied := 0
+	for _, refund := range refunds {
+		refundMinor := money.ToMinor(refund.Amount, currency)
+		if refund.ID == "" || refundMinor <= 0 {
+			continue
+		}
+
+		// Weights of the purchases the refund is split over, in minor units
+		var weighted []orderPurchase
+		for _, item := range refund.LineItems {
+			if purchase, ok := byProduct[item.ProductID]; ok {
+				weighted = append(weighted, orderPurchase{id: purchase.id, amount: money.ToMinor(item.Amount, currency)})
+			}
+		}
+		if totalWeight(weighted) <= 0 {
+			weighted = purchases
+		}
+
+		refundedAt := refund.CreatedAt.UTC()
+		if refund.CreatedAt.IsZero() {
+			refundedAt = time.Now().UTC()
+		}
+		isNew := false
+		for purchaseID, share := range splitMinor(refundMinor, weighted) {
+			result, err := tx.Exec(`
+				INSERT OR IGNORE INTO purchase_refunds (purchase_id, external_refund_id, amount_minor, reason, source, refunded_at, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, purchaseID, refund.ID, share, nullIfEmpty(refund.Reason), source, refundedAt, time.Now().UTC())
+			if err != nil {
+				return 0, fmt.Errorf("failed to record refund %s: %w", refund.ID, err)
+			}
+			if count, err := result.RowsAffected(); err == nil && count > 0 {
+				isNew = true
+			}
+		}
+		if isNew {
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// settleOrderPurchases updates the refunded amounts and statuses of the
+// purchases recorded from an order
+func settleOrderPurchases(tx *sql.Tx, integrationID, orderID string) error {
+	return settlePurchases(tx, `integration_id = ? AND external_order_id = ?`, integrationID, orderID)
+}
+
+// settlePurchases derives the refunded amount of the matching purchases from
+// the refund ledger, or the full amount when the store reports the order as
+// refunded, and moves paid purchases to partially_refunded or refunded.
+// Pending and cancelled purchases keep their status.
+func settlePurchases(tx *sql.Tx, condition string, args ...interface{}) error {
+	_, err := tx.Exec(`
+		UPDATE purchases SET refunded_minor = MIN(amount_minor, CASE
+			WHEN status = 'refunded' THEN amount_minor
+			ELSE (SELECT COALESCE(SUM(r.amount_minor), 0) FROM purchase_refunds r WHERE r.purchase_id = purchases.id)
+		END)
+		WHERE `+condition, args...)
+	if err != nil {
+		return fmt.Errorf("failed to settle purchase refunds: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE purchases SET status = CASE
+			WHEN status IN ('pending', 'cancelled', 'refunded') THEN status
+			WHEN refunded_minor > 0 AND refunded_minor >= amount_minor THEN 'refunded'
+			WHEN refunded_minor > 0 THEN 'partially_refunded'
+			ELSE 'completed'
+		END
+		WHERE `+condition, args...)
+	if err != nil {
+		return fmt.Errorf("failed to settle purchase status: %w", err)
+	}
+	return nil
+}
+
+// orderPurchase is a purchase of an order that refunds are split over
+type orderPurchase struct {
+	id       string
+	amount   int64
+	currency string
+}
+
+func totalWeight(purchases []orderPurchase) int64 {
+	var total int64
+	for _, purchase := range purchases {
+		total += purchase.amount
+	}
+	return total
+}
+
+// splitMinor splits an amount over purchases in proportion to their amounts.
+// The rounding remainder goes to the last purchase so the shares add up.
+func splitMinor(amount int64, purchases []orderPurchase) map[string]int64 {
+	shares := make(map[string]int64)
+	total := totalWeight(purchases)
+	if total <= 0 {
+		return shares
+	}
+	var assigned int64
+	for i, purchase := range purchases {
+		share := amount * purchase.amount / total
+		if i == len(purchases)-1 {
+			share = amount - assigned
+		}
+		shares[purchase.id] += share
+		assigned += share
+	}
+	return shares
+}
@@ -165,5 +165,14 @@ func (s *UserService) Authenticate(email, password string) (*User, error) {
 		return nil, errors.New("invalid credentials")
 	}
 
+	// Users disabled by an admin cannot log in
+	var disabled bool
+	if err := s.DB.QueryRow(`SELECT disabled_at IS NOT NULL FROM users WHERE id = ?`, user.ID).Scan(&disabled); err != nil {
+		return nil, err
+	}
+	if disabled {
+		return nil, errors.New("account disabled")
+	}
+
 	return user, nil
 }
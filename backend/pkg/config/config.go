@@ -0,0 +1,678 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"lynkr/pkg/mail"
+	"lynkr/pkg/oidc"
+	"lynkr/pkg/secrets"
+	"lynkr/pkg/storage"
+)
+
+// Environment names recognised by the API
+const (
+	EnvDevelopment = "development"
+	EnvStaging     = "staging"
+	EnvProduction  = "production"
+)
+
+// Default secrets used for local development only. Production refuses to start with them.
+const (
+	DefaultJWTSecret      = "brand-activations-secret-key"
+	DefaultAnonymizerSalt = "brand-activations-salt"
+	DefaultDownloadSecret = "brand-activations-download-secret"
+	DefaultMasterKey      = "bHlua3ItZGV2ZWxvcG1lbnQtbWFzdGVyLWtleS0zMmI="
+)
+
+// Config holds all runtime configuration for the API
+type Config struct {
+	Environment string         `json:"environment"`
+	Server      ServerConfig   `json:"server"`
+	Database    DatabaseConfig `json:"database"`
+	Auth        AuthConfig     `json:"auth"`
+	Privacy     PrivacyConfig  `json:"privacy"`
+	Jobs        JobsConfig     `json:"jobs"`
+	Storage     storage.Config `json:"storage"`
+	Exports     ExportsConfig  `json:"exports"`
+	Secrets     SecretsConfig  `json:"secrets"`
+	Currency    CurrencyConfig `json:"currency"`
+	Mail        mail.Config    `json:"mail"`
+	Brands      BrandsConfig   `json:"brands"`
+	SSO         SSOConfig      `json:"sso"`
+}
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	Port               int      `json:"port"`
+	CORSOrigins        []string `json:"corsOrigins"`
+	RateLimitPerMinute int      `json:"rateLimitPerMinute"`
+	ShutdownTimeout    Duration `json:"shutdownTimeout"`
+}
+
+// DatabaseConfig holds database settings
+type DatabaseConfig struct {
+	Path          string `json:"path"`
+	MigrationsDir string `json:"migrationsDir"`
+}
+
+// AuthConfig holds authentication settings
+type AuthConfig struct {
+	JWTSecret       string            `json:"jwtSecret"`       // signing key used when no signing keys are configured
+	SigningKeys     map[string]string `json:"signingKeys"`     // key ID to HS256 secret
+	ActiveKeyID     string            `json:"activeKeyId"`     // key new access tokens are signed with; the others only verify
+	AccessTokenTTL  Duration          `json:"accessTokenTtl"`  // lifetime of access tokens
+	RefreshTokenTTL Duration          `json:"refreshTokenTtl"` // lifetime of refresh tokens, renewed on every refresh
+}
+
+// PrivacyConfig holds anonymization and data retention settings
+type PrivacyConfig struct {
+	AnonymizerSalt    string   `json:"anonymizerSalt"`
+	RetentionInterval Duration `json:"retentionInterval"`
+}
+
+// JobsConfig holds background job queue settings
+type JobsConfig struct {
+	PollInterval Duration       `json:"pollInterval"`
+	Concurrency  map[string]int `json:"concurrency"` // workers per queue
+}
+
+// ExportsConfig holds settings for export files and their download links
+type ExportsConfig struct {
+	DownloadSecret  string   `json:"downloadSecret"`  // signs download links
+	PublicBaseURL   string   `json:"publicBaseUrl"`   // origin used in download links
+	DownloadLinkTTL Duration `json:"downloadLinkTtl"` // lifetime of a single download link
+	CleanupInterval Duration `json:"cleanupInterval"` // how often expired files are removed
+	SFTPDropDir     string   `json:"sftpDropDir"`     // where the SFTP delivery stand-in writes files
+}
+
+// SecretsConfig holds the master keys that encrypt stored integration credentials
+type SecretsConfig struct {
+	MasterKeys  map[string]string `json:"masterKeys"`  // key ID to base64 encoded 256 bit key
+	ActiveKeyID string            `json:"activeKeyId"` // key new values are encrypted with; the others only decrypt
+}
+
+// BrandsConfig holds settings for brand accounts and their members
+type BrandsConfig struct {
+	PortalURL     string   `json:"portalUrl"`     // origin of the brand portal, used in invitation links
+	InvitationTTL Duration `json:"invitationTtl"` // how long an invitation can be accepted
+	APIKeyTTL     Duration `json:"apiKeyTtl"`     // lifetime of API keys created without an expiry
+	APIKeyMaxTTL  Duration `json:"apiKeyMaxTtl"`  // longest lifetime an API key can be created with
+}
+
+// SSOConfig connects brand logins to an OpenID Connect provider. An empty
+// issuer turns single sign-on off.
+type SSOConfig struct {
+	Issuer               string `json:"issuer"`
+	ClientID             string `json:"clientId"`
+	ClientSecret         string `json:"clientSecret"`         // empty for a public client, which relies on PKCE alone
+	RedirectURL          string `json:"redirectUrl"`          // the API's callback, e.g. http://localhost:8080/api/v1/brands/sso/callback
+	AllowUnverifiedEmail bool   `json:"allowUnverifiedEmail"` // trust emails the provider does not mark as verified
+}
+
+// CurrencyConfig controls the exchange rates analytics convert money with
+type CurrencyConfig struct {
+	RatesFile string `json:"ratesFile"` // JSON exchange rate table loaded on start; empty keeps the stored rates
+}
+
+// Duration wraps time.Duration so it can be written as "24h" in config files
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON accepts either a duration string or a number of seconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	switch v := raw.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		d.Duration = parsed
+	case float64:
+		d.Duration = time.Duration(v) * time.Second
+	default:
+		return fmt.Errorf("invalid duration: %s", string(data))
+	}
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Default returns the development configuration
+func Default() *Config {
+	return &Config{
+		Environment: EnvDevelopment,
+		Server: ServerConfig{
+			Port:               8080,
+			CORSOrigins:        []string{"http://localhost:8081", "http://localhost:3000"},
+			RateLimitPerMinute: 100,
+			ShutdownTimeout:    Duration{30 * time.Second},
+		},
+		Database: DatabaseConfig{
+			Path: "./data/brand_activations.db",
+		},
+		Auth: AuthConfig{
+			JWTSecret:       DefaultJWTSecret,
+			AccessTokenTTL:  Duration{15 * time.Minute},
+			RefreshTokenTTL: Duration{30 * 24 * time.Hour},
+		},
+		Privacy: PrivacyConfig{
+			AnonymizerSalt:    DefaultAnonymizerSalt,
+			RetentionInterval: Duration{24 * time.Hour},
+		},
+		Jobs: JobsConfig{
+			PollInterval: Duration{time.Second},
+			Concurrency:  map[string]int{"exports": 2, "crm": 2, "ai": 4, "ecommerce": 2},
+		},
+		Storage: storage.Config{
+			Backend: "local",
+			Local:   storage.LocalConfig{Dir: "./data/exports"},
+		},
+		Exports: ExportsConfig{
+			DownloadSecret:  DefaultDownloadSecret,
+			PublicBaseURL:   "http://localhost:8080",
+			DownloadLinkTTL: Duration{time.Hour},
+			CleanupInterval: Duration{time.Hour},
+			SFTPDropDir:     "./data/sftp",
+		},
+		Secrets: SecretsConfig{
+			MasterKeys:  map[string]string{"dev": DefaultMasterKey},
+			ActiveKeyID: "dev",
+		},
+		Mail: mail.Config{
+			Backend: "dir",
+			From:    "Lynkr <no-reply@localhost>",
+			Dir:     "./data/mail",
+		},
+		Brands: BrandsConfig{
+			PortalURL:     "http://localhost:3000",
+			InvitationTTL: Duration{7 * 24 * time.Hour},
+			APIKeyTTL:     Duration{90 * 24 * time.Hour},
+			APIKeyMaxTTL:  Duration{365 * 24 * time.Hour},
+		},
+	}
+}
+
+// Load builds the configuration from defaults, then a JSON config file, then
+// LYNKR_* environment variables and finally command line flags. Later layers win.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("lynkr", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("LYNKR_CONFIG"), "path to a JSON config file")
+	env := fs.String("env", "", "environment (development, staging, production)")
+	port := fs.Int("port", 0, "HTTP port")
+	dbPath := fs.String("db", "", "SQLite database path")
+	migrationsDir := fs.String("migrations", "", "migrations directory to apply on start")
+	corsOrigins := fs.String("cors-origins", "", "comma separated list of allowed CORS origins")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	// Only flags given explicitly override the earlier layers
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "env":
+			cfg.Environment = *env
+		case "port":
+			cfg.Server.Port = *port
+		case "db":
+			cfg.Database.Path = *dbPath
+		case "migrations":
+			cfg.Database.MigrationsDir = *migrationsDir
+		case "cors-origins":
+			cfg.Server.CORSOrigins = splitList(*corsOrigins)
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadFile overlays values from a JSON config file
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// Master keys in the file replace the development key instead of merging with it
+	masterKeys := c.Secrets.MasterKeys
+	c.Secrets.MasterKeys = nil
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if c.Secrets.MasterKeys == nil {
+		c.Secrets.MasterKeys = masterKeys
+	}
+
+	return nil
+}
+
+// loadEnv overlays values from LYNKR_* environment variables
+func (c *Config) loadEnv() error {
+	if v, ok := os.LookupEnv("LYNKR_ENV"); ok {
+		c.Environment = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_PORT"); ok {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_PORT: %w", err)
+		}
+		c.Server.Port = port
+	}
+	if v, ok := os.LookupEnv("LYNKR_CORS_ORIGINS"); ok {
+		c.Server.CORSOrigins = splitList(v)
+	}
+	if v, ok := os.LookupEnv("LYNKR_RATE_LIMIT_PER_MINUTE"); ok {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_RATE_LIMIT_PER_MINUTE: %w", err)
+		}
+		c.Server.RateLimitPerMinute = limit
+	}
+	if v, ok := os.LookupEnv("LYNKR_SHUTDOWN_TIMEOUT"); ok {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_SHUTDOWN_TIMEOUT: %w", err)
+		}
+		c.Server.ShutdownTimeout = Duration{timeout}
+	}
+	if v, ok := os.LookupEnv("LYNKR_DB_PATH"); ok {
+		c.Database.Path = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_MIGRATIONS_DIR"); ok {
+		c.Database.MigrationsDir = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_JWT_SECRET"); ok {
+		c.Auth.JWTSecret = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_JWT_SIGNING_KEYS"); ok {
+		keys, err := parseKeyList(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_JWT_SIGNING_KEYS: %w", err)
+		}
+		c.Auth.SigningKeys = keys
+	}
+	if v, ok := os.LookupEnv("LYNKR_JWT_KEY_ID"); ok {
+		c.Auth.ActiveKeyID = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_ACCESS_TOKEN_TTL"); ok {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_ACCESS_TOKEN_TTL: %w", err)
+		}
+		c.Auth.AccessTokenTTL = Duration{ttl}
+	}
+	if v, ok := os.LookupEnv("LYNKR_REFRESH_TOKEN_TTL"); ok {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_REFRESH_TOKEN_TTL: %w", err)
+		}
+		c.Auth.RefreshTokenTTL = Duration{ttl}
+	}
+	if v, ok := os.LookupEnv("LYNKR_ANONYMIZER_SALT"); ok {
+		c.Privacy.AnonymizerSalt = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_JOB_POLL_INTERVAL"); ok {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_JOB_POLL_INTERVAL: %w", err)
+		}
+		c.Jobs.PollInterval = Duration{interval}
+	}
+	if v, ok := os.LookupEnv("LYNKR_RETENTION_INTERVAL"); ok {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_RETENTION_INTERVAL: %w", err)
+		}
+		c.Privacy.RetentionInterval = Duration{interval}
+	}
+	if v, ok := os.LookupEnv("LYNKR_STORAGE_BACKEND"); ok {
+		c.Storage.Backend = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_STORAGE_DIR"); ok {
+		c.Storage.Local.Dir = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_S3_ENDPOINT"); ok {
+		c.Storage.S3.Endpoint = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_S3_REGION"); ok {
+		c.Storage.S3.Region = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_S3_BUCKET"); ok {
+		c.Storage.S3.Bucket = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_S3_ACCESS_KEY_ID"); ok {
+		c.Storage.S3.AccessKeyID = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_S3_SECRET_ACCESS_KEY"); ok {
+		c.Storage.S3.SecretAccessKey = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_S3_PATH_STYLE"); ok {
+		pathStyle, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_S3_PATH_STYLE: %w", err)
+		}
+		c.Storage.S3.PathStyle = pathStyle
+	}
+	if v, ok := os.LookupEnv("LYNKR_DOWNLOAD_SECRET"); ok {
+		c.Exports.DownloadSecret = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_PUBLIC_BASE_URL"); ok {
+		c.Exports.PublicBaseURL = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_SFTP_DROP_DIR"); ok {
+		c.Exports.SFTPDropDir = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_DOWNLOAD_LINK_TTL"); ok {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_DOWNLOAD_LINK_TTL: %w", err)
+		}
+		c.Exports.DownloadLinkTTL = Duration{ttl}
+	}
+	if v, ok := os.LookupEnv("LYNKR_MASTER_KEYS"); ok {
+		keys, err := parseKeyList(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_MASTER_KEYS: %w", err)
+		}
+		c.Secrets.MasterKeys = keys
+	}
+	if v, ok := os.LookupEnv("LYNKR_MASTER_KEY_ID"); ok {
+		c.Secrets.ActiveKeyID = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_EXCHANGE_RATES_FILE"); ok {
+		c.Currency.RatesFile = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_MAIL_BACKEND"); ok {
+		c.Mail.Backend = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_MAIL_FROM"); ok {
+		c.Mail.From = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_MAIL_DIR"); ok {
+		c.Mail.Dir = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_SMTP_HOST"); ok {
+		c.Mail.SMTP.Host = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_SMTP_PORT"); ok {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_SMTP_PORT: %w", err)
+		}
+		c.Mail.SMTP.Port = port
+	}
+	if v, ok := os.LookupEnv("LYNKR_SMTP_USERNAME"); ok {
+		c.Mail.SMTP.Username = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_SMTP_PASSWORD"); ok {
+		c.Mail.SMTP.Password = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_BRAND_PORTAL_URL"); ok {
+		c.Brands.PortalURL = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_INVITATION_TTL"); ok {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_INVITATION_TTL: %w", err)
+		}
+		c.Brands.InvitationTTL = Duration{ttl}
+	}
+	if v, ok := os.LookupEnv("LYNKR_SSO_ISSUER"); ok {
+		c.SSO.Issuer = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_SSO_CLIENT_ID"); ok {
+		c.SSO.ClientID = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_SSO_CLIENT_SECRET"); ok {
+		c.SSO.ClientSecret = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_SSO_REDIRECT_URL"); ok {
+		c.SSO.RedirectURL = v
+	}
+	if v, ok := os.LookupEnv("LYNKR_API_KEY_TTL"); ok {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_API_KEY_TTL: %w", err)
+		}
+		c.Brands.APIKeyTTL = Duration{ttl}
+	}
+	if v, ok := os.LookupEnv("LYNKR_API_KEY_MAX_TTL"); ok {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid LYNKR_API_KEY_MAX_TTL: %w", err)
+		}
+		c.Brands.APIKeyMaxTTL = Duration{ttl}
+	}
+	return nil
+}
+
+// Validate checks the configuration and rejects development secrets in production
+func (c *Config) Validate() error {
+	var problems []string
+
+	switch c.Environment {
+	case EnvDevelopment, EnvStaging, EnvProduction:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown environment %q", c.Environment))
+	}
+
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("invalid port %d", c.Server.Port))
+	}
+	if c.Server.RateLimitPerMinute <= 0 {
+		problems = append(problems, "rate limit must be positive")
+	}
+	if c.Server.ShutdownTimeout.Duration <= 0 {
+		problems = append(problems, "shutdown timeout must be positive")
+	}
+	if c.Database.Path == "" {
+		problems = append(problems, "database path is required")
+	}
+	signingKeys, activeKeyID := c.SigningKeys()
+	if len(signingKeys) == 0 {
+		problems = append(problems, "JWT secret or signing keys are required")
+	} else if _, ok := signingKeys[activeKeyID]; !ok {
+		problems = append(problems, fmt.Sprintf("active signing key %q is not configured", activeKeyID))
+	}
+	if c.Auth.AccessTokenTTL.Duration <= 0 {
+		problems = append(problems, "access token TTL must be positive")
+	}
+	if c.Auth.RefreshTokenTTL.Duration <= c.Auth.AccessTokenTTL.Duration {
+		problems = append(problems, "refresh token TTL must be longer than the access token TTL")
+	}
+	if c.Privacy.AnonymizerSalt == "" {
+		problems = append(problems, "anonymizer salt is required")
+	}
+	if c.Privacy.RetentionInterval.Duration <= 0 {
+		problems = append(problems, "retention interval must be positive")
+	}
+
+	if c.Jobs.PollInterval.Duration <= 0 {
+		problems = append(problems, "job poll interval must be positive")
+	}
+	for queue, workers := range c.Jobs.Concurrency {
+		if workers <= 0 {
+			problems = append(problems, fmt.Sprintf("job queue %s needs at least one worker", queue))
+		}
+	}
+
+	switch c.Storage.Backend {
+	case "local":
+		if c.Storage.Local.Dir == "" {
+			problems = append(problems, "local storage directory is required")
+		}
+	case "s3":
+		if c.Storage.S3.Bucket == "" {
+			problems = append(problems, "S3 bucket is required")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown storage backend %q", c.Storage.Backend))
+	}
+	if c.Exports.DownloadSecret == "" {
+		problems = append(problems, "download secret is required")
+	}
+	if c.Exports.PublicBaseURL == "" {
+		problems = append(problems, "public base URL is required")
+	}
+	if c.Exports.DownloadLinkTTL.Duration <= 0 {
+		problems = append(problems, "download link TTL must be positive")
+	}
+	if c.Exports.CleanupInterval.Duration <= 0 {
+		problems = append(problems, "export cleanup interval must be positive")
+	}
+	if _, err := c.Keyring(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	switch c.Mail.Backend {
+	case "dir":
+		if c.Mail.Dir == "" {
+			problems = append(problems, "mail directory is required")
+		}
+	case "smtp":
+		if c.Mail.SMTP.Host == "" {
+			problems = append(problems, "SMTP host is required")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown mail backend %q", c.Mail.Backend))
+	}
+	if c.Mail.From == "" {
+		problems = append(problems, "mail sender address is required")
+	}
+	if c.Brands.PortalURL == "" {
+		problems = append(problems, "brand portal URL is required")
+	}
+	if c.Brands.InvitationTTL.Duration <= 0 {
+		problems = append(problems, "invitation TTL must be positive")
+	}
+	if c.Brands.APIKeyTTL.Duration <= 0 || c.Brands.APIKeyMaxTTL.Duration < c.Brands.APIKeyTTL.Duration {
+		problems = append(problems, "API key TTL must be positive and no longer than the maximum API key TTL")
+	}
+	if _, err := c.SSOProvider(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if c.IsProduction() {
+		for id, key := range signingKeys {
+			if key == DefaultJWTSecret {
+				problems = append(problems, fmt.Sprintf("default JWT secret must not be used in production (key %q)", id))
+			} else if len(key) < 32 {
+				problems = append(problems, fmt.Sprintf("JWT signing key %q must be at least 32 characters in production", id))
+			}
+		}
+		if c.Privacy.AnonymizerSalt == DefaultAnonymizerSalt {
+			problems = append(problems, "default anonymizer salt must not be used in production")
+		}
+		if c.Exports.DownloadSecret == DefaultDownloadSecret {
+			problems = append(problems, "default download secret must not be used in production")
+		}
+		for id, key := range c.Secrets.MasterKeys {
+			if key == DefaultMasterKey {
+				problems = append(problems, fmt.Sprintf("default master key %q must not be used in production", id))
+			}
+		}
+		if c.SSO.Issuer != "" && !strings.HasPrefix(c.SSO.Issuer, "https://") {
+			problems = append(problems, "SSO issuer must use https in production")
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// IsProduction reports whether the API is running in production mode
+func (c *Config) IsProduction() bool {
+	return c.Environment == EnvProduction
+}
+
+// Keyring builds the keyring that encrypts stored credentials
+func (c *Config) Keyring() (*secrets.Keyring, error) {
+	return secrets.NewKeyring(c.Secrets.MasterKeys, c.Secrets.ActiveKeyID)
+}
+
+// SSOProvider builds the OpenID Connect provider of brand logins, or returns
+// nil when single sign-on is off
+func (c *Config) SSOProvider() (*oidc.Provider, error) {
+	if c.SSO.Issuer == "" {
+		return nil, nil
+	}
+	return oidc.New(oidc.Config{
+		Issuer:       c.SSO.Issuer,
+		ClientID:     c.SSO.ClientID,
+		ClientSecret: c.SSO.ClientSecret,
+		RedirectURL:  c.SSO.RedirectURL,
+	})
+}
+
+// SigningKeys returns the JWT signing keys and the active key ID. Without
+// configured signing keys the JWT secret is used as the single key "default".
+func (c *Config) SigningKeys() (map[string]string, string) {
+	if len(c.Auth.SigningKeys) > 0 {
+		return c.Auth.SigningKeys, c.Auth.ActiveKeyID
+	}
+	if c.Auth.JWTSecret == "" {
+		return nil, ""
+	}
+	return map[string]string{"default": c.Auth.JWTSecret}, "default"
+}
+
+// Addr returns the listen address for the HTTP server
+func (c *Config) Addr() string {
+	return fmt.Sprintf(":%d", c.Server.Port)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseKeyList parses "id:key,id:key" key lists, such as master and signing keys
+func parseKeyList(value string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, item := range splitList(value) {
+		id, key, ok := strings.Cut(item, ":")
+		if !ok || id == "" || key == "" {
+			return nil, fmt.Errorf("expected id:key, got %q", item)
+		}
+		keys[strings.TrimSpace(id)] = strings.TrimSpace(key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,313 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"lynkr/pkg/secrets"
+)
+
+// clearEnv unsets the LYNKR_* variables of the test process for one test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		if strings.HasPrefix(name, "LYNKR_") {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func writeConfigFile(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lynkr.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	file := writeConfigFile(t, `{
+		"server": {"port": 9000, "rateLimitPerMinute": 50, "shutdownTimeout": "10s"},
+		"database": {"path": "/var/lib/lynkr/file.db"},
+		"auth": {"accessTokenTtl": 600}
+	}`)
+
+	tests := []struct {
+		name      string
+		env       map[string]string
+		args      []string
+		wantPort  int
+		wantDB    string
+		wantLimit int
+		wantCORS  []string
+	}{
+		{
+			name:      "defaults",
+			wantPort:  8080,
+			wantDB:    "./data/brand_activations.db",
+			wantLimit: 100,
+			wantCORS:  []string{"http://localhost:8081", "http://localhost:3000"},
+		},
+		{
+			name:      "file over defaults",
+			args:      []string{"-config", file},
+			wantPort:  9000,
+			wantDB:    "/var/lib/lynkr/file.db",
+			wantLimit: 50,
+			wantCORS:  []string{"http://localhost:8081", "http://localhost:3000"},
+		},
+		{
+			name:      "file named by LYNKR_CONFIG",
+			env:       map[string]string{"LYNKR_CONFIG": file},
+			wantPort:  9000,
+			wantDB:    "/var/lib/lynkr/file.db",
+			wantLimit: 50,
+			wantCORS:  []string{"http://localhost:8081", "http://localhost:3000"},
+		},
+		{
+			name:      "environment over file",
+			env:       map[string]string{"LYNKR_PORT": "9100", "LYNKR_DB_PATH": "/tmp/env.db", "LYNKR_CORS_ORIGINS": "https://a.test, https://b.test"},
+			args:      []string{"-config", file},
+			wantPort:  9100,
+			wantDB:    "/tmp/env.db",
+			wantLimit: 50,
+			wantCORS:  []string{"https://a.test", "https://b.test"},
+		},
+		{
+			name:      "flags over environment",
+			env:       map[string]string{"LYNKR_PORT": "9100", "LYNKR_DB_PATH": "/tmp/env.db"},
+			args:      []string{"-config", file, "-port", "9200", "-cors-origins", "https://flag.test"},
+			wantPort:  9200,
+			wantDB:    "/tmp/env.db",
+			wantLimit: 50,
+			wantCORS:  []string{"https://flag.test"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := Load(tt.args)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Server.Port != tt.wantPort || cfg.Database.Path != tt.wantDB || cfg.Server.RateLimitPerMinute != tt.wantLimit {
+				t.Errorf("port %d, database %q, rate limit %d; want %d, %q, %d",
+					cfg.Server.Port, cfg.Database.Path, cfg.Server.RateLimitPerMinute, tt.wantPort, tt.wantDB, tt.wantLimit)
+			}
+			if !reflect.DeepEqual(cfg.Server.CORSOrigins, tt.wantCORS) {
+				t.Errorf("CORS origins = %v, want %v", cfg.Server.CORSOrigins, tt.wantCORS)
+			}
+		})
+	}
+}
+
+func TestLoadFileKeepsUnsetValues(t *testing.T) {
+	clearEnv(t)
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	file := writeConfigFile(t, `{
+		"auth": {"accessTokenTtl": 600, "refreshTokenTtl": "48h"},
+		"secrets": {"masterKeys": {"prod": "`+key+`"}, "activeKeyId": "prod"}
+	}`)
+
+	cfg, err := Load([]string{"-config", file})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Auth.AccessTokenTTL.Duration != 10*time.Minute || cfg.Auth.RefreshTokenTTL.Duration != 48*time.Hour {
+		t.Errorf("token TTLs = %v and %v, want 10m and 48h", cfg.Auth.AccessTokenTTL, cfg.Auth.RefreshTokenTTL)
+	}
+	if cfg.Auth.JWTSecret != DefaultJWTSecret || cfg.Jobs.Concurrency["exports"] != 2 {
+		t.Error("values the file does not set were not kept")
+	}
+	// The file's master keys replace the development key
+	if !reflect.DeepEqual(cfg.Secrets.MasterKeys, map[string]string{"prod": key}) {
+		t.Errorf("master keys = %v, want only the file's", cfg.Secrets.MasterKeys)
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+	}{
+		{name: "port not a number", env: map[string]string{"LYNKR_PORT": "http"}},
+		{name: "invalid duration", env: map[string]string{"LYNKR_ACCESS_TOKEN_TTL": "15"}},
+		{name: "invalid key list", env: map[string]string{"LYNKR_MASTER_KEYS": "no-separator"}},
+		{name: "unknown environment", args: []string{"-env", "prod"}},
+		{name: "port out of range", args: []string{"-port", "70000"}},
+		{name: "unknown flag", args: []string{"-verbose"}},
+		{name: "missing config file", args: []string{"-config", "/nonexistent/lynkr.json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			if _, err := Load(tt.args); err == nil {
+				t.Error("Load succeeded")
+			}
+		})
+	}
+}
+
+// productionConfig returns a production configuration without development secrets
+func productionConfig(t *testing.T) *Config {
+	t.Helper()
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	cfg := Default()
+	cfg.Environment = EnvProduction
+	cfg.Auth.JWTSecret = strings.Repeat("j", 32)
+	cfg.Privacy.AnonymizerSalt = "production salt"
+	cfg.Exports.DownloadSecret = "production download secret"
+	cfg.Secrets.MasterKeys = map[string]string{"prod": key}
+	cfg.Secrets.ActiveKeyID = "prod"
+	return cfg
+}
+
+func TestValidateProduction(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(cfg *Config)
+		wantErr string
+	}{
+		{name: "no development secrets", change: func(cfg *Config) {}},
+		{name: "default JWT secret", change: func(cfg *Config) { cfg.Auth.JWTSecret = DefaultJWTSecret }, wantErr: "default JWT secret"},
+		{name: "short JWT secret", change: func(cfg *Config) { cfg.Auth.JWTSecret = strings.Repeat("j", 31) }, wantErr: "at least 32 characters"},
+		{
+			name: "short retired signing key",
+			change: func(cfg *Config) {
+				cfg.Auth.SigningKeys = map[string]string{"old": "short", "new": strings.Repeat("n", 32)}
+				cfg.Auth.ActiveKeyID = "new"
+			},
+			wantErr: `JWT signing key "old"`,
+		},
+		{name: "default anonymizer salt", change: func(cfg *Config) { cfg.Privacy.AnonymizerSalt = DefaultAnonymizerSalt }, wantErr: "default anonymizer salt"},
+		{name: "default download secret", change: func(cfg *Config) { cfg.Exports.DownloadSecret = DefaultDownloadSecret }, wantErr: "default download secret"},
+		{name: "default master key", change: func(cfg *Config) { cfg.Secrets.MasterKeys["dev"] = DefaultMasterKey }, wantErr: "default master key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := productionConfig(t)
+			tt.change(cfg)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate = %v, want an error about %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAllowsDevelopmentSecretsOutsideProduction(t *testing.T) {
+	for _, environment := range []string{EnvDevelopment, EnvStaging} {
+		cfg := Default()
+		cfg.Environment = environment
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validate in %s: %v", environment, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(cfg *Config)
+	}{
+		{name: "no JWT secret", change: func(cfg *Config) { cfg.Auth.JWTSecret = "" }},
+		{name: "active signing key missing", change: func(cfg *Config) {
+			cfg.Auth.SigningKeys = map[string]string{"k1": strings.Repeat("k", 32)}
+			cfg.Auth.ActiveKeyID = "k2"
+		}},
+		{name: "refresh tokens shorter than access tokens", change: func(cfg *Config) { cfg.Auth.RefreshTokenTTL = Duration{time.Minute} }},
+		{name: "queue without workers", change: func(cfg *Config) { cfg.Jobs.Concurrency["exports"] = 0 }},
+		{name: "S3 without a bucket", change: func(cfg *Config) { cfg.Storage.Backend = "s3" }},
+		{name: "unknown mail backend", change: func(cfg *Config) { cfg.Mail.Backend = "carrier-pigeon" }},
+		{name: "active master key missing", change: func(cfg *Config) { cfg.Secrets.ActiveKeyID = "prod" }},
+		{name: "API key TTL beyond the maximum", change: func(cfg *Config) { cfg.Brands.APIKeyTTL = Duration{400 * 24 * time.Hour} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(cfg)
+			if err := cfg.Validate(); err == nil {
+				t.Error("Validate succeeded")
+			}
+		})
+	}
+}
+
+func TestSigningKeys(t *testing.T) {
+	cfg := Default()
+	if keys, active := cfg.SigningKeys(); !reflect.DeepEqual(keys, map[string]string{"default": DefaultJWTSecret}) || active != "default" {
+		t.Errorf("SigningKeys = %v, %q; want the JWT secret as key default", keys, active)
+	}
+
+	cfg.Auth.SigningKeys = map[string]string{"k1": "one", "k2": "two"}
+	cfg.Auth.ActiveKeyID = "k2"
+	if keys, active := cfg.SigningKeys(); len(keys) != 2 || active != "k2" {
+		t.Errorf("SigningKeys = %v, %q; want the configured keys", keys, active)
+	}
+}
+
+func TestDurationUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    time.Duration
+		wantErr bool
+	}{
+		{json: `"90m"`, want: 90 * time.Minute},
+		{json: `3600`, want: time.Hour},
+		{json: `"an hour"`, wantErr: true},
+		{json: `true`, wantErr: true},
+	}
+	for _, tt := range tests {
+		var d Duration
+		err := d.UnmarshalJSON([]byte(tt.json))
+		if (err != nil) != tt.wantErr || (!tt.wantErr && d.Duration != tt.want) {
+			t.Errorf("UnmarshalJSON(%s) = %v, %v; want %v", tt.json, d.Duration, err, tt.want)
+		}
+	}
+}
+
+func TestParseKeyList(t *testing.T) {
+	keys, err := parseKeyList(" k1:one , k2:two:with:colons ,")
+	if err != nil {
+		t.Fatalf("parseKeyList: %v", err)
+	}
+	if want := map[string]string{"k1": "one", "k2": "two:with:colons"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("parseKeyList = %v, want %v", keys, want)
+	}
+	for _, value := range []string{"k1", ":one", "k1:"} {
+		if _, err := parseKeyList(value); err == nil {
+			t.Errorf("parseKeyList(%q) succeeded", value)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "0 9 * * 1"},
+		{expr: "*/15 * * * *"},
+		{expr: "5/20 8-18 1,15 jan-jun mon-fri"},
+		{expr: "0 0 * * 7"},
+		{expr: "  @Weekly "},
+		{expr: "0 0 ? * ?"},
+		{expr: "0 9 * *", wantErr: true},
+		{expr: "0 9 * * * *", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* 24 * * *", wantErr: true},
+		{expr: "* * 0 * *", wantErr: true},
+		{expr: "* * * 13 *", wantErr: true},
+		{expr: "* * * * 8", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "*/x * * * *", wantErr: true},
+		{expr: "30-10 * * * *", wantErr: true},
+		{expr: "* * * foo *", wantErr: true},
+		{expr: "@fortnightly", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) err = %v, want error: %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatalf("invalid time %q: %v", value, err)
+		}
+		return parsed
+	}
+
+	// 2024-01-31 is a Wednesday
+	tests := []struct {
+		name  string
+		expr  string
+		after string
+		want  string
+	}{
+		{name: "later the same day", expr: "0 9 * * *", after: "2024-01-31 08:00", want: "2024-01-31 09:00"},
+		{name: "strictly after", expr: "0 9 * * *", after: "2024-01-31 09:00", want: "2024-02-01 09:00"},
+		{name: "seconds are dropped", expr: "* * * * *", after: "2024-01-31 09:00", want: "2024-01-31 09:01"},
+		{name: "step", expr: "*/20 * * * *", after: "2024-01-31 09:41", want: "2024-01-31 10:00"},
+		{name: "step from an offset", expr: "5/20 * * * *", after: "2024-01-31 09:26", want: "2024-01-31 09:45"},
+		{name: "stepped range", expr: "0 8-18/4 * * *", after: "2024-01-31 12:30", want: "2024-01-31 16:00"},
+		{name: "range ends for the day", expr: "0 8-18/4 * * *", after: "2024-01-31 16:30", want: "2024-02-01 08:00"},
+		{name: "list", expr: "0 0 1,15 * *", after: "2024-01-10 00:00", want: "2024-01-15 00:00"},
+		{name: "month rollover", expr: "0 0 1,15 * *", after: "2024-01-31 12:00", want: "2024-02-01 00:00"},
+		{name: "year rollover", expr: "30 23 31 12 *", after: "2024-12-31 23:30", want: "2025-12-31 23:30"},
+		{name: "months without the day are skipped", expr: "0 0 31 * *", after: "2024-01-31 12:00", want: "2024-03-31 00:00"},
+		{name: "leap day", expr: "0 0 29 2 *", after: "2024-03-01 00:00", want: "2028-02-29 00:00"},
+		{name: "day-of-week", expr: "0 9 * * mon", after: "2024-01-31 09:00", want: "2024-02-05 09:00"},
+		{name: "7 is Sunday", expr: "0 9 * * 7", after: "2024-01-31 09:00", want: "2024-02-04 09:00"},
+		{name: "weekdays", expr: "0 9 * * 1-5", after: "2024-02-02 10:00", want: "2024-02-05 09:00"},
+		{name: "day-of-month or day-of-week", expr: "0 0 13 * fri", after: "2024-02-01 00:00", want: "2024-02-02 00:00"},
+		{name: "day-of-month when it comes first", expr: "0 0 13 * fri", after: "2024-02-10 00:00", want: "2024-02-13 00:00"},
+		{name: "day-of-month with any weekday", expr: "0 0 13 * *", after: "2024-02-01 00:00", want: "2024-02-13 00:00"},
+		{name: "named months", expr: "0 0 1 jan,jul *", after: "2024-01-31 00:00", want: "2024-07-01 00:00"},
+		{name: "monthly macro", expr: "@monthly", after: "2024-01-31 12:00", want: "2024-02-01 00:00"},
+		{name: "weekly macro", expr: "@weekly", after: "2024-01-31 12:00", want: "2024-02-04 00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := schedule.Next(at(tt.after)); !got.Equal(at(tt.want)) {
+				t.Errorf("Next(%s) = %s, want %s", tt.after, got.Format("2006-01-02 15:04 Mon"), tt.want)
+			}
+		})
+	}
+}
+
+func TestNextNeverMatches(t *testing.T) {
+	schedule, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := schedule.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next = %s, want the zero time for February 30th", got)
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	schedule, err := Parse("0 9 * * *")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	got := schedule.Next(time.Date(2024, 3, 30, 12, 0, 0, 0, berlin))
+	if want := time.Date(2024, 3, 31, 9, 0, 0, 0, berlin); !got.Equal(want) || got.Location() != berlin {
+		t.Errorf("Next = %s, want 09:00 Berlin time across the DST change", got)
+	}
+}
@@ -0,0 +1,307 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ColumnType is the logical type of a column
+type ColumnType int
+
+const (
+	TypeString ColumnType = iota
+	TypeInt
+	TypeFloat
+	TypeBool
+	TypeTime
+)
+
+// String returns the type name used in manifests
+func (t ColumnType) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeInt:
+		return "int"
+	case TypeFloat:
+		return "float"
+	case TypeBool:
+		return "bool"
+	case TypeTime:
+		return "time"
+	default:
+		return "unknown"
+	}
+}
+
+// Column describes one column of a dataset
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Schema describes the columns of a dataset in output order
+type Schema struct {
+	Name    string
+	Columns []Column
+}
+
+// Row holds one value per schema column, in schema order. Values must have the
+// Go type of their column (string, int64, float64, bool or time.Time) or be nil.
+type Row []interface{}
+
+// Writer streams rows into a file format
+type Writer interface {
+	WriteRow(row Row) error
+	// Close finishes the file. It does not close the underlying io.Writer.
+	Close() error
+}
+
+// Format is an export file format
+type Format struct {
+	ID          string
+	Name        string
+	Description string
+	Extension   string
+	ContentType string
+	NewWriter   func(w io.Writer, schema Schema) (Writer, error)
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   []Format
+)
+
+// Built-in formats, listed in this order by Formats
+func init() {
+	Register(Format{
+		ID:          "csv",
+		Name:        "CSV",
+		Description: "Comma-separated values",
+		Extension:   "csv",
+		ContentType: "text/csv; charset=utf-8",
+		NewWriter:   newCSVWriter,
+	})
+	Register(Format{
+		ID:          "json",
+		Name:        "JSON",
+		Description: "JavaScript Object Notation",
+		Extension:   "json",
+		ContentType: "application/json",
+		NewWriter:   newJSONWriter,
+	})
+	Register(Format{
+		ID:          "ndjson",
+		Name:        "NDJSON",
+		Description: "Newline-delimited JSON, one record per line",
+		Extension:   "ndjson",
+		ContentType: "application/x-ndjson",
+		NewWriter:   newNDJSONWriter,
+	})
+	Register(Format{
+		ID:          "xlsx",
+		Name:        "Excel",
+		Description: "Excel workbook",
+		Extension:   "xlsx",
+		ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		NewWriter:   newXLSXWriter,
+	})
+	Register(Format{
+		ID:          "parquet",
+		Name:        "Parquet",
+		Description: "Apache Parquet columnar file for data warehouses",
+		Extension:   "parquet",
+		ContentType: "application/vnd.apache.parquet",
+		NewWriter:   newParquetWriter,
+	})
+}
+
+// Register makes a format available for exports. It panics if the ID is taken.
+func Register(format Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	for _, existing := range formats {
+		if existing.ID == format.ID {
+			panic("export: format registered twice: " + format.ID)
+		}
+	}
+	formats = append(formats, format)
+}
+
+// Lookup returns the registered format with the given ID
+func Lookup(id string) (Format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	for _, format := range formats {
+		if format.ID == id {
+			return format, true
+		}
+	}
+	return Format{}, false
+}
+
+// Formats returns all registered formats in registration order
+func Formats() []Format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	return append([]Format(nil), formats...)
+}
+
+// Convert coerces a value read from the database into the Go type of a column
+func Convert(columnType ColumnType, value interface{}) (interface{}, error) {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	switch columnType {
+	case TypeString:
+		if t, ok := value.(time.Time); ok {
+			return t.UTC().Format(time.RFC3339), nil
+		}
+		return fmt.Sprint(value), nil
+
+	case TypeInt:
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case int:
+			return int64(v), nil
+		case float64:
+			return int64(v), nil
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		case string:
+			if v == "" {
+				return nil, nil
+			}
+			return strconv.ParseInt(v, 10, 64)
+		}
+
+	case TypeFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		case string:
+			if v == "" {
+				return nil, nil
+			}
+			return strconv.ParseFloat(v, 64)
+		}
+
+	case TypeBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			return v != 0, nil
+		case string:
+			if v == "" {
+				return nil, nil
+			}
+			return strconv.ParseBool(v)
+		}
+
+	case TypeTime:
+		switch v := value.(type) {
+		case time.Time:
+			return v.UTC(), nil
+		case int64:
+			return time.Unix(v, 0).UTC(), nil
+		case string:
+			if v == "" {
+				return nil, nil
+			}
+			return parseTime(v)
+		}
+	}
+
+	return nil, fmt.Errorf("cannot convert %T to column type %d", value, columnType)
+}
+
+// timeLayouts are the formats SQLite timestamps are stored in
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp: %s", value)
+}
+
+// formatText renders a value for text formats such as CSV
+func formatText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// checkRow verifies a row matches the schema
+func checkRow(schema Schema, row Row) error {
+	if len(row) != len(schema.Columns) {
+		return fmt.Errorf("row has %d values, schema %s has %d columns", len(row), schema.Name, len(schema.Columns))
+	}
+	for i, value := range row {
+		if value == nil {
+			continue
+		}
+		ok := false
+		switch schema.Columns[i].Type {
+		case TypeString:
+			_, ok = value.(string)
+		case TypeInt:
+			_, ok = value.(int64)
+		case TypeFloat:
+			var f float64
+			f, ok = value.(float64)
+			ok = ok && !math.IsNaN(f) && !math.IsInf(f, 0)
+		case TypeBool:
+			_, ok = value.(bool)
+		case TypeTime:
+			_, ok = value.(time.Time)
+		}
+		if !ok {
+			return fmt.Errorf("invalid value %v for column %s", value, schema.Columns[i].Name)
+		}
+	}
+	return nil
+}
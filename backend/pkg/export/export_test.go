@@ -0,0 +1,111 @@
+package export
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testCreatedAt = time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+// testSchema has a column of every type, in an order that is not alphabetical
+var testSchema = Schema{
+	Name: "purchases",
+	Columns: []Column{
+		{Name: "id", Type: TypeInt},
+		{Name: "product", Type: TypeString},
+		{Name: "amount", Type: TypeFloat},
+		{Name: "refunded", Type: TypeBool},
+		{Name: "created_at", Type: TypeTime},
+	},
+}
+
+var testRows = []Row{
+	{int64(1), "Tote <bag> & \"more\"", 19.99, false, testCreatedAt},
+	{int64(2), nil, 0.5, true, nil},
+	{nil, "Mug", nil, nil, testCreatedAt.Add(36 * time.Hour)},
+}
+
+func TestFormatsAreRegisteredInOrder(t *testing.T) {
+	var ids []string
+	for _, format := range Formats() {
+		ids = append(ids, format.ID)
+	}
+	if want := []string{"csv", "json", "ndjson", "xlsx", "parquet"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Formats = %v, want %v", ids, want)
+	}
+	if _, ok := Lookup("xml"); ok {
+		t.Error("Lookup found an unregistered format")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name       string
+		columnType ColumnType
+		value      interface{}
+		want       interface{}
+		wantErr    bool
+	}{
+		{name: "bytes to string", columnType: TypeString, value: []byte("Tote"), want: "Tote"},
+		{name: "time to string", columnType: TypeString, value: testCreatedAt, want: "2024-03-01T12:30:00Z"},
+		{name: "number to string", columnType: TypeString, value: int64(7), want: "7"},
+		{name: "string to int", columnType: TypeInt, value: "42", want: int64(42)},
+		{name: "float to int", columnType: TypeInt, value: 42.0, want: int64(42)},
+		{name: "empty string to int", columnType: TypeInt, value: "", want: nil},
+		{name: "invalid int", columnType: TypeInt, value: "forty", wantErr: true},
+		{name: "int to float", columnType: TypeFloat, value: int64(3), want: 3.0},
+		{name: "string to float", columnType: TypeFloat, value: "19.99", want: 19.99},
+		{name: "int to bool", columnType: TypeBool, value: int64(1), want: true},
+		{name: "string to bool", columnType: TypeBool, value: "false", want: false},
+		{name: "SQLite timestamp", columnType: TypeTime, value: "2024-03-01 12:30:00", want: testCreatedAt},
+		{name: "timestamp with zone", columnType: TypeTime, value: "2024-03-01T14:30:00+02:00", want: testCreatedAt},
+		{name: "unix seconds", columnType: TypeTime, value: testCreatedAt.Unix(), want: testCreatedAt},
+		{name: "invalid timestamp", columnType: TypeTime, value: "yesterday", wantErr: true},
+		{name: "null", columnType: TypeInt, value: nil, want: nil},
+		{name: "unsupported value", columnType: TypeBool, value: 1.5, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Convert(tt.columnType, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Convert err = %v, want error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Convert = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWritersRejectRowsNotMatchingTheSchema(t *testing.T) {
+	rows := []struct {
+		name string
+		row  Row
+	}{
+		{name: "too few values", row: Row{int64(1), "Tote"}},
+		{name: "wrong type", row: Row{1, "Tote", 19.99, false, testCreatedAt}},
+		{name: "NaN", row: Row{int64(1), "Tote", math.NaN(), false, testCreatedAt}},
+		{name: "infinity", row: Row{int64(1), "Tote", math.Inf(1), false, testCreatedAt}},
+	}
+
+	for _, format := range Formats() {
+		for _, tt := range rows {
+			t.Run(format.ID+"/"+tt.name, func(t *testing.T) {
+				w, err := format.NewWriter(discard{}, testSchema)
+				if err != nil {
+					t.Fatalf("NewWriter: %v", err)
+				}
+				if err := w.WriteRow(tt.row); err == nil {
+					t.Error("WriteRow accepted the row")
+				}
+			})
+		}
+	}
+}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) { return len(p), nil }
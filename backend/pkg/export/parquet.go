@@ -0,0 +1,425 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// parquetRowGroupSize is the number of rows buffered before a row group is written
+const parquetRowGroupSize = 50000
+
+// Values from the parquet-format Thrift definitions
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetGzip = 2
+
+	parquetDataPage = 0
+)
+
+var parquetMagic = []byte("PAR1")
+
+// parquetWriter writes a Parquet file with one optional column per schema
+// column. Rows are buffered per row group and written as one gzip-compressed
+// PLAIN data page per column chunk; the footer is written on Close.
+type parquetWriter struct {
+	schema    Schema
+	w         io.Writer
+	offset    int64
+	columns   []*parquetColumn
+	rows      int
+	numRows   int64
+	rowGroups []parquetRowGroup
+}
+
+type parquetColumn struct {
+	column  Column
+	present []bool // definition level of each row
+	values  bytes.Buffer
+	bools   []bool
+}
+
+type parquetRowGroup struct {
+	numRows   int64
+	totalSize int64
+	chunks    []parquetChunk
+}
+
+type parquetChunk struct {
+	offset           int64
+	numValues        int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+func newParquetWriter(w io.Writer, schema Schema) (Writer, error) {
+	pw := &parquetWriter{schema: schema, w: w}
+	for _, column := range schema.Columns {
+		pw.columns = append(pw.columns, &parquetColumn{column: column})
+	}
+
+	if err := pw.write(parquetMagic); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *parquetWriter) WriteRow(row Row) error {
+	if err := checkRow(pw.schema, row); err != nil {
+		return err
+	}
+
+	for i, value := range row {
+		pw.columns[i].append(value)
+	}
+	pw.rows++
+
+	if pw.rows >= parquetRowGroupSize {
+		return pw.flushRowGroup()
+	}
+	return nil
+}
+
+func (pw *parquetWriter) Close() error {
+	if err := pw.flushRowGroup(); err != nil {
+		return err
+	}
+
+	footer := pw.footer()
+	if err := pw.write(footer); err != nil {
+		return err
+	}
+
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	if err := pw.write(length[:]); err != nil {
+		return err
+	}
+	return pw.write(parquetMagic)
+}
+
+func (pw *parquetWriter) write(p []byte) error {
+	n, err := pw.w.Write(p)
+	pw.offset += int64(n)
+	return err
+}
+
+func (pw *parquetWriter) flushRowGroup() error {
+	if pw.rows == 0 {
+		return nil
+	}
+
+	group := parquetRowGroup{numRows: int64(pw.rows)}
+	for _, column := range pw.columns {
+		page := column.page()
+		compressed, err := gzipBytes(page)
+		if err != nil {
+			return err
+		}
+
+		header := parquetPageHeader(len(page), len(compressed), pw.rows)
+		chunk := parquetChunk{
+			offset:           pw.offset,
+			numValues:        int64(pw.rows),
+			uncompressedSize: int64(len(header) + len(page)),
+			compressedSize:   int64(len(header) + len(compressed)),
+		}
+		if err := pw.write(header); err != nil {
+			return err
+		}
+		if err := pw.write(compressed); err != nil {
+			return err
+		}
+
+		group.chunks = append(group.chunks, chunk)
+		group.totalSize += chunk.uncompressedSize
+		column.reset()
+	}
+
+	pw.rowGroups = append(pw.rowGroups, group)
+	pw.numRows += int64(pw.rows)
+	pw.rows = 0
+	return nil
+}
+
+func (pc *parquetColumn) append(value interface{}) {
+	pc.present = append(pc.present, value != nil)
+	if value == nil {
+		return
+	}
+
+	var scratch [8]byte
+	switch v := value.(type) {
+	case string:
+		binary.LittleEndian.PutUint32(scratch[:4], uint32(len(v)))
+		pc.values.Write(scratch[:4])
+		pc.values.WriteString(v)
+	case int64:
+		binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+		pc.values.Write(scratch[:])
+	case float64:
+		binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(v))
+		pc.values.Write(scratch[:])
+	case time.Time:
+		binary.LittleEndian.PutUint64(scratch[:], uint64(v.UnixMilli()))
+		pc.values.Write(scratch[:])
+	case bool:
+		pc.bools = append(pc.bools, v)
+	}
+}
+
+// page returns the uncompressed data page: the RLE encoded definition levels
+// prefixed with their length, followed by the PLAIN encoded non-null values
+func (pc *parquetColumn) page() []byte {
+	levels := rleBooleans(pc.present)
+
+	var page bytes.Buffer
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(levels)))
+	page.Write(length[:])
+	page.Write(levels)
+
+	if pc.column.Type == TypeBool {
+		packed := make([]byte, (len(pc.bools)+7)/8)
+		for i, v := range pc.bools {
+			if v {
+				packed[i/8] |= 1 << (i % 8)
+			}
+		}
+		page.Write(packed)
+	} else {
+		page.Write(pc.values.Bytes())
+	}
+
+	return page.Bytes()
+}
+
+func (pc *parquetColumn) reset() {
+	pc.present = pc.present[:0]
+	pc.values.Reset()
+	pc.bools = pc.bools[:0]
+}
+
+// rleBooleans encodes 0/1 levels as runs of the RLE/bit-packing hybrid
+// encoding with a bit width of 1
+func rleBooleans(values []bool) []byte {
+	var out []byte
+	for i := 0; i < len(values); {
+		run := 1
+		for i+run < len(values) && values[i+run] == values[i] {
+			run++
+		}
+
+		out = binary.AppendUvarint(out, uint64(run)<<1)
+		if values[i] {
+			out = append(out, 1)
+		} else {
+			out = append(out, 0)
+		}
+		i += run
+	}
+	return out
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func parquetPageHeader(uncompressedSize, compressedSize, numValues int) []byte {
+	var t thriftWriter
+	t.beginStruct()
+	t.i32(1, parquetDataPage)
+	t.i32(2, int32(uncompressedSize))
+	t.i32(3, int32(compressedSize))
+	t.structField(5, func() {
+		t.i32(1, int32(numValues))
+		t.i32(2, parquetPlain)
+		t.i32(3, parquetRLE)
+		t.i32(4, parquetRLE)
+	})
+	t.endStruct()
+	return t.buf.Bytes()
+}
+
+func (pw *parquetWriter) footer() []byte {
+	var t thriftWriter
+	t.beginStruct()
+	t.i32(1, 1) // version
+
+	t.listField(2, thriftStruct, len(pw.columns)+1)
+	t.listStruct(func() {
+		t.binary(4, "schema")
+		t.i32(5, int32(len(pw.columns)))
+	})
+	for _, column := range pw.columns {
+		physical, converted := parquetTypes(column.column.Type)
+		t.listStruct(func() {
+			t.i32(1, physical)
+			t.i32(3, parquetOptional)
+			t.binary(4, column.column.Name)
+			if converted >= 0 {
+				t.i32(6, converted)
+			}
+		})
+	}
+
+	t.i64(3, pw.numRows)
+
+	t.listField(4, thriftStruct, len(pw.rowGroups))
+	for _, group := range pw.rowGroups {
+		t.listStruct(func() {
+			t.listField(1, thriftStruct, len(group.chunks))
+			for i, chunk := range group.chunks {
+				column := pw.columns[i].column
+				physical, _ := parquetTypes(column.Type)
+				t.listStruct(func() {
+					t.i64(2, chunk.offset)
+					t.structField(3, func() {
+						t.i32(1, physical)
+						t.listField(2, thriftI32, 2)
+						t.listI32(parquetPlain)
+						t.listI32(parquetRLE)
+						t.listField(3, thriftBinary, 1)
+						t.listBinary(column.Name)
+						t.i32(4, parquetGzip)
+						t.i64(5, chunk.numValues)
+						t.i64(6, chunk.uncompressedSize)
+						t.i64(7, chunk.compressedSize)
+						t.i64(9, chunk.offset)
+					})
+				})
+			}
+			t.i64(2, group.totalSize)
+			t.i64(3, group.numRows)
+		})
+	}
+
+	t.binary(6, "lynkr")
+	t.endStruct()
+	return t.buf.Bytes()
+}
+
+// parquetTypes returns the physical and converted type of a column. The
+// converted type is -1 when there is none.
+func parquetTypes(columnType ColumnType) (int32, int32) {
+	switch columnType {
+	case TypeInt:
+		return parquetInt64, -1
+	case TypeFloat:
+		return parquetDouble, -1
+	case TypeBool:
+		return parquetBoolean, -1
+	case TypeTime:
+		return parquetInt64, parquetTimestampMillis
+	default:
+		return parquetByteArray, parquetUTF8
+	}
+}
+
+// Thrift compact protocol type IDs
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the subset of the Thrift compact protocol needed for
+// Parquet page headers and file metadata
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // last field ID written in each open struct
+}
+
+func (t *thriftWriter) beginStruct() {
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftWriter) endStruct() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) field(id int16, fieldType byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		t.buf.WriteByte(fieldType)
+		t.varint(int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) varint(v int64) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64((v<<1)^(v>>63))))
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) binary(id int16, v string) {
+	t.field(id, thriftBinary)
+	t.listBinary(v)
+}
+
+func (t *thriftWriter) structField(id int16, body func()) {
+	t.field(id, thriftStruct)
+	t.listStruct(body)
+}
+
+func (t *thriftWriter) listField(id int16, elementType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elementType)
+	} else {
+		t.buf.WriteByte(0xF0 | elementType)
+		t.buf.Write(binary.AppendUvarint(nil, uint64(size)))
+	}
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) listBinary(v string) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64(len(v))))
+	t.buf.WriteString(v)
+}
+
+func (t *thriftWriter) listStruct(body func()) {
+	t.beginStruct()
+	body()
+	t.endStruct()
+}
@@ -0,0 +1,239 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// thriftReader decodes the Thrift compact protocol into field ID maps, so
+// tests can read back the metadata parquetWriter encodes
+type thriftReader struct {
+	t    *testing.T
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.t.Fatalf("thrift data ends at %d", r.pos)
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.t.Fatalf("invalid varint at %d", r.pos)
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) readStruct() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var last int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.readValue(header & 0x0f)
+		last = id
+	}
+}
+
+func (r *thriftReader) readValue(fieldType byte) interface{} {
+	switch fieldType {
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.uvarint())
+		value := string(r.data[r.pos : r.pos+n])
+		r.pos += n
+		return value
+	case thriftList:
+		header := r.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.readValue(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return r.readStruct()
+	}
+	r.t.Fatalf("unexpected thrift type %d at %d", fieldType, r.pos)
+	return nil
+}
+
+// parquetFile is the metadata and the values of a Parquet file written by
+// parquetWriter, read back column by column
+type parquetFile struct {
+	numRows   int64
+	rowGroups int
+	names     []string
+	types     []int64
+	columns   [][]interface{}
+}
+
+func readParquet(t *testing.T, data []byte, schema Schema) parquetFile {
+	t.Helper()
+	if len(data) < 12 || !bytes.Equal(data[:4], parquetMagic) || !bytes.Equal(data[len(data)-4:], parquetMagic) {
+		t.Fatalf("file does not start and end with %q", parquetMagic)
+	}
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footerStart := len(data) - 8 - footerLength
+	if footerStart < 4 {
+		t.Fatalf("footer length %d does not fit the file", footerLength)
+	}
+	reader := &thriftReader{t: t, data: data[footerStart : len(data)-8]}
+	metadata := reader.readStruct()
+	if reader.pos != footerLength {
+		t.Fatalf("footer is %d bytes, decoded %d", footerLength, reader.pos)
+	}
+
+	file := parquetFile{numRows: metadata[3].(int64), columns: make([][]interface{}, len(schema.Columns))}
+	for _, element := range metadata[2].([]interface{})[1:] {
+		fields := element.(map[int16]interface{})
+		file.names = append(file.names, fields[4].(string))
+		file.types = append(file.types, fields[1].(int64))
+	}
+
+	for _, group := range metadata[4].([]interface{}) {
+		file.rowGroups++
+		chunks := group.(map[int16]interface{})[1].([]interface{})
+		for i, chunk := range chunks {
+			meta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+			file.columns[i] = append(file.columns[i], readParquetPage(t, data, int(meta[9].(int64)), schema.Columns[i].Type)...)
+		}
+	}
+	return file
+}
+
+// readParquetPage decodes the data page at offset
+func readParquetPage(t *testing.T, data []byte, offset int, columnType ColumnType) []interface{} {
+	t.Helper()
+	reader := &thriftReader{t: t, data: data[offset:]}
+	header := reader.readStruct()
+	numValues := int(header[5].(map[int16]interface{})[1].(int64))
+	compressed := data[offset+reader.pos : offset+reader.pos+int(header[3].(int64))]
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("page is not gzip compressed: %v", err)
+	}
+	page, err := io.ReadAll(zr)
+	if err != nil || len(page) != int(header[2].(int64)) {
+		t.Fatalf("page decompresses to %d bytes, %v; header says %d", len(page), err, header[2])
+	}
+
+	// Definition levels, as the runs rleBooleans writes
+	levelsLength := int(binary.LittleEndian.Uint32(page))
+	levels := &thriftReader{t: t, data: page[4 : 4+levelsLength]}
+	var present []bool
+	for levels.pos < levelsLength {
+		run := levels.uvarint()
+		if run&1 != 0 {
+			t.Fatal("unexpected bit-packed run")
+		}
+		value := levels.byte() == 1
+		for i := uint64(0); i < run>>1; i++ {
+			present = append(present, value)
+		}
+	}
+	if len(present) != numValues {
+		t.Fatalf("page has %d levels, header says %d values", len(present), numValues)
+	}
+
+	values := page[4+levelsLength:]
+	column := make([]interface{}, numValues)
+	bit := 0
+	for i := range column {
+		if !present[i] {
+			continue
+		}
+		switch columnType {
+		case TypeString:
+			n := int(binary.LittleEndian.Uint32(values))
+			column[i] = string(values[4 : 4+n])
+			values = values[4+n:]
+		case TypeInt:
+			column[i] = int64(binary.LittleEndian.Uint64(values))
+			values = values[8:]
+		case TypeFloat:
+			column[i] = math.Float64frombits(binary.LittleEndian.Uint64(values))
+			values = values[8:]
+		case TypeTime:
+			column[i] = time.UnixMilli(int64(binary.LittleEndian.Uint64(values))).UTC()
+			values = values[8:]
+		case TypeBool:
+			column[i] = values[bit/8]&(1<<(bit%8)) != 0
+			bit++
+		}
+	}
+	return column
+}
+
+func TestParquet(t *testing.T) {
+	file := readParquet(t, writeAll(t, "parquet", testSchema, testRows), testSchema)
+
+	if file.numRows != 3 || file.rowGroups != 1 {
+		t.Errorf("file has %d rows in %d row groups, want 3 in 1", file.numRows, file.rowGroups)
+	}
+	if want := []string{"id", "product", "amount", "refunded", "created_at"}; !reflect.DeepEqual(file.names, want) {
+		t.Errorf("columns = %v, want %v in schema order", file.names, want)
+	}
+	if want := []int64{parquetInt64, parquetByteArray, parquetDouble, parquetBoolean, parquetInt64}; !reflect.DeepEqual(file.types, want) {
+		t.Errorf("physical types = %v, want %v", file.types, want)
+	}
+	for i, column := range file.columns {
+		for j, value := range column {
+			if want := testRows[j][i]; !reflect.DeepEqual(value, want) {
+				t.Errorf("row %d %s = %#v, want %#v", j+1, file.names[i], value, want)
+			}
+		}
+	}
+}
+
+func TestParquetRowGroups(t *testing.T) {
+	schema := Schema{Name: "ids", Columns: []Column{{Name: "id", Type: TypeInt}}}
+	rows := make([]Row, parquetRowGroupSize+10)
+	for i := range rows {
+		rows[i] = Row{int64(i)}
+	}
+
+	file := readParquet(t, writeAll(t, "parquet", schema, rows), schema)
+	if file.numRows != int64(len(rows)) || file.rowGroups != 2 || len(file.columns[0]) != len(rows) {
+		t.Fatalf("file has %d rows in %d row groups with %d values, want %d in 2", file.numRows, file.rowGroups, len(file.columns[0]), len(rows))
+	}
+	if last := file.columns[0][len(rows)-1]; last != int64(len(rows)-1) {
+		t.Errorf("last value = %v, want %d", last, len(rows)-1)
+	}
+}
+
+func TestParquetWithoutRows(t *testing.T) {
+	file := readParquet(t, writeAll(t, "parquet", testSchema, nil), testSchema)
+	if file.numRows != 0 || file.rowGroups != 0 || len(file.names) != len(testSchema.Columns) {
+		t.Errorf("file has %d rows in %d row groups and columns %v, want an empty file with the schema", file.numRows, file.rowGroups, file.names)
+	}
+}
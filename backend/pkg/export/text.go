@@ -0,0 +1,120 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+)
+
+type csvWriter struct {
+	schema Schema
+	w      *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, schema Schema) (Writer, error) {
+	cw := &csvWriter{schema: schema, w: csv.NewWriter(w)}
+
+	header := make([]string, len(schema.Columns))
+	for i, column := range schema.Columns {
+		header[i] = column.Name
+	}
+	if err := cw.w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return cw, nil
+}
+
+func (cw *csvWriter) WriteRow(row Row) error {
+	if err := checkRow(cw.schema, row); err != nil {
+		return err
+	}
+
+	record := make([]string, len(row))
+	for i, value := range row {
+		record[i] = formatText(value)
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// jsonWriter writes a JSON array of objects, or one object per line when
+// lines is set. Keys follow the schema order.
+type jsonWriter struct {
+	schema Schema
+	w      *bufio.Writer
+	keys   [][]byte
+	lines  bool
+	rows   int
+}
+
+func newJSONWriter(w io.Writer, schema Schema) (Writer, error) {
+	return newJSONObjectWriter(w, schema, false)
+}
+
+func newNDJSONWriter(w io.Writer, schema Schema) (Writer, error) {
+	return newJSONObjectWriter(w, schema, true)
+}
+
+func newJSONObjectWriter(w io.Writer, schema Schema, lines bool) (*jsonWriter, error) {
+	jw := &jsonWriter{schema: schema, w: bufio.NewWriter(w), lines: lines}
+	for _, column := range schema.Columns {
+		key, err := json.Marshal(column.Name)
+		if err != nil {
+			return nil, err
+		}
+		jw.keys = append(jw.keys, key)
+	}
+	return jw, nil
+}
+
+func (jw *jsonWriter) WriteRow(row Row) error {
+	if err := checkRow(jw.schema, row); err != nil {
+		return err
+	}
+
+	switch {
+	case jw.lines:
+	case jw.rows == 0:
+		jw.w.WriteString("[\n  ")
+	default:
+		jw.w.WriteString(",\n  ")
+	}
+
+	jw.w.WriteByte('{')
+	for i, value := range row {
+		if i > 0 {
+			jw.w.WriteByte(',')
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		jw.w.Write(jw.keys[i])
+		jw.w.WriteByte(':')
+		jw.w.Write(encoded)
+	}
+	jw.w.WriteByte('}')
+
+	if jw.lines {
+		jw.w.WriteByte('\n')
+	}
+	jw.rows++
+	return nil
+}
+
+func (jw *jsonWriter) Close() error {
+	if !jw.lines {
+		if jw.rows == 0 {
+			jw.w.WriteString("[]\n")
+		} else {
+			jw.w.WriteString("\n]\n")
+		}
+	}
+	return jw.w.Flush()
+}
@@ -0,0 +1,77 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// writeAll writes rows in a format and returns the file
+func writeAll(t *testing.T, id string, schema Schema, rows []Row) []byte {
+	t.Helper()
+	format, ok := Lookup(id)
+	if !ok {
+		t.Fatalf("format %s is not registered", id)
+	}
+	var buf bytes.Buffer
+	w, err := format.NewWriter(&buf, schema)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatalf("WriteRow: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSV(t *testing.T) {
+	got := string(writeAll(t, "csv", testSchema, testRows))
+	want := "id,product,amount,refunded,created_at\n" +
+		"1,\"Tote <bag> & \"\"more\"\"\",19.99,false,2024-03-01T12:30:00Z\n" +
+		"2,,0.5,true,\n" +
+		",Mug,,,2024-03-03T00:30:00Z\n"
+	if got != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	got := string(writeAll(t, "ndjson", testSchema, testRows))
+	// Keys follow the schema order rather than being sorted
+	want := `{"id":1,"product":"Tote \u003cbag\u003e \u0026 \"more\"","amount":19.99,"refunded":false,"created_at":"2024-03-01T12:30:00Z"}` + "\n" +
+		`{"id":2,"product":null,"amount":0.5,"refunded":true,"created_at":null}` + "\n" +
+		`{"id":null,"product":"Mug","amount":null,"refunded":null,"created_at":"2024-03-03T00:30:00Z"}` + "\n"
+	if got != want {
+		t.Errorf("NDJSON =\n%s\nwant\n%s", got, want)
+	}
+
+	for i, line := range strings.Split(strings.TrimSuffix(got, "\n"), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Errorf("line %d is not a JSON object: %v", i+1, err)
+		}
+	}
+	if got := writeAll(t, "ndjson", testSchema, nil); len(got) != 0 {
+		t.Errorf("NDJSON without rows = %q, want an empty file", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var records []map[string]interface{}
+	if err := json.Unmarshal(writeAll(t, "json", testSchema, testRows), &records); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(records) != 3 || records[0]["product"] != `Tote <bag> & "more"` || records[1]["product"] != nil || records[2]["id"] != nil {
+		t.Errorf("records = %v", records)
+	}
+
+	if got := string(writeAll(t, "json", testSchema, nil)); got != "[]\n" {
+		t.Errorf("JSON without rows = %q, want an empty array", got)
+	}
+}
@@ -0,0 +1,215 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Excel limits
+const (
+	xlsxMaxRows       = 1048576
+	xlsxMaxCellLength = 32767
+	xlsxMaxSheetName  = 31
+)
+
+// Cell style indexes in xlsxStyles
+const (
+	xlsxStyleDate   = 1
+	xlsxStyleHeader = 2
+)
+
+// xlsxEpoch is day zero of Excel's date serial numbers
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxWriter streams a single-sheet workbook. The fixed parts are written up
+// front and rows go straight into the worksheet entry of the zip archive.
+type xlsxWriter struct {
+	schema Schema
+	zip    *zip.Writer
+	sheet  *bufio.Writer
+	row    int
+}
+
+func newXLSXWriter(w io.Writer, schema Schema) (Writer, error) {
+	xw := &xlsxWriter{schema: schema, zip: zip.NewWriter(w)}
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", strings.Replace(xlsxWorkbook, "{{sheet}}", xlsxSheetName(schema.Name), 1)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		entry, err := xw.zip.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(entry, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	entry, err := xw.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	xw.sheet = bufio.NewWriter(entry)
+	xw.sheet.WriteString(xlsxSheetHeader)
+
+	header := make(Row, len(schema.Columns))
+	for i, column := range schema.Columns {
+		header[i] = column.Name
+	}
+	xw.writeRow(header, xlsxStyleHeader)
+
+	return xw, nil
+}
+
+func (xw *xlsxWriter) WriteRow(row Row) error {
+	if err := checkRow(xw.schema, row); err != nil {
+		return err
+	}
+	if xw.row >= xlsxMaxRows {
+		return errors.New("export exceeds the Excel row limit")
+	}
+
+	xw.writeRow(row, 0)
+	return nil
+}
+
+func (xw *xlsxWriter) writeRow(row Row, style int) {
+	xw.row++
+	rowNumber := strconv.Itoa(xw.row)
+
+	xw.sheet.WriteString(`<row r="` + rowNumber + `">`)
+	for i, value := range row {
+		if value == nil {
+			continue
+		}
+
+		ref := xlsxColumnName(i) + rowNumber
+		xw.sheet.WriteString(`<c r="` + ref + `"`)
+		if style != 0 {
+			xw.sheet.WriteString(` s="` + strconv.Itoa(style) + `"`)
+		}
+
+		switch v := value.(type) {
+		case string:
+			xw.sheet.WriteString(` t="inlineStr"><is><t xml:space="preserve">`)
+			xml.EscapeText(xw.sheet, []byte(truncateUTF8(v, xlsxMaxCellLength)))
+			xw.sheet.WriteString(`</t></is></c>`)
+		case int64:
+			xw.sheet.WriteString(`><v>` + strconv.FormatInt(v, 10) + `</v></c>`)
+		case float64:
+			xw.sheet.WriteString(`><v>` + strconv.FormatFloat(v, 'g', -1, 64) + `</v></c>`)
+		case bool:
+			flag := "0"
+			if v {
+				flag = "1"
+			}
+			xw.sheet.WriteString(` t="b"><v>` + flag + `</v></c>`)
+		case time.Time:
+			serial := float64(v.UTC().Sub(xlsxEpoch)) / float64(24*time.Hour)
+			if style == 0 {
+				xw.sheet.WriteString(` s="` + strconv.Itoa(xlsxStyleDate) + `"`)
+			}
+			xw.sheet.WriteString(`><v>` + strconv.FormatFloat(serial, 'f', -1, 64) + `</v></c>`)
+		}
+	}
+	xw.sheet.WriteString(`</row>`)
+}
+
+func (xw *xlsxWriter) Close() error {
+	xw.sheet.WriteString(xlsxSheetFooter)
+	if err := xw.sheet.Flush(); err != nil {
+		return err
+	}
+	return xw.zip.Close()
+}
+
+// xlsxColumnName converts a zero-based column index to A, B, ..., Z, AA, ...
+func xlsxColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// xlsxSheetName returns an escaped sheet name within Excel's rules
+func xlsxSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = truncateUTF8(name, xlsxMaxSheetName)
+	if name == "" {
+		name = "Export"
+	}
+
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(name))
+	return escaped.String()
+}
+
+func truncateUTF8(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="{{sheet}}" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+// Style 1 formats dates as "m/d/yy h:mm" (built-in format 22), style 2 is the bold header
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="22" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`
+
+const xlsxSheetHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>
+<sheetData>`
+
+const xlsxSheetFooter = `</sheetData>
+</worksheet>`
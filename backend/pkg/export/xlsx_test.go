@@ -0,0 +1,153 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// xlsxCell is a worksheet cell as read back from the XML
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Style  string `xml:"s,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Ref   string     `xml:"r,attr"`
+		Cells []xlsxCell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX opens a workbook and returns its parts
+func readXLSX(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+	parts := map[string]string{}
+	for _, file := range archive.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", file.Name, err)
+		}
+		body, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file.Name, err)
+		}
+		// Every part has to be well-formed XML
+		decoder := xml.NewDecoder(bytes.NewReader(body))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s is not well-formed: %v", file.Name, err)
+			}
+		}
+		parts[file.Name] = string(body)
+	}
+	return parts
+}
+
+func TestXLSX(t *testing.T) {
+	parts := readXLSX(t, writeAll(t, "xlsx", testSchema, testRows))
+
+	var names []string
+	for name := range parts {
+		names = append(names, name)
+	}
+	wantParts := []string{"[Content_Types].xml", "_rels/.rels", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/workbook.xml", "xl/worksheets/sheet1.xml"}
+	for _, name := range wantParts {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("workbook has no %s, parts: %v", name, names)
+		}
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="purchases"`) {
+		t.Errorf("workbook.xml does not name the sheet after the schema:\n%s", parts["xl/workbook.xml"])
+	}
+
+	var sheet xlsxSheet
+	if err := xml.Unmarshal([]byte(parts["xl/worksheets/sheet1.xml"]), &sheet); err != nil {
+		t.Fatalf("invalid worksheet: %v", err)
+	}
+	if len(sheet.Rows) != 4 {
+		t.Fatalf("worksheet has %d rows, want the header and 3 rows", len(sheet.Rows))
+	}
+
+	serial := func(days float64) string { return strconv.FormatFloat(days, 'f', -1, 64) }
+	want := [][]xlsxCell{
+		{
+			{Ref: "A1", Type: "inlineStr", Style: "2", Inline: "id"},
+			{Ref: "B1", Type: "inlineStr", Style: "2", Inline: "product"},
+			{Ref: "C1", Type: "inlineStr", Style: "2", Inline: "amount"},
+			{Ref: "D1", Type: "inlineStr", Style: "2", Inline: "refunded"},
+			{Ref: "E1", Type: "inlineStr", Style: "2", Inline: "created_at"},
+		},
+		{
+			{Ref: "A2", Value: "1"},
+			{Ref: "B2", Type: "inlineStr", Inline: `Tote <bag> & "more"`},
+			{Ref: "C2", Value: "19.99"},
+			{Ref: "D2", Type: "b", Value: "0"},
+			// 2024-03-01 is day 45352 of Excel's calendar
+			{Ref: "E2", Style: "1", Value: serial(45352 + 12.5/24)},
+		},
+		{
+			{Ref: "A3", Value: "2"},
+			{Ref: "C3", Value: "0.5"},
+			{Ref: "D3", Type: "b", Value: "1"},
+		},
+		{
+			{Ref: "B4", Type: "inlineStr", Inline: "Mug"},
+			{Ref: "E4", Style: "1", Value: serial(45354 + 0.5/24)},
+		},
+	}
+	for i, row := range sheet.Rows {
+		if row.Ref != strconv.Itoa(i+1) {
+			t.Errorf("row %d is numbered %s", i+1, row.Ref)
+		}
+		if !reflect.DeepEqual(row.Cells, want[i]) {
+			t.Errorf("row %d = %+v\nwant %+v", i+1, row.Cells, want[i])
+		}
+	}
+}
+
+func TestXLSXColumnName(t *testing.T) {
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, "A"}, {25, "Z"}, {26, "AA"}, {51, "AZ"}, {52, "BA"}, {701, "ZZ"}, {702, "AAA"},
+	}
+	for _, tt := range tests {
+		if got := xlsxColumnName(tt.index); got != tt.want {
+			t.Errorf("xlsxColumnName(%d) = %s, want %s", tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestXLSXSheetName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "", want: "Export"},
+		{name: "Q1/Q2 [draft]", want: "Q1_Q2 _draft_"},
+		{name: "Sales & refunds", want: "Sales &amp; refunds"},
+		{name: strings.Repeat("é", 40), want: strings.Repeat("é", 31)},
+	}
+	for _, tt := range tests {
+		if got := xlsxSheetName(tt.name); got != tt.want {
+			t.Errorf("xlsxSheetName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
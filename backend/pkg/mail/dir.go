@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DirSender writes every message to a .eml file instead of sending it. It
+// stands in for a mail server in development.
+type DirSender struct {
+	dir  string
+	from string
+}
+
+// NewDirSender creates a sender writing to dir
+func NewDirSender(dir, from string) (*DirSender, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("mail directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &DirSender{dir: dir, from: from}, nil
+}
+
+func (s *DirSender) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, err := format(s.from, msg, now)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed to name message file: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405"), hex.EncodeToString(suffix))
+	if err := os.WriteFile(filepath.Join(s.dir, name), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	return nil
+}
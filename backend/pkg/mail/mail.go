@@ -0,0 +1,70 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+// ErrInvalidMessage is returned for messages that cannot be sent as they are
+var ErrInvalidMessage = errors.New("invalid email message")
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers email
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config selects and configures a mail backend
+type Config struct {
+	Backend string     `json:"backend"` // "dir" or "smtp"
+	From    string     `json:"from"`    // sender address
+	Dir     string     `json:"dir"`     // where the dir backend writes messages
+	SMTP    SMTPConfig `json:"smtp"`
+}
+
+// New creates the backend selected in the config
+func New(config Config) (Sender, error) {
+	switch config.Backend {
+	case "", "dir":
+		return NewDirSender(config.Dir, config.From)
+	case "smtp":
+		return NewSMTPSender(config.SMTP, config.From)
+	default:
+		return nil, fmt.Errorf("unknown mail backend: %s", config.Backend)
+	}
+}
+
+// format renders a message with its headers. Header values must not contain
+// line breaks, which would let them add headers of their own.
+func format(from string, msg Message, now time.Time) ([]byte, error) {
+	for _, value := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("%w: header contains a line break", ErrInvalidMessage)
+		}
+	}
+	if msg.To == "" {
+		return nil, fmt.Errorf("%w: no recipient", ErrInvalidMessage)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,58 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DefaultCurrency is used for amounts recorded without a currency
+const DefaultCurrency = "USD"
+
+// ErrInvalidCurrency is returned for codes that are not three letters
+var ErrInvalidCurrency = errors.New("money: invalid currency code")
+
+// exponents lists the ISO 4217 currencies whose minor unit is not a hundredth
+var exponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// Normalize upper-cases a currency code and checks it has three letters. An
+// empty code is the default currency.
+func Normalize(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return DefaultCurrency, nil
+	}
+	if len(code) != 3 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, code)
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, code)
+		}
+	}
+	return code, nil
+}
+
+// Exponent is the number of decimals of a currency's minor unit
+func Exponent(code string) int {
+	if exponent, ok := exponents[code]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// ToMinor converts an amount in major units, as sent by stores and clients,
+// to minor units, rounding to the nearest one
+func ToMinor(amount float64, code string) int64 {
+	return int64(math.Round(amount * math.Pow10(Exponent(code))))
+}
+
+// ToMajor converts minor units to an amount in major units for display
+func ToMajor(minor int64, code string) float64 {
+	return float64(minor) / math.Pow10(Exponent(code))
+}
@@ -0,0 +1,153 @@
+package money
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		code    string
+		want    string
+		wantErr bool
+	}{
+		{code: "usd", want: "USD"},
+		{code: " jpy ", want: "JPY"},
+		{code: "", want: DefaultCurrency},
+		{code: "US", wantErr: true},
+		{code: "USDT", wantErr: true},
+		{code: "U$D", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.code)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidCurrency) {
+				t.Errorf("Normalize(%q) err = %v, want ErrInvalidCurrency", tt.code, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Normalize(%q) = %q, %v; want %q", tt.code, got, err, tt.want)
+		}
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount float64
+		code   string
+		minor  int64
+		major  float64
+	}{
+		{name: "cents", amount: 19.99, code: "USD", minor: 1999, major: 19.99},
+		{name: "float error rounds to the nearest cent", amount: 0.29, code: "EUR", minor: 29, major: 0.29},
+		{name: "half a cent rounds away from zero", amount: 0.125, code: "USD", minor: 13, major: 0.13},
+		{name: "refund", amount: -4.5, code: "USD", minor: -450, major: -4.5},
+		{name: "zero-decimal currency", amount: 1500, code: "JPY", minor: 1500, major: 1500},
+		{name: "zero-decimal currency rounds fractions", amount: 1500.6, code: "KRW", minor: 1501, major: 1501},
+		{name: "three-decimal currency", amount: 1.234, code: "KWD", minor: 1234, major: 1.234},
+		{name: "three-decimal currency rounds", amount: 2.0005, code: "BHD", minor: 2001, major: 2.001},
+		{name: "unlisted currency has cents", amount: 7.5, code: "XYZ", minor: 750, major: 7.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			minor := ToMinor(tt.amount, tt.code)
+			if minor != tt.minor {
+				t.Errorf("ToMinor(%v, %s) = %d, want %d", tt.amount, tt.code, minor, tt.minor)
+			}
+			if major := ToMajor(minor, tt.code); major != tt.major {
+				t.Errorf("ToMajor(%d, %s) = %v, want %v", minor, tt.code, major, tt.major)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rates, err := NewRates("usd", map[string]float64{"EUR": 0.92, "JPY": 150, "KWD": 0.307})
+	if err != nil {
+		t.Fatalf("NewRates: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		minor   int64
+		from    string
+		to      string
+		want    int64
+		wantErr error
+	}{
+		{name: "same currency", minor: 1999, from: "GBP", to: "GBP", want: 1999},
+		{name: "base to another currency", minor: 10000, from: "USD", to: "EUR", want: 9200},
+		{name: "to the base currency", minor: 9200, from: "EUR", to: "USD", want: 10000},
+		{name: "cents to yen", minor: 1234, from: "USD", to: "JPY", want: 1851},
+		{name: "yen to cents", minor: 1500, from: "JPY", to: "USD", want: 1000},
+		{name: "between two other currencies", minor: 15000, from: "JPY", to: "EUR", want: 9200},
+		{name: "to fils", minor: 10000, from: "USD", to: "KWD", want: 30700},
+		{name: "rounds to the nearest minor unit", minor: 1, from: "EUR", to: "USD", want: 1},
+		{name: "no rate to convert from", minor: 100, from: "GBP", to: "USD", wantErr: ErrNoRate},
+		{name: "no rate to convert to", minor: 100, from: "USD", to: "GBP", wantErr: ErrNoRate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rates.Convert(tt.minor, tt.from, tt.to)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("Convert(%d, %s, %s) = %d, %v; want %d, %v", tt.minor, tt.from, tt.to, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewRates(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		rates   map[string]float64
+		wantErr bool
+	}{
+		{name: "valid", base: "USD", rates: map[string]float64{"eur": 0.92}},
+		{name: "base listed with rate 1", base: "USD", rates: map[string]float64{"USD": 1}},
+		{name: "base listed with another rate", base: "USD", rates: map[string]float64{"USD": 2}, wantErr: true},
+		{name: "zero rate", base: "USD", rates: map[string]float64{"EUR": 0}, wantErr: true},
+		{name: "negative rate", base: "USD", rates: map[string]float64{"EUR": -1}, wantErr: true},
+		{name: "invalid code", base: "USD", rates: map[string]float64{"EURO": 0.92}, wantErr: true},
+		{name: "invalid base", base: "DOLLAR", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates, err := NewRates(tt.base, tt.rates)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRates err = %v, want error: %v", err, tt.wantErr)
+			}
+			if err == nil && rates.Rates[rates.Base] != 1 {
+				t.Errorf("rate of the base currency = %v, want 1", rates.Rates[rates.Base])
+			}
+		})
+	}
+}
+
+func TestLoadRates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(`{"base": "usd", "rates": {"eur": 0.92, "jpy": 150}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rates, err := LoadRates(path)
+	if err != nil {
+		t.Fatalf("LoadRates: %v", err)
+	}
+	if rates.Base != "USD" || rates.Rates["EUR"] != 0.92 || rates.Rates["JPY"] != 150 || rates.Rates["USD"] != 1 {
+		t.Errorf("LoadRates = %+v, want normalized codes with the base at 1", rates)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"base": "USD", "rates": {"EUR": 0}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRates(path); err == nil {
+		t.Error("LoadRates accepted a zero rate")
+	}
+}
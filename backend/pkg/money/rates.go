@@ -0,0 +1,84 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// ErrNoRate is returned when a conversion needs a currency without a rate
+var ErrNoRate = errors.New("money: no exchange rate")
+
+// Rates is an exchange rate table. Every rate is the price of one unit of
+// the base currency in another currency, so with a USD base EUR 0.92 means
+// one dollar buys 0.92 euros.
+type Rates struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// LoadRates reads an exchange rate table from a JSON file such as
+// {"base": "USD", "rates": {"EUR": 0.92, "GBP": 0.79}}
+func LoadRates(path string) (*Rates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates: %w", err)
+	}
+
+	var file Rates
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse exchange rates: %w", err)
+	}
+
+	rates, err := NewRates(file.Base, file.Rates)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exchange rates in %s: %w", path, err)
+	}
+	return rates, nil
+}
+
+// NewRates validates and normalizes an exchange rate table. The base
+// currency always has the rate 1.
+func NewRates(base string, rates map[string]float64) (*Rates, error) {
+	base, err := Normalize(base)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &Rates{Base: base, Rates: map[string]float64{base: 1}}
+	for code, rate := range rates {
+		normalized, err := Normalize(code)
+		if err != nil {
+			return nil, err
+		}
+		if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+			return nil, fmt.Errorf("rate of %s must be positive", normalized)
+		}
+		if normalized == base && rate != 1 {
+			return nil, fmt.Errorf("rate of the base currency %s must be 1", base)
+		}
+		table.Rates[normalized] = rate
+	}
+	return table, nil
+}
+
+// Convert converts minor units of one currency to minor units of another,
+// rounding to the nearest one
+func (r *Rates) Convert(minor int64, from, to string) (int64, error) {
+	if from == to {
+		return minor, nil
+	}
+	fromRate, ok := r.Rates[from]
+	if !ok {
+		return 0, fmt.Errorf("%w for %s", ErrNoRate, from)
+	}
+	toRate, ok := r.Rates[to]
+	if !ok {
+		return 0, fmt.Errorf("%w for %s", ErrNoRate, to)
+	}
+
+	major := ToMajor(minor, from) / fromRate * toRate
+	return ToMinor(major, to), nil
+}
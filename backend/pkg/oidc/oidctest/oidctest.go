@@ -0,0 +1,345 @@
+// Package oidctest is a minimal OpenID Connect provider for development and
+// tests. Its login page signs in any email address without a password, so it
+// must never be exposed.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "mock-1"
+
+// Options configures the client the provider accepts
+type Options struct {
+	ClientID     string
+	ClientSecret string // required from the client when set
+	// EmailVerified is the default of the login form's "email verified" box
+	EmailVerified bool
+}
+
+// User is who signs in on the login page. Subject defaults to "mock|" and the
+// lower-cased email.
+type User struct {
+	Email         string
+	Name          string
+	EmailVerified bool
+	Subject       string
+}
+
+// authorization is an issued code waiting to be redeemed at the token endpoint
+type authorization struct {
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	user          User
+	expiresAt     time.Time
+}
+
+// Provider serves discovery, JWKS, authorize and token endpoints under its
+// issuer URL
+type Provider struct {
+	issuer  string
+	options Options
+	key     *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Mock identity provider</title></head>
+<body>
+<h1>Mock identity provider</h1>
+<p>Sign in to {{.ClientID}} as any user.</p>
+<form method="post" action="/authorize">
+{{range $name, $values := .Query}}<input type="hidden" name="{{$name}}" value="{{index $values 0}}">
+{{end}}<p><label>Email <input type="email" name="email" required autofocus></label></p>
+<p><label>Name <input type="text" name="name"></label></p>
+<p><label><input type="checkbox" name="email_verified" value="true"{{if .EmailVerified}} checked{{end}}> Email verified</label></p>
+<p><button type="submit">Sign in</button></p>
+</form>
+</body>
+</html>
+`))
+
+// New creates a provider reached at issuer. The signing key is generated
+// here, so tokens do not outlive the provider.
+func New(issuer string, options Options) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	return &Provider{
+		issuer:  strings.TrimSuffix(issuer, "/"),
+		options: options,
+		key:     key,
+		codes:   make(map[string]authorization),
+	}, nil
+}
+
+// NewServer starts a provider on a local port, like httptest.NewServer. The
+// caller closes the server.
+func NewServer(options Options) (*Provider, *httptest.Server) {
+	server := httptest.NewUnstartedServer(nil)
+	provider, err := New("http://"+server.Listener.Addr().String(), options)
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: %v", err))
+	}
+	server.Config.Handler = provider
+	server.Start()
+	return provider, server
+}
+
+// Issuer returns the provider's issuer URL
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		p.discovery(w, r)
+	case "/jwks":
+		p.jwks(w, r)
+	case "/authorize":
+		p.authorize(w, r)
+	case "/token":
+		p.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Login signs user in at an authorization URL as if they submitted the login
+// page, and returns the callback URL the browser would be sent to
+func (p *Provider) Login(authURL string, user User) (*url.URL, error) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		return nil, err
+	}
+	form := parsed.Query()
+	form.Set("email", user.Email)
+	form.Set("name", user.Name)
+	if user.EmailVerified {
+		form.Set("email_verified", "true")
+	}
+	form.Set("sub", user.Subject)
+
+	req := httptest.NewRequest(http.MethodPost, "/authorize", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	p.authorize(recorder, req)
+	if recorder.Code != http.StatusFound {
+		return nil, fmt.Errorf("authorize answered %d: %s", recorder.Code, strings.TrimSpace(recorder.Body.String()))
+	}
+	return url.Parse(recorder.Header().Get("Location"))
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	publicKey := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize shows the login form on GET and issues a code on POST
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("client_id") != p.options.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(r.Form.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		query := url.Values{}
+		for _, name := range []string{"client_id", "redirect_uri", "state", "nonce", "code_challenge", "code_challenge_method", "scope", "response_type"} {
+			query.Set(name, r.Form.Get(name))
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		loginPage.Execute(w, map[string]interface{}{
+			"ClientID":      p.options.ClientID,
+			"Query":         query,
+			"EmailVerified": p.options.EmailVerified,
+		})
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	callback := redirectURI.Query()
+	callback.Set("state", r.Form.Get("state"))
+	email := strings.TrimSpace(r.Form.Get("email"))
+	switch {
+	case r.Form.Get("response_type") != "code":
+		callback.Set("error", "unsupported_response_type")
+	case r.Form.Get("code_challenge_method") != "S256" || r.Form.Get("code_challenge") == "":
+		callback.Set("error", "invalid_request")
+		callback.Set("error_description", "S256 PKCE is required")
+	case email == "":
+		callback.Set("error", "access_denied")
+	default:
+		user := User{
+			Email:         email,
+			Name:          strings.TrimSpace(r.Form.Get("name")),
+			EmailVerified: r.Form.Get("email_verified") == "true",
+			Subject:       r.Form.Get("sub"),
+		}
+		if user.Subject == "" {
+			user.Subject = "mock|" + strings.ToLower(email)
+		}
+		code := randomString()
+		p.mu.Lock()
+		p.codes[code] = authorization{
+			redirectURI:   redirectURI.String(),
+			codeChallenge: r.Form.Get("code_challenge"),
+			nonce:         r.Form.Get("nonce"),
+			user:          user,
+			expiresAt:     time.Now().Add(time.Minute),
+		}
+		p.mu.Unlock()
+		callback.Set("code", code)
+	}
+	redirectURI.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token redeems a code for an ID token after checking the client and PKCE verifier
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type", "")
+		return
+	}
+
+	clientID, clientSecret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.Form.Get("client_id")
+	}
+	if clientID != p.options.ClientID ||
+		(p.options.ClientSecret != "" && subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.options.ClientSecret)) != 1) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.Form.Get("code")
+	p.mu.Lock()
+	auth, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+	if !ok || time.Now().After(auth.expiresAt) {
+		tokenError(w, "invalid_grant", "unknown or expired code")
+		return
+	}
+	if r.Form.Get("redirect_uri") != auth.redirectURI {
+		tokenError(w, "invalid_grant", "redirect_uri mismatch")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != auth.codeChallenge {
+		tokenError(w, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            auth.user.Subject,
+		"aud":            clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          auth.nonce,
+		"email":          auth.user.Email,
+		"email_verified": auth.user.EmailVerified,
+		"name":           auth.user.Name,
+	})
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	body := map[string]string{"error": code}
+	if description != "" {
+		body["error_description"] = description
+	}
+	writeJSON(w, http.StatusBadRequest, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("oidctest: failed to generate random value: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -1,6 +1,7 @@
 package privacy
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"log"
@@ -21,8 +22,9 @@ func NewRetentionManager(db *sql.DB, anonymizer *Anonymizer) *RetentionManager {
 	}
 }
 
-// ApplyRetentionPolicies applies retention policies to all user data
-func (r *RetentionManager) ApplyRetentionPolicies() error {
+// ApplyRetentionPolicies applies retention policies to all user data.
+// It stops between users when ctx is cancelled so no user is left half processed.
+func (r *RetentionManager) ApplyRetentionPolicies(ctx context.Context) error {
 	// Get all users with their privacy settings
 	rows, err := r.db.Query(`
 		SELECT id, privacy_settings, created_at
@@ -34,6 +36,10 @@ func (r *RetentionManager) ApplyRetentionPolicies() error {
 	defer rows.Close()
 
 	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		var (
 			userID         uint
 			privacySettingsJSON string
@@ -207,17 +213,22 @@ func (r *RetentionManager) applyAttendancesRetentionPolicy(userID uint, privacyS
 	return nil
 }
 
-// ScheduleRetentionJob schedules the retention job to run periodically
-func (r *RetentionManager) ScheduleRetentionJob(interval time.Duration) {
+// RunRetentionJob runs the retention job periodically until ctx is cancelled
+func (r *RetentionManager) RunRetentionJob(ctx context.Context, interval time.Duration) {
 	ticker := time.NewTicker(interval)
-	go func() {
-		for range ticker.C {
+	defer ticker.Stop()
+	log.Printf("Scheduled data retention job to run every %v", interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 			log.Println("Running scheduled data retention job")
-			err := r.ApplyRetentionPolicies()
-			if err != nil {
+			err := r.ApplyRetentionPolicies(ctx)
+			if err != nil && ctx.Err() == nil {
 				log.Printf("Error running retention job: %v", err)
 			}
 		}
-	}()
-	log.Printf("Scheduled data retention job to run every %v", interval)
+	}
 }
\ No newline at end of file
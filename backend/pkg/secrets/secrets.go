@@ -0,0 +1,230 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the length of master and data keys in bytes (AES-256)
+const KeySize = 32
+
+// prefix marks encrypted values; anything else is legacy plain text
+const prefix = "enc:v1:"
+
+var (
+	// ErrUnknownKey is returned for values encrypted with a master key that is not configured
+	ErrUnknownKey = errors.New("secrets: unknown master key")
+	// ErrMalformed is returned for encrypted values that cannot be parsed or authenticated
+	ErrMalformed = errors.New("secrets: malformed encrypted value")
+)
+
+// Keyring encrypts values with envelope encryption. Every value gets its own
+// random data key, which is stored next to the value wrapped with a master
+// key. Rotating the master key only re-wraps the data keys.
+type Keyring struct {
+	keys   map[string][]byte
+	active string
+}
+
+// NewKeyring builds a keyring from base64 encoded 256 bit master keys by key
+// ID. New values are encrypted with the active key; the others can still
+// decrypt values written before a rotation.
+func NewKeyring(masterKeys map[string]string, activeKeyID string) (*Keyring, error) {
+	if len(masterKeys) == 0 {
+		return nil, errors.New("secrets: at least one master key is required")
+	}
+
+	keys := make(map[string][]byte, len(masterKeys))
+	for id, encoded := range masterKeys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("secrets: invalid master key ID %q", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != KeySize {
+			return nil, fmt.Errorf("secrets: master key %q must be %d base64 encoded bytes", id, KeySize)
+		}
+		keys[id] = key
+	}
+	if _, ok := keys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("secrets: active master key %q is not configured", activeKeyID)
+	}
+
+	return &Keyring{keys: keys, active: activeKeyID}, nil
+}
+
+// GenerateKey returns a new random master key, base64 encoded
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ActiveKeyID returns the ID of the master key new values are encrypted with
+func (k *Keyring) ActiveKeyID() string {
+	return k.active
+}
+
+// Encrypt encrypts a value with a new data key wrapped by the active master
+// key. The empty string stays empty so unset credentials remain unset.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(dataKey, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := seal(k.keys[k.active], dataKey, []byte(k.active))
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + k.active + ":" + encode(wrappedKey) + ":" + encode(ciphertext), nil
+}
+
+// Decrypt returns the plain text of an encrypted value. Values that were
+// never encrypted are returned unchanged, so credentials stored before
+// encryption was introduced keep working until they are re-encrypted.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	_, dataKey, ciphertext, err := k.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(dataKey, ciphertext, nil)
+	if err != nil {
+		return "", ErrMalformed
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap re-wraps a value's data key with the active master key and encrypts
+// plain text values. It reports whether the value changed.
+func (k *Keyring) Rewrap(value string) (string, bool, error) {
+	if value == "" {
+		return value, false, nil
+	}
+	if !IsEncrypted(value) {
+		encrypted, err := k.Encrypt(value)
+		return encrypted, err == nil, err
+	}
+
+	keyID, dataKey, ciphertext, err := k.unwrap(value)
+	if err != nil {
+		return "", false, err
+	}
+	if keyID == k.active {
+		return value, false, nil
+	}
+
+	wrappedKey, err := seal(k.keys[k.active], dataKey, []byte(k.active))
+	if err != nil {
+		return "", false, err
+	}
+	return prefix + k.active + ":" + encode(wrappedKey) + ":" + encode(ciphertext), true, nil
+}
+
+// unwrap parses an encrypted value and decrypts its data key
+func (k *Keyring) unwrap(value string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrMalformed
+	}
+
+	keyID := parts[0]
+	masterKey, ok := k.keys[keyID]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+
+	wrappedKey, err := decode(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	ciphertext, err := decode(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+
+	dataKey, err := open(masterKey, wrappedKey, []byte(keyID))
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return keyID, dataKey, ciphertext, nil
+}
+
+// IsEncrypted reports whether a stored value was written by a Keyring
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Mask hides a credential for display, keeping the last four characters of
+// values long enough that this reveals little
+func Mask(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) < 12 {
+		return "****"
+	}
+	return "****" + value[len(value)-4:]
+}
+
+// seal encrypts with AES-GCM and prepends the nonce
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open reverses seal
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(value)
+}
@@ -0,0 +1,225 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func mustGenerateKey(t *testing.T) string {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return key
+}
+
+func mustKeyring(t *testing.T, keys map[string]string, active string) *Keyring {
+	t.Helper()
+	keyring, err := NewKeyring(keys, active)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return keyring
+}
+
+func TestNewKeyring(t *testing.T) {
+	key := mustGenerateKey(t)
+	short := base64.StdEncoding.EncodeToString([]byte("too short"))
+
+	tests := []struct {
+		name    string
+		keys    map[string]string
+		active  string
+		wantErr bool
+	}{
+		{name: "valid", keys: map[string]string{"k1": key}, active: "k1"},
+		{name: "no keys", keys: map[string]string{}, active: "k1", wantErr: true},
+		{name: "active key missing", keys: map[string]string{"k1": key}, active: "k2", wantErr: true},
+		{name: "short key", keys: map[string]string{"k1": short}, active: "k1", wantErr: true},
+		{name: "key not base64", keys: map[string]string{"k1": "not base64!"}, active: "k1", wantErr: true},
+		{name: "empty key ID", keys: map[string]string{"": key}, active: "", wantErr: true},
+		{name: "key ID with separator", keys: map[string]string{"k:1": key}, active: "k:1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyring(tt.keys, tt.active)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewKeyring err = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	keyring := mustKeyring(t, map[string]string{"k1": mustGenerateKey(t)}, "k1")
+
+	for _, plaintext := range []string{"pat-na1-1234", "ünïcödé secret", strings.Repeat("x", 4096)} {
+		encrypted, err := keyring.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt: %v", err)
+		}
+		if !IsEncrypted(encrypted) || strings.Contains(encrypted, plaintext) || !strings.HasPrefix(encrypted, "enc:v1:k1:") {
+			t.Errorf("Encrypt(%.12q) = %.40q, want an opaque value under key k1", plaintext, encrypted)
+		}
+		decrypted, err := keyring.Decrypt(encrypted)
+		if err != nil || decrypted != plaintext {
+			t.Errorf("Decrypt = %.12q, %v; want %.12q", decrypted, err, plaintext)
+		}
+	}
+
+	first, _ := keyring.Encrypt("same")
+	second, _ := keyring.Encrypt("same")
+	if first == second {
+		t.Error("encrypting a value twice gave the same ciphertext")
+	}
+
+	if encrypted, err := keyring.Encrypt(""); err != nil || encrypted != "" {
+		t.Errorf("Encrypt(\"\") = %q, %v; want the empty string", encrypted, err)
+	}
+}
+
+func TestDecryptPassesLegacyPlainText(t *testing.T) {
+	keyring := mustKeyring(t, map[string]string{"k1": mustGenerateKey(t)}, "k1")
+
+	for _, value := range []string{"", "legacy-api-key", "enc:v0:not ours"} {
+		decrypted, err := keyring.Decrypt(value)
+		if err != nil || decrypted != value {
+			t.Errorf("Decrypt(%q) = %q, %v; want it unchanged", value, decrypted, err)
+		}
+	}
+}
+
+func TestDecryptRejectsTamperedValues(t *testing.T) {
+	keyring := mustKeyring(t, map[string]string{"k1": mustGenerateKey(t), "k2": mustGenerateKey(t)}, "k1")
+	encrypted, err := keyring.Encrypt("pat-na1-1234")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	parts := strings.Split(strings.TrimPrefix(encrypted, prefix), ":")
+	keyID, wrappedKey, ciphertext := parts[0], parts[1], parts[2]
+
+	// flip changes the first character of an encoded part
+	flip := func(part string) string {
+		if part[0] == 'A' {
+			return "B" + part[1:]
+		}
+		return "A" + part[1:]
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr error
+	}{
+		{name: "tampered ciphertext", value: prefix + keyID + ":" + wrappedKey + ":" + flip(ciphertext), wantErr: ErrMalformed},
+		{name: "tampered data key", value: prefix + keyID + ":" + flip(wrappedKey) + ":" + ciphertext, wantErr: ErrMalformed},
+		{name: "relabelled with another key", value: prefix + "k2:" + wrappedKey + ":" + ciphertext, wantErr: ErrMalformed},
+		{name: "truncated", value: prefix + keyID + ":" + wrappedKey, wantErr: ErrMalformed},
+		{name: "not base64", value: prefix + keyID + ":" + wrappedKey + ":***", wantErr: ErrMalformed},
+		{name: "too short for a nonce", value: prefix + keyID + ":" + wrappedKey + ":AAAA", wantErr: ErrMalformed},
+		{name: "unknown key", value: prefix + "k9:" + wrappedKey + ":" + ciphertext, wantErr: ErrUnknownKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decrypted, err := keyring.Decrypt(tt.value)
+			if !errors.Is(err, tt.wantErr) || decrypted != "" {
+				t.Errorf("Decrypt = %q, %v; want %v", decrypted, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecryptWithWrongMasterKey(t *testing.T) {
+	original := mustKeyring(t, map[string]string{"k1": mustGenerateKey(t)}, "k1")
+	encrypted, err := original.Encrypt("pat-na1-1234")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	// Same key ID, different key material
+	other := mustKeyring(t, map[string]string{"k1": mustGenerateKey(t)}, "k1")
+	if _, err := other.Decrypt(encrypted); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Decrypt with another k1 = %v, want ErrMalformed", err)
+	}
+	// The key was removed from the configuration
+	rotated := mustKeyring(t, map[string]string{"k2": mustGenerateKey(t)}, "k2")
+	if _, err := rotated.Decrypt(encrypted); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt without k1 = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	oldKey, newKey := mustGenerateKey(t), mustGenerateKey(t)
+	before := mustKeyring(t, map[string]string{"old": oldKey}, "old")
+	onOldKey, err := before.Encrypt("old secret")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	rotating := mustKeyring(t, map[string]string{"old": oldKey, "new": newKey}, "new")
+	onNewKey, err := rotating.Encrypt("new secret")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		value       string
+		wantChanged bool
+		wantPlain   string
+	}{
+		{name: "value on the retired key", value: onOldKey, wantChanged: true, wantPlain: "old secret"},
+		{name: "value on the active key", value: onNewKey, wantChanged: false, wantPlain: "new secret"},
+		{name: "legacy plain text", value: "plain secret", wantChanged: true, wantPlain: "plain secret"},
+		{name: "empty", value: "", wantChanged: false, wantPlain: ""},
+	}
+
+	// Once every value is re-wrapped the retired key can be dropped
+	after := mustKeyring(t, map[string]string{"new": newKey}, "new")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewrapped, changed, err := rotating.Rewrap(tt.value)
+			if err != nil {
+				t.Fatalf("Rewrap: %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !changed && rewrapped != tt.value {
+				t.Errorf("unchanged value was rewritten to %q", rewrapped)
+			}
+			if tt.value != "" && !strings.HasPrefix(rewrapped, "enc:v1:new:") {
+				t.Errorf("Rewrap = %.20q, want it under the active key", rewrapped)
+			}
+			if plain, err := after.Decrypt(rewrapped); err != nil || plain != tt.wantPlain {
+				t.Errorf("Decrypt after rotation = %q, %v; want %q", plain, err, tt.wantPlain)
+			}
+		})
+	}
+
+	if _, _, err := rotating.Rewrap(prefix + "gone:AAAA:AAAA"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Rewrap of a value on an unknown key = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "", want: ""},
+		{value: "short", want: "****"},
+		{value: "pat-na1-12345678", want: "****5678"},
+	}
+	for _, tt := range tests {
+		if got := Mask(tt.value); got != tt.want {
+			t.Errorf("Mask(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
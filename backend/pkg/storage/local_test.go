@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorageRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStorage(filepath.Join(t.TempDir(), "exports"))
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+
+	const content = "id,name\n1,Acme\n"
+	if err := store.Put(ctx, "/brands/1/report.csv", strings.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	body, size, err := store.Open(ctx, "brands/1/report.csv")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil || string(data) != content || size != int64(len(content)) {
+		t.Errorf("Open = %q (%d bytes), %v; want %q", data, size, err, content)
+	}
+
+	if err := store.Delete(ctx, "brands/1/report.csv"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, err := store.Open(ctx, "brands/1/report.csv"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open after Delete: err = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "brands/1/report.csv"); err != nil {
+		t.Errorf("deleting a missing object: %v", err)
+	}
+}
+
+func TestLocalStorageRejectsPathTraversal(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+	root := filepath.Join(base, "exports")
+	store, err := NewLocalStorage(root)
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	secret := filepath.Join(base, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+
+	keys := []string{
+		"",
+		"/",
+		"../secret.txt",
+		"brands/../../secret.txt",
+		"brands/./report.csv",
+		"brands//report.csv",
+		"brands/..",
+	}
+	for _, key := range keys {
+		t.Run(key, func(t *testing.T) {
+			if err := store.Put(ctx, key, strings.NewReader("x"), 1); err == nil {
+				t.Error("Put accepted the key")
+			}
+			if body, _, err := store.Open(ctx, key); err == nil {
+				body.Close()
+				t.Error("Open accepted the key")
+			}
+			if err := store.Delete(ctx, key); err == nil {
+				t.Error("Delete accepted the key")
+			}
+		})
+	}
+
+	if data, err := os.ReadFile(secret); err != nil || string(data) != "secret" {
+		t.Errorf("file outside the root changed: %q, %v", data, err)
+	}
+}
+
+func TestLocalStoragePutStopsOnCancel(t *testing.T) {
+	store, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := store.Put(ctx, "report.csv", strings.NewReader("data"), 4); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Put: err = %v, want context.Canceled", err)
+	}
+	if _, _, err := store.Open(context.Background(), "report.csv"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("a cancelled upload left a file: err = %v", err)
+	}
+}
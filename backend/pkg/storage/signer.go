@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrLinkExpired      = errors.New("link expired")
+)
+
+// URLSigner creates and checks HMAC signatures for expiring download links
+type URLSigner struct {
+	secret []byte
+}
+
+// NewURLSigner creates a signer with the given secret
+func NewURLSigner(secret string) *URLSigner {
+	return &URLSigner{secret: []byte(secret)}
+}
+
+// Sign returns the signature granting access to resource until expiresAt
+func (s *URLSigner) Sign(resource string, expiresAt time.Time) string {
+	return s.signature(resource, expiresAt.Unix())
+}
+
+// Verify checks a signature and its expiry, given as a Unix timestamp
+func (s *URLSigner) Verify(resource string, expires int64, signature string) error {
+	expected := s.signature(resource, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() > expires {
+		return ErrLinkExpired
+	}
+	return nil
+}
+
+func (s *URLSigner) signature(resource string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(resource + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
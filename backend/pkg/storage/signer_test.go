@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestURLSignerVerify(t *testing.T) {
+	signer := NewURLSigner("download-secret")
+	resource := "exports/42/report.csv"
+	valid := time.Now().Add(time.Hour).Unix()
+	expired := time.Now().Add(-time.Minute).Unix()
+
+	tests := []struct {
+		name      string
+		resource  string
+		expires   int64
+		signature string
+		wantErr   error
+	}{
+		{name: "valid", resource: resource, expires: valid, signature: signer.Sign(resource, time.Unix(valid, 0))},
+		{name: "expired", resource: resource, expires: expired, signature: signer.Sign(resource, time.Unix(expired, 0)), wantErr: ErrLinkExpired},
+		{name: "expiry extended", resource: resource, expires: valid + 3600, signature: signer.Sign(resource, time.Unix(valid, 0)), wantErr: ErrInvalidSignature},
+		{name: "expired link with extended expiry", resource: resource, expires: valid, signature: signer.Sign(resource, time.Unix(expired, 0)), wantErr: ErrInvalidSignature},
+		{name: "other resource", resource: "exports/43/report.csv", expires: valid, signature: signer.Sign(resource, time.Unix(valid, 0)), wantErr: ErrInvalidSignature},
+		{name: "other secret", resource: resource, expires: valid, signature: NewURLSigner("other-secret").Sign(resource, time.Unix(valid, 0)), wantErr: ErrInvalidSignature},
+		{name: "tampered signature", resource: resource, expires: valid, signature: "00" + signer.Sign(resource, time.Unix(valid, 0))[2:], wantErr: ErrInvalidSignature},
+		{name: "empty signature", resource: resource, expires: valid, wantErr: ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := signer.Verify(tt.resource, tt.expires, tt.signature); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
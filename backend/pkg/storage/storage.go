@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotFound is returned when an object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// Storage stores opaque objects under slash-separated keys
+type Storage interface {
+	// Put writes an object. size may be -1 when unknown; backends that need
+	// a length buffer the body first.
+	Put(ctx context.Context, key string, body io.Reader, size int64) error
+	// Open returns a reader for an object and its size
+	Open(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	// Delete removes an object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Config selects and configures a storage backend
+type Config struct {
+	Backend string      `json:"backend"` // "local" or "s3"
+	Local   LocalConfig `json:"local"`
+	S3      S3Config    `json:"s3"`
+}
+
+// New creates the backend selected in the config
+func New(config Config) (Storage, error) {
+	switch config.Backend {
+	case "", "local":
+		return NewLocalStorage(config.Local.Dir)
+	case "s3":
+		return NewS3Storage(config.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", config.Backend)
+	}
+}
+
+// cleanKey rejects keys that could escape the storage root
+func cleanKey(key string) (string, error) {
+	key = strings.TrimPrefix(key, "/")
+	if key == "" {
+		return "", errors.New("empty storage key")
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("invalid storage key: %s", key)
+		}
+	}
+	return key, nil
+}
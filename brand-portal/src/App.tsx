@@ -7,6 +7,8 @@ import React, { useEffect } from 'react';
 import { BrowserRouter as Router, Routes, Route, Navigate } from 'react-router-dom';
 import { AuthService } from './services/AuthService';
 import { LoginPage } from './pages/LoginPage';
+import { AcceptInvitationPage } from './pages/AcceptInvitationPage';
+import { SSOCallbackPage } from './pages/SSOCallbackPage';
 import { DashboardPage } from './pages/DashboardPage';
 import { CampaignManagementPage } from './pages/CampaignManagementPage';
 import { ContentGalleryPage } from './pages/ContentGalleryPage';
@@ -25,6 +27,8 @@ const App: React.FC = () => {
       <div style={styles.app}>
         <Routes>
           <Route path="/login" element={<LoginPage />} />
+          <Route path="/invitations/accept" element={<AcceptInvitationPage />} />
+          <Route path="/sso/callback" element={<SSOCallbackPage />} />
           <Route
             path="/dashboard"
             element={
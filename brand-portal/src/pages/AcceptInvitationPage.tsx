@@ -0,0 +1,169 @@
+/**
+ * Accept Invitation Page
+ * Lets an invited member join a brand and sign in
+ */
+
+import React, { useEffect, useState } from 'react';
+import { useNavigate, useSearchParams } from 'react-router-dom';
+import { AuthService, InvitationPreview } from '../services/AuthService';
+
+export const AcceptInvitationPage: React.FC = () => {
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get('token') || '';
+  const [invitation, setInvitation] = useState<InvitationPreview | null>(null);
+  const [name, setName] = useState('');
+  const [password, setPassword] = useState('');
+  const [loading, setLoading] = useState(false);
+  const [error, setError] = useState('');
+  const navigate = useNavigate();
+
+  useEffect(() => {
+    if (!token) {
+      setError('This invitation link is incomplete');
+      return;
+    }
+    AuthService.previewInvitation(token)
+      .then(setInvitation)
+      .catch(() => setError('This invitation is invalid, expired or already used'));
+  }, [token]);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setLoading(true);
+    setError('');
+
+    try {
+      await AuthService.acceptInvitation({ token, name, password });
+      navigate('/dashboard');
+    } catch (err: any) {
+      setError(err.response?.data?.error || 'Failed to accept invitation');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div style={styles.container}>
+      <div style={styles.box}>
+        <h1 style={styles.title}>Brand Portal</h1>
+        {invitation ? (
+          <p style={styles.subtitle}>
+            Join {invitation.brandName} as {invitation.role}
+          </p>
+        ) : (
+          <p style={styles.subtitle}>{error ? '' : 'Loading invitation...'}</p>
+        )}
+
+        {invitation && (
+          <form onSubmit={handleSubmit} style={styles.form}>
+            <div style={styles.field}>
+              <label style={styles.label}>Email</label>
+              <input type="email" value={invitation.email} style={styles.input} disabled />
+            </div>
+
+            {!invitation.accountExists && (
+              <div style={styles.field}>
+                <label style={styles.label}>Name</label>
+                <input
+                  type="text"
+                  value={name}
+                  onChange={(e) => setName(e.target.value)}
+                  style={styles.input}
+                  required
+                />
+              </div>
+            )}
+
+            <div style={styles.field}>
+              <label style={styles.label}>
+                {invitation.accountExists ? 'Password of your account' : 'Choose a password'}
+              </label>
+              <input
+                type="password"
+                value={password}
+                onChange={(e) => setPassword(e.target.value)}
+                style={styles.input}
+                minLength={invitation.accountExists ? undefined : 8}
+                required
+              />
+            </div>
+
+            {error && <div style={styles.error}>{error}</div>}
+
+            <button type="submit" disabled={loading} style={styles.button}>
+              {loading ? 'Joining...' : 'Accept Invitation'}
+            </button>
+          </form>
+        )}
+
+        {!invitation && error && <div style={styles.error}>{error}</div>}
+      </div>
+    </div>
+  );
+};
+
+const styles = {
+  container: {
+    display: 'flex',
+    justifyContent: 'center',
+    alignItems: 'center',
+    minHeight: '100vh',
+    backgroundColor: '#f5f5f5',
+  },
+  box: {
+    backgroundColor: 'white',
+    padding: '2rem',
+    borderRadius: '8px',
+    boxShadow: '0 2px 10px rgba(0,0,0,0.1)',
+    width: '100%',
+    maxWidth: '400px',
+  },
+  title: {
+    fontSize: '2rem',
+    fontWeight: 'bold',
+    textAlign: 'center' as const,
+    marginBottom: '0.5rem',
+    color: '#333',
+  },
+  subtitle: {
+    textAlign: 'center' as const,
+    color: '#666',
+    marginBottom: '2rem',
+  },
+  form: {
+    display: 'flex',
+    flexDirection: 'column' as const,
+    gap: '1rem',
+  },
+  field: {
+    display: 'flex',
+    flexDirection: 'column' as const,
+  },
+  label: {
+    marginBottom: '0.5rem',
+    fontWeight: '500',
+    color: '#333',
+  },
+  input: {
+    padding: '0.75rem',
+    border: '1px solid #ddd',
+    borderRadius: '4px',
+    fontSize: '1rem',
+  },
+  button: {
+    padding: '0.75rem',
+    backgroundColor: '#007AFF',
+    color: 'white',
+    border: 'none',
+    borderRadius: '4px',
+    fontSize: '1rem',
+    fontWeight: '500',
+    cursor: 'pointer',
+    marginTop: '1rem',
+  },
+  error: {
+    color: '#dc3545',
+    fontSize: '0.875rem',
+    textAlign: 'center' as const,
+  },
+};
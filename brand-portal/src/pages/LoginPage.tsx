@@ -3,7 +3,7 @@
  * Authentication interface for brand users
  */
 
-import React, { useState } from 'react';
+import React, { useEffect, useState } from 'react';
 import { useNavigate } from 'react-router-dom';
 import { AuthService } from '../services/AuthService';
 
@@ -12,8 +12,15 @@ export const LoginPage: React.FC = () => {
   const [password, setPassword] = useState('');
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState('');
+  const [ssoEnabled, setSSOEnabled] = useState(false);
   const navigate = useNavigate();
 
+  useEffect(() => {
+    AuthService.isSSOEnabled()
+      .then(setSSOEnabled)
+      .catch(() => setSSOEnabled(false));
+  }, []);
+
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
     setLoading(true);
@@ -23,7 +30,7 @@ export const LoginPage: React.FC = () => {
       await AuthService.login({ email, password });
       navigate('/dashboard');
     } catch (err: any) {
-      setError(err.response?.data?.message || 'Login failed');
+      setError(err.response?.data?.error || 'Login failed');
     } finally {
       setLoading(false);
     }
@@ -68,6 +75,12 @@ export const LoginPage: React.FC = () => {
             {loading ? 'Signing in...' : 'Sign In'}
           </button>
         </form>
+
+        {ssoEnabled && (
+          <a href={AuthService.ssoStartURL('/dashboard')} style={styles.ssoButton}>
+            Sign in with single sign-on
+          </a>
+        )}
       </div>
     </div>
   );
@@ -132,6 +145,18 @@ const styles = {
     cursor: 'pointer',
     marginTop: '1rem',
   },
+  ssoButton: {
+    display: 'block',
+    padding: '0.75rem',
+    border: '1px solid #007AFF',
+    borderRadius: '4px',
+    color: '#007AFF',
+    fontSize: '1rem',
+    fontWeight: '500',
+    textAlign: 'center' as const,
+    textDecoration: 'none',
+    marginTop: '1rem',
+  },
   error: {
     color: '#dc3545',
     fontSize: '0.875rem',
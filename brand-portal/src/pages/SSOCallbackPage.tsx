@@ -0,0 +1,91 @@
+/**
+ * SSO Callback Page
+ * Completes a single sign-on by trading the one-time code for a session
+ */
+
+import React, { useEffect, useRef, useState } from 'react';
+import { Link, useNavigate, useSearchParams } from 'react-router-dom';
+import { AuthService } from '../services/AuthService';
+
+export const SSOCallbackPage: React.FC = () => {
+  const [searchParams] = useSearchParams();
+  const [error, setError] = useState(searchParams.get('error') || '');
+  const exchanged = useRef(false);
+  const navigate = useNavigate();
+
+  useEffect(() => {
+    const code = searchParams.get('code');
+    // Codes work once, so never send one twice
+    if (error || exchanged.current) {
+      return;
+    }
+    if (!code) {
+      setError('This sign-in link is incomplete');
+      return;
+    }
+    exchanged.current = true;
+
+    const redirect = searchParams.get('redirect') || '';
+    AuthService.exchangeSSOCode(code)
+      .then(() => navigate(redirect.startsWith('/') && !redirect.startsWith('//') ? redirect : '/dashboard', { replace: true }))
+      .catch((err: any) => setError(err.response?.data?.error || 'Single sign-on failed, please try again'));
+  }, [searchParams, error, navigate]);
+
+  return (
+    <div style={styles.container}>
+      <div style={styles.box}>
+        <h1 style={styles.title}>Brand Portal</h1>
+        {error ? (
+          <>
+            <div style={styles.error}>{error}</div>
+            <Link to="/login" style={styles.link}>
+              Back to sign in
+            </Link>
+          </>
+        ) : (
+          <p style={styles.subtitle}>Signing in...</p>
+        )}
+      </div>
+    </div>
+  );
+};
+
+const styles = {
+  container: {
+    display: 'flex',
+    justifyContent: 'center',
+    alignItems: 'center',
+    minHeight: '100vh',
+    backgroundColor: '#f5f5f5',
+  },
+  box: {
+    backgroundColor: 'white',
+    padding: '2rem',
+    borderRadius: '8px',
+    boxShadow: '0 2px 10px rgba(0,0,0,0.1)',
+    width: '100%',
+    maxWidth: '400px',
+  },
+  title: {
+    fontSize: '2rem',
+    fontWeight: 'bold',
+    textAlign: 'center' as const,
+    marginBottom: '0.5rem',
+    color: '#333',
+  },
+  subtitle: {
+    textAlign: 'center' as const,
+    color: '#666',
+  },
+  link: {
+    display: 'block',
+    textAlign: 'center' as const,
+    color: '#007AFF',
+    marginTop: '1rem',
+  },
+  error: {
+    color: '#dc3545',
+    fontSize: '0.875rem',
+    textAlign: 'center' as const,
+  },
+};
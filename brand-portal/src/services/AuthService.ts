@@ -3,37 +3,143 @@
  * Handles brand login, token management, and authorization
  */
 
-import axios from 'axios';
+import axios, { AxiosRequestConfig } from 'axios';
 
 interface BrandCredentials {
   email: string;
   password: string;
 }
 
+interface BrandMembership {
+  brandId: string;
+  brandName: string;
+  role: string;
+}
+
 interface BrandUser {
   id: string;
   name: string;
   email: string;
   brandId: string;
   role: string;
+  permissions: string[];
+  brands: BrandMembership[];
+}
+
+export interface InvitationPreview {
+  brandName: string;
+  email: string;
+  role: string;
+  expiresAt: string;
+  accountExists: boolean;
+}
+
+interface InvitationAcceptance {
+  token: string;
+  name?: string;
+  password: string;
+}
+
+interface TokenPair {
+  token: string;
+  refreshToken: string;
 }
 
 export class AuthService {
   private static TOKEN_KEY = 'brand_auth_token';
+  private static REFRESH_TOKEN_KEY = 'brand_refresh_token';
   private static USER_KEY = 'brand_user';
+  private static refreshing: Promise<string> | null = null;
 
   static async login(credentials: BrandCredentials): Promise<BrandUser> {
     const response = await axios.post('/api/v1/brands/login', credentials);
-    const { token, user } = response.data;
+    const { user } = response.data;
     
-    localStorage.setItem(this.TOKEN_KEY, token);
+    this.storeTokens(response.data);
     localStorage.setItem(this.USER_KEY, JSON.stringify(user));
     
     return user;
   }
 
-  static logout(): void {
+  static async previewInvitation(token: string): Promise<InvitationPreview> {
+    const response = await axios.post('/api/v1/brands/invitations/preview', { token });
+    return response.data;
+  }
+
+  // Accepting an invitation joins the brand and signs the member in
+  static async acceptInvitation(acceptance: InvitationAcceptance): Promise<BrandUser> {
+    const response = await axios.post('/api/v1/brands/invitations/accept', acceptance);
+    const { user } = response.data;
+
+    this.storeTokens(response.data);
+    localStorage.setItem(this.USER_KEY, JSON.stringify(user));
+
+    return user;
+  }
+
+  static async isSSOEnabled(): Promise<boolean> {
+    const response = await axios.get('/api/v1/brands/sso');
+    return !!response.data.enabled;
+  }
+
+  // The API redirects the browser to the identity provider and, after the
+  // sign-in, back to /sso/callback with a one-time code
+  static ssoStartURL(redirect?: string): string {
+    const query = redirect ? `?redirect=${encodeURIComponent(redirect)}` : '';
+    return `/api/v1/brands/sso/start${query}`;
+  }
+
+  static async exchangeSSOCode(code: string): Promise<BrandUser> {
+    const response = await axios.post('/api/v1/brands/sso/exchange', { code });
+    const { user } = response.data;
+
+    this.storeTokens(response.data);
+    localStorage.setItem(this.USER_KEY, JSON.stringify(user));
+
+    return user;
+  }
+
+  static hasPermission(permission: string): boolean {
+    return this.getCurrentUser()?.permissions?.includes(permission) ?? false;
+  }
+
+  static async logout(): Promise<void> {
+    const token = this.getToken();
+    this.clearSession();
+    if (token) {
+      // Revoke the session on the server; the local session is gone either way
+      await axios
+        .post('/api/v1/auth/logout', null, { headers: { Authorization: `Bearer ${token}` } })
+        .catch(() => undefined);
+    }
+  }
+
+  // Exchanges the refresh token for a new token pair. Concurrent callers share
+  // one request, as every refresh token can only be used once.
+  static refresh(): Promise<string> {
+    if (!this.refreshing) {
+      const refreshToken = localStorage.getItem(this.REFRESH_TOKEN_KEY);
+      this.refreshing = (refreshToken
+        ? axios.post('/api/v1/auth/refresh', { refreshToken }).then((response) => {
+            this.storeTokens(response.data);
+            return response.data.token as string;
+          })
+        : Promise.reject(new Error('No refresh token'))
+      ).finally(() => {
+        this.refreshing = null;
+      });
+    }
+    return this.refreshing;
+  }
+
+  private static storeTokens(pair: TokenPair): void {
+    localStorage.setItem(this.TOKEN_KEY, pair.token);
+    localStorage.setItem(this.REFRESH_TOKEN_KEY, pair.refreshToken);
+  }
+
+  private static clearSession(): void {
     localStorage.removeItem(this.TOKEN_KEY);
+    localStorage.removeItem(this.REFRESH_TOKEN_KEY);
     localStorage.removeItem(this.USER_KEY);
   }
 
@@ -53,7 +159,7 @@ export class AuthService {
   static setupAxiosInterceptors(): void {
     axios.interceptors.request.use((config) => {
       const token = this.getToken();
-      if (token) {
+      if (token && !config.headers.Authorization) {
         config.headers.Authorization = `Bearer ${token}`;
       }
       return config;
@@ -61,11 +167,27 @@ export class AuthService {
 
     axios.interceptors.response.use(
       (response) => response,
-      (error) => {
-        if (error.response?.status === 401) {
-          this.logout();
-          window.location.href = '/login';
+      async (error) => {
+        const request: (AxiosRequestConfig & { retried?: boolean }) | undefined = error.config;
+        const isAuthRequest = request?.url?.startsWith('/api/v1/auth/') || request?.url?.startsWith('/api/v1/brands/');
+        if (error.response?.status !== 401 || !request || isAuthRequest) {
+          return Promise.reject(error);
         }
+
+        // Retry once with a fresh access token before sending the user to the login page
+        if (!request.retried) {
+          request.retried = true;
+          try {
+            const token = await this.refresh();
+            request.headers = { ...request.headers, Authorization: `Bearer ${token}` };
+            return axios(request);
+          } catch {
+            // fall through to the login page
+          }
+        }
+
+        this.clearSession();
+        window.location.href = '/login';
         return Promise.reject(error);
       }
     );
@@ -0,0 +1,35 @@
+-- Campaign Management Migration
+-- Extends campaigns with a lifecycle, budget tracking and event linking
+
+-- Lifecycle and budget columns on the existing campaigns table
+ALTER TABLE campaigns ADD COLUMN status TEXT DEFAULT 'draft'; -- 'draft', 'scheduled', 'active', 'completed'
+ALTER TABLE campaigns ADD COLUMN budget REAL DEFAULT 0;
+ALTER TABLE campaigns ADD COLUMN archived_at DATETIME;
+ALTER TABLE campaigns ADD COLUMN updated_at DATETIME;
+
+-- Events linked to a campaign (many events per campaign)
+CREATE TABLE IF NOT EXISTS campaign_events (
+    campaign_id INTEGER NOT NULL,
+    event_id TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (campaign_id, event_id),
+    FOREIGN KEY (campaign_id) REFERENCES campaigns(id) ON DELETE CASCADE,
+    FOREIGN KEY (event_id) REFERENCES events(id)
+);
+
+-- Spend recorded against a campaign budget
+CREATE TABLE IF NOT EXISTS campaign_expenses (
+    id TEXT PRIMARY KEY,
+    campaign_id INTEGER NOT NULL,
+    amount REAL NOT NULL,
+    category TEXT,
+    description TEXT,
+    incurred_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (campaign_id) REFERENCES campaigns(id) ON DELETE CASCADE
+);
+
+-- Indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_campaigns_status ON campaigns(brand_id, status);
+CREATE INDEX IF NOT EXISTS idx_campaign_events_event ON campaign_events(event_id);
+CREATE INDEX IF NOT EXISTS idx_campaign_expenses_campaign ON campaign_expenses(campaign_id);
@@ -0,0 +1,12 @@
+-- Export Storage Migration
+-- Tracks where export files are stored so they can be downloaded and garbage-collected
+
+ALTER TABLE export_requests ADD COLUMN export_request_id TEXT;
+ALTER TABLE export_requests ADD COLUMN file_path TEXT; -- storage key of the generated file
+ALTER TABLE export_requests ADD COLUMN error_message TEXT;
+ALTER TABLE export_requests ADD COLUMN downloaded_at DATETIME;
+
+-- Sample exports were never written to storage
+UPDATE export_requests SET file_url = NULL WHERE file_url LIKE 'https://exports.lynkr.com/%';
+
+CREATE INDEX IF NOT EXISTS idx_export_requests_expiry ON export_requests(status, expires_at);
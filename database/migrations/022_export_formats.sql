@@ -0,0 +1,44 @@
+-- Export Formats Migration
+-- Drops the format CHECK on export_requests so any registered export format
+-- (csv, json, ndjson, xlsx, parquet, ...) can be stored. SQLite cannot alter
+-- a CHECK constraint, so the table is rebuilt.
+
+CREATE TABLE export_requests_new (
+    id TEXT PRIMARY KEY,
+    export_request_id TEXT,
+    brand_id TEXT NOT NULL,
+    event_id TEXT,
+    data_type TEXT NOT NULL CHECK (data_type IN ('attendance', 'content', 'analytics', 'feedback', 'all')),
+    format TEXT NOT NULL, -- validated against the registered export formats
+    status TEXT DEFAULT 'processing' CHECK (status IN ('processing', 'completed', 'failed', 'expired')),
+    file_url TEXT,
+    file_path TEXT, -- storage key of the generated file
+    file_size INTEGER DEFAULT 0,
+    record_count INTEGER DEFAULT 0,
+    error_message TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    completed_at DATETIME,
+    expires_at DATETIME NOT NULL,
+    downloaded_at DATETIME,
+    FOREIGN KEY (brand_id) REFERENCES brands(id),
+    FOREIGN KEY (event_id) REFERENCES events(id)
+);
+
+INSERT INTO export_requests_new (
+    id, export_request_id, brand_id, event_id, data_type, format, status, file_url, file_path,
+    file_size, record_count, error_message, created_at, completed_at, expires_at, downloaded_at
+)
+SELECT
+    id, export_request_id, brand_id, event_id, data_type, format, status, file_url, file_path,
+    file_size, record_count, error_message, created_at, completed_at,
+    COALESCE(expires_at, datetime(created_at, '+7 days'), datetime('now', '+7 days')), downloaded_at
+FROM export_requests;
+
+DROP TABLE export_requests;
+ALTER TABLE export_requests_new RENAME TO export_requests;
+
+CREATE INDEX IF NOT EXISTS idx_export_requests_brand ON export_requests(brand_id);
+CREATE INDEX IF NOT EXISTS idx_export_requests_status ON export_requests(status);
+CREATE INDEX IF NOT EXISTS idx_export_requests_created ON export_requests(created_at);
+CREATE INDEX IF NOT EXISTS idx_export_requests_brand_status ON export_requests(brand_id, status);
+CREATE INDEX IF NOT EXISTS idx_export_requests_expiry ON export_requests(status, expires_at);
@@ -0,0 +1,5 @@
+-- Export Options Migration
+-- Stores the full export spec (data types, events, campaign, date range and
+-- field selection) so one request can cover several datasets and events
+
+ALTER TABLE export_requests ADD COLUMN options TEXT; -- JSON encoded export spec
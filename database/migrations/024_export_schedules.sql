@@ -0,0 +1,16 @@
+-- Export Schedules Migration
+-- Recurring exports run from scheduled_exports and each run is an export
+-- request, so runs show up in status polling and in the schedule's history
+
+ALTER TABLE scheduled_exports ADD COLUMN options TEXT; -- JSON encoded export spec
+ALTER TABLE scheduled_exports ADD COLUMN incremental INTEGER DEFAULT 0; -- each run covers the time since the previous run
+ALTER TABLE scheduled_exports ADD COLUMN delivery TEXT; -- JSON encoded delivery target
+ALTER TABLE scheduled_exports ADD COLUMN last_error TEXT;
+ALTER TABLE scheduled_exports ADD COLUMN updated_at DATETIME;
+
+ALTER TABLE export_requests ADD COLUMN schedule_id TEXT;
+ALTER TABLE export_requests ADD COLUMN delivery_status TEXT; -- pending, delivered or failed
+ALTER TABLE export_requests ADD COLUMN delivery_error TEXT;
+ALTER TABLE export_requests ADD COLUMN delivered_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_export_requests_schedule ON export_requests(schedule_id, created_at);
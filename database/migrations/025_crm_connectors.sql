@@ -0,0 +1,39 @@
+-- CRM Connectors Migration
+-- Drops the crm_type CHECK on crm_integrations so any registered CRM connector
+-- can be stored, and adds per-integration base URLs, connector settings and
+-- field mappings. SQLite cannot alter a CHECK constraint, so the table is rebuilt.
+
+CREATE TABLE crm_integrations_new (
+    id TEXT PRIMARY KEY,
+    brand_id TEXT NOT NULL,
+    crm_type TEXT NOT NULL, -- validated against the registered CRM connectors
+    api_key TEXT NOT NULL,
+    api_secret TEXT,
+    webhook_url TEXT,
+    base_url TEXT, -- API origin, defaults to the connector's public API
+    settings TEXT, -- JSON encoded connector settings, e.g. {"list_id": "..."}
+    field_mapping TEXT, -- JSON encoded map of Lynkr attributes to CRM fields
+    sync_interval INTEGER DEFAULT 60, -- minutes
+    last_sync DATETIME,
+    status TEXT DEFAULT 'active' CHECK (status IN ('active', 'inactive', 'error')),
+    error_message TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (brand_id) REFERENCES brands(id),
+    UNIQUE(brand_id, crm_type)
+);
+
+INSERT INTO crm_integrations_new (
+    id, brand_id, crm_type, api_key, api_secret, webhook_url, sync_interval, last_sync,
+    status, error_message, created_at, updated_at
+)
+SELECT id, brand_id, crm_type, api_key, api_secret, webhook_url, sync_interval, last_sync,
+       status, error_message, created_at, updated_at
+FROM crm_integrations;
+
+DROP TABLE crm_integrations;
+ALTER TABLE crm_integrations_new RENAME TO crm_integrations;
+
+CREATE INDEX IF NOT EXISTS idx_crm_integrations_brand ON crm_integrations(brand_id);
+CREATE INDEX IF NOT EXISTS idx_crm_integrations_type ON crm_integrations(crm_type);
+CREATE INDEX IF NOT EXISTS idx_crm_integrations_brand_status ON crm_integrations(brand_id, status);
@@ -0,0 +1,24 @@
+-- CRM Sync Ledger Migration
+-- Records what was last pushed to a CRM per contact, so syncs only send
+-- changed fields, and adds per-run counts of skipped and failed contacts.
+
+CREATE TABLE IF NOT EXISTS crm_sync_ledger (
+    integration_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    email TEXT NOT NULL, -- the email address the contact was upserted on
+    external_id TEXT, -- the CRM's record ID, when the CRM reports it
+    fields TEXT NOT NULL DEFAULT '{}', -- JSON encoded CRM fields as last accepted by the CRM
+    status TEXT NOT NULL CHECK (status IN ('synced', 'failed')),
+    last_error TEXT,
+    synced_at DATETIME, -- last successful push
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (integration_id, user_id),
+    FOREIGN KEY (integration_id) REFERENCES crm_integrations(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_crm_sync_ledger_status ON crm_sync_ledger(integration_id, status);
+
+ALTER TABLE crm_sync_logs ADD COLUMN records_skipped INTEGER DEFAULT 0;
+ALTER TABLE crm_sync_logs ADD COLUMN records_failed INTEGER DEFAULT 0;
+ALTER TABLE crm_sync_logs ADD COLUMN failures TEXT; -- JSON encoded list of failed contacts and their errors
@@ -0,0 +1,20 @@
+-- Product Catalog Migration
+-- Keeps the products table in sync with connected stores: removed products
+-- are soft-deleted, price changes are kept in a history table and every
+-- integration gets its own catalog sync interval
+
+ALTER TABLE products ADD COLUMN deleted_at DATETIME; -- set when the product disappears from the store
+ALTER TABLE products ADD COLUMN last_synced_at DATETIME; -- last catalog sync that saw the product
+
+ALTER TABLE ecommerce_integrations ADD COLUMN sync_interval INTEGER DEFAULT 360; -- minutes between catalog syncs
+
+CREATE TABLE IF NOT EXISTS product_price_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id TEXT NOT NULL,
+    price REAL NOT NULL,
+    recorded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_price_history_product ON product_price_history(product_id, recorded_at);
+CREATE INDEX IF NOT EXISTS idx_products_brand_deleted ON products(brand_id, deleted_at);
@@ -0,0 +1,12 @@
+-- E-commerce Webhooks Migration
+-- Stores every order webhook a store delivers once, keyed by the store's
+-- delivery ID, and lets purchases recorded from store orders be updated in
+-- order of the store's changes
+
+ALTER TABLE webhook_events ADD COLUMN delivery_id TEXT; -- store delivery ID, the same on redelivery
+ALTER TABLE webhook_events ADD COLUMN last_error TEXT;
+
+ALTER TABLE purchases ADD COLUMN order_updated_at DATETIME; -- store update time of the order last applied
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_events_delivery ON webhook_events(integration_id, delivery_id);
+CREATE INDEX IF NOT EXISTS idx_purchases_external_order ON purchases(external_order_id);
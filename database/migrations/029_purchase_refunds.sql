@@ -0,0 +1,68 @@
+-- Purchase Refunds Migration
+-- Tracks refunds and cancellations of purchases so analytics can report net
+-- revenue next to gross revenue. Adds the partially_refunded status, the
+-- refunded amount of every purchase, the integration store orders came from,
+-- a ledger of the refunds applied and the time of each integration's last
+-- order reconciliation.
+-- SQLite cannot alter a CHECK constraint, so the purchases table is rebuilt.
+
+CREATE TABLE purchases_new (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    product_id TEXT NOT NULL,
+    event_id TEXT,
+    integration_id TEXT, -- store the order came from, NULL for purchases tracked in the app
+    external_order_id TEXT,
+    amount REAL NOT NULL, -- gross amount paid, never reduced by refunds
+    refunded_amount REAL NOT NULL DEFAULT 0,
+    currency TEXT DEFAULT 'USD',
+    status TEXT DEFAULT 'completed' CHECK (status IN ('pending', 'completed', 'partially_refunded', 'refunded', 'cancelled')),
+    attribution_data TEXT, -- JSON with attribution details
+    order_updated_at DATETIME, -- store update time of the order last applied
+    cancelled_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (product_id) REFERENCES products(id),
+    FOREIGN KEY (event_id) REFERENCES events(id),
+    FOREIGN KEY (integration_id) REFERENCES ecommerce_integrations(id)
+);
+
+INSERT INTO purchases_new (
+    id, user_id, product_id, event_id, integration_id, external_order_id, amount, refunded_amount, currency,
+    status, attribution_data, order_updated_at, created_at, updated_at
+)
+SELECT id, user_id, product_id, event_id,
+       CASE WHEN order_updated_at IS NOT NULL THEN (SELECT pr.integration_id FROM products pr WHERE pr.id = purchases.product_id) END,
+       external_order_id, amount,
+       CASE WHEN status = 'refunded' THEN amount ELSE 0 END, currency,
+       status, attribution_data, order_updated_at, created_at, created_at
+FROM purchases;
+
+DROP TABLE purchases;
+ALTER TABLE purchases_new RENAME TO purchases;
+
+CREATE INDEX IF NOT EXISTS idx_purchases_user ON purchases(user_id);
+CREATE INDEX IF NOT EXISTS idx_purchases_event ON purchases(event_id);
+CREATE INDEX IF NOT EXISTS idx_purchases_created ON purchases(created_at);
+CREATE INDEX IF NOT EXISTS idx_purchases_integration_order ON purchases(integration_id, external_order_id);
+
+-- One row per refund applied to a purchase. Refunds reported by the store
+-- carry its refund ID, so a refund seen by both a webhook and a reconciliation
+-- is only applied once.
+CREATE TABLE IF NOT EXISTS purchase_refunds (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    purchase_id TEXT NOT NULL,
+    external_refund_id TEXT NOT NULL,
+    amount REAL NOT NULL,
+    reason TEXT,
+    source TEXT NOT NULL, -- webhook, reconciliation or manual
+    refunded_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (purchase_id) REFERENCES purchases(id),
+    UNIQUE(purchase_id, external_refund_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchase_refunds_purchase ON purchase_refunds(purchase_id);
+
+ALTER TABLE ecommerce_integrations ADD COLUMN last_order_sync DATETIME; -- last reconciliation against the store's orders
@@ -0,0 +1,120 @@
+-- Multi-currency Migration
+-- Stores purchase, refund and discount redemption amounts as integer minor
+-- units (cents for USD, yen for JPY, fils for KWD) with their currency, adds
+-- the exchange rates analytics convert with and the currency each brand
+-- reports in.
+-- SQLite cannot change a column's type, so the tables are rebuilt. Existing
+-- amounts are converted with the exponent of their currency.
+
+CREATE TABLE purchases_new (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    product_id TEXT NOT NULL,
+    event_id TEXT,
+    integration_id TEXT, -- store the order came from, NULL for purchases tracked in the app
+    external_order_id TEXT,
+    amount_minor INTEGER NOT NULL, -- gross amount paid in minor units, never reduced by refunds
+    refunded_minor INTEGER NOT NULL DEFAULT 0,
+    currency TEXT NOT NULL DEFAULT 'USD', -- ISO 4217 code
+    status TEXT DEFAULT 'completed' CHECK (status IN ('pending', 'completed', 'partially_refunded', 'refunded', 'cancelled')),
+    attribution_data TEXT, -- JSON with attribution details
+    order_updated_at DATETIME, -- store update time of the order last applied
+    cancelled_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (product_id) REFERENCES products(id),
+    FOREIGN KEY (event_id) REFERENCES events(id),
+    FOREIGN KEY (integration_id) REFERENCES ecommerce_integrations(id)
+);
+
+INSERT INTO purchases_new (
+    id, user_id, product_id, event_id, integration_id, external_order_id, amount_minor, refunded_minor, currency,
+    status, attribution_data, order_updated_at, cancelled_at, created_at, updated_at
+)
+SELECT id, user_id, product_id, event_id, integration_id, external_order_id,
+       CAST(ROUND(amount * scale) AS INTEGER), CAST(ROUND(refunded_amount * scale) AS INTEGER), currency_code,
+       status, attribution_data, order_updated_at, cancelled_at, created_at, updated_at
+FROM (
+    SELECT *, UPPER(COALESCE(currency, 'USD')) AS currency_code,
+           CASE
+               WHEN UPPER(COALESCE(currency, 'USD')) IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+               WHEN UPPER(COALESCE(currency, 'USD')) IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000
+               ELSE 100
+           END AS scale
+    FROM purchases
+);
+
+-- Refund rows are converted with the currency of their purchase
+CREATE TABLE purchase_refunds_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    purchase_id TEXT NOT NULL,
+    external_refund_id TEXT NOT NULL,
+    amount_minor INTEGER NOT NULL, -- in the currency of the purchase
+    reason TEXT,
+    source TEXT NOT NULL, -- webhook, reconciliation or manual
+    refunded_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (purchase_id) REFERENCES purchases(id),
+    UNIQUE(purchase_id, external_refund_id)
+);
+
+INSERT INTO purchase_refunds_new (id, purchase_id, external_refund_id, amount_minor, reason, source, refunded_at, created_at)
+SELECT r.id, r.purchase_id, r.external_refund_id,
+       CAST(ROUND(r.amount * CASE
+           WHEN p.currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+           WHEN p.currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000
+           ELSE 100
+       END) AS INTEGER),
+       r.reason, r.source, r.refunded_at, r.created_at
+FROM purchase_refunds r
+LEFT JOIN purchases_new p ON p.id = r.purchase_id;
+
+DROP TABLE purchase_refunds;
+DROP TABLE purchases;
+ALTER TABLE purchases_new RENAME TO purchases;
+ALTER TABLE purchase_refunds_new RENAME TO purchase_refunds;
+
+CREATE INDEX IF NOT EXISTS idx_purchases_user ON purchases(user_id);
+CREATE INDEX IF NOT EXISTS idx_purchases_event ON purchases(event_id);
+CREATE INDEX IF NOT EXISTS idx_purchases_created ON purchases(created_at);
+CREATE INDEX IF NOT EXISTS idx_purchases_integration_order ON purchases(integration_id, external_order_id);
+CREATE INDEX IF NOT EXISTS idx_purchase_refunds_purchase ON purchase_refunds(purchase_id);
+
+-- Redemptions recorded before this migration are assumed to be in USD
+CREATE TABLE code_redemptions_new (
+    id TEXT PRIMARY KEY,
+    code_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    order_id TEXT,
+    amount_minor INTEGER NOT NULL, -- order amount in minor units
+    discount_minor INTEGER NOT NULL DEFAULT 0,
+    currency TEXT NOT NULL DEFAULT 'USD', -- ISO 4217 code
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (code_id) REFERENCES discount_codes(id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    UNIQUE(code_id, order_id)
+);
+
+INSERT INTO code_redemptions_new (id, code_id, user_id, order_id, amount_minor, discount_minor, currency, created_at)
+SELECT id, code_id, user_id, order_id, CAST(ROUND(amount * 100) AS INTEGER), CAST(ROUND(COALESCE(discount_applied, 0) * 100) AS INTEGER),
+       'USD', created_at
+FROM code_redemptions;
+
+DROP TABLE code_redemptions;
+ALTER TABLE code_redemptions_new RENAME TO code_redemptions;
+
+CREATE INDEX IF NOT EXISTS idx_code_redemptions_code ON code_redemptions(code_id);
+CREATE INDEX IF NOT EXISTS idx_code_redemptions_user ON code_redemptions(user_id);
+CREATE INDEX IF NOT EXISTS idx_code_redemptions_created ON code_redemptions(created_at);
+
+-- Exchange rates loaded from a rates file. rate is the price of one unit of
+-- base_currency in currency; every row of a load shares the base currency.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency TEXT PRIMARY KEY,
+    base_currency TEXT NOT NULL,
+    rate REAL NOT NULL CHECK (rate > 0),
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE brands ADD COLUMN reporting_currency TEXT; -- NULL reports in the base currency of the exchange rates
@@ -0,0 +1,32 @@
+-- Auth Tokens Migration
+-- Stores refresh tokens and the access token revocation list. Refresh tokens
+-- are opaque and stored only as a SHA-256 hash. Every login starts a session
+-- and each refresh rotates the session's token; presenting a rotated token
+-- again revokes the whole session.
+
+CREATE TABLE refresh_tokens (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    principal_type TEXT NOT NULL CHECK (principal_type IN ('user', 'brand_member', 'admin')),
+    subject TEXT NOT NULL, -- user, brand member or admin ID
+    brand_id TEXT, -- set for brand members
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    rotated_at DATETIME, -- set once the token has been exchanged
+    revoked_at DATETIME
+);
+
+CREATE INDEX idx_refresh_tokens_session ON refresh_tokens(session_id);
+CREATE INDEX idx_refresh_tokens_subject ON refresh_tokens(principal_type, subject);
+CREATE INDEX idx_refresh_tokens_expires ON refresh_tokens(expires_at);
+
+-- Revoked access tokens (by jti) and sessions (by "session:" + session ID),
+-- kept until the tokens they reject have expired
+CREATE TABLE revoked_tokens (
+    token_id TEXT PRIMARY KEY,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_revoked_tokens_expires ON revoked_tokens(expires_at);
@@ -0,0 +1,64 @@
+-- Brand Members Migration
+-- Brands become organizations with several members. A brand account is a
+-- person who can log in to the brand portal; memberships give an account a
+-- role within a brand, so one account can work on several brands. Members
+-- join through emailed invitations and everything they change is recorded in
+-- the brand audit log.
+
+CREATE TABLE IF NOT EXISTS brand_accounts (
+    id TEXT PRIMARY KEY,
+    email TEXT NOT NULL UNIQUE, -- stored lowercase
+    name TEXT NOT NULL,
+    password_hash TEXT, -- bcrypt; NULL for accounts that cannot log in with a password
+    last_login_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS brand_members (
+    brand_id TEXT NOT NULL,
+    account_id TEXT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'admin', 'analyst', 'content-reviewer', 'billing')),
+    invited_by TEXT, -- account that sent the accepted invitation
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (brand_id, account_id),
+    FOREIGN KEY (account_id) REFERENCES brand_accounts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_brand_members_account ON brand_members(account_id);
+
+CREATE TABLE IF NOT EXISTS brand_invitations (
+    id TEXT PRIMARY KEY,
+    brand_id TEXT NOT NULL,
+    email TEXT NOT NULL, -- stored lowercase
+    role TEXT NOT NULL CHECK (role IN ('owner', 'admin', 'analyst', 'content-reviewer', 'billing')),
+    token_hash TEXT NOT NULL UNIQUE, -- SHA-256 of the emailed token
+    invited_by TEXT, -- NULL for invitations created from the command line
+    expires_at DATETIME NOT NULL,
+    accepted_at DATETIME,
+    accepted_by TEXT,
+    revoked_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (invited_by) REFERENCES brand_accounts(id),
+    FOREIGN KEY (accepted_by) REFERENCES brand_accounts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_brand_invitations_brand ON brand_invitations(brand_id, email);
+
+CREATE TABLE IF NOT EXISTS brand_audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    brand_id TEXT NOT NULL,
+    actor_type TEXT NOT NULL, -- principal type, or 'system' for the command line
+    actor_id TEXT,
+    action TEXT NOT NULL, -- e.g. member.invited, or METHOD /route for other changes
+    target_type TEXT,
+    target_id TEXT,
+    details TEXT, -- JSON
+    ip_address TEXT,
+    user_agent TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_brand_audit_log_brand ON brand_audit_log(brand_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_brand_audit_log_actor ON brand_audit_log(brand_id, actor_id);
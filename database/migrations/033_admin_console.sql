@@ -0,0 +1,56 @@
+-- Admin Console Migration
+-- Platform admins get their own accounts with an optional TOTP second factor.
+-- Everything admins change, including impersonating a brand for support, is
+-- recorded in the admin audit log. Events can now belong to an organizer, and
+-- admins can disable user accounts.
+
+CREATE TABLE IF NOT EXISTS admin_accounts (
+    id TEXT PRIMARY KEY,
+    email TEXT NOT NULL UNIQUE, -- stored lowercase
+    name TEXT NOT NULL,
+    password_hash TEXT NOT NULL, -- bcrypt
+    totp_secret TEXT, -- encrypted with the credential master key; set once setup starts
+    totp_enabled_at DATETIME, -- NULL until a code confirmed the setup
+    totp_last_step INTEGER, -- last accepted TOTP time step, so a code works once
+    failed_login_count INTEGER NOT NULL DEFAULT 0,
+    locked_until DATETIME,
+    disabled_at DATETIME,
+    last_login_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    admin_id TEXT, -- NULL for changes made from the command line
+    action TEXT NOT NULL, -- e.g. brand.impersonated, or METHOD /route for other changes
+    target_type TEXT,
+    target_id TEXT,
+    details TEXT, -- JSON
+    ip_address TEXT,
+    user_agent TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (admin_id) REFERENCES admin_accounts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_created ON admin_audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_admin ON admin_audit_log(admin_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_target ON admin_audit_log(target_type, target_id);
+
+-- Organizers run events on behalf of brands
+CREATE TABLE IF NOT EXISTS organizers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    contact_email TEXT,
+    website TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_organizers_name ON organizers(name);
+
+ALTER TABLE events ADD COLUMN organizer_id INTEGER REFERENCES organizers(id);
+CREATE INDEX IF NOT EXISTS idx_events_organizer ON events(organizer_id);
+
+-- Disabled users cannot log in; their sessions are revoked when disabled
+ALTER TABLE users ADD COLUMN disabled_at DATETIME;
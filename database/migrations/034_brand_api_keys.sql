@@ -0,0 +1,21 @@
+-- Brand API Keys Migration
+-- Brands integrate their own systems, such as BI tools, with API keys instead
+-- of a member logging in. A key belongs to a brand, is limited to a set of
+-- scopes (brand permissions) and expires. Only a hash of the key is stored.
+
+CREATE TABLE IF NOT EXISTS brand_api_keys (
+    id TEXT PRIMARY KEY,
+    brand_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    key_prefix TEXT NOT NULL, -- start of the key, shown to tell keys apart
+    key_hash TEXT NOT NULL UNIQUE, -- SHA-256 of the key
+    scopes TEXT NOT NULL, -- JSON array of permissions
+    created_by TEXT, -- brand account that created the key; NULL when an admin did
+    expires_at DATETIME NOT NULL,
+    last_used_at DATETIME,
+    last_used_ip TEXT,
+    revoked_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_brand_api_keys_brand ON brand_api_keys(brand_id, created_at);
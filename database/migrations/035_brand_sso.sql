@@ -0,0 +1,49 @@
+-- Brand Single Sign-On Migration
+-- Brand members can log in through an OpenID Connect provider. Provider
+-- identities are linked to brand accounts, which are created on first login
+-- when needed. Brands can claim email domains, whose users join the brand
+-- automatically on their first single sign-on.
+
+CREATE TABLE IF NOT EXISTS brand_sso_identities (
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL, -- "sub" of the provider's ID tokens
+    account_id TEXT NOT NULL,
+    email TEXT, -- as last reported by the provider
+    last_login_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (issuer, subject),
+    FOREIGN KEY (account_id) REFERENCES brand_accounts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_brand_sso_identities_account ON brand_sso_identities(account_id);
+
+CREATE TABLE IF NOT EXISTS brand_sso_domains (
+    brand_id TEXT NOT NULL,
+    domain TEXT NOT NULL, -- stored lowercase, e.g. example.com
+    role TEXT NOT NULL CHECK (role IN ('admin', 'analyst', 'content-reviewer', 'billing')),
+    created_by TEXT, -- admin account; NULL when created from the command line
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (brand_id, domain)
+);
+
+CREATE INDEX IF NOT EXISTS idx_brand_sso_domains_domain ON brand_sso_domains(domain);
+
+-- Logins in progress, between sending the browser to the provider and its callback
+CREATE TABLE IF NOT EXISTS brand_sso_requests (
+    state_hash TEXT PRIMARY KEY, -- SHA-256 of the state parameter
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL, -- PKCE
+    brand_id TEXT, -- brand to log in to; NULL for the account's first brand
+    redirect_path TEXT, -- portal page to return to
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One-time codes the brand portal exchanges for tokens after the callback
+CREATE TABLE IF NOT EXISTS brand_sso_logins (
+    code_hash TEXT PRIMARY KEY, -- SHA-256 of the code
+    account_id TEXT NOT NULL,
+    brand_id TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
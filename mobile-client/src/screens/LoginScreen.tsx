@@ -62,6 +62,7 @@ export default function LoginScreen({ route, navigation }: any) {
       
       // Set token and user role in API service
       apiService.setToken(response.token);
+      apiService.setRefreshToken(response.refreshToken);
       apiService.setUserRole(userType);
       
       // Dispatch login action with role
@@ -6,12 +6,18 @@ const API_BASE_URL = 'http://localhost:8080';
 
 class ApiService {
   private token: string | null = null;
+  private refreshToken: string | null = null;
+  private refreshing: Promise<boolean> | null = null;
   private userRole: string | null = null;
 
   setToken(token: string) {
     this.token = token;
   }
 
+  setRefreshToken(refreshToken: string) {
+    this.refreshToken = refreshToken;
+  }
+
   setUserRole(role: string) {
     this.userRole = role;
   }
@@ -27,7 +33,36 @@ class ApiService {
     }
   }
 
-  private async request(endpoint: string, options: RequestInit = {}) {
+  // Exchanges the refresh token for a new token pair. Concurrent requests share
+  // one refresh, as every refresh token can only be used once.
+  private refreshSession(): Promise<boolean> {
+    if (!this.refreshing) {
+      this.refreshing = (async () => {
+        if (!this.refreshToken) {
+          return false;
+        }
+        const response = await fetch(`${API_BASE_URL}/api/v1/auth/refresh`, {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ refreshToken: this.refreshToken }),
+        });
+        if (!response.ok) {
+          this.token = null;
+          this.refreshToken = null;
+          return false;
+        }
+        const pair = await response.json();
+        this.token = pair.token;
+        this.refreshToken = pair.refreshToken;
+        return true;
+      })().finally(() => {
+        this.refreshing = null;
+      });
+    }
+    return this.refreshing;
+  }
+
+  private async request(endpoint: string, options: RequestInit = {}, retried = false): Promise<any> {
     const baseUrl = endpoint.startsWith('/api/v1') ? API_BASE_URL : this.getBaseUrl();
     const url = `${baseUrl}${endpoint}`;
     
@@ -38,6 +73,13 @@ class ApiService {
     };
 
     const response = await fetch(url, { ...options, headers });
+
+    // Access tokens are short lived; refresh once and retry
+    if (response.status === 401 && !retried && this.token && !endpoint.startsWith('/api/v1/auth/')) {
+      if (await this.refreshSession()) {
+        return this.request(endpoint, options, true);
+      }
+    }
     
     if (!response.ok) {
       throw new Error(`API Error: ${response.status}`);
@@ -433,7 +475,15 @@ class ApiService {
 
   // Logout method
   logout() {
+    if (this.token) {
+      // Revoke the session on the server; the local session is gone either way
+      fetch(`${API_BASE_URL}/api/v1/auth/logout`, {
+        method: 'POST',
+        headers: { Authorization: `Bearer ${this.token}` },
+      }).catch(() => undefined);
+    }
     this.token = null;
+    this.refreshToken = null;
     this.userRole = null;
   }
 }